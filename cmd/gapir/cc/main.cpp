@@ -34,6 +34,7 @@
 #include "core/cc/version.h"
 
 #include <signal.h>
+#include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
@@ -95,6 +96,7 @@ struct Options {
     bool enabled = false;
     bool cleanUp = false;
     const char* path = "";
+    size_t maxSize = 0;
   };
 
   int logLevel = LOG_LEVEL;
@@ -134,6 +136,9 @@ struct Options {
     GAPID_WARNING(
         "    If set, then gapir will create and use a disk cache for "
         "resources.\n");
+    GAPID_WARNING(
+        "    On Android, the cache is kept in the app's cache directory and\n"
+        "    deleted when gapir exits.\n");
     GAPID_WARNING("  --disk-cache-path string\n");
     GAPID_WARNING(
         "    Path to a directory that will be used for the disk cache.\n");
@@ -143,6 +148,10 @@ struct Options {
     GAPID_WARNING("  --cleanup-disk-cache\n");
     GAPID_WARNING(
         "    If set, the disk cache will be deleted when gapir exits.\n");
+    GAPID_WARNING("  --disk-cache-size-mb int\n");
+    GAPID_WARNING(
+        "    The maximum size of the disk cache, all the cached resources are\n"
+        "    evicted when it is full. If unset, the size is unlimited.\n");
     GAPID_WARNING("  --port int\n");
     GAPID_WARNING("    The port to use when listening for connections\n");
     GAPID_WARNING("  --log-level <F|E|W|I|D|V>\n");
@@ -211,7 +220,6 @@ struct Options {
         }
         opts->authTokenFile = argv[++i];
       } else if (strcmp(argv[i], "--enable-disk-cache") == 0) {
-        ensureNotAndroid("--enable-disk-cache");
         opts->SetMode(kReplayServer);
         opts->onDiskCacheOptions.enabled = true;
       } else if (strcmp(argv[i], "--disk-cache-path") == 0) {
@@ -221,6 +229,22 @@ struct Options {
           GAPID_FATAL("Usage: --disk-cache-path <cache-directory>");
         }
         opts->onDiskCacheOptions.path = argv[++i];
+      } else if (strcmp(argv[i], "--disk-cache-size-mb") == 0) {
+        opts->SetMode(kReplayServer);
+        if (i + 1 >= argc) {
+          GAPID_FATAL("Usage: --disk-cache-size-mb <size in MB>");
+        }
+        const char* arg = argv[++i];
+        char* end = nullptr;
+        long size = strtol(arg, &end, 10);
+        if (end == arg || *end != '\0' || size <= 0 ||
+            static_cast<unsigned long>(size) > SIZE_MAX / (1024 * 1024)) {
+          GAPID_FATAL(
+              "Usage: --disk-cache-size-mb <size in MB>, invalid size: %s",
+              arg);
+        }
+        opts->onDiskCacheOptions.maxSize =
+            static_cast<size_t>(size) * 1024 * 1024;
       } else if (strcmp(argv[i], "--cleanup-on-disk-cache") == 0) {
         ensureNotAndroid("--cleanup-on-disk-cache");
         opts->onDiskCacheOptions.cleanUp = true;
@@ -713,8 +737,18 @@ void android_main(struct android_app* app) {
   std::unique_ptr<Server> server = nullptr;
   std::shared_ptr<MemoryAllocator> allocator = createAllocator();
   MemoryManager memoryManager(allocator);
-  auto cache =
-      InMemoryResourceCache::create(allocator, allocator->getTotalSize());
+  std::unique_ptr<ResourceCache> cache;
+  if (opts.onDiskCacheOptions.enabled) {
+    // The resources are kept in the app's cache directory, keyed by their
+    // content hash, such that repeated replays of the session, e.g. when
+    // profiling, don't upload them again. The cache is deleted when GAPIR
+    // exits, ending the session.
+    cache = OnDiskResourceCache::create(getCacheDir(app) + "/resources", true,
+                                        opts.onDiskCacheOptions.maxSize);
+  }
+  if (cache == nullptr) {
+    cache = InMemoryResourceCache::create(allocator, allocator->getTotalSize());
+  }
   std::mutex lock;
   PrewarmData data;
 
@@ -849,8 +883,8 @@ std::unique_ptr<ResourceCache> createCache(
         "cache.");
     return InMemoryResourceCache::create(allocator, allocator->getTotalSize());
   }
-  auto onDiskCache =
-      OnDiskResourceCache::create(onDiskCachePath, cleanUpOnDiskCache);
+  auto onDiskCache = OnDiskResourceCache::create(
+      onDiskCachePath, cleanUpOnDiskCache, onDiskCacheOpts.maxSize);
   if (onDiskCache == nullptr) {
     GAPID_WARNING(
         "On-disk cache creation failed, fallback to use in-memory cache");
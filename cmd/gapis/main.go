@@ -20,6 +20,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -53,6 +54,7 @@ var (
 	gapisAuthToken   = flag.String("gapis-auth-token", "", "_The connection authorization token for gapis")
 	gapirAuthToken   = flag.String("gapir-auth-token", "", "_The connection authorization token for gapir")
 	gapirArgStr      = flag.String("gapir-args", "", "_The arguments to be passed to the host-run gapir")
+	gapirDiskCache   = flag.Int("gapir-disk-cache-mb", 0, "Size in MB of the disk cache of the replay resources on Android devices, deleted when the replay session ends; leave 0 to disable")
 	scanAndroidDevs  = flag.Bool("monitor-android-devices", true, "Server will scan for locally connected Android devices")
 	scanFuchsiaDevs  = flag.Bool("monitor-fuchsia-devices", true, "Server will scan for locally connected Fuchsia devices")
 	androidSerial    = flag.String("android-serial", "", "Server will only consider the Android device with this serial id")
@@ -62,6 +64,12 @@ var (
 	enableLocalFiles = flag.Bool("enable-local-files", false, "Allow clients to access local .gfxtrace files by path")
 	remoteSSHConfig  = flag.String("ssh-config", "", "_Path to an ssh config file for remote devices")
 	preloadDepGraph  = flag.Bool("preload-dep-graph", true, "_Preload the dependency graph when loading captures")
+	profileHistory   = flag.String("profile-history", "", "Path to a file recording all GPU profiling runs; leave empty to disable")
+	calibrationFile  = flag.String("counter-calibration", "", "Path to a file rating the reliability of the GPU counters; leave empty to disable")
+	aclFile          = flag.String("acl", "", "Path to a file listing the accepted auth tokens and their role, read-only or read-write, one per line")
+	deviceFarm       = flag.String("device-farm", "", "Device farm to lease replay devices from, either exec:<adapter command> or grpc:<host:port>; leave empty to disable")
+	presetsFile      = flag.String("presets", "", "Path to a file storing the named capture and profiling presets; leave empty to disable")
+	readOnly         = flag.Bool("read-only", false, "Only allow the RPCs that don't modify the server state, e.g. to share processed profiling data")
 )
 
 func main() {
@@ -143,6 +151,19 @@ func run(ctx context.Context) error {
 		onDeviceScanDone(ctx)
 	})
 
+	var acl auth.ACL
+	if *aclFile != "" {
+		f, err := os.Open(*aclFile)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to open the ACL file %v", *aclFile)
+		}
+		acl, err = auth.ParseACL(f)
+		f.Close()
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to parse the ACL file %v", *aclFile)
+		}
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		return log.Err(ctx, err, "Failed to retrieve hostname")
@@ -157,16 +178,34 @@ func run(ctx context.Context) error {
 			Features:          features,
 			ServerLocalDevice: hostDevice,
 		},
-		StringTables:     loadStrings(ctx),
-		EnableLocalFiles: *enableLocalFiles,
-		PreloadDepGraph:  *preloadDepGraph,
-		AuthToken:        auth.Token(*gapisAuthToken),
-		DeviceScanDone:   deviceScanDone,
-		LogBroadcaster:   logBroadcaster,
-		IdleTimeout:      *idleTimeout,
+		StringTables:       loadStrings(ctx),
+		EnableLocalFiles:   *enableLocalFiles,
+		PreloadDepGraph:    *preloadDepGraph,
+		AuthToken:          auth.Token(*gapisAuthToken),
+		DeviceScanDone:     deviceScanDone,
+		LogBroadcaster:     logBroadcaster,
+		IdleTimeout:        *idleTimeout,
+		ProfileHistory:     *profileHistory,
+		CounterCalibration: *calibrationFile,
+		DeviceFarm:         *deviceFarm,
+		Presets:            *presetsFile,
+		ACL:                acl,
+		ReadOnly:           *readOnly,
 	})
 }
 
+// androidGapirArgs returns the arguments passed to the gapir of the Android
+// devices.
+func androidGapirArgs() []string {
+	args := text.SplitArgs(*gapirArgStr)
+	if *gapirDiskCache > 0 {
+		// Keep the replay resources on the device, such that repeated replays,
+		// e.g. when profiling, don't upload them again.
+		args = append(args, "--enable-disk-cache", "--disk-cache-size-mb", strconv.Itoa(*gapirDiskCache))
+	}
+	return args
+}
+
 func monitorAndroidDevices(ctx context.Context, r *bind.Registry, scanDone func()) {
 	// Populate the registry with all the existing devices.
 	func() {
@@ -175,7 +214,7 @@ func monitorAndroidDevices(ctx context.Context, r *bind.Registry, scanDone func(
 		if devs, err := adb.Devices(ctx); err == nil {
 			for _, d := range devs {
 				r.AddDevice(ctx, d)
-				r.SetDeviceProperty(ctx, d, client.LaunchArgsKey, text.SplitArgs(*gapirArgStr))
+				r.SetDeviceProperty(ctx, d, client.LaunchArgsKey, androidGapirArgs())
 			}
 		}
 	}()
@@ -0,0 +1,161 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/layout"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/calibration"
+	"github.com/google/gapid/gapis/history"
+	"github.com/google/gapid/gapis/service"
+)
+
+type calibrateVerb struct{ CalibrateFlags }
+
+func init() {
+	verb := &calibrateVerb{CalibrateFlags{Runs: 5}}
+	app.AddVerb(&app.Verb{
+		Name:       "calibrate",
+		ShortHelp:  "Measures the run-to-run variance of the GPU counters and the timer resolution of a device",
+		ShortUsage: "[<gfx trace file>]",
+		Action:     verb,
+	})
+}
+
+func (verb *calibrateVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() > 1 {
+		app.Usage(ctx, "At most one gfx trace file expected, used instead of the standard calibration workload, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Out == "" {
+		app.Usage(ctx, "The output calibration file must be specified")
+		return nil
+	}
+	if verb.History != "" {
+		if flags.NArg() != 0 {
+			app.Usage(ctx, "A gfx trace file can't be replayed when calibrating from a profiling history")
+			return nil
+		}
+		return verb.fromHistory(ctx)
+	}
+	if verb.Runs < 3 {
+		app.Usage(ctx, "At least 3 runs are needed to measure the variance, got %d", verb.Runs)
+		return nil
+	}
+
+	var capture string
+	if flags.NArg() == 1 {
+		path, err := filepath.Abs(flags.Arg(0))
+		if err != nil {
+			return log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
+		}
+		capture = path
+	} else {
+		path, err := layout.CalibrationTrace(ctx)
+		if err != nil {
+			return log.Err(ctx, err, "Could not find the standard calibration workload, pass a gfx trace file instead")
+		}
+		capture = path.System()
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, GapirFlags{})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	capturePath, err := client.LoadCapture(ctx, capture)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the capture file")
+	}
+	devicePath, err := getDevice(ctx, client, capturePath, GapirFlags{DeviceFlags: verb.DeviceFlags})
+	if err != nil {
+		return err
+	}
+	if devicePath == nil {
+		return log.Err(ctx, nil, "A device is required for the calibration")
+	}
+	boxedDevice, err := client.Get(ctx, devicePath.Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Couldn't resolve device")
+	}
+	dev := boxedDevice.(*device.Instance)
+
+	runs := []*service.ProfilingRun{}
+	resolution := uint64(0)
+	fillRate, bandwidth := 0.0, 0.0
+	for i := 0; i < verb.Runs; i++ {
+		log.I(ctx, "Calibration run %d of %d", i+1, verb.Runs)
+		data, err := client.GpuProfile(ctx, &service.GpuProfileRequest{
+			Capture: capturePath,
+			Device:  devicePath,
+		})
+		if err != nil {
+			return log.Errf(ctx, err, "Calibration run %d failed", i+1)
+		}
+		runs = append(runs, history.NewRun(capturePath, filepath.Base(capture), dev, data))
+		if r := calibration.TimerResolution(data.Slices); r > 0 && (resolution == 0 || r < resolution) {
+			resolution = r
+		}
+		f, b := calibration.PeakRates(data.Counters)
+		fillRate, bandwidth = math.Max(fillRate, f), math.Max(bandwidth, b)
+	}
+
+	res := calibration.FromRuns(runs)
+	for _, d := range res.Devices {
+		d.TimerResolution = resolution
+		d.FillRate, d.Bandwidth = fillRate, bandwidth
+		log.I(ctx, "Calibrated %d counters of %v, timer resolution %dns, peak fill rate %.3g pixels/s, peak bandwidth %.3g bytes/s",
+			len(d.Counters), d.GpuName, resolution, fillRate, bandwidth)
+	}
+
+	return verb.save(ctx, res)
+}
+
+// fromHistory rates the counters of the runs of the profiling history, rather
+// than of new runs of a workload.
+func (verb *calibrateVerb) fromHistory(ctx context.Context) error {
+	db, err := history.Open(ctx, verb.History)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to open the profiling history %v", verb.History)
+	}
+	res := calibration.FromRuns(db.Query(nil))
+	for _, d := range res.Devices {
+		log.I(ctx, "Calibrated %d counters of %v", len(d.Counters), d.GpuName)
+	}
+	return verb.save(ctx, res)
+}
+
+// save writes the calibration to the output file, keeping the calibration of
+// the other devices already in the file.
+func (verb *calibrateVerb) save(ctx context.Context, res *service.CounterCalibration) error {
+	if _, err := os.Stat(verb.Out); err == nil {
+		existing, err := calibration.Load(ctx, verb.Out)
+		if err != nil {
+			return err
+		}
+		calibration.Merge(existing, res)
+		res = existing
+	}
+	return calibration.Save(ctx, verb.Out, res)
+}
@@ -80,7 +80,7 @@ func (verb *coarseProfileVerb) Run(ctx context.Context, flags flag.FlagSet) erro
 	reportWriter := csv.NewWriter(out)
 	defer reportWriter.Flush()
 
-	header := []string{"BeginCmd", "EndCmd", "Time(ns)"}
+	header := []string{"BeginCmd", "EndCmd", fmt.Sprintf("Time(%v)", verb.TimeUnit)}
 	if err = reportWriter.Write(header); err != nil {
 		log.Err(ctx, err, "Failed to write header")
 	}
@@ -99,7 +99,7 @@ func (verb *coarseProfileVerb) Run(ctx context.Context, flags flag.FlagSet) erro
 			for _, t := range ts.Timestamps {
 				begin := cmdToString(t.Begin)
 				end := cmdToString(t.End)
-				record := []string{begin, end, fmt.Sprint(t.TimeInNanoseconds)}
+				record := []string{begin, end, verb.TimeUnit.format(int64(t.TimeInNanoseconds))}
 				if err := reportWriter.Write(record); err != nil {
 					log.Err(ctx, err, "Failed to write record")
 				}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/google/gapid/core/app/flags"
 	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
 )
 
 const (
@@ -56,6 +57,52 @@ const (
 	OutputJson
 )
 
+const (
+	SpecLast CounterSpecPolicy = iota
+	SpecFirst
+	SpecDefault
+)
+
+const (
+	DedupSuffix CounterDedupPolicy = iota
+	DedupMerge
+	DedupKeepFirst
+)
+
+const (
+	SourcesDescriptor CounterSources = iota
+	SourcesNamed
+	SourcesAll
+)
+
+const (
+	SliceDedupDrop SliceDedupPolicy = iota
+	SliceDedupKeep
+)
+
+const (
+	ErrorsContinue ErrorPolicy = iota
+	ErrorsFail
+	ErrorsQuiet
+)
+
+const (
+	UnitNanoseconds TimeUnit = iota
+	UnitMicroseconds
+	UnitMilliseconds
+)
+
+const (
+	TimebaseTraceStart Timebase = iota
+	TimebaseFirstFrame
+	TimebaseBoottime
+)
+
+const (
+	ExportCsv ExportFormat = iota
+	ExportJson
+)
+
 type VideoType uint8
 
 var videoTypeNames = map[VideoType]string{
@@ -136,6 +183,167 @@ func (v PerfettoOutputFormat) String() string {
 	return PerfettoOutputFormatNames[v]
 }
 
+type CounterSpecPolicy uint8
+
+var counterSpecPolicyNames = map[CounterSpecPolicy]string{
+	SpecLast:    "last",
+	SpecFirst:   "first",
+	SpecDefault: "default",
+}
+
+var counterSpecPolicies = map[CounterSpecPolicy]service.CounterSpecMergePolicy{
+	SpecLast:    service.CounterSpecMergePolicy_LastSpec,
+	SpecFirst:   service.CounterSpecMergePolicy_FirstSpec,
+	SpecDefault: service.CounterSpecMergePolicy_PreferSelectedByDefault,
+}
+
+func (v *CounterSpecPolicy) Choose(c interface{}) {
+	*v = c.(CounterSpecPolicy)
+}
+func (v CounterSpecPolicy) String() string {
+	return counterSpecPolicyNames[v]
+}
+
+type CounterDedupPolicy uint8
+
+var counterDedupPolicyNames = map[CounterDedupPolicy]string{
+	DedupSuffix:    "suffix",
+	DedupMerge:     "merge",
+	DedupKeepFirst: "keep-first",
+}
+
+var counterDedupPolicies = map[CounterDedupPolicy]service.CounterDedupPolicy{
+	DedupSuffix:    service.CounterDedupPolicy_SuffixDuplicates,
+	DedupMerge:     service.CounterDedupPolicy_MergeDuplicates,
+	DedupKeepFirst: service.CounterDedupPolicy_KeepFirstDuplicate,
+}
+
+func (v *CounterDedupPolicy) Choose(c interface{}) {
+	*v = c.(CounterDedupPolicy)
+}
+func (v CounterDedupPolicy) String() string {
+	return counterDedupPolicyNames[v]
+}
+
+type CounterSources uint8
+
+var counterSourcesNames = map[CounterSources]string{
+	SourcesDescriptor: "descriptor",
+	SourcesNamed:      "named",
+	SourcesAll:        "all",
+}
+
+var counterSourcePolicies = map[CounterSources]service.CounterSourcePolicy{
+	SourcesDescriptor: service.CounterSourcePolicy_PreferDescriptorSource,
+	SourcesNamed:      service.CounterSourcePolicy_PreferNamedSource,
+	SourcesAll:        service.CounterSourcePolicy_KeepAllSources,
+}
+
+func (v *CounterSources) Choose(c interface{}) {
+	*v = c.(CounterSources)
+}
+func (v CounterSources) String() string {
+	return counterSourcesNames[v]
+}
+
+var captureAnalyses = map[string]service.CaptureAnalysis{
+	"passes":      service.CaptureAnalysis_RenderPassAnalysis,
+	"descriptors": service.CaptureAnalysis_DescriptorAnalysis,
+	"queues":      service.CaptureAnalysis_QueueAnalysis,
+	"memory":      service.CaptureAnalysis_MemoryAnalysis,
+}
+
+var allCaptureAnalyses = []service.CaptureAnalysis{
+	service.CaptureAnalysis_RenderPassAnalysis,
+	service.CaptureAnalysis_DescriptorAnalysis,
+	service.CaptureAnalysis_QueueAnalysis,
+	service.CaptureAnalysis_MemoryAnalysis,
+}
+
+type SliceDedupPolicy uint8
+
+var sliceDedupPolicyNames = map[SliceDedupPolicy]string{
+	SliceDedupDrop: "drop",
+	SliceDedupKeep: "keep",
+}
+
+var sliceDedupPolicies = map[SliceDedupPolicy]service.SliceDedupPolicy{
+	SliceDedupDrop: service.SliceDedupPolicy_DropDuplicateSlices,
+	SliceDedupKeep: service.SliceDedupPolicy_KeepDuplicateSlices,
+}
+
+func (v *SliceDedupPolicy) Choose(c interface{}) {
+	*v = c.(SliceDedupPolicy)
+}
+func (v SliceDedupPolicy) String() string {
+	return sliceDedupPolicyNames[v]
+}
+
+type ErrorPolicy uint8
+
+var errorPolicyNames = map[ErrorPolicy]string{
+	ErrorsContinue: "continue",
+	ErrorsFail:     "fail",
+	ErrorsQuiet:    "quiet",
+}
+
+var errorPolicies = map[ErrorPolicy]service.ProfilingErrorPolicy{
+	ErrorsContinue: service.ProfilingErrorPolicy_ContinueOnError,
+	ErrorsFail:     service.ProfilingErrorPolicy_FailOnError,
+	ErrorsQuiet:    service.ProfilingErrorPolicy_QuietOnError,
+}
+
+func (v *ErrorPolicy) Choose(c interface{}) {
+	*v = c.(ErrorPolicy)
+}
+func (v ErrorPolicy) String() string {
+	return errorPolicyNames[v]
+}
+
+type TimeUnit uint8
+
+var timeUnitNames = map[TimeUnit]string{
+	UnitNanoseconds:  "ns",
+	UnitMicroseconds: "us",
+	UnitMilliseconds: "ms",
+}
+
+func (v *TimeUnit) Choose(c interface{}) {
+	*v = c.(TimeUnit)
+}
+func (v TimeUnit) String() string {
+	return timeUnitNames[v]
+}
+
+type Timebase uint8
+
+var timebaseNames = map[Timebase]string{
+	TimebaseTraceStart: "trace-start",
+	TimebaseFirstFrame: "first-frame",
+	TimebaseBoottime:   "boottime",
+}
+
+func (v *Timebase) Choose(c interface{}) {
+	*v = c.(Timebase)
+}
+func (v Timebase) String() string {
+	return timebaseNames[v]
+}
+
+type ExportFormat uint8
+
+var exportFormatNames = map[ExportFormat]string{
+	ExportCsv:  "csv",
+	ExportJson: "json",
+}
+
+func (v *ExportFormat) Choose(c interface{}) {
+	*v = c.(ExportFormat)
+}
+func (v ExportFormat) String() string {
+	return exportFormatNames[v]
+}
+
 type (
 	CaptureFileFlags struct {
 		CaptureID bool `help:"if true then interpret the capture file argument as a capture ID that is already loaded in gapis"`
@@ -160,6 +368,15 @@ type (
 		Gapis GapisFlags
 		OS    device.OSKind `help:"Only display devices of the given OS kind"`
 	}
+	PresetsFlags struct {
+		Gapis  GapisFlags
+		Save   string `help:"Store the preset in this text format Preset proto file on the server, replacing any preset of the same name"`
+		Delete string `help:"Remove the preset of this name from the server"`
+	}
+	WirelessFlags struct {
+		Code    string `help:"the pairing code shown by the device, pairs with the device at the address"`
+		Connect string `help:"the address to connect to after pairing, if different from the pairing address"`
+	}
 	ProfileFlags struct {
 		Pprof string `help:"_produce a pprof file"`
 		Trace string `help:"_produce a trace file"`
@@ -334,6 +551,9 @@ type (
 		WaitForDebugger     bool   `help:"Make GAPII wait for a debugger to attach"`
 		ProcessName         string `help:"Name of the process to capture. Default to empty, i.e. capture any process. Useful for games that fork processes."`
 		LoadValidationLayer bool   `help:"Load Vulkan validation layer at capture time, under the spy layer, to debug spy bugs. Android only."`
+		VulkanLayers        string `help:"File containing the VulkanLayerConfig proto of additional layers to load, and their settings. Android only."`
+		Preset              string `help:"Name of the server's preset providing the tracing options, e.g. the duration and Perfetto config, not given on the command line"`
+		Triggers            string `help:"File containing the TraceTriggers proto of the conditions, e.g. a frame time, starting and stopping the trace automatically. Android only."`
 	}
 	BenchmarkFlags struct {
 		Gapis      GapisFlags
@@ -423,17 +643,70 @@ type (
 	GetTimestampsFlags struct {
 		Gapis     GapisFlags
 		Gapir     GapirFlags
-		LoopCount int    `help:"_The number of times to loop the trace. (experimental)"`
-		Out       string `help:"output file to save the profiling result"`
+		LoopCount int      `help:"_The number of times to loop the trace. (experimental)"`
+		Out       string   `help:"output file to save the profiling result"`
+		TimeUnit  TimeUnit `help:"Unit of the exported times: {ns|us|ms}. Default: ns."`
 	}
 
 	GpuProfileFlags struct {
-		Gapis        GapisFlags
-		Gapir        GapirFlags
-		Out          string           `help:"Output file (optional, if none then output goes to stdout)"`
-		Json         bool             `help:"Return replay profiling data as JSON instead of text"`
-		DisabledCmds []flags.U64Slice `help:"command/subcommand index (e.g. '[123, 0, 0, 4]') for disabling a draw call (repeatable)"`
-		DisableAF    bool             `help:"Disable Anisotropic Filtering for all samplers"`
+		Gapis         GapisFlags
+		Gapir         GapirFlags
+		Out           string             `help:"Output file (optional, if none then output goes to stdout)"`
+		Json          bool               `help:"Return replay profiling data as JSON instead of text"`
+		DisabledCmds  []flags.U64Slice   `help:"command/subcommand index (e.g. '[123, 0, 0, 4]') for disabling a draw call (repeatable)"`
+		DisableAF     bool               `help:"Disable Anisotropic Filtering for all samplers"`
+		BisectCmdBuf  bool               `help:"Attribute counters to command buffers by replaying with parts of each submission disabled"`
+		SpecPolicy    CounterSpecPolicy  `help:"Spec used for counters with several specs of the same name: {last|first|default}. Default: last."`
+		PrimeCaches   bool               `help:"Replay the capture once untimed before profiling, to warm up the pipeline caches"`
+		RawArgs       bool               `help:"Include the raw Perfetto arguments of each GPU slice"`
+		FrameBudget   time.Duration      `help:"Target frame time (e.g. '16.6ms'); flags the frames exceeding it"`
+		Overhead      bool               `help:"Replay once more without counters to measure the overhead of collecting them"`
+		Frames        flags.U64Slice     `help:"First and last frame to profile, inclusive (e.g. '[10, 12]'); the frames before are replayed untimed"`
+		Overrides     string             `help:"JSON or text proto file of CounterOverrides that rename, fix the units of, hide or select counters"`
+		Dedup         CounterDedupPolicy `help:"Handling of counter tracks with the same name: {suffix|merge|keep-first}. Default: suffix."`
+		Sources       CounterSources     `help:"Producer kept of the counters published by several producers under prefixed names: {descriptor|named|all}. Default: descriptor, the producer of the device's counters."`
+		Source        string             `help:"Name prefix of the producer kept with -sources named (e.g. 'HAL')"`
+		Bundle        string             `help:"Also save the capture, trace, device and profile as an .agiz bundle to this file"`
+		Fingerprint   bool               `help:"Include the anonymized performance fingerprint of the device in the profile"`
+		AllCounters   bool               `help:"Collect all the GPU counters, rather than only those of the GPU features used by the capture"`
+		Validate      bool               `help:"Replay with the Vulkan validation layers before profiling and report their errors and warnings"`
+		SliceDedup    SliceDedupPolicy   `help:"Handling of GPU slices duplicated on several tracks: {drop|keep}. Default: drop."`
+		Errors        ErrorPolicy        `help:"Handling of the sections of the profile that fail to process: {continue|fail|quiet}. Default: continue, logging the errors."`
+		IgnoreSlices  flags.StringSlice  `help:"Regular expressions of the names of GPU slices excluded from the slice aggregates (e.g. '[^Driver, Flush]')"`
+		Farm          bool               `help:"Lease the replay device from the device farm of the server for the duration of the profile"`
+		FarmNeeds     flags.StringSlice  `help:"Constraints on the device leased with -farm, as key=value pairs defined by the farm (e.g. '[gpu=Adreno 640, sdk=30]')"`
+		Preset        string             `help:"Name of the server's preset providing the profiling options not given on the command line"`
+		SlicesCsv     string             `help:"Also export the GPU slices as CSV to this file"`
+		FramesCsv     string             `help:"Also export the frames as CSV to this file"`
+		TraceJson     string             `help:"Also export the GPU slices, render passes, markers and frames as Chrome trace event JSON to this file, e.g. to convert for Windows Performance Analyzer"`
+		TimeUnit      TimeUnit           `help:"Unit of the times exported as CSV: {ns|us|ms}. Default: ns."`
+		Timebase      Timebase           `help:"Origin of the exported timestamps: {trace-start|first-frame|boottime}. Default: trace-start."`
+		ReplaceShader string             `help:"Handle or ID of a shader to replace with the source of -shadersource, to also profile the replay with the replacement and report the difference"`
+		ShaderSource  string             `help:"File with the source of the replacement of the -replaceshader shader"`
+		Scales        flags.StringSlice  `help:"Resolution scales to also profile the replay at, to find the passes bound by the resolution (e.g. '[0.75, 0.5]')"`
+		SamplerSweep  bool               `help:"Also profile the replay with the samplers biased to smaller mip levels, and with nearest filtering, to measure how bound by the texture sampling it is"`
+		ShadingRate   string             `help:"Fragment size (e.g. '2x2') to also profile the replay at, to estimate the savings of variable rate shading. Requires VK_KHR_fragment_shading_rate"`
+		Calibrate     bool               `help:"Time the command buffers of the replay with timestamp queries to verify, and if needed correct, the GPU clock of the trace"`
+		RatePasses    flags.U64Slice     `help:"Decimal handles of the render passes shaded at the -shadingrate fragment size, as in the renderPass argument of the GPU slices (e.g. '[123, 456]'); all the render passes if empty"`
+		Buckets       uint               `help:"Aggregate the samples of each counter into at most this many buckets of min, max and average values, to shrink long profiles; 0 keeps all the samples"`
+		Sustained     bool               `help:"Enable the sustained performance mode of the device, or the vendor's equivalent, while profiling, such that runs are comparable"`
+		Analyses      flags.StringSlice  `help:"Analyses of the capture's commands added to the profile: {passes|descriptors|queues|memory|all} (e.g. '[passes, memory]'). The report verb defaults to all"`
+	}
+	ProfileReportFlags struct {
+		GpuProfileFlags
+		Pdf       bool `help:"Also convert the Markdown report to PDF with pandoc; requires -out"`
+		TopPasses int  `help:"Number of rendering passes, or slice labels, listed in the report"`
+	}
+	ProfileExportFlags struct {
+		GpuProfileFlags
+		Format ExportFormat `help:"Format of the export: {csv|json}. Default: csv, written as slices.csv, counters.csv and gpu_counters.csv to the -out directory."`
+		Data   string       `help:"Export the profiling data saved by 'gapit profile', as text proto or, if ending in .json, JSON, instead of profiling a capture"`
+	}
+
+	GenGoldensFlags struct {
+		Gapis GapisFlags
+		Gapir GapirFlags
+		Out   string `help:"Directory to write the goldens to (defaults to the current directory)"`
 	}
 
 	CreateGraphVisualizationFlags struct {
@@ -475,6 +748,34 @@ type (
 		Format     PerfettoOutputFormat `help:"Output file format: {text|json}."`
 	}
 
+	SqlFlags struct {
+		Gapis   GapisFlags
+		History string `help:"File to keep the statement history in, defaults to ~/.gapit_sql_history"`
+		MaxRows int    `help:"Maximum number of rows printed per statement, 0 for all"`
+		Profile bool   `help:"Profile the trace first, such that its slice groups and counters can be queried in the agi_group, agi_slice, agi_metric and agi_group_metric tables"`
+	}
+
+	PerfettoQueryFlags struct {
+		Gapis  GapisFlags
+		Gapir  GapirFlags
+		Query  string               `help:"The trace processor SQL query to run"`
+		In     string               `help:"File containing the SQL query to run, instead of -query"`
+		Out    string               `help:"Output file, standard output if none"`
+		Format PerfettoOutputFormat `help:"Output format: {text|json}. Default: text."`
+	}
+
+	TraceInfoFlags struct {
+		Gapis GapisFlags
+	}
+
+	CalibrateFlags struct {
+		DeviceFlags
+		Gapis   GapisFlags
+		Runs    int    `help:"Number of profiling runs of the workload. Default: 5."`
+		History string `help:"Rate the counters from the runs of this profiling history instead of running a workload."`
+		Out     string `help:"Output calibration file, merged with the file if it exists."`
+	}
+
 	SplitFlags struct {
 		Gapis GapisFlags
 		Gapir GapirFlags
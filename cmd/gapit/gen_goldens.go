@@ -0,0 +1,113 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// internalVerb groups the verbs used in the development of AGI itself.
+var internalVerb = app.AddVerb(&app.Verb{
+	Name:      "internal",
+	ShortHelp: "Tools for the development of AGI",
+})
+
+type genGoldensVerb struct{ GenGoldensFlags }
+
+func init() {
+	verb := &genGoldensVerb{}
+	internalVerb.Add(&app.Verb{
+		Name:       "gen-goldens",
+		ShortHelp:  "Profile captures and record the counter processing inputs and outputs as golden test data",
+		ShortUsage: "<gfx or Perfetto trace file>...",
+		Action:     verb,
+	})
+}
+
+func (verb *genGoldensVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() == 0 {
+		app.Usage(ctx, "At least one gfx or Perfetto trace file expected")
+		return nil
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	for _, arg := range flags.Args() {
+		capture, err := filepath.Abs(arg)
+		if err != nil {
+			return log.Errf(ctx, err, "Could not find capture file: %v", arg)
+		}
+
+		capturePath, err := client.LoadCapture(ctx, capture)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to load the capture file %v", capture)
+		}
+		boxedCapture, err := client.Get(ctx, capturePath.Path(), nil)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to load the capture %v", capture)
+		}
+
+		golden := &service.ProfilingGolden{}
+		var devicePath *path.Device
+		if boxedCapture.(*service.Capture).Type != service.TraceType_Perfetto {
+			devicePath, err = getDevice(ctx, client, capturePath, verb.Gapir)
+			if err != nil {
+				return err
+			}
+			boxedDevice, err := client.Get(ctx, devicePath.Path(), nil)
+			if err != nil {
+				return log.Err(ctx, err, "Couldn't resolve device")
+			}
+			golden.GpuCounterDescriptor = boxedDevice.(*device.Instance).GetConfiguration().
+				GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor()
+		}
+
+		golden.ProfilingData, err = client.GpuProfile(ctx, &service.GpuProfileRequest{
+			Capture:       capturePath,
+			Device:        devicePath,
+			RecordQueries: true,
+		})
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to profile %v", capture)
+		}
+
+		data, err := proto.Marshal(golden)
+		if err != nil {
+			return log.Err(ctx, err, "Couldn't marshal the golden")
+		}
+		name := strings.TrimSuffix(filepath.Base(capture), filepath.Ext(capture)) + ".golden"
+		out := filepath.Join(verb.Out, name)
+		if err := ioutil.WriteFile(out, data, 0644); err != nil {
+			return log.Errf(ctx, err, "Writing file (%v)", out)
+		}
+		log.I(ctx, "Wrote golden %v", out)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	perfetto "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+type perfettoQueryVerb struct{ PerfettoQueryFlags }
+
+func init() {
+	verb := &perfettoQueryVerb{}
+	app.AddVerb(&app.Verb{
+		Name:       "perfetto-query",
+		ShortHelp:  "Runs a trace processor SQL query against a Perfetto trace, or the profile of a capture",
+		ShortUsage: "<perfetto-trace or capture>",
+		Action:     verb,
+	})
+}
+
+func (verb *perfettoQueryVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one perfetto trace or capture file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	query := verb.Query
+	if verb.In != "" {
+		if query != "" {
+			app.Usage(ctx, "Only one of -query and -in can be given")
+			return nil
+		}
+		data, err := ioutil.ReadFile(verb.In)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to read the query file %v", verb.In)
+		}
+		query = string(data)
+	}
+	if query == "" {
+		app.Usage(ctx, "A query is expected, given by -query or -in")
+		return nil
+	}
+
+	file := flags.Arg(0)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return fmt.Errorf("Could not find trace file: %v", file)
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, verb.Gapir, file, CaptureFileFlags{})
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to load the trace file %v", file)
+	}
+	defer client.Close()
+
+	boxedCapture, err := client.Get(ctx, capture.Path(), nil)
+	if err != nil {
+		return log.Err(ctx, err, "Failed to load the capture")
+	}
+	if boxedCapture.(*service.Capture).Type != service.TraceType_Perfetto {
+		// Graphics captures are queried through the Perfetto trace of their
+		// profile.
+		device, err := getDevice(ctx, client, capture, verb.Gapir)
+		if err != nil {
+			return err
+		}
+		if _, err := client.GpuProfile(ctx, &service.GpuProfileRequest{Capture: capture, Device: device}); err != nil {
+			return log.Errf(ctx, err, "Failed to profile the capture %v", file)
+		}
+	}
+
+	res, err := client.PerfettoQuery(ctx, capture, query)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to run the query")
+	}
+	if res.GetError() != "" {
+		return log.Errf(ctx, nil, "Query failed: %v", res.GetError())
+	}
+
+	out := io.Writer(os.Stdout)
+	if verb.Out != "" {
+		f, err := os.Create(verb.Out)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to create the output file %v", verb.Out)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if verb.Format == OutputJson {
+		return writeQueryResultJson(out, res)
+	}
+	writeQueryResult(out, res, 0)
+	return nil
+}
+
+// queryResultColumnJson is a column of a query result in the JSON output.
+type queryResultColumnJson struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// writeQueryResultJson writes the result as a JSON object of its typed
+// columns and of its rows, with the values of the null cells as null.
+func writeQueryResultJson(out io.Writer, res *perfetto.QueryResult) error {
+	descs, columns := res.GetColumnDescriptors(), res.GetColumns()
+	result := struct {
+		Columns []queryResultColumnJson `json:"columns"`
+		Rows    [][]interface{}         `json:"rows"`
+	}{
+		Columns: make([]queryResultColumnJson, len(descs)),
+		Rows:    make([][]interface{}, res.GetNumRecords()),
+	}
+	for i, desc := range descs {
+		result.Columns[i] = queryResultColumnJson{Name: desc.Name, Type: desc.Type.String()}
+	}
+	for i := range result.Rows {
+		row := make([]interface{}, len(descs))
+		for j, desc := range descs {
+			col := columns[j]
+			if nulls := col.GetIsNulls(); i < len(nulls) && nulls[i] {
+				continue
+			}
+			switch desc.Type {
+			case perfetto.QueryResult_ColumnDesc_LONG:
+				row[j] = col.LongValues[i]
+			case perfetto.QueryResult_ColumnDesc_DOUBLE:
+				row[j] = col.DoubleValues[i]
+			case perfetto.QueryResult_ColumnDesc_STRING:
+				row[j] = col.StringValues[i]
+			}
+		}
+		result.Rows[i] = row
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
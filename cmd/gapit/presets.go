@@ -0,0 +1,82 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type presetsVerb struct{ PresetsFlags }
+
+func init() {
+	verb := &presetsVerb{}
+	app.AddVerb(&app.Verb{
+		Name:      "presets",
+		ShortHelp: "Lists, stores or removes the capture and profiling presets of the server",
+		Action:    verb,
+	})
+}
+
+func (verb *presetsVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if verb.Save != "" && verb.Delete != "" {
+		app.Usage(ctx, "At most one of -save and -delete expected")
+		return nil
+	}
+
+	client, err := getGapis(ctx, verb.Gapis, GapirFlags{})
+	if err != nil {
+		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+	defer client.Close()
+
+	switch {
+	case verb.Save != "":
+		data, err := ioutil.ReadFile(verb.Save)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to read the preset %v", verb.Save)
+		}
+		preset := &service.Preset{}
+		if err := proto.UnmarshalText(string(data), preset); err != nil {
+			return log.Errf(ctx, err, "Failed to parse the preset %v", verb.Save)
+		}
+		if err := client.SavePreset(ctx, &service.SavePresetRequest{Preset: preset}); err != nil {
+			return log.Errf(ctx, err, "Failed to store the preset %v", preset.Name)
+		}
+		fmt.Fprintf(os.Stdout, "Stored preset %v\n", preset.Name)
+	case verb.Delete != "":
+		if err := client.DeletePreset(ctx, &service.DeletePresetRequest{Name: verb.Delete}); err != nil {
+			return log.Errf(ctx, err, "Failed to remove the preset %v", verb.Delete)
+		}
+		fmt.Fprintf(os.Stdout, "Removed preset %v\n", verb.Delete)
+	default:
+		presets, err := client.GetPresets(ctx, &service.GetPresetsRequest{})
+		if err != nil {
+			return log.Err(ctx, err, "Failed to get the presets")
+		}
+		for _, p := range presets.Presets {
+			fmt.Fprintf(os.Stdout, "%-24v %v\n", p.Name, p.Description)
+		}
+	}
+	return nil
+}
@@ -19,13 +19,21 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/flags"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/core/os/device/farm"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 )
@@ -39,35 +47,124 @@ func init() {
 	}}
 	app.AddVerb(&app.Verb{
 		Name:      "profile",
-		ShortHelp: "Profile a replay to get GPU activity and counter data.",
+		ShortHelp: "Profile a replay, or process a Perfetto trace, to get GPU activity and counter data.",
 		Action:    verb,
 	})
 }
 
 func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	if flags.NArg() != 1 {
-		app.Usage(ctx, "Exactly one gfx trace file expected, got %d", flags.NArg())
+		app.Usage(ctx, "Exactly one gfx or Perfetto trace file expected, got %d", flags.NArg())
 		return nil
 	}
-	capture, err := filepath.Abs(flags.Arg(0))
+	res, _, err := runGpuProfile(ctx, verb.GpuProfileFlags, flags.Arg(0))
+	if err != nil || res == nil {
+		return err
+	}
+
+	times := newExportTimes(ctx, verb.TimeUnit, verb.Timebase, res)
+	if verb.SlicesCsv != "" {
+		err := writeOutput(ctx, verb.SlicesCsv, func(w io.Writer) error { return writeSlicesCsv(w, res, times) })
+		if err != nil {
+			return err
+		}
+	}
+	if verb.FramesCsv != "" {
+		err := writeOutput(ctx, verb.FramesCsv, func(w io.Writer) error { return writeFramesCsv(w, res, times) })
+		if err != nil {
+			return err
+		}
+	}
+	if verb.TraceJson != "" {
+		err := writeOutput(ctx, verb.TraceJson, func(w io.Writer) error { return writeTraceEventsJson(w, res, times) })
+		if err != nil {
+			return err
+		}
+	}
+
+	out := os.Stdout
+	if verb.Out != "" {
+		out, err = os.Create(verb.Out)
+		if err != nil {
+			return log.Errf(ctx, err, "Creating file (%v)", out)
+		}
+		defer out.Close()
+	}
+
+	if verb.Json {
+		jsonBytes, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return log.Err(ctx, err, "Couldn't marshal trace to JSON")
+		}
+		fmt.Fprintln(out, string(jsonBytes))
+	} else {
+		err = proto.MarshalText(out, res)
+		if err != nil {
+			return log.Err(ctx, err, "Couldn't marshal trace to text")
+		}
+	}
+	return nil
+}
+
+// runGpuProfile profiles the capture, or processes the Perfetto trace, in the
+// file as configured by the flags, and logs the warnings about the profile.
+// Returns the profiling data and the device the capture was replayed on, nil
+// for Perfetto traces. Returns nil data if the flags are invalid.
+func runGpuProfile(ctx context.Context, verb GpuProfileFlags, file string) (*service.ProfilingData, *device.Instance, error) {
+	capture, err := filepath.Abs(file)
 	if err != nil {
-		log.Errf(ctx, err, "Could not find capture file: %v", flags.Arg(0))
+		log.Errf(ctx, err, "Could not find capture file: %v", file)
 	}
 
 	client, err := getGapis(ctx, verb.Gapis, verb.Gapir)
 	if err != nil {
-		return log.Err(ctx, err, "Failed to connect to the GAPIS server")
+		return nil, nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
 	}
 	defer client.Close()
 
 	capturePath, err := client.LoadCapture(ctx, capture)
 	if err != nil {
-		return log.Err(ctx, err, "Failed to load the capture file")
+		return nil, nil, log.Err(ctx, err, "Failed to load the capture file")
 	}
 
-	device, err := getDevice(ctx, client, capturePath, verb.Gapir)
+	boxedCapture, err := client.Get(ctx, capturePath.Path(), nil)
 	if err != nil {
-		return err
+		return nil, nil, log.Err(ctx, err, "Failed to load the capture")
+	}
+
+	// Perfetto traces are processed without a replay, so don't need a device.
+	var devicePath *path.Device
+	var instance *device.Instance
+	if boxedCapture.(*service.Capture).Type != service.TraceType_Perfetto {
+		if verb.Farm {
+			constraints, err := farm.ParseConstraints(verb.FarmNeeds)
+			if err != nil {
+				app.Usage(ctx, "%v", err)
+				return nil, nil, nil
+			}
+			leased, err := client.AcquireFarmDevice(ctx, &service.AcquireFarmDeviceRequest{Constraints: constraints})
+			if err != nil {
+				return nil, nil, log.Err(ctx, err, "Failed to lease a device from the device farm")
+			}
+			defer func() {
+				if err := client.ReleaseFarmDevice(ctx, &service.ReleaseFarmDeviceRequest{LeaseId: leased.LeaseId}); err != nil {
+					log.W(ctx, "Failed to release the device of lease %v: %v", leased.LeaseId, err)
+				}
+			}()
+			devicePath = leased.Device
+		} else {
+			devicePath, err = getDevice(ctx, client, capturePath, verb.Gapir)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if devicePath != nil {
+			boxedDevice, err := client.Get(ctx, devicePath.Path(), nil)
+			if err != nil {
+				return nil, nil, log.Err(ctx, err, "Failed to resolve the device")
+			}
+			instance = boxedDevice.(*device.Instance)
+		}
 	}
 
 	var commands []*path.Command
@@ -77,40 +174,303 @@ func (verb *profileVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		}
 	}
 
+	var profileRange *service.ProfileRange
+	if len(verb.Frames) > 0 {
+		if len(verb.Frames) != 2 {
+			app.Usage(ctx, "Expected the first and last frame to profile, got %v", verb.Frames)
+			return nil, nil, nil
+		}
+		profileRange = &service.ProfileRange{Range: &service.ProfileRange_Frames_{
+			Frames: &service.ProfileRange_Frames{First: uint32(verb.Frames[0]), Last: uint32(verb.Frames[1])},
+		}}
+	}
+
+	var shaderReplacement *service.ShaderReplacement
+	if (verb.ReplaceShader == "") != (verb.ShaderSource == "") {
+		app.Usage(ctx, "-replaceshader and -shadersource must be given together")
+		return nil, nil, nil
+	} else if verb.ReplaceShader != "" {
+		source, err := ioutil.ReadFile(verb.ShaderSource)
+		if err != nil {
+			return nil, nil, log.Errf(ctx, err, "Could not read the shader source %v", verb.ShaderSource)
+		}
+		shaderReplacement = &service.ShaderReplacement{Shader: verb.ReplaceShader, Source: string(source)}
+	}
+
+	var scales []float32
+	for _, s := range verb.Scales {
+		scale, err := strconv.ParseFloat(strings.TrimSpace(s), 32)
+		if err != nil || scale <= 0 || scale > 1 {
+			app.Usage(ctx, "Invalid resolution scale %v, expected a scale in (0, 1]", s)
+			return nil, nil, nil
+		}
+		scales = append(scales, float32(scale))
+	}
+
+	var analyses []service.CaptureAnalysis
+	for _, name := range verb.Analyses {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			analyses = allCaptureAnalyses
+			break
+		}
+		analysis, ok := captureAnalyses[name]
+		if !ok {
+			app.Usage(ctx, "Invalid analysis %v, expected one of passes, descriptors, queues, memory or all", name)
+			return nil, nil, nil
+		}
+		analyses = append(analyses, analysis)
+	}
+
+	var samplerSweep []*service.SamplerOverride
+	if verb.SamplerSweep {
+		samplerSweep = defaultSamplerSweep
+	}
+
+	var shadingRate *service.ShadingRateOverride
+	if verb.ShadingRate != "" {
+		var width, height uint32
+		if _, err := fmt.Sscanf(verb.ShadingRate, "%dx%d", &width, &height); err != nil {
+			app.Usage(ctx, "Invalid fragment size %v, expected e.g. '2x2'", verb.ShadingRate)
+			return nil, nil, nil
+		}
+		shadingRate = &service.ShadingRateOverride{Width: width, Height: height, RenderPasses: verb.RatePasses}
+	}
+
+	var overrides *service.CounterOverrides
+	if verb.Overrides != "" {
+		if overrides, err = loadCounterOverrides(verb.Overrides); err != nil {
+			return nil, nil, log.Errf(ctx, err, "Failed to load the counter overrides")
+		}
+	}
+
 	req := &service.GpuProfileRequest{
 		Capture: capturePath,
-		Device:  device,
+		Device:  devicePath,
 		Experiments: &service.ProfileExperiments{
 			DisabledCommands:            commands,
 			DisableAnisotropicFiltering: verb.DisableAF,
 		},
+		BisectCommandBuffers:     verb.BisectCmdBuf,
+		CounterSpecMergePolicy:   counterSpecPolicies[verb.SpecPolicy],
+		PrimePipelineCaches:      verb.PrimeCaches,
+		IncludeRawSliceArgs:      verb.RawArgs,
+		FrameBudget:              uint64(verb.FrameBudget),
+		MeasureOverhead:          verb.Overhead,
+		Range:                    profileRange,
+		CounterOverrides:         overrides,
+		CounterSourcePolicy:      counterSourcePolicies[verb.Sources],
+		CounterSource:            verb.Source,
+		CounterDedupPolicy:       counterDedupPolicies[verb.Dedup],
+		IncludeDeviceFingerprint: verb.Fingerprint,
+		AllCounters:              verb.AllCounters,
+		Validate:                 verb.Validate,
+		SliceDedupPolicy:         sliceDedupPolicies[verb.SliceDedup],
+		IgnoredSlices:            verb.IgnoreSlices,
+		Preset:                   verb.Preset,
+		ErrorPolicy:              errorPolicies[verb.Errors],
+		ShaderReplacement:        shaderReplacement,
+		ResolutionScales:         scales,
+		SamplerSweep:             samplerSweep,
+		ShadingRate:              shadingRate,
+		CalibrateTimestamps:      verb.Calibrate,
+		SustainedPerformance:     verb.Sustained,
+		CaptureAnalyses:          analyses,
+	}
+	if verb.Buckets > 0 {
+		req.CounterSampling = &service.CounterSampling{Buckets: uint32(verb.Buckets)}
 	}
 
 	res, err := client.GpuProfile(ctx, req)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	out := os.Stdout
-	if verb.Out != "" {
-		out, err = os.Create(verb.Out)
-		if err != nil {
-			return log.Errf(ctx, err, "Creating file (%v)", out)
+	for _, e := range res.Errors {
+		log.W(ctx, "The %v of the profile are incomplete. %v", e.Section, e.Error)
+		if e.Remediation != "" {
+			log.I(ctx, "Hint: %v", e.Remediation)
+		}
+	}
+	for _, issue := range res.KnownIssues {
+		log.W(ctx, "Known device issue: %v", issue.Description)
+	}
+	if n := len(res.ValidationIssues); n > 0 {
+		log.W(ctx, "The validation layers reported %d issues, which may affect the counters", n)
+	}
+	if b := res.FrameBudget; b != nil && b.ExceededFrames > 0 {
+		log.W(ctx, "%d of %d frames exceeded the frame budget of %v", b.ExceededFrames, len(b.Frames), verb.FrameBudget)
+	}
+	for _, r := range res.Recommendations {
+		if r.Severity != service.ProfilingData_Recommendation_Info {
+			log.W(ctx, "%v: %v", r.Kind, r.Description)
+		}
+	}
+	if n := bestEffortSlices(res.Slices); n > 0 {
+		log.W(ctx, "%d of %d GPU slices were attributed to their commands by a best-effort match", n, len(res.Slices.GetSlices()))
+	}
+	if sp := res.SustainedPerformance; sp != nil && !sp.Active {
+		log.W(ctx, "Profiled without the sustained performance mode: %v", sp.Reason)
+	}
+	if u := res.Utilization; u != nil {
+		log.I(ctx, "The GPU was busy %.0f%% of the time, %d of %d frames were GPU bound", 100*u.Utilization, u.GpuBoundFrames, len(u.Frames))
+	}
+	for _, sc := range res.GetSwapchainTimeline().GetSwapchains() {
+		if sc.Starved {
+			log.W(ctx, "The swapchain of %v was starved: %d of %d image acquisitions stalled, for %v in total",
+				sc.Layer, sc.StalledAcquires, sc.Acquires, time.Duration(sc.AcquireStall))
 		}
-		defer out.Close()
+	}
+	var worst *service.ProfilingData_DrawDurations_Outlier
+	outlierPasses, worstPass := 0, ""
+	for _, d := range res.DrawDurations {
+		if len(d.Outliers) == 0 {
+			continue
+		}
+		outlierPasses++
+		if o := d.Outliers[0]; worst == nil || o.Dur > worst.Dur {
+			worst, worstPass = o, d.Name
+		}
+	}
+	if worst != nil {
+		log.I(ctx, "%d passes have outlier draws, the longest took %v in %v, %.0fx the median draw of the pass (command %v)",
+			outlierPasses, time.Duration(worst.Dur), worstPass, worst.Ratio, worst.Command)
+	}
+	if d := res.DepthPasses; d != nil && len(d.Passes) > 0 {
+		longest := d.Passes[0]
+		log.I(ctx, "The depth-only passes took %v per frame, %.0f%% of the GPU busy time, the longest, %v, drew %.2f primitives per pixel",
+			time.Duration(d.MeanGpuTime), 100*d.MeanShare, longest.Name, longest.PrimitivesPerPixel)
+	}
+	if ab := res.ShaderAb; ab != nil {
+		log.I(ctx, "Replacing the shader changed the GPU time by %+.1f%% (%v vs %v originally)",
+			100*ab.Change, time.Duration(ab.ReplacedGpuTime), time.Duration(ab.GpuTime))
+	}
+	if sweep := res.ResolutionSweep; sweep != nil {
+		for _, g := range sweep.Groups {
+			if g.ResolutionBound {
+				log.I(ctx, "%v is resolution bound: %.0f%% of its GPU time scales with the resolution", g.Name, 100*g.PixelFraction)
+			}
+		}
+	}
+	if sweep := res.SamplerSweep; sweep != nil {
+		for _, step := range sweep.Steps[1:] {
+			log.I(ctx, "%v changed the GPU time by %+.1f%%", samplerOverrideName(step.Override), 100*step.Change)
+		}
+	}
+	if r := res.ShadingRate; r != nil {
+		log.I(ctx, "Shading at %dx%d saved %.1f%% of the GPU time (%v vs %v originally)", r.Override.Width, r.Override.Height,
+			100*r.Savings, time.Duration(r.CoarseGpuTime), time.Duration(r.GpuTime))
+	}
+	if u := res.DescriptorUsage; u != nil {
+		indexed := 0
+		for _, f := range u.Frames {
+			if f.UpdateAfterBindSets > 0 || f.VariableCountSets > 0 {
+				indexed++
+			}
+		}
+		if indexed > 0 {
+			log.I(ctx, "%d of %d frames bound descriptor sets using descriptor indexing", indexed, len(u.Frames))
+		}
+	}
+	if q := res.QueueDependencies; q != nil && len(q.Frames) > 0 {
+		var waitTime, transferTime uint64
+		for _, f := range q.Frames {
+			waitTime += f.WaitTime
+			transferTime += f.TransferTime
+		}
+		if waitTime+transferTime > 0 {
+			n := uint64(len(q.Frames))
+			log.I(ctx, "Cross-queue waits took %v and ownership transfers %v per frame across %d queues",
+				time.Duration(waitTime/n), time.Duration(transferTime/n), q.Queues)
+		}
+	}
+	if m := res.MemoryTimeline; m != nil {
+		var peak, live uint64
+		for _, h := range m.Heaps {
+			peak += h.Peak
+			live += h.Live
+		}
+		log.I(ctx, "The capture allocated up to %v of device memory, summing the peaks of %d heaps, %v remained allocated at its end",
+			readableBytes(peak), len(m.Heaps), readableBytes(live))
+	}
+	if c := res.ClockCalibration; c != nil {
+		if c.Corrected {
+			log.W(ctx, "The GPU clock of the trace was off by %+.1f%%, the slices and counters were corrected", 100*c.Skew)
+		} else {
+			log.I(ctx, "The GPU clock of the trace was within %+.2f%% of the timestamp queries", 100*c.Skew)
+		}
+	}
+	if i := res.SliceIntegrity; i != nil {
+		if i.MissingSubmissions > 0 || len(i.MissingRenderPasses) > 0 {
+			log.W(ctx, "The trace is missing the slices of %d of %d submissions and %d of %d render passes of the capture",
+				i.MissingSubmissions, i.Submissions, len(i.MissingRenderPasses), i.RenderPasses)
+		}
+		if i.ExtraSlices > 0 {
+			log.W(ctx, "%d render pass slices (%v) were not attributed to any render pass of the capture",
+				i.ExtraSlices, time.Duration(i.ExtraTime))
+		}
+		if i.OutOfOrderSubmissions > 0 {
+			log.W(ctx, "%d submissions executed before the previous submission to their queue", i.OutOfOrderSubmissions)
+		}
+	}
+	if o := res.Overhead; o != nil {
+		log.I(ctx, "Collecting the counters changed the GPU time by %+.1f%% (%v vs %v without counters)",
+			100*o.Overhead, time.Duration(o.GpuTime), time.Duration(o.BaselineGpuTime))
 	}
 
-	if verb.Json {
-		jsonBytes, err := json.MarshalIndent(res, "", "  ")
+	if verb.Bundle != "" {
+		out, err := filepath.Abs(verb.Bundle)
 		if err != nil {
-			return log.Err(ctx, err, "Couldn't marshal trace to JSON")
+			return nil, nil, log.Errf(ctx, err, "Invalid bundle path: %v", verb.Bundle)
 		}
-		fmt.Fprintln(out, string(jsonBytes))
-	} else {
-		err = proto.MarshalText(out, res)
-		if err != nil {
-			return log.Err(ctx, err, "Couldn't marshal trace to text")
+		req := &service.SaveBundleRequest{
+			Capture:       capturePath,
+			Device:        devicePath,
+			ProfilingData: res,
+			Path:          out,
+		}
+		if boxedCapture.(*service.Capture).Type == service.TraceType_Perfetto {
+			req.PerfettoTrace = capture
+		}
+		if err := client.SaveBundle(ctx, req); err != nil {
+			return nil, nil, log.Err(ctx, err, "Failed to save the bundle")
 		}
 	}
-	return nil
+	return res, instance, nil
+}
+
+// loadCounterOverrides reads the counter overrides from a JSON file, or a text
+// proto file for any other extension.
+func loadCounterOverrides(file string) (*service.CounterOverrides, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	res := &service.CounterOverrides{}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		err = jsonpb.UnmarshalString(string(data), res)
+	} else {
+		err = proto.UnmarshalText(string(data), res)
+	}
+	return res, err
+}
+
+// defaultSamplerSweep are the sampler overrides profiled by -samplersweep.
+var defaultSamplerSweep = []*service.SamplerOverride{
+	{LodBias: 1},
+	{LodBias: 2},
+	{NearestFiltering: true},
+}
+
+// samplerOverrideName returns the description of a sampler override.
+func samplerOverrideName(o *service.SamplerOverride) string {
+	switch {
+	case o == nil:
+		return "Original sampling"
+	case o.NearestFiltering && o.LodBias != 0:
+		return fmt.Sprintf("Nearest filtering with a LOD bias of %+g", o.LodBias)
+	case o.NearestFiltering:
+		return "Nearest filtering"
+	default:
+		return fmt.Sprintf("A LOD bias of %+g", o.LodBias)
+	}
 }
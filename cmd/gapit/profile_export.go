@@ -0,0 +1,541 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type profileExportVerb struct{ ProfileExportFlags }
+
+func init() {
+	verb := &profileExportVerb{ProfileExportFlags{
+		GpuProfileFlags: GpuProfileFlags{DisabledCmds: []flags.U64Slice{}},
+	}}
+	app.AddVerb(&app.Verb{
+		Name:      "profile_export",
+		ShortHelp: "Export the GPU slices, counters and GPU counters of a profile as CSV or JSON, e.g. for spreadsheets and dashboards.",
+		Action:    verb,
+	})
+}
+
+func (verb *profileExportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	var res *service.ProfilingData
+	if verb.Data != "" {
+		if flags.NArg() != 0 {
+			app.Usage(ctx, "No trace file expected with -data, got %d", flags.NArg())
+			return nil
+		}
+		var err error
+		if res, err = loadProfilingData(verb.Data); err != nil {
+			return log.Errf(ctx, err, "Failed to load the profiling data %v", verb.Data)
+		}
+	} else {
+		if flags.NArg() != 1 {
+			app.Usage(ctx, "Exactly one gfx or Perfetto trace file expected, got %d", flags.NArg())
+			return nil
+		}
+		var err error
+		if res, _, err = runGpuProfile(ctx, verb.GpuProfileFlags, flags.Arg(0)); err != nil || res == nil {
+			return err
+		}
+	}
+	times := newExportTimes(ctx, verb.TimeUnit, verb.Timebase, res)
+
+	if verb.Format == ExportJson {
+		if verb.Out == "" {
+			return writeProfileJson(os.Stdout, res, times)
+		}
+		return writeOutput(ctx, verb.Out, func(w io.Writer) error { return writeProfileJson(w, res, times) })
+	}
+
+	if verb.Out == "" {
+		app.Usage(ctx, "A CSV export requires an output directory")
+		return nil
+	}
+	if err := os.MkdirAll(verb.Out, 0755); err != nil {
+		return log.Errf(ctx, err, "Failed to create the output directory %v", verb.Out)
+	}
+	for name, write := range map[string]func(io.Writer, *service.ProfilingData, exportTimes) error{
+		"slices.csv":       writeSlicesCsv,
+		"counters.csv":     writeCountersCsv,
+		"gpu_counters.csv": writeGpuCountersCsv,
+	} {
+		write := write
+		err := writeOutput(ctx, filepath.Join(verb.Out, name), func(w io.Writer) error { return write(w, res, times) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadProfilingData reads the profiling data from a JSON file, or a text
+// proto file for any other extension.
+func loadProfilingData(file string) (*service.ProfilingData, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	res := &service.ProfilingData{}
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		err = u.Unmarshal(strings.NewReader(string(data)), res)
+	} else {
+		err = proto.UnmarshalText(string(data), res)
+	}
+	return res, err
+}
+
+// timeUnitScales are the number of nanoseconds per unit.
+var timeUnitScales = map[TimeUnit]int64{
+	UnitNanoseconds:  1,
+	UnitMicroseconds: 1000,
+	UnitMilliseconds: 1000000,
+}
+
+// timeUnitDigits are the number of fractional digits needed to represent a
+// nanosecond in the unit.
+var timeUnitDigits = map[TimeUnit]int{
+	UnitNanoseconds:  0,
+	UnitMicroseconds: 3,
+	UnitMilliseconds: 6,
+}
+
+// format returns the nanoseconds ns in the unit, without loss of precision.
+func (v TimeUnit) format(ns int64) string {
+	scale := timeUnitScales[v]
+	if scale <= 1 {
+		return strconv.FormatInt(ns, 10)
+	}
+	sign := ""
+	if ns < 0 {
+		sign, ns = "-", -ns
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, ns/scale, timeUnitDigits[v], ns%scale)
+}
+
+// exportTimes converts the boottime timestamps and the durations of the
+// profiling data to the unit and timebase selected for an export.
+type exportTimes struct {
+	unit TimeUnit
+	base uint64
+}
+
+func newExportTimes(ctx context.Context, unit TimeUnit, timebase Timebase, data *service.ProfilingData) exportTimes {
+	res := exportTimes{unit: unit}
+	switch timebase {
+	case TimebaseBoottime:
+		return res
+	case TimebaseFirstFrame:
+		if frames := data.GetGpuIdle().GetFrames(); len(frames) > 0 {
+			res.base = frames[0].Ts
+			return res
+		}
+		log.W(ctx, "The profile contains no frames, exporting the times relative to the start of the trace")
+	}
+
+	res.base = data.GetTraceStart()
+	if res.base == 0 {
+		// Fall back to the first GPU slice if the trace bounds are unknown.
+		for _, slice := range data.GetSlices().GetSlices() {
+			if res.base == 0 || slice.Ts < res.base {
+				res.base = slice.Ts
+			}
+		}
+	}
+	return res
+}
+
+// header returns the CSV column name of a time column.
+func (t exportTimes) header(name string) string {
+	return fmt.Sprintf("%s(%v)", name, t.unit)
+}
+
+func (t exportTimes) timestamp(ts uint64) string {
+	return t.unit.format(int64(ts - t.base))
+}
+
+func (t exportTimes) duration(dur uint64) string {
+	return t.unit.format(int64(dur))
+}
+
+// micros returns the timestamp in microseconds, ignoring the unit.
+func (t exportTimes) micros(ts uint64) float64 {
+	return float64(int64(ts-t.base)) / 1000
+}
+
+// writeSlicesCsv writes the GPU slices of the profiling data as CSV to w.
+func writeSlicesCsv(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	slices := data.GetSlices()
+	tracks := map[int32]string{}
+	for _, track := range slices.GetTracks() {
+		tracks[track.Id] = track.Name
+	}
+	groups := map[int32]string{}
+	for _, group := range slices.GetGroups() {
+		groups[group.Id] = group.Name
+	}
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"Id", times.header("Ts"), times.header("Dur"), "Label", "Depth", "Track", "Group", "Category", "Confidence"})
+	for _, slice := range slices.GetSlices() {
+		out.Write([]string{
+			fmt.Sprint(slice.Id),
+			times.timestamp(slice.Ts),
+			times.duration(slice.Dur),
+			slice.Label,
+			fmt.Sprint(slice.Depth),
+			tracks[slice.TrackId],
+			groups[slice.GroupId],
+			slice.Category.String(),
+			slice.Confidence.String(),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeFramesCsv writes the frames of the profiling data as CSV to w.
+func writeFramesCsv(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"FrameId", times.header("Ts"), times.header("Dur"), times.header("Idle"), "IdlePercent"})
+	for _, frame := range data.GetGpuIdle().GetFrames() {
+		out.Write([]string{
+			fmt.Sprint(frame.FrameId),
+			times.timestamp(frame.Ts),
+			times.duration(frame.Dur),
+			times.duration(frame.Idle),
+			fmt.Sprintf("%.2f", frame.IdlePercent),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeCountersCsv writes the samples of the counters of the profiling data
+// as CSV to w, a row per sample.
+func writeCountersCsv(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"CounterId", "Name", "Unit", times.header("Ts"), "Value"})
+	for _, c := range data.GetCounters() {
+		for i, ts := range c.Timestamps {
+			out.Write([]string{
+				fmt.Sprint(c.Id),
+				c.Name,
+				c.Unit,
+				times.timestamp(ts),
+				strconv.FormatFloat(c.Values[i], 'g', -1, 64),
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// gpuCounterRow is a metric of a slice group of the computed GPU counters.
+type gpuCounterRow struct {
+	Group    string  `json:"group"`
+	Metric   string  `json:"metric"`
+	Unit     string  `json:"unit"`
+	Estimate float64 `json:"estimate"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+// gpuCounterRows returns the metrics of each slice group of the computed GPU
+// counters, in the order of the groups and of the metrics.
+func gpuCounterRows(data *service.ProfilingData) []gpuCounterRow {
+	groups := map[int32]string{}
+	for _, group := range data.GetSlices().GetGroups() {
+		groups[group.Id] = group.Name
+	}
+	metrics := map[int32]*service.ProfilingData_GpuCounters_Metric{}
+	for _, m := range data.GetGpuCounters().GetMetrics() {
+		metrics[m.Id] = m
+	}
+
+	res := []gpuCounterRow{}
+	for _, entry := range data.GetGpuCounters().GetEntries() {
+		ids := make([]int32, 0, len(entry.MetricToValue))
+		for id := range entry.MetricToValue {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			perf := entry.MetricToValue[id]
+			res = append(res, gpuCounterRow{
+				Group:    groups[entry.GroupId],
+				Metric:   metrics[id].GetName(),
+				Unit:     metrics[id].GetUnit(),
+				Estimate: perf.Estimate,
+				Min:      perf.Min,
+				Max:      perf.Max,
+			})
+		}
+	}
+	return res
+}
+
+// writeGpuCountersCsv writes the GPU counters computed for the slice groups
+// of the profiling data as CSV to w, a row per group and metric.
+func writeGpuCountersCsv(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Group", "Metric", "Unit", "Estimate", "Min", "Max"})
+	for _, row := range gpuCounterRows(data) {
+		out.Write([]string{
+			row.Group,
+			row.Metric,
+			row.Unit,
+			strconv.FormatFloat(row.Estimate, 'g', -1, 64),
+			strconv.FormatFloat(row.Min, 'g', -1, 64),
+			strconv.FormatFloat(row.Max, 'g', -1, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// writeProfileJson writes the GPU slices, the counter samples and the
+// computed GPU counters of the profiling data as a JSON document to w. The
+// times are numbers in the unit of the export.
+func writeProfileJson(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	type slice struct {
+		Id       uint64      `json:"id"`
+		Ts       json.Number `json:"ts"`
+		Dur      json.Number `json:"dur"`
+		Label    string      `json:"label"`
+		Depth    int32       `json:"depth"`
+		Track    string      `json:"track"`
+		Group    string      `json:"group"`
+		Category string      `json:"category"`
+	}
+	type counter struct {
+		Id         uint32        `json:"id"`
+		Name       string        `json:"name"`
+		Unit       string        `json:"unit"`
+		Timestamps []json.Number `json:"timestamps"`
+		Values     []float64     `json:"values"`
+	}
+
+	slices := data.GetSlices()
+	tracks := map[int32]string{}
+	for _, track := range slices.GetTracks() {
+		tracks[track.Id] = track.Name
+	}
+	groups := map[int32]string{}
+	for _, group := range slices.GetGroups() {
+		groups[group.Id] = group.Name
+	}
+	doc := struct {
+		TimeUnit    string          `json:"timeUnit"`
+		Slices      []slice         `json:"slices"`
+		Counters    []counter       `json:"counters"`
+		GpuCounters []gpuCounterRow `json:"gpuCounters"`
+	}{
+		TimeUnit:    times.unit.String(),
+		Slices:      []slice{},
+		Counters:    []counter{},
+		GpuCounters: gpuCounterRows(data),
+	}
+	for _, s := range slices.GetSlices() {
+		doc.Slices = append(doc.Slices, slice{
+			Id:       s.Id,
+			Ts:       json.Number(times.timestamp(s.Ts)),
+			Dur:      json.Number(times.duration(s.Dur)),
+			Label:    s.Label,
+			Depth:    s.Depth,
+			Track:    tracks[s.TrackId],
+			Group:    groups[s.GroupId],
+			Category: s.Category.String(),
+		})
+	}
+	for _, c := range data.GetCounters() {
+		ts := make([]json.Number, len(c.Timestamps))
+		for i, t := range c.Timestamps {
+			ts[i] = json.Number(times.timestamp(t))
+		}
+		doc.Counters = append(doc.Counters, counter{
+			Id:         c.Id,
+			Name:       c.Name,
+			Unit:       c.Unit,
+			Timestamps: ts,
+			Values:     c.Values,
+		})
+	}
+
+	out := json.NewEncoder(w)
+	out.SetIndent("", "  ")
+	return out.Encode(doc)
+}
+
+// The processes of the exported trace events.
+const (
+	gpuProcess = iota + 1
+	passProcess
+	markerProcess
+	frameProcess
+)
+
+// traceEvent is an event of the Chrome trace event format, which most trace
+// viewers read, and which is commonly converted for Windows Performance
+// Analyzer.
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int32                  `json:"tid"`
+	Id   int32                  `json:"id,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// writeTraceEventsJson writes the GPU slices, the render pass groups, the
+// markers and the frames of the profiling data as trace events to w. The GPU
+// tracks and the marker tracks are threads, the groups are async events
+// spanning their slices, as they may overlap. The times are always in
+// microseconds, as required by the format.
+func writeTraceEventsJson(w io.Writer, data *service.ProfilingData, times exportTimes) error {
+	events := []traceEvent{}
+	meta := func(pid int, tid int32, kind, name string) {
+		events = append(events, traceEvent{Name: kind, Ph: "M", Pid: pid, Tid: tid, Args: map[string]interface{}{"name": name}})
+	}
+	meta(gpuProcess, 0, "process_name", "GPU")
+	meta(passProcess, 0, "process_name", "Render passes")
+	meta(markerProcess, 0, "process_name", "Markers")
+	meta(frameProcess, 0, "process_name", "Frames")
+
+	slices := data.GetSlices()
+	for _, track := range slices.GetTracks() {
+		meta(gpuProcess, track.Id, "thread_name", track.Name)
+	}
+	groups := map[int32]*service.ProfilingData_GpuSlices_Group{}
+	for _, group := range slices.GetGroups() {
+		groups[group.Id] = group
+	}
+	type span struct{ start, end uint64 }
+	spans := map[int32]*span{}
+	for _, slice := range slices.GetSlices() {
+		args := map[string]interface{}{"depth": slice.Depth, "confidence": slice.Confidence.String()}
+		if group, ok := groups[slice.GroupId]; ok {
+			args["group"] = group.Name
+			if s, ok := spans[group.Id]; !ok {
+				spans[group.Id] = &span{slice.Ts, slice.Ts + slice.Dur}
+			} else {
+				if slice.Ts < s.start {
+					s.start = slice.Ts
+				}
+				if end := slice.Ts + slice.Dur; end > s.end {
+					s.end = end
+				}
+			}
+		}
+		for _, extra := range slice.Extras {
+			if v, ok := extra.Value.(*service.ProfilingData_GpuSlices_Slice_Extra_IntValue); ok {
+				args[extra.Name] = v.IntValue
+			}
+		}
+		events = append(events, traceEvent{
+			Name: slice.Label,
+			Cat:  slice.Category.String(),
+			Ph:   "X",
+			Ts:   times.micros(slice.Ts),
+			Dur:  float64(slice.Dur) / 1000,
+			Pid:  gpuProcess,
+			Tid:  slice.TrackId,
+			Args: args,
+		})
+	}
+	for _, group := range slices.GetGroups() {
+		s, ok := spans[group.Id]
+		if !ok {
+			continue
+		}
+		args := map[string]interface{}{}
+		if link := group.GetLink(); link != nil {
+			args["from"], args["to"] = fmt.Sprint(link.From), fmt.Sprint(link.To)
+		}
+		events = append(events,
+			traceEvent{Name: group.Name, Cat: "group", Ph: "b", Ts: times.micros(s.start), Pid: passProcess, Id: group.Id, Args: args},
+			traceEvent{Name: group.Name, Cat: "group", Ph: "e", Ts: times.micros(s.end), Pid: passProcess, Id: group.Id})
+	}
+
+	markers := data.GetMarkers()
+	for _, track := range markers.GetTracks() {
+		meta(markerProcess, track.Id, "thread_name", track.Name)
+	}
+	for _, marker := range markers.GetMarkers() {
+		events = append(events, traceEvent{
+			Name: marker.Label,
+			Cat:  marker.Category,
+			Ph:   "X",
+			Ts:   times.micros(marker.Ts),
+			Dur:  float64(marker.Dur) / 1000,
+			Pid:  markerProcess,
+			Tid:  marker.TrackId,
+		})
+	}
+
+	for _, frame := range data.GetGpuIdle().GetFrames() {
+		events = append(events, traceEvent{
+			Name: fmt.Sprintf("Frame %d", frame.FrameId),
+			Cat:  "frame",
+			Ph:   "X",
+			Ts:   times.micros(frame.Ts),
+			Dur:  float64(frame.Dur) / 1000,
+			Pid:  frameProcess,
+			Args: map[string]interface{}{"idle": float64(frame.Idle) / 1000, "idlePercent": frame.IdlePercent},
+		})
+	}
+
+	out := json.NewEncoder(w)
+	return out.Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ns"})
+}
+
+// bestEffortSlices returns the number of slices attributed to their group by
+// a fuzzy or debug label match.
+func bestEffortSlices(slices *service.ProfilingData_GpuSlices) int {
+	res := 0
+	for _, slice := range slices.GetSlices() {
+		switch slice.Confidence {
+		case service.ProfilingData_GpuSlices_Slice_Fuzzy, service.ProfilingData_GpuSlices_Slice_DebugLabel:
+			res++
+		}
+	}
+	return res
+}
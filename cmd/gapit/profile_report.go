@@ -0,0 +1,701 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/flags"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// reportChartWidth is the maximum number of columns of the charts.
+	reportChartWidth = 72
+	// reportHistogramBuckets is the number of buckets of the frame time
+	// histogram.
+	reportHistogramBuckets = 10
+)
+
+// sparkBlocks are the characters of the sparkline charts, from low to high.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+type profileReportVerb struct{ ProfileReportFlags }
+
+func init() {
+	verb := &profileReportVerb{ProfileReportFlags{
+		GpuProfileFlags: GpuProfileFlags{DisabledCmds: []flags.U64Slice{}},
+		TopPasses:       10,
+	}}
+	app.AddVerb(&app.Verb{
+		Name:      "profile_report",
+		ShortHelp: "Profile a replay, or process a Perfetto trace, into a Markdown or PDF performance report.",
+		Action:    verb,
+	})
+}
+
+func (verb *profileReportVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one gfx or Perfetto trace file expected, got %d", flags.NArg())
+		return nil
+	}
+	if verb.Pdf && verb.Out == "" {
+		app.Usage(ctx, "A PDF report requires an output file")
+		return nil
+	}
+
+	// The report has sections for the results of all the capture analyses.
+	if len(verb.Analyses) == 0 {
+		verb.Analyses = append(verb.Analyses, "all")
+	}
+	res, instance, err := runGpuProfile(ctx, verb.GpuProfileFlags, flags.Arg(0))
+	if err != nil || res == nil {
+		return err
+	}
+	write := func(w io.Writer) error {
+		return writeProfileReport(w, filepath.Base(flags.Arg(0)), instance, res, verb.TopPasses)
+	}
+
+	if verb.Out == "" {
+		return write(os.Stdout)
+	}
+	if !verb.Pdf {
+		return writeOutput(ctx, verb.Out, write)
+	}
+
+	base := strings.TrimSuffix(verb.Out, filepath.Ext(verb.Out))
+	markdown, pdf := base+".md", base+".pdf"
+	if err := writeOutput(ctx, markdown, write); err != nil {
+		return err
+	}
+	if out, err := exec.Command("pandoc", markdown, "-o", pdf).CombinedOutput(); err != nil {
+		return log.Errf(ctx, err, "Failed to convert the report to PDF with pandoc: %s", out)
+	}
+	return nil
+}
+
+// writeProfileReport writes the Markdown performance report of the profiling
+// data of the capture, profiled on the device, nil if unknown.
+func writeProfileReport(w io.Writer, capture string, instance *device.Instance, data *service.ProfilingData, topPasses int) error {
+	r := &reportWriter{w: w}
+	r.printf("# Performance report: %v\n\n", capture)
+	r.printf("Generated on %v.\n\n", time.Now().Format("2006-01-02 15:04"))
+	if instance != nil {
+		hw := instance.GetConfiguration().GetHardware()
+		r.printf("* Device: %v\n", instance.GetName())
+		r.printf("* GPU: %v\n", hw.GetGPU().GetName())
+		r.printf("* OS: %v\n\n", instance.GetConfiguration().GetOS().GetName())
+	}
+	if f := data.GetDeviceFingerprint(); f != nil {
+		r.printf("Device fingerprint %v: driver %d, API level %d", f.Id, f.DriverVersion, f.ApiLevel)
+		if f.FillRate > 0 || f.Bandwidth > 0 {
+			r.printf(", peak fill rate %.3g pixels/s, peak bandwidth %.3g bytes/s", f.FillRate, f.Bandwidth)
+		}
+		r.printf(".\n\n")
+	}
+
+	r.frameStatistics(data)
+	r.topPasses(data, topPasses)
+	r.passTrends(data.GetPassTrends(), topPasses)
+	r.tiling(data.GetTiling(), topPasses)
+	r.passUploads(data, topPasses)
+	r.shaderAB(data.GetShaderAb(), topPasses)
+	r.resolutionSweep(data.GetResolutionSweep(), topPasses)
+	r.samplerSweep(data.GetSamplerSweep())
+	r.shadingRate(data.GetShadingRate(), topPasses)
+	r.descriptorUsage(data.GetDescriptorUsage(), topPasses)
+	r.queueDependencies(data.GetQueueDependencies(), topPasses)
+	r.memoryTimeline(data.GetMemoryTimeline(), topPasses)
+	r.recommendations(data.GetRecommendations())
+	r.validationIssues(data.GetValidationIssues())
+	r.logMessages(data.GetLogMessages(), data.GetTraceStart())
+	r.issues(data)
+	return r.err
+}
+
+// reportWriter writes the sections of a report, keeping the first error.
+type reportWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (r *reportWriter) printf(format string, args ...interface{}) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, format, args...)
+	}
+}
+
+func (r *reportWriter) frameStatistics(data *service.ProfilingData) {
+	frames := data.GetGpuIdle().GetFrames()
+	r.printf("## Frames\n\n")
+	if len(frames) == 0 {
+		r.printf("No frames were found in the profile.\n\n")
+		return
+	}
+
+	times := make([]uint64, len(frames))
+	total := uint64(0)
+	for i, frame := range frames {
+		times[i] = frame.Dur
+		total += frame.Dur
+	}
+	sorted := append([]uint64{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mean := total / uint64(len(frames))
+
+	r.printf("| Statistic | Value |\n|---|---|\n")
+	r.printf("| Frames | %d |\n", len(frames))
+	if mean > 0 {
+		r.printf("| Average FPS | %.1f |\n", float64(time.Second)/float64(mean))
+	}
+	r.printf("| Mean frame time | %v |\n", time.Duration(mean))
+	r.printf("| Median frame time | %v |\n", time.Duration(percentile(sorted, 0.5)))
+	r.printf("| 95th percentile frame time | %v |\n", time.Duration(percentile(sorted, 0.95)))
+	r.printf("| Worst frame time | %v |\n", time.Duration(sorted[len(sorted)-1]))
+	if u := data.GetUtilization(); u != nil {
+		r.printf("| GPU utilization | %.0f%% |\n", 100*u.Utilization)
+		r.printf("| GPU bound frames | %d |\n", u.GpuBoundFrames)
+	}
+	if b := data.GetFrameBudget(); b != nil {
+		r.printf("| Frames over the %v budget | %d |\n", time.Duration(b.Budget), b.ExceededFrames)
+	}
+	if sub := data.GetSubmissions(); sub != nil {
+		r.printf("| Queue submissions per frame | %.1f |\n", sub.MeanSubmits)
+		r.printf("| GPU idle time per submission | %v |\n", time.Duration(sub.GapPerSubmit))
+	}
+	if l := data.GetFrameLifecycle(); l.GetComposedFrames() > 0 {
+		r.printf("| Mean wait for the GPU after queuing | %v |\n", time.Duration(l.MeanGpuWait))
+		r.printf("| Mean time in the buffer queue | %v |\n", time.Duration(l.MeanQueueTime))
+	}
+	r.printf("\n")
+
+	r.printf("Frame times, from the first to the last frame, between %v and %v:\n\n", time.Duration(sorted[0]), time.Duration(sorted[len(sorted)-1]))
+	r.printf("```\n%v\n```\n\n", sparkline(times, sorted[0], sorted[len(sorted)-1]))
+	r.printf("Frame time distribution:\n\n")
+	r.printf("```\n%v```\n\n", histogram(sorted))
+}
+
+func (r *reportWriter) topPasses(data *service.ProfilingData, n int) {
+	if passes := data.GetEngine().GetPasses(); len(passes) > 0 {
+		sorted := append([]*service.ProfilingData_Engine_Pass{}, passes...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].GpuTime > sorted[j].GpuTime })
+		if len(sorted) > n {
+			sorted = sorted[:n]
+		}
+		busy := data.GetUtilization().GetBusy()
+		r.printf("## Top passes (%v)\n\n", data.GetEngine().Kind)
+		r.printf("| Pass | Markers | GPU time | Share |\n|---|---|---|---|\n")
+		for _, pass := range sorted {
+			r.printf("| %v | %d | %v | %s |\n", escapeMarkdown(pass.Name), pass.Count, time.Duration(pass.GpuTime), percentOf(pass.GpuTime, busy))
+		}
+		r.printf("\n")
+		return
+	}
+
+	aggregates := data.GetSliceAggregates()
+	if len(aggregates) == 0 {
+		return
+	}
+	if len(aggregates) > n {
+		aggregates = aggregates[:n]
+	}
+	r.printf("## Top GPU work\n\n")
+	r.printf("| Label | Category | Count | Total | Mean | 95th percentile |\n|---|---|---|---|---|---|\n")
+	for _, a := range aggregates {
+		r.printf("| %v | %v | %d | %v | %v | %v |\n", escapeMarkdown(a.Label), a.Category, a.Count,
+			time.Duration(a.Total), time.Duration(a.Mean), time.Duration(a.P95))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) passTrends(trends []*service.ProfilingData_PassTrend, n int) {
+	if len(trends) == 0 {
+		return
+	}
+	if len(trends) > n {
+		trends = trends[:n]
+	}
+	r.printf("## Pass cost over time\n\n")
+	r.printf("| Pass | Frames | Mean GPU time | Trend per frame | GPU time over time |\n|---|---|---|---|---|\n")
+	for _, trend := range trends {
+		times := make([]uint64, len(trend.Samples))
+		min, max := trend.Samples[0].GpuTime, trend.Samples[0].GpuTime
+		for i, s := range trend.Samples {
+			times[i] = s.GpuTime
+			if s.GpuTime < min {
+				min = s.GpuTime
+			}
+			if s.GpuTime > max {
+				max = s.GpuTime
+			}
+		}
+		name := trend.Name
+		if trend.Occurrence > 0 {
+			name = fmt.Sprintf("%v (#%d)", name, trend.Occurrence+1)
+		}
+		r.printf("| %v | %d | %v | %v | `%v` |\n", escapeMarkdown(name), len(trend.Samples),
+			time.Duration(trend.Mean), time.Duration(trend.Slope), sparkline(times, min, max))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) tiling(tiling *service.ProfilingData_Tiling, n int) {
+	passes := tiling.GetPasses()
+	if len(passes) == 0 {
+		return
+	}
+	if len(passes) > n {
+		passes = passes[:n]
+	}
+	r.printf("## Tiling\n\n")
+	if tiling.PrimitivesPerBinMax > 0 {
+		r.printf("Primitives per bin: median %.0f, 90th percentile %.0f, maximum %.0f.\n\n",
+			tiling.PrimitivesPerBinP50, tiling.PrimitivesPerBinP90, tiling.PrimitivesPerBinMax)
+	}
+	r.printf("| Pass | Bins | Primitives per bin | GPU time per bin |\n|---|---|---|---|\n")
+	for _, pass := range passes {
+		perBin := "-"
+		if pass.Primitives > 0 {
+			perBin = fmt.Sprintf("%.0f", pass.PrimitivesPerBin)
+		}
+		r.printf("| %v | %.0f | %v | %v |\n", escapeMarkdown(pass.Name), pass.Bins, perBin, time.Duration(pass.BinTime))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) passUploads(data *service.ProfilingData, n int) {
+	uploads := data.GetPassUploads()
+	if len(uploads) == 0 {
+		return
+	}
+	if len(uploads) > n {
+		uploads = uploads[:n]
+	}
+	names := map[int32]string{}
+	for _, group := range data.GetSlices().GetGroups() {
+		names[group.Id] = group.Name
+	}
+	r.printf("## Uploads\n\n")
+	r.printf("| Pass | Draws | Constants | Constants per draw | Push constant updates | Vertices | Indices |\n|---|---|---|---|---|---|---|\n")
+	for _, u := range uploads {
+		perDraw := "-"
+		if u.Draws > 0 {
+			perDraw = readableBytes(u.ConstantBytes / uint64(u.Draws))
+		}
+		r.printf("| %v | %d | %v | %v | %d | %v | %v |\n", escapeMarkdown(names[u.GroupId]), u.Draws, readableBytes(u.ConstantBytes),
+			perDraw, u.PushConstants, readableBytes(u.VertexBytes), readableBytes(u.IndexBytes))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) shaderAB(ab *service.ProfilingData_ShaderAB, count int) {
+	if ab == nil {
+		return
+	}
+	r.printf("## Shader replacement\n\n")
+	r.printf("Replacing the shader changed the GPU time by %+.1f%%, from %v to %v.\n\n",
+		100*ab.Change, time.Duration(ab.GpuTime), time.Duration(ab.ReplacedGpuTime))
+	if len(ab.Groups) > 0 {
+		r.printf("| Pass | Original | Replaced |\n|---|---|---|\n")
+		for i, g := range ab.Groups {
+			if i == count {
+				break
+			}
+			r.printf("| %v | %v | %v |\n", escapeMarkdown(g.Name), time.Duration(g.GpuTime), time.Duration(g.ReplacedGpuTime))
+		}
+		r.printf("\n")
+	}
+	if len(ab.Metrics) > 0 {
+		r.printf("| Counter | Original | Replaced |\n|---|---|---|\n")
+		for _, m := range ab.Metrics {
+			r.printf("| %v | %.4g %v | %.4g %v |\n", escapeMarkdown(m.Name), m.Average, m.Unit, m.ReplacedAverage, m.Unit)
+		}
+		r.printf("\n")
+	}
+}
+
+func (r *reportWriter) resolutionSweep(sweep *service.ProfilingData_ResolutionSweep, count int) {
+	if sweep == nil || len(sweep.Groups) == 0 {
+		return
+	}
+	r.printf("## Resolution scaling\n\n")
+	r.printf("| Pass |")
+	for _, s := range sweep.Scales {
+		r.printf(" %.0f%% |", 100*s)
+	}
+	r.printf(" Scales with resolution |\n|---|")
+	for range sweep.Scales {
+		r.printf("---|")
+	}
+	r.printf("---|\n")
+	for i, g := range sweep.Groups {
+		if i == count {
+			break
+		}
+		r.printf("| %v |", escapeMarkdown(g.Name))
+		for _, t := range g.GpuTimes {
+			r.printf(" %v |", time.Duration(t))
+		}
+		r.printf(" %.0f%% |\n", 100*g.PixelFraction)
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) samplerSweep(sweep *service.ProfilingData_SamplerSweep) {
+	if sweep == nil {
+		return
+	}
+	r.printf("## Texture sampling\n\n")
+	r.printf("Cheaper texture sampling saved up to %.0f%% of the GPU time.\n\n", 100*sweep.Sensitivity)
+	r.printf("| Sampling | GPU time | Fragment time | Change |\n|---|---|---|---|\n")
+	for _, step := range sweep.Steps {
+		r.printf("| %v | %v | %v | %+.1f%% |\n", samplerOverrideName(step.Override),
+			time.Duration(step.GpuTime), time.Duration(step.FragmentTime), 100*step.Change)
+	}
+	r.printf("\n")
+	for _, step := range sweep.Steps {
+		if len(step.Metrics) == 0 {
+			continue
+		}
+		r.printf("%v:\n\n| Counter | Average |\n|---|---|\n", samplerOverrideName(step.Override))
+		for _, m := range step.Metrics {
+			r.printf("| %v | %.4g %v |\n", escapeMarkdown(m.Name), m.Average, m.Unit)
+		}
+		r.printf("\n")
+	}
+}
+
+func (r *reportWriter) shadingRate(rate *service.ProfilingData_ShadingRate, count int) {
+	if rate == nil {
+		return
+	}
+	r.printf("## Variable rate shading\n\n")
+	r.printf("Shading at %dx%d saved %.1f%% of the GPU time, from %v to %v.\n\n", rate.Override.GetWidth(), rate.Override.GetHeight(),
+		100*rate.Savings, time.Duration(rate.GpuTime), time.Duration(rate.CoarseGpuTime))
+	if len(rate.Groups) == 0 {
+		return
+	}
+	r.printf("| Pass | Original | Coarse | Savings |\n|---|---|---|---|\n")
+	for i, g := range rate.Groups {
+		if i == count {
+			break
+		}
+		r.printf("| %v | %v | %v | %.1f%% |\n", escapeMarkdown(g.Name), time.Duration(g.GpuTime), time.Duration(g.CoarseGpuTime), 100*g.Savings)
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) descriptorUsage(usage *service.ProfilingData_DescriptorUsage, count int) {
+	if len(usage.GetFrames()) == 0 {
+		return
+	}
+	frames := append([]*service.ProfilingData_DescriptorUsage_Frame{}, usage.Frames...)
+	var binds, writes, indexed int
+	for _, f := range frames {
+		binds += int(f.Binds)
+		writes += int(f.DescriptorWrites)
+		if f.UpdateAfterBindSets > 0 || f.VariableCountSets > 0 {
+			indexed++
+		}
+	}
+	r.printf("## Descriptor usage\n\n")
+	r.printf("On average, a frame made %.1f descriptor set binds and %.1f descriptor writes. %d of %d frames used descriptor indexing.\n\n",
+		float64(binds)/float64(len(frames)), float64(writes)/float64(len(frames)), indexed, len(frames))
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].DriverTime > frames[j].DriverTime })
+	if len(frames) > count {
+		frames = frames[:count]
+	}
+	r.printf("| Frame | Binds | Sets bound | Writes | Update-after-bind sets | Variable count sets | Driver slices | Driver time |\n|---|---|---|---|---|---|---|---|\n")
+	for _, f := range frames {
+		r.printf("| %d | %d | %d | %d | %d | %d | %d | %v |\n", f.FrameId, f.Binds, f.BoundSets, f.DescriptorWrites,
+			f.UpdateAfterBindSets, f.VariableCountSets, f.DriverSlices, time.Duration(f.DriverTime))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) queueDependencies(deps *service.ProfilingData_QueueDependencies, count int) {
+	if len(deps.GetFrames()) == 0 {
+		return
+	}
+	frames := append([]*service.ProfilingData_QueueDependencies_Frame{}, deps.Frames...)
+	var waitTime, transferTime uint64
+	for _, f := range frames {
+		waitTime += f.WaitTime
+		transferTime += f.TransferTime
+	}
+	n := uint64(len(frames))
+	r.printf("## Queue dependencies\n\n")
+	r.printf("The capture submitted to %d queues. On average, a frame spent %v in cross-queue waits and %v in ownership transfers.\n\n",
+		deps.Queues, time.Duration(waitTime/n), time.Duration(transferTime/n))
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].WaitTime+frames[i].TransferTime > frames[j].WaitTime+frames[j].TransferTime
+	})
+	if len(frames) > count {
+		frames = frames[:count]
+	}
+	r.printf("| Frame | Cross-queue waits | Wait time | Ownership transfers | Transfer time |\n|---|---|---|---|---|\n")
+	for _, f := range frames {
+		r.printf("| %d | %d | %v | %d | %v |\n", f.FrameId, f.CrossQueueWaits, time.Duration(f.WaitTime),
+			f.OwnershipTransfers, time.Duration(f.TransferTime))
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) memoryTimeline(timeline *service.ProfilingData_MemoryTimeline, count int) {
+	if len(timeline.GetHeaps()) == 0 {
+		return
+	}
+	r.printf("## Device memory\n\n")
+	if timeline.Initial > 0 {
+		r.printf("The initial state of the capture allocated %v.\n\n", readableBytes(timeline.Initial))
+	}
+	r.printf("| Heap | Allocations | Total allocated | Peak | Allocated at the end |\n|---|---|---|---|---|\n")
+	for _, h := range timeline.Heaps {
+		r.printf("| %d | %d | %v | %v | %v |\n", h.Index, h.Allocations, readableBytes(h.Total), readableBytes(h.Peak), readableBytes(h.Live))
+	}
+	r.printf("\n")
+
+	frames := []*service.ProfilingData_MemoryTimeline_Frame{}
+	for _, f := range timeline.Frames {
+		if f.Allocations+f.Frees+f.ImagesCreated+f.ImagesDestroyed+f.BuffersCreated+f.BuffersDestroyed > 0 {
+			frames = append(frames, f)
+		}
+	}
+	if len(frames) == 0 {
+		return
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].Allocated+frames[i].Freed > frames[j].Allocated+frames[j].Freed })
+	if len(frames) > count {
+		frames = frames[:count]
+	}
+	r.printf("The frames allocating or freeing the most memory:\n\n")
+	if timeline.Counter != "" {
+		r.printf("| Frame | Allocations | Frees | Allocated | Freed | Allocated at the end | Images | Buffers | Peak %v |\n|---|---|---|---|---|---|---|---|---|\n",
+			escapeMarkdown(timeline.Counter))
+	} else {
+		r.printf("| Frame | Allocations | Frees | Allocated | Freed | Allocated at the end | Images | Buffers |\n|---|---|---|---|---|---|---|---|\n")
+	}
+	for _, f := range frames {
+		r.printf("| %d | %d | %d | %v | %v | %v | +%d/-%d | +%d/-%d |", f.FrameId, f.Allocations, f.Frees,
+			readableBytes(f.Allocated), readableBytes(f.Freed), readableBytes(f.Live),
+			f.ImagesCreated, f.ImagesDestroyed, f.BuffersCreated, f.BuffersDestroyed)
+		if timeline.Counter != "" {
+			r.printf(" %.0f %v |", f.CounterPeak, timeline.CounterUnit)
+		}
+		r.printf("\n")
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) recommendations(recommendations []*service.ProfilingData_Recommendation) {
+	r.printf("## Recommendations\n\n")
+	if len(recommendations) == 0 {
+		r.printf("No issues were found.\n\n")
+		return
+	}
+	r.printf("| Severity | Kind | Finding | Estimated savings |\n|---|---|---|---|\n")
+	for _, rec := range recommendations {
+		savings := "-"
+		if rec.EstimatedSavings > 0 {
+			savings = time.Duration(rec.EstimatedSavings).String()
+		}
+		r.printf("| %v | %v | %v | %v |\n", rec.Severity, rec.Kind, escapeMarkdown(rec.Description), savings)
+	}
+	r.printf("\n")
+}
+
+// maxReportMessages is the number of validation issues, and of driver
+// messages, listed in the report.
+const maxReportMessages = 20
+
+func (r *reportWriter) validationIssues(issues []*service.ProfilingData_ValidationIssue) {
+	if len(issues) == 0 {
+		return
+	}
+	r.printf("## Validation\n\n")
+	r.printf("The validation layers reported %d issues, invalid API usage may explain unexpected counter values.\n\n", len(issues))
+	r.printf("| Command | Severity | Message |\n|---|---|---|\n")
+	for i, issue := range issues {
+		if i == maxReportMessages {
+			break
+		}
+		cmd := "-"
+		if c := issue.GetCommand(); c != nil {
+			cmd = fmt.Sprint(c.Indices)
+		}
+		r.printf("| %v | %v | %v |\n", cmd, issue.Severity, escapeMarkdown(issue.Message))
+	}
+	if len(issues) > maxReportMessages {
+		r.printf("\n%d more issues were omitted.\n", len(issues)-maxReportMessages)
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) logMessages(messages []*service.ProfilingData_LogMessage, traceStart uint64) {
+	if len(messages) == 0 {
+		return
+	}
+	r.printf("## Driver messages\n\n")
+	r.printf("| Time | Severity | Tag | Message |\n|---|---|---|---|\n")
+	for i, msg := range messages {
+		if i == maxReportMessages {
+			break
+		}
+		at := "-"
+		if msg.Ts >= traceStart {
+			at = time.Duration(msg.Ts - traceStart).String()
+		}
+		r.printf("| %v | %v | %v | %v |\n", at, msg.Severity, escapeMarkdown(msg.Tag), escapeMarkdown(msg.Message))
+	}
+	if len(messages) > maxReportMessages {
+		r.printf("\n%d more messages were omitted.\n", len(messages)-maxReportMessages)
+	}
+	r.printf("\n")
+}
+
+func (r *reportWriter) issues(data *service.ProfilingData) {
+	dups := data.GetSlices().GetDuplicates()
+	clock := data.GetClockCalibration()
+	integrity := data.GetSliceIntegrity()
+	missing := len(integrity.GetMissingRenderPasses())
+	partial := integrity.GetMissingSubmissions() > 0 || missing > 0 ||
+		integrity.GetExtraSlices() > 0 || integrity.GetOutOfOrderSubmissions() > 0
+	if len(data.GetErrors()) == 0 && len(data.GetKnownIssues()) == 0 && dups == 0 && clock == nil && !partial {
+		return
+	}
+	r.printf("## Caveats\n\n")
+	if dups > 0 {
+		r.printf("* The driver emitted %d GPU slices twice, on different tracks.\n", dups)
+	}
+	if clock != nil {
+		r.printf("* The GPU clock of the trace was off by %+.2f%% (±%.2f%%) against the timestamp queries of %d command buffers.",
+			100*clock.Skew, 100*clock.Deviation, clock.Samples)
+		if clock.Corrected {
+			r.printf(" The slices and counters were corrected, the frame statistics were not.")
+		}
+		r.printf("\n")
+	}
+	if partial {
+		r.printf("* The GPU slices cover %d of %d submissions and %d of %d render passes of the capture.",
+			integrity.Submissions-integrity.MissingSubmissions, integrity.Submissions, int(integrity.RenderPasses)-missing, integrity.RenderPasses)
+		if missing > 0 {
+			r.printf(" Missing render passes: %v", integrity.MissingRenderPasses[0].From)
+			if missing > 1 {
+				r.printf(" and %d more", missing-1)
+			}
+			r.printf(".")
+		}
+		if integrity.ExtraSlices > 0 {
+			r.printf(" %d render pass slices (%v) are not part of the capture, e.g. inserted by the driver.",
+				integrity.ExtraSlices, time.Duration(integrity.ExtraTime))
+		}
+		if integrity.OutOfOrderSubmissions > 0 {
+			r.printf(" %d submissions executed out of order.", integrity.OutOfOrderSubmissions)
+		}
+		r.printf("\n")
+	}
+	for _, e := range data.GetErrors() {
+		r.printf("* The %v of the profile are incomplete: %v\n", e.Section, e.Error)
+		if e.Remediation != "" {
+			r.printf("  Hint: %v\n", e.Remediation)
+		}
+	}
+	for _, issue := range data.GetKnownIssues() {
+		r.printf("* Known device issue: %v\n", issue.Description)
+	}
+	r.printf("\n")
+}
+
+// percentile returns the p-th percentile of the sorted values.
+func percentile(sorted []uint64, p float64) uint64 {
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// percentOf formats part relative to total as a percentage, or "-" if the
+// total is zero.
+func percentOf(part, total uint64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*float64(part)/float64(total))
+}
+
+// sparkline returns a single line chart of the values, within [min, max].
+// If there are more values than columns, each column shows the maximum of
+// the values it covers.
+func sparkline(values []uint64, min, max uint64) string {
+	columns := len(values)
+	if columns > reportChartWidth {
+		columns = reportChartWidth
+	}
+	res := make([]rune, columns)
+	for c := range res {
+		v := uint64(0)
+		for _, x := range values[c*len(values)/columns : (c+1)*len(values)/columns] {
+			if x > v {
+				v = x
+			}
+		}
+		level := 0
+		if max > min {
+			level = int(float64(v-min) / float64(max-min) * float64(len(sparkBlocks)-1))
+		}
+		res[c] = sparkBlocks[level]
+	}
+	return string(res)
+}
+
+// histogram returns a bar chart of the number of sorted values per bucket,
+// one line per bucket.
+func histogram(sorted []uint64) string {
+	min, max := sorted[0], sorted[len(sorted)-1]
+	size := (max - min + reportHistogramBuckets) / reportHistogramBuckets
+	counts := make([]int, reportHistogramBuckets)
+	most := 0
+	for _, v := range sorted {
+		b := int((v - min) / size)
+		counts[b]++
+		if counts[b] > most {
+			most = counts[b]
+		}
+	}
+
+	sb := &strings.Builder{}
+	width := reportChartWidth - 30
+	for b, count := range counts {
+		from := time.Duration(min + uint64(b)*size)
+		bar := strings.Repeat("█", count*width/most)
+		fmt.Fprintf(sb, "%12v %-*s %d\n", from, width, bar, count)
+	}
+	return sb.String()
+}
+
+// escapeMarkdown escapes the characters of s that would break a table cell.
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
@@ -0,0 +1,314 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	perfetto "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	sqlPrompt             = "sql> "
+	sqlContinuationPrompt = "...> "
+	sqlHistoryFile        = ".gapit_sql_history"
+	sqlTablesQuery        = "" +
+		"SELECT name FROM sqlite_master WHERE type IN ('table', 'view') ORDER BY name"
+)
+
+type sqlVerb struct{ SqlFlags }
+
+func init() {
+	verb := &sqlVerb{SqlFlags{MaxRows: 100}}
+	app.AddVerb(&app.Verb{
+		Name:       "sql",
+		ShortHelp:  "Starts an interactive SQL prompt against a loaded Perfetto trace",
+		ShortUsage: "<perfetto-trace>",
+		Action:     verb,
+	})
+}
+
+func (verb *sqlVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one perfetto trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	trace := flags.Arg(0)
+	if _, err := os.Stat(trace); os.IsNotExist(err) {
+		return fmt.Errorf("Could not find trace file: %v", trace)
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, trace, CaptureFileFlags{})
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to load the trace file %v", trace)
+	}
+	defer client.Close()
+
+	if verb.Profile {
+		if _, err := client.GpuProfile(ctx, &service.GpuProfileRequest{Capture: capture}); err != nil {
+			return log.Errf(ctx, err, "Failed to profile the trace file %v", trace)
+		}
+	}
+
+	historyPath := verb.History
+	if historyPath == "" {
+		if usr, err := user.Current(); err == nil {
+			historyPath = filepath.Join(usr.HomeDir, sqlHistoryFile)
+		}
+	}
+
+	repl := &sqlRepl{
+		query: func(q string) (*perfetto.QueryResult, error) {
+			return client.PerfettoQuery(ctx, capture, q)
+		},
+		out:     os.Stdout,
+		maxRows: verb.MaxRows,
+	}
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		repl.interactive = true
+	}
+	if historyPath != "" {
+		repl.loadHistory(ctx, historyPath)
+	}
+	return repl.run(ctx, os.Stdin)
+}
+
+// sqlRepl is the state of an interactive SQL prompt.
+type sqlRepl struct {
+	query       func(string) (*perfetto.QueryResult, error)
+	out         io.Writer
+	interactive bool
+	maxRows     int
+	history     []string
+	historyPath string
+	last        *perfetto.QueryResult
+}
+
+// run reads statements and commands from in until the end of the input or a
+// .quit command. Statements may span multiple lines and end with a ';'.
+func (r *sqlRepl) run(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	statement := []string{}
+	r.prompt(sqlPrompt)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(statement) == 0 && line == "":
+		case len(statement) == 0 && strings.HasPrefix(line, "."):
+			if quit := r.command(ctx, line); quit {
+				return nil
+			}
+		default:
+			statement = append(statement, line)
+			if strings.HasSuffix(line, ";") {
+				r.execute(ctx, strings.Join(statement, " "))
+				statement = statement[:0]
+			}
+		}
+		if len(statement) == 0 {
+			r.prompt(sqlPrompt)
+		} else {
+			r.prompt(sqlContinuationPrompt)
+		}
+	}
+	if len(statement) > 0 {
+		r.execute(ctx, strings.Join(statement, " "))
+	}
+	r.prompt("\n")
+	return scanner.Err()
+}
+
+func (r *sqlRepl) prompt(p string) {
+	if r.interactive {
+		fmt.Fprint(r.out, p)
+	}
+}
+
+// command runs the dot command, returning whether the prompt should quit.
+func (r *sqlRepl) command(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ".quit", ".exit":
+		return true
+	case ".tables":
+		r.execute(ctx, sqlTablesQuery)
+	case ".history":
+		first := 0
+		if len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n < len(r.history) {
+				first = len(r.history) - n
+			}
+		}
+		for i := first; i < len(r.history); i++ {
+			fmt.Fprintf(r.out, "%5d  %v\n", i+1, r.history[i])
+		}
+	case ".export-to-csv":
+		if len(fields) != 2 {
+			fmt.Fprintln(r.out, "Usage: .export-to-csv <file>")
+		} else if r.last == nil {
+			fmt.Fprintln(r.out, "No query results to export.")
+		} else if err := r.exportToCSV(fields[1]); err != nil {
+			fmt.Fprintf(r.out, "Failed to export the results: %v\n", err)
+		} else {
+			fmt.Fprintf(r.out, "Exported %d rows to %v\n", r.last.NumRecords, fields[1])
+		}
+	default:
+		fmt.Fprintln(r.out, "Statements end with a ';' and may span multiple lines. Commands:")
+		fmt.Fprintln(r.out, "  .tables                 List the tables and views")
+		fmt.Fprintln(r.out, "  .history [n]            Show the last n statements")
+		fmt.Fprintln(r.out, "  .export-to-csv <file>   Export the results of the last statement")
+		fmt.Fprintln(r.out, "  .quit                   Exit the prompt")
+	}
+	return false
+}
+
+// execute runs the statement, prints its results and records it in the
+// history.
+func (r *sqlRepl) execute(ctx context.Context, statement string) {
+	r.addHistory(ctx, statement)
+	start := time.Now()
+	res, err := r.query(statement)
+	if err == nil && res.GetError() != "" {
+		err = fmt.Errorf("%v", res.GetError())
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	r.last = res
+	writeQueryResult(r.out, res, r.maxRows)
+	fmt.Fprintf(r.out, "(%d rows in %v)\n", res.NumRecords, time.Since(start).Round(time.Millisecond))
+}
+
+// loadHistory loads the history of previous sessions from the file, which
+// new statements are appended to.
+func (r *sqlRepl) loadHistory(ctx context.Context, path string) {
+	r.historyPath = path
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.W(ctx, "Failed to read the SQL history %v: %v", path, err)
+		}
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			r.history = append(r.history, line)
+		}
+	}
+}
+
+func (r *sqlRepl) addHistory(ctx context.Context, statement string) {
+	r.history = append(r.history, statement)
+	if r.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.W(ctx, "Failed to write the SQL history %v: %v", r.historyPath, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, statement)
+}
+
+func (r *sqlRepl) exportToCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	names, rows := queryResultCells(r.last)
+	w.Write(names)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeQueryResult writes the result as an aligned table of at most maxRows
+// rows, or all the rows if maxRows is zero.
+func writeQueryResult(out io.Writer, res *perfetto.QueryResult, maxRows int) {
+	names, rows := queryResultCells(res)
+	if len(names) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	rules := make([]string, len(names))
+	for i, name := range names {
+		rules[i] = strings.Repeat("-", len(name))
+	}
+	fmt.Fprintln(w, strings.Join(names, "\t"))
+	fmt.Fprintln(w, strings.Join(rules, "\t"))
+	for i, row := range rows {
+		if maxRows > 0 && i == maxRows {
+			fmt.Fprintf(w, "... %d more rows, use .export-to-csv for all rows\n", len(rows)-maxRows)
+			break
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// queryResultCells returns the column names and the formatted cells of the
+// rows of the result.
+func queryResultCells(res *perfetto.QueryResult) ([]string, [][]string) {
+	descs, columns := res.GetColumnDescriptors(), res.GetColumns()
+	names := make([]string, len(descs))
+	for i, desc := range descs {
+		names[i] = desc.Name
+	}
+	rows := make([][]string, res.GetNumRecords())
+	for i := range rows {
+		rows[i] = make([]string, len(descs))
+		for j, desc := range descs {
+			col := columns[j]
+			if nulls := col.GetIsNulls(); i < len(nulls) && nulls[i] {
+				rows[i][j] = "NULL"
+				continue
+			}
+			switch desc.Type {
+			case perfetto.QueryResult_ColumnDesc_LONG:
+				rows[i][j] = strconv.FormatInt(col.LongValues[i], 10)
+			case perfetto.QueryResult_ColumnDesc_DOUBLE:
+				rows[i][j] = strconv.FormatFloat(col.DoubleValues[i], 'g', -1, 64)
+			case perfetto.QueryResult_ColumnDesc_STRING:
+				rows[i][j] = col.StringValues[i]
+			default:
+				rows[i][j] = "NULL"
+			}
+		}
+	}
+	return names, rows
+}
@@ -84,8 +84,8 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 	}
 
 	if api.traceType == service.TraceType_Perfetto {
-		if verb.Perfetto == "" {
-			app.Usage(ctx, "The Perfetto config is required for System Profiles.")
+		if verb.Perfetto == "" && verb.Preset == "" {
+			app.Usage(ctx, "The Perfetto config, or a preset, is required for System Profiles.")
 			return nil
 		}
 		if verb.Local.Port != 0 {
@@ -247,10 +247,33 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 		WaitForDebugger:              verb.WaitForDebugger,
 		ProcessName:                  verb.ProcessName,
 		LoadValidationLayer:          verb.LoadValidationLayer,
+		Preset:                       verb.Preset,
 	}
 	target(options)
 
-	if api.traceType == service.TraceType_Perfetto {
+	if verb.VulkanLayers != "" {
+		data, err := ioutil.ReadFile(verb.VulkanLayers)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to read the Vulkan layer config")
+		}
+		options.VulkanLayers = &service.VulkanLayerConfig{}
+		if err := proto.UnmarshalText(string(data), options.VulkanLayers); err != nil {
+			return log.Errf(ctx, err, "Failed to parse the Vulkan layer config")
+		}
+	}
+
+	if verb.Triggers != "" {
+		data, err := ioutil.ReadFile(verb.Triggers)
+		if err != nil {
+			return log.Errf(ctx, err, "Failed to read the trace triggers")
+		}
+		options.Triggers = &service.TraceTriggers{}
+		if err := proto.UnmarshalText(string(data), options.Triggers); err != nil {
+			return log.Errf(ctx, err, "Failed to parse the trace triggers")
+		}
+	}
+
+	if api.traceType == service.TraceType_Perfetto && verb.Perfetto != "" {
 		data, err := ioutil.ReadFile(verb.Perfetto)
 		if err != nil {
 			return log.Errf(ctx, err, "Failed to read Perfetto config")
@@ -300,7 +323,9 @@ func (verb *traceVerb) Run(ctx context.Context, flags flag.FlagSet) error {
 			if !handlerInstalled {
 				crash.Go(func() {
 					reader := bufio.NewReader(os.Stdin)
-					if options.DeferStart {
+					if len(options.GetTriggers().GetStart()) > 0 {
+						println("Waiting for a start trigger...")
+					} else if options.DeferStart {
 						println("Press enter to start capturing...")
 						_, _ = reader.ReadString('\n')
 						_, _ = handler.Event(ctx, service.TraceEvent_Begin)
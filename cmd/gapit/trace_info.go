@@ -0,0 +1,138 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	perfetto "github.com/google/gapid/gapis/perfetto/service"
+)
+
+const (
+	traceBoundsQuery = "SELECT start_ts, end_ts FROM trace_bounds"
+	processesQuery   = "" +
+		"SELECT pid, COALESCE(name, '') FROM process WHERE pid != 0 ORDER BY pid"
+	gpuTracksQuery = "" +
+		"SELECT COALESCE(t.name, ''), COUNT(s.id) FROM gpu_track t " +
+		"LEFT JOIN slice s ON s.track_id = t.id GROUP BY t.id ORDER BY t.id"
+	counterTracksInfoQuery = "" +
+		"SELECT COALESCE(t.name, ''), COUNT(c.id) FROM counter_track t " +
+		"LEFT JOIN counter c ON c.track_id = t.id GROUP BY t.id ORDER BY t.name"
+	eventCountsQuery = "" +
+		"SELECT (SELECT COUNT(*) FROM slice), (SELECT COUNT(*) FROM counter), " +
+		"(SELECT COUNT(*) FROM sched), (SELECT COUNT(*) FROM gpu_slice)"
+)
+
+type traceInfoVerb struct{ TraceInfoFlags }
+
+func init() {
+	verb := &traceInfoVerb{}
+	app.AddVerb(&app.Verb{
+		Name:       "trace-info",
+		ShortHelp:  "Prints a summary of the contents of a .perfetto-trace file",
+		ShortUsage: "<perfetto-trace>",
+		Action:     verb,
+	})
+}
+
+func (verb *traceInfoVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	if flags.NArg() != 1 {
+		app.Usage(ctx, "Exactly one perfetto trace file expected, got %d", flags.NArg())
+		return nil
+	}
+
+	trace := flags.Arg(0)
+	if _, err := os.Stat(trace); os.IsNotExist(err) {
+		return fmt.Errorf("Could not find trace file: %v", trace)
+	}
+
+	client, capture, err := getGapisAndLoadCapture(ctx, verb.Gapis, GapirFlags{}, trace, CaptureFileFlags{})
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to load the trace file %v", trace)
+	}
+	defer client.Close()
+
+	query := func(q string) (*perfetto.QueryResult, error) {
+		res, err := client.PerfettoQuery(ctx, capture, q)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Query failed: %v", q)
+		}
+		return res, nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	bounds, err := query(traceBoundsQuery)
+	if err != nil {
+		return err
+	}
+	if bounds.GetNumRecords() > 0 {
+		start := bounds.GetColumns()[0].GetLongValues()[0]
+		end := bounds.GetColumns()[1].GetLongValues()[0]
+		fmt.Fprintf(w, "Duration:\t%v\n", time.Duration(end-start))
+	}
+
+	counts, err := query(eventCountsQuery)
+	if err != nil {
+		return err
+	}
+	if counts.GetNumRecords() > 0 {
+		columns := counts.GetColumns()
+		fmt.Fprintf(w, "Slices:\t%v\n", columns[0].GetLongValues()[0])
+		fmt.Fprintf(w, "Counter samples:\t%v\n", columns[1].GetLongValues()[0])
+		fmt.Fprintf(w, "Scheduling events:\t%v\n", columns[2].GetLongValues()[0])
+		fmt.Fprintf(w, "GPU slices:\t%v\n", columns[3].GetLongValues()[0])
+	}
+
+	processes, err := query(processesQuery)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%v processes:\n", processes.GetNumRecords())
+	pids := processes.GetColumns()[0].GetLongValues()
+	names := processes.GetColumns()[1].GetStringValues()
+	for i := range pids {
+		fmt.Fprintf(w, "\t%v\t%v\n", pids[i], names[i])
+	}
+
+	if err := printTrackCounts(w, "GPU tracks", "slices", query, gpuTracksQuery); err != nil {
+		return err
+	}
+	return printTrackCounts(w, "counter tracks", "samples", query, counterTracksInfoQuery)
+}
+
+// printTrackCounts prints the names and event counts of the tracks returned
+// by the given query.
+func printTrackCounts(w *tabwriter.Writer, title, events string, query func(string) (*perfetto.QueryResult, error), q string) error {
+	tracks, err := query(q)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%v %v:\n", tracks.GetNumRecords(), title)
+	names := tracks.GetColumns()[0].GetStringValues()
+	counts := tracks.GetColumns()[1].GetLongValues()
+	for i := range names {
+		fmt.Fprintf(w, "\t%v\t%v %v\n", names[i], counts[i], events)
+	}
+	return nil
+}
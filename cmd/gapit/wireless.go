@@ -0,0 +1,72 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+)
+
+type wirelessVerb struct{ WirelessFlags }
+
+func init() {
+	verb := &wirelessVerb{}
+	app.AddVerb(&app.Verb{
+		Name:       "wireless",
+		ShortHelp:  "Discovers, pairs with and connects to Android devices over Wi-Fi",
+		ShortUsage: "[<address>]",
+		Action:     verb,
+	})
+}
+
+func (verb *wirelessVerb) Run(ctx context.Context, flags flag.FlagSet) error {
+	switch flags.NArg() {
+	case 0:
+		services, err := adb.DiscoverWireless(ctx)
+		if err != nil {
+			return log.Err(ctx, err, "Failed to discover wireless devices")
+		}
+		for _, s := range services {
+			fmt.Fprintf(os.Stdout, "%-24v %-28v %v\n", s.Name, s.Type, s.Address)
+		}
+		return nil
+	case 1:
+		address := flags.Arg(0)
+		if verb.Code != "" {
+			if err := adb.Pair(ctx, address, verb.Code); err != nil {
+				return log.Errf(ctx, err, "Failed to pair with %v", address)
+			}
+			if verb.Connect == "" {
+				fmt.Fprintf(os.Stdout, "Paired with %v\n", address)
+				return nil
+			}
+			address = verb.Connect
+		}
+		if err := adb.Connect(ctx, address); err != nil {
+			return log.Errf(ctx, err, "Failed to connect to %v", address)
+		}
+		fmt.Fprintf(os.Stdout, "Connected to %v\n", address)
+		return nil
+	default:
+		app.Usage(ctx, "At most one device address expected, got %d", flags.NArg())
+		return nil
+	}
+}
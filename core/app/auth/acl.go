@@ -0,0 +1,148 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Role is the access granted to the holder of a token.
+type Role int
+
+const (
+	// ReadOnly only grants access to the RPCs that don't modify the state of
+	// the server.
+	ReadOnly Role = iota + 1
+	// ReadWrite grants access to all RPCs.
+	ReadWrite
+)
+
+var (
+	// ErrReadOnly is returned when a read-only token is used to call an RPC
+	// that modifies the state of the server.
+	ErrReadOnly = fmt.Errorf("Permission denied, the auth-token only grants read access")
+
+	roleNames = map[string]Role{
+		"read-only":  ReadOnly,
+		"read-write": ReadWrite,
+	}
+)
+
+// ACL maps the tokens accepted by a server to the access they grant. If the
+// ACL contains NoAuth, its role is granted to connections without a known
+// token.
+type ACL map[Token]Role
+
+// ParseACL parses an ACL with one token per line, followed by its role,
+// either read-only or read-write. Empty lines and lines starting with '#' are
+// ignored.
+func ParseACL(r io.Reader) (ACL, error) {
+	acl := ACL{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Line %d: expected '<token> <role>', got '%v'", line, text)
+		}
+		role, ok := roleNames[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("Line %d: unknown role '%v'", line, fields[1])
+		}
+		acl[Token(fields[0])] = role
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// ReadOnly returns a copy of the ACL granting at most read access to all
+// tokens.
+func (acl ACL) ReadOnly() ACL {
+	res := ACL{}
+	for token := range acl {
+		res[token] = ReadOnly
+	}
+	return res
+}
+
+// check returns an error if the token of the incoming RPC call doesn't grant
+// access to the method. isRead returns whether a method only reads the state
+// of the server.
+func (acl ACL) check(ctx context.Context, method string, isRead func(method string) bool) error {
+	token := NoAuth
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if got, ok := md[rpcHeader]; ok && len(got) == 1 {
+			token = Token(got[0])
+		}
+	}
+	role, ok := acl.role(token)
+	if !ok {
+		if role, ok = acl[NoAuth]; !ok {
+			return ErrInvalidToken
+		}
+	}
+	if role != ReadWrite && !isRead(method) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// role returns the role of the token, if in the ACL. The token is compared to
+// every token of the ACL in constant time, such that the time taken doesn't
+// reveal the tokens.
+func (acl ACL) role(token Token) (Role, bool) {
+	role, found := Role(0), false
+	for t, r := range acl {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role, found = r, true
+		}
+	}
+	return role, found
+}
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor that checks
+// that incoming RPC calls use a token granting access to the called method.
+func (acl ACL) UnaryServerInterceptor(isRead func(method string) bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := acl.check(ctx, info.FullMethod, isRead); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor that checks
+// that incoming RPC calls use a token granting access to the called method.
+func (acl ACL) StreamServerInterceptor(isRead func(method string) bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := acl.check(ss.Context(), info.FullMethod, isRead); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/app/auth"
+	"github.com/google/gapid/core/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseACL(t *testing.T) {
+	assert := assert.To(t)
+	acl, err := auth.ParseACL(strings.NewReader("# Team\nabc read-only\n\n  def read-write\n"))
+	assert.For("err").ThatError(err).Succeeded()
+	assert.For("acl").That(acl).DeepEquals(auth.ACL{"abc": auth.ReadOnly, "def": auth.ReadWrite})
+
+	_, err = auth.ParseACL(strings.NewReader("abc admin\n"))
+	assert.For("unknown role").ThatError(err).Failed()
+	_, err = auth.ParseACL(strings.NewReader("abc\n"))
+	assert.For("missing role").ThatError(err).Failed()
+}
+
+func TestACLInterceptor(t *testing.T) {
+	assert := assert.To(t)
+	acl := auth.ACL{"reader": auth.ReadOnly, "writer": auth.ReadWrite}
+	isRead := func(method string) bool { return method == "/service/Get" }
+	interceptor := acl.UnaryServerInterceptor(isRead)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+
+	call := func(token, method string) error {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("auth_token", token))
+		}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.For("reader get").ThatError(call("reader", "/service/Get")).Succeeded()
+	assert.For("reader set").ThatError(call("reader", "/service/Set")).Equals(auth.ErrReadOnly)
+	assert.For("writer set").ThatError(call("writer", "/service/Set")).Succeeded()
+	assert.For("unknown").ThatError(call("other", "/service/Get")).Equals(auth.ErrInvalidToken)
+	assert.For("prefix").ThatError(call("read", "/service/Get")).Equals(auth.ErrInvalidToken)
+	assert.For("missing").ThatError(call("", "/service/Get")).Equals(auth.ErrInvalidToken)
+
+	readOnly := acl.ReadOnly()
+	assert.For("read-only mode").That(readOnly["writer"]).Equals(auth.ReadOnly)
+
+	anyone := auth.ACL{auth.NoAuth: auth.ReadOnly}.UnaryServerInterceptor(isRead)
+	_, err := anyone(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/service/Get"}, handler)
+	assert.For("no auth").ThatError(err).Succeeded()
+}
@@ -66,6 +66,9 @@ type FileLayout interface {
 	GoArgs(ctx context.Context) []string
 	// DeviceInfo returns the device info executable for the given ABI.
 	DeviceInfo(ctx context.Context, os device.OSKind) (file.Path, error)
+	// CalibrationTrace returns the path to the trace of the standard
+	// workload used to calibrate the GPU counters of devices.
+	CalibrationTrace(ctx context.Context) (file.Path, error)
 }
 
 func withExecutablePlatformSuffix(exe string, os device.OSKind) string {
@@ -238,6 +241,10 @@ func (l pkgLayout) DeviceInfo(ctx context.Context, os device.OSKind) (file.Path,
 	return l.root.Join(osToDir(os), withExecutablePlatformSuffix("device-info", os)), nil
 }
 
+func (l pkgLayout) CalibrationTrace(ctx context.Context) (file.Path, error) {
+	return l.root.Join("calibration", calibrationTrace), nil
+}
+
 // NewPkgLayout returns a FileLayout rooted at the given directory with the standard package layout.
 // If create is true, the package layout is created if it doesn't exist, otherwise an error is returned.
 func NewPkgLayout(dir file.Path, create bool) (FileLayout, error) {
@@ -260,6 +267,10 @@ type runfilesLayout struct {
 	mapping  map[string]string
 }
 
+// calibrationTrace is the trace of the vulkan_sample app, a small scene
+// rendered every frame, replayed as the standard calibration workload.
+const calibrationTrace = "vulkan_sample.gfxtrace"
+
 var abiToApkPath = map[device.Architecture]string{
 	device.ARMv7a: "armeabi-v7a.apk",
 	device.ARMv8a: "arm64-v8a.apk",
@@ -371,6 +382,10 @@ func (l *runfilesLayout) PerfettoCmd(ctx context.Context, abi *device.ABI) (file
 	return file.Path{}, ErrCannotFindPackageFiles
 }
 
+func (l *runfilesLayout) CalibrationTrace(ctx context.Context) (file.Path, error) {
+	return l.find("gapid/test/traces/" + calibrationTrace)
+}
+
 // unknownLayout is the file layout used when no other layout can be discovered.
 // All methods will return an error.
 type unknownLayout struct{}
@@ -415,6 +430,10 @@ func (l unknownLayout) PerfettoCmd(ctx context.Context, abi *device.ABI) (file.P
 	return file.Path{}, ErrCannotFindPackageFiles
 }
 
+func (l unknownLayout) CalibrationTrace(ctx context.Context) (file.Path, error) {
+	return file.Path{}, ErrCannotFindPackageFiles
+}
+
 // ZipLayout is a FileLayout view over a ZIP file.
 type ZipLayout struct {
 	f     *zip.Reader
@@ -504,3 +523,8 @@ func (l *ZipLayout) PerfettoCmd(ctx context.Context, abi *device.ABI) (*zip.File
 	}
 	return l.file(osToDir(abi.OS) + "/perfetto/" + withExecutablePlatformSuffix("perfetto", abi.OS))
 }
+
+// CalibrationTrace returns the trace of the standard calibration workload.
+func (l *ZipLayout) CalibrationTrace(ctx context.Context) (*zip.File, error) {
+	return l.file("calibration/" + calibrationTrace)
+}
@@ -127,3 +127,9 @@ func DeviceInfo(ctx context.Context, os device.OSKind) (file.Path, error) {
 func PerfettoCmd(ctx context.Context, abi *device.ABI) (file.Path, error) {
 	return layout(ctx).PerfettoCmd(ctx, abi)
 }
+
+// CalibrationTrace returns the path to the trace of the standard workload used
+// to calibrate the GPU counters of devices.
+func CalibrationTrace(ctx context.Context) (file.Path, error) {
+	return layout(ctx).CalibrationTrace(ctx)
+}
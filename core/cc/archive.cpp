@@ -285,6 +285,13 @@ bool Archive::write(const std::string& id, const void* buffer, uint32_t size) {
   return true;
 }
 
+void Archive::clear() {
+  mDataFile.resize(0);
+  must_truncate(fileno(mIndexFile), 0);
+  fseek(mIndexFile, 0, SEEK_END);
+  mRecords.clear();
+}
+
 }  // namespace core
 
 extern "C" {
@@ -53,6 +53,12 @@ class Archive {
   // Write a resource of size size keyed by id from buffer into the archive.
   bool write(const std::string& id, const void* buffer, uint32_t size);
 
+  // Returns the size of the data of the archive, in bytes.
+  uint64_t size() { return mDataFile.size(); }
+
+  // Removes all the records from the archive.
+  void clear();
+
   // Returns the path of the index file.
   std::string indexFilePath() const { return mIndexFilePath; }
 
@@ -0,0 +1,222 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package arrow writes tables in the Apache Arrow IPC streaming format, see
+// https://arrow.apache.org/docs/format/Columnar.html, such that the Arrow
+// libraries can read them without copying the columns. Only non-nullable 64
+// bit integer and UTF-8 string columns are supported.
+package arrow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants of the Arrow flatbuffers schema, Schema.fbs and Message.fbs.
+const (
+	metadataV5         = 4
+	headerSchema       = 1
+	headerRecordBatch  = 3
+	typeInt            = 2
+	typeUtf8           = 5
+	continuationMarker = 0xffffffff
+)
+
+type columnKind int
+
+const (
+	int64Column columnKind = iota
+	stringColumn
+)
+
+// Column is a named column of a table.
+type Column struct {
+	Name    string
+	kind    columnKind
+	int64s  []int64
+	strings []string
+}
+
+// Int64Column returns a column of 64 bit signed integers.
+func Int64Column(name string, values []int64) Column {
+	return Column{Name: name, kind: int64Column, int64s: values}
+}
+
+// StringColumn returns a column of UTF-8 strings.
+func StringColumn(name string, values []string) Column {
+	return Column{Name: name, kind: stringColumn, strings: values}
+}
+
+// Len returns the number of values of the column.
+func (c Column) Len() int {
+	if c.kind == stringColumn {
+		return len(c.strings)
+	}
+	return len(c.int64s)
+}
+
+// WriteTable writes the columns, which must all have the same length, to w
+// as an Arrow stream of a single record batch.
+func WriteTable(w io.Writer, columns []Column) error {
+	length := 0
+	for i, c := range columns {
+		if i == 0 {
+			length = c.Len()
+		} else if c.Len() != length {
+			return fmt.Errorf("Column %v has %d values, expected %d", c.Name, c.Len(), length)
+		}
+	}
+
+	if err := writeMessage(w, headerSchema, schema(columns), 0); err != nil {
+		return err
+	}
+
+	// The body holds the buffers of the columns, each aligned to 8 bytes. The
+	// columns have no nulls, so their validity buffers are empty.
+	nodes, buffers, body := [][2]int64{}, [][2]int64{}, int64(0)
+	addBuffer := func(size int64) {
+		buffers = append(buffers, [2]int64{body, size})
+		body += align8(size)
+	}
+	for _, c := range columns {
+		nodes = append(nodes, [2]int64{int64(length), 0})
+		addBuffer(0)
+		switch c.kind {
+		case int64Column:
+			addBuffer(int64(8 * length))
+		case stringColumn:
+			size := int64(0)
+			for _, s := range c.strings {
+				size += int64(len(s))
+			}
+			if size > math.MaxInt32 {
+				return fmt.Errorf("Column %v has %d bytes of strings, more than the 2GB of an Arrow string column", c.Name, size)
+			}
+			addBuffer(int64(4 * (length + 1)))
+			addBuffer(size)
+		}
+	}
+	batch := func(b *builder) int {
+		return b.table(
+			scalar(8, uint64(length)),
+			object(func(b *builder) int { return b.structs(nodes) }),
+			object(func(b *builder) int { return b.structs(buffers) }),
+		)
+	}
+	if err := writeMessage(w, headerRecordBatch, batch, body); err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		var err error
+		switch c.kind {
+		case int64Column:
+			err = writePadded(w, int64(8*length), func() error {
+				return binary.Write(w, binary.LittleEndian, c.int64s)
+			})
+		case stringColumn:
+			offsets, offset := make([]int32, length+1), int32(0)
+			for i, s := range c.strings {
+				offset += int32(len(s))
+				offsets[i+1] = offset
+			}
+			err = writePadded(w, int64(4*(length+1)), func() error {
+				return binary.Write(w, binary.LittleEndian, offsets)
+			})
+			if err == nil {
+				err = writePadded(w, int64(offset), func() error {
+					for _, s := range c.strings {
+						if _, err := io.WriteString(w, s); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The end of the stream.
+	return binary.Write(w, binary.LittleEndian, []uint32{continuationMarker, 0})
+}
+
+// schema returns the writer of the schema of the columns.
+func schema(columns []Column) func(b *builder) int {
+	fields := make([]func(b *builder) int, len(columns))
+	for i, c := range columns {
+		c := c
+		fields[i] = func(b *builder) int {
+			typ, typeTable := uint64(typeInt), func(b *builder) int {
+				return b.table(scalar(4, 64), scalar(1, 1)) // bitWidth, is_signed
+			}
+			if c.kind == stringColumn {
+				typ, typeTable = typeUtf8, func(b *builder) int { return b.table() }
+			}
+			return b.table(
+				object(func(b *builder) int { return b.string(c.Name) }),
+				scalar(1, 0), // nullable
+				scalar(1, typ),
+				object(typeTable),
+				nil, // dictionary
+				object(func(b *builder) int { return b.tables(nil) }), // children
+			)
+		}
+	}
+	return func(b *builder) int {
+		return b.table(
+			scalar(2, 0), // little endian
+			object(func(b *builder) int { return b.tables(fields) }),
+		)
+	}
+}
+
+// writeMessage writes an encapsulated message with the header, preceding its
+// body of bodyLength bytes.
+func writeMessage(w io.Writer, headerType uint64, header func(b *builder) int, bodyLength int64) error {
+	meta := finish(func(b *builder) int {
+		return b.table(
+			scalar(2, metadataV5),
+			scalar(1, headerType),
+			object(header),
+			scalar(8, uint64(bodyLength)),
+		)
+	})
+	// The metadata is padded such that the body is aligned to 8 bytes.
+	size := align8(int64(8+len(meta))) - 8
+	if err := binary.Write(w, binary.LittleEndian, []uint32{continuationMarker, uint32(size)}); err != nil {
+		return err
+	}
+	return writePadded(w, int64(len(meta)), func() error {
+		_, err := w.Write(meta)
+		return err
+	})
+}
+
+// writePadded calls write, writing size bytes, and pads them to 8 bytes.
+func writePadded(w io.Writer, size int64, write func() error) error {
+	if err := write(); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, align8(size)-size))
+	return err
+}
+
+func align8(size int64) int64 {
+	return (size + 7) &^ 7
+}
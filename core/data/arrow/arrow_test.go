@@ -0,0 +1,179 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arrow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/arrow"
+	"github.com/google/gapid/core/log"
+)
+
+// table is a flatbuffer table read back from a message.
+type table struct {
+	buf []byte
+	pos int
+}
+
+func root(buf []byte) table {
+	return table{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the field, or 0 if absent.
+func (t table) field(id int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	if offset := int(binary.LittleEndian.Uint16(t.buf[vtable+4+2*id:])); offset != 0 {
+		return t.pos + offset
+	}
+	return 0
+}
+
+func (t table) uint(id, size int) uint64 {
+	pos, v := t.field(id), uint64(0)
+	for i := 0; pos != 0 && i < size; i++ {
+		v |= uint64(t.buf[pos+i]) << (8 * i)
+	}
+	return v
+}
+
+func (t table) deref(id int) int {
+	pos := t.field(id)
+	return pos + int(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+func (t table) table(id int) table {
+	return table{t.buf, t.deref(id)}
+}
+
+func (t table) string(id int) string {
+	pos := t.deref(id)
+	return string(t.buf[pos+4 : pos+4+int(binary.LittleEndian.Uint32(t.buf[pos:]))])
+}
+
+func (t table) vector(id int) (pos, count int) {
+	pos = t.deref(id)
+	return pos + 4, int(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+func (t table) tables(id int) []table {
+	pos, count := t.vector(id)
+	tables := make([]table, count)
+	for i := range tables {
+		p := pos + 4*i
+		tables[i] = table{t.buf, p + int(binary.LittleEndian.Uint32(t.buf[p:]))}
+	}
+	return tables
+}
+
+func (t table) structs(id int) [][2]int64 {
+	pos, count := t.vector(id)
+	structs := make([][2]int64, count)
+	for i := range structs {
+		structs[i][0] = int64(binary.LittleEndian.Uint64(t.buf[pos+16*i:]))
+		structs[i][1] = int64(binary.LittleEndian.Uint64(t.buf[pos+16*i+8:]))
+	}
+	return structs
+}
+
+// readMessage reads an encapsulated message, returning its metadata and body,
+// or false at the end of the stream.
+func readMessage(ctx context.Context, r *bytes.Reader) (table, []byte, bool) {
+	var prefix [2]uint32
+	binary.Read(r, binary.LittleEndian, &prefix)
+	assert.For(ctx, "continuation").That(prefix[0]).Equals(uint32(0xffffffff))
+	if prefix[1] == 0 {
+		return table{}, nil, false
+	}
+	assert.For(ctx, "metadata alignment").That((8 + prefix[1]) % 8).Equals(uint32(0))
+	meta := make([]byte, prefix[1])
+	r.Read(meta)
+	msg := root(meta)
+	assert.For(ctx, "version").That(msg.uint(0, 2)).Equals(uint64(4))
+	body := make([]byte, msg.uint(3, 8))
+	r.Read(body)
+	return msg, body, true
+}
+
+func TestWriteTable(t *testing.T) {
+	ctx := log.Testing(t)
+	buf := &bytes.Buffer{}
+	err := arrow.WriteTable(buf, []arrow.Column{
+		arrow.Int64Column("ts", []int64{10, -20, 30}),
+		arrow.StringColumn("name", []string{"vkQueueSubmit", "", "Shadows"}),
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "alignment").That(buf.Len() % 8).Equals(0)
+	r := bytes.NewReader(buf.Bytes())
+
+	msg, body, ok := readMessage(ctx, r)
+	assert.For(ctx, "schema").That(ok).Equals(true)
+	assert.For(ctx, "schema header").That(msg.uint(1, 1)).Equals(uint64(1))
+	assert.For(ctx, "schema body").That(len(body)).Equals(0)
+	fields := msg.table(2).tables(1)
+	if !assert.For(ctx, "fields").That(len(fields)).Equals(2) {
+		return
+	}
+	assert.For(ctx, "ts").That(fields[0].string(0)).Equals("ts")
+	assert.For(ctx, "ts nullable").That(fields[0].uint(1, 1)).Equals(uint64(0))
+	assert.For(ctx, "ts type").That(fields[0].uint(2, 1)).Equals(uint64(2))
+	assert.For(ctx, "ts width").That(fields[0].table(3).uint(0, 4)).Equals(uint64(64))
+	assert.For(ctx, "ts signed").That(fields[0].table(3).uint(1, 1)).Equals(uint64(1))
+	assert.For(ctx, "name").That(fields[1].string(0)).Equals("name")
+	assert.For(ctx, "name type").That(fields[1].uint(2, 1)).Equals(uint64(5))
+	_, children := fields[1].vector(5)
+	assert.For(ctx, "children").That(children).Equals(0)
+
+	msg, body, ok = readMessage(ctx, r)
+	assert.For(ctx, "batch").That(ok).Equals(true)
+	assert.For(ctx, "batch header").That(msg.uint(1, 1)).Equals(uint64(3))
+	batch := msg.table(2)
+	assert.For(ctx, "length").That(batch.uint(0, 8)).Equals(uint64(3))
+	assert.For(ctx, "nodes").ThatSlice(batch.structs(1)).Equals([][2]int64{{3, 0}, {3, 0}})
+	buffers := batch.structs(2)
+	if !assert.For(ctx, "buffers").That(len(buffers)).Equals(5) {
+		return
+	}
+	for _, b := range buffers {
+		assert.For(ctx, "buffer alignment").That(b[0] % 8).Equals(int64(0))
+	}
+	ts := make([]int64, 3)
+	binary.Read(bytes.NewReader(body[buffers[1][0]:]), binary.LittleEndian, ts)
+	assert.For(ctx, "ts values").ThatSlice(ts).Equals([]int64{10, -20, 30})
+	offsets := make([]int32, 4)
+	binary.Read(bytes.NewReader(body[buffers[3][0]:]), binary.LittleEndian, offsets)
+	assert.For(ctx, "name offsets").ThatSlice(offsets).Equals([]int32{0, 13, 13, 20})
+	data := body[buffers[4][0] : buffers[4][0]+buffers[4][1]]
+	assert.For(ctx, "name data").That(string(data)).Equals("vkQueueSubmitShadows")
+
+	_, _, ok = readMessage(ctx, r)
+	assert.For(ctx, "end of stream").That(ok).Equals(false)
+	assert.For(ctx, "trailing").That(r.Len()).Equals(0)
+}
+
+func TestWriteTableMismatchedLengths(t *testing.T) {
+	ctx := log.Testing(t)
+	err := arrow.WriteTable(&bytes.Buffer{}, []arrow.Column{
+		arrow.Int64Column("ts", []int64{1, 2}),
+		arrow.StringColumn("name", []string{"a"}),
+	})
+	assert.For(ctx, "err").ThatError(err).Failed()
+}
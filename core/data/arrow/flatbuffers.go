@@ -0,0 +1,153 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arrow
+
+import "encoding/binary"
+
+// builder builds a flatbuffer front to back. The offsets to the objects
+// referenced by tables and vectors are unsigned, so these objects are written
+// after the table or vector referencing them.
+type builder struct {
+	buf []byte
+}
+
+// field is a field of a table: an inline scalar of size bytes, or if object
+// is not nil, the offset to the object it writes.
+type field struct {
+	size   int
+	value  uint64
+	object func(b *builder) int
+}
+
+func scalar(size int, value uint64) *field {
+	return &field{size: size, value: value}
+}
+
+func object(object func(b *builder) int) *field {
+	return &field{size: 4, object: object}
+}
+
+// finish returns the flatbuffer with the root table written by root.
+func finish(root func(b *builder) int) []byte {
+	b := &builder{}
+	b.alloc(4)
+	b.putUint32(0, uint32(root(b)))
+	return b.buf
+}
+
+func (b *builder) alloc(size int) int {
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	return pos
+}
+
+// pad pads the buffer such that the next byte is at offset from a multiple of
+// align.
+func (b *builder) pad(align, offset int) {
+	for (len(b.buf)+offset)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *builder) putUint32(pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], v)
+}
+
+// putOffset writes the offset at pos to the object at target.
+func (b *builder) putOffset(pos, target int) {
+	b.putUint32(pos, uint32(target-pos))
+}
+
+// table writes a table of the fields, by field ID, nil for the fields that
+// are absent, preceded by its vtable, and returns its position.
+func (b *builder) table(fields ...*field) int {
+	// The fields follow the offset to the vtable, by decreasing size.
+	offsets := make([]int, len(fields))
+	size, align := 4, 4
+	for _, s := range []int{8, 4, 2, 1} {
+		for i, f := range fields {
+			if f != nil && f.size == s {
+				size = (size + s - 1) / s * s
+				offsets[i] = size
+				size += s
+				if s > align {
+					align = s
+				}
+			}
+		}
+	}
+
+	b.pad(2, 0)
+	vtable := b.alloc(4 + 2*len(fields))
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*len(fields)))
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(size))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*i:], uint16(offset))
+	}
+
+	b.pad(align, 0)
+	table := b.alloc(size)
+	b.putUint32(table, uint32(table-vtable))
+	for i, f := range fields {
+		if f == nil || f.object != nil {
+			continue
+		}
+		for j := 0; j < f.size; j++ {
+			b.buf[table+offsets[i]+j] = byte(f.value >> (8 * j))
+		}
+	}
+	for i, f := range fields {
+		if f != nil && f.object != nil {
+			b.putOffset(table+offsets[i], f.object(b))
+		}
+	}
+	return table
+}
+
+// string writes a string and returns its position.
+func (b *builder) string(s string) int {
+	b.pad(4, 0)
+	pos := b.alloc(4)
+	b.putUint32(pos, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+// tables writes a vector of the tables written by tables and returns its
+// position.
+func (b *builder) tables(tables []func(b *builder) int) int {
+	b.pad(4, 0)
+	pos := b.alloc(4 + 4*len(tables))
+	b.putUint32(pos, uint32(len(tables)))
+	for i, table := range tables {
+		b.putOffset(pos+4+4*i, table(b))
+	}
+	return pos
+}
+
+// structs writes a vector of structs of two 64 bit integers, e.g. the
+// FieldNode and Buffer structs, and returns its position.
+func (b *builder) structs(structs [][2]int64) int {
+	// The structs are aligned to 8 bytes, after the length.
+	b.pad(8, 4)
+	pos := b.alloc(4 + 16*len(structs))
+	b.putUint32(pos, uint32(len(structs)))
+	for i, s := range structs {
+		binary.LittleEndian.PutUint64(b.buf[pos+4+16*i:], uint64(s[0]))
+		binary.LittleEndian.PutUint64(b.buf[pos+12+16*i:], uint64(s[1]))
+	}
+	return pos
+}
@@ -81,6 +81,20 @@ func init() {
 
 	shell.LocalTarget = stub.OneOf(
 		devices,
+		stub.RespondTo(adbPath.System()+` mdns services`, `
+List of discovered mdns services
+adb-1234-AbCdEf	_adb-tls-pairing._tcp.	192.168.1.10:37001
+adb-1234-AbCdEf	_adb-tls-connect._tcp.	192.168.1.10:41235
+`),
+		stub.RespondTo(adbPath.System()+` pair 192.168.1.10:37001 123456`, `
+Successfully paired to 192.168.1.10:37001 [guid=adb-1234-AbCdEf]
+`),
+		stub.RespondTo(adbPath.System()+` pair 192.168.1.10:37001 000000`, `
+Failed: Wrong password or connection was dropped.
+`),
+		stub.RespondTo(adbPath.System()+` connect 192.168.1.10:41235`, `
+connected to 192.168.1.10:41235
+`),
 		stub.RespondTo(adbPath.System()+` -s dumpsys_device shell dumpsys package`, `
 Activity Resolver Table:
   Non-Data Actions:
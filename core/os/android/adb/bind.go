@@ -48,6 +48,10 @@ type Device interface {
 	// - an error to indicate if anything went wrong
 	// The returned bool disambiguates between "an error happened" and "profiling is not supported".
 	PrepareGpuProfiling(ctx context.Context, installedPackage *android.InstalledPackage) (bool, string, app.Cleanup, error)
+	// SetSustainedPerformance locks the clocks of the device, such that the
+	// performance of runs is comparable. It returns the mode enabled, empty if
+	// the device has none, and a cleanup function that restores the clocks.
+	SetSustainedPerformance(ctx context.Context) (string, app.Cleanup, error)
 }
 
 // Driver contains the information about a graphics driver.
@@ -53,8 +53,20 @@ const (
 
 	systemImageGpuProfilerSupportProperty = "graphics.gpu.profiler.support"
 	gpuProfilerVulkanLayerApkProperty     = "graphics.gpu.profiler.vulkan_layer_apk"
+
+	// FixedPerformanceMode is the sustained performance mode of the Android
+	// power manager.
+	FixedPerformanceMode = "fixed_performance"
 )
 
+// gpuGovernors are the vendor GPU frequency governors that stand in for the
+// fixed performance mode on rooted devices without it.
+var gpuGovernors = []struct {
+	mode, path, value string
+}{
+	{"kgsl_performance", "/sys/class/kgsl/kgsl-3d0/devfreq/governor", "performance"}, // Qualcomm
+}
+
 func isRootSuccessful(line string) bool {
 	for _, expected := range []string{
 		"adbd is already running as root",
@@ -428,6 +440,10 @@ func (b *binding) QueryPerfettoGpuProfilingDataSources(ctx context.Context) (*de
 			proto.UnmarshalMerge(data, gpu.GpuCounterDescriptor)
 		}
 	}
+	if gpu.GpuCounterDescriptor != nil {
+		gpu.GpuCounterDescriptor.GroupBlocks()
+		gpu.GpuCounterDescriptor.EstimateSamplingCosts()
+	}
 	return gpu, nil
 }
 
@@ -598,3 +614,34 @@ func (b *binding) PrepareGpuProfiling(ctx context.Context, installedPackage *and
 	}
 	return true, packageName, cleanup, nil
 }
+
+// SetSustainedPerformance implements the adb.Device interface.
+func (b *binding) SetSustainedPerformance(ctx context.Context) (string, app.Cleanup, error) {
+	// Android 11 and newer lock the clocks through the power manager.
+	res, err := b.Shell("cmd", "power", "set-fixed-performance-mode-enabled", "true").Call(ctx)
+	if err == nil && res == "" {
+		return FixedPerformanceMode, func(ctx context.Context) {
+			b.Shell("cmd", "power", "set-fixed-performance-mode-enabled", "false").Call(ctx)
+		}, nil
+	}
+	log.D(ctx, "Fixed performance mode not available: %v %s", err, res)
+
+	// Otherwise, pin the GPU frequency governor of the vendor if adbd runs as
+	// root.
+	if uid, err := b.Shell("id", "-u").Call(ctx); err != nil || uid != "0" {
+		return "", nil, nil
+	}
+	for _, g := range gpuGovernors {
+		old, err := b.Shell("cat", g.path).Call(ctx)
+		if err != nil || old == "" {
+			continue
+		}
+		if _, err := b.Shell("echo", g.value, ">", g.path).Call(ctx); err != nil {
+			return "", nil, log.Errf(ctx, err, "Failed to set the GPU governor %v", g.path)
+		}
+		return g.mode, func(ctx context.Context) {
+			b.Shell("echo", old, ">", g.path).Call(ctx)
+		}, nil
+	}
+	return "", nil, nil
+}
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/fault"
 	"github.com/google/gapid/core/log"
@@ -334,6 +335,9 @@ func scanDevices(ctx context.Context) error {
 			}
 			cache[serial] = device
 			registry.AddDevice(ctx, device)
+			if status == bind.Online && IsWireless(serial) {
+				crash.Go(func() { checkWirelessBandwidth(ctx, device) })
+			}
 		}
 	}
 
@@ -78,6 +78,19 @@ func parseLogcatPriority(r byte) android.LogcatPriority {
 // Logcat writes all logcat messages reported by the device to the chan msgs,
 // blocking until the context is stopped.
 func (b *binding) Logcat(ctx context.Context, msgs chan<- android.LogcatMessage) error {
+	return b.logcat(ctx, msgs, "GAPID:V", "*:W")
+}
+
+// ProcessLogcat writes the logcat messages of all priorities logged by the
+// process with the given pid to the chan msgs, blocking until the context is
+// stopped.
+func (b *binding) ProcessLogcat(ctx context.Context, pid int, msgs chan<- android.LogcatMessage) error {
+	return b.logcat(ctx, msgs, "--pid", strconv.Itoa(pid), "*:V")
+}
+
+// logcat writes the logcat messages matching the filter arguments to the
+// chan msgs, blocking until the context is stopped.
+func (b *binding) logcat(ctx context.Context, msgs chan<- android.LogcatMessage, filter ...string) error {
 	reader, stdout := io.Pipe()
 	buf := bufio.NewReader(reader)
 	err := make(chan error, 1)
@@ -123,7 +136,8 @@ func (b *binding) Logcat(ctx context.Context, msgs chan<- android.LogcatMessage)
 		}
 	})
 
-	if err := b.Command("logcat", "-v", "long", "-T", "0", "GAPID:V", "*:W").Capture(stdout, nil).Run(ctx); err != nil {
+	args := append([]string{"logcat", "-v", "long", "-T", "0"}, filter...)
+	if err := b.Command(args[0], args[1:]...).Capture(stdout, nil).Run(ctx); err != nil {
 		stdout.Close()
 		return err
 	}
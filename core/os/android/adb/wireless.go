@@ -0,0 +1,180 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/shell"
+)
+
+// The mDNS service types advertised by devices with wireless debugging
+// enabled. Android 11+ devices advertise a pairing service while the pairing
+// dialog is shown, and a connect service once paired.
+const (
+	MDNSPairingService = "_adb-tls-pairing._tcp"
+	MDNSConnectService = "_adb-tls-connect._tcp"
+	MDNSLegacyService  = "_adb._tcp"
+)
+
+const (
+	// bandwidthTestSize is the size of the file pushed to measure the
+	// bandwidth of a wireless connection.
+	bandwidthTestSize = 4 * 1024 * 1024
+	// minWirelessBandwidth is the bandwidth, in bytes per second, below which
+	// counter-heavy profiling traces take too long to transfer.
+	minWirelessBandwidth = 2 * 1024 * 1024
+)
+
+// MDNSService is a device advertising itself for wireless debugging.
+type MDNSService struct {
+	// Name is the service instance name, e.g. adb-<serial>-<id>.
+	Name string
+	// Type is one of the MDNS*Service types.
+	Type string
+	// Address is the host:port of the service.
+	Address string
+}
+
+// DiscoverWireless returns the devices advertising wireless debugging on the
+// local network.
+func DiscoverWireless(ctx context.Context) ([]MDNSService, error) {
+	exe, err := adb()
+	if err != nil {
+		return nil, log.Err(ctx, err, "")
+	}
+	stdout, err := shell.Command(exe.System(), "mdns", "services").Call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseMDNSServices(stdout), nil
+}
+
+func parseMDNSServices(out string) []MDNSService {
+	services := []MDNSService{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[1], "_adb") {
+			continue // For example, "List of discovered mdns services"
+		}
+		services = append(services, MDNSService{
+			Name:    fields[0],
+			Type:    strings.TrimSuffix(fields[1], "."),
+			Address: fields[2],
+		})
+	}
+	return services
+}
+
+// Pair pairs with the device at the address, as shown in the device's
+// wireless debugging pairing dialog, using the pairing code of the dialog.
+func Pair(ctx context.Context, address, code string) error {
+	exe, err := adb()
+	if err != nil {
+		return log.Err(ctx, err, "")
+	}
+	stdout, err := shell.Command(exe.System(), "pair", address, code).Call(ctx)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(stdout, "Successfully paired") {
+		return fmt.Errorf("Failed to pair with %v: %v", address, strings.TrimSpace(stdout))
+	}
+	return nil
+}
+
+// Connect connects to the device at the address over TCP. The device is
+// picked up by the next device scan.
+func Connect(ctx context.Context, address string) error {
+	exe, err := adb()
+	if err != nil {
+		return log.Err(ctx, err, "")
+	}
+	stdout, err := shell.Command(exe.System(), "connect", address).Call(ctx)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(stdout, "connected to") {
+		return fmt.Errorf("Failed to connect to %v: %v", address, strings.TrimSpace(stdout))
+	}
+	return nil
+}
+
+// Disconnect disconnects from the device at the address connected to by
+// Connect.
+func Disconnect(ctx context.Context, address string) error {
+	exe, err := adb()
+	if err != nil {
+		return log.Err(ctx, err, "")
+	}
+	_, err = shell.Command(exe.System(), "disconnect", address).Call(ctx)
+	return err
+}
+
+// IsWireless returns whether the device with the given serial is connected
+// over TCP rather than USB.
+func IsWireless(serial string) bool {
+	return strings.Contains(serial, ":") || strings.Contains(serial, MDNSConnectService)
+}
+
+// MeasureBandwidth returns the bandwidth of the connection to the device, in
+// bytes per second, by pushing a file to the device.
+func MeasureBandwidth(ctx context.Context, d Device) (float64, error) {
+	f, err := ioutil.TempFile("", "agi-bandwidth")
+	if err != nil {
+		return 0, log.Err(ctx, err, "Failed to create the bandwidth test file")
+	}
+	defer os.Remove(f.Name())
+	// Random data, such that the transfer can't be compressed.
+	data := make([]byte, bandwidthTestSize)
+	rand.Read(data)
+	_, err = f.Write(data)
+	f.Close()
+	if err != nil {
+		return 0, log.Err(ctx, err, "Failed to write the bandwidth test file")
+	}
+
+	remote := "/data/local/tmp/agi-bandwidth"
+	start := time.Now()
+	if err := d.Push(ctx, f.Name(), remote); err != nil {
+		return 0, log.Err(ctx, err, "Failed to push the bandwidth test file")
+	}
+	elapsed := time.Since(start)
+	d.RemoveFile(ctx, remote)
+	return float64(bandwidthTestSize) / elapsed.Seconds(), nil
+}
+
+// checkWirelessBandwidth warns if the bandwidth of the connection to the
+// wireless device is too low for profiling.
+func checkWirelessBandwidth(ctx context.Context, d Device) {
+	bandwidth, err := MeasureBandwidth(ctx, d)
+	if err != nil {
+		log.W(ctx, "Could not measure the bandwidth to %v: %v", d.Instance().Serial, err)
+		return
+	}
+	if bandwidth < minWirelessBandwidth {
+		log.W(ctx, "The wireless connection to %v is slow (%.1f MB/s), transferring counter-heavy profiling traces will take long. Consider using a USB connection.",
+			d.Instance().Serial, bandwidth/(1024*1024))
+	} else {
+		log.I(ctx, "Wireless connection to %v: %.1f MB/s", d.Instance().Serial, bandwidth/(1024*1024))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adb_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+)
+
+func TestDiscoverWireless(t_ *testing.T) {
+	ctx := log.Testing(t_)
+	services, err := adb.DiscoverWireless(ctx)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "services").ThatSlice(services).Equals([]adb.MDNSService{
+		{Name: "adb-1234-AbCdEf", Type: adb.MDNSPairingService, Address: "192.168.1.10:37001"},
+		{Name: "adb-1234-AbCdEf", Type: adb.MDNSConnectService, Address: "192.168.1.10:41235"},
+	})
+}
+
+func TestPairAndConnect(t_ *testing.T) {
+	ctx := log.Testing(t_)
+	assert.For(ctx, "pair").ThatError(adb.Pair(ctx, "192.168.1.10:37001", "123456")).Succeeded()
+	assert.For(ctx, "wrong code").ThatError(adb.Pair(ctx, "192.168.1.10:37001", "000000")).Failed()
+	assert.For(ctx, "connect").ThatError(adb.Connect(ctx, "192.168.1.10:41235")).Succeeded()
+}
+
+func TestIsWireless(t_ *testing.T) {
+	ctx := log.Testing(t_)
+	assert.For(ctx, "usb").That(adb.IsWireless("production_device")).Equals(false)
+	assert.For(ctx, "tcp").That(adb.IsWireless("192.168.1.10:41235")).Equals(true)
+	assert.For(ctx, "mdns").That(adb.IsWireless("adb-1234-AbCdEf._adb-tls-connect._tcp")).Equals(true)
+}
@@ -71,6 +71,10 @@ type Device interface {
 	// Logcat writes all logcat messages reported by the device to the chan msgs,
 	// blocking until the context is stopped.
 	Logcat(ctx context.Context, msgs chan<- LogcatMessage) error
+	// ProcessLogcat writes the logcat messages of all priorities logged by the
+	// process with the given pid to the chan msgs, blocking until the context
+	// is stopped.
+	ProcessLogcat(ctx context.Context, pid int, msgs chan<- LogcatMessage) error
 	// NativeBridgeABI returns the native ABI for the given emulated ABI for the
 	// device by consulting the ro.dalvik.vm.isa.<emulated_isa>=<native_isa>
 	// system properties. If there is no native ABI for the given ABI, then abi
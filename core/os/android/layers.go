@@ -16,12 +16,25 @@ package android
 
 import (
 	"context"
+	"sort"
 	"strings"
 
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/log"
 )
 
+// Layer is a Vulkan layer loaded by the application in addition to the
+// layers of AGI.
+type Layer struct {
+	// Name is the name of the layer, e.g. VK_LAYER_KHRONOS_validation.
+	Name string
+	// Package is the package providing the layer, or empty if the layer is
+	// provided by the application or AGI.
+	Package string
+	// Settings are the values of the layer's options, keyed by option name.
+	Settings map[string]string
+}
+
 // SupportsVulkanLayersViaSystemSettings returns whether the given device supports
 // loading Vulkan layers via the system settings.
 func SupportsVulkanLayersViaSystemSettings(d Device) bool {
@@ -63,3 +76,39 @@ func SetupLayers(ctx context.Context, d Device, appPkg string, layerPkgs []strin
 
 	return cleanup, nil
 }
+
+// LayerSettingProperty returns the system property the layer reads the option
+// from, following the convention of the Khronos layers. For example, the
+// "enables" option of VK_LAYER_KHRONOS_validation is read from the
+// debug.vulkan.khronos_validation.enables property.
+func LayerSettingProperty(layer, option string) string {
+	return "debug.vulkan." + strings.ToLower(strings.TrimPrefix(layer, "VK_LAYER_")) + "." + option
+}
+
+// SetupLayerSettings sets the options of the layers as system properties and
+// returns a cleanup to restore the previous values of the properties.
+func SetupLayerSettings(ctx context.Context, d Device, layers []Layer) (app.Cleanup, error) {
+	var cleanup app.Cleanup
+	for _, l := range layers {
+		options := make([]string, 0, len(l.Settings))
+		for option := range l.Settings {
+			options = append(options, option)
+		}
+		sort.Strings(options)
+		for _, option := range options {
+			prop := LayerSettingProperty(l.Name, option)
+			old, err := d.SystemProperty(ctx, prop)
+			if err != nil {
+				return cleanup.Invoke(ctx), err
+			}
+			cleanup = cleanup.Then(func(ctx context.Context) {
+				log.D(ctx, "Restoring property %v", prop)
+				d.SetSystemProperty(ctx, prop, old)
+			})
+			if err := d.SetSystemProperty(ctx, prop, l.Settings[option]); err != nil {
+				return cleanup.Invoke(ctx), err
+			}
+		}
+	}
+	return cleanup, nil
+}
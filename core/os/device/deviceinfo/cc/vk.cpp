@@ -110,6 +110,9 @@ bool vkLayersAndExtensions(
   return true;
 }
 
+// The version of Vulkan 1.1, encoded as by VK_MAKE_VERSION.
+const uint32_t kVulkan11 = (1 << 22) | (1 << 12);
+
 bool vkPhysicalDevices(
     device::VulkanDriver* driver, size_t vk_inst_handle,
     std::function<void*(size_t, const char*)> get_inst_proc_addr,
@@ -145,7 +148,17 @@ bool vkPhysicalDevices(
   MUST_RESOLVE(PFNVKGETPHYSICALDEVICEQUEUEFAMILYPROPERTIES,
                vkGetPhysicalDeviceQueueFamilyProperties);
   MUST_RESOLVE(PFNVKCREATEDEVICE, vkCreateDevice);
+  MUST_RESOLVE(PFNVKENUMERATEDEVICEEXTENSIONPROPERTIES,
+               vkEnumerateDeviceExtensionProperties);
 #undef MUST_RESOLVE
+  // Only available on Vulkan 1.1 implementations, so optional.
+  PFNVKGETPHYSICALDEVICEFEATURES2 vkGetPhysicalDeviceFeatures2 =
+      reinterpret_cast<PFNVKGETPHYSICALDEVICEFEATURES2>(
+          get_inst_proc_addr == nullptr
+              ? core::GetVulkanInstanceProcAddress(
+                    vk_inst_handle, "vkGetPhysicalDeviceFeatures2")
+              : get_inst_proc_addr(vk_inst_handle,
+                                   "vkGetPhysicalDeviceFeatures2"));
 
   uint32_t phy_dev_count = 0;
   MUST_SUCCESS(
@@ -165,6 +178,40 @@ bool vkPhysicalDevices(
     driver->mutable_physical_devices(i)->set_device_id(prop.deviceID);
     driver->mutable_physical_devices(i)->set_device_name(
         std::string(prop.deviceName));
+
+    uint32_t ext_count = 0;
+    MUST_SUCCESS(vkEnumerateDeviceExtensionProperties(phy_dev, nullptr,
+                                                      &ext_count, nullptr));
+    std::vector<VkExtensionProperties> ext_props(ext_count,
+                                                 VkExtensionProperties{});
+    MUST_SUCCESS(vkEnumerateDeviceExtensionProperties(
+        phy_dev, nullptr, &ext_count, ext_props.data()));
+    bool has_shading_rate = false;
+    for (size_t j = 0; j < ext_props.size(); j++) {
+      driver->mutable_physical_devices(i)->add_extensions(
+          ext_props[j].extensionName);
+      has_shading_rate |= !strcmp(ext_props[j].extensionName,
+                                  "VK_KHR_fragment_shading_rate");
+    }
+    if (has_shading_rate && vkGetPhysicalDeviceFeatures2 != nullptr &&
+        prop.apiVersion >= kVulkan11) {
+      VkPhysicalDeviceFragmentShadingRateFeaturesKHR shading_rate{
+          VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FRAGMENT_SHADING_RATE_FEATURES_KHR,
+          nullptr,  // pNext
+          0,        // pipelineFragmentShadingRate
+          0,        // primitiveFragmentShadingRate
+          0,        // attachmentFragmentShadingRate
+      };
+      VkPhysicalDeviceFeatures2 features{
+          VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FEATURES_2,
+          &shading_rate,  // pNext
+          VkPhysicalDeviceFeatures{},
+      };
+      vkGetPhysicalDeviceFeatures2(phy_dev, &features);
+      driver->mutable_physical_devices(i)->set_pipeline_fragment_shading_rate(
+          shading_rate.pipelineFragmentShadingRate != 0);
+    }
+
     if (!create_device) {
       continue;
     }
@@ -26,6 +26,9 @@ typedef enum VkStructureType {
   VK_STRUCTURE_TYPE_INSTANCE_CREATE_INFO = 1,
   VK_STRUCTURE_TYPE_DEVICE_QUEUE_CREATE_INFO = 2,
   VK_STRUCTURE_TYPE_DEVICE_CREATE_INFO = 3,
+  VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FEATURES_2 = 1000059000,
+  VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FRAGMENT_SHADING_RATE_FEATURES_KHR =
+      1000226003,
 } VkStructureType;
 
 typedef enum VkResult {
@@ -164,6 +167,20 @@ typedef struct {
   VkBool32 inheritedQueries;
 } VkPhysicalDeviceFeatures;
 
+typedef struct {
+  VkStructureType sType;
+  void* pNext;
+  VkPhysicalDeviceFeatures features;
+} VkPhysicalDeviceFeatures2;
+
+typedef struct {
+  VkStructureType sType;
+  void* pNext;
+  VkBool32 pipelineFragmentShadingRate;
+  VkBool32 primitiveFragmentShadingRate;
+  VkBool32 attachmentFragmentShadingRate;
+} VkPhysicalDeviceFragmentShadingRateFeaturesKHR;
+
 typedef struct {
   VkStructureType sType;
   void* pNext;
@@ -376,6 +393,11 @@ typedef VkResult(VULKAN_API_PTR* PFNVKENUMERATEPHYSICALDEVICES)(
     VkPhysicalDevice* pPhysicalDevices);
 typedef void(VULKAN_API_PTR* PFNVKGETPHYSICALDEVICEPROPERTIES)(
     VkPhysicalDevice physicalDevice, VkPhysicalDeviceProperties* pProperties);
+typedef void(VULKAN_API_PTR* PFNVKGETPHYSICALDEVICEFEATURES2)(
+    VkPhysicalDevice physicalDevice, VkPhysicalDeviceFeatures2* pFeatures);
+typedef VkResult(VULKAN_API_PTR* PFNVKENUMERATEDEVICEEXTENSIONPROPERTIES)(
+    VkPhysicalDevice physicalDevice, const char* pLayerName,
+    uint32_t* pPropertyCount, VkExtensionProperties* pProperties);
 
 typedef void(VULKAN_API_PTR* PFNVKGETPHYSICALDEVICEQUEUEFAMILYPROPERTIES)(
     VkPhysicalDevice physicalDevice, uint32_t* pQueueFamilyPropertyCount,
@@ -0,0 +1,79 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package farm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/google/gapid/core/os/shell"
+)
+
+// execProvider leases the devices by running an adapter executable:
+//
+//	<command> acquire [key=value...]
+//
+// prints the lease as JSON, e.g. {"id": "42", "address": "10.0.0.5:5555"},
+// on its standard output, and
+//
+//	<command> release <lease id>
+//
+// releases it. Both exit with a non-zero status on failure.
+type execProvider struct {
+	command string
+}
+
+func (p *execProvider) Acquire(ctx context.Context, req *AcquireRequest) (*Lease, error) {
+	args := []string{"acquire"}
+	for _, key := range sortedKeys(req.GetConstraints()) {
+		args = append(args, key+"="+req.Constraints[key])
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := shell.Command(p.command, args...).Capture(stdout, stderr).Run(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to acquire a device: %v: %v", err, stderr.String())
+	}
+	return parseLease(stdout.Bytes())
+}
+
+func (p *execProvider) Release(ctx context.Context, lease *Lease) error {
+	if out, err := shell.Command(p.command, "release", lease.Id).Call(ctx); err != nil {
+		return fmt.Errorf("Failed to release the device of lease %v: %v: %v", lease.Id, err, out)
+	}
+	return nil
+}
+
+// parseLease parses the JSON lease printed by an adapter executable.
+func parseLease(out []byte) (*Lease, error) {
+	lease := &Lease{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(out), lease); err != nil {
+		return nil, fmt.Errorf("Invalid lease %q: %v", out, err)
+	}
+	if lease.Id == "" || lease.Address == "" {
+		return nil, fmt.Errorf("Invalid lease %q: missing id or address", out)
+	}
+	return lease, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package farm provides access to the devices of device labs and farms, such
+// that captures can be profiled on remote devices rather than only on the
+// locally connected ones.
+//
+// The devices are leased through a Provider, and are reachable over adb at
+// the address of the lease. Farms are integrated either by an executable
+// adapter, or by a gRPC server implementing the DeviceFarm service.
+package farm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Provider leases the devices of a device farm.
+type Provider interface {
+	// Acquire leases a device matching the constraints of the request,
+	// waiting until one is available or the context is cancelled.
+	Acquire(ctx context.Context, req *AcquireRequest) (*Lease, error)
+	// Release returns the leased device to the farm.
+	Release(ctx context.Context, lease *Lease) error
+}
+
+// New returns the provider described by the spec, either "exec:<command>"
+// for an executable adapter, or "grpc:<host:port>" for a DeviceFarm server.
+func New(ctx context.Context, spec string) (Provider, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	if arg == "" {
+		return nil, fmt.Errorf("Invalid device farm %q, expected exec:<command> or grpc:<host:port>", spec)
+	}
+	switch kind {
+	case "exec":
+		return &execProvider{command: arg}, nil
+	case "grpc":
+		return newGRPCProvider(ctx, arg)
+	default:
+		return nil, fmt.Errorf("Unknown device farm kind %q, expected exec or grpc", kind)
+	}
+}
+
+// ParseConstraints parses the "key=value" constraints of an AcquireRequest.
+func ParseConstraints(constraints []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, c := range constraints {
+		i := strings.Index(c, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid device constraint %q, expected key=value", c)
+		}
+		res[c[:i]] = c[i+1:]
+	}
+	return res, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package farm
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestNew(t *testing.T) {
+	ctx := log.Testing(t)
+	p, err := New(ctx, "exec:/opt/lab/lease")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "provider").That(p).DeepEquals(&execProvider{command: "/opt/lab/lease"})
+
+	for _, spec := range []string{"", "exec", "exec:", "adb:10.0.0.5:5555"} {
+		_, err := New(ctx, spec)
+		assert.For(ctx, "New(%q)", spec).ThatError(err).Failed()
+	}
+}
+
+func TestParseConstraints(t *testing.T) {
+	ctx := log.Testing(t)
+	got, err := ParseConstraints([]string{"gpu=Adreno 640", "sdk=30", "tag="})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "constraints").ThatMap(got).DeepEquals(map[string]string{
+		"gpu": "Adreno 640",
+		"sdk": "30",
+		"tag": "",
+	})
+
+	_, err = ParseConstraints([]string{"=30"})
+	assert.For(ctx, "missing key").ThatError(err).Failed()
+	_, err = ParseConstraints([]string{"sdk"})
+	assert.For(ctx, "missing value").ThatError(err).Failed()
+}
+
+func TestParseLease(t *testing.T) {
+	ctx := log.Testing(t)
+	lease, err := parseLease([]byte(`{"id": "42", "address": "10.0.0.5:5555", "expires": "1634300000"}`))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "id").That(lease.Id).Equals("42")
+	assert.For(ctx, "address").That(lease.Address).Equals("10.0.0.5:5555")
+	assert.For(ctx, "expires").That(lease.Expires).Equals(int64(1634300000))
+
+	for _, out := range []string{``, `{"id": "42"}`, `{"address": "10.0.0.5:5555"}`, `not json`} {
+		_, err := parseLease([]byte(out))
+		assert.For(ctx, "parseLease(%q)", out).ThatError(err).Failed()
+	}
+}
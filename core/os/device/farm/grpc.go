@@ -0,0 +1,45 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package farm
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/net/grpcutil"
+	"google.golang.org/grpc"
+)
+
+// grpcProvider leases the devices from a server implementing the DeviceFarm
+// service.
+type grpcProvider struct {
+	client DeviceFarmClient
+}
+
+func newGRPCProvider(ctx context.Context, target string) (Provider, error) {
+	conn, err := grpcutil.Dial(ctx, target, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &grpcProvider{NewDeviceFarmClient(conn)}, nil
+}
+
+func (p *grpcProvider) Acquire(ctx context.Context, req *AcquireRequest) (*Lease, error) {
+	return p.client.Acquire(ctx, req)
+}
+
+func (p *grpcProvider) Release(ctx context.Context, lease *Lease) error {
+	_, err := p.client.Release(ctx, &ReleaseRequest{Id: lease.Id})
+	return err
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"math"
+	"strings"
+)
+
+// The hardware blocks counters are grouped into, if the producer does not
+// group them itself.
+const (
+	ShaderCoreBlock   = "Shader Core"
+	TilerBlock        = "Tiler"
+	L2CacheBlock      = "L2 Cache"
+	MemorySystemBlock = "Memory System"
+	GPUBlock          = "GPU"
+)
+
+// counterBlockKeywords maps keywords in the counter names, as used by the
+// vendors, to the hardware block the counter belongs to. The first match
+// wins, so more specific keywords come first.
+var counterBlockKeywords = []struct {
+	keyword string
+	block   string
+}{
+	{"l2", L2CacheBlock},
+	{"tiler", TilerBlock},
+	{"tiling", TilerBlock},
+	{"binning", TilerBlock},
+	{"primitive", TilerBlock},
+	{"triangle", TilerBlock},
+	{"vertex", TilerBlock},
+	{"vertices", TilerBlock},
+	{"bus", MemorySystemBlock},
+	{"bandwidth", MemorySystemBlock},
+	{"external memory", MemorySystemBlock},
+	{"dram", MemorySystemBlock},
+	{"shader", ShaderCoreBlock},
+	{"alu", ShaderCoreBlock},
+	{"texture", ShaderCoreBlock},
+	{"varying", ShaderCoreBlock},
+	{"fragment", ShaderCoreBlock},
+	{"warp", ShaderCoreBlock},
+	{"instruction", ShaderCoreBlock},
+}
+
+// counterGroupBlocks maps the logical counter groups to the hardware block
+// used for counters whose names don't match any keyword.
+var counterGroupBlocks = map[GpuCounterDescriptor_GpuCounterGroup]string{
+	GpuCounterDescriptor_FRAGMENTS:  ShaderCoreBlock,
+	GpuCounterDescriptor_COMPUTE:    ShaderCoreBlock,
+	GpuCounterDescriptor_VERTICES:   TilerBlock,
+	GpuCounterDescriptor_PRIMITIVES: TilerBlock,
+	GpuCounterDescriptor_MEMORY:     MemorySystemBlock,
+}
+
+// counterBlockOrder is the order in which the inferred blocks are added.
+var counterBlockOrder = []string{
+	ShaderCoreBlock, TilerBlock, L2CacheBlock, MemorySystemBlock, GPUBlock,
+}
+
+// blockSamplingOverheads are the estimated sampling overheads of a single
+// counter of the inferred blocks. Counters outside the memory system are
+// read from registers local to the GPU and are cheaper to sample.
+var blockSamplingOverheads = map[string]float64{
+	ShaderCoreBlock:   0.005,
+	TilerBlock:        0.003,
+	L2CacheBlock:      0.004,
+	MemorySystemBlock: 0.008,
+	GPUBlock:          0.001,
+}
+
+const (
+	// defaultSamplingOverhead is the estimated sampling overhead of a counter
+	// of a block grouped by the producer.
+	defaultSamplingOverhead = 0.004
+	// MaxRecommendedSamplingOverhead is the combined sampling overhead above
+	// which the selected counters are likely to perturb the results.
+	MaxRecommendedSamplingOverhead = 0.05
+)
+
+// CounterBlockOf returns the hardware block the counter described by spec
+// most likely belongs to, based on its name and groups.
+func CounterBlockOf(spec *GpuCounterDescriptor_GpuCounterSpec) string {
+	name := strings.ToLower(spec.GetName())
+	for _, k := range counterBlockKeywords {
+		if strings.Contains(name, k.keyword) {
+			return k.block
+		}
+	}
+	for _, group := range spec.GetGroups() {
+		if block, ok := counterGroupBlocks[group]; ok {
+			return block
+		}
+	}
+	return GPUBlock
+}
+
+// GroupBlocks adds the counters of the descriptor that are not part of any
+// block, to blocks inferred from the counter names and groups. Producers may
+// not group the counters at all, in which case all the counters are grouped.
+func (d *GpuCounterDescriptor) GroupBlocks() {
+	grouped := map[uint32]bool{}
+	nextID := uint32(0)
+	for _, block := range d.Blocks {
+		for _, id := range block.CounterIds {
+			grouped[id] = true
+		}
+		if block.BlockId >= nextID {
+			nextID = block.BlockId + 1
+		}
+	}
+
+	inferred := map[string]*GpuCounterDescriptor_GpuCounterBlock{}
+	for _, spec := range d.Specs {
+		if grouped[spec.CounterId] {
+			continue
+		}
+		grouped[spec.CounterId] = true
+		name := CounterBlockOf(spec)
+		block, ok := inferred[name]
+		if !ok {
+			block = &GpuCounterDescriptor_GpuCounterBlock{Name: name}
+			inferred[name] = block
+		}
+		block.CounterIds = append(block.CounterIds, spec.CounterId)
+	}
+
+	for _, name := range counterBlockOrder {
+		if block, ok := inferred[name]; ok {
+			block.BlockId = nextID
+			nextID++
+			d.Blocks = append(d.Blocks, block)
+		}
+	}
+}
+
+// EstimateSamplingCosts sets the sampling cost of the counters that don't
+// have one, from the blocks the counters belong to. The blocks should have
+// been grouped with GroupBlocks first.
+func (d *GpuCounterDescriptor) EstimateSamplingCosts() {
+	blocks := map[uint32]string{}
+	for _, block := range d.Blocks {
+		for _, id := range block.CounterIds {
+			blocks[id] = block.Name
+		}
+	}
+	for _, spec := range d.Specs {
+		if spec.SamplingCost != nil {
+			continue
+		}
+		overhead, ok := blockSamplingOverheads[blocks[spec.CounterId]]
+		if !ok {
+			overhead = defaultSamplingOverhead
+		}
+		spec.SamplingCost = &GpuCounterDescriptor_SamplingCost{
+			Overhead: overhead,
+			Source:   GpuCounterDescriptor_SamplingCost_ESTIMATED,
+		}
+	}
+}
+
+// SamplingOverhead returns the estimated combined overhead of sampling the
+// counters with the given IDs. Selecting more counters of a block than the
+// block's capacity requires multiplexing the block's counters over several
+// passes, which multiplies their cost.
+func (d *GpuCounterDescriptor) SamplingOverhead(ids []uint32) float64 {
+	selected := map[uint32]bool{}
+	for _, id := range ids {
+		selected[id] = true
+	}
+	passes := map[uint32]float64{}
+	for _, block := range d.Blocks {
+		if block.BlockCapacity == 0 {
+			continue
+		}
+		count := 0
+		for _, id := range block.CounterIds {
+			if selected[id] {
+				count++
+			}
+		}
+		p := math.Ceil(float64(count) / float64(block.BlockCapacity))
+		for _, id := range block.CounterIds {
+			passes[id] = p
+		}
+	}
+
+	res := 0.0
+	for _, spec := range d.Specs {
+		if !selected[spec.CounterId] {
+			continue
+		}
+		cost := spec.GetSamplingCost().GetOverhead()
+		if p := passes[spec.CounterId]; p > 1 {
+			cost *= p
+		}
+		res += cost
+	}
+	return res
+}
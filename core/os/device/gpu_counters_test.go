@@ -0,0 +1,95 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+)
+
+func TestGroupBlocks(t *testing.T) {
+	ctx := log.Testing(t)
+	desc := &device.GpuCounterDescriptor{
+		Specs: []*device.GpuCounterDescriptor_GpuCounterSpec{
+			{CounterId: 1, Name: "GPU % Utilization"},
+			{CounterId: 2, Name: "Fragment ALU Utilization"},
+			{CounterId: 3, Name: "L2 Cache Read Hits"},
+			{CounterId: 4, Name: "Tiler Primitives"},
+			{CounterId: 5, Name: "External Memory Read Bytes"},
+			{CounterId: 6, Name: "Clipped", Groups: []device.GpuCounterDescriptor_GpuCounterGroup{device.GpuCounterDescriptor_PRIMITIVES}},
+			{CounterId: 7, Name: "Producer grouped"},
+		},
+		Blocks: []*device.GpuCounterDescriptor_GpuCounterBlock{
+			{BlockId: 3, Name: "Job Manager", CounterIds: []uint32{7}},
+		},
+	}
+	desc.GroupBlocks()
+
+	expected := []struct {
+		id       uint32
+		name     string
+		counters []uint32
+	}{
+		{3, "Job Manager", []uint32{7}},
+		{4, device.ShaderCoreBlock, []uint32{2}},
+		{5, device.TilerBlock, []uint32{4, 6}},
+		{6, device.L2CacheBlock, []uint32{3}},
+		{7, device.MemorySystemBlock, []uint32{5}},
+		{8, device.GPUBlock, []uint32{1}},
+	}
+	assert.For(ctx, "Blocks").That(len(desc.Blocks)).Equals(len(expected))
+	for i, e := range expected {
+		ctx := log.Enter(ctx, e.name)
+		block := desc.Blocks[i]
+		assert.For(ctx, "BlockId").That(block.BlockId).Equals(e.id)
+		assert.For(ctx, "Name").That(block.Name).Equals(e.name)
+		assert.For(ctx, "CounterIds").ThatSlice(block.CounterIds).Equals(e.counters)
+	}
+}
+
+func TestSamplingOverhead(t *testing.T) {
+	ctx := log.Testing(t)
+	desc := &device.GpuCounterDescriptor{
+		Specs: []*device.GpuCounterDescriptor_GpuCounterSpec{
+			{CounterId: 1, Name: "GPU % Utilization"},
+			{CounterId: 2, Name: "Fragment ALU Utilization"},
+			{CounterId: 3, Name: "Fragment Texture Utilization"},
+			{CounterId: 4, Name: "Fragment Varying Utilization"},
+			{CounterId: 5, Name: "Calibrated", SamplingCost: &device.GpuCounterDescriptor_SamplingCost{
+				Overhead: 0.1,
+				Source:   device.GpuCounterDescriptor_SamplingCost_CALIBRATED,
+			}},
+		},
+		Blocks: []*device.GpuCounterDescriptor_GpuCounterBlock{
+			{BlockId: 1, Name: "Fragments", BlockCapacity: 2, CounterIds: []uint32{2, 3, 4}},
+		},
+	}
+	desc.GroupBlocks()
+	desc.EstimateSamplingCosts()
+
+	assert.For(ctx, "inferred").That(desc.Specs[0].SamplingCost.Overhead).Equals(0.001)
+	assert.For(ctx, "producer").That(desc.Specs[1].SamplingCost.Overhead).Equals(0.004)
+	assert.For(ctx, "source").That(desc.Specs[1].SamplingCost.Source).Equals(device.GpuCounterDescriptor_SamplingCost_ESTIMATED)
+	assert.For(ctx, "calibrated").That(desc.Specs[4].SamplingCost.Overhead).Equals(0.1)
+
+	assert.For(ctx, "single").ThatFloat(desc.SamplingOverhead([]uint32{2})).Equals(0.004, 1e-9)
+	assert.For(ctx, "within capacity").ThatFloat(desc.SamplingOverhead([]uint32{1, 2, 3})).Equals(0.009, 1e-9)
+	// Three counters in a block of capacity two need two passes.
+	assert.For(ctx, "multiplexed").ThatFloat(desc.SamplingOverhead([]uint32{2, 3, 4})).Equals(0.024, 1e-9)
+	assert.For(ctx, "recommended").ThatFloat(desc.SamplingOverhead([]uint32{1, 2, 3, 4, 5})).IsAtLeast(device.MaxRecommendedSamplingOverhead)
+}
@@ -346,6 +346,10 @@ public class Client {
         Service.ErrUnsupportedVersion e = err.getErrUnsupportedVersion();
         throw new UnsupportedVersionException(e.getReason()/*, e.getSuggestUpdate()*/, stack);
       }
+      case ERR_PROFILING: {
+        Service.ErrProfiling e = err.getErrProfiling();
+        throw new ProfilingException(e, stack);
+      }
       default:
         throw new RuntimeException("Unknown error: " + err.getErrCase(), stack);
     }
@@ -395,6 +399,23 @@ public class Client {
     }
   }
 
+  public static class ProfilingException extends RpcException {
+    public final Service.ProfilingErrorCode code;
+    public final String remediation;
+
+    public ProfilingException(Service.ErrProfiling err, Stack stack) {
+      super(err.getCause().isEmpty() ? err.getMessage() : err.getMessage() + ": " + err.getCause(),
+          stack);
+      this.code = err.getCode();
+      this.remediation = err.getRemediation();
+    }
+
+    @Override
+    public String toString() {
+      return remediation.isEmpty() ? super.toString() : super.toString() + " Hint: " + remediation;
+    }
+  }
+
   public static class Stack extends Exception {
     private final Supplier<String> requestString;
 
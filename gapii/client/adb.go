@@ -148,12 +148,26 @@ func Start(ctx context.Context, p *android.InstalledPackage, a *android.Activity
 		log.I(ctx, "Also loading Vulkan validation layer")
 		layerNames = append(layerNames, loader.VulkanValidationLayer)
 	}
-	cu, err := android.SetupLayers(ctx, d, p.Name, []string{gapidapk.PackageName(abi)}, layerNames)
+	layerPackages := []string{gapidapk.PackageName(abi)}
+	for _, l := range o.Layers {
+		log.I(ctx, "Also loading Vulkan layer %v", l.Name)
+		layerNames = append(layerNames, l.Name)
+		if l.Package != "" {
+			layerPackages = append(layerPackages, l.Package)
+		}
+	}
+	cu, err := android.SetupLayers(ctx, d, p.Name, layerPackages, layerNames)
 	if err != nil {
 		return nil, cleanup.Invoke(ctx), log.Err(ctx, err, "Failed when setting up layers")
 	}
 	cleanup = cleanup.Then(cu)
 
+	cu, err = android.SetupLayerSettings(ctx, d, o.Layers)
+	if err != nil {
+		return nil, cleanup.Invoke(ctx), log.Err(ctx, err, "Failed when setting up the layer settings")
+	}
+	cleanup = cleanup.Then(cu)
+
 	var additionalArgs []android.ActionExtra
 	if o.AdditionalFlags != "" {
 		additionalArgs = append(additionalArgs, android.CustomExtras(text.Quote(text.SplitArgs(o.AdditionalFlags))))
@@ -27,6 +27,7 @@ import (
 	"github.com/google/gapid/core/app/status"
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android"
 	"github.com/pkg/errors"
 )
 
@@ -82,6 +83,8 @@ type Options struct {
 	ProcessName string
 	// Whether to load the Vulkan validation layer under our Spy layer
 	LoadValidationLayer bool
+	// Additional Vulkan layers to load under our Spy layer
+	Layers []android.Layer
 }
 
 const sizeGap = 1024 * 1024 * 5
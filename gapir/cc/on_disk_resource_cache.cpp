@@ -61,7 +61,7 @@ int mkdirAll(const std::string& path) {
 }  // anonymous namespace
 
 std::unique_ptr<ResourceCache> OnDiskResourceCache::create(
-    const std::string& path, bool cleanUp) {
+    const std::string& path, bool cleanUp, size_t maxSize) {
   if (0 != mkdirAll(path)) {
     GAPID_WARNING(
         "Couldn't access/create cache directory; disabling disk cache.");
@@ -73,16 +73,32 @@ std::unique_ptr<ResourceCache> OnDiskResourceCache::create(
     }
 
     return std::unique_ptr<ResourceCache>(
-        new OnDiskResourceCache(std::move(diskPath), cleanUp));
+        new OnDiskResourceCache(std::move(diskPath), cleanUp, maxSize));
   }
 }
 
-OnDiskResourceCache::OnDiskResourceCache(const std::string& path, bool cleanUp)
+OnDiskResourceCache::OnDiskResourceCache(const std::string& path, bool cleanUp,
+                                         size_t maxSize)
     : ResourceCache(ResourceCache::PrefetchMode::IMMEDIATE_PREFETCH),
       mArchive(path + "resources"),
-      mCleanUp(cleanUp) {}
+      mCleanUp(cleanUp),
+      mMaxSize(maxSize) {
+  if (mCleanUp) {
+    // The cache is deleted when destroyed, so an existing cache was left by a
+    // process that didn't exit cleanly.
+    mArchive.clear();
+  }
+}
 
 bool OnDiskResourceCache::putCache(const Resource& resource, const void* data) {
+  if (mMaxSize != 0 && !mArchive.contains(resource.getID()) &&
+      mArchive.size() + resource.getSize() > mMaxSize) {
+    if (resource.getSize() > mMaxSize) {
+      return false;
+    }
+    GAPID_INFO("On-disk cache is full, evicting all the cached resources");
+    mArchive.clear();
+  }
   return mArchive.write(resource.getID(), data, resource.getSize());
 }
 
@@ -33,15 +33,22 @@
 
 namespace gapir {
 
-// Unlimited size cache on disk for resources
+// Cache on disk for resources, of unlimited size unless a maximum size is
+// given.
 class OnDiskResourceCache : public ResourceCache {
  public:
   // Creates new disk cache with the specified base path. If the base path is
   // not readable or it can't be created then returns the fall back provider.
+  // If cleanUp is set, the cache left at the path, e.g. by a crashed process,
+  // is cleared, and the cache is deleted when destroyed. If maxSize is not 0,
+  // all the cached resources are evicted when adding a resource would exceed
+  // maxSize bytes.
   static std::unique_ptr<ResourceCache> create(const std::string& path,
-                                               bool cleanUp);
+                                               bool cleanUp,
+                                               size_t maxSize = 0);
   virtual ~OnDiskResourceCache() {
-#if TARGET_OS == GAPID_OS_LINUX || TARGET_OS == GAPID_OS_OSX
+#if TARGET_OS == GAPID_OS_LINUX || TARGET_OS == GAPID_OS_OSX || \
+    TARGET_OS == GAPID_OS_ANDROID
     if (mCleanUp) {
       unlink(mArchive.dataFilePath().c_str());
       unlink(mArchive.indexFilePath().c_str());
@@ -54,9 +61,9 @@ class OnDiskResourceCache : public ResourceCache {
   virtual bool hasCache(const Resource& res) override;
   virtual bool loadCache(const Resource& res, void* target) override;
 
-  // Unlimited size for on-disk cache.
+  // Unlimited size for on-disk cache, unless a maximum size was given.
   virtual size_t totalCacheSize() const override {
-    return std::numeric_limits<size_t>::max();
+    return mMaxSize != 0 ? mMaxSize : std::numeric_limits<size_t>::max();
   }
   virtual size_t unusedSize() const override {
     return std::numeric_limits<size_t>::max();
@@ -65,13 +72,16 @@ class OnDiskResourceCache : public ResourceCache {
   virtual bool resize(size_t newSize) override { return true; };
 
  private:
-  OnDiskResourceCache(const std::string& path, bool cleanUp);
+  OnDiskResourceCache(const std::string& path, bool cleanUp, size_t maxSize);
 
   // Disk-backed archive holding the cached resources.
   core::Archive mArchive;
 
   // Delete archive files when this On-disk cache is out of scope.
   bool mCleanUp;
+
+  // The maximum size of the archive data, 0 if unlimited.
+  size_t mMaxSize;
 };
 
 }  // namespace gapir
@@ -121,6 +121,10 @@ std::unique_ptr<Server> Server::createAndStart(const char* uri,
   builder.SetMaxSendMessageSize(std::numeric_limits<int>::max());
   builder.SetMaxReceiveMessageSize(std::numeric_limits<int>::max());
   builder.AddListeningPort(std::string(uri), grpc::InsecureServerCredentials());
+  // Compress the responses if the client accepts compressed messages, which
+  // GAPIS only does for devices not on the host. Compressed requests are
+  // always accepted.
+  builder.SetDefaultCompressionAlgorithm(GRPC_COMPRESS_GZIP);
   builder.RegisterService(server->mServiceImpl.get());
   auto grpcServer = builder.BuildAndStart();
   if (grpcServer == nullptr) {
@@ -31,12 +31,18 @@ import (
 	"github.com/google/gapid/gapir"
 	replaysrv "github.com/google/gapid/gapir/replay_service"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
 const (
 	// LaunchArgsKey is the bind device property key used to control the command
 	// line arguments when launching GAPIR. The property must be of type []string.
 	LaunchArgsKey = "gapir-launch-args"
+	// CompressKey is the bind device property key used to control whether the
+	// replay stream to GAPIR is compressed. The property must be of type bool.
+	// If unset, the stream is compressed for all devices but the host, as the
+	// replay payloads and resources are costly to send over USB or Wi-Fi.
+	CompressKey = "gapir-compress"
 	// gRPCConnectTimeout is the time allowed to establish a gRPC connection.
 	gRPCConnectTimeout = time.Second * 30
 	// heartbeatInterval is the delay between heartbeat pings.
@@ -67,17 +73,32 @@ type ReplayerKey struct {
 // Client handles multiple GAPIR instances identified by ReplayerKey.
 type Client struct {
 	// mutex prevents data races when restarting replayers. All exported
-	// functions must acquire this mutex upon start, to guard the lookup
-	// in the replayers map which might be concurrently updated by a
+	// functions but Connect must acquire this mutex upon start, to guard the
+	// lookup in the replayers map which might be concurrently updated by a
 	// replayer reconnection.
 	mutex sync.Mutex
 	// replayers stores the informations relater to GAPIR instances.
 	replayers map[ReplayerKey]*replayer
+	// connecting holds a lock per key being connected, such that a GAPIR
+	// instance is only started once per key, without blocking the instances
+	// of other devices from starting concurrently.
+	connecting map[ReplayerKey]*connectLock
+}
+
+// connectLock is the lock of the connections to a GAPIR instance, with the
+// number of Connect calls holding or waiting for it. The lock is removed
+// from the client once there are none.
+type connectLock struct {
+	sync.Mutex
+	users int
 }
 
 // New returns a new Client with no replayers.
 func New(ctx context.Context) *Client {
-	client := &Client{replayers: map[ReplayerKey]*replayer{}}
+	client := &Client{
+		replayers:  map[ReplayerKey]*replayer{},
+		connecting: map[ReplayerKey]*connectLock{},
+	}
 	app.AddCleanup(ctx, func() {
 		client.shutdown(ctx)
 	})
@@ -96,20 +117,47 @@ func (client *Client) shutdown(ctx context.Context) {
 }
 
 // Connect starts a GAPIR instance and return its ReplayerKey.
+// The client's mutex is not held while the instance is started, which may
+// take a while on Android devices, such that the instances of different
+// devices can be started concurrently.
 func (client *Client) Connect(ctx context.Context, device bind.Device, abi *device.ABI) (*ReplayerKey, error) {
-	client.mutex.Lock()
-	defer client.mutex.Unlock()
-
 	ctx = status.Start(ctx, "Connect")
 	defer status.Finish(ctx)
 
+	key := ReplayerKey{device: device, arch: abi.GetArchitecture()}
+
+	client.mutex.Lock()
 	if client.replayers == nil {
+		client.mutex.Unlock()
 		return nil, log.Err(ctx, nil, "Client has been shutdown")
 	}
-
-	key := ReplayerKey{device: device, arch: abi.GetArchitecture()}
-
 	if _, ok := client.replayers[key]; ok {
+		client.mutex.Unlock()
+		return &key, nil
+	}
+	connecting, ok := client.connecting[key]
+	if !ok {
+		connecting = &connectLock{}
+		client.connecting[key] = connecting
+	}
+	connecting.users++
+	client.mutex.Unlock()
+
+	connecting.Lock()
+	defer func() {
+		connecting.Unlock()
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		if connecting.users--; connecting.users == 0 {
+			delete(client.connecting, key)
+		}
+	}()
+
+	// Another call may have connected while waiting for the lock.
+	client.mutex.Lock()
+	_, connected := client.replayers[key]
+	client.mutex.Unlock()
+	if connected {
 		return &key, nil
 	}
 
@@ -122,11 +170,20 @@ func (client *Client) Connect(ctx context.Context, device bind.Device, abi *devi
 	log.I(ctx, "Waiting for connection to GAPIR...")
 
 	// Create gRPC connection
-	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", newDeviceConnectionInfo.port),
+	opts := []grpc.DialOption{
 		grpc.WithInsecure(),
 		grpc.WithBlock(),
 		grpc.WithTimeout(gRPCConnectTimeout),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)))
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+	}
+	if shouldCompress(ctx, device) {
+		// GAPIR replies with the compressor of the requests. The stream is
+		// compressed with gzip rather than zstd, as the C++ gRPC of GAPIR only
+		// supports gzip and deflate.
+		log.I(ctx, "Compressing the replay stream")
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", newDeviceConnectionInfo.port), opts...)
 	if err != nil {
 		return nil, log.Err(ctx, err, "Timeout waiting for connection")
 	}
@@ -148,10 +205,25 @@ func (client *Client) Connect(ctx context.Context, device bind.Device, abi *devi
 		return nil, log.Err(ctx, err, "Error in startReplayCommunicationHandler")
 	}
 
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.replayers == nil {
+		replayer.closeConnection(ctx)
+		return nil, log.Err(ctx, nil, "Client has been shutdown")
+	}
 	client.replayers[key] = replayer
 	return &key, nil
 }
 
+// shouldCompress returns whether the replay stream to the device should be
+// compressed, as controlled by the CompressKey device property.
+func shouldCompress(ctx context.Context, device bind.Device) bool {
+	if compress, ok := bind.GetRegistry(ctx).DeviceProperty(ctx, device, CompressKey).(bool); ok {
+		return compress
+	}
+	return device.Instance().ID.ID() != bind.Host(ctx).Instance().ID.ID()
+}
+
 // removeReplayer closes and removes a GAPIR instance.
 func (client *Client) removeReplayer(ctx context.Context, replayer *replayer) {
 	client.mutex.Lock()
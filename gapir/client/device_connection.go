@@ -331,9 +331,21 @@ func newADB(ctx context.Context, d adb.Device, abi *device.ABI, launchArgs []str
 		return nil, log.Err(ctx, err, "Forwarding port")
 	}
 
+	diskCache := false
+	for _, arg := range completeLaunchArgs {
+		diskCache = diskCache || arg == "--enable-disk-cache"
+	}
+
 	cleanupFunc := func() {
 		cleanup.Invoke(ctx)
 		d.RemoveForward(ctx, localPort)
+		if diskCache {
+			// GAPIR deletes its disk cache when it exits, which it doesn't if
+			// it's killed at the end of the session.
+			if _, err := d.Shell("run-as", apk.Name, "rm", "-rf", appDir+"/cache/resources").Call(ctx); err != nil {
+				log.W(ctx, "Failed to delete the disk cache of gapir: %v", err)
+			}
+		}
 	}
 
 	return &deviceConnectionInfo{port: port, authToken: "", cleanupFunc: cleanupFunc}, nil
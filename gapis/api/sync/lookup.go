@@ -16,7 +16,9 @@ package sync
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sort"
 
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
@@ -40,6 +42,19 @@ func (r *SubCmdRange) IsNil() bool {
 	return r == nil || r.From == nil || r.To == nil
 }
 
+// Match is how closely a RenderPassLookup result matches the looked up key.
+type Match int
+
+const (
+	// NoMatch means no index was found for the key.
+	NoMatch Match = iota
+	// FuzzyMatch means the index was found from some of the key's handles,
+	// e.g. the closest submission of the command buffer.
+	FuzzyMatch
+	// ExactMatch means the index was found from all of the key's handles.
+	ExactMatch
+)
+
 // RenderPassLookup maintains a mapping of RenderPassKey to api.SubCmdIdx. It allows for fuzzy
 // lookup of command indecies for submitted render passes and command buffers.
 type RenderPassLookup struct {
@@ -82,15 +97,44 @@ func (l *RenderPassLookup) AddRenderPass(ctx context.Context, key RenderPassKey,
 // index, if it exists. Returned indecies either point to a submitted command buffer or a render
 // pass within a submitted command buffer.
 func (l *RenderPassLookup) Lookup(ctx context.Context, key RenderPassKey) SubCmdRange {
+	idx, _ := l.LookupMatch(ctx, key)
+	return idx
+}
+
+// LookupMatch is like Lookup, but also returns how closely the returned index
+// matches the key.
+func (l *RenderPassLookup) LookupMatch(ctx context.Context, key RenderPassKey) (SubCmdRange, Match) {
 	if key.RenderPass != 0 {
 		if rpl, ok := l.renderPasses[key.RenderPass]; ok {
 			return rpl.lookup(key)
 		}
 	}
 	if cbl, ok := l.commandBuffers[key.CommandBuffer]; ok {
-		return cbl.lookup(key)
+		idx, match := cbl.lookup(key)
+		if key.RenderPass != 0 && match == ExactMatch {
+			// The render pass is unknown, only its command buffer matched.
+			match = FuzzyMatch
+		}
+		return idx, match
 	}
-	return SubCmdRange{}
+	return SubCmdRange{}, NoMatch
+}
+
+// RenderPasses returns the command ranges of all the render passes added to
+// the lookup, sorted by their first command.
+func (l *RenderPassLookup) RenderPasses() []SubCmdRange {
+	seen := map[string]bool{}
+	r := []SubCmdRange{}
+	for _, rpl := range l.renderPasses {
+		for _, idx := range rpl.mappings {
+			if key := fmt.Sprint(idx.From); !seen[key] {
+				seen[key] = true
+				r = append(r, idx)
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].From.LessThan(r[j].From) })
+	return r
 }
 
 type commandBufferLookup struct {
@@ -114,14 +158,14 @@ func (l *commandBufferLookup) add(submission int, idx api.SubCmdIdx) {
 	}
 }
 
-func (l *commandBufferLookup) lookup(key RenderPassKey) SubCmdRange {
+func (l *commandBufferLookup) lookup(key RenderPassKey) (SubCmdRange, Match) {
 	if idx, ok := l.submissions[key.Submission]; ok {
-		return SubCmdRange{idx, idx}
+		return SubCmdRange{idx, idx}, ExactMatch
 	}
 
 	if key.Submission == 0 || len(l.submissions) == 1 {
 		idx := l.submissions[l.firstSubmission]
-		return SubCmdRange{idx, idx}
+		return SubCmdRange{idx, idx}, FuzzyMatch
 	}
 
 	// Find the command buffer that matches the submission index the closest.
@@ -134,7 +178,7 @@ func (l *commandBufferLookup) lookup(key RenderPassKey) SubCmdRange {
 			distance = d
 		}
 	}
-	return SubCmdRange{idx, idx}
+	return SubCmdRange{idx, idx}, FuzzyMatch
 }
 
 type renderPassLookup struct {
@@ -164,17 +208,17 @@ func (l *renderPassLookup) add(key RenderPassKey, idx SubCmdRange) {
 	}
 }
 
-func (l *renderPassLookup) lookup(key RenderPassKey) SubCmdRange {
+func (l *renderPassLookup) lookup(key RenderPassKey) (SubCmdRange, Match) {
 	key.RenderPass = 0
 
 	if idx, ok := l.mappings[key]; ok {
-		return idx
+		return idx, ExactMatch
 	}
 
 	if key.CommandBuffer != 0 {
 		if list, ok := l.byCommandBuffer[key.CommandBuffer]; ok {
 			if len(list) == 1 { // most common case.
-				return l.mappings[list[0]]
+				return l.mappings[list[0]], FuzzyMatch
 			}
 
 			// Find entry where the framebuffer matches, or the closest submission.
@@ -182,7 +226,7 @@ func (l *renderPassLookup) lookup(key RenderPassKey) SubCmdRange {
 			var found RenderPassKey
 			for i := range list {
 				if list[i].Framebuffer == key.Framebuffer {
-					return l.mappings[list[i]]
+					return l.mappings[list[i]], FuzzyMatch
 				}
 				d := abs(list[i].Submission - key.Submission)
 				if d < distance {
@@ -190,14 +234,14 @@ func (l *renderPassLookup) lookup(key RenderPassKey) SubCmdRange {
 					distance = d
 				}
 			}
-			return l.mappings[found]
+			return l.mappings[found], FuzzyMatch
 		}
 	}
 
 	if key.Framebuffer != 0 { // and key.CommandBuffer == 0 or unknown
 		if list, ok := l.byFramebuffer[key.Framebuffer]; ok {
 			if len(list) == 1 { // most common case.
-				return l.mappings[list[0]]
+				return l.mappings[list[0]], FuzzyMatch
 			}
 
 			// Find the entry with the closest submission index.
@@ -210,7 +254,7 @@ func (l *renderPassLookup) lookup(key RenderPassKey) SubCmdRange {
 					distance = d
 				}
 			}
-			return l.mappings[found]
+			return l.mappings[found], FuzzyMatch
 		}
 	}
 
@@ -224,7 +268,10 @@ func (l *renderPassLookup) lookup(key RenderPassKey) SubCmdRange {
 			distance = d
 		}
 	}
-	return idx
+	if idx.IsNil() {
+		return idx, NoMatch
+	}
+	return idx, FuzzyMatch
 }
 
 func abs(v int) int {
@@ -0,0 +1,66 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+)
+
+func TestRenderPassLookupMatch(t *testing.T) {
+	ctx := log.Testing(t)
+
+	l := NewRenderPassLookup()
+	l.AddCommandBuffer(ctx, 1, 10, api.SubCmdIdx{5, 0, 0})
+	l.AddCommandBuffer(ctx, 3, 10, api.SubCmdIdx{8, 0, 0})
+	rp := SubCmdRange{api.SubCmdIdx{5, 0, 0, 1}, api.SubCmdIdx{5, 0, 0, 3}}
+	l.AddRenderPass(ctx, RenderPassKey{1, 10, 20, 30}, rp)
+
+	for _, test := range []struct {
+		name     string
+		key      RenderPassKey
+		expected SubCmdRange
+		match    Match
+	}{
+		{"exact render pass", RenderPassKey{1, 10, 20, 30}, rp, ExactMatch},
+		{"other framebuffer", RenderPassKey{1, 10, 20, 31}, rp, FuzzyMatch},
+		{"exact command buffer", RenderPassKey{3, 10, 0, 0}, SubCmdRange{api.SubCmdIdx{8, 0, 0}, api.SubCmdIdx{8, 0, 0}}, ExactMatch},
+		{"unknown render pass", RenderPassKey{3, 10, 21, 30}, SubCmdRange{api.SubCmdIdx{8, 0, 0}, api.SubCmdIdx{8, 0, 0}}, FuzzyMatch},
+		{"closest submission", RenderPassKey{4, 10, 0, 0}, SubCmdRange{api.SubCmdIdx{8, 0, 0}, api.SubCmdIdx{8, 0, 0}}, FuzzyMatch},
+		{"unknown command buffer", RenderPassKey{1, 11, 21, 30}, SubCmdRange{}, NoMatch},
+	} {
+		idx, match := l.LookupMatch(ctx, test.key)
+		assert.For(ctx, "%v match", test.name).That(match).Equals(test.match)
+		assert.For(ctx, "%v index", test.name).That(idx).DeepEquals(test.expected)
+	}
+}
+
+func TestRenderPassLookupRenderPasses(t *testing.T) {
+	ctx := log.Testing(t)
+
+	l := NewRenderPassLookup()
+	rp1 := SubCmdRange{api.SubCmdIdx{5, 0, 0, 1}, api.SubCmdIdx{5, 0, 0, 3}}
+	rp2 := SubCmdRange{api.SubCmdIdx{5, 0, 0, 4}, api.SubCmdIdx{5, 0, 0, 6}}
+	rp3 := SubCmdRange{api.SubCmdIdx{8, 0, 0, 1}, api.SubCmdIdx{8, 0, 0, 2}}
+	l.AddRenderPass(ctx, RenderPassKey{3, 11, 21, 30}, rp3)
+	l.AddRenderPass(ctx, RenderPassKey{1, 10, 20, 30}, rp1)
+	l.AddRenderPass(ctx, RenderPassKey{1, 10, 21, 31}, rp2)
+	l.AddRenderPass(ctx, RenderPassKey{1, 10, 20, 30}, rp1)
+
+	assert.For(ctx, "render passes").ThatSlice(l.RenderPasses()).DeepEquals([]SubCmdRange{rp1, rp2, rp3})
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// cmdObserver is called with the state after each real command of a capture
+// was mutated, by analyzeCapture.
+type cmdObserver func(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error
+
+// analyzeCapture mutates the commands of the capture in order, from its
+// initial state, calling start, if not nil, with the initial state and
+// observe after each real command.
+func analyzeCapture(ctx context.Context, c *path.Capture, start func(s *api.GlobalState), observe cmdObserver) error {
+	ctx = capture.Put(ctx, c)
+	s, err := capture.NewState(ctx)
+	if err != nil {
+		return err
+	}
+	cmds, err := resolve.Cmds(ctx, c)
+	if err != nil {
+		return err
+	}
+	if start != nil {
+		start(s)
+	}
+	return api.ForeachCmd(ctx, cmds, true, func(ctx context.Context, id api.CmdID, cmd api.Cmd) error {
+		if err := cmd.Mutate(ctx, id, s, nil, nil); err != nil {
+			return err
+		}
+		if !id.IsReal() {
+			return nil
+		}
+		return observe(ctx, id, cmd, s)
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// recordCommands adds a command buffer with the given handle to the state,
+// recording the commands with the given arguments, in order.
+func recordCommands(st *State, handle VkCommandBuffer, cmds ...interface{}) {
+	cb := MakeCommandBufferObjectʳ()
+	cb.SetVulkanHandle(handle)
+	st.CommandBuffers().Add(handle, cb)
+	b := cb.BufferCommands()
+	for i, args := range cmds {
+		var ty CommandType
+		var index uint32
+		switch args := args.(type) {
+		case VkCmdBeginRenderPassArgsʳ:
+			ty, index = CommandType_cmd_vkCmdBeginRenderPass, uint32(b.VkCmdBeginRenderPass().Len())
+			b.VkCmdBeginRenderPass().Add(index, args)
+		case VkCmdEndRenderPassArgsʳ:
+			ty, index = CommandType_cmd_vkCmdEndRenderPass, uint32(b.VkCmdEndRenderPass().Len())
+			b.VkCmdEndRenderPass().Add(index, args)
+		case VkCmdExecuteCommandsArgsʳ:
+			ty, index = CommandType_cmd_vkCmdExecuteCommands, uint32(b.VkCmdExecuteCommands().Len())
+			b.VkCmdExecuteCommands().Add(index, args)
+		case VkCmdPushConstantsArgsʳ:
+			ty, index = CommandType_cmd_vkCmdPushConstants, uint32(b.VkCmdPushConstants().Len())
+			b.VkCmdPushConstants().Add(index, args)
+		case VkCmdUpdateBufferArgsʳ:
+			ty, index = CommandType_cmd_vkCmdUpdateBuffer, uint32(b.VkCmdUpdateBuffer().Len())
+			b.VkCmdUpdateBuffer().Add(index, args)
+		case VkCmdDrawArgsʳ:
+			ty, index = CommandType_cmd_vkCmdDraw, uint32(b.VkCmdDraw().Len())
+			b.VkCmdDraw().Add(index, args)
+		case VkCmdBindDescriptorSetsArgsʳ:
+			ty, index = CommandType_cmd_vkCmdBindDescriptorSets, uint32(b.VkCmdBindDescriptorSets().Len())
+			b.VkCmdBindDescriptorSets().Add(index, args)
+		case VkCmdPipelineBarrierArgsʳ:
+			ty, index = CommandType_cmd_vkCmdPipelineBarrier, uint32(b.VkCmdPipelineBarrier().Len())
+			b.VkCmdPipelineBarrier().Add(index, args)
+		default:
+			panic(fmt.Sprintf("Unexpected recorded command %T", args))
+		}
+		ref := MakeCommandReferenceʳ()
+		ref.SetBuffer(handle)
+		ref.SetCommandIndex(uint32(i))
+		ref.SetType(ty)
+		ref.SetMapIndex(index)
+		cb.CommandReferences().Add(uint32(i), ref)
+	}
+}
+
+// testBatch is a batch of command buffers of a queue submission, with the
+// semaphores it waits on and signals.
+type testBatch struct {
+	waits, signals []VkSemaphore
+	buffers        []VkCommandBuffer
+}
+
+// queueSubmit returns a submission of the batches to the queue, reading the
+// batches from memory allocated in the state.
+func queueSubmit(ctx context.Context, s *api.GlobalState, queue VkQueue, batches ...testBatch) api.Cmd {
+	reads := []api.AllocResult{}
+	alloc := func(count int, v interface{}) memory.Pointer {
+		if count == 0 {
+			return memory.Nullptr
+		}
+		res := s.AllocDataOrPanic(ctx, v)
+		reads = append(reads, res)
+		return res.Ptr()
+	}
+	infos := make([]VkSubmitInfo, len(batches))
+	for i, b := range batches {
+		infos[i] = NewVkSubmitInfo(
+			VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+			0,                    // pNext
+			uint32(len(b.waits)), // waitSemaphoreCount
+			NewVkSemaphoreᶜᵖ(alloc(len(b.waits), b.waits)), // pWaitSemaphores
+			0,                      // pWaitDstStageMask
+			uint32(len(b.buffers)), // commandBufferCount
+			NewVkCommandBufferᶜᵖ(alloc(len(b.buffers), b.buffers)), // pCommandBuffers
+			uint32(len(b.signals)),                             // signalSemaphoreCount
+			NewVkSemaphoreᶜᵖ(alloc(len(b.signals), b.signals)), // pSignalSemaphores
+		)
+	}
+	info := s.AllocDataOrPanic(ctx, infos)
+	cmd := CommandBuilder{}.VkQueueSubmit(queue, uint32(len(infos)), info.Ptr(), VkFence(0), VkResult_VK_SUCCESS)
+	cmd.AddRead(info.Data())
+	for _, r := range reads {
+		cmd.AddRead(r.Data())
+	}
+	return cmd
+}
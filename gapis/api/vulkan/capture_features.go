@@ -0,0 +1,79 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var _ = replay.FeatureAnalyzer(API{})
+
+// CaptureFeatures returns the GPU features used by the capture, from the
+// pipelines created in the initial state or by the capture's commands, and
+// the dispatches recorded by the commands.
+func (API) CaptureFeatures(ctx context.Context, c *path.Capture) (replay.CaptureFeatures, error) {
+	ctx = status.Start(ctx, "vulkan.CaptureFeatures")
+	defer status.Finish(ctx)
+	f := &captureFeatures{seen: map[VkPipeline]bool{}}
+	err := analyzeCapture(ctx, c, f.addPipelines, f.observe)
+	return f.features, err
+}
+
+// captureFeatures collects the features used by the pipelines and commands.
+type captureFeatures struct {
+	features replay.CaptureFeatures
+	// The graphics pipelines already inspected.
+	seen map[VkPipeline]bool
+}
+
+// addPipelines adds the features of the pipelines of the state not seen
+// before.
+func (f *captureFeatures) addPipelines(s *api.GlobalState) {
+	st := GetState(s)
+	for handle, p := range st.GraphicsPipelines().All() {
+		if f.seen[handle] {
+			continue
+		}
+		f.seen[handle] = true
+		for _, stage := range p.Stages().All() {
+			switch stage.Stage() {
+			case VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_CONTROL_BIT,
+				VkShaderStageFlagBits_VK_SHADER_STAGE_TESSELLATION_EVALUATION_BIT:
+				f.features.Tessellation = true
+			case VkShaderStageFlagBits_VK_SHADER_STAGE_GEOMETRY_BIT:
+				f.features.Geometry = true
+			}
+		}
+	}
+	if st.ComputePipelines().Len() > 0 {
+		f.features.Compute = true
+	}
+}
+
+// observe adds the features of the command, with the state after it.
+func (f *captureFeatures) observe(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error {
+	switch cmd.(type) {
+	case *VkCreateGraphicsPipelines, *VkCreateComputePipelines:
+		f.addPipelines(s)
+	case *VkCmdDispatch, *VkCmdDispatchIndirect:
+		f.features.Compute = true
+	}
+	return nil
+}
@@ -1606,6 +1606,25 @@ func rebuildVkCmdDrawIndirectByteCountEXT(
 	), nil
 }
 
+func rebuildVkCmdSetFragmentShadingRateKHR(
+	ctx context.Context,
+	cb CommandBuilder,
+	commandBuffer VkCommandBuffer,
+	r *api.GlobalState,
+	s *api.GlobalState,
+	d VkCmdSetFragmentShadingRateKHRArgsʳ) (func(), api.Cmd, error) {
+
+	sizeData := s.AllocDataOrPanic(ctx, d.FragmentSize())
+	combinerOps := NewVkFragmentShadingRateCombinerOpKHRː2ᵃ(d.PrimitiveCombinerOp(), d.AttachmentCombinerOp())
+
+	return func() {
+			sizeData.Free()
+		}, cb.VkCmdSetFragmentShadingRateKHR(commandBuffer,
+			sizeData.Ptr(),
+			combinerOps,
+		).AddRead(sizeData.Data()), nil
+}
+
 // GetCommandArgs takes a command reference and returns the command arguments
 // of that recorded command.
 func GetCommandArgs(ctx context.Context,
@@ -1744,6 +1763,9 @@ func GetCommandArgs(ctx context.Context,
 		return cmds.VkCmdEndQueryIndexedEXT().Get(cr.MapIndex())
 	case CommandType_cmd_vkCmdDrawIndirectByteCountEXT:
 		return cmds.VkCmdDrawIndirectByteCountEXT().Get(cr.MapIndex())
+	// @extension("VK_KHR_fragment_shading_rate")
+	case CommandType_cmd_vkCmdSetFragmentShadingRateKHR:
+		return cmds.VkCmdSetFragmentShadingRateKHR().Get(cr.MapIndex())
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", cr)
 		panic(x)
@@ -1884,6 +1906,9 @@ func GetCommandFunction(cr *CommandReference) interface{} {
 		return subDovkCmdEndQueryIndexedEXT
 	case CommandType_cmd_vkCmdDrawIndirectByteCountEXT:
 		return subDovkCmdDrawIndirectByteCountEXT
+	// @extension("VK_KHR_fragment_shading_rate")
+	case CommandType_cmd_vkCmdSetFragmentShadingRateKHR:
+		return subDovkCmdSetFragmentShadingRateKHR
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", cr)
 		panic(x)
@@ -2031,6 +2056,8 @@ func AddCommand(ctx context.Context,
 		return rebuildVkCmdEndQueryIndexedEXT(ctx, cb, commandBuffer, r, s, t)
 	case VkCmdDrawIndirectByteCountEXTArgsʳ:
 		return rebuildVkCmdDrawIndirectByteCountEXT(ctx, cb, commandBuffer, r, s, t)
+	case VkCmdSetFragmentShadingRateKHRArgsʳ:
+		return rebuildVkCmdSetFragmentShadingRateKHR(ctx, cb, commandBuffer, r, s, t)
 	default:
 		x := fmt.Sprintf("Should not reach here: %T", t)
 		panic(x)
@@ -0,0 +1,136 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var _ = replay.DescriptorAnalyzer(API{})
+
+// FrameDescriptors returns the descriptor usage of each frame of the capture,
+// the frames ending at each presentation: the descriptors written by the
+// updates of descriptor sets, and the descriptor sets bound by the submitted
+// command buffers, including secondary command buffers. Commands after the
+// last presentation are not reported.
+func (API) FrameDescriptors(ctx context.Context, c *path.Capture) ([]replay.FrameDescriptors, error) {
+	ctx = status.Start(ctx, "vulkan.FrameDescriptors")
+	defer status.Finish(ctx)
+	d := &descriptorUsage{res: []replay.FrameDescriptors{}, frame: newFrameDescriptors()}
+	err := analyzeCapture(ctx, c, nil, d.observe)
+	return d.res, err
+}
+
+// descriptorUsage collects the descriptor usage of the frames.
+type descriptorUsage struct {
+	res []replay.FrameDescriptors
+	// The frame of the next presentation.
+	frame *frameDescriptors
+}
+
+func (d *descriptorUsage) observe(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error {
+	l := s.MemoryLayout
+	st := GetState(s)
+	switch cmd := cmd.(type) {
+	case *VkUpdateDescriptorSets:
+		d.frame.Writes += cmd.DescriptorWriteCount()
+	case *VkUpdateDescriptorSetWithTemplate:
+		d.frame.addTemplateWrites(st, cmd.DescriptorUpdateTemplate())
+	case *VkUpdateDescriptorSetWithTemplateKHR:
+		d.frame.addTemplateWrites(st, cmd.DescriptorUpdateTemplate())
+	case *VkQueueSubmit:
+		submits, err := cmd.PSubmits().Slice(0, uint64(cmd.SubmitCount()), l).Read(ctx, cmd, s, nil)
+		if err != nil {
+			return err
+		}
+		for _, info := range submits {
+			buffers, err := info.PCommandBuffers().Slice(0, uint64(info.CommandBufferCount()), l).Read(ctx, cmd, s, nil)
+			if err != nil {
+				return err
+			}
+			for _, buffer := range buffers {
+				d.frame.addCommandBuffer(ctx, st, st.CommandBuffers().Get(buffer))
+			}
+		}
+	case *VkQueuePresentKHR:
+		d.res = append(d.res, d.frame.FrameDescriptors)
+		d.frame = newFrameDescriptors()
+	}
+	return nil
+}
+
+// frameDescriptors accumulates the descriptor usage of a frame.
+type frameDescriptors struct {
+	replay.FrameDescriptors
+	// The distinct descriptor sets bound in the frame.
+	sets map[VkDescriptorSet]struct{}
+}
+
+func newFrameDescriptors() *frameDescriptors {
+	return &frameDescriptors{sets: map[VkDescriptorSet]struct{}{}}
+}
+
+// addTemplateWrites adds the descriptors written by an update with the
+// template to the frame, being one write per entry of the template.
+func (f *frameDescriptors) addTemplateWrites(st *State, template VkDescriptorUpdateTemplate) {
+	if obj, ok := st.DescriptorUpdateTemplates().Lookup(template); ok {
+		f.Writes += uint32(obj.Entries().Len())
+	}
+}
+
+// addCommandBuffer adds the descriptor sets bound by the command buffer, and
+// by the secondary command buffers it executes, to the frame.
+func (f *frameDescriptors) addCommandBuffer(ctx context.Context, st *State, cb CommandBufferObjectʳ) {
+	for i := 0; i < cb.CommandReferences().Len(); i++ {
+		switch args := GetCommandArgs(ctx, cb.CommandReferences().Get(uint32(i)), st).(type) {
+		case VkCmdBindDescriptorSetsArgsʳ:
+			f.Binds++
+			for _, set := range args.DescriptorSets().All() {
+				f.addBoundSet(st, set)
+			}
+		case VkCmdExecuteCommandsArgsʳ:
+			for j := 0; j < args.CommandBuffers().Len(); j++ {
+				f.addCommandBuffer(ctx, st, st.CommandBuffers().Get(args.CommandBuffers().Get(uint32(j))))
+			}
+		}
+	}
+}
+
+// addBoundSet adds a bound descriptor set to the frame, counting the sets
+// using descriptor indexing only once per frame.
+func (f *frameDescriptors) addBoundSet(st *State, set VkDescriptorSet) {
+	f.BoundSets++
+	if _, ok := f.sets[set]; ok {
+		return
+	}
+	f.sets[set] = struct{}{}
+	obj, ok := st.DescriptorSets().Lookup(set)
+	if !ok {
+		return
+	}
+	if pool, ok := st.DescriptorPools().Lookup(obj.DescriptorPool()); ok {
+		if uint32(pool.Flags())&uint32(VkDescriptorPoolCreateFlagBits_VK_DESCRIPTOR_POOL_CREATE_UPDATE_AFTER_BIND_BIT_EXT) != 0 {
+			f.UpdateAfterBindSets++
+		}
+	}
+	if obj.VariableDescriptorCount() > 0 {
+		f.VariableCountSets++
+	}
+}
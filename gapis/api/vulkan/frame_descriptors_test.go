@@ -0,0 +1,84 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+func TestFrameDescriptors(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	st := GetState(s)
+
+	// Set 1 is allocated from an update-after-bind pool, set 2 with a
+	// variable descriptor count.
+	pool := MakeDescriptorPoolObjectʳ()
+	pool.SetFlags(VkDescriptorPoolCreateFlags(VkDescriptorPoolCreateFlagBits_VK_DESCRIPTOR_POOL_CREATE_UPDATE_AFTER_BIND_BIT_EXT))
+	st.DescriptorPools().Add(VkDescriptorPool(1), pool)
+	set := MakeDescriptorSetObjectʳ()
+	set.SetDescriptorPool(VkDescriptorPool(1))
+	st.DescriptorSets().Add(VkDescriptorSet(1), set)
+	set = MakeDescriptorSetObjectʳ()
+	set.SetVariableDescriptorCount(16)
+	st.DescriptorSets().Add(VkDescriptorSet(2), set)
+
+	template := MakeDescriptorUpdateTemplateObjectʳ()
+	template.Entries().Add(0, MakeVkDescriptorUpdateTemplateEntry())
+	template.Entries().Add(1, MakeVkDescriptorUpdateTemplateEntry())
+	st.DescriptorUpdateTemplates().Add(VkDescriptorUpdateTemplate(1), template)
+
+	bind := func(sets ...VkDescriptorSet) VkCmdBindDescriptorSetsArgsʳ {
+		args := MakeVkCmdBindDescriptorSetsArgsʳ()
+		for i, set := range sets {
+			args.DescriptorSets().Add(uint32(i), set)
+		}
+		return args
+	}
+	execute := MakeVkCmdExecuteCommandsArgsʳ()
+	execute.CommandBuffers().Add(0, VkCommandBuffer(2))
+	recordCommands(st, 1, bind(1, 2), execute)
+	recordCommands(st, 2, bind(1))
+
+	cb := CommandBuilder{}
+	cmds := []api.Cmd{
+		cb.VkUpdateDescriptorSets(VkDevice(1), 3, memory.Nullptr, 0, memory.Nullptr),
+		queueSubmit(ctx, s, VkQueue(1), testBatch{buffers: []VkCommandBuffer{1}}),
+		cb.VkQueuePresentKHR(VkQueue(1), memory.Nullptr, VkResult_VK_SUCCESS),
+		cb.VkUpdateDescriptorSetWithTemplate(VkDevice(1), VkDescriptorSet(1), VkDescriptorUpdateTemplate(1), memory.Nullptr),
+		cb.VkQueuePresentKHR(VkQueue(1), memory.Nullptr, VkResult_VK_SUCCESS),
+		// Commands after the last presentation are not reported.
+		cb.VkUpdateDescriptorSets(VkDevice(1), 1, memory.Nullptr, 0, memory.Nullptr),
+	}
+	d := &descriptorUsage{res: []replay.FrameDescriptors{}, frame: newFrameDescriptors()}
+	for i, cmd := range cmds {
+		err := d.observe(ctx, api.CmdID(i), cmd, s)
+		assert.For(ctx, "observe %d", i).ThatError(err).Succeeded()
+	}
+
+	assert.For(ctx, "frames").ThatSlice(d.res).Equals([]replay.FrameDescriptors{
+		{Binds: 2, BoundSets: 3, Writes: 3, UpdateAfterBindSets: 1, VariableCountSets: 1},
+		{Writes: 2},
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var _ = replay.MemoryAnalyzer(API{})
+
+// MemoryTimeline returns the device memory allocations and frees, and the
+// image and buffer creations and destructions, of the capture, in command
+// order. The memory allocated in the initial state of the capture is
+// returned first, without a command.
+func (API) MemoryTimeline(ctx context.Context, c *path.Capture) ([]replay.MemoryEvent, error) {
+	ctx = status.Start(ctx, "vulkan.MemoryTimeline")
+	defer status.Finish(ctx)
+	t := newMemoryTimeline()
+	err := analyzeCapture(ctx, c, t.start, t.observe)
+	return t.events, err
+}
+
+// memoryTimeline tracks the device memory allocations, and the number of
+// images and buffers, of the commands.
+type memoryTimeline struct {
+	events []replay.MemoryEvent
+	// The allocations not freed yet.
+	allocations map[VkDeviceMemory]DeviceMemoryObjectʳ
+	// The number of images and buffers after the last observed command.
+	images, buffers int
+	frame           int
+}
+
+func newMemoryTimeline() *memoryTimeline {
+	return &memoryTimeline{
+		events:      []replay.MemoryEvent{},
+		allocations: map[VkDeviceMemory]DeviceMemoryObjectʳ{},
+	}
+}
+
+// start adds the allocations, images and buffers of the initial state.
+func (t *memoryTimeline) start(s *api.GlobalState) {
+	st := GetState(s)
+	for handle, mem := range st.DeviceMemories().All() {
+		t.allocations[handle] = mem
+		t.events = append(t.events, replay.MemoryEvent{
+			Command: api.CmdNoID,
+			Heap:    st.memoryHeap(mem),
+			Size:    int64(mem.AllocationSize()),
+		})
+	}
+	t.images, t.buffers = st.Images().Len(), st.Buffers().Len()
+	if t.images+t.buffers > 0 {
+		t.events = append(t.events, replay.MemoryEvent{Command: api.CmdNoID, Images: int32(t.images), Buffers: int32(t.buffers)})
+	}
+}
+
+// observe adds the events of the command, with the state after it.
+func (t *memoryTimeline) observe(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error {
+	st := GetState(s)
+	switch cmd := cmd.(type) {
+	case *VkQueuePresentKHR:
+		t.frame++
+	case *VkAllocateMemory:
+		handle, err := cmd.PMemory().Read(ctx, cmd, s, nil)
+		if err != nil {
+			return err
+		}
+		if mem := st.DeviceMemories().Get(handle); !mem.IsNil() {
+			t.allocations[handle] = mem
+			t.events = append(t.events, replay.MemoryEvent{
+				Command: id,
+				Frame:   t.frame,
+				Heap:    st.memoryHeap(mem),
+				Size:    int64(mem.AllocationSize()),
+			})
+		}
+	case *VkFreeMemory:
+		freed, ok := t.allocations[cmd.Memory()]
+		if ok && st.DeviceMemories().Get(cmd.Memory()).IsNil() {
+			delete(t.allocations, cmd.Memory())
+			t.events = append(t.events, replay.MemoryEvent{
+				Command: id,
+				Frame:   t.frame,
+				Heap:    st.memoryHeap(freed),
+				Size:    -int64(freed.AllocationSize()),
+			})
+		}
+	}
+	images, buffers := st.Images().Len(), st.Buffers().Len()
+	if di, db := images-t.images, buffers-t.buffers; di != 0 || db != 0 {
+		t.events = append(t.events, replay.MemoryEvent{Command: id, Frame: t.frame, Images: int32(di), Buffers: int32(db)})
+	}
+	t.images, t.buffers = images, buffers
+	return nil
+}
+
+// memoryHeap returns the heap of the memory type of the allocation, or zero
+// if its physical device is unknown.
+func (s *State) memoryHeap(mem DeviceMemoryObjectʳ) uint32 {
+	device := s.Devices().Get(mem.Device())
+	if device.IsNil() {
+		return 0
+	}
+	physicalDevice := s.PhysicalDevices().Get(device.PhysicalDevice())
+	if physicalDevice.IsNil() {
+		return 0
+	}
+	props := physicalDevice.MemoryProperties()
+	if props.MemoryTypeCount() <= mem.MemoryTypeIndex() {
+		return 0
+	}
+	return props.MemoryTypes().Get(int(mem.MemoryTypeIndex())).HeapIndex()
+}
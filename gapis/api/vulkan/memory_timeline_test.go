@@ -0,0 +1,95 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+func TestMemoryTimeline(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	st := GetState(s)
+
+	// A device whose memory type 1 is allocated from heap 1.
+	props := MakeVkPhysicalDeviceMemoryProperties()
+	props.SetMemoryTypeCount(2)
+	heap1 := MakeVkMemoryType()
+	heap1.SetHeapIndex(1)
+	props.MemoryTypes().Set(1, heap1)
+	physicalDevice := MakePhysicalDeviceObjectʳ()
+	physicalDevice.SetMemoryProperties(props)
+	st.PhysicalDevices().Add(VkPhysicalDevice(1), physicalDevice)
+	dev := MakeDeviceObjectʳ()
+	dev.SetPhysicalDevice(VkPhysicalDevice(1))
+	st.Devices().Add(VkDevice(1), dev)
+
+	allocation := func(handle VkDeviceMemory, size VkDeviceSize, memoryType uint32) DeviceMemoryObjectʳ {
+		mem := MakeDeviceMemoryObjectʳ()
+		mem.SetDevice(VkDevice(1))
+		mem.SetVulkanHandle(handle)
+		mem.SetAllocationSize(size)
+		mem.SetMemoryTypeIndex(memoryType)
+		return mem
+	}
+
+	// 64 bytes of heap 0 are allocated in the initial state.
+	st.DeviceMemories().Add(VkDeviceMemory(1), allocation(1, 64, 0))
+	tl := newMemoryTimeline()
+	tl.start(s)
+
+	// The commands are observed with the state after their mutation.
+	handle := s.AllocDataOrPanic(ctx, VkDeviceMemory(2))
+	allocate := CommandBuilder{}.VkAllocateMemory(VkDevice(1), memory.Nullptr, memory.Nullptr, handle.Ptr(), VkResult_VK_SUCCESS)
+	allocate.AddWrite(handle.Data())
+	st.DeviceMemories().Add(VkDeviceMemory(2), allocation(2, 256, 1))
+	err := tl.observe(ctx, 0, allocate, s)
+	assert.For(ctx, "allocate").ThatError(err).Succeeded()
+
+	st.Images().Add(VkImage(1), MakeImageObjectʳ())
+	createImage := CommandBuilder{}.VkCreateImage(VkDevice(1), memory.Nullptr, memory.Nullptr, memory.Nullptr, VkResult_VK_SUCCESS)
+	err = tl.observe(ctx, 1, createImage, s)
+	assert.For(ctx, "create image").ThatError(err).Succeeded()
+
+	present := CommandBuilder{}.VkQueuePresentKHR(VkQueue(1), memory.Nullptr, VkResult_VK_SUCCESS)
+	err = tl.observe(ctx, 2, present, s)
+	assert.For(ctx, "present").ThatError(err).Succeeded()
+
+	st.DeviceMemories().Remove(VkDeviceMemory(1))
+	free := CommandBuilder{}.VkFreeMemory(VkDevice(1), VkDeviceMemory(1), memory.Nullptr)
+	err = tl.observe(ctx, 3, free, s)
+	assert.For(ctx, "free").ThatError(err).Succeeded()
+
+	// Freeing an untracked allocation is ignored.
+	free = CommandBuilder{}.VkFreeMemory(VkDevice(1), VkDeviceMemory(3), memory.Nullptr)
+	err = tl.observe(ctx, 4, free, s)
+	assert.For(ctx, "free untracked").ThatError(err).Succeeded()
+
+	assert.For(ctx, "events").ThatSlice(tl.events).DeepEquals([]replay.MemoryEvent{
+		{Command: api.CmdNoID, Heap: 0, Size: 64},
+		{Command: 0, Frame: 0, Heap: 1, Size: 256},
+		{Command: 1, Frame: 0, Images: 1},
+		{Command: 3, Frame: 1, Heap: 0, Size: -64},
+	})
+}
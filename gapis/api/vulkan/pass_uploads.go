@@ -0,0 +1,261 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var _ = replay.UploadAnalyzer(API{})
+
+// PassUploads returns the data uploaded for each render pass of the submitted
+// command buffers of the capture: the push constants recorded in the pass,
+// including secondary command buffers, and the buffer updates and copies
+// recorded before it, along with the draws recorded in the pass and whether
+// they only write depth or stencil. Writes of mapped memory are not measured.
+func (API) PassUploads(ctx context.Context, c *path.Capture) ([]replay.PassUploads, error) {
+	ctx = status.Start(ctx, "vulkan.PassUploads")
+	defer status.Finish(ctx)
+	u := &passUploads{res: []replay.PassUploads{}}
+	err := analyzeCapture(ctx, c, nil, u.observe)
+	return u.res, err
+}
+
+// passUploads collects the uploads of the render passes of the submitted
+// command buffers.
+type passUploads struct {
+	res []replay.PassUploads
+}
+
+func (u *passUploads) observe(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error {
+	submit, ok := cmd.(*VkQueueSubmit)
+	if !ok {
+		return nil
+	}
+	l := s.MemoryLayout
+	st := GetState(s)
+	submits, err := submit.PSubmits().Slice(0, uint64(submit.SubmitCount()), l).Read(ctx, submit, s, nil)
+	if err != nil {
+		return err
+	}
+	for i, info := range submits {
+		buffers, err := info.PCommandBuffers().Slice(0, uint64(info.CommandBufferCount()), l).Read(ctx, submit, s, nil)
+		if err != nil {
+			return err
+		}
+		for j, buffer := range buffers {
+			idx := api.SubCmdIdx{uint64(id), uint64(i), uint64(j)}
+			u.res = append(u.res, commandBufferUploads(ctx, st, st.CommandBuffers().Get(buffer), idx)...)
+		}
+	}
+	return nil
+}
+
+// passState is the render pass being recorded in a command buffer, along
+// with the state needed to tell whether it only writes depth or stencil.
+type passState struct {
+	replay.PassUploads
+	// The graphics pipeline bound for the draws.
+	pipeline GraphicsPipelineObjectʳ
+	// Whether the render pass has a depth/stencil attachment, has a color
+	// attachment, and whether any of its draws writes color.
+	depth, color, writesColor bool
+}
+
+// commandBufferUploads returns the uploads of the render passes of the
+// primary command buffer with the given index.
+func commandBufferUploads(ctx context.Context, st *State, cb CommandBufferObjectʳ, idx api.SubCmdIdx) []replay.PassUploads {
+	res := []replay.PassUploads{}
+	pass := passState{}
+	for i := 0; i < cb.CommandReferences().Len(); i++ {
+		cmdIdx := append(append(api.SubCmdIdx{}, idx...), uint64(i))
+		switch args := GetCommandArgs(ctx, cb.CommandReferences().Get(uint32(i)), st).(type) {
+		case VkCmdBeginRenderPassArgsʳ:
+			pass.From = cmdIdx
+			beginPass(st, args, &pass)
+		case VkCmdEndRenderPassArgsʳ:
+			pass.To = cmdIdx
+			pass.DepthOnly = pass.depth && pass.Draws > 0 && !pass.writesColor
+			res = append(res, pass.PassUploads)
+			pass = passState{pipeline: pass.pipeline}
+		case VkCmdExecuteCommandsArgsʳ:
+			for j := 0; j < args.CommandBuffers().Len(); j++ {
+				secondaryIdx := append(append(api.SubCmdIdx{}, cmdIdx...), uint64(j))
+				secondaryUploads(ctx, st, st.CommandBuffers().Get(args.CommandBuffers().Get(uint32(j))), secondaryIdx, &pass)
+			}
+		default:
+			addUploads(st, args, cmdIdx, &pass)
+		}
+	}
+	return res
+}
+
+// beginPass sets the render area and the attachments of the render pass
+// begun with the given arguments.
+func beginPass(st *State, args VkCmdBeginRenderPassArgsʳ, pass *passState) {
+	extent := args.RenderArea().Extent()
+	pass.Pixels = uint64(extent.Width()) * uint64(extent.Height())
+	if !st.RenderPasses().Contains(args.RenderPass()) {
+		return
+	}
+	for _, subpass := range st.RenderPasses().Get(args.RenderPass()).SubpassDescriptions().All() {
+		if ds := subpass.DepthStencilAttachment(); !ds.IsNil() && ds.Attachment() != VK_ATTACHMENT_UNUSED {
+			pass.depth = true
+		}
+		for _, color := range subpass.ColorAttachments().All() {
+			if color.Attachment() != VK_ATTACHMENT_UNUSED {
+				pass.color = true
+			}
+		}
+	}
+}
+
+// secondaryUploads adds the uploads of the secondary command buffer with the
+// given index to the pass.
+func secondaryUploads(ctx context.Context, st *State, cb CommandBufferObjectʳ, idx api.SubCmdIdx, pass *passState) {
+	for i := 0; i < cb.CommandReferences().Len(); i++ {
+		cmdIdx := append(append(api.SubCmdIdx{}, idx...), uint64(i))
+		addUploads(st, GetCommandArgs(ctx, cb.CommandReferences().Get(uint32(i)), st), cmdIdx, pass)
+	}
+}
+
+// addUploads adds the data uploaded, or the draw made, by the recorded
+// command with the given arguments and index to the pass.
+func addUploads(st *State, args interface{}, cmdIdx api.SubCmdIdx, pass *passState) {
+	switch args := args.(type) {
+	case VkCmdPushConstantsArgsʳ:
+		pass.Constants += uint64(args.Size())
+		pass.PushConstants++
+	case VkCmdUpdateBufferArgsʳ:
+		addBufferUpload(st, args.DstBuffer(), uint64(args.DataSize()), &pass.PassUploads)
+	case VkCmdCopyBufferArgsʳ:
+		for _, region := range args.CopyRegions().All() {
+			addBufferUpload(st, args.DstBuffer(), uint64(region.Size()), &pass.PassUploads)
+		}
+	case VkCmdBindPipelineArgsʳ:
+		if args.PipelineBindPoint() != VkPipelineBindPoint_VK_PIPELINE_BIND_POINT_GRAPHICS {
+			break
+		}
+		if st.GraphicsPipelines().Contains(args.Pipeline()) {
+			pass.pipeline = st.GraphicsPipelines().Get(args.Pipeline())
+		} else {
+			pass.pipeline = NilGraphicsPipelineObjectʳ
+		}
+	case VkCmdDrawArgsʳ:
+		addDraw(cmdIdx, args.VertexCount(), args.InstanceCount(), pass)
+	case VkCmdDrawIndexedArgsʳ:
+		addDraw(cmdIdx, args.IndexCount(), args.InstanceCount(), pass)
+	case VkCmdDrawIndirectArgsʳ, VkCmdDrawIndexedIndirectArgsʳ:
+		// The vertex counts of the indirect draws are only known on the GPU.
+		addDraw(cmdIdx, 0, 0, pass)
+	}
+}
+
+// addDraw adds the draw with the given index, vertex and instance counts to
+// the pass. Draws without a known pipeline are assumed to write color.
+func addDraw(cmdIdx api.SubCmdIdx, vertices, instances uint32, pass *passState) {
+	pass.Draws++
+	pass.DrawCmds = append(pass.DrawCmds, cmdIdx)
+	if pass.pipeline.IsNil() {
+		pass.writesColor = pass.writesColor || pass.color
+		return
+	}
+	pass.writesColor = pass.writesColor || pass.color && writesColor(pass.pipeline)
+	pass.Primitives += primitives(pass.pipeline, vertices) * uint64(instances)
+}
+
+// writesColor returns whether the draws of the graphics pipeline write a
+// color attachment: they are rasterized, shaded by a fragment shader and
+// their color write mask is not empty.
+func writesColor(p GraphicsPipelineObjectʳ) bool {
+	if p.RasterizationState().RasterizerDiscardEnable() != 0 {
+		return false
+	}
+	fragment := false
+	for _, stage := range p.Stages().All() {
+		if stage.Stage() == VkShaderStageFlagBits_VK_SHADER_STAGE_FRAGMENT_BIT {
+			fragment = true
+		}
+	}
+	if !fragment || p.ColorBlendState().IsNil() {
+		return false
+	}
+	for _, attachment := range p.ColorBlendState().Attachments().All() {
+		if attachment.ColorWriteMask() != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// primitives returns the number of primitives assembled from the vertices of
+// an instance of a draw with the graphics pipeline.
+func primitives(p GraphicsPipelineObjectʳ, vertices uint32) uint64 {
+	n := uint64(vertices)
+	atLeast := func(min, count uint64) uint64 {
+		if n < min {
+			return 0
+		}
+		return count
+	}
+	switch p.InputAssemblyState().Topology() {
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_POINT_LIST:
+		return n
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_LINE_LIST:
+		return n / 2
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_LINE_STRIP:
+		return atLeast(2, n-1)
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_TRIANGLE_LIST:
+		return n / 3
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_TRIANGLE_STRIP,
+		VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_TRIANGLE_FAN:
+		return atLeast(3, n-2)
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_LINE_LIST_WITH_ADJACENCY:
+		return n / 4
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_LINE_STRIP_WITH_ADJACENCY:
+		return atLeast(4, n-3)
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_TRIANGLE_LIST_WITH_ADJACENCY:
+		return n / 6
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_TRIANGLE_STRIP_WITH_ADJACENCY:
+		return atLeast(6, (n-4)/2)
+	case VkPrimitiveTopology_VK_PRIMITIVE_TOPOLOGY_PATCH_LIST:
+		if ts := p.TessellationState(); !ts.IsNil() && ts.PatchControlPoints() > 0 {
+			return n / uint64(ts.PatchControlPoints())
+		}
+	}
+	return 0
+}
+
+// addBufferUpload adds the size of an update of the buffer to the pass, by
+// the usage of the buffer.
+func addBufferUpload(st *State, buffer VkBuffer, size uint64, pass *replay.PassUploads) {
+	if !st.Buffers().Contains(buffer) {
+		return
+	}
+	usage := uint32(st.Buffers().Get(buffer).Info().Usage())
+	switch {
+	case usage&uint32(VkBufferUsageFlagBits_VK_BUFFER_USAGE_UNIFORM_BUFFER_BIT) != 0:
+		pass.Constants += size
+	case usage&uint32(VkBufferUsageFlagBits_VK_BUFFER_USAGE_INDEX_BUFFER_BIT) != 0:
+		pass.Indices += size
+	case usage&uint32(VkBufferUsageFlagBits_VK_BUFFER_USAGE_VERTEX_BUFFER_BIT) != 0:
+		pass.Vertices += size
+	}
+}
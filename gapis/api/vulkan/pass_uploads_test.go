@@ -0,0 +1,108 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/replay"
+)
+
+func TestPassUploads(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	st := GetState(s)
+
+	buffer := func(handle VkBuffer, usage VkBufferUsageFlagBits) {
+		info := MakeBufferInfo()
+		info.SetUsage(VkBufferUsageFlags(usage))
+		obj := MakeBufferObjectʳ()
+		obj.SetVulkanHandle(handle)
+		obj.SetInfo(info)
+		st.Buffers().Add(handle, obj)
+	}
+	buffer(1, VkBufferUsageFlagBits_VK_BUFFER_USAGE_UNIFORM_BUFFER_BIT)
+	buffer(2, VkBufferUsageFlagBits_VK_BUFFER_USAGE_VERTEX_BUFFER_BIT)
+
+	update := func(buffer VkBuffer, size VkDeviceSize) VkCmdUpdateBufferArgsʳ {
+		args := MakeVkCmdUpdateBufferArgsʳ()
+		args.SetDstBuffer(buffer)
+		args.SetDataSize(size)
+		return args
+	}
+	begin := func(width, height uint32) VkCmdBeginRenderPassArgsʳ {
+		args := MakeVkCmdBeginRenderPassArgsʳ()
+		args.SetRenderArea(NewVkRect2D(MakeVkOffset2D(), NewVkExtent2D(width, height)))
+		return args
+	}
+	push := func(size uint32) VkCmdPushConstantsArgsʳ {
+		args := MakeVkCmdPushConstantsArgsʳ()
+		args.SetSize(size)
+		return args
+	}
+	draw := func() VkCmdDrawArgsʳ {
+		args := MakeVkCmdDrawArgsʳ()
+		args.SetVertexCount(3)
+		args.SetInstanceCount(1)
+		return args
+	}
+	execute := MakeVkCmdExecuteCommandsArgsʳ()
+	execute.CommandBuffers().Add(0, VkCommandBuffer(2))
+
+	// The uniform buffer update before the first pass and the push constants
+	// of the secondary command buffer are attributed to the first pass, the
+	// vertex buffer update to the second.
+	recordCommands(st, 1,
+		update(1, 16),
+		begin(64, 32),
+		push(8),
+		draw(),
+		execute,
+		MakeVkCmdEndRenderPassArgsʳ(),
+		update(2, 32),
+		begin(16, 16),
+		MakeVkCmdEndRenderPassArgsʳ(),
+	)
+	recordCommands(st, 2, push(4), draw())
+
+	u := &passUploads{res: []replay.PassUploads{}}
+	submit := queueSubmit(ctx, s, VkQueue(1), testBatch{buffers: []VkCommandBuffer{1}})
+	err := u.observe(ctx, 10, submit, s)
+	assert.For(ctx, "observe").ThatError(err).Succeeded()
+
+	assert.For(ctx, "uploads").ThatSlice(u.res).DeepEquals([]replay.PassUploads{
+		{
+			From:          api.SubCmdIdx{10, 0, 0, 1},
+			To:            api.SubCmdIdx{10, 0, 0, 5},
+			Constants:     28,
+			PushConstants: 2,
+			Draws:         2,
+			DrawCmds:      []api.SubCmdIdx{{10, 0, 0, 3}, {10, 0, 0, 4, 0, 1}},
+			Pixels:        64 * 32,
+		},
+		{
+			From:     api.SubCmdIdx{10, 0, 0, 7},
+			To:       api.SubCmdIdx{10, 0, 0, 8},
+			Vertices: 32,
+			Pixels:   16 * 16,
+		},
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var _ = replay.QueueAnalyzer(API{})
+
+// queueFamilyIgnored is VK_QUEUE_FAMILY_IGNORED.
+const queueFamilyIgnored = ^uint32(0)
+
+// ownedResource is a buffer or image whose queue family ownership can be
+// transferred.
+type ownedResource struct {
+	image  bool
+	handle uint64
+}
+
+// QueueDependencies returns the batches of the queue submissions of the
+// capture, with the submissions to other queues they depend on: the
+// submissions signalling the semaphores they wait on, and the submissions
+// releasing the queue family ownership of the resources they acquire, from
+// the barriers of their command buffers, including secondary command buffers.
+func (API) QueueDependencies(ctx context.Context, c *path.Capture) ([]replay.QueueSubmission, error) {
+	ctx = status.Start(ctx, "vulkan.QueueDependencies")
+	defer status.Finish(ctx)
+	q := newQueueDependencies()
+	err := analyzeCapture(ctx, c, nil, q.observe)
+	return q.res, err
+}
+
+// queueDependencies collects the batches of the queue submissions and their
+// dependencies.
+type queueDependencies struct {
+	res []replay.QueueSubmission
+	// The batches that last signalled each semaphore, and released the
+	// ownership of each resource, by index.
+	signals  map[VkSemaphore]int
+	releases map[ownedResource]int
+	frame    int
+}
+
+func newQueueDependencies() *queueDependencies {
+	return &queueDependencies{
+		res:      []replay.QueueSubmission{},
+		signals:  map[VkSemaphore]int{},
+		releases: map[ownedResource]int{},
+	}
+}
+
+func (q *queueDependencies) observe(ctx context.Context, id api.CmdID, cmd api.Cmd, s *api.GlobalState) error {
+	switch cmd := cmd.(type) {
+	case *VkQueuePresentKHR:
+		q.frame++
+	case *VkQueueSubmit:
+		l := s.MemoryLayout
+		st := GetState(s)
+		family := st.Queues().Get(cmd.Queue()).Family()
+		submits, err := cmd.PSubmits().Slice(0, uint64(cmd.SubmitCount()), l).Read(ctx, cmd, s, nil)
+		if err != nil {
+			return err
+		}
+		for i, info := range submits {
+			idx := len(q.res)
+			sub := replay.QueueSubmission{
+				Submit: api.SubCmdIdx{uint64(id), uint64(i)},
+				Frame:  q.frame,
+				Queue:  uint64(cmd.Queue()),
+			}
+			waits, err := info.PWaitSemaphores().Slice(0, uint64(info.WaitSemaphoreCount()), l).Read(ctx, cmd, s, nil)
+			if err != nil {
+				return err
+			}
+			for _, sem := range waits {
+				if j, ok := q.signals[sem]; ok && q.res[j].Queue != sub.Queue {
+					sub.Waits = append(sub.Waits, j)
+				}
+			}
+			buffers, err := info.PCommandBuffers().Slice(0, uint64(info.CommandBufferCount()), l).Read(ctx, cmd, s, nil)
+			if err != nil {
+				return err
+			}
+			t := ownershipTransfers{family: family}
+			for _, buffer := range buffers {
+				t.addCommandBuffer(ctx, st, st.CommandBuffers().Get(buffer))
+			}
+			for _, r := range t.released {
+				q.releases[r] = idx
+			}
+			acquired := map[int]bool{}
+			for _, r := range t.acquired {
+				if j, ok := q.releases[r]; ok && q.res[j].Queue != sub.Queue {
+					sub.Transfers++
+					if !acquired[j] {
+						acquired[j] = true
+						sub.Acquires = append(sub.Acquires, j)
+					}
+				}
+			}
+			signalled, err := info.PSignalSemaphores().Slice(0, uint64(info.SignalSemaphoreCount()), l).Read(ctx, cmd, s, nil)
+			if err != nil {
+				return err
+			}
+			for _, sem := range signalled {
+				q.signals[sem] = idx
+			}
+			q.res = append(q.res, sub)
+		}
+	}
+	return nil
+}
+
+// ownershipTransfers collects the resources released and acquired by the
+// barriers of the command buffers submitted to a queue of the family.
+type ownershipTransfers struct {
+	family             uint32
+	released, acquired []ownedResource
+}
+
+func (t *ownershipTransfers) addCommandBuffer(ctx context.Context, st *State, cb CommandBufferObjectʳ) {
+	for i := 0; i < cb.CommandReferences().Len(); i++ {
+		switch args := GetCommandArgs(ctx, cb.CommandReferences().Get(uint32(i)), st).(type) {
+		case VkCmdPipelineBarrierArgsʳ:
+			t.addBarriers(args.BufferMemoryBarriers(), args.ImageMemoryBarriers())
+		case VkCmdWaitEventsArgsʳ:
+			t.addBarriers(args.BufferMemoryBarriers(), args.ImageMemoryBarriers())
+		case VkCmdExecuteCommandsArgsʳ:
+			for j := 0; j < args.CommandBuffers().Len(); j++ {
+				t.addCommandBuffer(ctx, st, st.CommandBuffers().Get(args.CommandBuffers().Get(uint32(j))))
+			}
+		}
+	}
+}
+
+func (t *ownershipTransfers) addBarriers(buffers U32ːVkBufferMemoryBarrierᵐ, images U32ːVkImageMemoryBarrierᵐ) {
+	for _, b := range buffers.All() {
+		t.add(ownedResource{false, uint64(b.Buffer())}, b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex())
+	}
+	for _, b := range images.All() {
+		t.add(ownedResource{true, uint64(b.Image())}, b.SrcQueueFamilyIndex(), b.DstQueueFamilyIndex())
+	}
+}
+
+// add adds the resource of a barrier if the barrier transfers its ownership
+// from or to the queue family.
+func (t *ownershipTransfers) add(r ownedResource, src, dst uint32) {
+	if src == dst || src == queueFamilyIgnored || dst == queueFamilyIgnored {
+		return
+	}
+	switch t.family {
+	case src:
+		t.released = append(t.released, r)
+	case dst:
+		t.acquired = append(t.acquired, r)
+	}
+}
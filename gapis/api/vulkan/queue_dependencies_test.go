@@ -0,0 +1,90 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/database"
+	"github.com/google/gapid/gapis/memory"
+	"github.com/google/gapid/gapis/replay"
+)
+
+func TestQueueDependencies(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+	st := GetState(s)
+
+	// Queue 1 is of family 0, queue 2 of family 1.
+	for handle, family := range map[VkQueue]uint32{1: 0, 2: 1} {
+		queue := MakeQueueObjectʳ()
+		queue.SetVulkanHandle(handle)
+		queue.SetFamily(family)
+		st.Queues().Add(handle, queue)
+	}
+
+	// Both command buffers transfer the ownership of buffer 5 from family 0
+	// to family 1. Command buffer 2 also transitions image 6, without a
+	// transfer.
+	transfer := MakeVkBufferMemoryBarrier()
+	transfer.SetSrcQueueFamilyIndex(0)
+	transfer.SetDstQueueFamilyIndex(1)
+	transfer.SetBuffer(VkBuffer(5))
+	release := MakeVkCmdPipelineBarrierArgsʳ()
+	release.BufferMemoryBarriers().Add(0, transfer)
+	recordCommands(st, 1, release)
+	transition := MakeVkImageMemoryBarrier()
+	transition.SetSrcQueueFamilyIndex(queueFamilyIgnored)
+	transition.SetDstQueueFamilyIndex(queueFamilyIgnored)
+	transition.SetImage(VkImage(6))
+	acquire := MakeVkCmdPipelineBarrierArgsʳ()
+	acquire.BufferMemoryBarriers().Add(0, transfer)
+	acquire.ImageMemoryBarriers().Add(0, transition)
+	recordCommands(st, 2, acquire)
+
+	cmds := []api.Cmd{
+		queueSubmit(ctx, s, VkQueue(1), testBatch{
+			signals: []VkSemaphore{1},
+			buffers: []VkCommandBuffer{1},
+		}),
+		queueSubmit(ctx, s, VkQueue(2), testBatch{
+			waits:   []VkSemaphore{1},
+			buffers: []VkCommandBuffer{2},
+		}),
+		CommandBuilder{}.VkQueuePresentKHR(VkQueue(1), memory.Nullptr, VkResult_VK_SUCCESS),
+		// Waits on a semaphore signalled by the same queue are not
+		// cross-queue dependencies.
+		queueSubmit(ctx, s, VkQueue(1), testBatch{}, testBatch{
+			waits: []VkSemaphore{1},
+		}),
+	}
+	q := newQueueDependencies()
+	for i, cmd := range cmds {
+		err := q.observe(ctx, api.CmdID(i), cmd, s)
+		assert.For(ctx, "observe %d", i).ThatError(err).Succeeded()
+	}
+
+	assert.For(ctx, "submissions").ThatSlice(q.res).DeepEquals([]replay.QueueSubmission{
+		{Submit: api.SubCmdIdx{0, 0}, Frame: 0, Queue: 1},
+		{Submit: api.SubCmdIdx{1, 0}, Frame: 0, Queue: 2, Waits: []int{0}, Acquires: []int{0}, Transfers: 1},
+		{Submit: api.SubCmdIdx{3, 0}, Frame: 1, Queue: 1},
+		{Submit: api.SubCmdIdx{3, 1}, Frame: 1, Queue: 1},
+	})
+}
@@ -163,6 +163,12 @@ func (a API) Replay(
 
 		loopStart := numOfInitialCmds
 		loopEnd := api.CmdID(len(initialCmds) + len(c.Commands) - 1)
+		// Only the selected range is looped over and traced, the commands
+		// before it establish its state.
+		if r := request.experiments.Range; r.Length() > 0 {
+			loopStart = numOfInitialCmds + r.Start
+			loopEnd = numOfInitialCmds + r.Last()
+		}
 		nullWriterObj := nullWriter{state: cloneStateWithSharedAllocator(ctx, c, out.State())}
 		chain := transform.CreateTransformChain(ctx, cmdGenerator, transforms, nullWriterObj)
 		loopCallbacks := getPerfettoLoopCallbacks(request.traceOptions, request.handler, request.buffer)
@@ -316,6 +322,18 @@ func getProfileTransforms(ctx context.Context,
 		transforms = append(transforms, newAfDisablerTransform())
 	}
 
+	if s := request.experiments.ResolutionScale; s > 0 && s != 1 {
+		transforms = append(transforms, newResolutionScaleTransform(s))
+	}
+
+	if e := request.experiments; e.LodBias != 0 || e.NearestFiltering {
+		transforms = append(transforms, newSamplerOverrideTransform(e.LodBias, e.NearestFiltering))
+	}
+
+	if e := request.experiments; e.ShadingRateWidth > 0 && e.ShadingRateHeight > 0 {
+		transforms = append(transforms, newShadingRateTransform(e.ShadingRateWidth, e.ShadingRateHeight, e.ShadingRatePasses, device))
+	}
+
 	var err error
 	if len(request.experiments.DisabledCmds) > 0 {
 		disablerTransform := newCommandDisabler(ctx, uint64(numOfInitialCmds))
@@ -326,6 +344,12 @@ func getProfileTransforms(ctx context.Context,
 		transforms = append(transforms, disablerTransform)
 	}
 
+	// The timestamps are queried around the command buffers as submitted,
+	// after the other transforms modified them.
+	if request.experiments.CalibrateTimestamps {
+		transforms = append(transforms, newQueryTimestamps(ctx, request.timestamps))
+	}
+
 	transforms = append(transforms, profileTransform)
 	return transforms, err
 }
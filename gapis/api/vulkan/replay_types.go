@@ -18,8 +18,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/google/gapid/core/image"
+	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/resolve"
@@ -94,6 +96,9 @@ type profileRequest struct {
 	handleMappings map[uint64][]service.VulkanHandleMappingItem
 	experiments    replay.ProfileExperiments
 	loopCount      int32
+	// timestamps receives the timestamps of the command buffers, if
+	// experiments.CalibrateTimestamps is set.
+	timestamps service.TimeStampsHandler
 }
 
 func (a API) QueryFramebufferAttachment(
@@ -191,7 +196,15 @@ func (a API) QueryProfile(
 	handler := replay.NewSignalHandler()
 	var buffer bytes.Buffer
 	handleMappings := map[uint64][]service.VulkanHandleMappingItem{}
-	r := profileRequest{traceOptions, handler, &buffer, handleMappings, experiments, loopCount}
+	var timestampsMutex sync.Mutex
+	timestamps := []*service.TimestampsItem{}
+	timestampsHandler := func(res *service.GetTimestampsResponse) error {
+		timestampsMutex.Lock()
+		defer timestampsMutex.Unlock()
+		timestamps = append(timestamps, res.GetTimestamps().GetTimestamps()...)
+		return nil
+	}
+	r := profileRequest{traceOptions, handler, &buffer, handleMappings, experiments, loopCount, timestampsHandler}
 	_, err := mgr.Replay(ctx, intent, c, r, a, hints, true)
 	if err != nil {
 		return nil, err
@@ -204,5 +217,16 @@ func (a API) QueryProfile(
 	}
 
 	d, err := trace.ProcessProfilingData(ctx, intent.Device, intent.Capture, &buffer, handleMappings, s)
-	return d, err
+	if err != nil {
+		return nil, err
+	}
+	if experiments.CalibrateTimestamps {
+		timestampsMutex.Lock()
+		defer timestampsMutex.Unlock()
+		d.ClockCalibration = replay.CalibrateClock(d, timestamps)
+		if d.ClockCalibration == nil {
+			log.W(ctx, "None of the %d timed command buffers could be matched to the trace", len(timestamps))
+		}
+	}
+	return d, nil
 }
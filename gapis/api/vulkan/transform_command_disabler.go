@@ -54,7 +54,9 @@ func newCommandDisabler(ctx context.Context, cmdsOffset uint64) *commandDisabler
 	}
 }
 
-// Remove removes a draw call command from a command buffer.
+// Remove removes a draw call command from a command buffer, or a whole
+// command buffer from a submission if the id is that of a command buffer,
+// i.e. [submit, submit info, command buffer].
 func (disablerTransform *commandDisabler) remove(ctx context.Context, id api.SubCmdIdx) error {
 	if disablerTransform.mutationStarted {
 		return log.Err(ctx, nil, "Commands cannot be requested to disable after mutation started")
@@ -209,6 +211,12 @@ func (disablerTransform *commandDisabler) removeCommandFromSubmit(ctx context.Co
 
 	for i, commandBuffer := range commandBuffers {
 		currentSubCmdID := append(idx, uint64(i))
+		if disablerTransform.shouldBeDisabled(currentSubCmdID) {
+			// Drop the whole command buffer from the submission.
+			disablerTransform.removeFromDisabledList(currentSubCmdID)
+			log.I(ctx, "Command buffer %v disabled", append(api.SubCmdIdx{currentSubCmdID[0] - disablerTransform.cmdsOffset}, currentSubCmdID[1:]...))
+			continue
+		}
 		if !disablerTransform.doesContainDisabledCmd(currentSubCmdID) {
 			newCommandBuffers = append(newCommandBuffers, commandBuffer)
 			continue
@@ -223,20 +231,22 @@ func (disablerTransform *commandDisabler) removeCommandFromSubmit(ctx context.Co
 		newCommandBuffers = append(newCommandBuffers, newCommandBuffer)
 	}
 
-	if len(newCommandBuffers) != len(commandBuffers) {
-		return VkSubmitInfo{}, log.Err(ctx, nil, "Number of command buffers changed")
+	// A submission whose command buffers were all disabled still waits on and
+	// signals its semaphores.
+	pCommandBuffers := NewVkCommandBufferᶜᵖ(memory.Nullptr)
+	if len(newCommandBuffers) > 0 {
+		newCbs := disablerTransform.mustAllocReadDataForSubmit(ctx, inputState, newCommandBuffers)
+		pCommandBuffers = NewVkCommandBufferᶜᵖ(newCbs.Ptr())
 	}
 
-	newCbs := disablerTransform.mustAllocReadDataForSubmit(ctx, inputState, newCommandBuffers)
-
 	newSubmitInfo := MakeVkSubmitInfo()
 	newSubmitInfo.SetSType(submitInfo.SType())
 	newSubmitInfo.SetPNext(submitInfo.PNext())
 	newSubmitInfo.SetWaitSemaphoreCount(submitInfo.WaitSemaphoreCount())
 	newSubmitInfo.SetPWaitSemaphores(submitInfo.PWaitSemaphores())
 	newSubmitInfo.SetPWaitDstStageMask(submitInfo.PWaitDstStageMask())
-	newSubmitInfo.SetCommandBufferCount(submitInfo.CommandBufferCount())
-	newSubmitInfo.SetPCommandBuffers(NewVkCommandBufferᶜᵖ(newCbs.Ptr()))
+	newSubmitInfo.SetCommandBufferCount(uint32(len(newCommandBuffers)))
+	newSubmitInfo.SetPCommandBuffers(pCommandBuffers)
 	newSubmitInfo.SetSignalSemaphoreCount(submitInfo.SignalSemaphoreCount())
 	newSubmitInfo.SetPSignalSemaphores(submitInfo.PSignalSemaphores())
 	return newSubmitInfo, nil
@@ -0,0 +1,98 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/database"
+)
+
+func TestCommandDisablerDisablesCommandBuffers(t *testing.T) {
+	ctx := log.Testing(t)
+	ctx = database.Put(ctx, database.NewInMemory(ctx))
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+
+	// A submission of three command buffers, at command 10.
+	cbs := s.AllocDataOrPanic(ctx, []VkCommandBuffer{1, 2, 3})
+	info := s.AllocDataOrPanic(ctx, NewVkSubmitInfo(
+		VkStructureType_VK_STRUCTURE_TYPE_SUBMIT_INFO, // sType
+		0,                               // pNext
+		0,                               // waitSemaphoreCount
+		0,                               // pWaitSemaphores
+		0,                               // pWaitDstStageMask
+		3,                               // commandBufferCount
+		NewVkCommandBufferᶜᵖ(cbs.Ptr()), // pCommandBuffers
+		0,                               // signalSemaphoreCount
+		0,                               // pSignalSemaphores
+	))
+	submit := CommandBuilder{}.VkQueueSubmit(VkQueue(1), 1, info.Ptr(), VkFence(0), VkResult_VK_SUCCESS)
+	submit.AddRead(cbs.Data()).AddRead(info.Data())
+
+	written := []api.Cmd{}
+	disabler := newCommandDisabler(ctx, 0)
+	disabler.SetInnerStateMutationFunction(func(cmds []api.Cmd) error {
+		written = append(written, cmds...)
+		return nil
+	})
+	err := disabler.remove(ctx, api.SubCmdIdx{10, 0, 1})
+	assert.For(ctx, "remove").ThatError(err).Succeeded()
+
+	err = disabler.BeginTransform(ctx, s)
+	assert.For(ctx, "begin").ThatError(err).Succeeded()
+	_, err = disabler.TransformCommand(ctx, transform.NewTransformCommandID(10), []api.Cmd{submit}, s)
+	assert.For(ctx, "transform").ThatError(err).Succeeded()
+	_, err = disabler.EndTransform(ctx, s)
+	assert.For(ctx, "all disabled").ThatError(err).Succeeded()
+	defer disabler.ClearTransformResources(ctx)
+
+	if !assert.For(ctx, "written").That(len(written)).Equals(1) {
+		return
+	}
+	newSubmit, ok := written[0].(*VkQueueSubmit)
+	if !assert.For(ctx, "submit").That(ok).Equals(true) {
+		return
+	}
+	infos, err := newSubmit.PSubmits().Slice(0, uint64(newSubmit.SubmitCount()), s.MemoryLayout).Read(ctx, newSubmit, s, nil)
+	assert.For(ctx, "read infos").ThatError(err).Succeeded()
+	if !assert.For(ctx, "infos").That(len(infos)).Equals(1) {
+		return
+	}
+	count := infos[0].CommandBufferCount()
+	assert.For(ctx, "count").That(count).Equals(uint32(2))
+	buffers, err := infos[0].PCommandBuffers().Slice(0, uint64(count), s.MemoryLayout).Read(ctx, newSubmit, s, nil)
+	assert.For(ctx, "read buffers").ThatError(err).Succeeded()
+	assert.For(ctx, "buffers").ThatSlice(buffers).Equals([]VkCommandBuffer{1, 3})
+}
+
+func TestCommandDisablerReportsMissingCommandBuffers(t *testing.T) {
+	ctx := log.Testing(t)
+	s := api.NewStateWithEmptyAllocator(device.Little32)
+
+	disabler := newCommandDisabler(ctx, 0)
+	disabler.SetInnerStateMutationFunction(func([]api.Cmd) error { return nil })
+	disabler.remove(ctx, api.SubCmdIdx{10, 0, 1})
+	disabler.BeginTransform(ctx, s)
+	defer disabler.ClearTransformResources(ctx)
+
+	// No command was transformed, so the command buffer was never disabled.
+	_, err := disabler.EndTransform(ctx, s)
+	assert.For(ctx, "missing").ThatError(err).Failed()
+}
@@ -42,6 +42,17 @@ type mappingHandle struct {
 	name          string
 }
 
+// submittedHandle identifies a trace handle by its type name and value.
+type submittedHandle struct {
+	name  string
+	value uint64
+}
+
+// commandRange is a range of capture command indices, [begin, end).
+type commandRange struct {
+	begin, end uint64
+}
+
 type mappingExporter struct {
 	mappings         map[uint64][]service.VulkanHandleMappingItem
 	thread           uint64
@@ -50,6 +61,8 @@ type mappingExporter struct {
 	notificationID   uint64
 	usedFrameBuffers map[uint64]struct{}
 	numOfInitialCmds uint64
+	// The submissions of each handle, a range per submitting command.
+	validity map[submittedHandle][]commandRange
 }
 
 func newMappingExporter(ctx context.Context, numOfInitialCmds uint64, mappings map[uint64][]service.VulkanHandleMappingItem) *mappingExporter {
@@ -57,6 +70,7 @@ func newMappingExporter(ctx context.Context, numOfInitialCmds uint64, mappings m
 		mappings:         mappings,
 		usedFrameBuffers: map[uint64]struct{}{},
 		numOfInitialCmds: numOfInitialCmds,
+		validity:         map[submittedHandle][]commandRange{},
 	}
 }
 
@@ -67,6 +81,7 @@ func newMappingExporterWithPrint(ctx context.Context, path string) *mappingExpor
 		path:           path,
 		traceValues:    make([]mappingHandle, 0, 0),
 		notificationID: 0,
+		validity:       map[submittedHandle][]commandRange{},
 	}
 }
 
@@ -109,9 +124,10 @@ func (mappingTransform *mappingExporter) TransformCommand(ctx context.Context, i
 	// But it does reduces chance to hit the case by not mapping the framebuffer used in
 	// initialCmds.
 	if uint64(id.GetID()) >= mappingTransform.numOfInitialCmds {
+		captureCmd := uint64(id.GetID()) - mappingTransform.numOfInitialCmds
 		for _, cmd := range inputCommands {
 			if queueSubmit, ok := cmd.(*VkQueueSubmit); ok {
-				if err := mappingTransform.recordFramebuffersInSubmittedRenderPasses(ctx, queueSubmit, inputState); err != nil {
+				if err := mappingTransform.recordSubmittedHandles(ctx, captureCmd, queueSubmit, inputState); err != nil {
 					return nil, err
 				}
 			}
@@ -121,8 +137,9 @@ func (mappingTransform *mappingExporter) TransformCommand(ctx context.Context, i
 	return inputCommands, nil
 }
 
-// Record the framebuffers used in the renderpasses that actually submitted to GPU.
-func (mappingTransform *mappingExporter) recordFramebuffersInSubmittedRenderPasses(ctx context.Context, cmd *VkQueueSubmit, inputState *api.GlobalState) error {
+// Record the framebuffers used in the renderpasses that actually submitted to GPU, and the
+// commands submitting the command buffers, render passes, framebuffers and descriptor sets.
+func (mappingTransform *mappingExporter) recordSubmittedHandles(ctx context.Context, captureCmd uint64, cmd *VkQueueSubmit, inputState *api.GlobalState) error {
 	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
 	layout := inputState.MemoryLayout
 	stateObj := GetState(inputState)
@@ -139,12 +156,19 @@ func (mappingTransform *mappingExporter) recordFramebuffersInSubmittedRenderPass
 		}
 
 		for _, cmdBuffer := range commandBuffers {
+			mappingTransform.recordSubmission("VkCommandBuffer", uint64(cmdBuffer), captureCmd)
 			cmdBufferObj := GetState(inputState).CommandBuffers().Get(cmdBuffer)
 			for cmdIndex := 0; cmdIndex < cmdBufferObj.CommandReferences().Len(); cmdIndex++ {
 				currentCmd := cmdBufferObj.CommandReferences().Get(uint32(cmdIndex))
-				args := GetCommandArgs(ctx, currentCmd, stateObj)
-				if beginRenderPassArgs, ok := args.(VkCmdBeginRenderPassArgsʳ); ok {
-					mappingTransform.usedFrameBuffers[uint64(beginRenderPassArgs.Framebuffer())] = struct{}{}
+				switch args := GetCommandArgs(ctx, currentCmd, stateObj).(type) {
+				case VkCmdBeginRenderPassArgsʳ:
+					mappingTransform.usedFrameBuffers[uint64(args.Framebuffer())] = struct{}{}
+					mappingTransform.recordSubmission("VkFramebuffer", uint64(args.Framebuffer()), captureCmd)
+					mappingTransform.recordSubmission("VkRenderPass", uint64(args.RenderPass()), captureCmd)
+				case VkCmdBindDescriptorSetsArgsʳ:
+					for _, set := range args.DescriptorSets().All() {
+						mappingTransform.recordSubmission("VkDescriptorSet", uint64(set), captureCmd)
+					}
 				}
 			}
 		}
@@ -153,6 +177,18 @@ func (mappingTransform *mappingExporter) recordFramebuffersInSubmittedRenderPass
 	return nil
 }
 
+// recordSubmission adds the submitting command to the validity of the handle.
+// The handle is only valid at its submissions, not in between them, as the
+// driver may reuse the handle for other objects meanwhile.
+func (mappingTransform *mappingExporter) recordSubmission(name string, traceValue uint64, captureCmd uint64) {
+	key := submittedHandle{name, traceValue}
+	ranges := mappingTransform.validity[key]
+	if n := len(ranges); n > 0 && ranges[n-1].begin == captureCmd {
+		return // Already submitted by the command.
+	}
+	mappingTransform.validity[key] = append(ranges, commandRange{captureCmd, captureCmd + 1})
+}
+
 func (mappingTransform *mappingExporter) extractRemappings(ctx context.Context, inputState *api.GlobalState, b *builder.Builder) error {
 	bufferSize := uint64(0)
 
@@ -228,9 +264,22 @@ func (mappingTransform *mappingExporter) processNotification(ctx context.Context
 			continue
 		}
 
-		mappingTransform.mappings[replayValue] = append(
-			mappingTransform.mappings[replayValue],
-			service.VulkanHandleMappingItem{HandleType: handle.name, TraceValue: handle.traceValue, ReplayValue: replayValue})
+		validity := mappingTransform.validity[submittedHandle{handle.name, handle.traceValue}]
+		if len(validity) == 0 {
+			// Never submitted, valid for the whole capture.
+			validity = []commandRange{{}}
+		}
+		for _, r := range validity {
+			mappingTransform.mappings[replayValue] = append(
+				mappingTransform.mappings[replayValue],
+				service.VulkanHandleMappingItem{
+					HandleType:   handle.name,
+					TraceValue:   handle.traceValue,
+					ReplayValue:  replayValue,
+					BeginCommand: r.begin,
+					EndCommand:   r.end,
+				})
+		}
 	}
 
 	mappingTransform.notificationID = 0
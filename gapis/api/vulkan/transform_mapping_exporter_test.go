@@ -0,0 +1,40 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestMappingExporterRecordsEachSubmission(t *testing.T) {
+	ctx := log.Testing(t)
+
+	exporter := newMappingExporter(context.Background(), 0, nil)
+	// Submitted twice by the same command, and again later. The handle is
+	// not valid in between the submissions.
+	for _, cmd := range []uint64{5, 5, 9} {
+		exporter.recordSubmission("VkCommandBuffer", 0xa, cmd)
+	}
+	exporter.recordSubmission("VkRenderPass", 0xa, 7)
+
+	assert.For(ctx, "command buffer").ThatSlice(exporter.validity[submittedHandle{"VkCommandBuffer", 0xa}]).
+		Equals([]commandRange{{5, 6}, {9, 10}})
+	assert.For(ctx, "render pass").ThatSlice(exporter.validity[submittedHandle{"VkRenderPass", 0xa}]).
+		Equals([]commandRange{{7, 8}})
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"math"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+)
+
+// resolutionScaleTransform implements a transform that scales the viewports,
+// scissors and render areas of the replay, such that every pass renders to
+// the scaled fraction of its attachments.
+type resolutionScaleTransform struct {
+	scale       float32
+	allocations *allocationTracker
+}
+
+func newResolutionScaleTransform(scale float32) *resolutionScaleTransform {
+	return &resolutionScaleTransform{
+		scale:       scale,
+		allocations: nil,
+	}
+}
+
+func (t *resolutionScaleTransform) RequiresAccurateState() bool {
+	return false
+}
+
+func (t *resolutionScaleTransform) RequiresInnerStateMutation() bool {
+	return false
+}
+
+func (t *resolutionScaleTransform) SetInnerStateMutationFunction(mutator transform.StateMutator) {
+	// This transform does not require inner state mutation
+}
+
+func (t *resolutionScaleTransform) BeginTransform(ctx context.Context, inputState *api.GlobalState) error {
+	t.allocations = NewAllocationTracker(inputState)
+	return nil
+}
+
+func (t *resolutionScaleTransform) EndTransform(ctx context.Context, inputState *api.GlobalState) ([]api.Cmd, error) {
+	return nil, nil
+}
+
+func (t *resolutionScaleTransform) ClearTransformResources(ctx context.Context) {
+	t.allocations.FreeAllocations()
+}
+
+func (t *resolutionScaleTransform) TransformCommand(ctx context.Context, id transform.CommandID, inputCommands []api.Cmd, inputState *api.GlobalState) ([]api.Cmd, error) {
+	for i, cmd := range inputCommands {
+		var newCmd api.Cmd
+		var err error
+		switch cmd := cmd.(type) {
+		case *VkCreateGraphicsPipelines:
+			newCmd, err = t.scaleGraphicsPipelines(ctx, cmd, inputState)
+		case *VkCmdSetViewport:
+			newCmd, err = t.scaleSetViewport(ctx, cmd, inputState)
+		case *VkCmdSetScissor:
+			newCmd, err = t.scaleSetScissor(ctx, cmd, inputState)
+		case *VkCmdBeginRenderPass:
+			newCmd, err = t.scaleBeginRenderPass(ctx, cmd, inputState)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if newCmd != nil {
+			inputCommands[i] = newCmd
+		}
+	}
+	return inputCommands, nil
+}
+
+func (t *resolutionScaleTransform) scaleGraphicsPipelines(ctx context.Context, cmd *VkCreateGraphicsPipelines, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	count := uint64(cmd.CreateInfoCount())
+	infos := cmd.PCreateInfos().Slice(0, count, inputState.MemoryLayout)
+	newInfos := make([]VkGraphicsPipelineCreateInfo, count)
+
+	reads := []api.AllocResult{}
+	for i := uint64(0); i < count; i++ {
+		pInfo, err := infos.Index(i).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		info := pInfo[0]
+		newInfos[i] = info
+		if info.PViewportState().IsNullptr() {
+			// Rasterization is disabled.
+			continue
+		}
+
+		viewportState, err := info.PViewportState().Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		// The viewports and scissors of pipelines with dynamic viewports and
+		// scissors are null, and set by vkCmdSetViewport and vkCmdSetScissor.
+		if p := viewportState.PViewports(); !p.IsNullptr() {
+			viewports, err := p.Slice(0, uint64(viewportState.ViewportCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			data := t.allocations.AllocDataOrPanic(ctx, t.scaleViewports(viewports))
+			viewportState.SetPViewports(NewVkViewportᶜᵖ(data.Ptr()))
+			reads = append(reads, data)
+		}
+		if p := viewportState.PScissors(); !p.IsNullptr() {
+			scissors, err := p.Slice(0, uint64(viewportState.ScissorCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			data := t.allocations.AllocDataOrPanic(ctx, t.scaleRects(scissors))
+			viewportState.SetPScissors(NewVkRect2Dᶜᵖ(data.Ptr()))
+			reads = append(reads, data)
+		}
+		data := t.allocations.AllocDataOrPanic(ctx, viewportState)
+		newInfos[i].SetPViewportState(NewVkPipelineViewportStateCreateInfoᶜᵖ(data.Ptr()))
+		reads = append(reads, data)
+	}
+	newInfosData := t.allocations.AllocDataOrPanic(ctx, newInfos)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateGraphicsPipelines(cmd.Device(),
+		cmd.PipelineCache(), cmd.CreateInfoCount(), newInfosData.Ptr(),
+		cmd.PAllocator(), cmd.PPipelines(), cmd.Result()).AddRead(newInfosData.Data())
+	for _, r := range reads {
+		newCmd.AddRead(r.Data())
+	}
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
+
+func (t *resolutionScaleTransform) scaleSetViewport(ctx context.Context, cmd *VkCmdSetViewport, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	viewports, err := cmd.PViewports().Slice(0, uint64(cmd.ViewportCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := t.allocations.AllocDataOrPanic(ctx, t.scaleViewports(viewports))
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	return cb.VkCmdSetViewport(cmd.CommandBuffer(), cmd.FirstViewport(),
+		cmd.ViewportCount(), data.Ptr()).AddRead(data.Data()), nil
+}
+
+func (t *resolutionScaleTransform) scaleSetScissor(ctx context.Context, cmd *VkCmdSetScissor, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	scissors, err := cmd.PScissors().Slice(0, uint64(cmd.ScissorCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := t.allocations.AllocDataOrPanic(ctx, t.scaleRects(scissors))
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	return cb.VkCmdSetScissor(cmd.CommandBuffer(), cmd.FirstScissor(),
+		cmd.ScissorCount(), data.Ptr()).AddRead(data.Data()), nil
+}
+
+func (t *resolutionScaleTransform) scaleBeginRenderPass(ctx context.Context, cmd *VkCmdBeginRenderPass, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	info, err := cmd.PRenderPassBegin().Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	info.SetRenderArea(t.scaleRects([]VkRect2D{info.RenderArea()})[0])
+	data := t.allocations.AllocDataOrPanic(ctx, info)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCmdBeginRenderPass(cmd.CommandBuffer(), data.Ptr(), cmd.Contents()).AddRead(data.Data())
+	// The clear values are still read from the original pointer.
+	for _, r := range cmd.Extras().Observations().Reads {
+		newCmd.AddRead(r.Range, r.ID)
+	}
+	return newCmd, nil
+}
+
+func (t *resolutionScaleTransform) scaleViewports(viewports []VkViewport) []VkViewport {
+	res := make([]VkViewport, len(viewports))
+	for i, v := range viewports {
+		res[i] = NewVkViewport(v.X()*t.scale, v.Y()*t.scale,
+			v.Width()*t.scale, v.Height()*t.scale, v.MinDepth(), v.MaxDepth())
+	}
+	return res
+}
+
+func (t *resolutionScaleTransform) scaleRects(rects []VkRect2D) []VkRect2D {
+	res := make([]VkRect2D, len(rects))
+	for i, r := range rects {
+		res[i] = NewVkRect2D(
+			NewVkOffset2D(int32(float32(r.Offset().X())*t.scale), int32(float32(r.Offset().Y())*t.scale)),
+			NewVkExtent2D(t.scaleExtent(r.Extent().Width()), t.scaleExtent(r.Extent().Height())))
+	}
+	return res
+}
+
+// scaleExtent scales the size of a rectangle, rounding up such that no
+// rectangle becomes empty.
+func (t *resolutionScaleTransform) scaleExtent(v uint32) uint32 {
+	return uint32(math.Ceil(float64(v) * float64(t.scale)))
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+)
+
+// samplerOverrideTransform implements the Transform interface to change the
+// LOD bias and the filtering of every vkCreateSampler call.
+type samplerOverrideTransform struct {
+	lodBias          float32
+	nearestFiltering bool
+	allocations      *allocationTracker
+}
+
+func newSamplerOverrideTransform(lodBias float32, nearestFiltering bool) *samplerOverrideTransform {
+	return &samplerOverrideTransform{
+		lodBias:          lodBias,
+		nearestFiltering: nearestFiltering,
+		allocations:      nil,
+	}
+}
+
+func (t *samplerOverrideTransform) RequiresAccurateState() bool {
+	return false
+}
+
+func (t *samplerOverrideTransform) RequiresInnerStateMutation() bool {
+	return false
+}
+
+func (t *samplerOverrideTransform) SetInnerStateMutationFunction(mutator transform.StateMutator) {
+	// This transform does not require inner state mutation
+}
+
+func (t *samplerOverrideTransform) BeginTransform(ctx context.Context, inputState *api.GlobalState) error {
+	t.allocations = NewAllocationTracker(inputState)
+	log.I(ctx, "Sampler override: LOD bias %+v, nearest filtering %v.", t.lodBias, t.nearestFiltering)
+	return nil
+}
+
+func (t *samplerOverrideTransform) ClearTransformResources(ctx context.Context) {
+	t.allocations.FreeAllocations()
+}
+
+func (t *samplerOverrideTransform) TransformCommand(ctx context.Context, id transform.CommandID, inputCommands []api.Cmd, inputState *api.GlobalState) ([]api.Cmd, error) {
+	for i, cmd := range inputCommands {
+		if cmd, ok := cmd.(*VkCreateSampler); ok {
+			var err error
+			inputCommands[i], err = t.overrideSamplerCreation(ctx, cmd, inputState)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return inputCommands, nil
+}
+
+func (t *samplerOverrideTransform) EndTransform(ctx context.Context, inputState *api.GlobalState) ([]api.Cmd, error) {
+	return nil, nil
+}
+
+func (t *samplerOverrideTransform) overrideSamplerCreation(ctx context.Context, cmd *VkCreateSampler, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	pAlloc := memory.Pointer(cmd.PAllocator())
+	pSampler := memory.Pointer(cmd.PSampler())
+
+	pInfo := cmd.PCreateInfo()
+	info, err := pInfo.Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Samplers with unnormalized coordinates must have a zero LOD bias.
+	if info.UnnormalizedCoordinates() == VkBool32(0) {
+		info.SetMipLodBias(info.MipLodBias() + t.lodBias)
+	}
+	if t.nearestFiltering {
+		info.SetMagFilter(VkFilter_VK_FILTER_NEAREST)
+		info.SetMinFilter(VkFilter_VK_FILTER_NEAREST)
+		info.SetMipmapMode(VkSamplerMipmapMode_VK_SAMPLER_MIPMAP_MODE_NEAREST)
+		info.SetAnisotropyEnable(VkBool32(0))
+	}
+	newInfo := t.allocations.AllocDataOrPanic(ctx, info)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateSampler(cmd.Device(), newInfo.Ptr(), pAlloc, pSampler, cmd.Result())
+	newCmd.AddRead(newInfo.Data())
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+
+	return newCmd, nil
+}
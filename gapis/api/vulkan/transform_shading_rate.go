@@ -0,0 +1,313 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vulkan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/transform"
+	"github.com/google/gapid/gapis/memory"
+)
+
+const (
+	fragmentShadingRateExtension = "VK_KHR_fragment_shading_rate"
+	createRenderPass2Extension   = "VK_KHR_create_renderpass2"
+)
+
+// shadingRateTransform implements a transform that replays the render
+// passes at a coarser shading rate, using VK_KHR_fragment_shading_rate. The
+// extension is enabled on every device, the shading rate is made a dynamic
+// state of every graphics pipeline, and is set at the start of every render
+// pass, and of every secondary command buffer continuing a render pass.
+type shadingRateTransform struct {
+	width, height uint32
+	// renderPasses are the render passes shaded at the coarser rate. If
+	// empty, all the render passes are.
+	renderPasses map[VkRenderPass]bool
+	// devices are the physical devices of the replay device.
+	devices     []*device.VulkanPhysicalDevice
+	allocations *allocationTracker
+}
+
+func newShadingRateTransform(width, height uint32, renderPasses []uint64, dev *device.Instance) *shadingRateTransform {
+	t := &shadingRateTransform{
+		width:        width,
+		height:       height,
+		renderPasses: map[VkRenderPass]bool{},
+		devices:      dev.GetConfiguration().GetDrivers().GetVulkan().GetPhysicalDevices(),
+		allocations:  nil,
+	}
+	for _, rp := range renderPasses {
+		t.renderPasses[VkRenderPass(rp)] = true
+	}
+	return t
+}
+
+func (t *shadingRateTransform) RequiresAccurateState() bool {
+	return false
+}
+
+func (t *shadingRateTransform) RequiresInnerStateMutation() bool {
+	return false
+}
+
+func (t *shadingRateTransform) SetInnerStateMutationFunction(mutator transform.StateMutator) {
+	// This transform does not require inner state mutation
+}
+
+func (t *shadingRateTransform) BeginTransform(ctx context.Context, inputState *api.GlobalState) error {
+	t.allocations = NewAllocationTracker(inputState)
+	log.I(ctx, "Shading render passes at %dx%d fragments.", t.width, t.height)
+	return nil
+}
+
+func (t *shadingRateTransform) EndTransform(ctx context.Context, inputState *api.GlobalState) ([]api.Cmd, error) {
+	return nil, nil
+}
+
+func (t *shadingRateTransform) ClearTransformResources(ctx context.Context) {
+	t.allocations.FreeAllocations()
+}
+
+func (t *shadingRateTransform) TransformCommand(ctx context.Context, id transform.CommandID, inputCommands []api.Cmd, inputState *api.GlobalState) ([]api.Cmd, error) {
+	outputCommands := make([]api.Cmd, 0, len(inputCommands))
+	for _, cmd := range inputCommands {
+		switch cmd := cmd.(type) {
+		case *VkCreateDevice:
+			newCmd, err := t.enableShadingRate(ctx, cmd, inputState)
+			if err != nil {
+				return nil, err
+			}
+			outputCommands = append(outputCommands, newCmd)
+		case *VkCreateGraphicsPipelines:
+			newCmd, err := t.addDynamicShadingRate(ctx, cmd, inputState)
+			if err != nil {
+				return nil, err
+			}
+			outputCommands = append(outputCommands, newCmd)
+		case *VkCmdBeginRenderPass:
+			cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+			info, err := cmd.PRenderPassBegin().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			outputCommands = append(outputCommands, cmd,
+				t.setShadingRate(ctx, cmd.Thread(), cmd.CommandBuffer(), t.coarse(info.RenderPass())))
+		case *VkBeginCommandBuffer:
+			// Secondary command buffers continuing a render pass don't
+			// inherit the dynamic state of the primary command buffer. The
+			// other command buffers set the rate at their render passes.
+			cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+			info, err := cmd.PBeginInfo().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			continueBit := VkCommandBufferUsageFlags(VkCommandBufferUsageFlagBits_VK_COMMAND_BUFFER_USAGE_RENDER_PASS_CONTINUE_BIT)
+			if info.Flags()&continueBit == 0 || info.PInheritanceInfo().IsNullptr() {
+				outputCommands = append(outputCommands, cmd)
+				continue
+			}
+			inheritance, err := info.PInheritanceInfo().Read(ctx, cmd, inputState, nil)
+			if err != nil {
+				return nil, err
+			}
+			outputCommands = append(outputCommands, cmd,
+				t.setShadingRate(ctx, cmd.Thread(), cmd.CommandBuffer(), t.coarse(inheritance.RenderPass())))
+		default:
+			outputCommands = append(outputCommands, cmd)
+		}
+	}
+	return outputCommands, nil
+}
+
+// coarse returns whether the render pass is shaded at the coarser rate.
+func (t *shadingRateTransform) coarse(rp VkRenderPass) bool {
+	return len(t.renderPasses) == 0 || t.renderPasses[rp]
+}
+
+// setShadingRate returns the command setting the coarser, or the default,
+// shading rate of the command buffer.
+func (t *shadingRateTransform) setShadingRate(ctx context.Context, thread uint64, commandBuffer VkCommandBuffer, coarse bool) api.Cmd {
+	size := NewVkExtent2D(1, 1)
+	if coarse {
+		size = NewVkExtent2D(t.width, t.height)
+	}
+	sizeData := t.allocations.AllocDataOrPanic(ctx, size)
+	keep := VkFragmentShadingRateCombinerOpKHR_VK_FRAGMENT_SHADING_RATE_COMBINER_OP_KEEP_KHR
+
+	cb := CommandBuilder{Thread: thread}
+	return cb.VkCmdSetFragmentShadingRateKHR(commandBuffer, sizeData.Ptr(),
+		NewVkFragmentShadingRateCombinerOpKHRː2ᵃ(keep, keep)).AddRead(sizeData.Data())
+}
+
+// enableShadingRate enables the fragment shading rate extension, and its
+// pipeline shading rate feature, on the device.
+func (t *shadingRateTransform) enableShadingRate(ctx context.Context, cmd *VkCreateDevice, inputState *api.GlobalState) (api.Cmd, error) {
+	if err := t.checkSupport(GetState(inputState), cmd.PhysicalDevice()); err != nil {
+		return nil, err
+	}
+
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+	info, err := cmd.PCreateInfo().Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	exts, err := info.PpEnabledExtensionNames().Slice(0, uint64(info.EnabledExtensionCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil)
+	if err != nil {
+		return nil, err
+	}
+	missing := map[string]bool{fragmentShadingRateExtension: true, createRenderPass2Extension: true}
+	for _, e := range exts {
+		rawStr, err := e.StringSlice(ctx, inputState).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		delete(missing, strings.TrimRight(string(memory.CharToBytes(rawStr)), "\x00"))
+	}
+	reads := []api.AllocResult{}
+	for _, name := range []string{fragmentShadingRateExtension, createRenderPass2Extension} {
+		if missing[name] {
+			nameData := t.allocations.AllocDataOrPanic(ctx, name)
+			exts = append(exts, NewCharᶜᵖ(nameData.Ptr()))
+			reads = append(reads, nameData)
+		}
+	}
+	extsData := t.allocations.AllocDataOrPanic(ctx, exts)
+	reads = append(reads, extsData)
+	info.SetEnabledExtensionCount(uint32(len(exts)))
+	info.SetPpEnabledExtensionNames(NewCharᶜᵖᶜᵖ(extsData.Ptr()))
+
+	features := NewVkPhysicalDeviceFragmentShadingRateFeaturesKHR(
+		VkStructureType_VK_STRUCTURE_TYPE_PHYSICAL_DEVICE_FRAGMENT_SHADING_RATE_FEATURES_KHR, // sType
+		NewVoidᵖ(info.PNext()), // pNext
+		VkBool32(1),            // pipelineFragmentShadingRate
+		VkBool32(0),            // primitiveFragmentShadingRate
+		VkBool32(0),            // attachmentFragmentShadingRate
+	)
+	featuresData := t.allocations.AllocDataOrPanic(ctx, features)
+	reads = append(reads, featuresData)
+	info.SetPNext(NewVoidᶜᵖ(featuresData.Ptr()))
+	infoData := t.allocations.AllocDataOrPanic(ctx, info)
+	reads = append(reads, infoData)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateDevice(cmd.PhysicalDevice(), infoData.Ptr(), cmd.PAllocator(), cmd.PDevice(), cmd.Result())
+	for _, r := range reads {
+		newCmd.AddRead(r.Data())
+	}
+	// Also add back all the other read/write observations of the original
+	// vkCreateDevice, e.g. for the rest of the pNext chain.
+	for _, r := range cmd.Extras().Observations().Reads {
+		newCmd.AddRead(r.Range, r.ID)
+	}
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
+
+// checkSupport returns an error if the physical device of the replay device,
+// matching the physical device of the capture, does not support the pipeline
+// fragment shading rate.
+func (t *shadingRateTransform) checkSupport(s *State, physicalDevice VkPhysicalDevice) error {
+	obj := s.PhysicalDevices().Get(physicalDevice)
+	if obj.IsNil() {
+		return fmt.Errorf("Fragment shading rate unsupported: unknown physical device %v", physicalDevice)
+	}
+	props := obj.PhysicalDeviceProperties()
+	for _, d := range t.devices {
+		if d.GetVendorId() != props.VendorID() || d.GetDeviceId() != props.DeviceID() {
+			continue
+		}
+		supported := map[string]bool{}
+		for _, e := range d.GetExtensions() {
+			supported[e] = true
+		}
+		for _, e := range []string{fragmentShadingRateExtension, createRenderPass2Extension} {
+			if !supported[e] {
+				return fmt.Errorf("Fragment shading rate unsupported: %s does not support %s", d.GetDeviceName(), e)
+			}
+		}
+		if !d.GetPipelineFragmentShadingRate() {
+			return fmt.Errorf("Fragment shading rate unsupported: %s does not support pipelineFragmentShadingRate", d.GetDeviceName())
+		}
+		return nil
+	}
+	return fmt.Errorf("Fragment shading rate unsupported: the replay device has no physical device %x:%x",
+		props.VendorID(), props.DeviceID())
+}
+
+// addDynamicShadingRate adds the fragment shading rate to the dynamic states
+// of the graphics pipelines.
+func (t *shadingRateTransform) addDynamicShadingRate(ctx context.Context, cmd *VkCreateGraphicsPipelines, inputState *api.GlobalState) (api.Cmd, error) {
+	cmd.Extras().Observations().ApplyReads(inputState.Memory.ApplicationPool())
+
+	count := uint64(cmd.CreateInfoCount())
+	infos := cmd.PCreateInfos().Slice(0, count, inputState.MemoryLayout)
+	newInfos := make([]VkGraphicsPipelineCreateInfo, count)
+
+	reads := []api.AllocResult{}
+	for i := uint64(0); i < count; i++ {
+		pInfo, err := infos.Index(i).Read(ctx, cmd, inputState, nil)
+		if err != nil {
+			return nil, err
+		}
+		info := pInfo[0]
+
+		states := []VkDynamicState{}
+		dynamicState := NewVkPipelineDynamicStateCreateInfo(
+			VkStructureType_VK_STRUCTURE_TYPE_PIPELINE_DYNAMIC_STATE_CREATE_INFO, // sType
+			0, // pNext
+			0, // flags
+			0, // dynamicStateCount
+			0, // pDynamicStates
+		)
+		if !info.PDynamicState().IsNullptr() {
+			if dynamicState, err = info.PDynamicState().Read(ctx, cmd, inputState, nil); err != nil {
+				return nil, err
+			}
+			if states, err = dynamicState.PDynamicStates().Slice(0, uint64(dynamicState.DynamicStateCount()), inputState.MemoryLayout).Read(ctx, cmd, inputState, nil); err != nil {
+				return nil, err
+			}
+		}
+		states = append(states, VkDynamicState_VK_DYNAMIC_STATE_FRAGMENT_SHADING_RATE_KHR)
+		statesData := t.allocations.AllocDataOrPanic(ctx, states)
+		dynamicState.SetDynamicStateCount(uint32(len(states)))
+		dynamicState.SetPDynamicStates(NewVkDynamicStateᶜᵖ(statesData.Ptr()))
+		dynamicStateData := t.allocations.AllocDataOrPanic(ctx, dynamicState)
+		info.SetPDynamicState(NewVkPipelineDynamicStateCreateInfoᶜᵖ(dynamicStateData.Ptr()))
+		newInfos[i] = info
+		reads = append(reads, statesData, dynamicStateData)
+	}
+	newInfosData := t.allocations.AllocDataOrPanic(ctx, newInfos)
+
+	cb := CommandBuilder{Thread: cmd.Thread()}
+	newCmd := cb.VkCreateGraphicsPipelines(cmd.Device(),
+		cmd.PipelineCache(), cmd.CreateInfoCount(), newInfosData.Ptr(),
+		cmd.PAllocator(), cmd.PPipelines(), cmd.Result()).AddRead(newInfosData.Data())
+	for _, r := range reads {
+		newCmd.AddRead(r.Data())
+	}
+	for _, w := range cmd.Extras().Observations().Writes {
+		newCmd.AddWrite(w.Range, w.ID)
+	}
+	return newCmd, nil
+}
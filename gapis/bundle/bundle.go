@@ -0,0 +1,83 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle implements the .agiz bundle format, bundling a capture, its
+// Perfetto trace, the profiled device and the profiling data into a single
+// file. A bundle is the magic followed by the gzip compressed binary encoding
+// of a service.Bundle.
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// Extension is the file extension of bundles.
+	Extension = ".agiz"
+	// Version is the version of the bundle format written by Write.
+	Version = 1
+)
+
+var magic = []byte("AGIZ")
+
+// Write writes the bundle to w, setting its version.
+func Write(w io.Writer, b *service.Bundle) error {
+	b.Version = Version
+	data, err := proto.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(magic); err != nil {
+		return err
+	}
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(data); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Read reads a bundle from r. Returns an error if r isn't a bundle, or the
+// bundle is of a newer version than supported.
+func Read(r io.Reader) (*service.Bundle, error) {
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, magic) {
+		return nil, fmt.Errorf("Not an %v bundle", Extension)
+	}
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &service.Bundle{}
+	if err := proto.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Version > Version {
+		return nil, fmt.Errorf("Unsupported bundle version %d, expected at most %d", b.Version, Version)
+	}
+	return b, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/bundle"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := log.Testing(t)
+
+	buf := &bytes.Buffer{}
+	err := bundle.Write(buf, &service.Bundle{
+		CaptureName:   "capture.gfxtrace",
+		Capture:       []byte{1, 2, 3},
+		PerfettoTrace: []byte{4, 5},
+		Device:        &device.Instance{Name: "Pixel"},
+		ProfilingData: &service.ProfilingData{TraceStart: 42},
+	})
+	assert.For(ctx, "write").ThatError(err).Succeeded()
+
+	got, err := bundle.Read(buf)
+	assert.For(ctx, "read").ThatError(err).Succeeded()
+	assert.For(ctx, "version").That(got.Version).Equals(uint32(bundle.Version))
+	assert.For(ctx, "name").That(got.CaptureName).Equals("capture.gfxtrace")
+	assert.For(ctx, "capture").ThatSlice(got.Capture).Equals([]byte{1, 2, 3})
+	assert.For(ctx, "trace").ThatSlice(got.PerfettoTrace).Equals([]byte{4, 5})
+	assert.For(ctx, "device").That(got.Device.GetName()).Equals("Pixel")
+	assert.For(ctx, "data").That(got.ProfilingData.GetTraceStart()).Equals(uint64(42))
+}
+
+func TestReadInvalid(t *testing.T) {
+	ctx := log.Testing(t)
+
+	_, err := bundle.Read(bytes.NewReader([]byte("PK\x03\x04")))
+	assert.For(ctx, "not a bundle").ThatError(err).Failed()
+
+	buf := &bytes.Buffer{}
+	bundle.Write(buf, &service.Bundle{})
+	data := buf.Bytes()
+	_, err = bundle.Read(bytes.NewReader(data[:len(data)-4]))
+	assert.For(ctx, "truncated").ThatError(err).Failed()
+}
@@ -0,0 +1,301 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package calibration rates the reliability of the GPU counters of devices,
+// based on how much the counters vary across repeated profiling runs of the
+// same capture. The ratings, and optionally the measured sampling overheads
+// of the counters, are stored in a calibration file, a text format
+// CounterCalibration proto. The peak rates of the GPUs measured by the
+// counters are part of the devices' performance fingerprints.
+package calibration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// minRuns is the minimum number of runs of a capture needed to measure
+	// the variation of its counters.
+	minRuns = 3
+	// The maximum coefficients of variation of reliable and noisy counters.
+	maxReliableVariation = 0.05
+	maxNoisyVariation    = 0.2
+)
+
+// Load reads the calibration file at path.
+func Load(ctx context.Context, path string) (*service.CounterCalibration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the counter calibration %v", path)
+	}
+	res := &service.CounterCalibration{}
+	if err := proto.UnmarshalText(string(data), res); err != nil {
+		return nil, log.Errf(ctx, err, "Failed to parse the counter calibration %v", path)
+	}
+	return res, nil
+}
+
+// Save writes the calibration to the file at path.
+func Save(ctx context.Context, path string, calibration *service.CounterCalibration) error {
+	if err := ioutil.WriteFile(path, []byte(proto.MarshalTextString(calibration)), 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write the counter calibration %v", path)
+	}
+	return nil
+}
+
+// Rating returns the reliability rating of a counter with the given
+// coefficient of variation.
+func Rating(variation float64) service.CounterReliability {
+	switch {
+	case variation <= maxReliableVariation:
+		return service.CounterReliability_Reliable
+	case variation <= maxNoisyVariation:
+		return service.CounterReliability_Noisy
+	default:
+		return service.CounterReliability_Unreliable
+	}
+}
+
+// FromRuns measures the variation of the counters of each GPU from the
+// given profiling runs. The runs are grouped by capture and GPU, and the
+// variation of a counter is the largest it has across the captures profiled
+// at least minRuns times on the GPU.
+func FromRuns(runs []*service.ProfilingRun) *service.CounterCalibration {
+	type key struct{ capture, gpu string }
+	type samples map[string][]float64 // metric name -> averages
+	groups := map[key]samples{}
+	for _, run := range runs {
+		k := key{string(run.GetCaptureId().GetData()), run.GpuName}
+		if groups[k] == nil {
+			groups[k] = samples{}
+		}
+		for _, metric := range run.Metrics {
+			groups[k][metric.Name] = append(groups[k][metric.Name], metric.Average)
+		}
+	}
+
+	counters := map[string]map[string]*service.CounterCalibration_Counter{}
+	for k, metrics := range groups {
+		for name, values := range metrics {
+			if len(values) < minRuns {
+				continue
+			}
+			if counters[k.gpu] == nil {
+				counters[k.gpu] = map[string]*service.CounterCalibration_Counter{}
+			}
+			variation := coefficientOfVariation(values)
+			c, ok := counters[k.gpu][name]
+			if !ok {
+				c = &service.CounterCalibration_Counter{Name: name}
+				counters[k.gpu][name] = c
+			}
+			if !ok || variation > c.Variation {
+				c.Variation = variation
+			}
+			c.Runs += uint32(len(values))
+		}
+	}
+
+	res := &service.CounterCalibration{}
+	for gpu, byName := range counters {
+		d := &service.CounterCalibration_Device{GpuName: gpu}
+		for _, c := range byName {
+			c.Reliability = Rating(c.Variation)
+			d.Counters = append(d.Counters, c)
+		}
+		sort.Slice(d.Counters, func(i, j int) bool { return d.Counters[i].Name < d.Counters[j].Name })
+		res.Devices = append(res.Devices, d)
+	}
+	sort.Slice(res.Devices, func(i, j int) bool { return res.Devices[i].GpuName < res.Devices[j].GpuName })
+	return res
+}
+
+// TimerResolution estimates the resolution of the GPU timer from the
+// timestamps of the given slices, as the smallest difference between two
+// distinct timestamps. Returns zero if there are too few slices.
+func TimerResolution(slices *service.ProfilingData_GpuSlices) uint64 {
+	ts := []uint64{}
+	for _, s := range slices.GetSlices() {
+		ts = append(ts, s.Ts, s.Ts+s.Dur)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+
+	res := uint64(0)
+	for i := 1; i < len(ts); i++ {
+		if d := ts[i] - ts[i-1]; d > 0 && (res == 0 || d < res) {
+			res = d
+		}
+	}
+	return res
+}
+
+// Merge adds the devices of src to dst, replacing the devices of dst that
+// have the same GPU.
+func Merge(dst, src *service.CounterCalibration) {
+	for _, d := range src.GetDevices() {
+		replaced := false
+		for i, old := range dst.Devices {
+			if old.GpuName == d.GpuName {
+				dst.Devices[i], replaced = d, true
+				break
+			}
+		}
+		if !replaced {
+			dst.Devices = append(dst.Devices, d)
+		}
+	}
+	sort.Slice(dst.Devices, func(i, j int) bool { return dst.Devices[i].GpuName < dst.Devices[j].GpuName })
+}
+
+// Apply sets the reliability of the GPU counter metrics of the data, as
+// calibrated for the given GPU. Metrics without a calibration are left
+// unrated.
+func Apply(calibration *service.CounterCalibration, gpu string, data *service.ProfilingData) {
+	for _, d := range calibration.GetDevices() {
+		if d.GpuName != gpu {
+			continue
+		}
+		ratings := map[string]service.CounterReliability{}
+		for _, c := range d.Counters {
+			ratings[c.Name] = c.Reliability
+		}
+		for _, metric := range data.GetGpuCounters().GetMetrics() {
+			metric.Reliability = ratings[metric.Name]
+		}
+		return
+	}
+}
+
+// ApplySamplingCosts sets the sampling costs of the counters of the
+// descriptor, as calibrated for the given GPU, overriding the estimated
+// costs. Counters without a measured overhead are left untouched.
+func ApplySamplingCosts(calibration *service.CounterCalibration, gpu string, desc *device.GpuCounterDescriptor) {
+	for _, d := range calibration.GetDevices() {
+		if d.GpuName != gpu {
+			continue
+		}
+		overheads := map[string]float64{}
+		for _, c := range d.Counters {
+			if c.SamplingOverhead > 0 {
+				overheads[c.Name] = c.SamplingOverhead
+			}
+		}
+		for _, spec := range desc.GetSpecs() {
+			if overhead, ok := overheads[spec.Name]; ok {
+				spec.SamplingCost = &device.GpuCounterDescriptor_SamplingCost{
+					Overhead: overhead,
+					Source:   device.GpuCounterDescriptor_SamplingCost_CALIBRATED,
+				}
+			}
+		}
+		return
+	}
+}
+
+// PeakRates estimates the peak fill rate, in pixels per second, and memory
+// bandwidth, in bytes per second, of the GPU from the samples of the counters
+// measuring pixels and bytes. The samples of counters without a time unit
+// are the totals since the previous sample, and are converted to rates.
+// Returns zero for the rates without a counter.
+func PeakRates(counters []*service.ProfilingData_Counter) (fillRate, bandwidth float64) {
+	for _, counter := range counters {
+		spec := counter.GetSpec()
+		if len(spec.GetNumeratorUnits()) != 1 {
+			continue
+		}
+		var peak *float64
+		switch spec.NumeratorUnits[0] {
+		case device.GpuCounterDescriptor_PIXEL:
+			peak = &fillRate
+		case device.GpuCounterDescriptor_BYTE:
+			peak = &bandwidth
+		default:
+			continue
+		}
+
+		denominators := spec.GetDenominatorUnits()
+		switch {
+		case len(denominators) == 1 && denominators[0] == device.GpuCounterDescriptor_SECOND:
+			for _, v := range counter.Values {
+				*peak = math.Max(*peak, v)
+			}
+		case len(denominators) == 0:
+			for i := 1; i < len(counter.Timestamps); i++ {
+				if dt := counter.Timestamps[i] - counter.Timestamps[i-1]; dt > 0 {
+					*peak = math.Max(*peak, counter.Values[i]*1e9/float64(dt))
+				}
+			}
+		}
+	}
+	return fillRate, bandwidth
+}
+
+// Fingerprint returns the anonymized performance fingerprint of the device,
+// with the characteristics of its GPU measured by the calibration, if any.
+func Fingerprint(calibration *service.CounterCalibration, inst *device.Instance) *service.DeviceFingerprint {
+	config := inst.GetConfiguration()
+	res := &service.DeviceFingerprint{
+		Model:     config.GetHardware().GetName(),
+		GpuName:   config.GetHardware().GetGPU().GetName(),
+		GpuVendor: config.GetHardware().GetGPU().GetVendor(),
+		Os:        config.GetOS().GetName(),
+		ApiLevel:  config.GetOS().GetAPIVersion(),
+	}
+	if devices := config.GetDrivers().GetVulkan().GetPhysicalDevices(); len(devices) > 0 {
+		res.DriverVersion = devices[0].DriverVersion
+	}
+	for _, d := range calibration.GetDevices() {
+		if d.GpuName == res.GpuName {
+			res.FillRate = d.FillRate
+			res.Bandwidth = d.Bandwidth
+			res.TimerResolution = d.TimerResolution
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v|%v|%v|%v|%v|%v|%.3g|%.3g|%v",
+		res.Model, res.GpuName, res.GpuVendor, res.DriverVersion, res.Os, res.ApiLevel,
+		res.FillRate, res.Bandwidth, res.TimerResolution)))
+	res.Id = hex.EncodeToString(hash[:6])
+	return res
+}
+
+// coefficientOfVariation returns the standard deviation of the values
+// relative to their mean.
+func coefficientOfVariation(values []float64) float64 {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values))
+	return math.Sqrt(variance) / math.Abs(mean)
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calibration_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/calibration"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestFromRuns(t *testing.T) {
+	ctx := log.Testing(t)
+
+	run := func(capture byte, gpu string, stable, noisy float64) *service.ProfilingRun {
+		return &service.ProfilingRun{
+			CaptureId: &path.ID{Data: []byte{capture}},
+			GpuName:   gpu,
+			Metrics: []*service.ProfilingRun_Metric{
+				{Name: "Stable", Average: stable},
+				{Name: "Noisy", Average: noisy},
+			},
+		}
+	}
+	runs := []*service.ProfilingRun{
+		run(1, "GPU", 100, 50),
+		run(1, "GPU", 101, 100),
+		run(1, "GPU", 99, 150),
+		// Too few runs to measure the variation.
+		run(2, "GPU", 10, 1000),
+		run(2, "GPU", 1000, 1),
+	}
+
+	c := calibration.FromRuns(runs)
+	assert.For(ctx, "devices").That(len(c.Devices)).Equals(1)
+	counters := c.Devices[0].Counters
+	assert.For(ctx, "counters").That(len(counters)).Equals(2)
+	assert.For(ctx, "noisy name").That(counters[0].Name).Equals("Noisy")
+	assert.For(ctx, "noisy rating").That(counters[0].Reliability).Equals(service.CounterReliability_Unreliable)
+	assert.For(ctx, "stable name").That(counters[1].Name).Equals("Stable")
+	assert.For(ctx, "stable rating").That(counters[1].Reliability).Equals(service.CounterReliability_Reliable)
+	assert.For(ctx, "stable runs").That(counters[1].Runs).Equals(uint32(3))
+
+	data := &service.ProfilingData{GpuCounters: &service.ProfilingData_GpuCounters{
+		Metrics: []*service.ProfilingData_GpuCounters_Metric{{Name: "Stable"}, {Name: "Other"}},
+	}}
+	calibration.Apply(c, "GPU", data)
+	assert.For(ctx, "applied").That(data.GpuCounters.Metrics[0].Reliability).Equals(service.CounterReliability_Reliable)
+	assert.For(ctx, "uncalibrated").That(data.GpuCounters.Metrics[1].Reliability).Equals(service.CounterReliability_UnknownReliability)
+}
+
+func TestTimerResolution(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 1000, Dur: 500},
+			{Ts: 1000, Dur: 260},
+			{Ts: 1600, Dur: 120},
+		},
+	}
+	assert.For(ctx, "resolution").That(calibration.TimerResolution(slices)).Equals(uint64(100))
+	assert.For(ctx, "empty").That(calibration.TimerResolution(nil)).Equals(uint64(0))
+}
+
+func TestMerge(t *testing.T) {
+	ctx := log.Testing(t)
+
+	dst := &service.CounterCalibration{Devices: []*service.CounterCalibration_Device{
+		{GpuName: "B", TimerResolution: 1},
+		{GpuName: "C"},
+	}}
+	src := &service.CounterCalibration{Devices: []*service.CounterCalibration_Device{
+		{GpuName: "A"},
+		{GpuName: "B", TimerResolution: 2},
+	}}
+	calibration.Merge(dst, src)
+	assert.For(ctx, "devices").That(len(dst.Devices)).Equals(3)
+	assert.For(ctx, "first").That(dst.Devices[0].GpuName).Equals("A")
+	assert.For(ctx, "replaced").That(dst.Devices[1].TimerResolution).Equals(uint64(2))
+	assert.For(ctx, "kept").That(dst.Devices[2].GpuName).Equals("C")
+}
+
+func TestApplySamplingCosts(t *testing.T) {
+	ctx := log.Testing(t)
+
+	estimated := &device.GpuCounterDescriptor_SamplingCost{
+		Overhead: 0.004,
+		Source:   device.GpuCounterDescriptor_SamplingCost_ESTIMATED,
+	}
+	desc := &device.GpuCounterDescriptor{Specs: []*device.GpuCounterDescriptor_GpuCounterSpec{
+		{CounterId: 1, Name: "measured", SamplingCost: estimated},
+		{CounterId: 2, Name: "unmeasured", SamplingCost: estimated},
+	}}
+	calib := &service.CounterCalibration{Devices: []*service.CounterCalibration_Device{
+		{GpuName: "A", Counters: []*service.CounterCalibration_Counter{
+			{Name: "measured", SamplingOverhead: 0.02},
+			{Name: "unmeasured"},
+		}},
+	}}
+
+	calibration.ApplySamplingCosts(calib, "B", desc)
+	assert.For(ctx, "other gpu").That(desc.Specs[0].SamplingCost).Equals(estimated)
+
+	calibration.ApplySamplingCosts(calib, "A", desc)
+	assert.For(ctx, "overhead").That(desc.Specs[0].SamplingCost.Overhead).Equals(0.02)
+	assert.For(ctx, "source").That(desc.Specs[0].SamplingCost.Source).Equals(device.GpuCounterDescriptor_SamplingCost_CALIBRATED)
+	assert.For(ctx, "unmeasured").That(desc.Specs[1].SamplingCost).Equals(estimated)
+}
+
+func TestPeakRates(t *testing.T) {
+	ctx := log.Testing(t)
+
+	spec := func(numerator device.GpuCounterDescriptor_MeasureUnit, denominators ...device.GpuCounterDescriptor_MeasureUnit) *device.GpuCounterDescriptor_GpuCounterSpec {
+		return &device.GpuCounterDescriptor_GpuCounterSpec{
+			NumeratorUnits:   []device.GpuCounterDescriptor_MeasureUnit{numerator},
+			DenominatorUnits: denominators,
+		}
+	}
+	counters := []*service.ProfilingData_Counter{
+		// 2000 pixels per microsecond at most.
+		{Spec: spec(device.GpuCounterDescriptor_PIXEL), Timestamps: []uint64{0, 1000, 3000}, Values: []float64{0, 1000, 4000}},
+		{Spec: spec(device.GpuCounterDescriptor_BYTE, device.GpuCounterDescriptor_SECOND), Values: []float64{5e9, 8e9}},
+		{Spec: spec(device.GpuCounterDescriptor_PERCENT), Values: []float64{100}},
+		{Name: "No spec", Values: []float64{1e12}},
+	}
+	fillRate, bandwidth := calibration.PeakRates(counters)
+	assert.For(ctx, "fill rate").That(fillRate).Equals(2e9)
+	assert.For(ctx, "bandwidth").That(bandwidth).Equals(8e9)
+}
+
+func TestFingerprint(t *testing.T) {
+	ctx := log.Testing(t)
+
+	instance := func(serial string) *device.Instance {
+		return &device.Instance{
+			Serial: serial,
+			Name:   "Someone's phone",
+			Configuration: &device.Configuration{
+				OS: &device.OS{Name: "Android", APIVersion: 30},
+				Hardware: &device.Hardware{
+					Name: "Pixel",
+					GPU:  &device.GPU{Name: "Adreno 640", Vendor: "Qualcomm"},
+				},
+			},
+		}
+	}
+	calib := &service.CounterCalibration{Devices: []*service.CounterCalibration_Device{
+		{GpuName: "Adreno 640", FillRate: 2e9, Bandwidth: 8e9, TimerResolution: 52},
+	}}
+
+	a := calibration.Fingerprint(calib, instance("A"))
+	assert.For(ctx, "model").That(a.Model).Equals("Pixel")
+	assert.For(ctx, "api level").That(a.ApiLevel).Equals(int32(30))
+	assert.For(ctx, "fill rate").That(a.FillRate).Equals(2e9)
+	assert.For(ctx, "timer resolution").That(a.TimerResolution).Equals(uint64(52))
+	assert.For(ctx, "anonymous").That(calibration.Fingerprint(calib, instance("B")).Id).Equals(a.Id)
+	assert.For(ctx, "uncalibrated").That(calibration.Fingerprint(nil, instance("A")).Id).NotEquals(a.Id)
+}
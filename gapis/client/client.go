@@ -337,6 +337,30 @@ func (c *client) SaveCapture(ctx context.Context, capture *path.Capture, path st
 	return nil
 }
 
+func (c *client) LoadBundle(ctx context.Context, path string) (*service.LoadedBundle, error) {
+	res, err := c.client.LoadBundle(ctx, &service.LoadBundleRequest{
+		Path: path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetBundle(), nil
+}
+
+func (c *client) SaveBundle(ctx context.Context, req *service.SaveBundleRequest) error {
+	res, err := c.client.SaveBundle(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
 func (c *client) ExportReplay(ctx context.Context, capture *path.Capture, device *path.Device, path string, opts *service.ExportReplayOptions) error {
 	res, err := c.client.ExportReplay(ctx, &service.ExportReplayRequest{
 		Capture: capture,
@@ -540,6 +564,127 @@ func (c *client) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 	return res.GetProfilingData(), nil
 }
 
+func (c *client) GetProfilingHistory(ctx context.Context, req *service.GetProfilingHistoryRequest) (*service.ProfilingHistory, error) {
+	res, err := c.client.GetProfilingHistory(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetHistory(), nil
+}
+
+func (c *client) GetPresets(ctx context.Context, req *service.GetPresetsRequest) (*service.Presets, error) {
+	res, err := c.client.GetPresets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetPresets(), nil
+}
+
+func (c *client) SavePreset(ctx context.Context, req *service.SavePresetRequest) error {
+	res, err := c.client.SavePreset(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
+func (c *client) DeletePreset(ctx context.Context, req *service.DeletePresetRequest) error {
+	res, err := c.client.DeletePreset(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
+func (c *client) GetTimeMapping(ctx context.Context, req *service.GetTimeMappingRequest) (*service.TimeMapping, error) {
+	res, err := c.client.GetTimeMapping(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetMapping(), nil
+}
+
+func (c *client) GetGroupCounterSamples(ctx context.Context, req *service.GetGroupCounterSamplesRequest) (*service.GroupCounterSamples, error) {
+	res, err := c.client.GetGroupCounterSamples(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetSamples(), nil
+}
+
+func (c *client) CreateSession(ctx context.Context, req *service.CreateSessionRequest) (*service.Session, error) {
+	res, err := c.client.CreateSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetSession(), nil
+}
+
+func (c *client) GetSession(ctx context.Context, req *service.GetSessionRequest) (*service.Session, error) {
+	res, err := c.client.GetSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetSession(), nil
+}
+
+func (c *client) CloseSession(ctx context.Context, req *service.CloseSessionRequest) error {
+	res, err := c.client.CloseSession(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
+func (c *client) AcquireFarmDevice(ctx context.Context, req *service.AcquireFarmDeviceRequest) (*service.FarmDevice, error) {
+	res, err := c.client.AcquireFarmDevice(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.GetError(); err != nil {
+		return nil, err.Get()
+	}
+	return res.GetDevice(), nil
+}
+
+func (c *client) ReleaseFarmDevice(ctx context.Context, req *service.ReleaseFarmDeviceRequest) error {
+	res, err := c.client.ReleaseFarmDevice(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := res.GetError(); err != nil {
+		return err.Get()
+	}
+	return nil
+}
+
 func (c *client) GetTimestamps(ctx context.Context, req *service.GetTimestampsRequest, handler service.TimeStampsHandler) error {
 	stream, err := c.client.GetTimestamps(ctx, req)
 	if err != nil {
@@ -0,0 +1,300 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profiling provides a client for profiling captures with GAPIS, for
+// use in automation. It takes care of starting or connecting to the server,
+// loading the capture and choosing a replay device.
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/app/auth"
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/client"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Config holds the settings used to connect to the GAPIS server.
+type Config struct {
+	// Port of a running GAPIS server to connect to. If zero, a new server is
+	// started, which is stopped when the session is closed.
+	Port int
+	// Token used to authenticate with a running server.
+	Token auth.Token
+	// Args are additional command line arguments for a started server.
+	Args []string
+}
+
+// Session is a connection to a GAPIS server with a loaded capture.
+type Session struct {
+	client  client.Client
+	capture *path.Capture
+	isTrace bool
+}
+
+// Open connects to the GAPIS server and loads the capture file.
+func Open(ctx context.Context, cfg Config, capture string) (*Session, error) {
+	token := cfg.Token
+	args := append([]string{"--enable-local-files"}, cfg.Args...)
+	if cfg.Port == 0 {
+		token = auth.GenToken()
+		args = append(args, "--idle-timeout", "1m")
+	}
+	c, err := client.Connect(ctx, client.Config{
+		Port:  cfg.Port,
+		Args:  args,
+		Token: token,
+	})
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to connect to the GAPIS server")
+	}
+
+	s := &Session{client: c}
+	if s.capture, err = c.LoadCapture(ctx, capture); err != nil {
+		c.Close()
+		return nil, log.Errf(ctx, err, "Failed to load the capture %v", capture)
+	}
+	boxed, err := c.Get(ctx, s.capture.Path(), nil)
+	if err != nil {
+		c.Close()
+		return nil, log.Err(ctx, err, "Failed to load the capture")
+	}
+	s.isTrace = boxed.(*service.Capture).Type == service.TraceType_Perfetto
+	return s, nil
+}
+
+// Close closes the connection to the server.
+func (s *Session) Close() error {
+	return s.client.Close()
+}
+
+// Client returns the client of the session's server, for the RPCs not wrapped
+// by the session.
+func (s *Session) Client() client.Client {
+	return s.client
+}
+
+// Capture returns the path to the loaded capture.
+func (s *Session) Capture() *path.Capture {
+	return s.capture
+}
+
+// Devices returns the devices the capture can be replayed and profiled on.
+func (s *Session) Devices(ctx context.Context) ([]*device.Instance, []*path.Device, error) {
+	paths, compatible, _, err := s.client.GetDevicesForReplay(ctx, s.capture)
+	if err != nil {
+		return nil, nil, log.Err(ctx, err, "Failed to query the devices for replay")
+	}
+	devices, devicePaths := []*device.Instance{}, []*path.Device{}
+	for i, p := range paths {
+		if !compatible[i] {
+			continue
+		}
+		boxed, err := s.client.Get(ctx, p.Path(), nil)
+		if err != nil {
+			return nil, nil, log.Err(ctx, err, "Failed to resolve the device")
+		}
+		devices = append(devices, boxed.(*device.Instance))
+		devicePaths = append(devicePaths, p)
+	}
+	return devices, devicePaths, nil
+}
+
+// Device returns the replay device with the given serial or name, or the
+// first replay device if serialOrName is empty.
+func (s *Session) Device(ctx context.Context, serialOrName string) (*path.Device, error) {
+	devices, paths, err := s.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, d := range devices {
+		if serialOrName == "" || d.GetSerial() == serialOrName || d.GetName() == serialOrName {
+			return paths[i], nil
+		}
+	}
+	if serialOrName == "" {
+		return nil, fmt.Errorf("No compatible replay device found")
+	}
+	return nil, fmt.Errorf("No compatible replay device %v found", serialOrName)
+}
+
+// Options are the options of a profile.
+type Options struct {
+	// Device is the device to replay the capture on. If nil, the first
+	// compatible device is used. Unused for Perfetto traces.
+	Device *path.Device
+	// Experiments to apply to the replay.
+	Experiments *service.ProfileExperiments
+	// LoopCount is the number of times the capture is replayed.
+	LoopCount int32
+	// BisectCommandBuffers attributes the counters of submissions to their
+	// individual command buffers.
+	BisectCommandBuffers bool
+	// PrimePipelineCaches runs an untimed replay before profiling.
+	PrimePipelineCaches bool
+	// CounterSpecMergePolicy picks the counter specs used on conflicts.
+	CounterSpecMergePolicy service.CounterSpecMergePolicy
+	// FrameBudget is the target frame time. If set, the frames exceeding it
+	// are flagged in the profile.
+	FrameBudget time.Duration
+	// Session is the server profiling session to profile in, if any.
+	Session *path.ID
+	// MeasureOverhead replays the capture once more without collecting the
+	// counters, to measure the overhead of the counter collection.
+	MeasureOverhead bool
+	// Range is the range of the capture to profile. If nil, the whole
+	// capture is profiled. Unused for Perfetto traces.
+	Range *service.ProfileRange
+	// CounterOverrides fix up the counters reported by the driver.
+	CounterOverrides *service.CounterOverrides
+	// CounterSourcePolicy handles the counters published by several
+	// producers, preferring CounterSource with PreferNamedSource.
+	CounterSourcePolicy service.CounterSourcePolicy
+	CounterSource       string
+	// CounterDedupPolicy handles the counter tracks with the same name.
+	CounterDedupPolicy service.CounterDedupPolicy
+	// IncludeDeviceFingerprint adds the anonymized performance fingerprint
+	// of the device to the profile.
+	IncludeDeviceFingerprint bool
+	// AllCounters collects all the GPU counters of the device, rather than
+	// only the counters of the GPU features used by the capture.
+	AllCounters bool
+	// Validate replays the capture with the validation layers enabled before
+	// profiling it, and adds the issues they report to the profile.
+	Validate bool
+	// SliceDedupPolicy handles the GPU slices duplicated on several tracks.
+	SliceDedupPolicy service.SliceDedupPolicy
+	// IgnoredSlices are the regular expressions of the names of the GPU
+	// slices excluded from the slice aggregates.
+	IgnoredSlices []string
+	// Preset is the name of the server's preset providing the options left
+	// unset.
+	Preset string
+	// ErrorPolicy handles the sections of the profiling data that fail to
+	// process.
+	ErrorPolicy service.ProfilingErrorPolicy
+	// ShaderReplacement, if set, also profiles the capture with the shader
+	// replaced, and reports the difference. Unused for Perfetto traces.
+	ShaderReplacement *service.ShaderReplacement
+	// ResolutionScales, if set, also profiles the capture at each of these
+	// resolution scales. Unused for Perfetto traces.
+	ResolutionScales []float32
+	// SamplerSweep, if set, also profiles the capture with each of these
+	// sampler overrides. Unused for Perfetto traces.
+	SamplerSweep []*service.SamplerOverride
+	// ShadingRate, if set, also profiles the capture with the render passes
+	// shaded at this coarser rate. Unused for Perfetto traces.
+	ShadingRate *service.ShadingRateOverride
+	// CalibrateTimestamps times the command buffers of the replay with
+	// timestamp queries, to verify the GPU clock of the trace. Unused for
+	// Perfetto traces.
+	CalibrateTimestamps bool
+	// CaptureAnalyses are the analyses of the capture's commands added to
+	// the profile. Unused for Perfetto traces.
+	CaptureAnalyses []service.CaptureAnalysis
+}
+
+// Profile profiles the capture and returns the profiling data.
+func (s *Session) Profile(ctx context.Context, opts Options) (*service.ProfilingData, error) {
+	req := &service.GpuProfileRequest{
+		Capture:                  s.capture,
+		Experiments:              opts.Experiments,
+		LoopCount:                opts.LoopCount,
+		BisectCommandBuffers:     opts.BisectCommandBuffers,
+		PrimePipelineCaches:      opts.PrimePipelineCaches,
+		CounterSpecMergePolicy:   opts.CounterSpecMergePolicy,
+		FrameBudget:              uint64(opts.FrameBudget),
+		Session:                  opts.Session,
+		MeasureOverhead:          opts.MeasureOverhead,
+		CounterOverrides:         opts.CounterOverrides,
+		CounterSourcePolicy:      opts.CounterSourcePolicy,
+		CounterSource:            opts.CounterSource,
+		CounterDedupPolicy:       opts.CounterDedupPolicy,
+		IncludeDeviceFingerprint: opts.IncludeDeviceFingerprint,
+		AllCounters:              opts.AllCounters,
+		Validate:                 opts.Validate,
+		SliceDedupPolicy:         opts.SliceDedupPolicy,
+		IgnoredSlices:            opts.IgnoredSlices,
+		Preset:                   opts.Preset,
+		ErrorPolicy:              opts.ErrorPolicy,
+	}
+	if !s.isTrace {
+		req.Device = opts.Device
+		req.Range = opts.Range
+		req.ShaderReplacement = opts.ShaderReplacement
+		req.ResolutionScales = opts.ResolutionScales
+		req.SamplerSweep = opts.SamplerSweep
+		req.ShadingRate = opts.ShadingRate
+		req.CalibrateTimestamps = opts.CalibrateTimestamps
+		req.CaptureAnalyses = opts.CaptureAnalyses
+		if req.Device == nil {
+			d, err := s.Device(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			req.Device = d
+		}
+	}
+	data, err := s.client.GpuProfile(ctx, req)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to profile the capture")
+	}
+	return data, nil
+}
+
+// DeviceProfile is the result of profiling the capture on one of several
+// devices.
+type DeviceProfile struct {
+	Device *path.Device
+	Data   *service.ProfilingData
+	Err    error
+}
+
+// ProfileDevices profiles the capture on all the devices concurrently, using
+// opts for all but the device. Each device runs its own replay and Perfetto
+// session, such that a failure on one device doesn't affect the others. The
+// results are in the order of the devices.
+func (s *Session) ProfileDevices(ctx context.Context, devices []*path.Device, opts Options) []DeviceProfile {
+	res := make([]DeviceProfile, len(devices))
+	wg := sync.WaitGroup{}
+	for i, d := range devices {
+		i, d := i, d
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			o := opts
+			o.Device = d
+			data, err := s.Profile(ctx, o)
+			res[i] = DeviceProfile{Device: d, Data: data, Err: err}
+		})
+	}
+	wg.Wait()
+	return res
+}
+
+// ProfileSummary profiles the capture and returns the summary of the data.
+func (s *Session) ProfileSummary(ctx context.Context, opts Options) (*Summary, error) {
+	data, err := s.Profile(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return Summarize(data), nil
+}
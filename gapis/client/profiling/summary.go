@@ -0,0 +1,125 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// maxTopGroups is the number of most expensive groups in a summary.
+const maxTopGroups = 10
+
+// The names of the time metrics of the groups, as opposed to counter metrics.
+const (
+	gpuTimeMetric     = "GPU Time"
+	gpuWallTimeMetric = "GPU Wall Time"
+)
+
+// Summary is a summary of the profiling data of a capture.
+type Summary struct {
+	// GpuTime is the GPU time of all the top level groups, in nanoseconds.
+	GpuTime uint64
+	// Frames is the number of frames in the profile.
+	Frames int
+	// MedianFrameBusy is the busy GPU time of the median frame, in
+	// nanoseconds.
+	MedianFrameBusy uint64
+	// OverBudgetFrames are the IDs of the frames that exceeded the requested
+	// frame budget. Empty if no budget was requested.
+	OverBudgetFrames []int64
+	// TopGroups are the top level groups with the most GPU time, by
+	// decreasing GPU time.
+	TopGroups []GroupSummary
+	// Counters are the averages of the GPU counters over all groups.
+	Counters []CounterSummary
+	// Errors are the errors of the sections that failed to be processed.
+	Errors []string
+	// Hints are the hints on how to fix the errors, for the errors with a
+	// known fix.
+	Hints []string
+}
+
+// GroupSummary is the summary of a GPU slice group.
+type GroupSummary struct {
+	Name    string
+	GpuTime uint64
+}
+
+// CounterSummary is the summary of a GPU counter.
+type CounterSummary struct {
+	Name    string
+	Unit    string
+	Average float64
+}
+
+// Summarize returns the summary of the profiling data.
+func Summarize(data *service.ProfilingData) *Summary {
+	s := &Summary{}
+
+	gpuTimeID, hasGpuTime := int32(0), false
+	for _, metric := range data.GetGpuCounters().GetMetrics() {
+		switch metric.Name {
+		case gpuTimeMetric:
+			gpuTimeID, hasGpuTime = metric.Id, true
+		case gpuWallTimeMetric:
+		default:
+			s.Counters = append(s.Counters, CounterSummary{metric.Name, metric.Unit, metric.Average})
+		}
+	}
+
+	if hasGpuTime {
+		gpuTimes := map[int32]uint64{}
+		for _, entry := range data.GetGpuCounters().GetEntries() {
+			if perf, ok := entry.MetricToValue[gpuTimeID]; ok {
+				gpuTimes[entry.GroupId] = uint64(perf.Estimate)
+			}
+		}
+		for _, group := range data.GetSlices().GetGroups() {
+			if group.ParentId == 0 {
+				s.GpuTime += gpuTimes[group.Id]
+				s.TopGroups = append(s.TopGroups, GroupSummary{group.Name, gpuTimes[group.Id]})
+			}
+		}
+		sort.SliceStable(s.TopGroups, func(i, j int) bool {
+			return s.TopGroups[i].GpuTime > s.TopGroups[j].GpuTime
+		})
+		if len(s.TopGroups) > maxTopGroups {
+			s.TopGroups = s.TopGroups[:maxTopGroups]
+		}
+	}
+
+	s.Frames = len(data.GetGpuIdle().GetFrames())
+	for _, frame := range data.GetRepresentativeFrames().GetFrames() {
+		if frame.Kind == service.ProfilingData_FrameSelection_Median {
+			s.MedianFrameBusy = frame.Busy
+		}
+	}
+
+	for _, frame := range data.GetFrameBudget().GetFrames() {
+		if frame.Exceeded {
+			s.OverBudgetFrames = append(s.OverBudgetFrames, frame.FrameId)
+		}
+	}
+
+	for _, e := range data.GetErrors() {
+		s.Errors = append(s.Errors, e.Error)
+		if e.Remediation != "" {
+			s.Hints = append(s.Hints, e.Remediation)
+		}
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSummarize(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1, Name: "A"},
+				{Id: 2, Name: "B"},
+				{Id: 3, Name: "B.1", ParentId: 2},
+			},
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: 0, Name: "GPU Time"},
+				{Id: 1, Name: "GPU Wall Time"},
+				{Id: 2, Name: "Fragments", Unit: "25", Average: 42},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{
+				{GroupId: 1, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{0: {Estimate: 100}}},
+				{GroupId: 2, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{0: {Estimate: 300}}},
+				{GroupId: 3, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{0: {Estimate: 200}}},
+			},
+		},
+		RepresentativeFrames: &service.ProfilingData_FrameSelection{
+			Frames: []*service.ProfilingData_FrameSelection_Frame{
+				{Kind: service.ProfilingData_FrameSelection_Median, Busy: 50},
+				{Kind: service.ProfilingData_FrameSelection_Worst, Busy: 90},
+			},
+		},
+		FrameBudget: &service.ProfilingData_FrameBudget{
+			Frames: []*service.ProfilingData_FrameBudget_Frame{
+				{FrameId: 1},
+				{FrameId: 2, Exceeded: true},
+			},
+		},
+		Errors: []*service.ProfilingData_SectionError{
+			{Section: service.ProfilingData_SectionError_Markers, Error: "failed"},
+			{Section: service.ProfilingData_SectionError_Slices, Error: "misaligned", Code: service.ProfilingErrorCode_ClockSyncMissing, Remediation: "restart"},
+		},
+	}
+
+	s := Summarize(data)
+	assert.For(ctx, "GpuTime").That(s.GpuTime).Equals(uint64(400))
+	assert.For(ctx, "MedianFrameBusy").That(s.MedianFrameBusy).Equals(uint64(50))
+	assert.For(ctx, "TopGroups").ThatSlice(s.TopGroups).Equals([]GroupSummary{{"B", 300}, {"A", 100}})
+	assert.For(ctx, "Counters").ThatSlice(s.Counters).Equals([]CounterSummary{{"Fragments", "25", 42}})
+	assert.For(ctx, "OverBudgetFrames").ThatSlice(s.OverBudgetFrames).Equals([]int64{2})
+	assert.For(ctx, "Errors").ThatSlice(s.Errors).Equals([]string{"failed", "misaligned"})
+	assert.For(ctx, "Hints").ThatSlice(s.Hints).Equals([]string{"restart"})
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history implements a persistent store of the GPU profiling runs
+// performed by the server, allowing to compare measurements across sessions.
+//
+// The runs are stored in a single file as a sequence of length prefixed
+// ProfilingRun protos, which is only ever appended to.
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// DB is a persistent database of profiling runs. A nil DB is valid and does
+// not record anything.
+type DB struct {
+	mutex sync.Mutex
+	path  string
+	runs  []*service.ProfilingRun
+}
+
+// Open opens, or creates, the database stored in the file at path. A
+// truncated last record, left by an interrupted write, is dropped and the
+// file is truncated to the end of the last complete record, so that the runs
+// added later can be read back.
+func Open(ctx context.Context, path string) (*DB, error) {
+	db := &DB{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the profiling history %v", path)
+	}
+
+	offset := 0
+	for offset < len(data) {
+		size, n := binary.Uvarint(data[offset:])
+		if n < 0 {
+			return nil, log.Errf(ctx, nil, "Corrupt profiling history %v: invalid record size at %d", path, offset)
+		}
+		if n == 0 || uint64(len(data)-offset-n) < size {
+			break
+		}
+		run := &service.ProfilingRun{}
+		if err := proto.Unmarshal(data[offset+n:offset+n+int(size)], run); err != nil {
+			return nil, log.Errf(ctx, err, "Corrupt profiling history %v", path)
+		}
+		db.runs = append(db.runs, run)
+		offset += n + int(size)
+	}
+
+	if offset < len(data) {
+		log.W(ctx, "Dropping truncated record from the profiling history %v", path)
+		if err := os.Truncate(path, int64(offset)); err != nil {
+			return nil, log.Errf(ctx, err, "Failed to truncate the profiling history %v", path)
+		}
+	}
+	return db, nil
+}
+
+// Add appends the run to the database.
+func (db *DB) Add(ctx context.Context, run *service.ProfilingRun) error {
+	if db == nil {
+		return nil
+	}
+
+	data, err := proto.Marshal(run)
+	if err != nil {
+		return err
+	}
+	buf := bytes.Buffer{}
+	size := make([]byte, binary.MaxVarintLen64)
+	buf.Write(size[:binary.PutUvarint(size, uint64(len(data)))])
+	buf.Write(data)
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(db.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to open the profiling history %v", db.path)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return log.Errf(ctx, err, "Failed to write the profiling history %v", db.path)
+	}
+	db.runs = append(db.runs, run)
+	return nil
+}
+
+// Query returns all the runs matching the predicate, oldest first. A nil
+// predicate matches all runs.
+func (db *DB) Query(pred func(*service.ProfilingRun) bool) []*service.ProfilingRun {
+	if db == nil {
+		return nil
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	res := []*service.ProfilingRun{}
+	for _, run := range db.runs {
+		if pred == nil || pred(run) {
+			res = append(res, run)
+		}
+	}
+	return res
+}
+
+// NewRun returns the summary of the profiling data of the given capture,
+// profiled on the given device.
+func NewRun(capture *path.Capture, captureName string, d *device.Instance, data *service.ProfilingData) *service.ProfilingRun {
+	run := &service.ProfilingRun{
+		Timestamp:    time.Now().UnixNano(),
+		CaptureId:    capture.GetID(),
+		CaptureName:  captureName,
+		DeviceName:   d.GetName(),
+		DeviceSerial: d.GetSerial(),
+		GpuName:      d.GetConfiguration().GetHardware().GetGPU().GetName(),
+	}
+	for _, metric := range data.GetGpuCounters().GetMetrics() {
+		run.Metrics = append(run.Metrics, &service.ProfilingRun_Metric{
+			Name:    metric.Name,
+			Unit:    metric.Unit,
+			Average: metric.Average,
+		})
+	}
+	return run
+}
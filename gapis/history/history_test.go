@@ -0,0 +1,85 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/history"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestTornWrite(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "history")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+
+	db, err := history.Open(ctx, file)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "err").ThatError(db.Add(ctx, &service.ProfilingRun{CaptureName: "first"})).Succeeded()
+	info, err := os.Stat(file)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	good := info.Size()
+	assert.For(ctx, "err").ThatError(db.Add(ctx, &service.ProfilingRun{CaptureName: "second"})).Succeeded()
+
+	for _, test := range []struct {
+		name string
+		tear func() error
+	}{
+		// The write of the second record was interrupted in its data.
+		{"data", func() error { return os.Truncate(file, good+3) }},
+		// The write of the second record was interrupted in its size.
+		{"size", func() error {
+			if err := os.Truncate(file, good); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte{0x80})
+			return err
+		}},
+	} {
+		ctx := log.Enter(ctx, test.name)
+		assert.For(ctx, "tear").ThatError(test.tear()).Succeeded()
+
+		db, err := history.Open(ctx, file)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		runs := db.Query(nil)
+		assert.For(ctx, "runs").That(len(runs)).Equals(1)
+		info, err := os.Stat(file)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		assert.For(ctx, "truncated").That(info.Size()).Equals(good)
+
+		// The runs added after the recovery are read back.
+		assert.For(ctx, "err").ThatError(db.Add(ctx, &service.ProfilingRun{CaptureName: "second"})).Succeeded()
+		db, err = history.Open(ctx, file)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		runs = db.Query(nil)
+		if assert.For(ctx, "runs").That(len(runs)).Equals(2) {
+			assert.For(ctx, "first").That(runs[0].CaptureName).Equals("first")
+			assert.For(ctx, "second").That(runs[1].CaptureName).Equals("second")
+		}
+	}
+}
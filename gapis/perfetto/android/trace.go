@@ -102,7 +102,7 @@ func SetupProfileLayersSource(ctx context.Context, d adb.Device, apk *android.In
 }
 
 // setupProfileLayers configures the device to allow the app being traced to load the layers required for render stage profiling
-func setupProfileLayers(ctx context.Context, d adb.Device, packageName string, hasRenderStages bool, abi *device.ABI, profileLayerPackages []string, layers []string) (app.Cleanup, error) {
+func setupProfileLayers(ctx context.Context, d adb.Device, packageName string, hasRenderStages bool, abi *device.ABI, profileLayerPackages []string, layers []string, extraLayers []android.Layer) (app.Cleanup, error) {
 	packages := []string{}
 	enabledLayers := []string{}
 
@@ -111,6 +111,13 @@ func setupProfileLayers(ctx context.Context, d adb.Device, packageName string, h
 		enabledLayers = append(enabledLayers, layers...)
 	}
 
+	for _, l := range extraLayers {
+		if l.Package != "" {
+			packages = append(packages, l.Package)
+		}
+		enabledLayers = append(enabledLayers, l.Name)
+	}
+
 	// Setup render stage layer. Render stage layer should be at the bottom (end of list).
 	if hasRenderStages && d.Instance().GetConfiguration().GetPerfettoCapability().GetGpuProfiling().GetHasRenderStageProducerLayer() {
 		packages = append(packages, profileLayerPackages...)
@@ -121,11 +128,17 @@ func setupProfileLayers(ctx context.Context, d adb.Device, packageName string, h
 	if err != nil {
 		return cleanup.Invoke(ctx), log.Err(ctx, err, "Failed to setup GPU activity producer environment.")
 	}
+	nextCleanup, err := android.SetupLayerSettings(ctx, d, extraLayers)
+	cleanup = cleanup.Then(nextCleanup)
+	if err != nil {
+		return cleanup.Invoke(ctx), log.Err(ctx, err, "Failed to setup the Vulkan layer settings.")
+	}
 	return cleanup, nil
 }
 
-// Start optional starts an app and sets up a Perfetto trace
-func Start(ctx context.Context, d adb.Device, a *android.ActivityAction, opts *service.TraceOptions, abi *device.ABI, layers []string) (*Process, app.Cleanup, error) {
+// Start optional starts an app and sets up a Perfetto trace. The extraLayers
+// are loaded by the app in addition to the profiling layers.
+func Start(ctx context.Context, d adb.Device, a *android.ActivityAction, opts *service.TraceOptions, abi *device.ABI, layers []string, extraLayers []android.Layer) (*Process, app.Cleanup, error) {
 	ctx = log.Enter(ctx, "start")
 
 	if abi != nil {
@@ -155,7 +168,7 @@ func Start(ctx context.Context, d adb.Device, a *android.ActivityAction, opts *s
 
 		// Setup the profiling layers.
 		hasRenderStages := hasDataSourceEnabled(opts.PerfettoConfig, gpuRenderStagesDataSourceName)
-		nextCleanup, err = setupProfileLayers(ctx, d, a.Package.Name, hasRenderStages, abi, packages, layers)
+		nextCleanup, err = setupProfileLayers(ctx, d, a.Package.Name, hasRenderStages, abi, packages, layers, extraLayers)
 		cleanup = cleanup.Then(nextCleanup)
 		if err != nil {
 			return nil, cleanup.Invoke(ctx), err
@@ -15,8 +15,11 @@
  */
 
 #include <google/protobuf/text_format.h>
+#include <stdint.h>
 #include <string.h>
 
+#include <vector>
+
 #include "gapis/perfetto/service/perfetto.pb.h"
 #include "perfetto/trace_processor/trace_processor.h"
 
@@ -46,25 +49,23 @@ bool parse_data(processor processor, const void* data, size_t size) {
   return true;
 }
 
-result execute_query(processor processor, const char* query) {
-  ptp::TraceProcessor* p = static_cast<ptp::TraceProcessor*>(processor);
-  p::QueryResult raw;
-
-  auto it = p->ExecuteQuery(query);
-
-  for (uint32_t col = 0; col < it.ColumnCount(); col++) {
-    auto* descriptor = raw.add_column_descriptors();
-    descriptor->set_name(it.GetColumnName(col));
-    descriptor->set_type(p::QueryResult::ColumnDesc::UNKNOWN);
-    raw.add_columns();
-  }
+namespace {
 
+// Appends at most max_rows rows of the iterator to the result, converting the
+// values to the types of the columns. Returns the number of rows appended, and
+// sets done if the iterator has no more rows.
+uint32_t append_rows(ptp::Iterator* it, p::QueryResult* raw, uint32_t max_rows,
+                     bool* done) {
   uint32_t rows = 0;
-  for (; it.Next(); rows++) {
-    for (uint32_t col = 0; col < it.ColumnCount(); col++) {
-      auto* column = raw.mutable_columns(static_cast<int>(col));
-      auto* desc = raw.mutable_column_descriptors(static_cast<int>(col));
-      auto value = it.Get(col);
+  for (; rows < max_rows; rows++) {
+    if (!it->Next()) {
+      *done = true;
+      break;
+    }
+    for (uint32_t col = 0; col < it->ColumnCount(); col++) {
+      auto* column = raw->mutable_columns(static_cast<int>(col));
+      auto* desc = raw->mutable_column_descriptors(static_cast<int>(col));
+      auto value = it->Get(col);
 
       switch (desc->type() << 8 | value.type) {
         // Nulls.
@@ -133,19 +134,82 @@ result execute_query(processor processor, const char* query) {
       }
     }
   }
+  return rows;
+}
 
-  raw.set_num_records(rows);
+// Adds the column descriptors of the iterator to the result, with the given
+// types, or UNKNOWN if the types are not known yet.
+void add_columns(ptp::Iterator* it, p::QueryResult* raw,
+                 const std::vector<p::QueryResult::ColumnDesc::Type>& types) {
+  for (uint32_t col = 0; col < it->ColumnCount(); col++) {
+    auto* descriptor = raw->add_column_descriptors();
+    descriptor->set_name(it->GetColumnName(col));
+    descriptor->set_type(col < types.size()
+                             ? types[col]
+                             : p::QueryResult::ColumnDesc::UNKNOWN);
+    raw->add_columns();
+  }
+}
 
-  auto status = it.Status();
+result serialize(ptp::Iterator* it, p::QueryResult* raw) {
+  auto status = it->Status();
   if (!status.ok()) {
-    raw.set_error(status.message());
+    raw->set_error(status.message());
   }
 
   result res;
-  res.size = raw.ByteSizeLong();
+  res.size = raw->ByteSizeLong();
   res.data = new uint8_t[res.size];
-  raw.SerializeWithCachedSizesToArray(res.data);
+  raw->SerializeWithCachedSizesToArray(res.data);
   return res;
 }
 
+// query_state is the state of a query started by start_query.
+struct query_state {
+  explicit query_state(ptp::Iterator it) : it(std::move(it)) {}
+
+  ptp::Iterator it;
+  // The types of the columns seen in the previous batches.
+  std::vector<p::QueryResult::ColumnDesc::Type> types;
+  bool done = false;
+};
+
+}  // namespace
+
+result execute_query(processor processor, const char* query) {
+  ptp::TraceProcessor* p = static_cast<ptp::TraceProcessor*>(processor);
+  p::QueryResult raw;
+
+  auto it = p->ExecuteQuery(query);
+  add_columns(&it, &raw, {});
+  bool done = false;
+  raw.set_num_records(append_rows(&it, &raw, UINT32_MAX, &done));
+  return serialize(&it, &raw);
+}
+
+query start_query(processor processor, const char* query) {
+  ptp::TraceProcessor* p = static_cast<ptp::TraceProcessor*>(processor);
+  return new query_state(p->ExecuteQuery(query));
+}
+
+result next_rows(query query, uint32_t max_rows) {
+  query_state* q = static_cast<query_state*>(query);
+  p::QueryResult raw;
+
+  add_columns(&q->it, &raw, q->types);
+  uint32_t rows = 0;
+  if (!q->done) {
+    rows = append_rows(&q->it, &raw, max_rows, &q->done);
+  }
+  raw.set_num_records(rows);
+
+  q->types.clear();
+  for (const auto& desc : raw.column_descriptors()) {
+    q->types.push_back(desc.type());
+  }
+  return serialize(&q->it, &raw);
+}
+
+void end_query(query query) { delete static_cast<query_state*>(query); }
+
 void delete_processor(processor processor) { free(processor); }
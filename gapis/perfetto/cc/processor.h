@@ -26,6 +26,7 @@ extern "C" {
 #endif
 
 typedef void* processor;
+typedef void* query;
 
 typedef struct {
   size_t size;
@@ -35,6 +36,12 @@ typedef struct {
 processor new_processor();
 bool parse_data(processor processor, const void* data, size_t size);
 result execute_query(processor processor, const char* query);
+// Starts a query whose rows are returned in batches by next_rows, which
+// returns no rows once all rows were returned. The query must be ended by
+// end_query.
+query start_query(processor processor, const char* query);
+result next_rows(query query, uint32_t max_rows);
+void end_query(query query);
 void delete_processor(processor processor);
 
 #ifdef __cplusplus
@@ -19,6 +19,7 @@ package perfetto
 import "C"
 import (
 	"context"
+	"errors"
 	"sync"
 	"unsafe"
 
@@ -63,6 +64,39 @@ func (p *Processor) Query(q string) (*service.QueryResult, error) {
 	return r, err
 }
 
+// QueryStreaming runs the query and calls cb with the rows of its result in
+// batches of at most batchRows rows, instead of returning all the rows at once.
+// Every batch has the column descriptors of the query. Returning an error from
+// cb stops the query and the error is returned.
+func (p *Processor) QueryStreaming(q string, batchRows int, cb func(*service.QueryResult) error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	qPtr := C.CString(q)
+	query := C.start_query(p.handle, qPtr)
+	defer C.end_query(query)
+	C.free(unsafe.Pointer(qPtr))
+
+	for {
+		r := &service.QueryResult{}
+		res := C.next_rows(query, C.uint32_t(batchRows))
+		err := proto.Unmarshal((*[1 << 31]byte)(unsafe.Pointer(res.data))[:int(res.size)], r)
+		C.free(unsafe.Pointer(res.data))
+		if err != nil {
+			return err
+		}
+		if r.GetError() != "" {
+			return errors.New(r.GetError())
+		}
+		if r.GetNumRecords() == 0 {
+			return nil
+		}
+		if err := cb(r); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *Processor) Close() {
 	if p == nil {
 		return
@@ -0,0 +1,97 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package perfetto
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/gapid/gapis/perfetto/service"
+)
+
+// Querier is the interface implemented by types that can run trace processor
+// queries, such as the Processor.
+type Querier interface {
+	Query(q string) (*service.QueryResult, error)
+}
+
+// StreamingQuerier is the interface implemented by Queriers that can return
+// the rows of a query result in batches, such as the Processor.
+type StreamingQuerier interface {
+	Querier
+	QueryStreaming(q string, batchRows int, cb func(*service.QueryResult) error) error
+}
+
+var (
+	_ = Querier(&Processor{})
+	_ = StreamingQuerier(&Processor{})
+	_ = Querier(&QueryRecorder{})
+	_ = Querier(QueryPlayer{})
+)
+
+// QueryRecorder is a Querier that records the results of all the queries run
+// on the wrapped Querier.
+type QueryRecorder struct {
+	querier Querier
+	mutex   sync.Mutex
+	queries []string
+	results map[string]*service.QueryResult
+}
+
+// NewQueryRecorder returns a new QueryRecorder wrapping querier.
+func NewQueryRecorder(querier Querier) *QueryRecorder {
+	return &QueryRecorder{
+		querier: querier,
+		results: map[string]*service.QueryResult{},
+	}
+}
+
+// Query runs the query on the wrapped Querier and records its result.
+func (r *QueryRecorder) Query(q string) (*service.QueryResult, error) {
+	res, err := r.querier.Query(q)
+	if err != nil {
+		return res, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.results[q]; !ok {
+		r.queries = append(r.queries, q)
+	}
+	r.results[q] = res
+	return res, nil
+}
+
+// Recorded calls cb for each successfully run query and its result, in the
+// order the queries were first run.
+func (r *QueryRecorder) Recorded(cb func(q string, res *service.QueryResult)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, q := range r.queries {
+		cb(q, r.results[q])
+	}
+}
+
+// QueryPlayer is a Querier that returns previously recorded query results,
+// keyed by the query.
+type QueryPlayer map[string]*service.QueryResult
+
+// Query returns the recorded result of the query.
+func (p QueryPlayer) Query(q string) (*service.QueryResult, error) {
+	if res, ok := p[q]; ok {
+		return res, nil
+	}
+	return nil, fmt.Errorf("No recorded result for query: %v", q)
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package presets implements the store of the named capture and profiling
+// presets of the server, such that teams measure with the same tracing and
+// profiling configurations. The presets are stored in a single text format
+// Presets proto, which can also be edited by hand and checked in.
+package presets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+// Store is a persistent store of presets. A nil Store is valid, holds no
+// presets and can't be modified.
+type Store struct {
+	mutex   sync.Mutex
+	path    string
+	presets map[string]*service.Preset
+}
+
+// Open opens, or creates, the store kept in the file at path.
+func Open(ctx context.Context, path string) (*Store, error) {
+	s := &Store{path: path, presets: map[string]*service.Preset{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the presets %v", path)
+	}
+	presets := &service.Presets{}
+	if err := proto.UnmarshalText(string(data), presets); err != nil {
+		return nil, log.Errf(ctx, err, "Failed to parse the presets %v", path)
+	}
+	for _, p := range presets.Presets {
+		s.presets[p.Name] = p
+	}
+	return s, nil
+}
+
+// Get returns the preset with the given name.
+func (s *Store) Get(name string) (*service.Preset, error) {
+	if s == nil {
+		return nil, fmt.Errorf("Unknown preset %q: the server stores no presets", name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, ok := s.presets[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown preset %q", name)
+	}
+	return p, nil
+}
+
+// List returns all the presets, sorted by name.
+func (s *Store) List() *service.Presets {
+	res := &service.Presets{}
+	if s == nil {
+		return res
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.presets {
+		res.Presets = append(res.Presets, p)
+	}
+	sort.Slice(res.Presets, func(i, j int) bool {
+		return res.Presets[i].Name < res.Presets[j].Name
+	})
+	return res
+}
+
+// Save adds the preset to the store, replacing any preset of the same name.
+// The target of the preset's options, i.e. the device, application and
+// capture, is dropped.
+func (s *Store) Save(ctx context.Context, preset *service.Preset) error {
+	if s == nil {
+		return fmt.Errorf("The server stores no presets")
+	}
+	if preset.GetName() == "" {
+		return fmt.Errorf("The preset has no name")
+	}
+
+	preset = proto.Clone(preset).(*service.Preset)
+	if t := preset.Trace; t != nil {
+		t.Device, t.App, t.ServerLocalSavePath, t.Preset = nil, nil, "", ""
+	}
+	if p := preset.Profile; p != nil {
+		p.Capture, p.Device, p.Session, p.Preset = nil, nil, nil, ""
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, existed := s.presets[preset.Name]
+	s.presets[preset.Name] = preset
+	if err := s.write(ctx); err != nil {
+		if existed {
+			s.presets[preset.Name] = old
+		} else {
+			delete(s.presets, preset.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the preset with the given name from the store.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if s == nil {
+		return fmt.Errorf("The server stores no presets")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, ok := s.presets[name]
+	if !ok {
+		return fmt.Errorf("Unknown preset %q", name)
+	}
+	delete(s.presets, name)
+	if err := s.write(ctx); err != nil {
+		s.presets[name] = old
+		return err
+	}
+	return nil
+}
+
+// write writes the presets to the file of the store. Must be called with the
+// mutex locked.
+func (s *Store) write(ctx context.Context) error {
+	presets := &service.Presets{}
+	for _, p := range s.presets {
+		presets.Presets = append(presets.Presets, p)
+	}
+	sort.Slice(presets.Presets, func(i, j int) bool {
+		return presets.Presets[i].Name < presets.Presets[j].Name
+	})
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path, []byte(proto.MarshalTextString(presets)), 0644); err != nil {
+		return log.Errf(ctx, err, "Failed to write the presets %v", s.path)
+	}
+	return nil
+}
+
+// ApplyToTrace returns the tracing options of the request, with the options
+// it leaves unset taken from its preset, if any. A Perfetto config, Vulkan
+// layer config or triggers in the request replace those of the preset.
+func (s *Store) ApplyToTrace(opts *service.TraceOptions) (*service.TraceOptions, error) {
+	if opts.GetPreset() == "" {
+		return opts, nil
+	}
+	preset, err := s.Get(opts.Preset)
+	if err != nil {
+		return nil, err
+	}
+	res := &service.TraceOptions{}
+	if preset.Trace != nil {
+		res = proto.Clone(preset.Trace).(*service.TraceOptions)
+	}
+	if opts.PerfettoConfig != nil {
+		res.PerfettoConfig = nil
+	}
+	if opts.VulkanLayers != nil {
+		res.VulkanLayers = nil
+	}
+	if opts.Triggers != nil {
+		res.Triggers = nil
+	}
+	proto.Merge(res, opts)
+	return res, nil
+}
+
+// ApplyToProfile returns the profiling request, with the options it leaves
+// unset taken from its preset, if any. The ignored slices of the request are
+// added to those of the preset, and counter overrides in the request replace
+// those of the preset.
+func (s *Store) ApplyToProfile(req *service.GpuProfileRequest) (*service.GpuProfileRequest, error) {
+	if req.GetPreset() == "" {
+		return req, nil
+	}
+	preset, err := s.Get(req.Preset)
+	if err != nil {
+		return nil, err
+	}
+	res := &service.GpuProfileRequest{}
+	if preset.Profile != nil {
+		res = proto.Clone(preset.Profile).(*service.GpuProfileRequest)
+	}
+	if req.CounterOverrides != nil {
+		res.CounterOverrides = nil
+	}
+	proto.Merge(res, req)
+	return res, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package presets_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/presets"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestStore(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "presets")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "presets.textproto")
+
+	s, err := presets.Open(ctx, file)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "empty").That(len(s.List().Presets)).Equals(0)
+
+	err = s.Save(ctx, &service.Preset{
+		Name:  "smoke",
+		Trace: &service.TraceOptions{Duration: 5, Device: &path.Device{ID: &path.ID{}}},
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	err = s.Save(ctx, &service.Preset{
+		Name:    "full",
+		Profile: &service.GpuProfileRequest{AllCounters: true},
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "unnamed").ThatError(s.Save(ctx, &service.Preset{})).Failed()
+
+	// The presets persist across opens.
+	s, err = presets.Open(ctx, file)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	list := s.List().Presets
+	assert.For(ctx, "count").That(len(list)).Equals(2)
+	assert.For(ctx, "first").That(list[0].Name).Equals("full")
+	assert.For(ctx, "second").That(list[1].Name).Equals("smoke")
+	assert.For(ctx, "duration").That(list[1].Trace.Duration).Equals(float32(5))
+	assert.For(ctx, "device dropped").That(list[1].Trace.Device).IsNil()
+
+	assert.For(ctx, "delete").ThatError(s.Delete(ctx, "smoke")).Succeeded()
+	assert.For(ctx, "delete unknown").ThatError(s.Delete(ctx, "smoke")).Failed()
+	_, err = s.Get("smoke")
+	assert.For(ctx, "get deleted").ThatError(err).Failed()
+}
+
+func TestApply(t *testing.T) {
+	ctx := log.Testing(t)
+	dir, err := ioutil.TempDir("", "presets")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	defer os.RemoveAll(dir)
+
+	s, err := presets.Open(ctx, filepath.Join(dir, "presets.textproto"))
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	err = s.Save(ctx, &service.Preset{
+		Name:  "team",
+		Trace: &service.TraceOptions{Duration: 10, NoBuffer: true},
+		Profile: &service.GpuProfileRequest{
+			AllCounters:   true,
+			FrameBudget:   16600000,
+			IgnoredSlices: []string{"^Driver"},
+		},
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	opts, err := s.ApplyToTrace(&service.TraceOptions{Preset: "team", Duration: 3})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "request duration").That(opts.Duration).Equals(float32(3))
+	assert.For(ctx, "preset no buffer").That(opts.NoBuffer).Equals(true)
+
+	req, err := s.ApplyToProfile(&service.GpuProfileRequest{Preset: "team", IgnoredSlices: []string{"Flush"}})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "all counters").That(req.AllCounters).Equals(true)
+	assert.For(ctx, "budget").That(req.FrameBudget).Equals(uint64(16600000))
+	assert.For(ctx, "ignored").ThatSlice(req.IgnoredSlices).Equals([]string{"^Driver", "Flush"})
+
+	_, err = s.ApplyToProfile(&service.GpuProfileRequest{Preset: "unknown"})
+	assert.For(ctx, "unknown preset").ThatError(err).Failed()
+
+	noPreset := &service.GpuProfileRequest{FrameBudget: 1}
+	req, err = s.ApplyToProfile(noPreset)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "unchanged").That(req).Equals(noPreset)
+}
@@ -17,13 +17,20 @@ package replay
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/trace"
+	"github.com/google/gapid/gapis/trace/android/gfxstream"
+	"github.com/google/gapid/gapis/trace/android/profile"
 
 	perfetto_pb "protos/perfetto/config"
 )
@@ -35,9 +42,118 @@ const (
 	durationMs                              = 30000
 	gpuCountersDataSourceDescriptorName     = "gpu.counters"
 	gpuRenderStagesDataSourceDescriptorName = "gpu.renderstages"
+	ftraceDataSourceDescriptorName          = "linux.ftrace"
+	processStatsDataSourceDescriptorName    = "linux.process_stats"
+	graphicsFrameDataSourceDescriptorName   = "android.graphics.frame"
 )
 
-func getPerfettoConfig(ctx context.Context, device *path.Device) (*perfetto_pb.TraceConfig, error) {
+// featureCounters describe the GPU counters that only measure the work of a
+// GPU feature: the counters of the feature's counter group, or if the spec
+// has no groups, the counters with one of the feature's keywords, sequences
+// of whole words, in their names.
+var featureCounters = []struct {
+	used     func(f *CaptureFeatures) bool
+	group    device.GpuCounterDescriptor_GpuCounterGroup
+	keywords [][]string
+}{
+	{func(f *CaptureFeatures) bool { return f.Tessellation }, device.GpuCounterDescriptor_UNCLASSIFIED,
+		[][]string{{"tessellation"}, {"tessellated"}, {"tess"}, {"hull"}, {"domain", "shader"}}},
+	{func(f *CaptureFeatures) bool { return f.Geometry }, device.GpuCounterDescriptor_UNCLASSIFIED,
+		[][]string{{"geometry", "shader"}, {"gs"}}},
+	{func(f *CaptureFeatures) bool { return f.Compute }, device.GpuCounterDescriptor_COMPUTE,
+		[][]string{{"compute"}}},
+}
+
+// sharedCounterWords are words of the names of the GPU counters that measure
+// the work of the vertex or fragment stages, e.g. Mali's "Vertex and compute"
+// counters, which are kept even if they have a feature's keyword too.
+var sharedCounterWords = map[string]bool{
+	"vertex":    true,
+	"vertices":  true,
+	"fragment":  true,
+	"fragments": true,
+	"pixel":     true,
+	"pixels":    true,
+}
+
+// selectCounters returns the IDs of the counters to collect. If features is
+// not nil, the counters of the features the capture doesn't use are skipped.
+func selectCounters(ctx context.Context, specs []*device.GpuCounterDescriptor_GpuCounterSpec, features *CaptureFeatures) []uint32 {
+	ids := make([]uint32, 0, len(specs))
+	skipped := []string{}
+	for _, s := range specs {
+		if features != nil && isUnusedFeatureCounter(s, features) {
+			skipped = append(skipped, s.GetName())
+			continue
+		}
+		ids = append(ids, s.GetCounterId())
+	}
+	if len(skipped) > 0 {
+		log.I(ctx, "Skipping %d counters of GPU features the capture doesn't use: %v", len(skipped), strings.Join(skipped, ", "))
+	}
+	return ids
+}
+
+// isUnusedFeatureCounter returns whether the counter only measures the work
+// of GPU features the capture doesn't use.
+func isUnusedFeatureCounter(spec *device.GpuCounterDescriptor_GpuCounterSpec, features *CaptureFeatures) bool {
+	words := strings.FieldsFunc(strings.ToLower(spec.GetName()), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	shared := false
+	for _, w := range words {
+		shared = shared || sharedCounterWords[w]
+	}
+	for _, f := range featureCounters {
+		if f.used(features) {
+			continue
+		}
+		if groups := spec.GetGroups(); len(groups) > 0 {
+			if f.group != device.GpuCounterDescriptor_UNCLASSIFIED && onlyGroup(groups, f.group) {
+				return true
+			}
+			continue
+		}
+		if shared {
+			continue
+		}
+		for _, k := range f.keywords {
+			if hasWords(words, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// onlyGroup returns whether all the groups are the given group.
+func onlyGroup(groups []device.GpuCounterDescriptor_GpuCounterGroup, group device.GpuCounterDescriptor_GpuCounterGroup) bool {
+	for _, g := range groups {
+		if g != group {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWords returns whether the words contain the sequence of words seq.
+func hasWords(words, seq []string) bool {
+	for i := 0; i+len(seq) <= len(words); i++ {
+		match := true
+		for j, w := range seq {
+			if words[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func getPerfettoConfig(ctx context.Context, device *path.Device, features *CaptureFeatures) (*perfetto_pb.TraceConfig, error) {
 	t, err := trace.GetTracer(ctx, device)
 	if err != nil {
 		err = log.Errf(ctx, err, "Failed to find tracer for %v", device)
@@ -45,10 +161,7 @@ func getPerfettoConfig(ctx context.Context, device *path.Device) (*perfetto_pb.T
 	}
 	d := t.GetDevice()
 	specs := d.Instance().GetConfiguration().GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor().GetSpecs()
-	ids := make([]uint32, len(specs))
-	for i, s := range specs {
-		ids[i] = s.GetCounterId()
-	}
+	ids := selectCounters(ctx, specs, features)
 	conf := &perfetto_pb.TraceConfig{
 		Buffers: []*perfetto_pb.TraceConfig_BufferConfig{
 			{SizeKb: proto.Uint32(bufferSizeKb)},
@@ -69,17 +182,117 @@ func getPerfettoConfig(ctx context.Context, device *path.Device) (*perfetto_pb.T
 					},
 				},
 			},
+			// The scheduling and frequency data is used to attribute the CPU
+			// time to threads and to detect scheduler induced slowdowns.
+			{
+				Config: &perfetto_pb.DataSourceConfig{
+					Name: proto.String(ftraceDataSourceDescriptorName),
+					FtraceConfig: &perfetto_pb.FtraceConfig{
+						FtraceEvents: []string{"sched/sched_switch", "power/cpu_frequency"},
+					},
+				},
+			},
+			{
+				Config: &perfetto_pb.DataSourceConfig{
+					Name: proto.String(processStatsDataSourceDescriptorName),
+					ProcessStatsConfig: &perfetto_pb.ProcessStatsConfig{
+						ScanAllProcessesOnStart: proto.Bool(true),
+					},
+				},
+			},
+			// The buffer queue events measure the time from queuing a frame
+			// to the compositor to it being displayed.
+			{
+				Config: &perfetto_pb.DataSourceConfig{
+					Name: proto.String(graphicsFrameDataSourceDescriptorName),
+				},
+			},
 		},
 	}
+	if gfxstream.IsEmulator(d.Instance()) {
+		// Emulators have no render stages or counters, the host-side timings
+		// of gfxstream stand in for the GPU slices.
+		conf.DataSources = append(conf.DataSources, gfxstream.DataSource())
+	}
 	return conf, nil
 }
 
-// GpuProfile replays the trace and writes a Perfetto trace of the replay
-func GpuProfile(ctx context.Context, capturePath *path.Capture, device *path.Device, experiments *service.ProfileExperiments, loopCount int32) (*service.ProfilingData, error) {
+// captureFeatures returns the GPU features used by the capture, or nil if none
+// of its APIs can analyze them.
+func captureFeatures(ctx context.Context, apis []api.API, capturePath *path.Capture) *CaptureFeatures {
+	for _, a := range apis {
+		if fa, ok := a.(FeatureAnalyzer); ok {
+			f, err := fa.CaptureFeatures(ctx, capturePath)
+			if err != nil {
+				log.W(ctx, "Failed to analyze the GPU features of the capture, collecting all counters: %v", err)
+				return nil
+			}
+			return &f
+		}
+	}
+	return nil
+}
+
+// GpuProfileOptions are the options of the profiling replays of GpuProfile.
+type GpuProfileOptions struct {
+	// Experiments to apply to the replay.
+	Experiments *service.ProfileExperiments
+	// Range is the range of the capture to trace. If nil, the whole capture
+	// is traced.
+	Range *service.ProfileRange
+	// LoopCount is the number of times the capture is replayed.
+	LoopCount int32
+	// Bisect further attributes the counters to individual command buffers
+	// by replaying with parts of each submission disabled.
+	Bisect bool
+	// Prime replays the capture once untimed before the measured replay, such
+	// that the pipeline compilation is not part of the measurements.
+	Prime bool
+	// Overhead replays the capture once more without collecting the GPU
+	// counters, and adds the overhead of the counter collection to the data.
+	Overhead bool
+	// AllCounters collects the counters of the GPU features the capture
+	// doesn't use too.
+	AllCounters bool
+	// Validate first replays the capture with the validation layers enabled,
+	// and adds the issues they report to the data.
+	Validate bool
+	// Calibrate times the command buffers of the profiled replay with
+	// timestamp queries, which verify the GPU clock of the trace.
+	Calibrate bool
+	// Analyses are the analyses of the capture's commands added to the data.
+	Analyses []service.CaptureAnalysis
+}
+
+// analyzes returns whether the analysis of the capture was requested.
+func (o GpuProfileOptions) analyzes(analysis service.CaptureAnalysis) bool {
+	for _, a := range o.Analyses {
+		if a == analysis {
+			return true
+		}
+	}
+	return false
+}
+
+// GpuProfile replays the trace and writes a Perfetto trace of the replay,
+// according to the options.
+// The driver and validation messages logged on Android devices during the
+// profiled replay are added to the data.
+// The requested analyses of the capture are matched up with the slices of the
+// profiled replay and added to the data.
+func GpuProfile(ctx context.Context, capturePath *path.Capture, device *path.Device, options GpuProfileOptions) (res *service.ProfilingData, err error) {
 	if device == nil {
 		return nil, errors.New("Replay device is required.")
 	}
 
+	// All but the last iteration of a looping replay run before the Perfetto
+	// trace is started, which warms up the driver's pipeline caches.
+	loopCount := options.LoopCount
+	if options.Prime && loopCount < 2 {
+		log.I(ctx, "Priming the pipeline caches with an untimed replay")
+		loopCount = 2
+	}
+
 	c, err := capture.ResolveGraphicsFromPath(ctx, capturePath)
 	if err != nil {
 		return nil, err
@@ -90,7 +303,11 @@ func GpuProfile(ctx context.Context, capturePath *path.Capture, device *path.Dev
 		Device:  device,
 	}
 
-	conf, err := getPerfettoConfig(ctx, device)
+	var features *CaptureFeatures
+	if !options.AllCounters {
+		features = captureFeatures(ctx, c.APIs, capturePath)
+	}
+	conf, err := getPerfettoConfig(ctx, device, features)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +323,7 @@ func GpuProfile(ctx context.Context, capturePath *path.Capture, device *path.Dev
 		DisableAnisotropicFiltering: false,
 	}
 
-	if experiments != nil {
+	if experiments := options.Experiments; experiments != nil {
 		var disabledCmdsIndices [][]uint64
 		if experiments.DisabledCommands != nil {
 			disabledCmdsIndices = make([][]uint64, 0, len(experiments.DisabledCommands))
@@ -116,22 +333,110 @@ func GpuProfile(ctx context.Context, capturePath *path.Capture, device *path.Dev
 		}
 		profilingExperiments.DisabledCmds = disabledCmdsIndices
 		profilingExperiments.DisableAnisotropicFiltering = experiments.DisableAnisotropicFiltering
+		profilingExperiments.ResolutionScale = experiments.ResolutionScale
+		profilingExperiments.LodBias = experiments.GetSamplerOverride().GetLodBias()
+		profilingExperiments.NearestFiltering = experiments.GetSamplerOverride().GetNearestFiltering()
+		if r := experiments.ShadingRate; r != nil {
+			profilingExperiments.ShadingRateWidth = r.Width
+			profilingExperiments.ShadingRateHeight = r.Height
+			profilingExperiments.ShadingRatePasses = r.RenderPasses
+		}
+	}
+
+	profilingExperiments.CalibrateTimestamps = options.Calibrate
+
+	profilingExperiments.Range, err = profileRange(c, options.Range)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Invalid profile range.")
 	}
 
 	mgr := GetManager(ctx)
 	hints := &path.UsageHints{Background: true}
+	var validationIssues []*service.ProfilingData_ValidationIssue
+	var validationErr error
+	if options.Validate {
+		log.I(ctx, "Validating the replay before profiling it")
+		validationIssues, validationErr = validateReplay(ctx, c.APIs, intent, mgr, hints)
+	}
+	// The replays are run as segments that survive transient disconnects of
+	// the device, and are checkpointed such that a retried request resumes
+	// after the last completed segment.
+	run := newProfileRun(device, runKey{
+		Capture:     capturePath.GetID().ID().String(),
+		Device:      device.GetID().ID().String(),
+		Trace:       proto.CompactTextString(opts),
+		Experiments: profilingExperiments,
+		LoopCount:   loopCount,
+		Bisect:      options.Bisect,
+		Prime:       options.Prime,
+		Overhead:    options.Overhead,
+		AllCounters: options.AllCounters,
+		Validate:    options.Validate,
+		Calibrate:   options.Calibrate,
+	})
+	defer func() { run.finish(ctx, err) }()
 	for _, a := range c.APIs {
 		if pf, ok := a.(Profiler); ok {
-			data, err := pf.QueryProfile(ctx, intent, mgr, hints, opts, profilingExperiments, loopCount)
+			logcat := startLogcat(ctx, device)
+			data, err := run.segment(ctx, "profile", func(ctx context.Context) (*service.ProfilingData, error) {
+				return pf.QueryProfile(ctx, intent, mgr, hints, opts, profilingExperiments, loopCount)
+			})
+			messages := logcat.stop()
 			if err != nil {
 				log.E(ctx, "Replay profiling failed:", err)
 				return nil, log.Err(ctx, err, "Failed to profile the replay.")
 			}
+			if len(messages) > 0 {
+				data.LogMessages = messages
+			}
+			data.ValidationIssues = validationIssues
+			if options.analyzes(service.CaptureAnalysis_RenderPassAnalysis) {
+				passes := analyzePasses(ctx, c.APIs, capturePath)
+				data.PassUploads = passUploads(data, passes)
+				data.DrawDurations = drawDurations(data, passes)
+				data.DepthPasses = depthPasses(data, passes)
+			}
+			if options.analyzes(service.CaptureAnalysis_DescriptorAnalysis) {
+				data.DescriptorUsage = descriptorUsage(ctx, c.APIs, capturePath, data)
+			}
+			if options.analyzes(service.CaptureAnalysis_QueueAnalysis) {
+				data.QueueDependencies = queueDependencies(ctx, c.APIs, capturePath, data)
+			}
+			if options.analyzes(service.CaptureAnalysis_MemoryAnalysis) {
+				data.MemoryTimeline = memoryTimeline(ctx, c.APIs, capturePath, data)
+			}
+			errs := profile.SectionErrors(data.Errors)
+			if err := errs.Add(ctx, service.ProfilingData_SectionError_Validation, validationErr, "Failed to validate the replay"); err != nil {
+				return nil, err
+			}
+			data.Errors = errs
+			if options.Bisect {
+				profileDisabled := func(ctx context.Context, disabled [][]uint64) (*service.ProfilingData, error) {
+					exp := profilingExperiments
+					exp.DisabledCmds = append(append([][]uint64{}, profilingExperiments.DisabledCmds...), disabled...)
+					return run.segment(ctx, fmt.Sprintf("bisect %v", disabled), func(ctx context.Context) (*service.ProfilingData, error) {
+						return pf.QueryProfile(ctx, intent, mgr, hints, opts, exp, loopCount)
+					})
+				}
+				if err := bisectCommandBuffers(ctx, data, profileDisabled); err != nil {
+					return nil, log.Err(ctx, err, "Failed to bisect the command buffers.")
+				}
+			}
+			if options.Overhead {
+				baselineOpts := proto.Clone(opts).(*service.TraceOptions)
+				baselineOpts.PerfettoConfig = baselinePerfettoConfig(conf)
+				baseline, err := run.segment(ctx, "baseline", func(ctx context.Context) (*service.ProfilingData, error) {
+					return pf.QueryProfile(ctx, intent, mgr, hints, baselineOpts, profilingExperiments, loopCount)
+				})
+				if err != nil {
+					return nil, log.Err(ctx, err, "Failed to measure the profiling overhead.")
+				}
+				data.Overhead = computeOverhead(data, baseline)
+			}
 			log.I(ctx, "Replay profiling finished.")
 			return data, nil
 		}
 	}
 
-	err = log.Err(ctx, nil, "No profiling capable API in the trace")
-	return nil, err
+	return nil, profile.Errf(service.ProfilingErrorCode_NoProfilingApi, nil, "No profiling capable API in the trace")
 }
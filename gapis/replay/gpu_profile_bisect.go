@@ -0,0 +1,151 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+type profileFunc func(ctx context.Context, disabled [][]uint64) (*service.ProfilingData, error)
+
+// cmdBufSet is a set of command buffers of a single submission, whose
+// combined cost is measured by replaying with all the other command buffers
+// of the submission disabled.
+type cmdBufSet struct {
+	submission *service.ProfilingData_GpuSlices_Group
+	cmdBufs    []*service.ProfilingData_GpuSlices_Group
+}
+
+// split halves the set of command buffers.
+func (s cmdBufSet) split() []cmdBufSet {
+	mid := len(s.cmdBufs) / 2
+	return []cmdBufSet{
+		{s.submission, s.cmdBufs[:mid]},
+		{s.submission, s.cmdBufs[mid:]},
+	}
+}
+
+// complement returns the indices of the command buffers of the submission
+// that are not part of this set.
+func (s cmdBufSet) complement(all []*service.ProfilingData_GpuSlices_Group) [][]uint64 {
+	in := map[int32]bool{}
+	for _, cb := range s.cmdBufs {
+		in[cb.Id] = true
+	}
+	out := [][]uint64{}
+	for _, cb := range all {
+		if !in[cb.Id] {
+			out = append(out, cb.GetLink().GetFrom())
+		}
+	}
+	return out
+}
+
+// bisectCommandBuffers attributes the counters measured for each submission
+// down to the command buffers of the submission. The command buffers are
+// halved repeatedly and each half is replayed on its own, until single command
+// buffers are measured. All submissions are bisected together, such that the
+// number of replays only depends on the largest submission. Halves that did
+// not produce any GPU work are not split any further.
+func bisectCommandBuffers(ctx context.Context, data *service.ProfilingData, profileDisabled profileFunc) error {
+	if data.GetSlices() == nil || data.GetGpuCounters() == nil {
+		return nil
+	}
+
+	children := map[int32][]*service.ProfilingData_GpuSlices_Group{}
+	for _, group := range data.Slices.Groups {
+		children[group.ParentId] = append(children[group.ParentId], group)
+	}
+	entries := map[int32]*service.ProfilingData_GpuCounters_Entry{}
+	for _, entry := range data.GpuCounters.Entries {
+		entries[entry.GroupId] = entry
+	}
+
+	// One queue of pending sets per submission.
+	queues := [][]cmdBufSet{}
+	for _, submission := range children[0] {
+		if cmdBufs := children[submission.Id]; len(cmdBufs) > 1 {
+			queues = append(queues, cmdBufSet{submission, cmdBufs}.split())
+		}
+	}
+
+	for round := 1; len(queues) > 0; round++ {
+		log.I(ctx, "Command buffer bisection round %d, %d submissions", round, len(queues))
+		current := make([]cmdBufSet, len(queues))
+		disabled := [][]uint64{}
+		for i, queue := range queues {
+			current[i] = queue[0]
+			queues[i] = queue[1:]
+			disabled = append(disabled, current[i].complement(children[current[i].submission.Id])...)
+		}
+
+		res, err := profileDisabled(ctx, disabled)
+		if err != nil {
+			return err
+		}
+		measured := submissionPerfs(res)
+
+		for i, set := range current {
+			perf, ok := measured[fmt.Sprint(set.submission.GetLink().GetFrom())]
+			if !ok {
+				log.D(ctx, "No GPU work for command buffers %v of submission %v", set.cmdBufs, set.submission.Name)
+				continue
+			}
+			if len(set.cmdBufs) > 1 {
+				queues[i] = append(queues[i], set.split()...)
+				continue
+			}
+			cb := set.cmdBufs[0]
+			entry, ok := entries[cb.Id]
+			if !ok {
+				entry = &service.ProfilingData_GpuCounters_Entry{GroupId: cb.Id}
+				entries[cb.Id] = entry
+				data.GpuCounters.Entries = append(data.GpuCounters.Entries, entry)
+			}
+			entry.MetricToValue = perf
+		}
+
+		pending := queues[:0]
+		for _, queue := range queues {
+			if len(queue) > 0 {
+				pending = append(pending, queue)
+			}
+		}
+		queues = pending
+	}
+	return nil
+}
+
+// submissionPerfs returns the metric values of all the submission groups in
+// the profiling data, keyed by the command index of the submission.
+func submissionPerfs(data *service.ProfilingData) map[string]map[int32]*service.ProfilingData_GpuCounters_Perf {
+	submissions := map[int32]string{}
+	for _, group := range data.GetSlices().GetGroups() {
+		if group.ParentId == 0 {
+			submissions[group.Id] = fmt.Sprint(group.GetLink().GetFrom())
+		}
+	}
+	res := map[string]map[int32]*service.ProfilingData_GpuCounters_Perf{}
+	for _, entry := range data.GetGpuCounters().GetEntries() {
+		if key, ok := submissions[entry.GroupId]; ok {
+			res[key] = entry.MetricToValue
+		}
+	}
+	return res
+}
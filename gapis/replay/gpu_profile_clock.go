@@ -0,0 +1,169 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+const (
+	// minCalibrationTime is the minimum GPU time of a command buffer, in
+	// nanoseconds, for its durations to calibrate the clock. Shorter command
+	// buffers are dominated by the resolution of the clocks.
+	minCalibrationTime = 100 * 1000
+	// minCalibrationSamples is the minimum number of command buffers needed
+	// to correct the clock.
+	minCalibrationSamples = 5
+	// maxClockSkew is the relative difference between the durations of the
+	// trace and those measured by the timestamp queries above which the trace
+	// is corrected, if the durations agree on it.
+	maxClockSkew = 0.01
+)
+
+// CalibrateClock verifies the conversion of the GPU clock of the trace by
+// comparing the durations of the command buffers in the trace to the
+// durations measured by the timestamp queries of the replay. The median
+// durations across the frames of each command buffer are compared. If the
+// trace's clock is skewed, and the command buffers agree on the skew, the
+// slices and counters of the data are rescaled to the measured clock. The
+// sections derived from them are not recomputed. Returns nil if no command
+// buffer could be compared.
+func CalibrateClock(data *service.ProfilingData, timestamps []*service.TimestampsItem) *service.ProfilingData_ClockCalibration {
+	measured := map[string][]float64{}
+	for _, t := range timestamps {
+		if idx := t.GetBegin().GetIndices(); len(idx) >= 3 && t.TimeInNanoseconds >= minCalibrationTime {
+			key := fmt.Sprint(api.SubCmdIdx(idx[:3]))
+			measured[key] = append(measured[key], float64(t.TimeInNanoseconds))
+		}
+	}
+	traced := commandBufferDurations(data.GetSlices())
+
+	ratios := []float64{}
+	for key, durations := range measured {
+		if d, ok := traced[key]; ok {
+			ratios = append(ratios, median(d)/median(durations))
+		}
+	}
+	if len(ratios) == 0 {
+		return nil
+	}
+	ratio := median(ratios)
+	deviations := make([]float64, len(ratios))
+	for i, r := range ratios {
+		deviations[i] = math.Abs(r - ratio)
+	}
+	res := &service.ProfilingData_ClockCalibration{
+		Samples:   uint32(len(ratios)),
+		Skew:      ratio - 1,
+		Deviation: median(deviations),
+	}
+	if len(ratios) >= minCalibrationSamples && math.Abs(res.Skew) > maxClockSkew && res.Deviation < math.Abs(res.Skew) {
+		rescaleClock(data, ratio)
+		res.Corrected = true
+	}
+	return res
+}
+
+// cmdBufferSpan is the time range of the slices of a command buffer.
+type cmdBufferSpan struct {
+	start, end uint64
+}
+
+// commandBufferDurations returns the durations of the slices of each command
+// buffer within each frame, keyed by the command buffer's command index. The
+// duration of a command buffer is the span of its slices.
+func commandBufferDurations(slices *service.ProfilingData_GpuSlices) map[string][]float64 {
+	groups := map[int32]string{}
+	for _, group := range slices.GetGroups() {
+		if from := group.GetLink().GetFrom(); len(from) >= 3 {
+			groups[group.Id] = fmt.Sprint(api.SubCmdIdx(from[:3]))
+		}
+	}
+
+	res := map[string][]float64{}
+	for _, frame := range profile.SliceFrames(slices) {
+		spans := map[string]*cmdBufferSpan{}
+		for _, slice := range frame {
+			key, ok := groups[slice.GroupId]
+			if !ok {
+				continue
+			}
+			end := slice.Ts + slice.Dur
+			if s, ok := spans[key]; !ok {
+				spans[key] = &cmdBufferSpan{slice.Ts, end}
+			} else {
+				if slice.Ts < s.start {
+					s.start = slice.Ts
+				}
+				if end > s.end {
+					s.end = end
+				}
+			}
+		}
+		for key, s := range spans {
+			if d := s.end - s.start; d >= minCalibrationTime {
+				res[key] = append(res[key], float64(d))
+			}
+		}
+	}
+	return res
+}
+
+// rescaleClock divides the times of the slices and counters of the data,
+// relative to the start of the first slice, by the ratio.
+func rescaleClock(data *service.ProfilingData, ratio float64) {
+	slices := data.GetSlices().GetSlices()
+	if len(slices) == 0 {
+		return
+	}
+	start := slices[0].Ts
+	for _, slice := range slices {
+		if slice.Ts < start {
+			start = slice.Ts
+		}
+	}
+	rescale := func(ts uint64) uint64 {
+		if ts < start {
+			return ts
+		}
+		return start + uint64(math.Round(float64(ts-start)/ratio))
+	}
+	for _, slice := range slices {
+		slice.Ts = rescale(slice.Ts)
+		slice.Dur = uint64(math.Round(float64(slice.Dur) / ratio))
+		slice.SelfDur = uint64(math.Round(float64(slice.SelfDur) / ratio))
+	}
+	for _, counter := range data.GetCounters() {
+		for i, ts := range counter.Timestamps {
+			counter.Timestamps[i] = rescale(ts)
+		}
+	}
+}
+
+// median returns the median of the values. The values must not be empty.
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	if n := len(sorted); n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
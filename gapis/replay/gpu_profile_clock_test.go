@@ -0,0 +1,85 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestCalibrateClock(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Six command buffers of 1ms each, in two frames, traced at the given
+	// multiple of their duration.
+	traced := func(scale float64) (*service.ProfilingData, []*service.TimestampsItem) {
+		data := &service.ProfilingData{Slices: &service.ProfilingData_GpuSlices{}}
+		timestamps := []*service.TimestampsItem{}
+		ts := uint64(1000)
+		for frame := 0; frame < 2; frame++ {
+			for cb := 0; cb < 6; cb++ {
+				id := int32(cb + 1)
+				if frame == 0 {
+					data.Slices.Groups = append(data.Slices.Groups, &service.ProfilingData_GpuSlices_Group{
+						Id:   id,
+						Link: &path.Commands{From: []uint64{10, 0, uint64(cb)}, To: []uint64{10, 0, uint64(cb)}},
+					})
+				}
+				dur := uint64(1000000 * scale)
+				data.Slices.Slices = append(data.Slices.Slices, &service.ProfilingData_GpuSlices_Slice{
+					Ts:      ts,
+					Dur:     dur,
+					SelfDur: dur,
+					GroupId: id,
+					Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{
+						{Name: "frameId", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(frame)}},
+					},
+				})
+				ts += dur
+				timestamps = append(timestamps, &service.TimestampsItem{
+					Begin:             &path.Command{Indices: []uint64{10, 0, uint64(cb), 0}},
+					TimeInNanoseconds: 1000000,
+				})
+			}
+		}
+		return data, timestamps
+	}
+
+	data, timestamps := traced(1.002)
+	res := CalibrateClock(data, timestamps)
+	assert.For(ctx, "samples").That(res.Samples).Equals(uint32(6))
+	assert.For(ctx, "small skew").ThatFloat(res.Skew).IsAtLeast(0.0019)
+	assert.For(ctx, "small skew corrected").ThatBoolean(res.Corrected).IsFalse()
+	assert.For(ctx, "uncorrected dur").That(data.Slices.Slices[0].Dur).Equals(uint64(1002000))
+
+	data, timestamps = traced(1.1)
+	res = CalibrateClock(data, timestamps)
+	assert.For(ctx, "deviation").ThatFloat(res.Deviation).IsAtMost(1e-9)
+	assert.For(ctx, "large skew corrected").ThatBoolean(res.Corrected).IsTrue()
+	assert.For(ctx, "corrected start").That(data.Slices.Slices[0].Ts).Equals(uint64(1000))
+	assert.For(ctx, "corrected dur").That(data.Slices.Slices[0].Dur).Equals(uint64(1000000))
+	assert.For(ctx, "corrected ts").That(data.Slices.Slices[1].Ts).Equals(uint64(1001000))
+
+	// The command buffers are too short to calibrate the clock.
+	data, timestamps = traced(0.01)
+	for _, t := range timestamps {
+		t.TimeInNanoseconds = 10000
+	}
+	assert.For(ctx, "too short").That(CalibrateClock(data, timestamps)).IsNil()
+}
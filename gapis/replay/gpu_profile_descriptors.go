@@ -0,0 +1,87 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// descriptorSlicePattern matches the labels of the driver slices of the
+// descriptor work, e.g. the updates and copies of descriptor sets.
+var descriptorSlicePattern = regexp.MustCompile(`(?i)descriptor`)
+
+// descriptorUsage returns the descriptor usage of each frame of the replay.
+// Returns nil if none of the APIs of the capture can measure the usage.
+func descriptorUsage(ctx context.Context, apis []api.API, capturePath *path.Capture, data *service.ProfilingData) *service.ProfilingData_DescriptorUsage {
+	for _, a := range apis {
+		da, ok := a.(DescriptorAnalyzer)
+		if !ok {
+			continue
+		}
+		frames, err := da.FrameDescriptors(ctx, capturePath)
+		if err != nil {
+			log.W(ctx, "Failed to measure the descriptor usage of the frames: %v", err)
+			return nil
+		}
+		return joinDescriptorUsage(frames, data)
+	}
+	return nil
+}
+
+// joinDescriptorUsage matches the frames of the capture, in order, to the
+// frames of the replay, by start time, repeating the capture frames if the
+// replay was looped. Returns nil if either has no frames.
+func joinDescriptorUsage(frames []FrameDescriptors, data *service.ProfilingData) *service.ProfilingData_DescriptorUsage {
+	replayed := append([]*service.ProfilingData_GpuIdle_Frame{}, data.GetGpuIdle().GetFrames()...)
+	if len(frames) == 0 || len(replayed) == 0 {
+		return nil
+	}
+	sort.SliceStable(replayed, func(i, j int) bool { return replayed[i].Ts < replayed[j].Ts })
+
+	slices := []*service.ProfilingData_GpuSlices_Slice{}
+	for _, s := range data.GetSlices().GetSlices() {
+		if descriptorSlicePattern.MatchString(s.Label) {
+			slices = append(slices, s)
+		}
+	}
+
+	res := &service.ProfilingData_DescriptorUsage{}
+	for i, f := range replayed {
+		d := frames[i%len(frames)]
+		frame := &service.ProfilingData_DescriptorUsage_Frame{
+			FrameId:             f.FrameId,
+			Binds:               d.Binds,
+			BoundSets:           d.BoundSets,
+			DescriptorWrites:    d.Writes,
+			UpdateAfterBindSets: d.UpdateAfterBindSets,
+			VariableCountSets:   d.VariableCountSets,
+		}
+		for _, s := range slices {
+			if s.Ts >= f.Ts && s.Ts < f.Ts+f.Dur {
+				frame.DriverSlices++
+				frame.DriverTime += s.Dur
+			}
+		}
+		res.Frames = append(res.Frames, frame)
+	}
+	return res
+}
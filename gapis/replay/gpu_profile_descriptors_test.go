@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestJoinDescriptorUsage(t *testing.T) {
+	ctx := log.Testing(t)
+
+	frames := []FrameDescriptors{
+		{Binds: 2, BoundSets: 3, Writes: 3, UpdateAfterBindSets: 1, VariableCountSets: 1},
+		{Writes: 1},
+	}
+	assert.For(ctx, "no frames").That(joinDescriptorUsage(nil, replayedFrames(1))).IsNil()
+	assert.For(ctx, "not replayed").That(joinDescriptorUsage(frames, &service.ProfilingData{})).IsNil()
+
+	// The replay was looped: its third frame is the first of the capture.
+	data := replayedFrames(3)
+	data.Slices = &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Label: "UpdateDescriptorSets", Ts: 10, Dur: 5},
+			{Label: "Render", Ts: 20, Dur: 50},
+			{Label: "Descriptor copy", Ts: 120, Dur: 7},
+		},
+	}
+
+	res := joinDescriptorUsage(frames, data)
+	assert.For(ctx, "frames").ThatSlice(res.Frames).DeepEquals([]*service.ProfilingData_DescriptorUsage_Frame{
+		{FrameId: 1, Binds: 2, BoundSets: 3, DescriptorWrites: 3, UpdateAfterBindSets: 1, VariableCountSets: 1, DriverSlices: 1, DriverTime: 5},
+		{FrameId: 2, DescriptorWrites: 1, DriverSlices: 1, DriverTime: 7},
+		{FrameId: 3, Binds: 2, BoundSets: 3, DescriptorWrites: 3, UpdateAfterBindSets: 1, VariableCountSets: 1},
+	})
+}
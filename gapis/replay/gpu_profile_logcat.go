@@ -0,0 +1,159 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/service/severity"
+)
+
+const (
+	// deviceClocksCmd prints the device's wall clock, in the format of the
+	// logcat timestamps, and its uptime, which is the boottime the trace
+	// timestamps are in.
+	deviceClocksCmd  = "date +'%m-%d %H:%M:%S.%N' && cat /proc/uptime"
+	logcatTimeLayout = "01-02 15:04:05.999999999"
+)
+
+// driverLogKeywords are keywords of the tags of the logcat messages of the
+// GPU drivers and of the Vulkan validation layers.
+var driverLogKeywords = []string{
+	"vulkan", "vk", "validation", "gpu", "egl", "gralloc",
+	"adreno", "kgsl", // Qualcomm
+	"mali", // Arm
+}
+
+// logcatRecorder collects the driver and validation messages of the device's
+// logcat while the replay is profiled.
+type logcatRecorder struct {
+	cancel task.CancelFunc
+	done   chan struct{}
+	// offset is the difference between the boottime and the wall clock of
+	// the device, in nanoseconds.
+	offset   int64
+	messages []android.LogcatMessage
+}
+
+// startLogcat starts recording the logcat of the replay device. Returns nil
+// if the device is not an Android device, or its clocks can't be aligned.
+func startLogcat(ctx context.Context, device *path.Device) *logcatRecorder {
+	d, ok := bind.GetRegistry(ctx).Device(device.GetID().ID()).(android.Device)
+	if !ok {
+		return nil
+	}
+	offset, err := deviceClockOffset(ctx, d)
+	if err != nil {
+		log.W(ctx, "Failed to align the logcat with the trace, not recording it: %v", err)
+		return nil
+	}
+
+	ctx, cancel := task.WithCancel(ctx)
+	r := &logcatRecorder{cancel: cancel, done: make(chan struct{}), offset: offset}
+	msgs := make(chan android.LogcatMessage, 64)
+	crash.Go(func() {
+		defer close(r.done)
+		for msg := range msgs {
+			if isDriverMessage(msg) {
+				r.messages = append(r.messages, msg)
+			}
+		}
+	})
+	crash.Go(func() {
+		if err := d.Logcat(ctx, msgs); err != nil && !task.Stopped(ctx) {
+			log.W(ctx, "Recording the logcat failed: %v", err)
+		}
+	})
+	return r
+}
+
+// stop stops the recording and returns the recorded messages, by time, with
+// their timestamps in the boottime of the trace.
+func (r *logcatRecorder) stop() []*service.ProfilingData_LogMessage {
+	if r == nil {
+		return nil
+	}
+	r.cancel()
+	<-r.done
+
+	res := make([]*service.ProfilingData_LogMessage, 0, len(r.messages))
+	for _, msg := range r.messages {
+		ts := msg.Timestamp.UnixNano() + r.offset
+		if ts < 0 {
+			continue
+		}
+		res = append(res, &service.ProfilingData_LogMessage{
+			Ts:       uint64(ts),
+			Severity: severity.Severity(msg.Priority.Severity()),
+			Tag:      msg.Tag,
+			Pid:      int32(msg.ProcessID),
+			Tid:      int32(msg.ThreadID),
+			Message:  msg.Message,
+		})
+	}
+	return res
+}
+
+// deviceClockOffset returns the difference between the boottime and the wall
+// clock of the device, in nanoseconds. The wall clock is interpreted the same
+// way as the logcat timestamps, such that the offset also makes up for a
+// difference between the time zones of the device and the host.
+func deviceClockOffset(ctx context.Context, d android.Device) (int64, error) {
+	out, err := d.Shell(deviceClocksCmd).Call(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		return 0, fmt.Errorf("Unexpected output of %q: %q", deviceClocksCmd, out)
+	}
+	wall, err := time.ParseInLocation(logcatTimeLayout, strings.TrimSpace(lines[0]), time.Local)
+	if err != nil {
+		return 0, err
+	}
+	wall = wall.AddDate(time.Now().Year(), 0, 0)
+	fields := strings.Fields(lines[1])
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Unexpected output of %q: %q", deviceClocksCmd, out)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(uptime*float64(time.Second)) - wall.UnixNano(), nil
+}
+
+// isDriverMessage returns whether the message was logged by the GPU driver or
+// the validation layers, based on its tag.
+func isDriverMessage(msg android.LogcatMessage) bool {
+	tag := strings.ToLower(msg.Tag)
+	for _, k := range driverLogKeywords {
+		if strings.Contains(tag, k) {
+			return true
+		}
+	}
+	return false
+}
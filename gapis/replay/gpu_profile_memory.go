@@ -0,0 +1,179 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+var (
+	// memoryCounterPattern matches the names of the GPU counters of the
+	// memory used, and memoryTrafficPattern those of the memory traffic,
+	// which are excluded.
+	memoryCounterPattern = regexp.MustCompile(`(?i)memory`)
+	memoryTrafficPattern = regexp.MustCompile(`(?i)read|write|bandwidth|traffic`)
+	memoryCounterUnits   = map[string]bool{"B": true, "KB": true, "MB": true, "GB": true}
+)
+
+// memoryTimeline returns the device memory allocated by the capture, per heap
+// and per frame of the replay. Returns nil if none of the APIs of the capture
+// can track the allocations.
+func memoryTimeline(ctx context.Context, apis []api.API, capturePath *path.Capture, data *service.ProfilingData) *service.ProfilingData_MemoryTimeline {
+	for _, a := range apis {
+		ma, ok := a.(MemoryAnalyzer)
+		if !ok {
+			continue
+		}
+		events, err := ma.MemoryTimeline(ctx, capturePath)
+		if err != nil {
+			log.W(ctx, "Failed to track the memory allocations of the capture: %v", err)
+			return nil
+		}
+		return joinMemoryTimeline(events, data)
+	}
+	return nil
+}
+
+// joinMemoryTimeline sums the memory events per heap, and per frame of the
+// capture. The capture frames are matched, in order, to the frames of the
+// replay, by start time, repeating the capture frames if the replay was
+// looped, and compared to the peak of the GPU memory counter in the frame.
+// Returns nil if there are no events.
+func joinMemoryTimeline(events []MemoryEvent, data *service.ProfilingData) *service.ProfilingData_MemoryTimeline {
+	if len(events) == 0 {
+		return nil
+	}
+
+	res := &service.ProfilingData_MemoryTimeline{}
+	heaps := map[uint32]*service.ProfilingData_MemoryTimeline_Heap{}
+	frames := []*service.ProfilingData_MemoryTimeline_Frame{}
+	live := uint64(0)
+	for _, e := range events {
+		if e.Command == api.CmdNoID && e.Size > 0 {
+			res.Initial += uint64(e.Size)
+		}
+		for len(frames) <= e.Frame {
+			frames = append(frames, &service.ProfilingData_MemoryTimeline_Frame{Live: live})
+		}
+		frame := frames[e.Frame]
+
+		if e.Size != 0 {
+			heap, ok := heaps[e.Heap]
+			if !ok {
+				heap = &service.ProfilingData_MemoryTimeline_Heap{Index: e.Heap}
+				heaps[e.Heap] = heap
+			}
+			if e.Size > 0 {
+				size := uint64(e.Size)
+				heap.Live += size
+				heap.Total += size
+				heap.Allocations++
+				if heap.Live > heap.Peak {
+					heap.Peak = heap.Live
+				}
+				if e.Command != api.CmdNoID {
+					frame.Allocations++
+					frame.Allocated += size
+				}
+				live += size
+			} else {
+				size := uint64(-e.Size)
+				if size > heap.Live {
+					size = heap.Live
+				}
+				heap.Live -= size
+				frame.Frees++
+				frame.Freed += size
+				live -= size
+			}
+			frame.Live = live
+		}
+
+		if e.Command != api.CmdNoID {
+			if e.Images > 0 {
+				frame.ImagesCreated += uint32(e.Images)
+			} else if e.Images < 0 {
+				frame.ImagesDestroyed += uint32(-e.Images)
+			}
+			if e.Buffers > 0 {
+				frame.BuffersCreated += uint32(e.Buffers)
+			} else if e.Buffers < 0 {
+				frame.BuffersDestroyed += uint32(-e.Buffers)
+			}
+		}
+	}
+	for _, heap := range heaps {
+		res.Heaps = append(res.Heaps, heap)
+	}
+	sort.Slice(res.Heaps, func(i, j int) bool { return res.Heaps[i].Index < res.Heaps[j].Index })
+
+	replayed := append([]*service.ProfilingData_GpuIdle_Frame{}, data.GetGpuIdle().GetFrames()...)
+	if len(replayed) == 0 {
+		return res
+	}
+	sort.SliceStable(replayed, func(i, j int) bool { return replayed[i].Ts < replayed[j].Ts })
+
+	counter := memoryCounter(data.GetCounters())
+	if counter != nil {
+		res.Counter, res.CounterUnit = counter.Name, counter.Unit
+	}
+	for i, f := range replayed {
+		d := frames[i%len(frames)]
+		frame := &service.ProfilingData_MemoryTimeline_Frame{
+			FrameId:          f.FrameId,
+			Allocations:      d.Allocations,
+			Frees:            d.Frees,
+			Allocated:        d.Allocated,
+			Freed:            d.Freed,
+			Live:             d.Live,
+			ImagesCreated:    d.ImagesCreated,
+			ImagesDestroyed:  d.ImagesDestroyed,
+			BuffersCreated:   d.BuffersCreated,
+			BuffersDestroyed: d.BuffersDestroyed,
+		}
+		if counter != nil {
+			first := sort.Search(len(counter.Timestamps), func(i int) bool { return counter.Timestamps[i] >= f.Ts })
+			for j := first; j < len(counter.Timestamps) && counter.Timestamps[j] < f.Ts+f.Dur; j++ {
+				if v := counter.Values[j]; v > frame.CounterPeak {
+					frame.CounterPeak = v
+				}
+			}
+		}
+		res.Frames = append(res.Frames, frame)
+	}
+	return res
+}
+
+// memoryCounter returns the GPU counter of the memory used with the most
+// samples, or nil if there is none.
+func memoryCounter(counters []*service.ProfilingData_Counter) *service.ProfilingData_Counter {
+	var res *service.ProfilingData_Counter
+	for _, c := range counters {
+		if !memoryCounterPattern.MatchString(c.Name) || memoryTrafficPattern.MatchString(c.Name) || !memoryCounterUnits[c.Unit] {
+			continue
+		}
+		if res == nil || len(c.Timestamps) > len(res.Timestamps) {
+			res = c
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+// replayedFrames returns profiling data of a replay of the given number of
+// frames of 100ns each, starting at 0.
+func replayedFrames(count int) *service.ProfilingData {
+	data := &service.ProfilingData{GpuIdle: &service.ProfilingData_GpuIdle{}}
+	for i := 0; i < count; i++ {
+		data.GpuIdle.Frames = append(data.GpuIdle.Frames, &service.ProfilingData_GpuIdle_Frame{
+			FrameId: int64(i + 1),
+			Ts:      uint64(i) * 100,
+			Dur:     100,
+		})
+	}
+	return data
+}
+
+func TestJoinMemoryTimeline(t *testing.T) {
+	ctx := log.Testing(t)
+
+	assert.For(ctx, "no events").That(joinMemoryTimeline(nil, replayedFrames(1))).IsNil()
+
+	events := []MemoryEvent{
+		{Command: api.CmdNoID, Heap: 0, Size: 64},
+		{Command: api.CmdNoID, Images: 2},
+		{Command: 0, Frame: 0, Heap: 1, Size: 256},
+		{Command: 1, Frame: 0, Images: 1},
+		{Command: 3, Frame: 1, Heap: 0, Size: -64},
+		{Command: 4, Frame: 1, Buffers: -1},
+	}
+	// The replay was looped: its third frame is the first of the capture.
+	data := replayedFrames(3)
+	data.Counters = []*service.ProfilingData_Counter{
+		{Name: "Memory Read Bytes", Unit: "B", Timestamps: []uint64{10}, Values: []float64{100}},
+		{Name: "GPU Memory Used", Unit: "MB", Timestamps: []uint64{10, 50, 150}, Values: []float64{3, 5, 4}},
+	}
+
+	res := joinMemoryTimeline(events, data)
+	assert.For(ctx, "initial").That(res.Initial).Equals(uint64(64))
+	assert.For(ctx, "counter").That(res.Counter).Equals("GPU Memory Used")
+	assert.For(ctx, "heaps").ThatSlice(res.Heaps).DeepEquals([]*service.ProfilingData_MemoryTimeline_Heap{
+		{Index: 0, Peak: 64, Total: 64, Allocations: 1, Live: 0},
+		{Index: 1, Peak: 256, Total: 256, Allocations: 1, Live: 256},
+	})
+	assert.For(ctx, "frames").ThatSlice(res.Frames).DeepEquals([]*service.ProfilingData_MemoryTimeline_Frame{
+		{FrameId: 1, Allocations: 1, Allocated: 256, Live: 320, ImagesCreated: 1, CounterPeak: 5},
+		{FrameId: 2, Frees: 1, Freed: 64, Live: 256, BuffersDestroyed: 1, CounterPeak: 4},
+		{FrameId: 3, Allocations: 1, Allocated: 256, Live: 320, ImagesCreated: 1},
+	})
+}
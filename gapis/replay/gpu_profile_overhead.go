@@ -0,0 +1,61 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/gapis/service"
+
+	perfetto_pb "protos/perfetto/config"
+)
+
+// baselinePerfettoConfig returns the config of the replay the overhead of the
+// counter collection is measured against. Only the GPU render stages are
+// traced, as they are needed to measure the GPU time.
+func baselinePerfettoConfig(conf *perfetto_pb.TraceConfig) *perfetto_pb.TraceConfig {
+	res := proto.Clone(conf).(*perfetto_pb.TraceConfig)
+	res.DataSources = nil
+	for _, ds := range conf.DataSources {
+		if ds.GetConfig().GetName() == gpuRenderStagesDataSourceDescriptorName {
+			res.DataSources = append(res.DataSources, proto.Clone(ds).(*perfetto_pb.TraceConfig_DataSource))
+		}
+	}
+	return res
+}
+
+// computeOverhead returns the overhead of the counter collection of the
+// profiled data, compared to the baseline data profiled without collecting
+// the counters.
+func computeOverhead(data, baseline *service.ProfilingData) *service.ProfilingData_Overhead {
+	res := &service.ProfilingData_Overhead{
+		GpuTime:         gpuTime(data),
+		BaselineGpuTime: gpuTime(baseline),
+	}
+	if res.BaselineGpuTime > 0 {
+		res.Overhead = (float64(res.GpuTime) - float64(res.BaselineGpuTime)) / float64(res.BaselineGpuTime)
+	}
+	return res
+}
+
+// gpuTime returns the total duration of the top level GPU slices.
+func gpuTime(data *service.ProfilingData) uint64 {
+	res := uint64(0)
+	for _, s := range data.GetSlices().GetSlices() {
+		if s.Depth == 0 {
+			res += s.Dur
+		}
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/app"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// SustainedPerformance enables the sustained performance mode of the replay
+// device, if it has one, and returns whether it is active along with the
+// cleanup that disables it again. Failing to enable the mode is not an
+// error, the profile is then taken with the clocks as they are.
+func SustainedPerformance(ctx context.Context, device *path.Device) (*service.ProfilingData_SustainedPerformance, app.Cleanup) {
+	res := &service.ProfilingData_SustainedPerformance{}
+	d, ok := bind.GetRegistry(ctx).Device(device.GetID().ID()).(adb.Device)
+	if !ok {
+		res.Reason = "Not an Android device"
+		return res, nil
+	}
+	mode, cleanup, err := d.SetSustainedPerformance(ctx)
+	switch {
+	case err != nil:
+		log.W(ctx, "Failed to enable the sustained performance mode: %v", err)
+		res.Reason = err.Error()
+	case mode == "":
+		log.W(ctx, "The device has no sustained performance mode, profiling with the clocks unlocked")
+		res.Reason = "Not supported by the device"
+	default:
+		log.I(ctx, "Enabled the sustained performance mode %v", mode)
+		res.Active, res.Mode = true, mode
+	}
+	return res, cleanup
+}
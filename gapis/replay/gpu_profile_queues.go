@@ -0,0 +1,151 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// queueDependencies returns the time of the dependencies between the queues
+// of each frame of the replay. Returns nil if none of the APIs of the capture
+// can find the dependencies, or if the capture submitted to a single queue.
+func queueDependencies(ctx context.Context, apis []api.API, capturePath *path.Capture, data *service.ProfilingData) *service.ProfilingData_QueueDependencies {
+	for _, a := range apis {
+		qa, ok := a.(QueueAnalyzer)
+		if !ok {
+			continue
+		}
+		submissions, err := qa.QueueDependencies(ctx, capturePath)
+		if err != nil {
+			log.W(ctx, "Failed to find the dependencies between the queues: %v", err)
+			return nil
+		}
+		return joinQueueDependencies(submissions, data)
+	}
+	return nil
+}
+
+// submissionSpan is the span of the GPU work of a queue submission.
+type submissionSpan struct {
+	start, end uint64
+}
+
+// joinQueueDependencies times the dependencies of the submissions of each
+// frame of the capture, in order, by the GPU work of the submissions in the
+// matching frame of the replay, repeating the capture frames if the replay
+// was looped. The GPU work of a submission is found by the commands linked to
+// the groups of its slices.
+func joinQueueDependencies(submissions []QueueSubmission, data *service.ProfilingData) *service.ProfilingData_QueueDependencies {
+	queues := map[uint64]bool{}
+	frames := 0
+	for _, sub := range submissions {
+		queues[sub.Queue] = true
+		if sub.Frame+1 > frames {
+			frames = sub.Frame + 1
+		}
+	}
+	replayed := append([]*service.ProfilingData_GpuIdle_Frame{}, data.GetGpuIdle().GetFrames()...)
+	if len(queues) < 2 || len(replayed) == 0 {
+		return nil
+	}
+	sort.SliceStable(replayed, func(i, j int) bool { return replayed[i].Ts < replayed[j].Ts })
+
+	groupSubmits := map[int32]string{}
+	for _, group := range data.GetSlices().GetGroups() {
+		if from := group.GetLink().GetFrom(); len(from) >= 2 {
+			groupSubmits[group.Id] = fmt.Sprint(api.SubCmdIdx(from[:2]))
+		}
+	}
+	slices := append([]*service.ProfilingData_GpuSlices_Slice{}, data.GetSlices().GetSlices()...)
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].Ts < slices[j].Ts })
+
+	res := &service.ProfilingData_QueueDependencies{Queues: uint32(len(queues))}
+	for i, f := range replayed {
+		// The spans of the submissions whose GPU work started in the frame.
+		spans := map[string]*submissionSpan{}
+		first := sort.Search(len(slices), func(i int) bool { return slices[i].Ts >= f.Ts })
+		for _, s := range slices[first:] {
+			if s.Ts >= f.Ts+f.Dur {
+				break
+			}
+			key, ok := groupSubmits[s.GroupId]
+			if !ok {
+				continue
+			}
+			span, ok := spans[key]
+			if !ok {
+				span = &submissionSpan{start: s.Ts, end: s.Ts + s.Dur}
+				spans[key] = span
+			}
+			if e := s.Ts + s.Dur; e > span.end {
+				span.end = e
+			}
+		}
+		span := func(idx int) (*submissionSpan, bool) {
+			s, ok := spans[fmt.Sprint(submissions[idx].Submit)]
+			return s, ok
+		}
+
+		frame := &service.ProfilingData_QueueDependencies_Frame{FrameId: f.FrameId}
+		// The end of the GPU work submitted to each queue so far.
+		queueEnds := map[uint64]uint64{}
+		for idx, sub := range submissions {
+			if sub.Frame != i%frames {
+				continue
+			}
+			s, ok := span(idx)
+			if !ok {
+				continue
+			}
+			idleFrom, ok := queueEnds[sub.Queue]
+			if !ok {
+				idleFrom = f.Ts
+			}
+			signalled := uint64(0)
+			for _, j := range sub.Waits {
+				if w, ok := span(j); ok {
+					frame.CrossQueueWaits++
+					if w.end > signalled {
+						signalled = w.end
+					}
+				}
+			}
+			if signalled > s.start {
+				signalled = s.start
+			}
+			if signalled > idleFrom {
+				frame.WaitTime += signalled - idleFrom
+			}
+			for _, j := range sub.Acquires {
+				if r, ok := span(j); ok && s.start > r.end {
+					frame.TransferTime += s.start - r.end
+				}
+			}
+			frame.OwnershipTransfers += sub.Transfers
+			if s.end > queueEnds[sub.Queue] {
+				queueEnds[sub.Queue] = s.end
+			}
+		}
+		res.Frames = append(res.Frames, frame)
+	}
+	return res
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestJoinQueueDependencies(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// The graphics queue signals a semaphore, and releases a buffer, for the
+	// compute queue.
+	submissions := []QueueSubmission{
+		{Submit: api.SubCmdIdx{0, 0}, Queue: 1},
+		{Submit: api.SubCmdIdx{1, 0}, Queue: 2, Waits: []int{0}, Acquires: []int{0}, Transfers: 1},
+	}
+	data := replayedFrames(1)
+	data.Slices = &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Link: &path.Commands{From: []uint64{0, 0, 0}, To: []uint64{0, 0, 0}}},
+			{Id: 2, Link: &path.Commands{From: []uint64{1, 0, 0}, To: []uint64{1, 0, 0}}},
+		},
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 10, Dur: 20, GroupId: 1},
+			{Ts: 50, Dur: 10, GroupId: 2},
+		},
+	}
+
+	res := joinQueueDependencies(submissions, data)
+	assert.For(ctx, "queues").That(res.Queues).Equals(uint32(2))
+	// The compute queue waited from the start of the frame to the end of the
+	// graphics work, and acquired the buffer 20ns after it was released.
+	assert.For(ctx, "frames").ThatSlice(res.Frames).DeepEquals([]*service.ProfilingData_QueueDependencies_Frame{
+		{FrameId: 1, CrossQueueWaits: 1, WaitTime: 30, OwnershipTransfers: 1, TransferTime: 20},
+	})
+
+	single := []QueueSubmission{{Submit: api.SubCmdIdx{0, 0}, Queue: 1}}
+	assert.For(ctx, "single queue").That(joinQueueDependencies(single, data)).IsNil()
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"fmt"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/service"
+)
+
+// profileRange returns the range of the capture's commands selected by r, or
+// an empty range if r is nil, in which case the whole capture is profiled.
+func profileRange(c *capture.GraphicsCapture, r *service.ProfileRange) (api.CmdIDRange, error) {
+	res := api.CmdIDRange{}
+	switch {
+	case r.GetCommands() != nil:
+		cmds := r.GetCommands()
+		if len(cmds.From) == 0 || len(cmds.To) == 0 || cmds.To[0] < cmds.From[0] {
+			return res, fmt.Errorf("Invalid command range [%v, %v]", cmds.From, cmds.To)
+		}
+		res = api.CmdIDRange{Start: api.CmdID(cmds.From[0]), End: api.CmdID(cmds.To[0]) + 1}
+	case r.GetFrames() != nil:
+		frames := r.GetFrames()
+		if frames.Last < frames.First {
+			return res, fmt.Errorf("Invalid frame range [%v, %v]", frames.First, frames.Last)
+		}
+		// A frame ends with its end of frame command, e.g. vkQueuePresentKHR.
+		start, frame := api.CmdID(0), uint32(0)
+		for i, cmd := range c.Commands {
+			if !cmd.CmdFlags().IsEndOfFrame() {
+				continue
+			}
+			if frame == frames.First {
+				res.Start = start
+			}
+			if frame == frames.Last {
+				res.End = api.CmdID(i) + 1
+				break
+			}
+			start, frame = api.CmdID(i)+1, frame+1
+		}
+		if res.End == 0 {
+			return res, fmt.Errorf("Frame %v is out of range, the capture has %v frames", frames.Last, frame)
+		}
+	default:
+		return res, nil
+	}
+
+	if res.End > api.CmdID(len(c.Commands)) {
+		return res, fmt.Errorf("Command range %v is out of range, the capture has %v commands", res, len(c.Commands))
+	}
+	// The replay loops over the range, which requires at least two commands.
+	if res.Length() < 2 {
+		return res, fmt.Errorf("Command range %v is too short, at least two commands are required", res)
+	}
+	return res, nil
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+const (
+	// maxSegmentAttempts is the number of times a replay segment is run
+	// before giving up, if the device keeps disconnecting.
+	maxSegmentAttempts = 3
+	// reconnectTimeout is how long to wait for a disconnected device to come
+	// back before giving up.
+	reconnectTimeout = 60 * time.Second
+	// reconnectPollInterval is how often the device registry is checked for
+	// the reconnected device.
+	reconnectPollInterval = time.Second
+	// maxCheckpointedRuns is the number of unfinished profiling runs whose
+	// checkpoints are kept, the oldest runs are dropped first.
+	maxCheckpointedRuns = 4
+)
+
+// disconnectErrors are the errors of the device connection and the Perfetto
+// session that indicate the device was lost, when found in the chain of
+// causes of an error.
+var disconnectErrors = []error{
+	io.EOF,
+	io.ErrUnexpectedEOF,
+	syscall.ECONNRESET,
+	syscall.ECONNREFUSED,
+	syscall.EPIPE,
+}
+
+// adbDisconnectMessages matches the lines of the adb errors that indicate
+// the device was lost.
+var adbDisconnectMessages = regexp.MustCompile(
+	`(?m)^error: (device offline|device '[^']*' not found|no devices/emulators found|closed)$`)
+
+// checkpoints holds the profiling data of the completed replay segments of
+// the profiling runs that did not finish because the device was lost, such
+// that the run resumes after the last completed segment when retried.
+var checkpoints = struct {
+	sync.Mutex
+	runs  map[string]map[string]*service.ProfilingData // run key -> segment -> data
+	order []string                                     // run keys, oldest first
+}{runs: map[string]map[string]*service.ProfilingData{}}
+
+// runKey is all the parameters of a profiling run that affect the data of
+// its segments.
+type runKey struct {
+	Capture     string
+	Device      string
+	Trace       string // The trace options, in text format.
+	Experiments ProfileExperiments
+	LoopCount   int32
+	Bisect      bool
+	Prime       bool
+	Overhead    bool
+	AllCounters bool
+	Validate    bool
+	Calibrate   bool
+}
+
+// profileRun is a profiling run consisting of several replay segments, e.g.
+// the command buffer bisection rounds.
+type profileRun struct {
+	key    string
+	device *path.Device
+}
+
+func newProfileRun(device *path.Device, key runKey) *profileRun {
+	return &profileRun{key: fmt.Sprintf("%+v", key), device: device}
+}
+
+// segment returns the checkpointed data of the named segment, or runs the
+// segment with profile. If the device disconnects while running the segment,
+// it waits for the device to reconnect and runs the segment again.
+func (r *profileRun) segment(ctx context.Context, name string, profile func(ctx context.Context) (*service.ProfilingData, error)) (*service.ProfilingData, error) {
+	checkpoints.Lock()
+	data, ok := checkpoints.runs[r.key][name]
+	checkpoints.Unlock()
+	if ok {
+		log.I(ctx, "Resuming the profiling run after segment %v", name)
+		return proto.Clone(data).(*service.ProfilingData), nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		data, err := profile(ctx)
+		if err == nil {
+			// The callers may modify the data, e.g. when bisecting.
+			r.checkpoint(name, proto.Clone(data).(*service.ProfilingData))
+			return data, nil
+		}
+		if attempt >= maxSegmentAttempts || !r.disconnected(ctx, err) {
+			return nil, err
+		}
+		log.W(ctx, "Device disconnected during profiling segment %v (attempt %d of %d): %v", name, attempt, maxSegmentAttempts, err)
+		if err := r.waitForDevice(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// checkpoint records the data of the completed segment of the run, dropping
+// the checkpoints of the oldest runs beyond maxCheckpointedRuns.
+func (r *profileRun) checkpoint(name string, data *service.ProfilingData) {
+	checkpoints.Lock()
+	defer checkpoints.Unlock()
+	if checkpoints.runs[r.key] == nil {
+		checkpoints.runs[r.key] = map[string]*service.ProfilingData{}
+		checkpoints.order = append(checkpoints.order, r.key)
+		for len(checkpoints.order) > maxCheckpointedRuns {
+			delete(checkpoints.runs, checkpoints.order[0])
+			checkpoints.order = checkpoints.order[1:]
+		}
+	}
+	checkpoints.runs[r.key][name] = data
+}
+
+// finish drops the checkpoints of the run once it returns with err, unless
+// it failed because the device was lost, in which case a retry resumes it.
+func (r *profileRun) finish(ctx context.Context, err error) {
+	if err != nil && r.disconnected(ctx, err) {
+		log.I(ctx, "Keeping the completed segments of the profiling run for a retry")
+		return
+	}
+	checkpoints.Lock()
+	defer checkpoints.Unlock()
+	if _, ok := checkpoints.runs[r.key]; !ok {
+		return
+	}
+	delete(checkpoints.runs, r.key)
+	for i, key := range checkpoints.order {
+		if key == r.key {
+			checkpoints.order = append(checkpoints.order[:i], checkpoints.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// disconnected returns whether err was caused by the device disconnecting.
+func (r *profileRun) disconnected(ctx context.Context, err error) bool {
+	if bind.GetRegistry(ctx).Device(r.device.GetID().ID()) == nil {
+		return true
+	}
+	for i := 0; i < 64 && err != nil; i++ {
+		for _, e := range disconnectErrors {
+			if err == e {
+				return true
+			}
+		}
+		if adbDisconnectMessages.MatchString(err.Error()) {
+			return true
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// waitForDevice waits until the device of the run is back in the registry.
+func (r *profileRun) waitForDevice(ctx context.Context) error {
+	deadline := time.Now().Add(reconnectTimeout)
+	for bind.GetRegistry(ctx).Device(r.device.GetID().ID()) == nil {
+		if time.Now().After(deadline) {
+			return log.Errf(ctx, nil, "Device did not reconnect within %v", reconnectTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectPollInterval):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestIsUnusedFeatureCounter(t *testing.T) {
+	ctx := log.Testing(t)
+
+	none := &CaptureFeatures{}
+	all := &CaptureFeatures{Tessellation: true, Geometry: true, Compute: true}
+	spec := func(name string, groups ...device.GpuCounterDescriptor_GpuCounterGroup) *device.GpuCounterDescriptor_GpuCounterSpec {
+		return &device.GpuCounterDescriptor_GpuCounterSpec{Name: name, Groups: groups}
+	}
+
+	// Counters of the Adreno and Mali GPUs that measure work of any capture.
+	for _, name := range []string{
+		// Adreno
+		"Clocks / Second",
+		"GPU % Utilization",
+		"GPU % Bus Busy",
+		"% Shaders Busy",
+		"% Texture Fetch Stall",
+		"% Vertex Fetch Stall",
+		"Avg Bytes / Fragment",
+		"Avg Bytes / Vertex",
+		"Fragment ALU Instructions / Sec (Full)",
+		"Fragments Shaded / Second",
+		"Vertices Shaded / Second",
+		"Textures / Vertex",
+		"Textures / Fragment",
+		"% Time Shading Fragments",
+		"% Time Shading Vertices",
+		"Read Total (Bytes/sec)",
+		"Write Total (Bytes/sec)",
+		// Mali
+		"GPU active cycles",
+		"Any iterator active cycles",
+		"Fragment jobs",
+		"Fragment active cycles",
+		"Non-fragment active cycles",
+		"Tiler active cycles",
+		"External memory read bytes",
+		"External memory write bytes",
+		"GPU utilization",
+		"Fragment queue utilization",
+		"Execution core utilization",
+	} {
+		assert.For(ctx, name).That(isUnusedFeatureCounter(spec(name), none)).Equals(false)
+	}
+
+	for _, test := range []struct {
+		spec   *device.GpuCounterDescriptor_GpuCounterSpec
+		unused bool
+	}{
+		// Adreno
+		{spec("% Time Compute"), true},
+		// Whole words only.
+		{spec("Tessellated Primitives"), true},
+		{spec("GS Invocations"), true},
+		{spec("Computed Attributes"), false},
+		{spec("Settings / Second"), false},
+		// Counters shared with the vertex or fragment work are kept.
+		{spec("Vertex and compute jobs"), false},
+		// The counter groups take precedence over the names.
+		{spec("Warps", device.GpuCounterDescriptor_COMPUTE), true},
+		{spec("Compute Warps", device.GpuCounterDescriptor_VERTICES, device.GpuCounterDescriptor_COMPUTE), false},
+	} {
+		name := test.spec.Name
+		assert.For(ctx, name).That(isUnusedFeatureCounter(test.spec, none)).Equals(test.unused)
+		assert.For(ctx, "%v used", name).That(isUnusedFeatureCounter(test.spec, all)).Equals(false)
+	}
+}
+
+func TestGpuProfileAnalyses(t *testing.T) {
+	ctx := log.Testing(t)
+
+	options := GpuProfileOptions{Analyses: []service.CaptureAnalysis{
+		service.CaptureAnalysis_DescriptorAnalysis,
+		service.CaptureAnalysis_MemoryAnalysis,
+	}}
+	for analysis, requested := range map[service.CaptureAnalysis]bool{
+		service.CaptureAnalysis_RenderPassAnalysis: false,
+		service.CaptureAnalysis_DescriptorAnalysis: true,
+		service.CaptureAnalysis_QueueAnalysis:      false,
+		service.CaptureAnalysis_MemoryAnalysis:     true,
+	} {
+		assert.For(ctx, "%v", analysis).That(options.analyzes(analysis)).Equals(requested)
+		assert.For(ctx, "%v by default", analysis).That(GpuProfileOptions{}.analyzes(analysis)).Equals(false)
+	}
+}
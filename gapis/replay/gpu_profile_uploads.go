@@ -0,0 +1,128 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// analyzePasses returns the uploads, the draws and the depth-only passes of
+// the render passes of the capture. Returns nil if none of the APIs of the
+// capture can measure them.
+func analyzePasses(ctx context.Context, apis []api.API, capturePath *path.Capture) []PassUploads {
+	for _, a := range apis {
+		ua, ok := a.(UploadAnalyzer)
+		if !ok {
+			continue
+		}
+		uploads, err := ua.PassUploads(ctx, capturePath)
+		if err != nil {
+			log.W(ctx, "Failed to measure the uploads of the render passes: %v", err)
+			return nil
+		}
+		return uploads
+	}
+	return nil
+}
+
+// passUploads returns the data uploaded for each render pass group of the
+// data, by decreasing constant bytes. Returns nil if the passes weren't
+// analyzed.
+func passUploads(data *service.ProfilingData, passes []PassUploads) []*service.ProfilingData_PassUploads {
+	if passes == nil {
+		return nil
+	}
+	return groupUploads(data.GetSlices().GetGroups(), passes)
+}
+
+// drawDurations returns the distribution of the draw durations of each
+// render pass group of the data, with the draw commands of the analyzed
+// passes matched to the draw slices of their groups.
+func drawDurations(data *service.ProfilingData, passes []PassUploads) []*service.ProfilingData_DrawDurations {
+	byFrom := map[string][]api.SubCmdIdx{}
+	for _, p := range passes {
+		byFrom[fmt.Sprint(p.From)] = p.DrawCmds
+	}
+	draws := map[int32][]api.SubCmdIdx{}
+	for _, group := range data.GetSlices().GetGroups() {
+		if group.Link == nil {
+			continue
+		}
+		if cmds, ok := byFrom[fmt.Sprint(api.SubCmdIdx(group.Link.From))]; ok {
+			draws[group.Id] = cmds
+		}
+	}
+	return profile.ComputeDrawDurations(data.GetSlices(), draws)
+}
+
+// depthPasses returns the cost of the depth-only render passes of the
+// analyzed passes, matched to the render pass groups of the data. Returns nil
+// if there are none.
+func depthPasses(data *service.ProfilingData, passes []PassUploads) *service.ProfilingData_DepthPasses {
+	byFrom := map[string]PassUploads{}
+	for _, p := range passes {
+		if p.DepthOnly {
+			byFrom[fmt.Sprint(p.From)] = p
+		}
+	}
+	depth := map[int32]profile.DepthPass{}
+	for _, group := range data.GetSlices().GetGroups() {
+		if group.Link == nil {
+			continue
+		}
+		if p, ok := byFrom[fmt.Sprint(api.SubCmdIdx(group.Link.From))]; ok {
+			depth[group.Id] = profile.DepthPass{Pixels: p.Pixels, Primitives: p.Primitives}
+		}
+	}
+	return profile.ComputeDepthPasses(data, depth)
+}
+
+// groupUploads matches the uploads to the groups linked to the commands
+// beginning the render passes.
+func groupUploads(groups []*service.ProfilingData_GpuSlices_Group, uploads []PassUploads) []*service.ProfilingData_PassUploads {
+	passes := map[string]PassUploads{}
+	for _, u := range uploads {
+		passes[fmt.Sprint(u.From)] = u
+	}
+
+	res := []*service.ProfilingData_PassUploads{}
+	for _, group := range groups {
+		if group.Link == nil {
+			continue
+		}
+		u, ok := passes[fmt.Sprint(api.SubCmdIdx(group.Link.From))]
+		if !ok {
+			continue
+		}
+		res = append(res, &service.ProfilingData_PassUploads{
+			GroupId:       group.Id,
+			ConstantBytes: u.Constants,
+			VertexBytes:   u.Vertices,
+			IndexBytes:    u.Indices,
+			PushConstants: u.PushConstants,
+			Draws:         u.Draws,
+		})
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ConstantBytes > res[j].ConstantBytes })
+	return res
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestGroupUploads(t *testing.T) {
+	ctx := log.Testing(t)
+
+	uploads := []PassUploads{
+		{From: api.SubCmdIdx{10, 0, 0, 1}, To: api.SubCmdIdx{10, 0, 0, 5}, Constants: 28, PushConstants: 2, Draws: 2},
+		{From: api.SubCmdIdx{10, 0, 0, 7}, To: api.SubCmdIdx{10, 0, 0, 8}, Vertices: 32},
+	}
+	link := func(from ...uint64) *path.Commands {
+		return &path.Commands{From: from, To: from}
+	}
+	data := &service.ProfilingData{Slices: &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Link: link(10, 0, 0, 7)},
+			{Id: 2},
+			{Id: 3, Link: link(10, 0, 0, 1)},
+			{Id: 4, Link: link(20, 0, 0, 1)},
+		},
+	}}
+
+	assert.For(ctx, "not analyzed").ThatSlice(passUploads(data, nil)).IsEmpty()
+	// The groups are sorted by decreasing constant bytes.
+	assert.For(ctx, "uploads").ThatSlice(passUploads(data, uploads)).DeepEquals([]*service.ProfilingData_PassUploads{
+		{GroupId: 3, ConstantBytes: 28, PushConstants: 2, Draws: 2},
+		{GroupId: 1, VertexBytes: 32},
+	})
+}
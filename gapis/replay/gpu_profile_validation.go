@@ -0,0 +1,54 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// validateReplay replays the capture with the validation layers enabled, and
+// returns the errors and warnings they report. Returns nil if none of the
+// APIs of the capture can be validated.
+func validateReplay(ctx context.Context, apis []api.API, intent Intent, mgr Manager, hints *path.UsageHints) ([]*service.ProfilingData_ValidationIssue, error) {
+	var res []*service.ProfilingData_ValidationIssue
+	for _, a := range apis {
+		qi, ok := a.(QueryIssues)
+		if !ok {
+			continue
+		}
+		issues, err := qi.QueryIssues(ctx, intent, mgr, false, hints)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if issue.Severity < service.Severity_WarningLevel {
+				continue
+			}
+			v := &service.ProfilingData_ValidationIssue{
+				Severity: issue.Severity,
+				Message:  issue.Error.Error(),
+			}
+			if issue.Command != api.CmdNoID {
+				v.Command = intent.Capture.Command(uint64(issue.Command))
+			}
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
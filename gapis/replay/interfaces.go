@@ -94,6 +94,117 @@ type Profiler interface {
 		loopCount int32) (*service.ProfilingData, error)
 }
 
+// FeatureAnalyzer is the optional interface implemented by APIs that can
+// report the GPU features used by a capture, used to skip the GPU counters
+// that can't measure any of the capture's work when profiling.
+type FeatureAnalyzer interface {
+	CaptureFeatures(ctx context.Context, capture *path.Capture) (CaptureFeatures, error)
+}
+
+// CaptureFeatures are the GPU features used by a capture.
+type CaptureFeatures struct {
+	Tessellation bool
+	Geometry     bool
+	Compute      bool
+}
+
+// UploadAnalyzer is the optional interface implemented by APIs that can
+// measure the data uploaded for each render pass of a capture by the commands
+// of the command buffers, used to report the constant update churn.
+type UploadAnalyzer interface {
+	PassUploads(ctx context.Context, capture *path.Capture) ([]PassUploads, error)
+}
+
+// PassUploads is the data uploaded for a render pass, in bytes. Updates
+// recorded before a render pass in its command buffer are attributed to it.
+type PassUploads struct {
+	// The commands beginning and ending the render pass.
+	From, To api.SubCmdIdx
+	// The push constants and the updates of uniform buffers.
+	Constants uint64
+	// The updates of vertex and index buffers.
+	Vertices, Indices uint64
+	// The number of push constant updates and draws in the render pass.
+	PushConstants, Draws uint32
+	// The draw commands of the render pass, in recording order.
+	DrawCmds []api.SubCmdIdx
+	// Whether the render pass only writes depth or stencil, e.g. a shadow
+	// map or a depth prepass: it has a depth/stencil attachment and none of
+	// its draws writes a color attachment.
+	DepthOnly bool
+	// The number of pixels of the render area of the pass.
+	Pixels uint64
+	// The number of primitives of the direct draws of the pass, including
+	// their instances.
+	Primitives uint64
+}
+
+// DescriptorAnalyzer is the optional interface implemented by APIs that can
+// measure the descriptor usage of each frame of a capture, used to report the
+// use of descriptor indexing.
+type DescriptorAnalyzer interface {
+	FrameDescriptors(ctx context.Context, capture *path.Capture) ([]FrameDescriptors, error)
+}
+
+// FrameDescriptors is the descriptor usage of a frame of a capture.
+type FrameDescriptors struct {
+	// The number of commands binding descriptor sets, and of the sets they
+	// bound.
+	Binds, BoundSets uint32
+	// The number of descriptors written by the updates of descriptor sets.
+	Writes uint32
+	// The number of distinct sets bound that were allocated from
+	// update-after-bind pools, and with a variable descriptor count.
+	UpdateAfterBindSets, VariableCountSets uint32
+}
+
+// QueueAnalyzer is the optional interface implemented by APIs that can find
+// the dependencies between the submissions to different queues of a capture,
+// used to report the time of the cross-queue waits and ownership transfers.
+type QueueAnalyzer interface {
+	QueueDependencies(ctx context.Context, capture *path.Capture) ([]QueueSubmission, error)
+}
+
+// QueueSubmission is a batch of command buffers submitted to a queue, with
+// the submissions to other queues it depends on.
+type QueueSubmission struct {
+	// The command submitting the batch, and the index of the batch in it.
+	Submit api.SubCmdIdx
+	// The frame of the submission, being the number of presentations before
+	// it.
+	Frame int
+	Queue uint64
+	// The submissions signalling the semaphores the submission waits on, by
+	// index.
+	Waits []int
+	// The submissions releasing the ownership of the resources the
+	// submission acquires, by index, and the number of resources acquired.
+	Acquires  []int
+	Transfers uint32
+}
+
+// MemoryAnalyzer is the optional interface implemented by APIs that can
+// track the device memory allocations of a capture, used to report the
+// memory timeline of the frames.
+type MemoryAnalyzer interface {
+	MemoryTimeline(ctx context.Context, capture *path.Capture) ([]MemoryEvent, error)
+}
+
+// MemoryEvent is an allocation or free of device memory, or a change in the
+// number of images and buffers, by a command of a capture.
+type MemoryEvent struct {
+	// The command of the event, or api.CmdNoID for the initial state.
+	Command api.CmdID
+	// The frame of the event, being the number of presentations before it.
+	Frame int
+	// The memory heap of an allocation or free, and the allocated size in
+	// bytes, negative if freed.
+	Heap uint32
+	Size int64
+	// The number of images and buffers created, negative if destroyed.
+	Images, Buffers int32
+}
+
 // Issue represents a single replay issue reported by QueryIssues.
 type Issue struct {
 	Command  api.CmdID        // The command that reported the issue.
@@ -105,4 +216,25 @@ type Issue struct {
 type ProfileExperiments struct {
 	DisabledCmds                [][]uint64
 	DisableAnisotropicFiltering bool
+	// ResolutionScale is the factor by which the viewports, scissors and
+	// render areas are scaled. If 0, the replay is not scaled.
+	ResolutionScale float32
+	// LodBias is added to the mip LOD bias of every sampler.
+	LodBias float32
+	// NearestFiltering, if true, replaces the filtering of every sampler by
+	// nearest filtering, without anisotropy.
+	NearestFiltering bool
+	// ShadingRateWidth and ShadingRateHeight are the fragment size of the
+	// render passes of ShadingRatePasses, or of all the render passes if
+	// empty. If 0, the shading rate is not changed.
+	ShadingRateWidth  uint32
+	ShadingRateHeight uint32
+	ShadingRatePasses []uint64
+	// CalibrateTimestamps, if true, inserts timestamp queries around the
+	// command buffers of the replay, used to verify the GPU clock of the
+	// trace.
+	CalibrateTimestamps bool
+	// Range is the range of commands to profile. If empty, all the commands
+	// are profiled.
+	Range api.CmdIDRange
 }
@@ -0,0 +1,147 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/core/os/device/farm"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// farmDeviceTimeout is the time to wait for a leased device to be picked up
+// by the device scan after connecting to it.
+const farmDeviceTimeout = time.Minute
+
+// farmLease is a lease of a device acquired from the device farm.
+type farmLease struct {
+	lease *farm.Lease
+	// The session the device is leased for, or the zero ID if none.
+	session id.ID
+}
+
+func (s *server) AcquireFarmDevice(ctx context.Context, req *service.AcquireFarmDeviceRequest) (*service.FarmDevice, error) {
+	ctx = status.Start(ctx, "RPC AcquireFarmDevice")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "AcquireFarmDevice")
+	if s.deviceFarm == nil {
+		return nil, fmt.Errorf("The server has no device farm")
+	}
+	var session id.ID
+	if req.Session != nil {
+		session = req.Session.ID()
+		if _, err := s.sessions.Get(session); err != nil {
+			return nil, err
+		}
+	}
+	lease, err := s.deviceFarm.Acquire(ctx, &farm.AcquireRequest{Constraints: req.Constraints})
+	if err != nil {
+		return nil, err
+	}
+	d, err := connectFarmDevice(ctx, lease)
+	if err != nil {
+		s.releaseFarmLease(ctx, lease)
+		return nil, err
+	}
+	s.farmLeases.Store(lease.Id, &farmLease{lease, session})
+	return &service.FarmDevice{
+		Device:  path.NewDevice(d.Instance().ID.ID()),
+		LeaseId: lease.Id,
+		Expires: lease.Expires,
+	}, nil
+}
+
+func (s *server) ReleaseFarmDevice(ctx context.Context, req *service.ReleaseFarmDeviceRequest) error {
+	ctx = status.Start(ctx, "RPC ReleaseFarmDevice")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "ReleaseFarmDevice")
+	l, ok := s.farmLeases.LoadAndDelete(req.LeaseId)
+	if !ok {
+		return fmt.Errorf("Unknown device lease %v", req.LeaseId)
+	}
+	lease := l.(*farmLease).lease
+	if err := adb.Disconnect(ctx, lease.Address); err != nil {
+		log.W(ctx, "Failed to disconnect from the leased device %v: %v", lease.Address, err)
+	}
+	return s.deviceFarm.Release(ctx, lease)
+}
+
+// releaseFarmDevices releases the leased devices matching the predicate,
+// e.g. the devices of a closed session.
+func (s *server) releaseFarmDevices(ctx context.Context, pred func(*farmLease) bool) {
+	s.farmLeases.Range(func(key, value interface{}) bool {
+		if pred(value.(*farmLease)) {
+			if _, ok := s.farmLeases.LoadAndDelete(key); ok {
+				s.releaseFarmLease(ctx, value.(*farmLease).lease)
+			}
+		}
+		return true
+	})
+}
+
+// releaseFarmLease disconnects from the leased device and returns it to the
+// device farm, logging the failures.
+func (s *server) releaseFarmLease(ctx context.Context, lease *farm.Lease) {
+	if err := adb.Disconnect(ctx, lease.Address); err != nil {
+		log.W(ctx, "Failed to disconnect from the leased device %v: %v", lease.Address, err)
+	}
+	if err := s.deviceFarm.Release(ctx, lease); err != nil {
+		log.W(ctx, "Failed to release the device of lease %v: %v", lease.Id, err)
+	}
+}
+
+// connectFarmDevice connects to the leased device over adb, and waits for it
+// to be added to the device registry.
+func connectFarmDevice(ctx context.Context, lease *farm.Lease) (bind.Device, error) {
+	registry := bind.GetRegistry(ctx)
+	added := make(chan bind.Device, 1)
+	isLeased := func(d bind.Device) bool {
+		return d.Instance().GetSerial() == lease.Address
+	}
+	unlisten := registry.Listen(bind.NewDeviceListener(func(ctx context.Context, d bind.Device) {
+		if isLeased(d) {
+			select {
+			case added <- d:
+			default:
+			}
+		}
+	}, func(context.Context, bind.Device) {}))
+	defer unlisten()
+
+	for _, d := range registry.Devices() {
+		if isLeased(d) {
+			return d, nil
+		}
+	}
+	if err := adb.Connect(ctx, lease.Address); err != nil {
+		return nil, err
+	}
+	select {
+	case d := <-added:
+		return d, nil
+	case <-time.After(farmDeviceTimeout):
+		return nil, fmt.Errorf("Timed out waiting for the leased device %v", lease.Address)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,13 +54,27 @@ func Listen(ctx context.Context, addr string, cfg Config) error {
 // NewWithListener starts a new GRPC server listening on l.
 // This is a blocking call.
 func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan chan<- *grpc.Server) error {
+	handler := New(ctx, cfg)
+	// The devices leased from the device farm are released once the server
+	// stops, with a context that isn't cancelled.
+	defer handler.(*server).releaseFarmDevices(keys.Clone(context.Background(), ctx), func(*farmLease) bool { return true })
+
 	s := &grpcServer{
-		handler:      New(ctx, cfg),
+		handler:      handler,
 		bindCtx:      func(c context.Context) context.Context { return keys.Clone(c, ctx) },
 		keepAlive:    make(chan struct{}, 1),
 		interrupters: map[int]func(){},
 	}
 
+	// An ACL, if given, replaces the single auth-token.
+	acl := cfg.ACL
+	if acl == nil {
+		acl = auth.ACL{cfg.AuthToken: auth.ReadWrite}
+	}
+	if cfg.ReadOnly {
+		acl = acl.ReadOnly()
+	}
+
 	done := make(chan error)
 	ctx, stop := task.WithCancel(ctx)
 	crash.Go(func() {
@@ -78,8 +93,8 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 				crash.Go(func() { s.stopOnInterrupt(ctx, server, stop) })
 			}
 			return nil
-		}, grpc.UnaryInterceptor(auth.UnaryServerInterceptor(cfg.AuthToken)),
-			grpc.StreamInterceptor(auth.StreamServerInterceptor(cfg.AuthToken)))
+		}, grpc.UnaryInterceptor(acl.UnaryServerInterceptor(isReadMethod)),
+			grpc.StreamInterceptor(acl.StreamServerInterceptor(isReadMethod)))
 	})
 
 	select {
@@ -95,6 +110,37 @@ func NewWithListener(ctx context.Context, l net.Listener, cfg Config, srvChan ch
 	}
 }
 
+// readMethods are the RPCs that don't modify the state of the server or of
+// its devices. Get may still replay captures on the devices, to resolve the
+// framebuffers, resources and other paths of the captures that depend on a
+// replay. These are the only RPCs allowed in read-only mode and for read-only
+// auth-tokens.
+var readMethods = map[string]bool{
+	"Ping":                     true,
+	"GetServerInfo":            true,
+	"CheckForUpdates":          true,
+	"Get":                      true,
+	"Follow":                   true,
+	"GetAvailableStringTables": true,
+	"GetStringTable":           true,
+	"GetLogStream":             true,
+	"Find":                     true,
+	"ClientEvent":              true,
+	"Status":                   true,
+	"PerfettoQuery":            true,
+	"GetProfilingHistory":      true,
+	"GetPresets":               true,
+	"GetSession":               true,
+	"GetPerformanceCounters":   true,
+	"GetProfile":               true,
+}
+
+// isReadMethod returns whether the gRPC method, in the form
+// "/package.Service/Method", is one of the readMethods.
+func isReadMethod(method string) bool {
+	return readMethods[method[strings.LastIndex(method, "/")+1:]]
+}
+
 type grpcServer struct {
 	handler         Server
 	bindCtx         func(context.Context) context.Context
@@ -488,6 +534,24 @@ func (s *grpcServer) SaveCapture(ctx xctx.Context, req *service.SaveCaptureReque
 	return &service.SaveCaptureResponse{}, nil
 }
 
+func (s *grpcServer) LoadBundle(ctx xctx.Context, req *service.LoadBundleRequest) (*service.LoadBundleResponse, error) {
+	defer s.inRPC()()
+	bundle, err := s.handler.LoadBundle(s.bindCtx(ctx), req.Path)
+	if err := service.NewError(err); err != nil {
+		return &service.LoadBundleResponse{Res: &service.LoadBundleResponse_Error{Error: err}}, nil
+	}
+	return &service.LoadBundleResponse{Res: &service.LoadBundleResponse_Bundle{Bundle: bundle}}, nil
+}
+
+func (s *grpcServer) SaveBundle(ctx xctx.Context, req *service.SaveBundleRequest) (*service.SaveBundleResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.SaveBundle(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.SaveBundleResponse{Error: err}, nil
+	}
+	return &service.SaveBundleResponse{}, nil
+}
+
 func (s *grpcServer) ExportReplay(ctx xctx.Context, req *service.ExportReplayRequest) (*service.ExportReplayResponse, error) {
 	defer s.inRPC()()
 	err := s.handler.ExportReplay(s.bindCtx(ctx), req.Capture, req.Device, req.Path, req.Options)
@@ -565,6 +629,105 @@ func (s *grpcServer) GpuProfile(ctx xctx.Context, req *service.GpuProfileRequest
 	return &service.GpuProfileResponse{Res: &service.GpuProfileResponse_ProfilingData{ProfilingData: res}}, nil
 }
 
+func (s *grpcServer) GetProfilingHistory(ctx xctx.Context, req *service.GetProfilingHistoryRequest) (*service.GetProfilingHistoryResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetProfilingHistory(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetProfilingHistoryResponse{Res: &service.GetProfilingHistoryResponse_Error{Error: err}}, nil
+	}
+	return &service.GetProfilingHistoryResponse{Res: &service.GetProfilingHistoryResponse_History{History: res}}, nil
+}
+
+func (s *grpcServer) GetPresets(ctx xctx.Context, req *service.GetPresetsRequest) (*service.GetPresetsResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetPresets(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetPresetsResponse{Res: &service.GetPresetsResponse_Error{Error: err}}, nil
+	}
+	return &service.GetPresetsResponse{Res: &service.GetPresetsResponse_Presets{Presets: res}}, nil
+}
+
+func (s *grpcServer) SavePreset(ctx xctx.Context, req *service.SavePresetRequest) (*service.SavePresetResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.SavePreset(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.SavePresetResponse{Error: err}, nil
+	}
+	return &service.SavePresetResponse{}, nil
+}
+
+func (s *grpcServer) DeletePreset(ctx xctx.Context, req *service.DeletePresetRequest) (*service.DeletePresetResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.DeletePreset(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.DeletePresetResponse{Error: err}, nil
+	}
+	return &service.DeletePresetResponse{}, nil
+}
+
+func (s *grpcServer) GetTimeMapping(ctx xctx.Context, req *service.GetTimeMappingRequest) (*service.GetTimeMappingResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetTimeMapping(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetTimeMappingResponse{Res: &service.GetTimeMappingResponse_Error{Error: err}}, nil
+	}
+	return &service.GetTimeMappingResponse{Res: &service.GetTimeMappingResponse_Mapping{Mapping: res}}, nil
+}
+
+func (s *grpcServer) GetGroupCounterSamples(ctx xctx.Context, req *service.GetGroupCounterSamplesRequest) (*service.GetGroupCounterSamplesResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetGroupCounterSamples(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetGroupCounterSamplesResponse{Res: &service.GetGroupCounterSamplesResponse_Error{Error: err}}, nil
+	}
+	return &service.GetGroupCounterSamplesResponse{Res: &service.GetGroupCounterSamplesResponse_Samples{Samples: res}}, nil
+}
+
+func (s *grpcServer) CreateSession(ctx xctx.Context, req *service.CreateSessionRequest) (*service.CreateSessionResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.CreateSession(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.CreateSessionResponse{Res: &service.CreateSessionResponse_Error{Error: err}}, nil
+	}
+	return &service.CreateSessionResponse{Res: &service.CreateSessionResponse_Session{Session: res}}, nil
+}
+
+func (s *grpcServer) GetSession(ctx xctx.Context, req *service.GetSessionRequest) (*service.GetSessionResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.GetSession(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.GetSessionResponse{Res: &service.GetSessionResponse_Error{Error: err}}, nil
+	}
+	return &service.GetSessionResponse{Res: &service.GetSessionResponse_Session{Session: res}}, nil
+}
+
+func (s *grpcServer) CloseSession(ctx xctx.Context, req *service.CloseSessionRequest) (*service.CloseSessionResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.CloseSession(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.CloseSessionResponse{Error: err}, nil
+	}
+	return &service.CloseSessionResponse{}, nil
+}
+
+func (s *grpcServer) AcquireFarmDevice(ctx xctx.Context, req *service.AcquireFarmDeviceRequest) (*service.AcquireFarmDeviceResponse, error) {
+	defer s.inRPC()()
+	res, err := s.handler.AcquireFarmDevice(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.AcquireFarmDeviceResponse{Res: &service.AcquireFarmDeviceResponse_Error{Error: err}}, nil
+	}
+	return &service.AcquireFarmDeviceResponse{Res: &service.AcquireFarmDeviceResponse_Device{Device: res}}, nil
+}
+
+func (s *grpcServer) ReleaseFarmDevice(ctx xctx.Context, req *service.ReleaseFarmDeviceRequest) (*service.ReleaseFarmDeviceResponse, error) {
+	defer s.inRPC()()
+	err := s.handler.ReleaseFarmDevice(s.bindCtx(ctx), req)
+	if err := service.NewError(err); err != nil {
+		return &service.ReleaseFarmDeviceResponse{Error: err}, nil
+	}
+	return &service.ReleaseFarmDeviceResponse{}, nil
+}
+
 func (s *grpcServer) UpdateSettings(ctx xctx.Context, req *service.UpdateSettingsRequest) (*service.UpdateSettingsResponse, error) {
 	defer s.inRPC()()
 	err := s.handler.UpdateSettings(s.bindCtx(ctx), req)
@@ -22,12 +22,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/gapid/core/app/crash"
 	"github.com/google/gapid/core/app/crash/reporting"
 	"github.com/google/gapid/core/context/keys"
@@ -40,12 +42,19 @@ import (
 	"github.com/google/gapid/core/event/task"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/core/os/device"
 	"github.com/google/gapid/core/os/device/bind"
+	"github.com/google/gapid/core/os/device/farm"
 	"github.com/google/gapid/core/os/file"
+	"github.com/google/gapid/gapis/bundle"
+	"github.com/google/gapid/gapis/calibration"
 	"github.com/google/gapid/gapis/capture"
 	"github.com/google/gapid/gapis/config"
+	"github.com/google/gapid/gapis/history"
 	"github.com/google/gapid/gapis/messages"
+	perfetto_processor "github.com/google/gapid/gapis/perfetto"
 	perfetto "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/presets"
 	"github.com/google/gapid/gapis/replay"
 	"github.com/google/gapid/gapis/replay/devices"
 	"github.com/google/gapid/gapis/resolve"
@@ -53,8 +62,11 @@ import (
 	"github.com/google/gapid/gapis/resolve/dependencygraph2/graph_visualization"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/session"
 	"github.com/google/gapid/gapis/stringtable"
 	"github.com/google/gapid/gapis/trace"
+	"github.com/google/gapid/gapis/trace/android/profile"
+	"github.com/google/gapid/gapis/trace/trigger"
 
 	// Register all the apis
 	_ "github.com/google/gapid/gapis/api/all"
@@ -66,14 +78,20 @@ const (
 
 // Config holds the server configuration settings.
 type Config struct {
-	Info             *service.ServerInfo
-	StringTables     []*stringtable.StringTable
-	EnableLocalFiles bool
-	PreloadDepGraph  bool
-	AuthToken        auth.Token
-	DeviceScanDone   task.Signal
-	LogBroadcaster   *log.Broadcaster
-	IdleTimeout      time.Duration
+	Info               *service.ServerInfo
+	StringTables       []*stringtable.StringTable
+	EnableLocalFiles   bool
+	PreloadDepGraph    bool
+	AuthToken          auth.Token
+	DeviceScanDone     task.Signal
+	LogBroadcaster     *log.Broadcaster
+	IdleTimeout        time.Duration
+	ProfileHistory     string
+	CounterCalibration string
+	DeviceFarm         string
+	Presets            string
+	ACL                auth.ACL
+	ReadOnly           bool
 }
 
 // Server is the server interface to GAPIS.
@@ -83,23 +101,81 @@ type Server interface {
 
 // New constructs and returns a new Server.
 func New(ctx context.Context, cfg Config) Server {
+	var profileHistory *history.DB
+	if cfg.ProfileHistory != "" {
+		var err error
+		if profileHistory, err = history.Open(ctx, cfg.ProfileHistory); err != nil {
+			log.W(ctx, "Profiling history disabled: %v", err)
+		}
+	}
+	var counterCalibration *service.CounterCalibration
+	if cfg.CounterCalibration != "" {
+		var err error
+		if counterCalibration, err = calibration.Load(ctx, cfg.CounterCalibration); err != nil {
+			log.W(ctx, "Counter calibration disabled: %v", err)
+		} else {
+			applyCosts := func(ctx context.Context, d bind.Device) {
+				conf := d.Instance().GetConfiguration()
+				desc := conf.GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor()
+				calibration.ApplySamplingCosts(counterCalibration, conf.GetHardware().GetGPU().GetName(), desc)
+			}
+			registry := bind.GetRegistry(ctx)
+			registry.Listen(bind.NewDeviceListener(applyCosts, func(context.Context, bind.Device) {}))
+			for _, d := range registry.Devices() {
+				applyCosts(ctx, d)
+			}
+		}
+	}
+	var presetStore *presets.Store
+	if cfg.Presets != "" {
+		var err error
+		if presetStore, err = presets.Open(ctx, cfg.Presets); err != nil {
+			log.W(ctx, "Presets disabled: %v", err)
+		}
+	}
+	var deviceFarm farm.Provider
+	if cfg.DeviceFarm != "" {
+		var err error
+		if deviceFarm, err = farm.New(ctx, cfg.DeviceFarm); err != nil {
+			log.W(ctx, "Device farm disabled: %v", err)
+		}
+	}
 	return &server{
-		cfg.Info,
-		cfg.StringTables,
-		cfg.EnableLocalFiles,
-		cfg.PreloadDepGraph,
-		cfg.DeviceScanDone,
-		cfg.LogBroadcaster,
+		info:               cfg.Info,
+		stbs:               cfg.StringTables,
+		enableLocalFiles:   cfg.EnableLocalFiles,
+		preloadDepGraph:    cfg.PreloadDepGraph,
+		deviceScanDone:     cfg.DeviceScanDone,
+		logBroadcaster:     cfg.LogBroadcaster,
+		profileHistory:     profileHistory,
+		counterCalibration: counterCalibration,
+		sessions:           session.NewManager(),
+		deviceFarm:         deviceFarm,
+		presets:            presetStore,
 	}
 }
 
 type server struct {
-	info             *service.ServerInfo
-	stbs             []*stringtable.StringTable
-	enableLocalFiles bool
-	preloadDepGraph  bool
-	deviceScanDone   task.Signal
-	logBroadcaster   *log.Broadcaster
+	info               *service.ServerInfo
+	stbs               []*stringtable.StringTable
+	enableLocalFiles   bool
+	preloadDepGraph    bool
+	deviceScanDone     task.Signal
+	logBroadcaster     *log.Broadcaster
+	profileHistory     *history.DB
+	counterCalibration *service.CounterCalibration
+	sessions           *session.Manager
+	deviceFarm         farm.Provider
+	presets            *presets.Store
+	// captureFiles are the local files the captures were loaded from, keyed
+	// by capture ID.
+	captureFiles sync.Map
+	// profileTraces are the *profileTrace of the last profiles of the
+	// graphics captures, keyed by capture ID.
+	profileTraces sync.Map
+	// farmLeases are the farmLeases of the devices acquired from the device
+	// farm, keyed by lease ID.
+	farmLeases sync.Map
 }
 
 func (s *server) Ping(ctx context.Context) error {
@@ -210,6 +286,7 @@ func (s *server) LoadCapture(ctx context.Context, path string) (*path.Capture, e
 	if err != nil {
 		return nil, err
 	}
+	s.captureFiles.Store(p.ID.ID(), path)
 	// Ensure the capture can be read by resolving it now.
 	c, err := capture.ResolveFromPath(ctx, p)
 	if err != nil {
@@ -251,6 +328,104 @@ func (s *server) SaveCapture(ctx context.Context, c *path.Capture, path string)
 	defer f.Close()
 	return capture.Export(ctx, c, f)
 }
+
+func (s *server) LoadBundle(ctx context.Context, path string) (*service.LoadedBundle, error) {
+	ctx = status.Start(ctx, "RPC LoadBundle")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "LoadBundle")
+	if !s.enableLocalFiles {
+		return nil, fmt.Errorf("Server not configured to allow reading of local files")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := bundle.Read(f)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to read the bundle %v", path)
+	}
+
+	res := &service.LoadedBundle{Device: b.Device, ProfilingData: b.ProfilingData}
+	if len(b.Capture) > 0 {
+		if res.Capture, err = importBundled(ctx, b.CaptureName, b.Capture); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.PerfettoTrace) > 0 {
+		if res.PerfettoTrace, err = importBundled(ctx, b.PerfettoTraceName, b.PerfettoTrace); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// importBundled imports the data of a capture, or Perfetto trace, of a bundle.
+func importBundled(ctx context.Context, name string, data []byte) (*path.Capture, error) {
+	p, err := capture.Import(ctx, name, name, &capture.Blob{Data: data})
+	if err != nil {
+		return nil, err
+	}
+	// Ensure the capture can be read by resolving it now.
+	if _, err = capture.ResolveFromPath(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *server) SaveBundle(ctx context.Context, req *service.SaveBundleRequest) error {
+	ctx = status.Start(ctx, "RPC SaveBundle")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "SaveBundle")
+	if !s.enableLocalFiles {
+		return fmt.Errorf("Server not configured to allow writing of local files")
+	}
+
+	b := &service.Bundle{ProfilingData: req.ProfilingData}
+	if req.Capture != nil {
+		c, err := capture.ResolveFromPath(ctx, req.Capture)
+		if err != nil {
+			return err
+		}
+		b.CaptureName = c.Name()
+		// Perfetto captures can't be exported, they are bundled from the
+		// Perfetto trace file.
+		if _, ok := c.(*capture.PerfettoCapture); !ok {
+			buf := bytes.Buffer{}
+			if err := c.Export(ctx, &buf); err != nil {
+				return err
+			}
+			b.Capture = buf.Bytes()
+		}
+	}
+	if req.PerfettoTrace != "" {
+		f, err := os.Open(req.PerfettoTrace)
+		if err != nil {
+			return err
+		}
+		b.PerfettoTrace, err = ReadFile(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		b.PerfettoTraceName = filepath.Base(req.PerfettoTrace)
+	}
+	if req.Device != nil {
+		if d := bind.GetRegistry(ctx).Device(req.Device.ID.ID()); d != nil {
+			b.Device = d.Instance()
+		}
+	}
+
+	f, err := os.Create(req.Path)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Write(f, b); err != nil {
+		f.Close()
+		return log.Errf(ctx, err, "Failed to write the bundle %v", req.Path)
+	}
+	return f.Close()
+}
 func (s *server) ExportReplay(ctx context.Context, c *path.Capture, d *path.Device, out string, opts *service.ExportReplayOptions) error {
 	ctx = status.Start(ctx, "RPC ExportReplay")
 	defer status.Finish(ctx)
@@ -733,6 +908,7 @@ func (s *server) FindTraceTargets(ctx context.Context, req *service.FindTraceTar
 // traceHandler implements the TraceHandler interface
 // It wraps all of the state for a trace operation
 type traceHandler struct {
+	presets        *presets.Store
 	initialized    bool        // Has the trace been initialized yet
 	started        bool        // Has the trace been started yet
 	done           bool        // Has the trace been finished
@@ -749,15 +925,45 @@ func (r *traceHandler) Initialize(ctx context.Context, opts *service.TraceOption
 	if r.initialized {
 		return nil, log.Errf(ctx, nil, "Error initialize a running trace")
 	}
+	opts, err := r.presets.ApplyToTrace(opts)
+	if err != nil {
+		return nil, err
+	}
+	var triggers trigger.Source
+	if trigger.Enabled(opts.GetTriggers()) {
+		if triggers, err = trace.ObserveTriggers(ctx, opts.Device, opts); err != nil {
+			return nil, err
+		}
+		if len(opts.Triggers.Start) > 0 {
+			// The trace is started by the start triggers.
+			opts = proto.Clone(opts).(*service.TraceOptions)
+			opts.DeferStart = true
+		}
+	}
 	r.initialized = true
 	stopSignal, stopFunc := task.NewSignal()
 	readyFunc := task.Noop()
 	r.stopFunc = stopFunc
+	watchCtx, stopWatching := task.WithCancel(ctx)
 	go func() {
 		r.err = trace.Trace(ctx, opts.Device, r.startSignal, stopSignal, readyFunc, opts, &r.bytesWritten)
+		stopWatching()
 		r.done = true
 		r.doneSignalFunc(ctx)
 	}()
+	if triggers != nil {
+		crash.Go(func() {
+			defer triggers.Close(ctx)
+			start := func(ctx context.Context) error {
+				r.started = true
+				return r.startFunc(ctx)
+			}
+			if err := trigger.Watch(watchCtx, opts.Triggers, triggers, start, stopFunc); err != nil {
+				r.err = err
+				stopFunc(ctx)
+			}
+		})
+	}
 
 	stat := service.TraceStatus_Initializing
 	if !opts.DeferStart {
@@ -838,6 +1044,7 @@ func (s *server) Trace(ctx context.Context) (service.TraceHandler, error) {
 	startSignal, startFunc := task.NewSignal()
 	doneSignal, doneSigFunc := task.NewSignal()
 	return &traceHandler{
+		presets:        s.presets,
 		startSignal:    startSignal,
 		startFunc:      startFunc,
 		doneSignal:     doneSignal,
@@ -879,13 +1086,323 @@ func (s *server) GpuProfile(ctx context.Context, req *service.GpuProfileRequest)
 	ctx = status.Start(ctx, "RPC GpuProfile")
 	defer status.Finish(ctx)
 	ctx = log.Enter(ctx, "GpuProfile")
-	res, err := replay.GpuProfile(ctx, req.Capture, req.Device, req.Experiments, req.LoopCount)
+	req, err := s.presets.ApplyToProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	var data *service.ProfilingData
+	if req.Session != nil {
+		sess, err := s.sessions.Get(req.Session.ID())
+		if err != nil {
+			return nil, err
+		}
+		data, err = sess.Profile(ctx, req.Capture, req.Device, func() (*service.ProfilingData, error) {
+			return s.gpuProfile(ctx, req)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if req.CounterSampling != nil {
+			// The session keeps the profile with all its counter samples.
+			data = proto.Clone(data).(*service.ProfilingData)
+		}
+	} else if data, err = s.gpuProfile(ctx, req); err != nil {
+		return nil, err
+	}
+	if req.CounterSampling != nil {
+		data.Counters = profile.SampleCounters(data.Counters, req.CounterSampling)
+	}
+	return data, nil
+}
+
+func (s *server) gpuProfile(ctx context.Context, req *service.GpuProfileRequest) (*service.ProfilingData, error) {
+	if req.RecordQueries {
+		ctx = profile.PutRecordQueries(ctx)
+	}
+	if req.IncludeRawSliceArgs {
+		ctx = profile.PutIncludeRawArgs(ctx)
+	}
+	ctx = profile.PutCounterSpecMergePolicy(ctx, req.CounterSpecMergePolicy)
+	ctx = profile.PutCounterOverrides(ctx, req.CounterOverrides)
+	ctx = profile.PutCounterSources(ctx, req.CounterSourcePolicy, req.CounterSource)
+	ctx = profile.PutCounterDedupPolicy(ctx, req.CounterDedupPolicy)
+	ctx = profile.PutSliceDedupPolicy(ctx, req.SliceDedupPolicy)
+	ctx = profile.PutErrorPolicy(ctx, req.ErrorPolicy)
+	ignored, err := profile.CompileSlicePatterns(req.IgnoredSlices)
+	if err != nil {
+		return nil, err
+	}
+	ctx = profile.PutIgnoredSlices(ctx, ignored)
+	c, err := capture.ResolveFromPath(ctx, req.Capture)
 	if err != nil {
 		return nil, err
 	}
+	var res *service.ProfilingData
+	if p, ok := c.(*capture.PerfettoCapture); ok {
+		// Perfetto traces captured outside of AGI are processed as is. Their
+		// counter samples are cached next to the trace file, if known.
+		if file, ok := s.captureFiles.Load(req.Capture.ID.ID()); ok {
+			ctx = profile.PutCounterCache(ctx, profile.CounterCache{
+				Path: file.(string) + profile.CounterCacheSuffix,
+				Key:  req.Capture.ID.ID().String(),
+			})
+		}
+		res, err = profile.WithQueryRecording(ctx, p.Processor, func(querier perfetto_processor.Querier) (*service.ProfilingData, error) {
+			return profile.ProcessExternalProfilingData(ctx, querier)
+		})
+		// Make the groups and counters queryable alongside the raw trace
+		// data through PerfettoQuery.
+		if err == nil {
+			if err := profile.ExportTables(ctx, p.Processor, res); err != nil {
+				log.W(ctx, "Failed to export the profiling data tables: %v", err)
+			}
+		}
+	} else {
+		// Keep the Perfetto trace of the profile, but not those of the sweeps
+		// replayed after it, queryable through PerfettoQuery.
+		var profileTrace []byte
+		ctx := profile.PutTraceSink(ctx, func(data []byte) {
+			if profileTrace == nil {
+				profileTrace = data
+			}
+		})
+		// The mode is held for the sweeps too, such that they are compared to
+		// a profile taken at the same clocks.
+		var sustained *service.ProfilingData_SustainedPerformance
+		if req.SustainedPerformance {
+			var cleanup app.Cleanup
+			sustained, cleanup = replay.SustainedPerformance(ctx, req.Device)
+			defer cleanup.Invoke(ctx)
+		}
+		replayProfile := func(c *path.Capture) (*service.ProfilingData, error) {
+			return replay.GpuProfile(ctx, c, req.Device, replay.GpuProfileOptions{
+				Experiments: req.Experiments,
+				Range:       req.Range,
+				LoopCount:   req.LoopCount,
+				Bisect:      req.BisectCommandBuffers,
+				Prime:       req.PrimePipelineCaches,
+				Overhead:    req.MeasureOverhead,
+				AllCounters: req.AllCounters,
+				Validate:    req.Validate,
+				Calibrate:   req.CalibrateTimestamps,
+				Analyses:    req.CaptureAnalyses,
+			})
+		}
+		res, err = replayProfile(req.Capture)
+		if err == nil && req.ShaderReplacement != nil {
+			res.ShaderAb, err = profileShaderReplacement(ctx, req, res, replayProfile)
+		}
+		if err == nil && len(req.ResolutionScales) > 0 {
+			res.ResolutionSweep, err = profileResolutionSweep(ctx, req, res)
+		}
+		if err == nil && len(req.SamplerSweep) > 0 {
+			res.SamplerSweep, err = profileSamplerSweep(ctx, req, res)
+		}
+		if err == nil && req.ShadingRate != nil {
+			res.ShadingRate, err = profileShadingRate(ctx, req, res)
+		}
+		if err == nil {
+			res.SustainedPerformance = sustained
+		}
+		if err == nil && profileTrace != nil {
+			s.keepProfileTrace(ctx, req.Capture, profileTrace)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Device != nil {
+		if d := bind.GetRegistry(ctx).Device(req.Device.ID.ID()); d != nil {
+			if s.counterCalibration != nil {
+				calibration.Apply(s.counterCalibration, d.Instance().GetConfiguration().GetHardware().GetGPU().GetName(), res)
+			}
+			if req.IncludeDeviceFingerprint {
+				res.DeviceFingerprint = calibration.Fingerprint(s.counterCalibration, d.Instance())
+			}
+		}
+	}
+	res.FrameBudget = profile.ComputeFrameBudget(res, req.FrameBudget)
+	res.Submissions = profile.ComputeSubmissions(res)
+	res.Recommendations = profile.ComputeRecommendations(res)
+	res.PassTrends = profile.ComputePassTrends(res)
+	res.Tiling = profile.ComputeTiling(res)
+	s.recordProfilingRun(ctx, req, res)
 	return res, nil
 }
 
+// recordProfilingRun adds the summary of the profiling data to the profiling
+// history, if enabled.
+func (s *server) recordProfilingRun(ctx context.Context, req *service.GpuProfileRequest, data *service.ProfilingData) {
+	if s.profileHistory == nil {
+		return
+	}
+	name := ""
+	if c, err := capture.ResolveFromPath(ctx, req.Capture); err == nil {
+		name = c.Name()
+	}
+	var instance *device.Instance
+	if req.Device != nil {
+		if d := bind.GetRegistry(ctx).Device(req.Device.ID.ID()); d != nil {
+			instance = d.Instance()
+		}
+	}
+	if err := s.profileHistory.Add(ctx, history.NewRun(req.Capture, name, instance, data)); err != nil {
+		log.W(ctx, "Failed to record the profiling run: %v", err)
+	}
+}
+
+func (s *server) GetProfilingHistory(ctx context.Context, req *service.GetProfilingHistoryRequest) (*service.ProfilingHistory, error) {
+	ctx = status.Start(ctx, "RPC GetProfilingHistory")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetProfilingHistory")
+
+	serial := ""
+	if req.Device != nil {
+		d := bind.GetRegistry(ctx).Device(req.Device.ID.ID())
+		if d == nil {
+			return nil, &service.ErrDataUnavailable{Reason: messages.ErrUnknownDevice()}
+		}
+		serial = d.Instance().GetSerial()
+	}
+
+	runs := s.profileHistory.Query(func(run *service.ProfilingRun) bool {
+		if req.Capture != nil && !bytes.Equal(run.GetCaptureId().GetData(), req.Capture.GetID().GetData()) {
+			return false
+		}
+		return serial == "" || run.DeviceSerial == serial
+	})
+	return &service.ProfilingHistory{Runs: runs}, nil
+}
+
+func (s *server) GetPresets(ctx context.Context, req *service.GetPresetsRequest) (*service.Presets, error) {
+	ctx = status.Start(ctx, "RPC GetPresets")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetPresets")
+	return s.presets.List(), nil
+}
+
+func (s *server) SavePreset(ctx context.Context, req *service.SavePresetRequest) error {
+	ctx = status.Start(ctx, "RPC SavePreset")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "SavePreset")
+	if req.Preset == nil {
+		return fmt.Errorf("Missing preset")
+	}
+	return s.presets.Save(ctx, req.Preset)
+}
+
+func (s *server) DeletePreset(ctx context.Context, req *service.DeletePresetRequest) error {
+	ctx = status.Start(ctx, "RPC DeletePreset")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "DeletePreset")
+	return s.presets.Delete(ctx, req.Name)
+}
+
+func (s *server) GetTimeMapping(ctx context.Context, req *service.GetTimeMappingRequest) (*service.TimeMapping, error) {
+	ctx = status.Start(ctx, "RPC GetTimeMapping")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetTimeMapping")
+
+	data, err := s.sessionProfile(req.Session, req.Capture)
+	if err != nil {
+		return nil, err
+	}
+	mapping := profile.ComputeTimeMapping(req.Capture, data.Slices)
+	if req.HasTs {
+		mapping.Entries = profile.LookupTime(mapping, req.Ts)
+	}
+	return mapping, nil
+}
+
+func (s *server) GetGroupCounterSamples(ctx context.Context, req *service.GetGroupCounterSamplesRequest) (*service.GroupCounterSamples, error) {
+	ctx = status.Start(ctx, "RPC GetGroupCounterSamples")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetGroupCounterSamples")
+
+	data, err := s.sessionProfile(req.Session, req.Capture)
+	if err != nil {
+		return nil, err
+	}
+	return profile.GroupCounterSamples(data, req.GroupId, req.CounterIds)
+}
+
+// sessionProfile returns the latest profile of the capture kept by the
+// session, without profiling the capture again.
+func (s *server) sessionProfile(session *path.ID, capture *path.Capture) (*service.ProfilingData, error) {
+	if session == nil {
+		return nil, fmt.Errorf("Missing session")
+	}
+	if capture == nil {
+		return nil, fmt.Errorf("Missing capture")
+	}
+	sess, err := s.sessions.Get(session.ID())
+	if err != nil {
+		return nil, err
+	}
+	return sess.LatestProfile(capture.ID.ID())
+}
+
+func (s *server) CreateSession(ctx context.Context, req *service.CreateSessionRequest) (*service.Session, error) {
+	ctx = status.Start(ctx, "RPC CreateSession")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "CreateSession")
+	return s.sessions.Create(req.Quota).Service(), nil
+}
+
+func (s *server) GetSession(ctx context.Context, req *service.GetSessionRequest) (*service.Session, error) {
+	ctx = status.Start(ctx, "RPC GetSession")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "GetSession")
+	sess, err := s.sessions.Get(req.Id.ID())
+	if err != nil {
+		return nil, err
+	}
+	return sess.Service(), nil
+}
+
+func (s *server) CloseSession(ctx context.Context, req *service.CloseSessionRequest) error {
+	ctx = status.Start(ctx, "RPC CloseSession")
+	defer status.Finish(ctx)
+	ctx = log.Enter(ctx, "CloseSession")
+	if err := s.sessions.Close(req.Id.ID()); err != nil {
+		return err
+	}
+	s.releaseFarmDevices(ctx, func(l *farmLease) bool { return l.session == req.Id.ID() })
+	return nil
+}
+
+// keepProfileTrace keeps the Perfetto trace of the last profile of the
+// capture, such that it can be queried through PerfettoQuery. The trace is
+// only imported into a trace processor when it is first queried.
+func (s *server) keepProfileTrace(ctx context.Context, c *path.Capture, data []byte) {
+	s.profileTraces.Store(c.ID.ID(), &profileTrace{
+		name: fmt.Sprintf("%v.perfetto", c.ID.ID()),
+		data: data,
+	})
+}
+
+// profileTrace is the Perfetto trace of the last profile of a graphics
+// capture, imported as a capture on its first query.
+type profileTrace struct {
+	name    string
+	data    []byte
+	once    sync.Once
+	capture *path.Capture
+	err     error
+}
+
+// resolve imports the trace, if not imported yet, and returns its capture.
+func (t *profileTrace) resolve(ctx context.Context) (*capture.PerfettoCapture, error) {
+	t.once.Do(func() {
+		t.capture, t.err = importBundled(ctx, t.name, t.data)
+		t.data = nil
+	})
+	if t.err != nil {
+		return nil, log.Err(ctx, t.err, "Failed to import the Perfetto trace of the profile")
+	}
+	return capture.ResolvePerfettoFromPath(ctx, t.capture)
+}
+
 func (s *server) PerfettoQuery(ctx context.Context, c *path.Capture, query string) (*perfetto.QueryResult, error) {
 	ctx = status.Start(ctx, "RPC PerfettoQuery")
 	defer status.Finish(ctx)
@@ -893,7 +1410,15 @@ func (s *server) PerfettoQuery(ctx context.Context, c *path.Capture, query strin
 	ctx = log.Enter(ctx, "PerfettoQuery")
 	p, err := capture.ResolvePerfettoFromPath(ctx, c)
 	if err != nil {
-		return nil, err
+		// Graphics captures are queried through the Perfetto trace of their
+		// last profile.
+		trace, ok := s.profileTraces.Load(c.ID.ID())
+		if !ok {
+			return nil, log.Err(ctx, err, "The capture is neither a Perfetto trace nor profiled")
+		}
+		if p, err = trace.(*profileTrace).resolve(ctx); err != nil {
+			return nil, err
+		}
 	}
 
 	res, err := p.Processor.Query(query)
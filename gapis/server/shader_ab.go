@@ -0,0 +1,87 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/capture"
+	"github.com/google/gapid/gapis/resolve"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// profileShaderReplacement profiles the capture with the shader of the
+// request replaced, using replayProfile, and compares it to the profile of
+// the original capture.
+func profileShaderReplacement(ctx context.Context, req *service.GpuProfileRequest, original *service.ProfilingData, replayProfile func(*path.Capture) (*service.ProfilingData, error)) (*service.ProfilingData_ShaderAB, error) {
+	ctx = status.Start(ctx, "Shader A/B")
+	defer status.Finish(ctx)
+
+	replaced, err := replaceShader(ctx, req.Capture, req.ShaderReplacement)
+	if err != nil {
+		return nil, err
+	}
+	data, err := replayProfile(replaced)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to profile the capture with the shader replaced")
+	}
+	res := profile.CompareShaderAB(original, data)
+	res.Capture = replaced
+	return res, nil
+}
+
+// replaceShader returns a new capture with the source of the shader replaced
+// after the last command of the capture.
+func replaceShader(ctx context.Context, c *path.Capture, r *service.ShaderReplacement) (*path.Capture, error) {
+	resources, err := resolve.Resources(ctx, c, nil)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Could not find the capture's resources")
+	}
+	shader, err := resources.FindSingle(func(t path.ResourceType, res service.Resource) bool {
+		return t == path.ResourceType_Shader &&
+			(strings.Contains(res.GetHandle(), r.Shader) || strings.Contains(res.GetID().ID().String(), r.Shader))
+	})
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Could not find the shader %v", r.Shader)
+	}
+
+	gc, err := capture.ResolveGraphicsFromPath(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if len(gc.Commands) == 0 {
+		return nil, log.Errf(ctx, nil, "The capture has no commands")
+	}
+	resourcePath := c.Command(uint64(len(gc.Commands) - 1)).ResourceAfter(shader.ID)
+	old, err := resolve.Get(ctx, resourcePath.Path(), nil)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Could not get the data of the shader %v", shader.Handle)
+	}
+	data := api.NewResourceData(&api.Shader{
+		Type:   old.(*api.ResourceData).GetShader().GetType(),
+		Source: r.Source,
+	})
+	replaced, err := resolve.Set(ctx, resourcePath.Path(), data, nil)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Could not replace the shader %v", shader.Handle)
+	}
+	return path.FindCapture(replaced.Node()), nil
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/app/status"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/replay"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/android/profile"
+)
+
+// profileResolutionSweep profiles the capture at each of the resolution
+// scales of the request, and compares the profiles to that of the original
+// replay, at full resolution.
+func profileResolutionSweep(ctx context.Context, req *service.GpuProfileRequest, original *service.ProfilingData) (*service.ProfilingData_ResolutionSweep, error) {
+	ctx = status.Start(ctx, "Resolution Sweep")
+	defer status.Finish(ctx)
+
+	scales := []float32{1}
+	profiles := []*service.ProfilingData{original}
+	for _, scale := range req.ResolutionScales {
+		if scale == 1 {
+			continue
+		} else if scale <= 0 || scale > 1 {
+			return nil, log.Errf(ctx, nil, "Invalid resolution scale %v, expected a scale in (0, 1]", scale)
+		}
+		experiments := sweepExperiments(req)
+		experiments.ResolutionScale = scale
+		data, err := sweepProfile(ctx, req, experiments)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to profile the capture at the resolution scale %v", scale)
+		}
+		scales = append(scales, scale)
+		profiles = append(profiles, data)
+	}
+	return profile.ComputeResolutionSweep(scales, profiles), nil
+}
+
+// profileSamplerSweep profiles the capture with each of the sampler
+// overrides of the request, and compares the profiles to that of the
+// original replay.
+func profileSamplerSweep(ctx context.Context, req *service.GpuProfileRequest, original *service.ProfilingData) (*service.ProfilingData_SamplerSweep, error) {
+	ctx = status.Start(ctx, "Sampler Sweep")
+	defer status.Finish(ctx)
+
+	profiles := make([]*service.ProfilingData, len(req.SamplerSweep))
+	for i, o := range req.SamplerSweep {
+		experiments := sweepExperiments(req)
+		experiments.SamplerOverride = o
+		data, err := sweepProfile(ctx, req, experiments)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to profile the capture with the sampler override %v", o)
+		}
+		profiles[i] = data
+	}
+	return profile.ComputeSamplerSweep(original, req.SamplerSweep, profiles), nil
+}
+
+// fragmentSizes are the fragment sizes of VK_KHR_fragment_shading_rate. The
+// devices supporting the pipeline fragment shading rate support at least
+// 1x1, 1x2, 2x1 and 2x2, and clamp the larger sizes they don't support.
+var fragmentSizes = map[[2]uint32]bool{
+	{1, 1}: true, {1, 2}: true, {2, 1}: true, {2, 2}: true,
+	{2, 4}: true, {4, 2}: true, {4, 4}: true,
+}
+
+// profileShadingRate profiles the capture with the render passes shaded at
+// the coarser rate of the request, and compares the profile to that of the
+// original replay.
+func profileShadingRate(ctx context.Context, req *service.GpuProfileRequest, original *service.ProfilingData) (*service.ProfilingData_ShadingRate, error) {
+	ctx = status.Start(ctx, "Shading Rate")
+	defer status.Finish(ctx)
+
+	r := req.ShadingRate
+	if !fragmentSizes[[2]uint32{r.Width, r.Height}] {
+		return nil, log.Errf(ctx, nil, "Invalid fragment size %dx%d, expected one of "+
+			"1x1, 1x2, 2x1, 2x2, 2x4, 4x2 or 4x4", r.Width, r.Height)
+	}
+	experiments := sweepExperiments(req)
+	experiments.ShadingRate = r
+	data, err := sweepProfile(ctx, req, experiments)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Failed to profile the capture at the %dx%d shading rate", r.Width, r.Height)
+	}
+	res := profile.CompareShadingRate(original, data)
+	res.Override = r
+	return res, nil
+}
+
+// sweepExperiments returns a copy of the experiments of the request, to be
+// changed by a sweep.
+func sweepExperiments(req *service.GpuProfileRequest) *service.ProfileExperiments {
+	if req.Experiments == nil {
+		return &service.ProfileExperiments{}
+	}
+	return proto.Clone(req.Experiments).(*service.ProfileExperiments)
+}
+
+// sweepProfile profiles the capture of the request with the experiments of a
+// sweep. Only the slices and counters are compared, so the replay skips the
+// optional bisection, overhead and validation passes.
+func sweepProfile(ctx context.Context, req *service.GpuProfileRequest, experiments *service.ProfileExperiments) (*service.ProfilingData, error) {
+	return replay.GpuProfile(ctx, req.Capture, req.Device, replay.GpuProfileOptions{
+		Experiments: experiments,
+		Range:       req.Range,
+		LoopCount:   req.LoopCount,
+		Prime:       req.PrimePipelineCaches,
+		AllCounters: req.AllCounters,
+	})
+}
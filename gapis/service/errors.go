@@ -39,3 +39,14 @@ func (e *ErrInternal) Error() string {
 func (e *ErrUnsupportedVersion) Error() string {
 	return fmt.Sprintf("Unsupported version: %v", e.Reason.Text(nil))
 }
+
+func (e *ErrProfiling) Error() string {
+	msg := e.Message
+	if e.Cause != "" {
+		msg = fmt.Sprintf("%v: %v", msg, e.Cause)
+	}
+	if e.Remediation != "" {
+		msg = fmt.Sprintf("%v\n   Hint: %v", msg, e.Remediation)
+	}
+	return fmt.Sprintf("Profiling failed (%v): %v", e.Code, msg)
+}
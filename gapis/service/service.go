@@ -82,6 +82,14 @@ type Service interface {
 	// SaveCapture saves the capture to a local file.
 	SaveCapture(ctx context.Context, c *path.Capture, path string) error
 
+	// LoadBundle loads an .agiz bundle from a local file, importing its
+	// capture and Perfetto trace.
+	LoadBundle(ctx context.Context, path string) (*LoadedBundle, error)
+
+	// SaveBundle saves a capture and its profiling results to a local .agiz
+	// bundle file.
+	SaveBundle(ctx context.Context, req *SaveBundleRequest) error
+
 	// ExportReplay saves replay commands and assets to file.
 	ExportReplay(ctx context.Context, c *path.Capture, d *path.Device, path string, opts *ExportReplayOptions) error
 
@@ -178,7 +186,43 @@ type Service interface {
 	// Get timestamps from GPU for commands.
 	GpuProfile(ctx context.Context, req *GpuProfileRequest) (*ProfilingData, error)
 
-	// Run a perfetto query
+	// GetProfilingHistory returns the previously recorded GPU profiling runs.
+	GetProfilingHistory(ctx context.Context, req *GetProfilingHistoryRequest) (*ProfilingHistory, error)
+
+	// GetPresets returns the capture and profiling presets of the server.
+	GetPresets(ctx context.Context, req *GetPresetsRequest) (*Presets, error)
+
+	// SavePreset stores a capture and profiling preset.
+	SavePreset(ctx context.Context, req *SavePresetRequest) error
+
+	// DeletePreset removes a stored capture and profiling preset.
+	DeletePreset(ctx context.Context, req *DeletePresetRequest) error
+
+	// GetTimeMapping returns the mapping between the commands of a capture and
+	// the times they executed on the GPU, in a session's profile.
+	GetTimeMapping(ctx context.Context, req *GetTimeMappingRequest) (*TimeMapping, error)
+
+	// GetGroupCounterSamples returns the counter samples within the time
+	// range of a slice group of the latest profile of a capture in a session.
+	GetGroupCounterSamples(ctx context.Context, req *GetGroupCounterSamplesRequest) (*GroupCounterSamples, error)
+
+	// CreateSession creates a new profiling session.
+	CreateSession(ctx context.Context, req *CreateSessionRequest) (*Session, error)
+
+	// GetSession returns the latest profiles of the captures of a session.
+	GetSession(ctx context.Context, req *GetSessionRequest) (*Session, error)
+
+	// CloseSession closes a profiling session, releasing its profiles.
+	CloseSession(ctx context.Context, req *CloseSessionRequest) error
+
+	// AcquireFarmDevice leases a device from the device farm of the server.
+	AcquireFarmDevice(ctx context.Context, req *AcquireFarmDeviceRequest) (*FarmDevice, error)
+
+	// ReleaseFarmDevice returns a leased device to the device farm.
+	ReleaseFarmDevice(ctx context.Context, req *ReleaseFarmDeviceRequest) error
+
+	// Run a perfetto query, against the Perfetto trace of the last GpuProfile
+	// for graphics captures.
 	PerfettoQuery(ctx context.Context, c *path.Capture, query string) (*perfetto.QueryResult, error)
 
 	// Split out a new capture containing a subset of another capture's commands.
@@ -230,6 +274,8 @@ func NewError(err error) *Error {
 			return &Error{Err: &Error_ErrPathNotFollowable{err}}
 		case *ErrUnsupportedVersion:
 			return &Error{Err: &Error_ErrUnsupportedVersion{err}}
+		case *ErrProfiling:
+			return &Error{Err: &Error_ErrProfiling{err}}
 		}
 
 		causer, ok := cause.(causer)
@@ -0,0 +1,178 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session implements the profiling sessions of the server. A session
+// holds the latest profile of each capture profiled in it, independently of
+// the other sessions, such that several captures or runs can be compared
+// using a single server, and limits the resources the session may use.
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Manager holds the open sessions of the server.
+type Manager struct {
+	mutex    sync.Mutex
+	sessions map[id.ID]*Session
+}
+
+// NewManager returns a new Manager without any sessions.
+func NewManager() *Manager {
+	return &Manager{sessions: map[id.ID]*Session{}}
+}
+
+// Create opens a new session limited by the given quota, which may be nil.
+func (m *Manager) Create(quota *service.SessionQuota) *Session {
+	if quota == nil {
+		quota = &service.SessionQuota{}
+	}
+	s := &Session{
+		id:       id.Unique(),
+		quota:    quota,
+		profiles: map[id.ID]*service.Session_Profile{},
+	}
+	if quota.MaxConcurrentProfiles > 0 {
+		s.running = make(chan struct{}, quota.MaxConcurrentProfiles)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessions[s.id] = s
+	return s
+}
+
+// Get returns the open session with the given ID.
+func (m *Manager) Get(sessionID id.ID) (*Session, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown session %v", sessionID)
+	}
+	return s, nil
+}
+
+// Close closes the session with the given ID, releasing its profiles.
+func (m *Manager) Close(sessionID id.ID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.sessions[sessionID]; !ok {
+		return fmt.Errorf("Unknown session %v", sessionID)
+	}
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+// Session is a profiling session.
+type Session struct {
+	id    id.ID
+	quota *service.SessionQuota
+	// running limits the number of concurrent profiling runs, nil if
+	// unlimited.
+	running chan struct{}
+
+	mutex    sync.Mutex
+	captures []id.ID // in the order they were added.
+	profiles map[id.ID]*service.Session_Profile
+}
+
+// ID returns the ID of the session.
+func (s *Session) ID() id.ID {
+	return s.id
+}
+
+// Profile calls profile to profile the capture on the device, subject to the
+// quota of the session, and keeps the returned data as the session's latest
+// profile of the capture.
+func (s *Session) Profile(ctx context.Context, capture *path.Capture, device *path.Device, profile func() (*service.ProfilingData, error)) (*service.ProfilingData, error) {
+	if err := s.addCapture(capture.ID.ID()); err != nil {
+		return nil, err
+	}
+
+	if s.running != nil {
+		select {
+		case s.running <- struct{}{}:
+			defer func() { <-s.running }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	data, err := profile()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.profiles[capture.ID.ID()] = &service.Session_Profile{
+		Capture: capture,
+		Device:  device,
+		Data:    data,
+	}
+	return data, nil
+}
+
+// LatestProfile returns the session's latest profile of the capture. It
+// returns an error if the capture has not been profiled in the session.
+func (s *Session) LatestProfile(capture id.ID) (*service.ProfilingData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, ok := s.profiles[capture]
+	if !ok {
+		return nil, fmt.Errorf("Capture %v has not been profiled in session %v", capture, s.id)
+	}
+	return p.Data, nil
+}
+
+// addCapture adds the capture to the session, unless it would exceed the
+// quota of the session.
+func (s *Session) addCapture(capture id.ID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.captures {
+		if c == capture {
+			return nil
+		}
+	}
+	if max := s.quota.MaxCaptures; max > 0 && uint32(len(s.captures)) >= max {
+		return fmt.Errorf("Session %v is limited to %d captures", s.id, max)
+	}
+	s.captures = append(s.captures, capture)
+	return nil
+}
+
+// Service returns the session and its profiles as a service proto.
+func (s *Session) Service() *service.Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := &service.Session{
+		Id:    path.NewID(s.id),
+		Quota: proto.Clone(s.quota).(*service.SessionQuota),
+	}
+	for _, c := range s.captures {
+		if p, ok := s.profiles[c]; ok {
+			res.Profiles = append(res.Profiles, p)
+		}
+	}
+	return res
+}
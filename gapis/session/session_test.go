@@ -0,0 +1,77 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session_test
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/data/id"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/session"
+)
+
+func TestSessions(t *testing.T) {
+	ctx := log.Testing(t)
+
+	m := session.NewManager()
+	a := m.Create(&service.SessionQuota{MaxCaptures: 1})
+	b := m.Create(nil)
+
+	capture := func(b byte) *path.Capture {
+		return &path.Capture{ID: path.NewID(id.ID{b})}
+	}
+	profile := func(frames int) func() (*service.ProfilingData, error) {
+		return func() (*service.ProfilingData, error) {
+			data := &service.ProfilingData{GpuIdle: &service.ProfilingData_GpuIdle{}}
+			for i := 0; i < frames; i++ {
+				data.GpuIdle.Frames = append(data.GpuIdle.Frames, &service.ProfilingData_GpuIdle_Frame{})
+			}
+			return data, nil
+		}
+	}
+
+	_, err := a.Profile(ctx, capture(1), nil, profile(1))
+	assert.For(ctx, "first capture").ThatError(err).Succeeded()
+	_, err = a.Profile(ctx, capture(1), nil, profile(2))
+	assert.For(ctx, "same capture").ThatError(err).Succeeded()
+	_, err = a.Profile(ctx, capture(2), nil, profile(1))
+	assert.For(ctx, "over quota").ThatError(err).Failed()
+	_, err = b.Profile(ctx, capture(2), nil, profile(3))
+	assert.For(ctx, "other session").ThatError(err).Succeeded()
+
+	sa := a.Service()
+	assert.For(ctx, "a profiles").That(len(sa.Profiles)).Equals(1)
+	assert.For(ctx, "a latest").That(len(sa.Profiles[0].Data.GpuIdle.Frames)).Equals(2)
+	sb := b.Service()
+	assert.For(ctx, "b profiles").That(len(sb.Profiles)).Equals(1)
+	assert.For(ctx, "b latest").That(len(sb.Profiles[0].Data.GpuIdle.Frames)).Equals(3)
+
+	latest, err := a.LatestProfile(capture(1).ID.ID())
+	assert.For(ctx, "latest profile").ThatError(err).Succeeded()
+	assert.For(ctx, "latest frames").That(len(latest.GpuIdle.Frames)).Equals(2)
+	_, err = a.LatestProfile(capture(2).ID.ID())
+	assert.For(ctx, "not profiled").ThatError(err).Failed()
+
+	got, err := m.Get(a.ID())
+	assert.For(ctx, "get").ThatError(err).Succeeded()
+	assert.For(ctx, "got").That(got).Equals(a)
+	assert.For(ctx, "close").ThatError(m.Close(a.ID())).Succeeded()
+	_, err = m.Get(a.ID())
+	assert.For(ctx, "closed").ThatError(err).Failed()
+	assert.For(ctx, "close twice").ThatError(m.Close(a.ID())).Failed()
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gfxstream implements the profiling of the Android Emulator and
+// Cuttlefish virtual devices. These devices have no GPU counters or render
+// stages, instead the host-side gfxstream renderer times the decoding and
+// execution of the guest's commands and reports them as Perfetto track
+// events, from which approximate GPU slices are derived.
+package gfxstream
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/os/device"
+
+	perfetto_pb "protos/perfetto/config"
+)
+
+const (
+	trackEventDataSourceDescriptorName = "track_event"
+	// categoryPrefix is the prefix of the track event categories of the
+	// gfxstream host timing hooks.
+	categoryPrefix = "gfxstream"
+)
+
+// emulatorProducts matches the build products of the emulator and Cuttlefish
+// system images, e.g. sdk_gphone64_x86_64 or vsoc_x86_64.
+var emulatorProducts = regexp.MustCompile(`^(sdk_gphone|sdk_phone|emulator|emu64|generic_x86|vsoc_|cf_)`)
+
+// IsEmulator returns whether the device is an Android Emulator or Cuttlefish
+// virtual device rendering through gfxstream.
+func IsEmulator(inst *device.Instance) bool {
+	if strings.HasPrefix(inst.GetSerial(), "emulator-") {
+		return true
+	}
+	conf := inst.GetConfiguration()
+	if emulatorProducts.MatchString(conf.GetHardware().GetName()) {
+		return true
+	}
+	gpu := strings.ToLower(conf.GetHardware().GetGPU().GetName())
+	return strings.Contains(gpu, "gfxstream") || strings.Contains(gpu, "emulator")
+}
+
+// DataSource returns the Perfetto data source collecting the gfxstream host
+// timings. The emulator must be started with its Perfetto producer connected
+// to the guest's tracing service for the timings to be part of the trace.
+func DataSource() *perfetto_pb.TraceConfig_DataSource {
+	return &perfetto_pb.TraceConfig_DataSource{
+		Config: &perfetto_pb.DataSourceConfig{
+			Name: proto.String(trackEventDataSourceDescriptorName),
+			TrackEventConfig: &perfetto_pb.TrackEventConfig{
+				EnabledCategories: []string{categoryPrefix + "*"},
+			},
+		},
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gfxstream
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+	"github.com/google/gapid/gapis/trace/android/validate"
+)
+
+const (
+	// hostSlicesQuery returns the gfxstream host timings in the columns of
+	// the render stage slices. The host doesn't know the guest's handles, so
+	// the handle columns are all zero.
+	hostSlicesQuery = "" +
+		"SELECT 0, 0, 0, 0, 0, 0, 0, s.ts, s.dur, s.id, COALESCE(s.name, ''), s.depth, s.arg_set_id, s.track_id, COALESCE(t.name, ''), COALESCE(s.parent_id, 0) " +
+		"FROM slice s JOIN track t ON s.track_id = t.id " +
+		"WHERE s.category LIKE '" + categoryPrefix + "%' ORDER BY s.ts"
+	// approximateTimings is the known issue reported for all emulator profiles.
+	approximateTimings = "" +
+		"The slices are the host-side gfxstream timings of the guest's submissions, not " +
+		"GPU render stages. They include the host's decoding and driver overhead and only " +
+		"approximate the cost of the submissions on a real device."
+)
+
+var (
+	// submitSliceNames matches the names of the host slices of the decoding
+	// of a guest vkQueueSubmit, each of which starts a new submission.
+	submitSliceNames = regexp.MustCompile(`^(on_)?vkQueueSubmit(2)?(KHR)?\b`)
+	// frameBoundaries are the ways the host slices are assigned to frames, in
+	// order of preference.
+	frameBoundaries = profile.DefaultFrameBoundaries
+)
+
+func init() {
+	// The emulators are matched before the vendor backends, as their GPU may
+	// be named after the host's GPU.
+	profile.RegisterBackend(profile.Backend{
+		Name:     "gfxstream",
+		Priority: 1,
+		Matches:  IsEmulator,
+		NewValidator: func(*device.Instance) validate.Validator {
+			return &Validator{}
+		},
+		ProcessProfilingData: func(ctx context.Context, processor perfetto.Querier, capture *path.Capture, desc *device.GpuCounterDescriptor, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+			return ProcessProfilingData(ctx, processor, capture, syncData)
+		},
+	})
+}
+
+// ProcessProfilingData processes a Perfetto trace of a replay on an emulator.
+// The slices are the host timings of the guest's submissions, and stand in
+// for the GPU time of the submissions. There are no GPU counters.
+func ProcessProfilingData(ctx context.Context, processor perfetto.Querier, capture *path.Capture, syncData *sync.Data) (*service.ProfilingData, error) {
+	errs := profile.SectionErrors{}
+	slices, err := processHostSlices(ctx, processor, capture, syncData)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Slices, err, "Failed to get the gfxstream host slices"); err != nil {
+		return nil, err
+	}
+	data, err := profile.Analyze(ctx, processor, profile.Extraction{Slices: slices, Capture: capture, SyncData: syncData}, errs)
+	if err != nil {
+		return nil, err
+	}
+	data.KnownIssues = append(data.KnownIssues, &service.ProfilingData_KnownIssue{
+		Description: approximateTimings,
+		Sections:    []service.ProfilingData_SectionError_Section{service.ProfilingData_SectionError_Slices},
+	})
+	return data, nil
+}
+
+// processHostSlices extracts the gfxstream host slices and groups them by
+// the guest submission they were decoded from. The submissions are matched
+// to the capture's vkQueueSubmit commands by their order only, as the host
+// slices carry none of the guest's handles.
+func processHostSlices(ctx context.Context, processor perfetto.Querier, capture *path.Capture, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
+	sliceData, err := profile.ExtractSliceDataWithQuery(ctx, processor, hostSlicesQuery)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Extracting gfxstream slice data failed")
+	}
+	if sliceData.Len() == 0 {
+		return nil, profile.Errf(service.ProfilingErrorCode_NoHostTimings, nil, "The trace has no gfxstream host slices")
+	}
+
+	assignSubmissions(sliceData)
+	if err := profile.AssignFrames(ctx, processor, sliceData, frameBoundaries...); err != nil {
+		return nil, err
+	}
+
+	submits := profile.SubmissionCommands(syncData)
+	sliceData.Commands = make([]int64, sliceData.Len())
+	for i, sub := range sliceData.Submissions {
+		sliceData.Commands[i] = -1
+		sliceData.GroupIds[i] = -1
+		if sub < 0 || int(sub) >= len(submits) {
+			continue
+		}
+		cmd := submits[sub]
+		sliceData.Commands[i] = int64(cmd)
+		idx := api.SubCmdIdx{cmd}
+		sliceData.GroupIds[i] = sliceData.CreateOrGetGroup(
+			fmt.Sprintf("vkQueueSubmit %v", cmd),
+			sync.SubCmdRange{From: idx, To: idx},
+		)
+		sliceData.Confidences[i] = service.ProfilingData_GpuSlices_Slice_Fuzzy
+	}
+	if len(submits) > 0 && countSubmissions(sliceData) != len(submits) {
+		log.W(ctx, "Found %d gfxstream submissions for %d submissions in the capture, the slices may be misattributed",
+			countSubmissions(sliceData), len(submits))
+	}
+
+	return sliceData.ToService(ctx, processor, capture), nil
+}
+
+// assignSubmissions sets the submission of each slice to the index of the
+// submit slice it is, or is nested in, or -1 if it is not part of any.
+func assignSubmissions(d *profile.SliceData) {
+	current := map[int64]int64{} // The submission by track.
+	next := int64(0)
+	for i := range d.Submissions {
+		if d.Depths[i] == 0 {
+			if submitSliceNames.MatchString(d.Names[i]) {
+				current[d.Tracks[i]] = next
+				next++
+			} else {
+				current[d.Tracks[i]] = -1
+			}
+		}
+		if sub, ok := current[d.Tracks[i]]; ok {
+			d.Submissions[i] = sub
+		} else {
+			d.Submissions[i] = -1
+		}
+	}
+}
+
+// countSubmissions returns the number of submissions found by
+// assignSubmissions.
+func countSubmissions(d *profile.SliceData) int {
+	count := int64(0)
+	for _, sub := range d.Submissions {
+		if sub >= count {
+			count = sub + 1
+		}
+	}
+	return int(count)
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gfxstream
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/android/profile"
+	"github.com/google/gapid/gapis/trace/android/validate"
+)
+
+const hostSliceCountQuery = "" +
+	"SELECT COUNT(*) FROM slice WHERE category LIKE '" + categoryPrefix + "%'"
+
+// Validator validates that the emulator reports the gfxstream host timings.
+type Validator struct {
+}
+
+func (v *Validator) Validate(ctx context.Context, processor *perfetto.Processor) error {
+	res, err := processor.Query(hostSliceCountQuery)
+	if err != nil {
+		return log.Errf(ctx, err, "Failed to query with %v", hostSliceCountQuery)
+	}
+	if counts := res.GetColumns()[0].GetLongValues(); len(counts) != 1 || counts[0] == 0 {
+		return profile.Errf(service.ProfilingErrorCode_NoHostTimings, nil, "The trace has no gfxstream host slices")
+	}
+	return nil
+}
+
+// GetCounters returns no counters, as the emulators have none.
+func (v *Validator) GetCounters() []validate.GpuCounter {
+	return nil
+}
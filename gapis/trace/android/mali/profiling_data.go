@@ -25,69 +25,65 @@ import (
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/trace/android/profile"
+	"github.com/google/gapid/gapis/trace/android/validate"
 )
 
-var (
-	queueSubmitQuery = "" +
-		"SELECT submission_id, command_buffer FROM gpu_slice s JOIN track t ON s.track_id = t.id WHERE s.name = 'vkQueueSubmit' AND t.name = 'Vulkan Events' ORDER BY submission_id"
-	counterTracksQuery = "" +
-		"SELECT id, name, unit, description FROM gpu_counter_track ORDER BY id"
-	countersQueryFmt = "" +
-		"SELECT ts, value FROM counter c WHERE c.track_id = %d ORDER BY ts"
-)
+// frameBoundaries are the ways the GPU slices are assigned to frames, in order
+// of preference.
+var frameBoundaries = profile.DefaultFrameBoundaries
+
+func init() {
+	profile.RegisterBackend(profile.Backend{
+		Name:    "Mali",
+		Matches: profile.MatchGpuName("Mali"),
+		NewValidator: func(inst *device.Instance) validate.Validator {
+			return NewMaliValidator(inst.GetConfiguration().GetHardware().GetGPU().GetName())
+		},
+		ProcessProfilingData: ProcessProfilingData,
+	})
+}
 
-func ProcessProfilingData(ctx context.Context, processor *perfetto.Processor, capture *path.Capture, desc *device.GpuCounterDescriptor, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+func ProcessProfilingData(ctx context.Context, processor perfetto.Querier, capture *path.Capture, desc *device.GpuCounterDescriptor, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+	errs := profile.SectionErrors{}
 	slices, err := processGpuSlices(ctx, processor, capture, handleMapping, syncData)
-	if err != nil {
-		log.Err(ctx, err, "Failed to get GPU slices")
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Slices, err, "Failed to get GPU slices"); err != nil {
+		return nil, err
 	}
-	counters, err := processCounters(ctx, processor, desc)
-	if err != nil {
-		log.Err(ctx, err, "Failed to get GPU counters")
-	}
-	gpuCounters, err := profile.ComputeCounters(ctx, slices, counters)
-	if err != nil {
-		log.Err(ctx, err, "Failed to calculate performance data based on GPU slices and counters")
+	counters, conflicts, err := profile.ProcessCounters(ctx, processor, desc)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Counters, err, "Failed to get GPU counters"); err != nil {
+		return nil, err
 	}
-
-	return &service.ProfilingData{
-		Slices:      slices,
-		Counters:    counters,
-		GpuCounters: gpuCounters,
-	}, nil
+	return profile.Analyze(ctx, processor, profile.Extraction{
+		Slices:        slices,
+		Counters:      counters,
+		Desc:          desc,
+		SpecConflicts: conflicts,
+		Capture:       capture,
+		SyncData:      syncData,
+	}, errs)
 }
 
-func processGpuSlices(ctx context.Context, processor *perfetto.Processor, capture *path.Capture, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
+func processGpuSlices(ctx context.Context, processor perfetto.Querier, capture *path.Capture, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
 	sliceData, err := profile.ExtractSliceData(ctx, processor)
 	if err != nil {
 		return nil, log.Errf(ctx, err, "Extracting slice data failed")
 	}
 
-	queueSubmitQueryResult, err := processor.Query(queueSubmitQuery)
+	submissionOrdering, err := profile.ProcessSubmissionOrdering(ctx, processor, true)
 	if err != nil {
-		return nil, log.Errf(ctx, err, "SQL query failed: %v", queueSubmitQuery)
-	}
-	queueSubmitColumns := queueSubmitQueryResult.GetColumns()
-	queueSubmitIds := queueSubmitColumns[0].GetLongValues()
-	queueSubmitCommandBuffers := queueSubmitColumns[1].GetLongValues()
-	submissionOrdering := make(map[int64]int)
-
-	order := 0
-	for i, v := range queueSubmitIds {
-		if queueSubmitCommandBuffers[i] == 0 {
-			// This is a spurious submission. See b/150854367
-			log.W(ctx, "Spurious vkQueueSubmit slice with submission id %v", v)
-			continue
-		}
-		submissionOrdering[v] = order
-		order++
+		return nil, err
 	}
 
+	sliceData.AssignCommands(submissionOrdering, syncData)
 	sliceData.MapIdentifiers(ctx, handleMapping)
+	if err := profile.AssignFrames(ctx, processor, sliceData, frameBoundaries...); err != nil {
+		return nil, err
+	}
 
 	groupId := int32(-1)
+	confidence := service.ProfilingData_GpuSlices_Slice_Unmatched
 	for i, v := range sliceData.Submissions {
-		subOrder, ok := submissionOrdering[v]
+		subOrder, ok := submissionOrdering.Lookup(v, sliceData.Timestamps[i])
 		if ok {
 			cb := uint64(sliceData.CommandBuffers[i])
 			key := sync.RenderPassKey{
@@ -95,13 +91,14 @@ func processGpuSlices(ctx context.Context, processor *perfetto.Processor, captur
 			}
 			// Create a new group for each main renderPass slice.
 			name := sliceData.Names[i]
-			indices := syncData.RenderPassLookup.Lookup(ctx, key)
+			indices, match := syncData.RenderPassLookup.LookupMatch(ctx, key)
 			if !indices.IsNil() && (name == "vertex" || name == "fragment") {
 				sliceData.Names[i] = fmt.Sprintf("%v-%v %v", indices.From, indices.To, name)
 				groupId = sliceData.CreateOrGetGroup(
-					fmt.Sprintf("RenderPass %v, RenderTarget %v", uint64(sliceData.RenderPasses[i]), uint64(sliceData.RenderTargets[i])),
+					profile.RenderPassGroupName(syncData, uint64(sliceData.RenderPasses[i]), uint64(sliceData.RenderTargets[i]), indices),
 					indices,
 				)
+				confidence = profile.MatchConfidence(match)
 			}
 		} else {
 			log.W(ctx, "Encountered submission ID mismatch %v", v)
@@ -112,58 +109,9 @@ func processGpuSlices(ctx context.Context, processor *perfetto.Processor, captur
 				sliceData.Names[i], sliceData.Submissions[i], sliceData.CommandBuffers[i], sliceData.RenderPasses[i], sliceData.RenderTargets[i])
 		}
 		sliceData.GroupIds[i] = groupId
+		sliceData.Confidences[i] = confidence
 	}
+	sliceData.AttributeByLabels()
 
 	return sliceData.ToService(ctx, processor, capture), nil
 }
-
-func processCounters(ctx context.Context, processor *perfetto.Processor, desc *device.GpuCounterDescriptor) ([]*service.ProfilingData_Counter, error) {
-	counterTracksQueryResult, err := processor.Query(counterTracksQuery)
-	if err != nil {
-		return nil, log.Errf(ctx, err, "SQL query failed: %v", counterTracksQuery)
-	}
-	// t.id, name, unit, description, ts, value
-	tracksColumns := counterTracksQueryResult.GetColumns()
-	numTracksRows := counterTracksQueryResult.GetNumRecords()
-	counters := make([]*service.ProfilingData_Counter, numTracksRows)
-	// Grab all the column values. Depends on the order of columns selected in countersQuery
-	trackIds := tracksColumns[0].GetLongValues()
-	names := tracksColumns[1].GetStringValues()
-	units := tracksColumns[2].GetStringValues()
-	descriptions := tracksColumns[3].GetStringValues()
-
-	nameToSpec := map[string]*device.GpuCounterDescriptor_GpuCounterSpec{}
-	if desc != nil {
-		for _, spec := range desc.Specs {
-			nameToSpec[spec.Name] = spec
-		}
-	}
-
-	for i := uint64(0); i < numTracksRows; i++ {
-		countersQuery := fmt.Sprintf(countersQueryFmt, trackIds[i])
-		countersQueryResult, err := processor.Query(countersQuery)
-		countersColumns := countersQueryResult.GetColumns()
-		if err != nil {
-			return nil, log.Errf(ctx, err, "SQL query failed: %v", counterTracksQuery)
-		}
-		timestampsLong := countersColumns[0].GetLongValues()
-		timestamps := make([]uint64, len(timestampsLong))
-		for i, t := range timestampsLong {
-			timestamps[i] = uint64(t)
-		}
-		values := countersColumns[1].GetDoubleValues()
-
-		spec, _ := nameToSpec[names[i]]
-		// TODO(apbodnar) Populate the `default` field once the trace processor supports it (b/147432390)
-		counters[i] = &service.ProfilingData_Counter{
-			Id:          uint32(trackIds[i]),
-			Name:        names[i],
-			Unit:        units[i],
-			Description: descriptions[i],
-			Spec:        spec,
-			Timestamps:  timestamps,
-			Values:      values,
-		}
-	}
-	return counters, nil
-}
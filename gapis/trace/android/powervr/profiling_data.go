@@ -0,0 +1,137 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package powervr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/profile"
+	"github.com/google/gapid/gapis/trace/android/validate"
+)
+
+var (
+	// renderPassStages maps the names of the render stages of the PowerVR
+	// render passes to the work they do: the tile accelerator (TA) processes
+	// the geometry, and the 3D stage renders the fragments of the tiles.
+	renderPassStages = map[string]renderPassStage{
+		"TA":       {"geometry", service.ProfilingData_GpuSlices_Slice_Vertex},
+		"Geometry": {"geometry", service.ProfilingData_GpuSlices_Slice_Vertex},
+		"3D":       {"fragment", service.ProfilingData_GpuSlices_Slice_Fragment},
+		"Fragment": {"fragment", service.ProfilingData_GpuSlices_Slice_Fragment},
+	}
+	// frameBoundaries are the ways the GPU slices are assigned to frames, in
+	// order of preference.
+	frameBoundaries = profile.DefaultFrameBoundaries
+)
+
+type renderPassStage struct {
+	name     string
+	category service.ProfilingData_GpuSlices_Slice_Category
+}
+
+func init() {
+	profile.RegisterBackend(profile.Backend{
+		Name:    "PowerVR",
+		Matches: profile.MatchGpuName("PowerVR"),
+		NewValidator: func(inst *device.Instance) validate.Validator {
+			return NewPowerVRValidator(inst.GetConfiguration().GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor())
+		},
+		ProcessProfilingData: ProcessProfilingData,
+	})
+}
+
+func ProcessProfilingData(ctx context.Context, processor perfetto.Querier, capture *path.Capture, desc *device.GpuCounterDescriptor, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData, error) {
+	errs := profile.SectionErrors{}
+	slices, err := processGpuSlices(ctx, processor, capture, handleMapping, syncData)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Slices, err, "Failed to get GPU slices"); err != nil {
+		return nil, err
+	}
+	counters, conflicts, err := profile.ProcessCounters(ctx, processor, desc)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Counters, err, "Failed to get GPU counters"); err != nil {
+		return nil, err
+	}
+	return profile.Analyze(ctx, processor, profile.Extraction{
+		Slices:        slices,
+		Counters:      counters,
+		Desc:          desc,
+		SpecConflicts: conflicts,
+		Capture:       capture,
+		SyncData:      syncData,
+	}, errs)
+}
+
+func processGpuSlices(ctx context.Context, processor perfetto.Querier, capture *path.Capture, handleMapping map[uint64][]service.VulkanHandleMappingItem, syncData *sync.Data) (*service.ProfilingData_GpuSlices, error) {
+	sliceData, err := profile.ExtractSliceData(ctx, processor)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Extracting slice data failed")
+	}
+
+	submissionOrdering, err := profile.ProcessSubmissionOrdering(ctx, processor, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceData.AssignCommands(submissionOrdering, syncData)
+	sliceData.MapIdentifiers(ctx, handleMapping)
+	if err := profile.AssignFrames(ctx, processor, sliceData, frameBoundaries...); err != nil {
+		return nil, err
+	}
+
+	groupId := int32(-1)
+	confidence := service.ProfilingData_GpuSlices_Slice_Unmatched
+	for i, v := range sliceData.Submissions {
+		stage, isRenderPass := renderPassStages[sliceData.Names[i]]
+		if isRenderPass {
+			// The stage names are too short to be categorized by keyword.
+			sliceData.Categories[i] = stage.category
+		}
+		subOrder, ok := submissionOrdering.Lookup(v, sliceData.Timestamps[i])
+		if ok {
+			cb := uint64(sliceData.CommandBuffers[i])
+			key := sync.RenderPassKey{
+				subOrder, cb, uint64(sliceData.RenderPasses[i]), uint64(sliceData.RenderTargets[i]),
+			}
+			// Create a new group for each TA and 3D slice of a render pass.
+			indices, match := syncData.RenderPassLookup.LookupMatch(ctx, key)
+			if !indices.IsNil() && isRenderPass {
+				sliceData.Names[i] = fmt.Sprintf("%v-%v %v", indices.From, indices.To, stage.name)
+				groupId = sliceData.CreateOrGetGroup(
+					profile.RenderPassGroupName(syncData, uint64(sliceData.RenderPasses[i]), uint64(sliceData.RenderTargets[i]), indices),
+					indices,
+				)
+				confidence = profile.MatchConfidence(match)
+			}
+		} else {
+			log.W(ctx, "Encountered submission ID mismatch %v", v)
+		}
+
+		if groupId < 0 {
+			log.W(ctx, "Group missing for slice %v at submission %v, commandBuffer %v, renderPass %v, renderTarget %v",
+				sliceData.Names[i], sliceData.Submissions[i], sliceData.CommandBuffers[i], sliceData.RenderPasses[i], sliceData.RenderTargets[i])
+		}
+		sliceData.GroupIds[i] = groupId
+		sliceData.Confidences[i] = confidence
+	}
+	sliceData.AttributeByLabels()
+
+	return sliceData.ToService(ctx, processor, capture), nil
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package powervr
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/trace/android/validate"
+)
+
+// validatedCounters matches the names of the counters that are validated.
+// The IDs of the PowerVR counters differ between GPU generations, so the
+// counters are looked up in the counter descriptor of the device.
+var validatedCounters = regexp.MustCompile(`(?i)^(gpu|renderer|tiler|geometry|3d) (active|utili[sz]ation)`)
+
+func counterChecker() validate.Checker {
+	return validate.And(validate.IsNumber, validate.CheckNonNegative(), validate.Not(validate.CheckAllEqualTo(0)))
+}
+
+type PowerVRValidator struct {
+	counters []validate.GpuCounter
+}
+
+func NewPowerVRValidator(desc *device.GpuCounterDescriptor) *PowerVRValidator {
+	counters := []validate.GpuCounter{}
+	for _, spec := range desc.GetSpecs() {
+		if validatedCounters.MatchString(spec.GetName()) {
+			counters = append(counters, validate.GpuCounter{Id: spec.GetCounterId(), Name: spec.GetName(), Check: counterChecker()})
+		}
+	}
+	return &PowerVRValidator{counters}
+}
+
+func (v *PowerVRValidator) Validate(ctx context.Context, processor *perfetto.Processor) error {
+	if err := validate.ValidateGpuCounters(ctx, processor, v.GetCounters()); err != nil {
+		return err
+	}
+	if err := validate.ValidateGpuSlices(ctx, processor); err != nil {
+		return err
+	}
+	if err := validate.ValidateVulkanEvents(ctx, processor); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (v *PowerVRValidator) GetCounters() []validate.GpuCounter {
+	return v.counters
+}
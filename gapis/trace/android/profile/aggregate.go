@@ -0,0 +1,92 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// AggregateSlices groups the GPU slices by label and category, across all
+// frames, and returns the statistics of the durations of each group, by
+// decreasing total duration. The durations are inclusive of nested slices,
+// the self totals exclusive. The slices ignored by the patterns attached to
+// the context by PutIgnoredSlices are excluded.
+func AggregateSlices(ctx context.Context, slices *service.ProfilingData_GpuSlices, gpuIdle *service.ProfilingData_GpuIdle) []*service.ProfilingData_SliceAggregate {
+	ignored := GetIgnoredSlices(ctx)
+	type key struct {
+		label    string
+		category service.ProfilingData_GpuSlices_Slice_Category
+	}
+	durs := map[key][]uint64{}
+	selfTotals := map[key]uint64{}
+	frames := map[key]map[int]bool{}
+	keys := []key{}
+	for _, s := range slices.GetSlices() {
+		if isIgnoredSlice(s, ignored) {
+			continue
+		}
+		k := key{s.Label, s.Category}
+		if _, ok := durs[k]; !ok {
+			keys = append(keys, k)
+			frames[k] = map[int]bool{}
+		}
+		durs[k] = append(durs[k], s.Dur)
+		selfTotals[k] += s.SelfDur
+		if f := frameOf(gpuIdle, s.Ts); f >= 0 {
+			frames[k][f] = true
+		}
+	}
+
+	res := make([]*service.ProfilingData_SliceAggregate, 0, len(keys))
+	for _, k := range keys {
+		d := durs[k]
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		agg := &service.ProfilingData_SliceAggregate{
+			Label:     k.label,
+			Category:  k.category,
+			Count:     uint32(len(d)),
+			Frames:    uint32(len(frames[k])),
+			P95:       d[int(math.Ceil(0.95*float64(len(d))))-1],
+			SelfTotal: selfTotals[k],
+		}
+		for _, v := range d {
+			agg.Total += v
+		}
+		agg.Mean = float64(agg.Total) / float64(len(d))
+		variance := 0.0
+		for _, v := range d {
+			variance += (float64(v) - agg.Mean) * (float64(v) - agg.Mean)
+		}
+		agg.StdDev = math.Sqrt(variance / float64(len(d)))
+		res = append(res, agg)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Total > res[j].Total })
+	return res
+}
+
+// frameOf returns the index of the frame containing the timestamp, or -1 if
+// none does. The frames are sorted by time.
+func frameOf(gpuIdle *service.ProfilingData_GpuIdle, ts uint64) int {
+	frames := gpuIdle.GetFrames()
+	i := sort.Search(len(frames), func(i int) bool { return frames[i].Ts+frames[i].Dur > ts })
+	if i < len(frames) && frames[i].Ts <= ts {
+		return i
+	}
+	return -1
+}
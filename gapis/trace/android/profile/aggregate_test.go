@@ -0,0 +1,86 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestAggregateSlices(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 0, Dur: 10, Label: "Shadows", Category: service.ProfilingData_GpuSlices_Slice_Vertex},
+			{Ts: 20, Dur: 40, Label: "Main", Category: service.ProfilingData_GpuSlices_Slice_Fragment},
+			{Ts: 100, Dur: 30, Label: "Shadows", Category: service.ProfilingData_GpuSlices_Slice_Vertex},
+			{Ts: 140, Dur: 50, Label: "Main", Category: service.ProfilingData_GpuSlices_Slice_Fragment},
+			// Same label, different category.
+			{Ts: 150, Dur: 5, Label: "Shadows", Category: service.ProfilingData_GpuSlices_Slice_Fragment},
+		},
+	}
+	idle := &service.ProfilingData_GpuIdle{
+		Frames: []*service.ProfilingData_GpuIdle_Frame{
+			{Ts: 0, Dur: 100},
+			{Ts: 100, Dur: 100},
+		},
+	}
+
+	res := AggregateSlices(ctx, slices, idle)
+	assert.For(ctx, "aggregates").That(len(res)).Equals(3)
+
+	main := res[0]
+	assert.For(ctx, "main label").That(main.Label).Equals("Main")
+	assert.For(ctx, "main count").That(main.Count).Equals(uint32(2))
+	assert.For(ctx, "main frames").That(main.Frames).Equals(uint32(2))
+	assert.For(ctx, "main total").That(main.Total).Equals(uint64(90))
+	assert.For(ctx, "main mean").That(main.Mean).Equals(45.0)
+	assert.For(ctx, "main stddev").That(main.StdDev).Equals(5.0)
+	assert.For(ctx, "main p95").That(main.P95).Equals(uint64(50))
+
+	shadows := res[1]
+	assert.For(ctx, "shadows label").That(shadows.Label).Equals("Shadows")
+	assert.For(ctx, "shadows category").That(shadows.Category).Equals(service.ProfilingData_GpuSlices_Slice_Vertex)
+	assert.For(ctx, "shadows total").That(shadows.Total).Equals(uint64(40))
+	assert.For(ctx, "other category").That(res[2].Total).Equals(uint64(5))
+}
+
+func TestAggregateIgnoredSlices(t *testing.T) {
+	ctx := log.Testing(t)
+
+	_, err := CompileSlicePatterns([]string{"("})
+	assert.For(ctx, "invalid pattern").ThatError(err).Failed()
+	patterns, err := CompileSlicePatterns([]string{"^Driver", "housekeeping"})
+	if !assert.For(ctx, "patterns").ThatError(err).Succeeded() {
+		return
+	}
+	ctx = PutIgnoredSlices(ctx, patterns)
+
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 0, Dur: 10, Name: "Driver flush", Label: "Driver flush"},
+			{Ts: 20, Dur: 40, Name: "Surface", Label: "Main"},
+			{Ts: 60, Dur: 5, Name: "Surface", Label: "cache housekeeping"},
+		},
+	}
+	res := AggregateSlices(ctx, slices, &service.ProfilingData_GpuIdle{})
+	if assert.For(ctx, "aggregates").That(len(res)).Equals(1) {
+		assert.For(ctx, "label").That(res[0].Label).Equals("Main")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// Extraction is the data a GPU vendor backend extracts from a trace, which
+// the analyses shared by all backends are computed from.
+type Extraction struct {
+	Slices   *service.ProfilingData_GpuSlices
+	Counters []*service.ProfilingData_Counter
+	// The counter descriptor of the device, nil if unknown, and the
+	// conflicts between its specs found by ProcessCounters.
+	Desc          *device.GpuCounterDescriptor
+	SpecConflicts []*service.ProfilingData_CounterSpecConflict
+	// The capture the slices were attributed to and its sync data, nil for
+	// traces without a capture.
+	Capture  *path.Capture
+	SyncData *sync.Data
+}
+
+// Analyze computes the profiling data of the extracted slices and counters.
+// The errors of the extraction are those of the sections the backend
+// extracted, to which the errors of the analyses are added. Returns an error
+// only if the error policy of the context stops at the first failed section.
+func Analyze(ctx context.Context, processor perfetto.Querier, x Extraction, errs SectionErrors) (*service.ProfilingData, error) {
+	slices, counters := x.Slices, x.Counters
+	gpuCounters, err := ComputeCounters(ctx, slices, counters)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_GpuCounters, err, "Failed to calculate performance data based on GPU slices and counters"); err != nil {
+		return nil, err
+	}
+	markers, err := ProcessMarkers(ctx, processor, slices)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Markers, err, "Failed to get the application markers"); err != nil {
+		return nil, err
+	}
+	gpuIdle, err := ComputeGpuIdle(ctx, processor, slices)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_GpuIdle, err, "Failed to calculate the GPU idle time"); err != nil {
+		return nil, err
+	}
+	lifecycle, err := ComputeFrameLifecycle(ctx, processor, slices)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_FrameLifecycle, err, "Failed to calculate the frame lifecycle"); err != nil {
+		return nil, err
+	}
+	err = ComputeCompositionLatency(ctx, processor, lifecycle)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_CompositionLatency, err, "Failed to calculate the composition latency"); err != nil {
+		return nil, err
+	}
+	perFrame, err := ComputeFrameCounters(ctx, processor, counters)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_FrameCounters, err, "Failed to calculate the counters of the frames"); err != nil {
+		return nil, err
+	}
+	swapchains, err := ComputeSwapchainTimeline(ctx, processor)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_SwapchainTimeline, err, "Failed to calculate the swapchain timeline"); err != nil {
+		return nil, err
+	}
+	err = ComputePreemptions(ctx, processor, gpuIdle)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Preemptions, err, "Failed to attribute the GPU preemptions"); err != nil {
+		return nil, err
+	}
+	err = ComputeThreadUsage(ctx, processor, gpuIdle)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Threads, err, "Failed to calculate the CPU usage of the threads"); err != nil {
+		return nil, err
+	}
+	traceStart, err := QueryTraceStart(ctx, processor)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_TraceStart, err, "Failed to get the start of the trace"); err != nil {
+		return nil, err
+	}
+	err = CheckClockSync(ctx, processor)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_ClockSync, err, "The GPU slices may be misaligned"); err != nil {
+		return nil, err
+	}
+
+	return &service.ProfilingData{
+		Slices:               slices,
+		Counters:             counters,
+		GpuCounters:          gpuCounters,
+		Markers:              markers,
+		GpuIdle:              gpuIdle,
+		RepresentativeFrames: SelectFrames(gpuIdle),
+		Engine:               ProcessEngine(markers, slices, gpuCounters),
+		CounterSpecConflicts: x.SpecConflicts,
+		CounterBlocks:        CounterBlocks(x.Desc, counters),
+		SliceAggregates:      AggregateSlices(ctx, slices, gpuIdle),
+		FrameLifecycle:       lifecycle,
+		SwapchainTimeline:    swapchains,
+		FrameCounters:        perFrame,
+		DrawDurations:        ComputeDrawDurations(slices, nil),
+		Utilization:          ComputeUtilization(slices, gpuIdle),
+		TraceStart:           traceStart,
+		GpuCount:             CountGpus(slices, counters),
+		SliceIntegrity:       CheckSliceIntegrity(slices, x.Capture, x.SyncData),
+		Errors:               errs,
+	}, nil
+}
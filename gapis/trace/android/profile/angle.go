@@ -0,0 +1,110 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+)
+
+// maxAngleCallsInName is the maximum number of distinct GL calls listed in
+// the name of a render pass group.
+const maxAngleCallsInName = 3
+
+// RenderPassGroupName returns the name of the slice group of a render pass
+// executing the commands in the given range.
+//
+// For applications running on top of ANGLE, the Vulkan render passes don't
+// correspond to anything the application did, so the default name, based on
+// the Vulkan handles, is meaningless. ANGLE labels the Vulkan commands it
+// records with the GL calls they implement, as well as with the debug groups
+// pushed by the application. If such labels are found around or inside the
+// render pass, they are used to name the group instead.
+func RenderPassGroupName(syncData *sync.Data, renderPass, renderTarget uint64, idx sync.SubCmdRange) string {
+	name := fmt.Sprintf("RenderPass %v, RenderTarget %v", renderPass, renderTarget)
+	if syncData == nil || idx.IsNil() || len(idx.From) == 0 || len(idx.From) != len(idx.To) {
+		return name
+	}
+
+	parent := idx.From[:len(idx.From)-1]
+	groups, _ := syncData.SubCommandMarkerGroups.Value(parent).([]*api.CmdIDGroup)
+	start, end := api.CmdID(idx.From[len(idx.From)-1]), api.CmdID(idx.To[len(idx.To)-1])
+
+	enclosing := []*api.CmdIDGroup{}
+	calls := []string{}
+	seen := map[string]bool{}
+	angle := false
+	for _, group := range groups {
+		switch {
+		case group.Range.Start <= start && end < group.Range.End:
+			if isStructuralMarker(group.Name) {
+				continue
+			}
+			enclosing = append(enclosing, group)
+			angle = angle || isAngleCall(group.Name)
+		case start <= group.Range.Start && group.Range.End <= end+1:
+			if isAngleCall(group.Name) {
+				angle = true
+				if !seen[group.Name] {
+					seen[group.Name] = true
+					calls = append(calls, group.Name)
+				}
+			}
+		}
+	}
+	if !angle {
+		return name
+	}
+
+	// Outermost group first.
+	sort.SliceStable(enclosing, func(i, j int) bool {
+		return enclosing[i].Range.End-enclosing[i].Range.Start > enclosing[j].Range.End-enclosing[j].Range.Start
+	})
+	labels := make([]string, len(enclosing))
+	for i, group := range enclosing {
+		labels[i] = group.Name
+	}
+	label := strings.Join(labels, " / ")
+	if len(calls) > 0 {
+		if len(calls) > maxAngleCallsInName {
+			calls = append(calls[:maxAngleCallsInName], "...")
+		}
+		if label != "" {
+			label += ": "
+		}
+		label += strings.Join(calls, ", ")
+	}
+	return fmt.Sprintf("%v (%v)", label, name)
+}
+
+// isAngleCall returns whether the marker label is one of the GL entry point
+// labels inserted by ANGLE, e.g. "glDrawElements".
+func isAngleCall(label string) bool {
+	return len(label) > 2 && strings.HasPrefix(label, "gl") && unicode.IsUpper(rune(label[2]))
+}
+
+// isStructuralMarker returns whether the marker group was created by the
+// command tree for the Vulkan structure of the commands, rather than from a
+// debug label.
+func isStructuralMarker(label string) bool {
+	return label == "State Setting Group" ||
+		strings.HasPrefix(label, "RenderPass: ") ||
+		strings.HasPrefix(label, "Subpass: ")
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/gapid/core/os/device"
+	api_sync "github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/android/validate"
+)
+
+// Matcher returns whether a backend supports profiling the device.
+type Matcher func(inst *device.Instance) bool
+
+// Backend is a GPU vendor profiling backend, turning the Perfetto trace of
+// the devices it matches into the profiling data.
+type Backend struct {
+	// Name is the name of the backend, used in the logs.
+	Name string
+	// Priority orders the matching of the backends, the ones with a higher
+	// priority are tried first, e.g. the emulators before the GPU names that
+	// their host GPU may also match.
+	Priority int
+	// Matches returns whether the backend supports the device.
+	Matches Matcher
+	// NewValidator returns the validator of the device's trace.
+	NewValidator func(inst *device.Instance) validate.Validator
+	// ProcessProfilingData returns the profiling data of the trace.
+	ProcessProfilingData func(ctx context.Context, processor perfetto.Querier,
+		capture *path.Capture, desc *device.GpuCounterDescriptor,
+		handleMapping map[uint64][]service.VulkanHandleMappingItem,
+		syncData *api_sync.Data) (*service.ProfilingData, error)
+}
+
+var backends struct {
+	sync.Mutex
+	list []Backend
+}
+
+// RegisterBackend adds the backend to the ones matched against the devices.
+// Backends register themselves from the init of their package. Backends of
+// the same priority are matched in their registration order.
+func RegisterBackend(b Backend) {
+	if b.Matches == nil || b.ProcessProfilingData == nil {
+		panic("Backend " + b.Name + " has no matcher or no ProcessProfilingData")
+	}
+	backends.Lock()
+	defer backends.Unlock()
+	backends.list = append(backends.list, b)
+	sort.SliceStable(backends.list, func(i, j int) bool {
+		return backends.list[i].Priority > backends.list[j].Priority
+	})
+}
+
+// FindBackend returns the registered backend supporting the device, if any.
+func FindBackend(inst *device.Instance) (Backend, bool) {
+	backends.Lock()
+	defer backends.Unlock()
+	for _, b := range backends.list {
+		if b.Matches(inst) {
+			return b, true
+		}
+	}
+	return Backend{}, false
+}
+
+// MatchGpuName returns a matcher of the devices whose GPU name contains any
+// of the names, e.g. "Mali" for both "Mali-G78" and "Mali-G710".
+func MatchGpuName(names ...string) Matcher {
+	return func(inst *device.Instance) bool {
+		gpu := inst.GetConfiguration().GetHardware().GetGPU().GetName()
+		for _, name := range names {
+			if strings.Contains(gpu, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchGpuVendor returns a matcher of the devices whose GPU vendor is any of
+// the vendors, ignoring the case.
+func MatchGpuVendor(vendors ...string) Matcher {
+	return func(inst *device.Instance) bool {
+		vendor := inst.GetConfiguration().GetHardware().GetGPU().GetVendor()
+		for _, v := range vendors {
+			if vendor != "" && strings.EqualFold(vendor, v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchAny returns a matcher of the devices matched by any of the matchers.
+func MatchAny(matchers ...Matcher) Matcher {
+	return func(inst *device.Instance) bool {
+		for _, m := range matchers {
+			if m(inst) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func gpuInstance(name, vendor string) *device.Instance {
+	return &device.Instance{
+		Configuration: &device.Configuration{
+			Hardware: &device.Hardware{GPU: &device.GPU{Name: name, Vendor: vendor}},
+		},
+	}
+}
+
+func testBackend(name string, priority int, matches Matcher) Backend {
+	return Backend{
+		Name:     name,
+		Priority: priority,
+		Matches:  matches,
+		ProcessProfilingData: func(context.Context, perfetto.Querier, *path.Capture, *device.GpuCounterDescriptor, map[uint64][]service.VulkanHandleMappingItem, *sync.Data) (*service.ProfilingData, error) {
+			return &service.ProfilingData{}, nil
+		},
+	}
+}
+
+func TestFindBackend(t *testing.T) {
+	ctx := log.Testing(t)
+
+	registered := backends.list
+	defer func() { backends.list = registered }()
+	backends.list = nil
+
+	RegisterBackend(testBackend("Mali", 0, MatchGpuName("Mali", "Immortalis")))
+	RegisterBackend(testBackend("Xclipse", 0, MatchAny(MatchGpuName("Xclipse"), MatchGpuVendor("Samsung"))))
+	RegisterBackend(testBackend("Emulator", 1, MatchGpuName("Emulator")))
+
+	for _, test := range []struct {
+		name, gpu, vendor string
+		expected          string
+	}{
+		{"name", "Mali-G78", "", "Mali"},
+		{"other name", "Immortalis-G715", "", "Mali"},
+		{"vendor", "Unknown", "SAMSUNG", "Xclipse"},
+		{"priority", "Emulator (Mali-G78)", "", "Emulator"},
+	} {
+		b, ok := FindBackend(gpuInstance(test.gpu, test.vendor))
+		assert.For(ctx, "%v found", test.name).That(ok).Equals(true)
+		assert.For(ctx, "%v backend", test.name).That(b.Name).Equals(test.expected)
+	}
+
+	_, ok := FindBackend(gpuInstance("Unknown", ""))
+	assert.For(ctx, "unsupported").That(ok).Equals(false)
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// batchingSubmits is the number of queue submissions per frame above
+	// which batching them is recommended, if they are small.
+	batchingSubmits = 20
+	// smallSubmitTime is the mean GPU time of a submission, in nanoseconds,
+	// below which the submissions are considered small.
+	smallSubmitTime = 500 * 1000
+)
+
+// submission is the span of the GPU work of a queue submission.
+type submission struct {
+	start, end uint64
+	gpuTime    uint64
+}
+
+// ComputeSubmissions returns the number of queue submissions of each frame,
+// their mean GPU time and the GPU idle time between them. Returns nil if the
+// slices of the data have no submissions. The data's GPU idle time should
+// have been computed.
+func ComputeSubmissions(data *service.ProfilingData) *service.ProfilingData_Submissions {
+	lateSubmissions := map[int64]uint64{}
+	for _, frame := range data.GetGpuIdle().GetFrames() {
+		for _, gap := range frame.Gaps {
+			if gap.Cause == service.ProfilingData_GpuIdle_LateSubmission {
+				lateSubmissions[frame.FrameId] += gap.Dur
+			}
+		}
+	}
+
+	res := &service.ProfilingData_Submissions{}
+	submits, gaps := 0, 0
+	gapTime, lateTime := uint64(0), uint64(0)
+	for frameID, slices := range SliceFrames(data.GetSlices()) {
+		subs := frameSubmissions(slices)
+		if len(subs) == 0 {
+			continue
+		}
+		frame := &service.ProfilingData_Submissions_Frame{
+			FrameId:            frameID,
+			Submits:            uint32(len(subs)),
+			LateSubmissionTime: lateSubmissions[frameID],
+		}
+		gpuTime, end := uint64(0), subs[0].end
+		for _, sub := range subs {
+			gpuTime += sub.gpuTime
+			if sub.start > end {
+				frame.GapTime += sub.start - end
+			}
+			if sub.end > end {
+				end = sub.end
+			}
+		}
+		frame.MeanGpuTime = gpuTime / uint64(len(subs))
+		res.Frames = append(res.Frames, frame)
+
+		submits += len(subs)
+		gaps += len(subs) - 1
+		gapTime += frame.GapTime
+		lateTime += frame.LateSubmissionTime
+	}
+	if len(res.Frames) == 0 {
+		return nil
+	}
+	sort.Slice(res.Frames, func(i, j int) bool { return res.Frames[i].FrameId < res.Frames[j].FrameId })
+
+	res.MeanSubmits = float64(submits) / float64(len(res.Frames))
+	if gaps > 0 {
+		res.GapPerSubmit = gapTime / uint64(gaps)
+		res.CpuOverheadPerSubmit = lateTime / uint64(gaps)
+	}
+	return res
+}
+
+// frameSubmissions returns the submissions of the slices of a frame, by start
+// time. The GPU time of a submission is the duration of its top level slices.
+func frameSubmissions(slices []*service.ProfilingData_GpuSlices_Slice) []submission {
+	byID := map[int64]*submission{}
+	for _, slice := range slices {
+		id, ok := sliceSubmission(slice)
+		if !ok {
+			continue
+		}
+		sub, ok := byID[id]
+		if !ok {
+			sub = &submission{start: slice.Ts, end: slice.Ts + slice.Dur}
+			byID[id] = sub
+		}
+		if slice.Ts < sub.start {
+			sub.start = slice.Ts
+		}
+		if e := slice.Ts + slice.Dur; e > sub.end {
+			sub.end = e
+		}
+		if slice.Depth == 0 {
+			sub.gpuTime += slice.Dur
+		}
+	}
+
+	res := make([]submission, 0, len(byID))
+	for _, sub := range byID {
+		res = append(res, *sub)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].start < res[j].start })
+	return res
+}
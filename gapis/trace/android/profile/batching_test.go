@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeSubmissions(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slice := func(frame, submission int64, ts, dur uint64) *service.ProfilingData_GpuSlices_Slice {
+		return &service.ProfilingData_GpuSlices_Slice{
+			Ts:  ts,
+			Dur: dur,
+			Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{
+				{Name: "frameId", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(frame)}},
+				{Name: "submissionId", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(submission)}},
+			},
+		}
+	}
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{},
+		GpuIdle: &service.ProfilingData_GpuIdle{
+			Frames: []*service.ProfilingData_GpuIdle_Frame{
+				{FrameId: 1, Dur: 1000, Gaps: []*service.ProfilingData_GpuIdle_Gap{
+					{Dur: 10, Cause: service.ProfilingData_GpuIdle_LateSubmission},
+					{Dur: 10, Cause: service.ProfilingData_GpuIdle_SyncWait},
+				}},
+				{FrameId: 2, Dur: 1000},
+			},
+		},
+	}
+	// Frame 1 has 30 small submissions, 20ns apart.
+	for i := uint64(0); i < 30; i++ {
+		data.Slices.Slices = append(data.Slices.Slices, slice(1, int64(i), i*30, 10))
+	}
+	// Frame 2 has a single submission of two slices.
+	data.Slices.Slices = append(data.Slices.Slices, slice(2, 100, 2000, 400), slice(2, 100, 2400, 100))
+
+	submissions := ComputeSubmissions(data)
+	if !assert.For(ctx, "frames").That(len(submissions.GetFrames())).Equals(2) {
+		return
+	}
+	first, second := submissions.Frames[0], submissions.Frames[1]
+	assert.For(ctx, "submits").That(first.Submits).Equals(uint32(30))
+	assert.For(ctx, "mean GPU time").That(first.MeanGpuTime).Equals(uint64(10))
+	assert.For(ctx, "gap time").That(first.GapTime).Equals(uint64(29 * 20))
+	assert.For(ctx, "late submission time").That(first.LateSubmissionTime).Equals(uint64(10))
+	assert.For(ctx, "single submit").That(second.Submits).Equals(uint32(1))
+	assert.For(ctx, "single submit GPU time").That(second.MeanGpuTime).Equals(uint64(500))
+	assert.For(ctx, "single submit gap time").That(second.GapTime).Equals(uint64(0))
+	assert.For(ctx, "mean submits").That(submissions.MeanSubmits).Equals(15.5)
+	assert.For(ctx, "gap per submit").That(submissions.GapPerSubmit).Equals(uint64(20))
+
+	data.Submissions = submissions
+	got := batchingRecommendation(data.Submissions, 2000)
+	if assert.For(ctx, "recommendation").That(got).IsNotNil() {
+		assert.For(ctx, "frames").ThatSlice(got.FrameIds).Equals([]int64{1})
+		assert.For(ctx, "savings").That(got.EstimatedSavings).Equals(uint64(29 * 20))
+		assert.For(ctx, "severity").That(got.Severity).Equals(service.ProfilingData_Recommendation_Critical)
+	}
+
+	assert.For(ctx, "no submissions").That(ComputeSubmissions(&service.ProfilingData{})).IsNil()
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// CounterBlocks groups the counters by the hardware blocks of the descriptor,
+// such that clients can present the counters organized by block. The counter
+// ids of the returned blocks reference the counters' track ids. Counters that
+// are not part of any block of the descriptor, including counters without a
+// spec, are grouped by their names.
+func CounterBlocks(desc *device.GpuCounterDescriptor, counters []*service.ProfilingData_Counter) []*device.GpuCounterDescriptor_GpuCounterBlock {
+	// Group a copy of the descriptor, so that the blocks of descriptors
+	// from devices that didn't group their counters are inferred.
+	grouped := &device.GpuCounterDescriptor{
+		Blocks: append([]*device.GpuCounterDescriptor_GpuCounterBlock{}, desc.GetBlocks()...),
+	}
+	specIds := map[uint32]uint32{} // spec counter id -> track id
+	for _, counter := range counters {
+		spec := counter.Spec
+		if spec == nil {
+			// Use an id that can't clash with the descriptor's.
+			spec = &device.GpuCounterDescriptor_GpuCounterSpec{CounterId: ^counter.Id, Name: counter.Name}
+		}
+		specIds[spec.CounterId] = counter.Id
+		grouped.Specs = append(grouped.Specs, spec)
+	}
+	grouped.GroupBlocks()
+
+	res := []*device.GpuCounterDescriptor_GpuCounterBlock{}
+	for _, block := range grouped.Blocks {
+		ids := []uint32{}
+		for _, id := range block.CounterIds {
+			if trackId, ok := specIds[id]; ok {
+				ids = append(ids, trackId)
+			}
+		}
+		if len(ids) > 0 {
+			res = append(res, &device.GpuCounterDescriptor_GpuCounterBlock{
+				BlockId:       block.BlockId,
+				BlockCapacity: block.BlockCapacity,
+				Name:          block.Name,
+				Description:   block.Description,
+				CounterIds:    ids,
+			})
+		}
+	}
+	return res
+}
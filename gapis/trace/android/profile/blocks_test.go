@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCounterBlocks(t *testing.T) {
+	ctx := log.Testing(t)
+
+	desc := &device.GpuCounterDescriptor{
+		Specs: []*device.GpuCounterDescriptor_GpuCounterSpec{
+			{CounterId: 1, Name: "Shader Core Utilization"},
+			{CounterId: 2, Name: "Unused"},
+		},
+		Blocks: []*device.GpuCounterDescriptor_GpuCounterBlock{
+			{BlockId: 1, Name: "Core", BlockCapacity: 4, CounterIds: []uint32{1, 2}},
+		},
+	}
+	counters := []*service.ProfilingData_Counter{
+		{Id: 10, Name: "Shader Core Utilization", Spec: desc.Specs[0]},
+		{Id: 11, Name: "Tiler Active Cycles"},
+	}
+
+	blocks := CounterBlocks(desc, counters)
+	assert.For(ctx, "blocks").That(len(blocks)).Equals(2)
+	assert.For(ctx, "core name").That(blocks[0].Name).Equals("Core")
+	assert.For(ctx, "core capacity").That(blocks[0].BlockCapacity).Equals(uint32(4))
+	assert.For(ctx, "core counters").ThatSlice(blocks[0].CounterIds).Equals([]uint32{10})
+	assert.For(ctx, "tiler name").That(blocks[1].Name).Equals(device.TilerBlock)
+	assert.For(ctx, "tiler counters").ThatSlice(blocks[1].CounterIds).Equals([]uint32{11})
+	assert.For(ctx, "descriptor").That(len(desc.Blocks)).Equals(1)
+}
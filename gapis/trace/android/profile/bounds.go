@@ -0,0 +1,37 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/perfetto"
+)
+
+const traceStartQuery = "SELECT start_ts FROM trace_bounds"
+
+// QueryTraceStart returns the boottime timestamp of the start of the trace,
+// such that exporters can make the timestamps relative to it.
+func QueryTraceStart(ctx context.Context, processor perfetto.Querier) (uint64, error) {
+	res, err := processor.Query(traceStartQuery)
+	if err != nil {
+		return 0, queryError(err, traceStartQuery)
+	}
+	starts := res.GetColumns()[0].GetLongValues()
+	if len(starts) == 0 {
+		return 0, nil
+	}
+	return uint64(starts[0]), nil
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"github.com/google/gapid/gapis/service"
+)
+
+// ComputeFrameBudget returns the utilization of the given frame time budget,
+// in nanoseconds, by each frame of the data and, if a game engine was
+// detected, by each of the engine's rendering passes. Returns nil if the
+// budget is zero.
+func ComputeFrameBudget(data *service.ProfilingData, budget uint64) *service.ProfilingData_FrameBudget {
+	if budget == 0 {
+		return nil
+	}
+
+	res := &service.ProfilingData_FrameBudget{Budget: budget}
+	frames := data.GetGpuIdle().GetFrames()
+	for _, frame := range frames {
+		f := &service.ProfilingData_FrameBudget_Frame{
+			FrameId:        frame.FrameId,
+			Utilization:    float64(frame.Dur) / float64(budget),
+			GpuUtilization: float64(frame.Dur-frame.Idle) / float64(budget),
+			Exceeded:       frame.Dur > budget,
+		}
+		if f.Exceeded {
+			res.ExceededFrames++
+		}
+		res.Frames = append(res.Frames, f)
+	}
+
+	if len(frames) > 0 {
+		for _, pass := range data.GetEngine().GetPasses() {
+			res.Passes = append(res.Passes, &service.ProfilingData_FrameBudget_Pass{
+				Name:        pass.Name,
+				Utilization: float64(pass.GpuTime) / float64(len(frames)) / float64(budget),
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeFrameBudget(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data := &service.ProfilingData{
+		GpuIdle: &service.ProfilingData_GpuIdle{
+			Frames: []*service.ProfilingData_GpuIdle_Frame{
+				{FrameId: 1, Ts: 0, Dur: 80, Idle: 40},
+				{FrameId: 2, Ts: 80, Dur: 120, Idle: 20},
+			},
+		},
+		Engine: &service.ProfilingData_Engine{
+			Passes: []*service.ProfilingData_Engine_Pass{{Name: "Shadows", GpuTime: 50}},
+		},
+	}
+
+	assert.For(ctx, "disabled").That(ComputeFrameBudget(data, 0)).IsNil()
+
+	budget := ComputeFrameBudget(data, 100)
+	assert.For(ctx, "frames").That(len(budget.Frames)).Equals(2)
+	assert.For(ctx, "utilization").That(budget.Frames[0].Utilization).Equals(0.8)
+	assert.For(ctx, "gpu utilization").That(budget.Frames[0].GpuUtilization).Equals(0.4)
+	assert.For(ctx, "within budget").That(budget.Frames[0].Exceeded).Equals(false)
+	assert.For(ctx, "over budget").That(budget.Frames[1].Exceeded).Equals(true)
+	assert.For(ctx, "exceeded").That(budget.ExceededFrames).Equals(uint32(1))
+	assert.For(ctx, "passes").That(len(budget.Passes)).Equals(1)
+	assert.For(ctx, "pass utilization").That(budget.Passes[0].Utilization).Equals(0.25)
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"strings"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// categoryKeywords maps keywords of the vendor render stage names to slice
+// categories. The first matching keyword wins, so more specific stages come
+// first, e.g. an Adreno "GMEM Store" is a resolve, not a render.
+var categoryKeywords = []struct {
+	keyword  string
+	category service.ProfilingData_GpuSlices_Slice_Category
+}{
+	{"present", service.ProfilingData_GpuSlices_Slice_Present},
+	{"resolve", service.ProfilingData_GpuSlices_Slice_Resolve},
+	{"store", service.ProfilingData_GpuSlices_Slice_Resolve},
+	{"blit", service.ProfilingData_GpuSlices_Slice_Blit},
+	{"copy", service.ProfilingData_GpuSlices_Slice_Blit},
+	{"compute", service.ProfilingData_GpuSlices_Slice_Compute},
+	{"dispatch", service.ProfilingData_GpuSlices_Slice_Compute},
+	{"vertex", service.ProfilingData_GpuSlices_Slice_Vertex},
+	{"binning", service.ProfilingData_GpuSlices_Slice_Vertex},
+	{"tiler", service.ProfilingData_GpuSlices_Slice_Vertex},
+	{"fragment", service.ProfilingData_GpuSlices_Slice_Fragment},
+	{"surface", service.ProfilingData_GpuSlices_Slice_Fragment},
+	{"render", service.ProfilingData_GpuSlices_Slice_Fragment},
+}
+
+// categoryColors are the suggested colors of the slice categories, such that
+// all clients use the same color coding.
+var categoryColors = map[service.ProfilingData_GpuSlices_Slice_Category]string{
+	service.ProfilingData_GpuSlices_Slice_Unknown:  "#9E9E9E",
+	service.ProfilingData_GpuSlices_Slice_Vertex:   "#4285F4",
+	service.ProfilingData_GpuSlices_Slice_Fragment: "#34A853",
+	service.ProfilingData_GpuSlices_Slice_Compute:  "#FBBC04",
+	service.ProfilingData_GpuSlices_Slice_Blit:     "#A142F4",
+	service.ProfilingData_GpuSlices_Slice_Resolve:  "#EA4335",
+	service.ProfilingData_GpuSlices_Slice_Present:  "#24C1E0",
+}
+
+// SliceCategory returns the category of a GPU slice, based on the name of
+// its render stage and, if that is not conclusive, the name of its track.
+func SliceCategory(name, track string) service.ProfilingData_GpuSlices_Slice_Category {
+	for _, s := range []string{name, track} {
+		s = strings.ToLower(s)
+		for _, k := range categoryKeywords {
+			if strings.Contains(s, k.keyword) {
+				return k.category
+			}
+		}
+	}
+	return service.ProfilingData_GpuSlices_Slice_Unknown
+}
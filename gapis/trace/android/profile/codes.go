@@ -0,0 +1,96 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const clockSyncFailuresQuery = "" +
+	"SELECT COALESCE(SUM(value), 0) FROM stats WHERE name = 'clock_sync_failure'"
+
+// remediations are the hints given to the users for the known reasons of
+// profiling failures.
+var remediations = map[service.ProfilingErrorCode]string{
+	service.ProfilingErrorCode_QueryFailed: "The trace may be truncated or corrupt. Try profiling again, " +
+		"or with a larger trace buffer.",
+	service.ProfilingErrorCode_NoRenderStageTrack: "Make sure the GPU driver has render stages enabled, " +
+		"e.g. that the device's GPU profiling is supported and the app is debuggable, " +
+		"and that the replay ran long enough to submit work to the GPU.",
+	service.ProfilingErrorCode_ClockSyncMissing: "The GPU producer didn't emit clock snapshots. Update " +
+		"the GPU driver, or restart the device's traced and traced_probes services.",
+	service.ProfilingErrorCode_NoHostTimings: "Start the emulator with its gfxstream tracing enabled and " +
+		"connected to the guest's Perfetto service.",
+	service.ProfilingErrorCode_UnsupportedGpu: "Profile on a device with an Adreno, Mali or PowerVR GPU, or an emulator.",
+	service.ProfilingErrorCode_NoProfilingCapability: "Update the device to Android 10 or later, with a GPU " +
+		"driver that supports the Perfetto GPU data sources.",
+	service.ProfilingErrorCode_NoProfilingApi: "Capture the app with an API that supports profiling, e.g. Vulkan.",
+}
+
+// Errf returns a *service.ErrProfiling of the given code, with the hint of
+// the code on how to fix it.
+func Errf(code service.ProfilingErrorCode, cause error, format string, args ...interface{}) error {
+	res := &service.ErrProfiling{
+		Code:        code,
+		Message:     fmt.Sprintf(format, args...),
+		Remediation: remediations[code],
+	}
+	if cause != nil {
+		res.Cause = cause.Error()
+	}
+	return res
+}
+
+// queryError returns the error for the failed query of the trace processor.
+func queryError(err error, query string) error {
+	return Errf(service.ProfilingErrorCode_QueryFailed, err, "SQL query failed: %v", query)
+}
+
+// AsProfilingError returns the first *service.ErrProfiling in the chain of
+// causes of err, or nil if there is none.
+func AsProfilingError(err error) *service.ErrProfiling {
+	for i := 0; i < 64 && err != nil; i++ {
+		switch e := err.(type) {
+		case *service.ErrProfiling:
+			return e
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// CheckClockSync returns an error if the trace processor failed to convert
+// any of the timestamps of the trace to the trace clock, which leaves the GPU
+// slices misaligned with the CPU side events.
+func CheckClockSync(ctx context.Context, processor perfetto.Querier) error {
+	res, err := processor.Query(clockSyncFailuresQuery)
+	if err != nil {
+		return queryError(err, clockSyncFailuresQuery)
+	}
+	if failures := res.GetColumns()[0].GetLongValues(); len(failures) > 0 && failures[0] > 0 {
+		return Errf(service.ProfilingErrorCode_ClockSyncMissing, nil,
+			"Failed to convert %d timestamps to the trace clock", failures[0])
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestErrf(t *testing.T) {
+	ctx := log.Testing(t)
+	err := Errf(service.ProfilingErrorCode_NoRenderStageTrack, errors.New("empty"), "No slices in %v", "trace")
+	perr := AsProfilingError(log.Err(ctx, err, "Profiling failed"))
+	assert.For(ctx, "found").That(perr != nil).Equals(true)
+	assert.For(ctx, "code").That(perr.Code).Equals(service.ProfilingErrorCode_NoRenderStageTrack)
+	assert.For(ctx, "message").That(perr.Message).Equals("No slices in trace")
+	assert.For(ctx, "cause").That(perr.Cause).Equals("empty")
+	assert.For(ctx, "remediation").That(perr.Remediation).Equals(remediations[service.ProfilingErrorCode_NoRenderStageTrack])
+
+	assert.For(ctx, "plain").That(AsProfilingError(errors.New("plain")) == nil).Equals(true)
+}
+
+func TestSectionErrorsCode(t *testing.T) {
+	ctx := log.Testing(t)
+	failure := log.Err(ctx, queryError(errors.New("no such table"), "SELECT 1"), "Failed to get the markers")
+
+	errs := SectionErrors{}
+	errs.Add(PutErrorPolicy(ctx, service.ProfilingErrorPolicy_QuietOnError), service.ProfilingData_SectionError_Markers, failure, "Failed")
+	assert.For(ctx, "recorded").That(len(errs)).Equals(1)
+	assert.For(ctx, "code").That(errs[0].Code).Equals(service.ProfilingErrorCode_QueryFailed)
+	assert.For(ctx, "remediation").That(errs[0].Remediation).Equals(remediations[service.ProfilingErrorCode_QueryFailed])
+
+	ctx = PutErrorPolicy(ctx, service.ProfilingErrorPolicy_FailOnError)
+	errs = SectionErrors{}
+	err := errs.Add(ctx, service.ProfilingData_SectionError_Markers, failure, "Failed")
+	boxed := service.NewError(err).GetErrProfiling()
+	assert.For(ctx, "boxed").That(boxed != nil).Equals(true)
+	assert.For(ctx, "boxed code").That(boxed.Code).Equals(service.ProfilingErrorCode_QueryFailed)
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// The buffer queue events of the graphics frame data source are reported
+	// as slices on a track per layer, named after the layer.
+	bufferQueueQuery = "" +
+		"SELECT t.name, s.name, s.ts FROM slice s JOIN gpu_track t ON s.track_id = t.id " +
+		"WHERE t.scope = 'graphics_frame_event' AND s.name IN ('Queue', 'Latch', 'PresentFenceSignaled') ORDER BY s.ts"
+)
+
+// bufferQueueEvents holds the sorted times the buffers of a layer were queued
+// to the compositor, latched by it and displayed.
+type bufferQueueEvents struct {
+	queues, latches, displays []uint64
+}
+
+// ComputeCompositionLatency adds the time from the buffer of each frame of the
+// lifecycle being queued to it being displayed, and splits it into the time
+// the compositor waited for the GPU to finish the frame and the time the
+// finished frame sat in the queue. The frames are matched to the buffers of
+// the layer with the most queued buffers, being the replayed surface. Traces
+// without buffer queue events leave the frames untouched.
+func ComputeCompositionLatency(ctx context.Context, processor perfetto.Querier, lifecycle *service.ProfilingData_FrameLifecycle) error {
+	if len(lifecycle.GetFrames()) == 0 {
+		return nil
+	}
+
+	bufferQueueQueryResult, err := processor.Query(bufferQueueQuery)
+	if err != nil {
+		return queryError(err, bufferQueueQuery)
+	}
+	columns := bufferQueueQueryResult.GetColumns()
+	layers := columns[0].GetStringValues()
+	names := columns[1].GetStringValues()
+	timestamps := columns[2].GetLongValues()
+
+	events := map[string]*bufferQueueEvents{}
+	for i := range layers {
+		e, ok := events[layers[i]]
+		if !ok {
+			e = &bufferQueueEvents{}
+			events[layers[i]] = e
+		}
+		switch names[i] {
+		case "Queue":
+			e.queues = append(e.queues, uint64(timestamps[i]))
+		case "Latch":
+			e.latches = append(e.latches, uint64(timestamps[i]))
+		case "PresentFenceSignaled":
+			e.displays = append(e.displays, uint64(timestamps[i]))
+		}
+	}
+	var layer *bufferQueueEvents
+	for _, e := range events {
+		if layer == nil || len(e.queues) > len(layer.queues) {
+			layer = e
+		}
+	}
+	if layer == nil || len(layer.queues) == 0 {
+		return nil
+	}
+
+	gpuWait, queueTime := uint64(0), uint64(0)
+	for _, frame := range lifecycle.Frames {
+		if frameComposition(frame, layer) {
+			lifecycle.ComposedFrames++
+			gpuWait += frame.GpuWait
+			queueTime += frame.QueueTime
+		}
+	}
+	if lifecycle.ComposedFrames > 0 {
+		lifecycle.MeanGpuWait = gpuWait / uint64(lifecycle.ComposedFrames)
+		lifecycle.MeanQueueTime = queueTime / uint64(lifecycle.ComposedFrames)
+	}
+	return nil
+}
+
+// frameComposition sets the composition timing of the frame from the first
+// buffer queued by its presentation. Returns false if the frame has no
+// presentation or its buffer was not displayed.
+func frameComposition(frame *service.ProfilingData_FrameLifecycle_Frame, events *bufferQueueEvents) bool {
+	if frame.Present == 0 {
+		return false
+	}
+	queued, ok := firstAtOrAfter(events.queues, frame.Present)
+	if !ok {
+		return false
+	}
+	latched, ok := firstAtOrAfter(events.latches, queued)
+	if !ok {
+		return false
+	}
+	displayed, ok := firstAtOrAfter(events.displays, latched)
+	if !ok {
+		return false
+	}
+	frame.Queued, frame.Latched, frame.Displayed = queued, latched, displayed
+
+	// The buffer is queued with an acquire fence, which signals at the end of
+	// the GPU work. Until then, the compositor waits for the GPU.
+	ready := queued
+	if frame.GpuEnd > ready {
+		frame.GpuWait = frame.GpuEnd - ready
+		ready = frame.GpuEnd
+	}
+	if displayed > ready {
+		frame.QueueTime = displayed - ready
+	}
+	return true
+}
+
+// firstAtOrAfter returns the first of the sorted times at or after ts.
+func firstAtOrAfter(times []uint64, ts uint64) (uint64, bool) {
+	i := sort.Search(len(times), func(i int) bool { return times[i] >= ts })
+	if i == len(times) {
+		return 0, false
+	}
+	return times[i], true
+}
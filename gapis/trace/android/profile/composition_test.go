@@ -0,0 +1,53 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestFrameComposition(t *testing.T) {
+	ctx := log.Testing(t)
+	events := &bufferQueueEvents{
+		queues:   []uint64{110, 210},
+		latches:  []uint64{160, 260},
+		displays: []uint64{180, 300},
+	}
+
+	// The GPU finished after the buffer was queued.
+	late := &service.ProfilingData_FrameLifecycle_Frame{Present: 100, GpuEnd: 150}
+	assert.For(ctx, "late composed").That(frameComposition(late, events)).Equals(true)
+	assert.For(ctx, "late queued").That(late.Queued).Equals(uint64(110))
+	assert.For(ctx, "late latched").That(late.Latched).Equals(uint64(160))
+	assert.For(ctx, "late displayed").That(late.Displayed).Equals(uint64(180))
+	assert.For(ctx, "late gpu wait").That(late.GpuWait).Equals(uint64(40))
+	assert.For(ctx, "late queue time").That(late.QueueTime).Equals(uint64(30))
+
+	// The GPU finished before the buffer was queued.
+	queued := &service.ProfilingData_FrameLifecycle_Frame{Present: 200, GpuEnd: 190}
+	assert.For(ctx, "queued composed").That(frameComposition(queued, events)).Equals(true)
+	assert.For(ctx, "queued gpu wait").That(queued.GpuWait).Equals(uint64(0))
+	assert.For(ctx, "queued queue time").That(queued.QueueTime).Equals(uint64(90))
+
+	unknown := &service.ProfilingData_FrameLifecycle_Frame{GpuEnd: 50}
+	assert.For(ctx, "no present").That(frameComposition(unknown, events)).Equals(false)
+	undisplayed := &service.ProfilingData_FrameLifecycle_Frame{Present: 250, GpuEnd: 240}
+	assert.For(ctx, "not displayed").That(frameComposition(undisplayed, events)).Equals(false)
+	assert.For(ctx, "not displayed queued").That(undisplayed.Queued).Equals(uint64(0))
+}
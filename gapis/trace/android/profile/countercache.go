@@ -0,0 +1,322 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	counterCacheKey = contextKey("counterCache")
+	// CounterCacheSuffix is the suffix of the counter cache files, which are
+	// stored next to the traces.
+	CounterCacheSuffix = ".counters"
+	// counterCacheMagic identifies the format, and its version, of the
+	// counter cache files.
+	counterCacheMagic = "AGICNT02"
+)
+
+// CounterCache is the location of the cache of the counter samples of a trace.
+type CounterCache struct {
+	Path string
+	// Key identifies the trace, such that a stale cache isn't used.
+	Key string
+}
+
+// PutCounterCache attaches the counter cache of the profiled trace to the
+// context.
+func PutCounterCache(ctx context.Context, cache CounterCache) context.Context {
+	return keys.WithValue(ctx, counterCacheKey, cache)
+}
+
+// GetCounterCache returns the counter cache attached to the context by
+// PutCounterCache, if any.
+func GetCounterCache(ctx context.Context) (CounterCache, bool) {
+	val, ok := ctx.Value(counterCacheKey).(CounterCache)
+	return val, ok
+}
+
+// The cache file starts with the magic and the key, followed by the directory
+// of the counter tracks and the columns of their samples:
+//
+//   magic, key, track count
+//   for each track: id, name, unit, description, sample count and the sizes
+//                   of its timestamp and value columns
+//   for each track: the timestamp column, then the value column
+//
+// The strings and integers are uvarint encoded, the strings prefixed by their
+// length. The timestamps are delta encoded, the values XORed with the
+// previous value, both as uvarints, and each column is compressed separately
+// such that a track is decoded without decoding the others.
+
+// writeCounterCache writes the tracks of the counters and their samples to the
+// cache file. The file is written atomically, such that a concurrent or
+// interrupted write leaves no partial file behind.
+func writeCounterCache(cache CounterCache, counters []*service.ProfilingData_Counter) error {
+	header, columns := &bytes.Buffer{}, &bytes.Buffer{}
+	header.WriteString(counterCacheMagic)
+	putString(header, cache.Key)
+	putUvarint(header, uint64(len(counters)))
+	for _, c := range counters {
+		timestamps, err := compressColumn(deltaEncode(c.Timestamps))
+		if err != nil {
+			return err
+		}
+		values, err := compressColumn(xorEncode(c.Values))
+		if err != nil {
+			return err
+		}
+		putUvarint(header, uint64(c.Id))
+		putString(header, c.Name)
+		putString(header, c.Unit)
+		putString(header, c.Description)
+		putUvarint(header, uint64(c.Gpu))
+		putUvarint(header, uint64(len(c.Timestamps)))
+		putUvarint(header, uint64(len(timestamps)))
+		putUvarint(header, uint64(len(values)))
+		columns.Write(timestamps)
+		columns.Write(values)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(cache.Path), filepath.Base(cache.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(header.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(columns.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cache.Path)
+}
+
+// readCounterCache reads the counters and their samples from the memory
+// mapped cache file. Returns an error if the file doesn't exist, or is not a
+// cache of the keyed trace.
+func readCounterCache(cache CounterCache) ([]*service.ProfilingData_Counter, error) {
+	data, unmap, err := mapFile(cache.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer unmap()
+
+	if !bytes.HasPrefix(data, []byte(counterCacheMagic)) {
+		return nil, fmt.Errorf("Not a counter cache: %v", cache.Path)
+	}
+	r := bytes.NewReader(data[len(counterCacheMagic):])
+	key, err := getString(r)
+	if err != nil {
+		return nil, err
+	}
+	if key != cache.Key {
+		return nil, fmt.Errorf("Counter cache %v is of another trace", cache.Path)
+	}
+
+	type track struct {
+		counter                *service.ProfilingData_Counter
+		samples, tsLen, valLen uint64
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	tracks := []track{}
+	for i := uint64(0); i < count; i++ {
+		t := track{counter: &service.ProfilingData_Counter{}}
+		id, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range []*string{&t.counter.Name, &t.counter.Unit, &t.counter.Description} {
+			if *s, err = getString(r); err != nil {
+				return nil, err
+			}
+		}
+		gpu, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		t.counter.Gpu = uint32(gpu)
+		for _, v := range []*uint64{&t.samples, &t.tsLen, &t.valLen} {
+			if *v, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		t.counter.Id = uint32(id)
+		t.counter.TrackIds = []uint32{uint32(id)}
+		tracks = append(tracks, t)
+	}
+
+	offset := uint64(len(data)) - uint64(r.Len())
+	res := make([]*service.ProfilingData_Counter, len(tracks))
+	for i, t := range tracks {
+		// Check each length on its own, as their sum may overflow.
+		rest := uint64(len(data)) - offset
+		if t.tsLen > rest || t.valLen > rest-t.tsLen {
+			return nil, fmt.Errorf("Counter cache %v is truncated", cache.Path)
+		}
+		end := offset + t.tsLen + t.valLen
+		deltas, err := decompressColumn(data[offset:offset+t.tsLen], t.samples)
+		if err != nil {
+			return nil, err
+		}
+		xors, err := decompressColumn(data[offset+t.tsLen:end], t.samples)
+		if err != nil {
+			return nil, err
+		}
+		t.counter.Timestamps = deltaDecode(deltas)
+		t.counter.Values = xorDecode(xors)
+		res[i] = t.counter
+		offset = end
+	}
+	return res, nil
+}
+
+// deltaEncode returns the differences between the consecutive timestamps,
+// which are small for the regularly sampled counters.
+func deltaEncode(timestamps []uint64) []uint64 {
+	res, prev := make([]uint64, len(timestamps)), uint64(0)
+	for i, ts := range timestamps {
+		res[i], prev = ts-prev, ts
+	}
+	return res
+}
+
+func deltaDecode(deltas []uint64) []uint64 {
+	res, prev := make([]uint64, len(deltas)), uint64(0)
+	for i, d := range deltas {
+		prev += d
+		res[i] = prev
+	}
+	return res
+}
+
+// xorEncode returns the bits of the values XORed with the bits of the previous
+// value, which have few significant bits for the slowly changing counters.
+// The bits are reversed, such that the mostly zero low bits of the mantissa
+// are encoded as high bits, and the uvarints are short.
+func xorEncode(values []float64) []uint64 {
+	res, prev := make([]uint64, len(values)), uint64(0)
+	for i, v := range values {
+		bits := math.Float64bits(v)
+		res[i], prev = reverseBits(bits^prev), bits
+	}
+	return res
+}
+
+func xorDecode(xors []uint64) []float64 {
+	res, prev := make([]float64, len(xors)), uint64(0)
+	for i, x := range xors {
+		prev ^= reverseBits(x)
+		res[i] = math.Float64frombits(prev)
+	}
+	return res
+}
+
+func reverseBits(v uint64) uint64 {
+	res := uint64(0)
+	for i := 0; i < 64; i++ {
+		res = res<<1 | v&1
+		v >>= 1
+	}
+	return res
+}
+
+// compressColumn returns the compressed uvarint encoding of the column.
+func compressColumn(column []uint64) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := flate.NewWriter(buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(w)
+	var tmp [binary.MaxVarintLen64]byte
+	for _, v := range column {
+		if _, err := bw.Write(tmp[:binary.PutUvarint(tmp[:], v)]); err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressColumn decodes a column of n values compressed by compressColumn.
+// The column grows as the values are decoded, rather than being allocated
+// upfront, as n is read from the cache and may be corrupt.
+func decompressColumn(data []byte, n uint64) ([]uint64, error) {
+	r := bufio.NewReader(flate.NewReader(bytes.NewReader(data)))
+	res := []uint64{}
+	for i := uint64(0); i < n; i++ {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func putUvarint(w *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func putString(w *bytes.Buffer, s string) {
+	putUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func getString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
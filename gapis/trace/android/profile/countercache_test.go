@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCounterCache(t *testing.T) {
+	ctx := log.Testing(t)
+
+	dir, err := ioutil.TempDir("", "countercache")
+	if !assert.For(ctx, "temp dir").ThatError(err).Succeeded() {
+		return
+	}
+	defer os.RemoveAll(dir)
+	cache := CounterCache{Path: filepath.Join(dir, "trace.perfetto"+CounterCacheSuffix), Key: "trace"}
+
+	_, err = readCounterCache(cache)
+	assert.For(ctx, "missing").That(os.IsNotExist(err)).Equals(true)
+
+	counters := []*service.ProfilingData_Counter{
+		{Id: 3, Name: "GPU Frequency", Unit: "Hz", Description: "The frequency",
+			Timestamps: []uint64{1000, 2000, 3000, 4000}, Values: []float64{585e6, 585e6, 0.5, -1}},
+		{Id: 7, Name: "Empty", Gpu: 1},
+	}
+	if !assert.For(ctx, "write").ThatError(writeCounterCache(cache, counters)).Succeeded() {
+		return
+	}
+
+	got, err := readCounterCache(cache)
+	if !assert.For(ctx, "read").ThatError(err).Succeeded() || !assert.For(ctx, "count").That(len(got)).Equals(2) {
+		return
+	}
+	assert.For(ctx, "id").That(got[0].Id).Equals(uint32(3))
+	assert.For(ctx, "name").That(got[0].Name).Equals("GPU Frequency")
+	assert.For(ctx, "unit").That(got[0].Unit).Equals("Hz")
+	assert.For(ctx, "description").That(got[0].Description).Equals("The frequency")
+	assert.For(ctx, "tracks").ThatSlice(got[0].TrackIds).Equals([]uint32{3})
+	assert.For(ctx, "timestamps").ThatSlice(got[0].Timestamps).Equals(counters[0].Timestamps)
+	assert.For(ctx, "values").ThatSlice(got[0].Values).Equals(counters[0].Values)
+	assert.For(ctx, "empty").That(len(got[1].Timestamps)).Equals(0)
+
+	_, err = readCounterCache(CounterCache{Path: cache.Path, Key: "other trace"})
+	assert.For(ctx, "stale").ThatError(err).Failed()
+}
+
+func TestDecompressCorruptColumn(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data, err := compressColumn([]uint64{1, 2, 3})
+	if !assert.For(ctx, "compress").ThatError(err).Succeeded() {
+		return
+	}
+	got, err := decompressColumn(data, 3)
+	assert.For(ctx, "decompress").ThatError(err).Succeeded()
+	assert.For(ctx, "values").ThatSlice(got).Equals([]uint64{1, 2, 3})
+
+	// A corrupt sample count must not be allocated upfront.
+	_, err = decompressColumn(data, 1<<62)
+	assert.For(ctx, "corrupt count").ThatError(err).Failed()
+}
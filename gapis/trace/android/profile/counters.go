@@ -0,0 +1,176 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	counterTracksQuery = "" +
+		"SELECT id, name, unit, description, COALESCE(gpu_id, 0) FROM gpu_counter_track ORDER BY id"
+	countersQueryFmt = "" +
+		"SELECT ts, value FROM counter c WHERE c.track_id = %d ORDER BY ts"
+	allCountersQuery = "" +
+		"SELECT c.track_id, c.ts, c.value FROM counter c " +
+		"JOIN gpu_counter_track t ON c.track_id = t.id " +
+		"ORDER BY c.track_id, c.ts"
+
+	// counterBatchRows is the number of counter samples returned per batch
+	// by the streaming counter query.
+	counterBatchRows = 100000
+)
+
+// ProcessCounters extracts all the GPU counter tracks and their samples from
+// the trace, or from the context's counter cache, which is written if it
+// doesn't exist yet. The counters are matched up with the specs in desc by
+// name. Samples of 32-bit counters that wrapped around are unwrapped. The
+// counters published by several producers are selected according to the
+// context's counter sources, and tracks with the same name are de-duplicated
+// according to the context's dedup policy. Also returns the conflicts between
+// the specs of desc with the same counter name.
+func ProcessCounters(ctx context.Context, processor perfetto.Querier, desc *device.GpuCounterDescriptor) ([]*service.ProfilingData_Counter, []*service.ProfilingData_CounterSpecConflict, error) {
+	var counters []*service.ProfilingData_Counter
+	cache, cached := GetCounterCache(ctx)
+	if cached {
+		var err error
+		if counters, err = readCounterCache(cache); err != nil && !os.IsNotExist(err) {
+			log.W(ctx, "Ignoring the counter cache: %v", err)
+		}
+	}
+	if counters == nil {
+		var err error
+		if counters, err = queryCounters(ctx, processor); err != nil {
+			return nil, nil, err
+		}
+		if cached {
+			if err := writeCounterCache(cache, counters); err != nil {
+				log.W(ctx, "Failed to write the counter cache %v: %v", cache.Path, err)
+			}
+		}
+	}
+
+	nameToSpec, conflicts := MergeCounterSpecs(ctx, desc)
+	for _, conflict := range conflicts {
+		log.W(ctx, "Conflicting specs for counter %v differ in %v, using spec %d of %d",
+			conflict.Name, conflict.Fields, conflict.Used+1, len(conflict.Specs))
+	}
+
+	for _, counter := range counters {
+		spec, _ := nameToSpec[counter.Name]
+		// TODO(apbodnar) Populate the `default` field once the trace processor supports it (b/147432390)
+		counter.Spec = spec
+		counter.Aggregation = CounterAggregation(spec)
+		if unwrapCounter(counter) {
+			log.W(ctx, "Counter %v wrapped around at 2^32, its samples were unwrapped", counter.Name)
+			counter.Unwrapped = true
+		}
+	}
+	inferCounterUnits(counters)
+	counters = applyCounterOverrides(counters, GetCounterOverrides(ctx))
+	counters = selectCounterSources(ctx, counters, GetCounterSources(ctx))
+	return dedupCounters(counters, GetCounterDedupPolicy(ctx)), conflicts, nil
+}
+
+// queryCounters returns the GPU counter tracks of the trace and their raw
+// samples. If the processor can stream query results, the samples of all the
+// tracks are read with a single query, otherwise with a query per track.
+func queryCounters(ctx context.Context, processor perfetto.Querier) ([]*service.ProfilingData_Counter, error) {
+	counterTracksQueryResult, err := processor.Query(counterTracksQuery)
+	if err != nil {
+		return nil, queryError(err, counterTracksQuery)
+	}
+	// t.id, name, unit, description, gpu_id
+	tracksColumns := counterTracksQueryResult.GetColumns()
+	numTracksRows := counterTracksQueryResult.GetNumRecords()
+	counters := make([]*service.ProfilingData_Counter, numTracksRows)
+	// Grab all the column values. Depends on the order of columns selected in countersQuery
+	trackIds := tracksColumns[0].GetLongValues()
+	names := tracksColumns[1].GetStringValues()
+	units := tracksColumns[2].GetStringValues()
+	descriptions := tracksColumns[3].GetStringValues()
+	gpus := tracksColumns[4].GetLongValues()
+
+	for i := uint64(0); i < numTracksRows; i++ {
+		counters[i] = &service.ProfilingData_Counter{
+			Id:          uint32(trackIds[i]),
+			Name:        names[i],
+			Unit:        units[i],
+			Description: descriptions[i],
+			TrackIds:    []uint32{uint32(trackIds[i])},
+			Gpu:         uint32(gpus[i]),
+		}
+	}
+
+	if streaming, ok := processor.(perfetto.StreamingQuerier); ok {
+		if err := streamCounterSamples(streaming, counters); err != nil {
+			return nil, queryError(err, allCountersQuery)
+		}
+		return counters, nil
+	}
+
+	for _, counter := range counters {
+		countersQuery := fmt.Sprintf(countersQueryFmt, counter.Id)
+		countersQueryResult, err := processor.Query(countersQuery)
+		if err != nil {
+			return nil, queryError(err, countersQuery)
+		}
+		countersColumns := countersQueryResult.GetColumns()
+		timestampsLong := countersColumns[0].GetLongValues()
+		timestamps := make([]uint64, len(timestampsLong))
+		for i, t := range timestampsLong {
+			timestamps[i] = uint64(t)
+		}
+		counter.Timestamps = timestamps
+		counter.Values = countersColumns[1].GetDoubleValues()
+	}
+	return counters, nil
+}
+
+// streamCounterSamples reads the samples of all the GPU counter tracks with a
+// single query, returned in batches, and appends them to the counters of their
+// tracks.
+func streamCounterSamples(processor perfetto.StreamingQuerier, counters []*service.ProfilingData_Counter) error {
+	byTrack := make(map[int64]*service.ProfilingData_Counter, len(counters))
+	for _, counter := range counters {
+		byTrack[int64(counter.Id)] = counter
+	}
+	return processor.QueryStreaming(allCountersQuery, counterBatchRows, func(res *perfetto_service.QueryResult) error {
+		// c.track_id, c.ts, c.value
+		columns := res.GetColumns()
+		trackIds := columns[0].GetLongValues()
+		timestamps := columns[1].GetLongValues()
+		values := columns[2].GetDoubleValues()
+		var counter *service.ProfilingData_Counter
+		for i := range trackIds {
+			if counter == nil || int64(counter.Id) != trackIds[i] {
+				if counter = byTrack[trackIds[i]]; counter == nil {
+					continue
+				}
+			}
+			counter.Timestamps = append(counter.Timestamps, uint64(timestamps[i]))
+			counter.Values = append(counter.Values, values[i])
+		}
+		return nil
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+)
+
+// streamingPlayer is a QueryPlayer that returns the rows of the recorded
+// results in batches.
+type streamingPlayer struct {
+	perfetto.QueryPlayer
+	batches map[string][]*perfetto_service.QueryResult
+}
+
+func (p streamingPlayer) QueryStreaming(q string, batchRows int, cb func(*perfetto_service.QueryResult) error) error {
+	batches, ok := p.batches[q]
+	if !ok {
+		return fmt.Errorf("No recorded result for query: %v", q)
+	}
+	for _, batch := range batches {
+		if err := cb(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestQueryCounters(t *testing.T) {
+	ctx := log.Testing(t)
+
+	longs := func(v ...int64) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{LongValues: v}
+	}
+	doubles := func(v ...float64) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{DoubleValues: v}
+	}
+	strings := func(v ...string) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{StringValues: v}
+	}
+	player := perfetto.QueryPlayer{
+		counterTracksQuery: &perfetto_service.QueryResult{
+			NumRecords: 3,
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				longs(2, 5, 9),
+				strings("GPU Frequency", "Fragment Cycles", "Empty"),
+				strings("Hz", "", ""),
+				strings("", "", ""),
+				longs(0, 0, 1),
+			},
+		},
+		fmt.Sprintf(countersQueryFmt, 2): &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{longs(10, 20, 30), doubles(1, 2, 3)},
+		},
+		fmt.Sprintf(countersQueryFmt, 5): &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{longs(10, 20), doubles(4, 5)},
+		},
+		fmt.Sprintf(countersQueryFmt, 9): &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{longs(), doubles()},
+		},
+	}
+	// The samples of track 2 are split across the batches, and track 9 has
+	// none.
+	streaming := streamingPlayer{
+		QueryPlayer: perfetto.QueryPlayer{counterTracksQuery: player[counterTracksQuery]},
+		batches: map[string][]*perfetto_service.QueryResult{
+			allCountersQuery: {
+				{
+					NumRecords: 2,
+					Columns:    []*perfetto_service.QueryResult_ColumnValues{longs(2, 2), longs(10, 20), doubles(1, 2)},
+				},
+				{
+					NumRecords: 3,
+					Columns:    []*perfetto_service.QueryResult_ColumnValues{longs(2, 5, 5), longs(30, 10, 20), doubles(3, 4, 5)},
+				},
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		name    string
+		querier perfetto.Querier
+	}{
+		{"per track", player},
+		{"streaming", streaming},
+	} {
+		counters, err := queryCounters(ctx, test.querier)
+		if !assert.For(ctx, "%v err", test.name).ThatError(err).Succeeded() ||
+			!assert.For(ctx, "%v count", test.name).That(len(counters)).Equals(3) {
+			continue
+		}
+		assert.For(ctx, "%v id", test.name).That(counters[0].Id).Equals(uint32(2))
+		assert.For(ctx, "%v unit", test.name).That(counters[0].Unit).Equals("Hz")
+		assert.For(ctx, "%v timestamps", test.name).ThatSlice(counters[0].Timestamps).Equals([]uint64{10, 20, 30})
+		assert.For(ctx, "%v values", test.name).ThatSlice(counters[0].Values).Equals([]float64{1, 2, 3})
+		assert.For(ctx, "%v other values", test.name).ThatSlice(counters[1].Values).Equals([]float64{4, 5})
+		assert.For(ctx, "%v empty", test.name).That(len(counters[2].Timestamps)).Equals(0)
+		assert.For(ctx, "%v gpu", test.name).That(counters[2].Gpu).Equals(uint32(1))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	counterDedupPolicyKey = contextKey("counterDedupPolicy")
+	sliceDedupPolicyKey   = contextKey("sliceDedupPolicy")
+)
+
+// PutCounterDedupPolicy attaches the policy used for counter tracks with the
+// same name to the context.
+func PutCounterDedupPolicy(ctx context.Context, policy service.CounterDedupPolicy) context.Context {
+	return keys.WithValue(ctx, counterDedupPolicyKey, policy)
+}
+
+// GetCounterDedupPolicy returns the policy attached to the context by
+// PutCounterDedupPolicy, defaulting to SuffixDuplicates.
+func GetCounterDedupPolicy(ctx context.Context) service.CounterDedupPolicy {
+	val, _ := ctx.Value(counterDedupPolicyKey).(service.CounterDedupPolicy)
+	return val
+}
+
+// dedupCounters handles the counters of the same GPU with the same name
+// according to the policy. The counters are expected to be sorted by track
+// ID, such that the first of the duplicates is the one with the lowest track
+// ID.
+func dedupCounters(counters []*service.ProfilingData_Counter, policy service.CounterDedupPolicy) []*service.ProfilingData_Counter {
+	type key struct {
+		name string
+		gpu  uint32
+	}
+	byName := map[key][]*service.ProfilingData_Counter{}
+	for _, counter := range counters {
+		k := key{counter.Name, counter.Gpu}
+		byName[k] = append(byName[k], counter)
+	}
+
+	res := make([]*service.ProfilingData_Counter, 0, len(counters))
+	for _, counter := range counters {
+		dups := byName[key{counter.Name, counter.Gpu}]
+		if len(dups) == 1 {
+			res = append(res, counter)
+			continue
+		}
+		switch policy {
+		case service.CounterDedupPolicy_MergeDuplicates:
+			if counter == dups[0] {
+				res = append(res, mergeCounters(dups))
+			}
+		case service.CounterDedupPolicy_KeepFirstDuplicate:
+			if counter == dups[0] {
+				res = append(res, counter)
+			}
+		default:
+			counter.Name = fmt.Sprintf("%v (%v)", counter.Name, counter.Id)
+			res = append(res, counter)
+		}
+	}
+	return res
+}
+
+// mergeCounters merges the samples of the counters into the first counter,
+// ordered by time.
+func mergeCounters(counters []*service.ProfilingData_Counter) *service.ProfilingData_Counter {
+	type sample struct {
+		ts    uint64
+		value float64
+	}
+	samples := []sample{}
+	res := counters[0]
+	trackIds := []uint32{}
+	for _, counter := range counters {
+		for i, ts := range counter.Timestamps {
+			samples = append(samples, sample{ts, counter.Values[i]})
+		}
+		trackIds = append(trackIds, counter.TrackIds...)
+		res.Unwrapped = res.Unwrapped || counter.Unwrapped
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].ts < samples[j].ts })
+
+	res.Timestamps = make([]uint64, len(samples))
+	res.Values = make([]float64, len(samples))
+	for i, s := range samples {
+		res.Timestamps[i], res.Values[i] = s.ts, s.value
+	}
+	res.TrackIds = trackIds
+	return res
+}
+
+// PutSliceDedupPolicy attaches the policy used for the GPU slices duplicated
+// on several tracks to the context.
+func PutSliceDedupPolicy(ctx context.Context, policy service.SliceDedupPolicy) context.Context {
+	return keys.WithValue(ctx, sliceDedupPolicyKey, policy)
+}
+
+// GetSliceDedupPolicy returns the policy attached to the context by
+// PutSliceDedupPolicy, defaulting to DropDuplicateSlices.
+func GetSliceDedupPolicy(ctx context.Context) service.SliceDedupPolicy {
+	val, _ := ctx.Value(sliceDedupPolicyKey).(service.SliceDedupPolicy)
+	return val
+}
+
+// sliceKey identifies a render stage slice across the tracks.
+type sliceKey struct {
+	ts, dur, depth                        int64
+	submission, commandBuffer, renderPass int64
+	name                                  string
+}
+
+// duplicateSlices returns which slices duplicate a slice of another track,
+// i.e. have the same timing, name and handles as an earlier slice on a
+// different track. Identical slices on the same track aren't duplicates.
+func duplicateSlices(d *SliceData) ([]bool, int) {
+	tracks := map[sliceKey]int64{}
+	dups, count := make([]bool, d.Len()), 0
+	for i := range d.Timestamps {
+		key := sliceKey{
+			ts:            d.Timestamps[i],
+			dur:           d.Durations[i],
+			depth:         d.Depths[i],
+			submission:    d.Submissions[i],
+			commandBuffer: d.CommandBuffers[i],
+			renderPass:    d.RenderPasses[i],
+			name:          d.Names[i],
+		}
+		if track, ok := tracks[key]; !ok {
+			tracks[key] = d.Tracks[i]
+		} else if track != d.Tracks[i] {
+			dups[i] = true
+			count++
+		}
+	}
+	return dups, count
+}
+
+// dropSlices removes the slices for which drop is true from all the columns
+// of the data.
+func (d *SliceData) dropSlices(drop []bool) {
+	int64s := func(col []int64) []int64 {
+		res := make([]int64, 0, len(col))
+		for i, v := range col {
+			if !drop[i] {
+				res = append(res, v)
+			}
+		}
+		return res
+	}
+	strs := func(col []string) []string {
+		res := make([]string, 0, len(col))
+		for i, v := range col {
+			if !drop[i] {
+				res = append(res, v)
+			}
+		}
+		return res
+	}
+	d.Contexts = int64s(d.Contexts)
+	d.RenderTargets = int64s(d.RenderTargets)
+	d.Frames = int64s(d.Frames)
+	d.Submissions = int64s(d.Submissions)
+	d.HardwareQueues = int64s(d.HardwareQueues)
+	d.CommandBuffers = int64s(d.CommandBuffers)
+	d.RenderPasses = int64s(d.RenderPasses)
+	d.Timestamps = int64s(d.Timestamps)
+	d.Durations = int64s(d.Durations)
+	d.SliceIds = int64s(d.SliceIds)
+	d.Names = strs(d.Names)
+	d.Depths = int64s(d.Depths)
+	d.ArgSets = int64s(d.ArgSets)
+	d.Tracks = int64s(d.Tracks)
+	d.TrackNames = strs(d.TrackNames)
+	d.Parents = int64s(d.Parents)
+}
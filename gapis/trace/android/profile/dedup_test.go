@@ -0,0 +1,124 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func duplicateCounters() []*service.ProfilingData_Counter {
+	return []*service.ProfilingData_Counter{
+		{Id: 1, Name: "ALU Busy", TrackIds: []uint32{1}, Timestamps: []uint64{10, 30}, Values: []float64{1, 3}},
+		{Id: 2, Name: "GPU Freq", TrackIds: []uint32{2}, Timestamps: []uint64{10}, Values: []float64{5}},
+		{Id: 3, Name: "ALU Busy", TrackIds: []uint32{3}, Timestamps: []uint64{20, 40}, Values: []float64{2, 4}},
+	}
+}
+
+func TestDedupCounters(t *testing.T) {
+	ctx := log.Testing(t)
+
+	got := dedupCounters(duplicateCounters(), service.CounterDedupPolicy_SuffixDuplicates)
+	assert.For(ctx, "suffix count").That(len(got)).Equals(3)
+	if len(got) == 3 {
+		assert.For(ctx, "suffix first").That(got[0].Name).Equals("ALU Busy (1)")
+		assert.For(ctx, "suffix unique").That(got[1].Name).Equals("GPU Freq")
+		assert.For(ctx, "suffix second").That(got[2].Name).Equals("ALU Busy (3)")
+	}
+
+	got = dedupCounters(duplicateCounters(), service.CounterDedupPolicy_KeepFirstDuplicate)
+	assert.For(ctx, "keep-first count").That(len(got)).Equals(2)
+	if len(got) == 2 {
+		assert.For(ctx, "keep-first id").That(got[0].Id).Equals(uint32(1))
+		assert.For(ctx, "keep-first name").That(got[0].Name).Equals("ALU Busy")
+		assert.For(ctx, "keep-first unique").That(got[1].Id).Equals(uint32(2))
+	}
+
+	got = dedupCounters(duplicateCounters(), service.CounterDedupPolicy_MergeDuplicates)
+	assert.For(ctx, "merge count").That(len(got)).Equals(2)
+	if len(got) == 2 {
+		assert.For(ctx, "merge id").That(got[0].Id).Equals(uint32(1))
+		assert.For(ctx, "merge tracks").ThatSlice(got[0].TrackIds).Equals([]uint32{1, 3})
+		assert.For(ctx, "merge timestamps").ThatSlice(got[0].Timestamps).Equals([]uint64{10, 20, 30, 40})
+		assert.For(ctx, "merge values").ThatSlice(got[0].Values).Equals([]float64{1, 2, 3, 4})
+		assert.For(ctx, "merge unique").That(got[1].Name).Equals("GPU Freq")
+	}
+}
+
+func TestDedupCountersPerGpu(t *testing.T) {
+	ctx := log.Testing(t)
+
+	counters := []*service.ProfilingData_Counter{
+		{Id: 1, Name: "ALU Busy", Gpu: 0},
+		{Id: 2, Name: "ALU Busy", Gpu: 1},
+	}
+	got := dedupCounters(counters, service.CounterDedupPolicy_KeepFirstDuplicate)
+	assert.For(ctx, "count").That(len(got)).Equals(2)
+	if len(got) == 2 {
+		assert.For(ctx, "first name").That(got[0].Name).Equals("ALU Busy")
+		assert.For(ctx, "second name").That(got[1].Name).Equals("ALU Busy")
+		assert.For(ctx, "second gpu").That(got[1].Gpu).Equals(uint32(1))
+	}
+}
+
+func TestCounterDedupPolicyContext(t *testing.T) {
+	ctx := log.Testing(t)
+
+	assert.For(ctx, "unset").That(GetCounterDedupPolicy(ctx)).Equals(service.CounterDedupPolicy_SuffixDuplicates)
+	ctx = PutCounterDedupPolicy(ctx, service.CounterDedupPolicy_MergeDuplicates)
+	assert.For(ctx, "set").That(GetCounterDedupPolicy(ctx)).Equals(service.CounterDedupPolicy_MergeDuplicates)
+}
+
+func TestDuplicateSlices(t *testing.T) {
+	ctx := log.Testing(t)
+
+	n := 5
+	data := &SliceData{
+		Contexts:       make([]int64, n),
+		RenderTargets:  make([]int64, n),
+		Frames:         make([]int64, n),
+		Submissions:    []int64{1, 1, 1, 2, 2},
+		HardwareQueues: make([]int64, n),
+		CommandBuffers: make([]int64, n),
+		RenderPasses:   make([]int64, n),
+		Timestamps:     []int64{10, 10, 20, 30, 30},
+		Durations:      []int64{5, 5, 5, 5, 5},
+		SliceIds:       []int64{1, 2, 3, 4, 5},
+		Names:          []string{"Render", "Render", "Render", "Blit", "Blit"},
+		Depths:         make([]int64, n),
+		ArgSets:        make([]int64, n),
+		// The last two slices are identical, but on the same track.
+		Tracks:     []int64{1, 2, 1, 1, 1},
+		TrackNames: []string{"a", "b", "a", "a", "a"},
+		Parents:    make([]int64, n),
+	}
+
+	dups, count := duplicateSlices(data)
+	assert.For(ctx, "count").That(count).Equals(1)
+	assert.For(ctx, "dups").ThatSlice(dups).Equals([]bool{false, true, false, false, false})
+
+	data.dropSlices(dups)
+	assert.For(ctx, "len").That(data.Len()).Equals(4)
+	assert.For(ctx, "ids").ThatSlice(data.SliceIds).Equals([]int64{1, 3, 4, 5})
+	assert.For(ctx, "names").ThatSlice(data.Names).Equals([]string{"Render", "Render", "Blit", "Blit"})
+	assert.For(ctx, "tracks").ThatSlice(data.Tracks).Equals([]int64{1, 1, 1, 1})
+
+	assert.For(ctx, "policy unset").That(GetSliceDedupPolicy(ctx)).Equals(service.SliceDedupPolicy_DropDuplicateSlices)
+	ctx = PutSliceDedupPolicy(ctx, service.SliceDedupPolicy_KeepDuplicateSlices)
+	assert.For(ctx, "policy set").That(GetSliceDedupPolicy(ctx)).Equals(service.SliceDedupPolicy_KeepDuplicateSlices)
+}
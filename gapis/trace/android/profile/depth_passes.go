@@ -0,0 +1,110 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// DepthPass is a render pass that only writes depth or stencil, as found by
+// the analysis of the commands of the capture.
+type DepthPass struct {
+	// The pixels of the render area of the pass.
+	Pixels uint64
+	// The primitives of the direct draws of the pass.
+	Primitives uint64
+}
+
+// ComputeDepthPasses sums up the cost of the depth-only render passes, by
+// group id, for each frame of the data and computes their per pixel metrics.
+// The GPU time of a pass is that of the top level slices of its group, and
+// the pass belongs to the frame of its first slice. The data's GPU idle time
+// should have been computed. Returns nil if none of the groups with slices
+// is a depth-only pass.
+func ComputeDepthPasses(data *service.ProfilingData, passes map[int32]DepthPass) *service.ProfilingData_DepthPasses {
+	if len(passes) == 0 {
+		return nil
+	}
+	gpuTime := map[int32]uint64{}
+	start := map[int32]uint64{}
+	for _, s := range data.GetSlices().GetSlices() {
+		if _, ok := passes[s.GroupId]; !ok || s.Depth != 0 {
+			continue
+		}
+		if ts, ok := start[s.GroupId]; !ok || s.Ts < ts {
+			start[s.GroupId] = s.Ts
+		}
+		gpuTime[s.GroupId] += s.Dur
+	}
+	if len(gpuTime) == 0 {
+		return nil
+	}
+
+	res := &service.ProfilingData_DepthPasses{}
+	idle := data.GetGpuIdle()
+	frames := map[int]*service.ProfilingData_DepthPasses_Frame{}
+	for _, group := range data.GetSlices().GetGroups() {
+		t, ok := gpuTime[group.Id]
+		if !ok {
+			continue
+		}
+		p := passes[group.Id]
+		pass := &service.ProfilingData_DepthPasses_Pass{
+			GroupId:    group.Id,
+			Name:       group.Name,
+			GpuTime:    t,
+			Pixels:     p.Pixels,
+			Primitives: p.Primitives,
+		}
+		if p.Pixels > 0 {
+			pass.PrimitivesPerPixel = float64(p.Primitives) / float64(p.Pixels)
+			pass.TimePerPixel = float64(t) / float64(p.Pixels)
+		}
+		res.Passes = append(res.Passes, pass)
+
+		f := frameOf(idle, start[group.Id])
+		if f < 0 {
+			continue
+		}
+		frame, ok := frames[f]
+		if !ok {
+			frame = &service.ProfilingData_DepthPasses_Frame{FrameId: idle.Frames[f].FrameId}
+			frames[f] = frame
+		}
+		frame.Passes++
+		frame.GpuTime += t
+	}
+	sort.SliceStable(res.Passes, func(i, j int) bool { return res.Passes[i].GpuTime > res.Passes[j].GpuTime })
+
+	for f, frame := range idle.GetFrames() {
+		depth, ok := frames[f]
+		if !ok {
+			continue
+		}
+		if busy := frame.Dur - frame.Idle; frame.Idle < frame.Dur {
+			depth.Share = float64(depth.GpuTime) / float64(busy)
+		}
+		res.Frames = append(res.Frames, depth)
+		res.MeanGpuTime += depth.GpuTime
+		res.MeanShare += depth.Share
+	}
+	if n := len(idle.GetFrames()); n > 0 {
+		res.MeanGpuTime /= uint64(n)
+		res.MeanShare /= float64(n)
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeDepthPasses(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Two frames with a shadow map and a main pass each. The GPU is idle for
+	// half of the first frame.
+	slice := func(ts, dur uint64, group int32) *service.ProfilingData_GpuSlices_Slice {
+		return &service.ProfilingData_GpuSlices_Slice{Ts: ts, Dur: dur, GroupId: group}
+	}
+	data := &service.ProfilingData{
+		GpuIdle: &service.ProfilingData_GpuIdle{
+			Frames: []*service.ProfilingData_GpuIdle_Frame{
+				{FrameId: 1, Ts: 0, Dur: 200, Idle: 100},
+				{FrameId: 2, Ts: 200, Dur: 100},
+			},
+		},
+		Slices: &service.ProfilingData_GpuSlices{
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1, Name: "Shadow"}, {Id: 2, Name: "Main"},
+				{Id: 3, Name: "Shadow"}, {Id: 4, Name: "Main"},
+			},
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				slice(0, 20, 1), slice(20, 5, 1), slice(25, 75, 2),
+				slice(200, 50, 3), slice(250, 50, 4),
+				{Ts: 200, Dur: 40, GroupId: 3, Depth: 1},
+			},
+		},
+	}
+	passes := map[int32]DepthPass{
+		1: {Pixels: 1000, Primitives: 500},
+		3: {Pixels: 1000, Primitives: 2000},
+	}
+
+	res := ComputeDepthPasses(data, passes)
+	if !assert.For(ctx, "passes").That(len(res.GetPasses())).Equals(2) {
+		return
+	}
+	shadow := res.Passes[0]
+	assert.For(ctx, "longest").That(shadow.GroupId).Equals(int32(3))
+	assert.For(ctx, "gpu time").That(shadow.GpuTime).Equals(uint64(50))
+	assert.For(ctx, "primitives per pixel").That(shadow.PrimitivesPerPixel).Equals(2.0)
+	assert.For(ctx, "time per pixel").That(shadow.TimePerPixel).Equals(0.05)
+	assert.For(ctx, "second").That(res.Passes[1].GpuTime).Equals(uint64(25))
+
+	if !assert.For(ctx, "frames").That(len(res.Frames)).Equals(2) {
+		return
+	}
+	assert.For(ctx, "frame 1").That(res.Frames[0].FrameId).Equals(int64(1))
+	assert.For(ctx, "frame 1 share").That(res.Frames[0].Share).Equals(0.25)
+	assert.For(ctx, "frame 2 share").That(res.Frames[1].Share).Equals(0.5)
+	assert.For(ctx, "mean gpu time").That(res.MeanGpuTime).Equals(uint64(37))
+	assert.For(ctx, "mean share").That(res.MeanShare).Equals(0.375)
+
+	assert.For(ctx, "no depth passes").That(ComputeDepthPasses(data, nil)).IsNil()
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// SampleCounters returns the counters selected by the sampling, with their
+// samples within its time range. The samples of the counters with more
+// samples than the buckets of the sampling are aggregated into as many
+// buckets of equal duration, of the minimum, maximum and average of their
+// samples. The counters are not modified. Returns the counters as is if the
+// sampling is nil.
+func SampleCounters(counters []*service.ProfilingData_Counter, sampling *service.CounterSampling) []*service.ProfilingData_Counter {
+	if sampling == nil {
+		return counters
+	}
+	selected := map[uint32]bool{}
+	for _, id := range sampling.CounterIds {
+		selected[id] = true
+	}
+
+	// The buckets of all the counters are aligned on the same range.
+	start, end := sampling.Start, sampling.End
+	if end == 0 {
+		for _, counter := range counters {
+			if n := len(counter.Timestamps); n > 0 && counter.Timestamps[n-1] > end {
+				end = counter.Timestamps[n-1]
+			}
+		}
+	}
+
+	res := []*service.ProfilingData_Counter{}
+	for _, counter := range counters {
+		if len(selected) > 0 && !selected[counter.Id] {
+			continue
+		}
+		res = append(res, sampleCounter(counter, start, end, int(sampling.Buckets)))
+	}
+	return res
+}
+
+// sampleCounter returns a copy of the counter with its samples within
+// [start, end], aggregated into buckets if it has more than buckets samples.
+func sampleCounter(counter *service.ProfilingData_Counter, start, end uint64, buckets int) *service.ProfilingData_Counter {
+	timestamps := counter.Timestamps
+	from := sort.Search(len(timestamps), func(i int) bool { return timestamps[i] >= start })
+	to := sort.Search(len(timestamps), func(i int) bool { return timestamps[i] > end })
+	if to < from {
+		to = from
+	}
+
+	res := &service.ProfilingData_Counter{
+		Id:           counter.Id,
+		Name:         counter.Name,
+		Description:  counter.Description,
+		Unit:         counter.Unit,
+		Default:      counter.Default,
+		Spec:         counter.Spec,
+		Aggregation:  counter.Aggregation,
+		TrackIds:     counter.TrackIds,
+		UnitInferred: counter.UnitInferred,
+		Unwrapped:    counter.Unwrapped,
+		Gpu:          counter.Gpu,
+		RawSamples:   uint32(to - from),
+	}
+	if buckets == 0 || to-from <= buckets {
+		res.Timestamps = timestamps[from:to]
+		res.Values = counter.Values[from:to]
+		return res
+	}
+
+	width := (end-start)/uint64(buckets) + 1
+	for i := from; i < to; {
+		bucket := (timestamps[i] - start) / width
+		bucketEnd := start + (bucket+1)*width
+		lo, hi, sum, n := math.Inf(1), math.Inf(-1), 0.0, 0
+		for ; i < to && timestamps[i] < bucketEnd; i++ {
+			v := counter.Values[i]
+			lo, hi, sum, n = math.Min(lo, v), math.Max(hi, v), sum+v, n+1
+		}
+		res.Timestamps = append(res.Timestamps, start+bucket*width)
+		res.Values = append(res.Values, sum/float64(n))
+		res.MinValues = append(res.MinValues, lo)
+		res.MaxValues = append(res.MaxValues, hi)
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSampleCounters(t *testing.T) {
+	ctx := log.Testing(t)
+	counters := []*service.ProfilingData_Counter{
+		{Id: 1, Name: "Busy", Unit: "%",
+			Timestamps: []uint64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90},
+			Values:     []float64{1, 3, 2, 8, 4, 4, 6, 0, 5, 7}},
+		{Id: 2, Name: "Frequency", Unit: "Hz",
+			Timestamps: []uint64{45, 90},
+			Values:     []float64{100, 200}},
+	}
+
+	same := SampleCounters(counters, nil)
+	assert.For(ctx, "nil sampling").That(len(same)).Equals(2)
+	assert.For(ctx, "nil sampling samples").ThatSlice(same[0].Values).Equals(counters[0].Values)
+
+	// The range [0, 90] is split into 3 buckets of 31ns.
+	res := SampleCounters(counters, &service.CounterSampling{Buckets: 3})
+	if !assert.For(ctx, "count").That(len(res)).Equals(2) {
+		return
+	}
+	busy := res[0]
+	assert.For(ctx, "name").That(busy.Name).Equals("Busy")
+	assert.For(ctx, "raw samples").That(busy.RawSamples).Equals(uint32(10))
+	assert.For(ctx, "timestamps").ThatSlice(busy.Timestamps).Equals([]uint64{0, 31, 62})
+	assert.For(ctx, "averages").ThatSlice(busy.Values).Equals([]float64{3.5, 14.0 / 3, 4})
+	assert.For(ctx, "minimums").ThatSlice(busy.MinValues).Equals([]float64{1, 4, 0})
+	assert.For(ctx, "maximums").ThatSlice(busy.MaxValues).Equals([]float64{8, 6, 7})
+	// Counters with fewer samples than buckets keep their raw samples.
+	freq := res[1]
+	assert.For(ctx, "raw timestamps").ThatSlice(freq.Timestamps).Equals([]uint64{45, 90})
+	assert.For(ctx, "raw min").That(len(freq.MinValues)).Equals(0)
+	// The counters are not modified.
+	assert.For(ctx, "unmodified").That(len(counters[0].Values)).Equals(10)
+
+	// Zooming in on the range of a bucket returns its raw samples.
+	res = SampleCounters(counters, &service.CounterSampling{Buckets: 3, Start: 31, End: 61, CounterIds: []uint32{1}})
+	if !assert.For(ctx, "zoom count").That(len(res)).Equals(1) {
+		return
+	}
+	assert.For(ctx, "zoom timestamps").ThatSlice(res[0].Timestamps).Equals([]uint64{40, 50, 60})
+	assert.For(ctx, "zoom values").ThatSlice(res[0].Values).Equals([]float64{4, 4, 6})
+	assert.For(ctx, "zoom raw samples").That(res[0].RawSamples).Equals(uint32(3))
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// drawHistogramBuckets is the number of buckets of the draw duration
+	// histogram of a group.
+	drawHistogramBuckets = 10
+	// drawOutlierRatio is the number of times the median duration a draw
+	// has to take to be an outlier.
+	drawOutlierRatio = 4.0
+	// maxDrawOutliers is the number of outliers listed per group.
+	maxDrawOutliers = 5
+)
+
+// ComputeDrawDurations computes the distribution of the durations of the
+// draw slices of each group, being the slices nested in another slice of the
+// group that have no nested slices themselves. The draws, if known, are the
+// draw commands of the render pass of each group, by group id, in recording
+// order. They are matched to the draw slices of a group in time order if
+// there are as many of both. Groups with fewer than two draw slices are
+// skipped.
+func ComputeDrawDurations(slices *service.ProfilingData_GpuSlices, draws map[int32][]api.SubCmdIdx) []*service.ProfilingData_DrawDurations {
+	parents := map[uint64]bool{}
+	for _, s := range slices.GetSlices() {
+		if s.ParentId != 0 {
+			parents[s.ParentId] = true
+		}
+	}
+	groupDraws := map[int32][]*service.ProfilingData_GpuSlices_Slice{}
+	for _, s := range slices.GetSlices() {
+		if s.Depth > 0 && s.GroupId >= 0 && !parents[s.Id] {
+			groupDraws[s.GroupId] = append(groupDraws[s.GroupId], s)
+		}
+	}
+
+	res := []*service.ProfilingData_DrawDurations{}
+	for _, group := range slices.GetGroups() {
+		if d := drawDurations(group, groupDraws[group.Id], draws[group.Id]); d != nil {
+			res = append(res, d)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Max > res[j].Max })
+	return res
+}
+
+// drawDurations computes the distribution of the durations of the draw
+// slices of the group. Returns nil if the group has fewer than two draws.
+func drawDurations(group *service.ProfilingData_GpuSlices_Group, slices []*service.ProfilingData_GpuSlices_Slice, cmds []api.SubCmdIdx) *service.ProfilingData_DrawDurations {
+	if len(slices) < 2 {
+		return nil
+	}
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].Ts < slices[j].Ts })
+	if len(cmds) != len(slices) {
+		cmds = nil
+	}
+
+	durs := make([]uint64, len(slices))
+	for i, s := range slices {
+		durs[i] = s.Dur
+	}
+	sort.Slice(durs, func(i, j int) bool { return durs[i] < durs[j] })
+	min, max := durs[0], durs[len(durs)-1]
+	res := &service.ProfilingData_DrawDurations{
+		GroupId: group.Id,
+		Name:    group.Name,
+		Draws:   uint32(len(slices)),
+		P50:     durs[(len(durs)-1)/2],
+		P90:     durs[(len(durs)-1)*9/10],
+		Max:     max,
+	}
+
+	size := (max - min + drawHistogramBuckets) / drawHistogramBuckets
+	res.Buckets = make([]*service.ProfilingData_DrawDurations_Bucket, drawHistogramBuckets)
+	for b := range res.Buckets {
+		res.Buckets[b] = &service.ProfilingData_DrawDurations_Bucket{From: min + uint64(b)*size}
+	}
+	for _, d := range durs {
+		res.Buckets[(d-min)/size].Draws++
+	}
+
+	if res.P50 == 0 {
+		return res
+	}
+	order := make([]int, len(slices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return slices[order[i]].Dur > slices[order[j]].Dur })
+	for _, i := range order {
+		ratio := float64(slices[i].Dur) / float64(res.P50)
+		if ratio < drawOutlierRatio || len(res.Outliers) == maxDrawOutliers {
+			break
+		}
+		outlier := &service.ProfilingData_DrawDurations_Outlier{
+			SliceId: slices[i].Id,
+			Label:   slices[i].Label,
+			Dur:     slices[i].Dur,
+			Ratio:   ratio,
+		}
+		if cmds != nil {
+			outlier.Command = cmds[i]
+		}
+		res.Outliers = append(res.Outliers, outlier)
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestDrawDurations(t *testing.T) {
+	ctx := log.Testing(t)
+	draw := func(id, parent uint64, depth int32, group int32, ts, dur uint64) *service.ProfilingData_GpuSlices_Slice {
+		return &service.ProfilingData_GpuSlices_Slice{Id: id, ParentId: parent, Depth: depth, GroupId: group, Ts: ts, Dur: dur, Label: "draw"}
+	}
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			draw(1, 0, 0, 1, 0, 200),
+			draw(2, 1, 1, 1, 10, 10),
+			draw(3, 1, 1, 1, 20, 10),
+			draw(4, 1, 1, 1, 30, 12),
+			draw(5, 1, 1, 1, 40, 10),
+			draw(6, 1, 1, 1, 50, 100),
+			// A marker with a nested draw.
+			draw(7, 1, 1, 1, 160, 20),
+			draw(8, 7, 2, 1, 160, 10),
+			// A pass with a single draw.
+			draw(9, 0, 0, 2, 300, 50),
+			draw(10, 9, 1, 2, 300, 50),
+		},
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Name: "pass"},
+			{Id: 2, Name: "single"},
+		},
+	}
+	cmds := []api.SubCmdIdx{}
+	for i := uint64(1); i <= 6; i++ {
+		cmds = append(cmds, api.SubCmdIdx{1, 0, 0, i})
+	}
+	res := ComputeDrawDurations(slices, map[int32][]api.SubCmdIdx{1: cmds})
+
+	assert.For(ctx, "groups").That(len(res)).Equals(1)
+	pass := res[0]
+	assert.For(ctx, "group").That(pass.GroupId).Equals(int32(1))
+	assert.For(ctx, "draws").That(pass.Draws).Equals(uint32(6))
+	assert.For(ctx, "p50").That(pass.P50).Equals(uint64(10))
+	assert.For(ctx, "p90").That(pass.P90).Equals(uint64(12))
+	assert.For(ctx, "max").That(pass.Max).Equals(uint64(100))
+	assert.For(ctx, "buckets").That(len(pass.Buckets)).Equals(drawHistogramBuckets)
+	assert.For(ctx, "first bucket").That(pass.Buckets[0].Draws).Equals(uint32(5))
+	assert.For(ctx, "last bucket").That(pass.Buckets[9].Draws).Equals(uint32(1))
+	assert.For(ctx, "last bucket from").That(pass.Buckets[9].From).Equals(uint64(100))
+
+	assert.For(ctx, "outliers").That(len(pass.Outliers)).Equals(1)
+	outlier := pass.Outliers[0]
+	assert.For(ctx, "outlier slice").That(outlier.SliceId).Equals(uint64(6))
+	assert.For(ctx, "outlier ratio").That(outlier.Ratio).Equals(10.0)
+	assert.For(ctx, "outlier command").ThatSlice(outlier.Command).Equals([]uint64{1, 0, 0, 5})
+
+	// The draws aren't matched to the commands if their numbers differ.
+	res = ComputeDrawDurations(slices, map[int32][]api.SubCmdIdx{1: cmds[:5]})
+	assert.For(ctx, "unmatched command").That(len(res[0].Outliers[0].Command)).Equals(0)
+}
@@ -0,0 +1,280 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// enginePass describes a rendering pass of a game engine, identified by the
+// prefix of the trace markers the engine emits for it.
+type enginePass struct {
+	engine service.ProfilingData_Engine_Kind
+	prefix string
+	name   string
+	// If the pass takes more than this share of the GPU time, advice is
+	// added to the recommendations.
+	threshold float64
+	advice    string
+}
+
+// sdkPassCategory is the track_event category of the markers with which the
+// app delimits its own rendering passes, see sdk/agi_markers.h.
+const sdkPassCategory = "agi.pass"
+
+var enginePasses = []enginePass{
+	{service.ProfilingData_Engine_Unity, "Camera.Render", "Camera", 0, ""},
+	{service.ProfilingData_Engine_Unity, "Shadows.RenderShadowMap", "Shadows", 0.2,
+		"consider reducing the shadow distance or the number of shadow cascades in the quality settings"},
+	{service.ProfilingData_Engine_Unity, "Render.OpaqueGeometry", "Opaque", 0, ""},
+	{service.ProfilingData_Engine_Unity, "Render.TransparentGeometry", "Transparent", 0.2,
+		"consider reducing the overdraw of transparent objects and particles"},
+	{service.ProfilingData_Engine_Unity, "Camera.ImageEffects", "PostProcessing", 0.25,
+		"consider disabling expensive image effects, such as bloom or depth of field, on mobile"},
+	{service.ProfilingData_Engine_Unity, "PostProcessing", "PostProcessing", 0.25,
+		"consider disabling expensive image effects, such as bloom or depth of field, on mobile"},
+	{service.ProfilingData_Engine_Unity, "UGUI.Rendering", "UI", 0.15,
+		"consider splitting static and dynamic UI elements into separate canvases"},
+
+	{service.ProfilingData_Engine_Unreal, "MobileBasePass", "BasePass", 0, ""},
+	{service.ProfilingData_Engine_Unreal, "BasePass", "BasePass", 0, ""},
+	{service.ProfilingData_Engine_Unreal, "PrePass", "PrePass", 0, ""},
+	{service.ProfilingData_Engine_Unreal, "ShadowDepths", "Shadows", 0.2,
+		"consider lowering r.Shadow.CSM.MaxCascades or r.Shadow.MaxResolution"},
+	{service.ProfilingData_Engine_Unreal, "Translucency", "Translucency", 0.2,
+		"consider reducing the overdraw of translucent materials and particles"},
+	{service.ProfilingData_Engine_Unreal, "PostProcessing", "PostProcessing", 0.25,
+		"consider disabling expensive post processing features, such as bloom, or lowering r.PostProcessAAQuality"},
+	{service.ProfilingData_Engine_Unreal, "SlateUI", "UI", 0.15,
+		"consider invalidation boxes or retainer widgets for static UI"},
+}
+
+// ProcessEngine detects the game engine that emitted the trace markers, or
+// the debug labels of the GPU work, and groups the GPU work by the engine's
+// rendering passes. If the app delimited its passes with the in-app SDK
+// markers, these are used instead, named by their labels. Returns nil if
+// neither was found.
+//
+// The GPU time of a pass is that of the render passes within its command
+// range, i.e. of the slice groups with the pass among their debug labels. The
+// passes without any labeled render pass are attributed the submissions
+// issued while their markers were active.
+func ProcessEngine(markers *service.ProfilingData_Markers, slices *service.ProfilingData_GpuSlices, gpuCounters *service.ProfilingData_GpuCounters) *service.ProfilingData_Engine {
+	kind := detectEngine(markers, slices)
+	if kind == service.ProfilingData_Engine_Unknown {
+		return nil
+	}
+
+	gpuTimes := map[int32]uint64{}
+	for _, entry := range gpuCounters.GetEntries() {
+		if perf, ok := entry.MetricToValue[gpuTimeMetricId]; ok {
+			gpuTimes[entry.GroupId] = uint64(perf.Estimate)
+		}
+	}
+	total := uint64(0)
+	for _, group := range slices.GetGroups() {
+		if group.ParentId == 0 {
+			total += gpuTimes[group.Id]
+		}
+	}
+
+	res := &service.ProfilingData_Engine{Kind: kind}
+	passes := map[string]*service.ProfilingData_Engine_Pass{}
+	specs := map[string]*enginePass{}
+	submitted := map[string][]int32{}
+	addPass := func(name string, spec *enginePass) *service.ProfilingData_Engine_Pass {
+		pass, ok := passes[name]
+		if !ok {
+			pass = &service.ProfilingData_Engine_Pass{Name: name}
+			passes[name] = pass
+			specs[name] = spec
+			res.Passes = append(res.Passes, pass)
+		}
+		return pass
+	}
+	sdkPasses := map[string]bool{}
+	for _, marker := range markers.GetMarkers() {
+		name, spec := markerPass(kind, marker)
+		if name == "" {
+			continue
+		}
+		addPass(name, spec).Count++
+		submitted[name] = append(submitted[name], marker.GroupIds...)
+		if kind == service.ProfilingData_Engine_App {
+			sdkPasses[name] = true
+		}
+	}
+
+	labeled := map[string][]int32{}
+	for _, pl := range labeledPassGroups(kind, slices, sdkPasses) {
+		pass := addPass(pl.name, pl.spec)
+		if len(submitted[pl.name]) == 0 {
+			// Passes only found in the debug labels, e.g. of a replay, count
+			// their render passes.
+			pass.Count++
+		}
+		labeled[pl.name] = append(labeled[pl.name], pl.group)
+	}
+
+	for _, pass := range res.Passes {
+		groups := labeled[pass.Name]
+		if len(groups) == 0 {
+			groups = submitted[pass.Name]
+		}
+		seen := map[int32]bool{}
+		for _, group := range groups {
+			if !seen[group] {
+				seen[group] = true
+				pass.GroupIds = append(pass.GroupIds, group)
+				pass.GpuTime += gpuTimes[group]
+			}
+		}
+	}
+
+	if total > 0 {
+		for _, pass := range res.Passes {
+			spec := specs[pass.Name]
+			if spec == nil {
+				continue
+			}
+			if share := float64(pass.GpuTime) / float64(total); spec.advice != "" && share > spec.threshold {
+				res.Recommendations = append(res.Recommendations,
+					fmt.Sprintf("%v takes %.0f%% of the GPU time, %v.", pass.Name, 100*share, spec.advice))
+			}
+		}
+	}
+	return res
+}
+
+// passLabel is a slice group within the command range of a pass.
+type passLabel struct {
+	name  string
+	spec  *enginePass
+	group int32
+}
+
+// labeledPassGroups returns the slice groups with the passes of the engine, or
+// the SDK passes, among their debug labels, in the order of the groups. A
+// group is omitted if one of its ancestors already has the same pass, such
+// that the GPU time of the pass is only counted once.
+func labeledPassGroups(kind service.ProfilingData_Engine_Kind, slices *service.ProfilingData_GpuSlices, sdkPasses map[string]bool) []passLabel {
+	groups := slices.GetGroups()
+	parents := map[int32]int32{}
+	for _, group := range groups {
+		parents[group.Id] = group.ParentId
+	}
+	has := map[int32]map[string]bool{}
+	hasAncestor := func(group int32, name string) bool {
+		for p := parents[group]; p != 0; p = parents[p] {
+			if has[p][name] {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := []passLabel{}
+	for _, group := range groups {
+		for _, label := range groupLabels(group.Name) {
+			name, spec := label, (*enginePass)(nil)
+			if kind == service.ProfilingData_Engine_App {
+				if !sdkPasses[label] {
+					continue
+				}
+			} else if spec = enginePassOf(kind, label); spec != nil {
+				name = spec.name
+			} else {
+				continue
+			}
+			if has[group.Id][name] {
+				continue
+			}
+			if has[group.Id] == nil {
+				has[group.Id] = map[string]bool{}
+			}
+			has[group.Id][name] = true
+			if !hasAncestor(group.Id, name) {
+				res = append(res, passLabel{name, spec, group.Id})
+			}
+		}
+	}
+	return res
+}
+
+// detectEngine returns the kind of the passes of the markers: App if any of
+// the markers is an in-app SDK pass, otherwise the engine with the most
+// markers and debug labels of the slice groups matching its passes.
+func detectEngine(markers *service.ProfilingData_Markers, slices *service.ProfilingData_GpuSlices) service.ProfilingData_Engine_Kind {
+	// Each marker and label votes for all the engines it has a matching pass
+	// of.
+	votes := map[service.ProfilingData_Engine_Kind]int{}
+	vote := func(label string) {
+		voted := map[service.ProfilingData_Engine_Kind]bool{}
+		for _, pass := range enginePasses {
+			if !voted[pass.engine] && strings.HasPrefix(label, pass.prefix) {
+				voted[pass.engine] = true
+				votes[pass.engine]++
+			}
+		}
+	}
+	for _, marker := range markers.GetMarkers() {
+		if marker.Category == sdkPassCategory {
+			return service.ProfilingData_Engine_App
+		}
+		vote(marker.Label)
+	}
+	for _, group := range slices.GetGroups() {
+		for _, label := range groupLabels(group.Name) {
+			vote(label)
+		}
+	}
+	kind, best := service.ProfilingData_Engine_Unknown, 0
+	for k, v := range votes {
+		if v > best || (v == best && k < kind) {
+			kind, best = k, v
+		}
+	}
+	return kind
+}
+
+// markerPass returns the name of the pass of the marker, and the engine pass
+// it matches, if any. The SDK passes are named by their label and match no
+// engine pass. Returns an empty name if the marker is not a pass.
+func markerPass(kind service.ProfilingData_Engine_Kind, marker *service.ProfilingData_Markers_Marker) (string, *enginePass) {
+	if kind == service.ProfilingData_Engine_App {
+		if marker.Category != sdkPassCategory {
+			return "", nil
+		}
+		return marker.Label, nil
+	}
+	if spec := enginePassOf(kind, marker.Label); spec != nil {
+		return spec.name, spec
+	}
+	return "", nil
+}
+
+// enginePassOf returns the pass of the engine matching the marker label, or
+// nil if there is none.
+func enginePassOf(engine service.ProfilingData_Engine_Kind, label string) *enginePass {
+	for i := range enginePasses {
+		if pass := &enginePasses[i]; pass.engine == engine && strings.HasPrefix(label, pass.prefix) {
+			return pass
+		}
+	}
+	return nil
+}
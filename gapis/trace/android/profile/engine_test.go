@@ -0,0 +1,143 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestProcessEngine(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slices := &service.ProfilingData_GpuSlices{}
+	counters := &service.ProfilingData_GpuCounters{}
+	for i, gpuTime := range []float64{60, 30, 10} {
+		id := int32(i + 1)
+		slices.Groups = append(slices.Groups, &service.ProfilingData_GpuSlices_Group{Id: id})
+		counters.Entries = append(counters.Entries, &service.ProfilingData_GpuCounters_Entry{
+			GroupId: id,
+			MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+				gpuTimeMetricId: {Estimate: gpuTime},
+			},
+		})
+	}
+	marker := func(label string, groups ...int32) *service.ProfilingData_Markers_Marker {
+		return &service.ProfilingData_Markers_Marker{Label: label, GroupIds: groups}
+	}
+
+	assert.For(ctx, "no engine").That(ProcessEngine(&service.ProfilingData_Markers{
+		Markers: []*service.ProfilingData_Markers_Marker{marker("Choreographer#doFrame", 1)},
+	}, slices, counters) == nil).Equals(true)
+
+	got := ProcessEngine(&service.ProfilingData_Markers{
+		Markers: []*service.ProfilingData_Markers_Marker{
+			marker("FRenderingThread"),
+			marker("ShadowDepths", 1),
+			marker("MobileBasePass", 2),
+			marker("PostProcessing", 3),
+			marker("ShadowDepths", 1),
+		},
+	}, slices, counters)
+	assert.For(ctx, "kind").That(got.Kind).Equals(service.ProfilingData_Engine_Unreal)
+	assert.For(ctx, "passes").That(len(got.Passes)).Equals(3)
+
+	shadows := got.Passes[0]
+	assert.For(ctx, "name").That(shadows.Name).Equals("Shadows")
+	assert.For(ctx, "count").That(shadows.Count).Equals(int32(2))
+	assert.For(ctx, "groups").ThatSlice(shadows.GroupIds).Equals([]int32{1})
+	assert.For(ctx, "gpu time").That(shadows.GpuTime).Equals(uint64(60))
+
+	// Only the shadows exceed their threshold.
+	assert.For(ctx, "recommendations").That(len(got.Recommendations)).Equals(1)
+
+	// The in-app SDK passes take precedence over the engine markers.
+	sdkMarker := func(label string, groups ...int32) *service.ProfilingData_Markers_Marker {
+		m := marker(label, groups...)
+		m.Category = sdkPassCategory
+		return m
+	}
+	got = ProcessEngine(&service.ProfilingData_Markers{
+		Markers: []*service.ProfilingData_Markers_Marker{
+			marker("ShadowDepths", 1),
+			sdkMarker("Terrain", 1, 2),
+			sdkMarker("Water", 3),
+			sdkMarker("Terrain", 2),
+		},
+	}, slices, counters)
+	assert.For(ctx, "sdk kind").That(got.Kind).Equals(service.ProfilingData_Engine_App)
+	if assert.For(ctx, "sdk passes").That(len(got.Passes)).Equals(2) {
+		terrain := got.Passes[0]
+		assert.For(ctx, "sdk name").That(terrain.Name).Equals("Terrain")
+		assert.For(ctx, "sdk count").That(terrain.Count).Equals(int32(2))
+		assert.For(ctx, "sdk groups").ThatSlice(terrain.GroupIds).Equals([]int32{1, 2})
+		assert.For(ctx, "sdk gpu time").That(terrain.GpuTime).Equals(uint64(90))
+	}
+	assert.For(ctx, "sdk recommendations").That(len(got.Recommendations)).Equals(0)
+}
+
+func TestProcessEngineCommandRanges(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// The render passes of a submission, with the debug labels of an Unreal
+	// replay. The nested shadow pass is already counted by its parent.
+	slices := &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Name: "vkQueueSubmit"},
+			{Id: 2, ParentId: 1, Name: "ShadowDepths: vkCmdDraw (RenderPass 1, RenderTarget 2)"},
+			{Id: 3, ParentId: 2, Name: "ShadowDepths / Cascade: vkCmdDraw (RenderPass 2, RenderTarget 2)"},
+			{Id: 4, ParentId: 1, Name: "MobileBasePass: vkCmdDraw (RenderPass 3, RenderTarget 4)"},
+		},
+	}
+	counters := &service.ProfilingData_GpuCounters{}
+	for id, gpuTime := range map[int32]float64{1: 100, 2: 50, 3: 20, 4: 40} {
+		counters.Entries = append(counters.Entries, &service.ProfilingData_GpuCounters_Entry{
+			GroupId: id,
+			MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+				gpuTimeMetricId: {Estimate: gpuTime},
+			},
+		})
+	}
+
+	for _, test := range []struct {
+		name    string
+		markers []*service.ProfilingData_Markers_Marker
+	}{
+		{"labels", nil},
+		// The submission of the marker also holds the base pass, which is
+		// not attributed to the shadows.
+		{"markers", []*service.ProfilingData_Markers_Marker{{Label: "ShadowDepths", GroupIds: []int32{1}}}},
+	} {
+		got := ProcessEngine(&service.ProfilingData_Markers{Markers: test.markers}, slices, counters)
+		if !assert.For(ctx, "%v kind", test.name).That(got.GetKind()).Equals(service.ProfilingData_Engine_Unreal) {
+			continue
+		}
+		if !assert.For(ctx, "%v passes", test.name).That(len(got.Passes)).Equals(2) {
+			continue
+		}
+		shadows, base := got.Passes[0], got.Passes[1]
+		assert.For(ctx, "%v shadows", test.name).That(shadows.Name).Equals("Shadows")
+		assert.For(ctx, "%v shadows count", test.name).That(shadows.Count).Equals(int32(1))
+		assert.For(ctx, "%v shadows groups", test.name).ThatSlice(shadows.GroupIds).Equals([]int32{2})
+		assert.For(ctx, "%v shadows gpu time", test.name).That(shadows.GpuTime).Equals(uint64(50))
+		assert.For(ctx, "%v base", test.name).That(base.Name).Equals("BasePass")
+		assert.For(ctx, "%v base groups", test.name).ThatSlice(base.GroupIds).Equals([]int32{4})
+		assert.For(ctx, "%v base gpu time", test.name).That(base.GpuTime).Equals(uint64(40))
+		assert.For(ctx, "%v recommendations", test.name).That(len(got.Recommendations)).Equals(1)
+	}
+}
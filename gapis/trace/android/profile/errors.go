@@ -0,0 +1,95 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+const errorPolicyKey = contextKey("errorPolicy")
+
+// PutErrorPolicy attaches the handling of the errors of the sections of the
+// profiling data to the context.
+func PutErrorPolicy(ctx context.Context, policy service.ProfilingErrorPolicy) context.Context {
+	return keys.WithValue(ctx, errorPolicyKey, policy)
+}
+
+// GetErrorPolicy returns the policy attached to the context by
+// PutErrorPolicy, defaulting to ContinueOnError.
+func GetErrorPolicy(ctx context.Context) service.ProfilingErrorPolicy {
+	val, _ := ctx.Value(errorPolicyKey).(service.ProfilingErrorPolicy)
+	return val
+}
+
+// SectionError is the error returned for a failed section of the profiling
+// data under the FailOnError policy.
+type SectionError struct {
+	Section service.ProfilingData_SectionError_Section
+	Msg     string
+	Err     error
+}
+
+func (e *SectionError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Msg, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *SectionError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the cause of the error, such that service.NewError finds the
+// *service.ErrProfiling of a failed section.
+func (e *SectionError) Cause() error {
+	return e.Err
+}
+
+// SectionErrors collects the errors of the sections of the profiling data
+// that failed to be processed, such that clients can tell a missing section
+// apart from an empty one.
+type SectionErrors []*service.ProfilingData_SectionError
+
+// Add records err as the error of section, if err is not nil, handling it
+// according to the error policy of the context. Under the FailOnError policy
+// the error is returned as a *SectionError, and processing must stop. Under
+// the other policies nil is returned, and the error is logged unless the
+// policy is QuietOnError.
+func (e *SectionErrors) Add(ctx context.Context, section service.ProfilingData_SectionError_Section, err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	policy := GetErrorPolicy(ctx)
+	if policy == service.ProfilingErrorPolicy_FailOnError {
+		return &SectionError{Section: section, Msg: msg, Err: err}
+	}
+	if policy != service.ProfilingErrorPolicy_QuietOnError {
+		log.Err(ctx, err, msg)
+	}
+	res := &service.ProfilingData_SectionError{
+		Section: section,
+		Error:   fmt.Sprintf("%v: %v", msg, err),
+	}
+	if perr := AsProfilingError(err); perr != nil {
+		res.Code = perr.Code
+		res.Remediation = perr.Remediation
+	}
+	*e = append(*e, res)
+	return nil
+}
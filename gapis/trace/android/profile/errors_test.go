@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSectionErrorsPolicy(t *testing.T) {
+	ctx := log.Testing(t)
+	failure := errors.New("no such table")
+
+	for _, policy := range []service.ProfilingErrorPolicy{
+		service.ProfilingErrorPolicy_ContinueOnError,
+		service.ProfilingErrorPolicy_QuietOnError,
+	} {
+		ctx := PutErrorPolicy(ctx, policy)
+		errs := SectionErrors{}
+		assert.For(ctx, "%v nil", policy).ThatError(errs.Add(ctx, service.ProfilingData_SectionError_Markers, nil, "Failed")).Succeeded()
+		assert.For(ctx, "%v error", policy).ThatError(errs.Add(ctx, service.ProfilingData_SectionError_Markers, failure, "Failed")).Succeeded()
+		assert.For(ctx, "%v recorded", policy).That(len(errs)).Equals(1)
+		assert.For(ctx, "%v message", policy).That(errs[0].Error).Equals("Failed: no such table")
+	}
+
+	ctx = PutErrorPolicy(ctx, service.ProfilingErrorPolicy_FailOnError)
+	errs := SectionErrors{}
+	err := errs.Add(ctx, service.ProfilingData_SectionError_GpuIdle, failure, "Failed")
+	assert.For(ctx, "fail error").ThatError(err).HasMessage("Failed: no such table")
+	var sectionErr *SectionError
+	assert.For(ctx, "fail typed").That(errors.As(err, &sectionErr)).Equals(true)
+	assert.For(ctx, "fail section").That(sectionErr.Section).Equals(service.ProfilingData_SectionError_GpuIdle)
+	assert.For(ctx, "fail cause").That(errors.Is(err, failure)).Equals(true)
+	assert.For(ctx, "fail not recorded").That(len(errs)).Equals(0)
+}
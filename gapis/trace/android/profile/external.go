@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+// ProcessExternalProfilingData processes a Perfetto trace that was captured
+// without an accompanying graphics capture, e.g. with the perfetto command
+// line tool. As there are no commands to attribute the slices to, the slices
+// are grouped by their submission and command buffer only, and the groups do
+// not link to any commands.
+func ProcessExternalProfilingData(ctx context.Context, processor perfetto.Querier) (*service.ProfilingData, error) {
+	sliceData, err := ExtractSliceData(ctx, processor)
+	if err != nil {
+		return nil, log.Errf(ctx, err, "Extracting slice data failed")
+	}
+	if err := AssignFrames(ctx, processor, sliceData, DefaultFrameBoundaries...); err != nil {
+		return nil, err
+	}
+
+	submissions := map[int64]uint64{}
+	commandBuffers := map[int64]map[int64]uint64{}
+	for i, submission := range sliceData.Submissions {
+		sub, ok := submissions[submission]
+		if !ok {
+			sub = uint64(len(submissions))
+			submissions[submission] = sub
+			commandBuffers[submission] = map[int64]uint64{}
+		}
+		cbs := commandBuffers[submission]
+		cb, ok := cbs[sliceData.CommandBuffers[i]]
+		if !ok {
+			cb = uint64(len(cbs))
+			cbs[sliceData.CommandBuffers[i]] = cb
+		}
+		idx := api.SubCmdIdx{sub, 0, cb}
+		sliceData.GroupIds[i] = sliceData.CreateOrGetGroup(
+			fmt.Sprintf("Submission %v, CommandBuffer %v", submission, uint64(sliceData.CommandBuffers[i])),
+			sync.SubCmdRange{From: idx, To: idx},
+		)
+	}
+
+	errs := SectionErrors{}
+	slices := sliceData.ToService(ctx, processor, nil)
+	counters, _, err := ProcessCounters(ctx, processor, nil)
+	if err := errs.Add(ctx, service.ProfilingData_SectionError_Counters, err, "Failed to get GPU counters"); err != nil {
+		return nil, err
+	}
+	return Analyze(ctx, processor, Extraction{Slices: slices, Counters: counters}, errs)
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+// ComputeFrameCounters segments the counter samples into the frames between
+// consecutive presentations, and averages the samples of each counter within
+// each frame. Returns nil if the trace has fewer than two presentations.
+func ComputeFrameCounters(ctx context.Context, processor perfetto.Querier, counters []*service.ProfilingData_Counter) (*service.ProfilingData_FrameCounters, error) {
+	events, err := queryVulkanEvents(ctx, processor)
+	if err != nil {
+		return nil, err
+	}
+	return frameCounters(events.presents, counters), nil
+}
+
+// frameCounters averages the samples of the counters within the frames
+// delimited by the sorted presentations. The frame ending at presents[i] is
+// numbered i+1, as in framesByPresents.
+func frameCounters(presents []uint64, counters []*service.ProfilingData_Counter) *service.ProfilingData_FrameCounters {
+	if len(presents) < 2 {
+		return nil
+	}
+	res := &service.ProfilingData_FrameCounters{}
+	for i := 1; i < len(presents); i++ {
+		res.Frames = append(res.Frames, &service.ProfilingData_FrameCounters_Frame{
+			FrameId: int64(i + 1),
+			Start:   presents[i-1],
+			End:     presents[i],
+		})
+	}
+	for _, c := range counters {
+		// The first sample at or after the start of the frame.
+		first := 0
+		for _, frame := range res.Frames {
+			first += sort.Search(len(c.Timestamps)-first, func(i int) bool { return c.Timestamps[first+i] >= frame.Start })
+			sum, n := 0.0, 0
+			for first+n < len(c.Timestamps) && c.Timestamps[first+n] < frame.End {
+				sum += c.Values[first+n]
+				n++
+			}
+			if n > 0 {
+				frame.Values = append(frame.Values, &service.ProfilingData_FrameCounters_Value{
+					CounterId: c.Id,
+					Average:   sum / float64(n),
+					Samples:   uint32(n),
+				})
+			}
+		}
+	}
+	return res
+}
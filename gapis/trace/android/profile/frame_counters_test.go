@@ -0,0 +1,50 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestFrameCounters(t *testing.T) {
+	ctx := log.Testing(t)
+	counters := []*service.ProfilingData_Counter{
+		{Id: 1, Timestamps: []uint64{5, 12, 18, 25, 31}, Values: []float64{1, 2, 4, 6, 8}},
+		{Id: 2, Timestamps: []uint64{21}, Values: []float64{7}},
+	}
+	res := frameCounters([]uint64{10, 20, 30}, counters)
+
+	assert.For(ctx, "frames").That(len(res.Frames)).Equals(2)
+	first, second := res.Frames[0], res.Frames[1]
+	assert.For(ctx, "first id").That(first.FrameId).Equals(int64(2))
+	assert.For(ctx, "first start").That(first.Start).Equals(uint64(10))
+	assert.For(ctx, "first end").That(first.End).Equals(uint64(20))
+	assert.For(ctx, "first values").That(len(first.Values)).Equals(1)
+	assert.For(ctx, "first average").That(first.Values[0].Average).Equals(3.0)
+	assert.For(ctx, "first samples").That(first.Values[0].Samples).Equals(uint32(2))
+
+	assert.For(ctx, "second id").That(second.FrameId).Equals(int64(3))
+	assert.For(ctx, "second values").That(len(second.Values)).Equals(2)
+	assert.For(ctx, "second counter").That(second.Values[0].CounterId).Equals(uint32(1))
+	assert.For(ctx, "second average").That(second.Values[0].Average).Equals(6.0)
+	assert.For(ctx, "second other").That(second.Values[1].CounterId).Equals(uint32(2))
+	assert.For(ctx, "second other average").That(second.Values[1].Average).Equals(7.0)
+
+	assert.For(ctx, "single present").That(frameCounters([]uint64{10}, counters)).IsNil()
+}
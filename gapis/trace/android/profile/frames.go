@@ -0,0 +1,54 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// SelectFrames picks the frames representative of the trace, based on the
+// time the GPU was busy in each frame: the median, the 95th percentile and
+// the worst frame. Returns nil if there are no frames.
+func SelectFrames(gpuIdle *service.ProfilingData_GpuIdle) *service.ProfilingData_FrameSelection {
+	frames := append([]*service.ProfilingData_GpuIdle_Frame{}, gpuIdle.GetFrames()...)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	busy := func(f *service.ProfilingData_GpuIdle_Frame) uint64 { return f.Dur - f.Idle }
+	sort.SliceStable(frames, func(i, j int) bool { return busy(frames[i]) < busy(frames[j]) })
+
+	n := len(frames)
+	res := &service.ProfilingData_FrameSelection{}
+	for _, sel := range []struct {
+		kind service.ProfilingData_FrameSelection_Kind
+		idx  int
+	}{
+		{service.ProfilingData_FrameSelection_Median, (n - 1) / 2},
+		{service.ProfilingData_FrameSelection_Percentile95, int(math.Ceil(0.95*float64(n))) - 1},
+		{service.ProfilingData_FrameSelection_Worst, n - 1},
+	} {
+		frame := frames[sel.idx]
+		res.Frames = append(res.Frames, &service.ProfilingData_FrameSelection_Frame{
+			Kind:    sel.kind,
+			FrameId: frame.FrameId,
+			Busy:    busy(frame),
+		})
+	}
+	return res
+}
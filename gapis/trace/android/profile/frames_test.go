@@ -0,0 +1,57 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSelectFrames(t *testing.T) {
+	ctx := log.Testing(t)
+
+	assert.For(ctx, "no frames").That(SelectFrames(nil) == nil).Equals(true)
+
+	idle := &service.ProfilingData_GpuIdle{}
+	// Frame i is busy for (i * 7 % 20) + 1 ms, giving busy times 1..20ms.
+	for i := 0; i < 20; i++ {
+		busy := uint64(i*7%20+1) * 1e6
+		idle.Frames = append(idle.Frames, &service.ProfilingData_GpuIdle_Frame{
+			FrameId: int64(i),
+			Dur:     busy + 5e6,
+			Idle:    5e6,
+		})
+	}
+
+	got := SelectFrames(idle)
+	expected := []struct {
+		kind service.ProfilingData_FrameSelection_Kind
+		busy uint64
+	}{
+		{service.ProfilingData_FrameSelection_Median, 10e6},
+		{service.ProfilingData_FrameSelection_Percentile95, 19e6},
+		{service.ProfilingData_FrameSelection_Worst, 20e6},
+	}
+	assert.For(ctx, "frames").That(len(got.Frames)).Equals(len(expected))
+	for i, e := range expected {
+		f := got.Frames[i]
+		assert.For(ctx, "kind").That(f.Kind).Equals(e.kind)
+		assert.For(ctx, "busy").That(f.Busy).Equals(e.busy)
+		assert.For(ctx, "frame").That(uint64(f.FrameId*7%20+1) * 1e6).Equals(e.busy)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+type contextKey string
+
+const recordQueriesKey = contextKey("recordQueries")
+
+// goldenTolerance is the relative difference allowed between a golden and a
+// recomputed counter value. The aggregation order of the samples is not
+// deterministic, so the values may differ by rounding errors.
+const goldenTolerance = 1e-9
+
+// PutRecordQueries marks the context such that the trace processor queries
+// run while processing the profiling data are recorded into the data.
+func PutRecordQueries(ctx context.Context) context.Context {
+	return keys.WithValue(ctx, recordQueriesKey, true)
+}
+
+// ShouldRecordQueries returns whether the context was marked by
+// PutRecordQueries.
+func ShouldRecordQueries(ctx context.Context) bool {
+	val, _ := ctx.Value(recordQueriesKey).(bool)
+	return val
+}
+
+// WithQueryRecording calls process with the given processor. If the context
+// was marked by PutRecordQueries, the queries run by process, and their
+// results, are added to the returned profiling data.
+func WithQueryRecording(ctx context.Context, processor perfetto.Querier, process func(perfetto.Querier) (*service.ProfilingData, error)) (*service.ProfilingData, error) {
+	if !ShouldRecordQueries(ctx) {
+		return process(processor)
+	}
+
+	recorder := perfetto.NewQueryRecorder(processor)
+	data, err := process(recorder)
+	if err != nil {
+		return nil, err
+	}
+	recorder.Recorded(func(q string, res *perfetto_service.QueryResult) {
+		data.RecordedQueries = append(data.RecordedQueries, &service.ProfilingData_RecordedQuery{
+			Query:  q,
+			Result: res,
+		})
+	})
+	return data, nil
+}
+
+// ReplayGolden recomputes the GPU counters of the golden from its recorded
+// query results and slices.
+func ReplayGolden(ctx context.Context, golden *service.ProfilingGolden) (*service.ProfilingData_GpuCounters, error) {
+	player := perfetto.QueryPlayer{}
+	for _, q := range golden.GetProfilingData().GetRecordedQueries() {
+		player[q.Query] = q.Result
+	}
+	counters, _, err := ProcessCounters(ctx, player, golden.GetGpuCounterDescriptor())
+	if err != nil {
+		return nil, err
+	}
+	return ComputeCounters(ctx, golden.GetProfilingData().GetSlices(), counters)
+}
+
+// CheckGolden recomputes the GPU counters of the golden and returns an error
+// describing the first difference to the recorded counters, if any.
+func CheckGolden(ctx context.Context, golden *service.ProfilingGolden) error {
+	got, err := ReplayGolden(ctx, golden)
+	if err != nil {
+		return err
+	}
+	expected := golden.GetProfilingData().GetGpuCounters()
+
+	if len(got.Metrics) != len(expected.GetMetrics()) {
+		return fmt.Errorf("Got %d metrics, expected %d", len(got.Metrics), len(expected.GetMetrics()))
+	}
+	for i, metric := range expected.GetMetrics() {
+		if g := got.Metrics[i]; g.Id != metric.Id || g.Name != metric.Name || g.Op != metric.Op {
+			return fmt.Errorf("Got metric %v, expected %v", g, metric)
+		}
+	}
+
+	entries := map[int32]*service.ProfilingData_GpuCounters_Entry{}
+	for _, entry := range got.Entries {
+		entries[entry.GroupId] = entry
+	}
+	if len(entries) != len(expected.GetEntries()) {
+		return fmt.Errorf("Got %d entries, expected %d", len(entries), len(expected.GetEntries()))
+	}
+	for _, entry := range expected.GetEntries() {
+		g, ok := entries[entry.GroupId]
+		if !ok {
+			return fmt.Errorf("Missing entry for group %d", entry.GroupId)
+		}
+		for metric, perf := range entry.MetricToValue {
+			gp, ok := g.MetricToValue[metric]
+			switch {
+			case !ok:
+				return fmt.Errorf("Missing metric %d for group %d", metric, entry.GroupId)
+			case !goldenEqual(gp.Estimate, perf.Estimate) || !goldenEqual(gp.Min, perf.Min) || !goldenEqual(gp.Max, perf.Max):
+				return fmt.Errorf("Got %v for metric %d of group %d, expected %v", gp, metric, entry.GroupId, perf)
+			}
+		}
+	}
+	return nil
+}
+
+func goldenEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) <= goldenTolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+// syntheticGolden returns a golden recorded from a trace with a counter
+// sampled over the slices of two groups, as "gapit internal gen-goldens"
+// records it, read back from its serialized form.
+func syntheticGolden(ctx context.Context) *service.ProfilingGolden {
+	longs := func(v ...int64) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{LongValues: v}
+	}
+	doubles := func(v ...float64) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{DoubleValues: v}
+	}
+	strings := func(v ...string) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{StringValues: v}
+	}
+	player := perfetto.QueryPlayer{
+		counterTracksQuery: &perfetto_service.QueryResult{
+			NumRecords: 1,
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				longs(1), strings("Busy"), strings(""), strings(""), longs(0),
+			},
+		},
+		fmt.Sprintf(countersQueryFmt, 1): &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{longs(100, 200, 300), doubles(0, 10, 30)},
+		},
+	}
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Id: 1, Ts: 110, Dur: 80, TrackId: 1, GroupId: 1},
+			{Id: 2, Ts: 210, Dur: 80, TrackId: 1, GroupId: 2},
+		},
+		Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 1}},
+		Groups: []*service.ProfilingData_GpuSlices_Group{{Id: 1}, {Id: 2}},
+	}
+
+	data, err := WithQueryRecording(PutRecordQueries(ctx), player, func(processor perfetto.Querier) (*service.ProfilingData, error) {
+		counters, _, err := ProcessCounters(ctx, processor, nil)
+		if err != nil {
+			return nil, err
+		}
+		gpuCounters, err := ComputeCounters(ctx, slices, counters)
+		if err != nil {
+			return nil, err
+		}
+		return &service.ProfilingData{Slices: slices, Counters: counters, GpuCounters: gpuCounters}, nil
+	})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	bytes, err := proto.Marshal(&service.ProfilingGolden{ProfilingData: data})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	golden := &service.ProfilingGolden{}
+	assert.For(ctx, "err").ThatError(proto.Unmarshal(bytes, golden)).Succeeded()
+	return golden
+}
+
+// goldenEntry returns the recorded counters of the group of the golden.
+func goldenEntry(golden *service.ProfilingGolden, group int32) *service.ProfilingData_GpuCounters_Entry {
+	for _, entry := range golden.GetProfilingData().GetGpuCounters().GetEntries() {
+		if entry.GroupId == group {
+			return entry
+		}
+	}
+	return nil
+}
+
+// TestGoldens recomputes the GPU counters of a synthetic golden and of the
+// goldens generated with "gapit internal gen-goldens" and compares them to
+// the recorded counters.
+func TestGoldens(t *testing.T) {
+	ctx := log.Testing(t)
+	goldens := map[string]*service.ProfilingGolden{"synthetic": syntheticGolden(ctx)}
+	files, err := filepath.Glob("testdata/*.golden")
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		assert.For(ctx, "err").ThatError(err).Succeeded()
+		golden := &service.ProfilingGolden{}
+		assert.For(ctx, "err").ThatError(proto.Unmarshal(data, golden)).Succeeded()
+		goldens[filepath.Base(file)] = golden
+	}
+
+	checked := 0
+	for name, golden := range goldens {
+		ctx := log.Enter(ctx, name)
+		assert.For(ctx, "entries").That(len(golden.GetProfilingData().GetGpuCounters().GetEntries()) > 0).Equals(true)
+		if assert.For(ctx, "err").ThatError(CheckGolden(ctx, golden)).Succeeded() {
+			checked++
+		}
+	}
+	assert.For(ctx, "checked").That(checked).Equals(len(goldens))
+}
+
+func TestCheckGoldenDetectsDifferences(t *testing.T) {
+	ctx := log.Testing(t)
+	busy := counterMetricIdOffset
+
+	// The counter's first sample covers group 1 and its second group 2.
+	golden := syntheticGolden(ctx)
+	assert.For(ctx, "recorded").That(len(golden.GetProfilingData().GetRecordedQueries())).Equals(2)
+	assert.For(ctx, "group 1").That(goldenEntry(golden, 1).MetricToValue[busy].Estimate).Equals(10.0)
+	assert.For(ctx, "group 2").That(goldenEntry(golden, 2).MetricToValue[busy].Estimate).Equals(30.0)
+
+	golden = syntheticGolden(ctx)
+	goldenEntry(golden, 2).MetricToValue[busy].Estimate = 31
+	assert.For(ctx, "estimate").ThatError(CheckGolden(ctx, golden)).Failed()
+
+	golden = syntheticGolden(ctx)
+	goldenEntry(golden, 1).MetricToValue[gpuTimeMetricId].Max = 99
+	assert.For(ctx, "gpu time").ThatError(CheckGolden(ctx, golden)).Failed()
+
+	golden = syntheticGolden(ctx)
+	entries := golden.ProfilingData.GpuCounters.Entries
+	golden.ProfilingData.GpuCounters.Entries = append(entries, &service.ProfilingData_GpuCounters_Entry{GroupId: 3})
+	assert.For(ctx, "entries").ThatError(CheckGolden(ctx, golden)).Failed()
+}
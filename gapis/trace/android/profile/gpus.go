@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	trackGpusQuery = "" +
+		"SELECT id, COALESCE(gpu_id, 0) FROM gpu_track WHERE scope = 'gpu_render_stage'"
+)
+
+// queryTrackGpus returns the index of the GPU of each render stage track, on
+// devices with several GPUs, e.g. exposed as a Vulkan device group. If the
+// trace processor doesn't expose the GPU of the tracks, they are all of GPU 0.
+func queryTrackGpus(ctx context.Context, processor perfetto.Querier) map[int64]uint32 {
+	res, err := processor.Query(trackGpusQuery)
+	if err != nil {
+		log.D(ctx, "SQL query failed, assuming a single GPU: %v: %v", trackGpusQuery, err)
+		return map[int64]uint32{}
+	}
+	columns := res.GetColumns()
+	ids := columns[0].GetLongValues()
+	gpus := columns[1].GetLongValues()
+	tracks := make(map[int64]uint32, len(ids))
+	for i := range ids {
+		if gpus[i] > 0 {
+			tracks[ids[i]] = uint32(gpus[i])
+		}
+	}
+	return tracks
+}
+
+// CountGpus returns the number of GPUs the slices and counters are from.
+func CountGpus(slices *service.ProfilingData_GpuSlices, counters []*service.ProfilingData_Counter) uint32 {
+	max := uint32(0)
+	for _, t := range slices.GetTracks() {
+		if t.Gpu > max {
+			max = t.Gpu
+		}
+	}
+	for _, c := range counters {
+		if c.Gpu > max {
+			max = c.Gpu
+		}
+	}
+	return max + 1
+}
+
+// slicesOnGpu returns the slices executed by the GPU, given the GPU of each
+// track. If the tracks are all of GPU 0, e.g. as the GPU of the tracks is
+// unknown, the slices are returned as is.
+func slicesOnGpu(slices []*service.ProfilingData_GpuSlices_Slice, trackGpus map[int32]uint32, gpu uint32) []*service.ProfilingData_GpuSlices_Slice {
+	if len(trackGpus) == 0 {
+		return slices
+	}
+	res := make([]*service.ProfilingData_GpuSlices_Slice, 0, len(slices))
+	for _, s := range slices {
+		if trackGpus[s.TrackId] == gpu {
+			res = append(res, s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCountGpus(t *testing.T) {
+	ctx := log.Testing(t)
+
+	single := &service.ProfilingData_GpuSlices{Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 1}}}
+	assert.For(ctx, "single").That(CountGpus(single, nil)).Equals(uint32(1))
+
+	multi := &service.ProfilingData_GpuSlices{Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 1}, {Id: 2, Gpu: 1}}}
+	assert.For(ctx, "slices").That(CountGpus(multi, nil)).Equals(uint32(2))
+	counters := []*service.ProfilingData_Counter{{Id: 1}, {Id: 2, Gpu: 2}}
+	assert.For(ctx, "counters").That(CountGpus(multi, counters)).Equals(uint32(3))
+}
+
+func TestComputeCountersPerGpu(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Group 1 runs on GPU 0, group 2 on GPU 1, at the same time.
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Id: 1, Ts: 100, Dur: 100, TrackId: 1, GroupId: 1},
+			{Id: 2, Ts: 100, Dur: 100, TrackId: 2, GroupId: 2},
+		},
+		Tracks: []*service.ProfilingData_GpuSlices_Track{{Id: 1}, {Id: 2, Gpu: 1}},
+		Groups: []*service.ProfilingData_GpuSlices_Group{{Id: 1}, {Id: 2}},
+	}
+	counters := []*service.ProfilingData_Counter{
+		{Id: 1, Name: "Busy", Gpu: 0, Timestamps: []uint64{100, 200}, Values: []float64{0, 10}},
+		{Id: 2, Name: "Busy", Gpu: 1, Timestamps: []uint64{100, 200}, Values: []float64{0, 30}},
+	}
+	res, err := ComputeCounters(ctx, slices, counters)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	entries := map[int32]*service.ProfilingData_GpuCounters_Entry{}
+	for _, e := range res.Entries {
+		entries[e.GroupId] = e
+	}
+	gpu0 := counterMetricIdOffset
+	gpu1 := counterMetricIdOffset + 1
+	assert.For(ctx, "group 1 gpu 0").That(entries[1].MetricToValue[gpu0].Estimate).Equals(10.0)
+	assert.For(ctx, "group 1 gpu 1").That(entries[1].MetricToValue[gpu1]).IsNil()
+	assert.For(ctx, "group 2 gpu 1").That(entries[2].MetricToValue[gpu1].Estimate).Equals(30.0)
+	assert.For(ctx, "group 2 gpu 0").That(entries[2].MetricToValue[gpu0]).IsNil()
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// GroupCounterSamples returns the samples of the counters clipped to the time
+// range of the slices of the group, including the slices of its descendant
+// groups. A sample covers the period since the previous sample, so the
+// samples whose period overlaps the range are returned, i.e. including the
+// first sample after the range. If counterIDs is not empty, only the counters
+// with these IDs are returned.
+func GroupCounterSamples(data *service.ProfilingData, groupID int32, counterIDs []uint32) (*service.GroupCounterSamples, error) {
+	r, ok := groupTimeRanges(data.GetSlices())[groupID]
+	if !ok {
+		return nil, fmt.Errorf("Group %d not found, or without GPU slices", groupID)
+	}
+	selected := map[uint32]bool{}
+	for _, id := range counterIDs {
+		selected[id] = true
+	}
+
+	res := &service.GroupCounterSamples{GroupId: groupID, Start: r.start, End: r.end}
+	for _, counter := range data.GetCounters() {
+		if len(selected) > 0 && !selected[counter.Id] {
+			continue
+		}
+		from, to := clipSamples(counter.Timestamps, r.start, r.end)
+		res.Counters = append(res.Counters, &service.GroupCounterSamples_Counter{
+			CounterId:  counter.Id,
+			Name:       counter.Name,
+			Unit:       counter.Unit,
+			Timestamps: counter.Timestamps[from:to],
+			Values:     counter.Values[from:to],
+		})
+	}
+	return res, nil
+}
+
+// clipSamples returns the range of the sorted sample timestamps whose period,
+// since the previous sample, overlaps [start, end].
+func clipSamples(timestamps []uint64, start, end uint64) (int, int) {
+	from := sort.Search(len(timestamps), func(i int) bool { return timestamps[i] >= start })
+	to := sort.Search(len(timestamps), func(i int) bool { return timestamps[i] > end })
+	if to > 0 && to < len(timestamps) && timestamps[to-1] < end {
+		// The next sample covers the end of the range.
+		to++
+	}
+	return from, to
+}
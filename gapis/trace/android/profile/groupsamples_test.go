@@ -0,0 +1,66 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestGroupCounterSamples(t *testing.T) {
+	ctx := log.Testing(t)
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Ts: 100, Dur: 50, GroupId: 2},
+				{Ts: 160, Dur: 40, GroupId: 3},
+			},
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1},
+				{Id: 2, ParentId: 1},
+				{Id: 3, ParentId: 1},
+			},
+		},
+		Counters: []*service.ProfilingData_Counter{
+			{Id: 7, Name: "Busy", Unit: "%", Timestamps: []uint64{50, 90, 130, 170, 210, 250}, Values: []float64{1, 2, 3, 4, 5, 6}},
+			{Id: 8, Name: "Other", Timestamps: []uint64{120}, Values: []float64{1}},
+		},
+	}
+
+	res, err := GroupCounterSamples(data, 1, []uint32{7})
+	if !assert.For(ctx, "err").ThatError(err).Succeeded() {
+		return
+	}
+	assert.For(ctx, "start").That(res.Start).Equals(uint64(100))
+	assert.For(ctx, "end").That(res.End).Equals(uint64(200))
+	if assert.For(ctx, "counters").That(len(res.Counters)).Equals(1) {
+		c := res.Counters[0]
+		assert.For(ctx, "id").That(c.CounterId).Equals(uint32(7))
+		assert.For(ctx, "timestamps").ThatSlice(c.Timestamps).Equals([]uint64{130, 170, 210})
+		assert.For(ctx, "values").ThatSlice(c.Values).Equals([]float64{3, 4, 5})
+	}
+
+	res, err = GroupCounterSamples(data, 2, nil)
+	if assert.For(ctx, "err").ThatError(err).Succeeded() && assert.For(ctx, "all counters").That(len(res.Counters)).Equals(2) {
+		assert.For(ctx, "within sample").ThatSlice(res.Counters[0].Timestamps).Equals([]uint64{130, 170})
+		assert.For(ctx, "covering sample").ThatSlice(res.Counters[1].Timestamps).Equals([]uint64{120})
+	}
+
+	_, err = GroupCounterSamples(data, 4, nil)
+	assert.For(ctx, "unknown group").ThatError(err).Failed()
+}
@@ -22,7 +22,10 @@ import (
 )
 
 // ExtractTraceHandles translates the handles in the replayHandles array based on the mappings.
-func ExtractTraceHandles(ctx context.Context, replayHandles []int64, replayHandleType string, handleMapping map[uint64][]service.VulkanHandleMappingItem) {
+// If commands isn't nil, it holds the capture command index of each handle's use, -1 if unknown,
+// which picks the mapping valid at that command when several trace handles map to the same
+// replay handle.
+func ExtractTraceHandles(ctx context.Context, replayHandles []int64, replayHandleType string, handleMapping map[uint64][]service.VulkanHandleMappingItem, commands []int64) {
 	for i, v := range replayHandles {
 		handles, ok := handleMapping[uint64(v)]
 		if !ok {
@@ -39,17 +42,48 @@ func ExtractTraceHandles(ctx context.Context, replayHandles []int64, replayHandl
 			}
 		}
 
-		found := false
-		for _, handle := range handles {
-			if handle.HandleType == replayHandleType {
-				replayHandles[i] = int64(handle.TraceValue)
-				found = true
-				break
-			}
+		cmd := int64(-1)
+		if commands != nil {
+			cmd = commands[i]
 		}
-
-		if !found {
+		handle := findHandleMapping(handles, replayHandleType, cmd)
+		if handle == nil {
 			log.E(ctx, "Incorrect Handle type for %v: %v", replayHandleType, v)
+			continue
+		}
+		replayHandles[i] = int64(handle.TraceValue)
+	}
+}
+
+// findHandleMapping returns the mapping of the given type that is valid at
+// the command, preferring mappings submitted around the command over mappings
+// without a validity range. Falls back to the first mapping of the type if
+// none is valid or the command is unknown. Returns nil if there is no mapping
+// of the type.
+func findHandleMapping(handles []service.VulkanHandleMappingItem, handleType string, cmd int64) *service.VulkanHandleMappingItem {
+	var first, unbounded *service.VulkanHandleMappingItem
+	for i := range handles {
+		handle := &handles[i]
+		if handle.HandleType != handleType {
+			continue
 		}
+		if cmd < 0 {
+			return handle
+		}
+		switch {
+		case handle.EndCommand == 0:
+			if unbounded == nil {
+				unbounded = handle
+			}
+		case uint64(cmd) >= handle.BeginCommand && uint64(cmd) < handle.EndCommand:
+			return handle
+		}
+		if first == nil {
+			first = handle
+		}
+	}
+	if unbounded != nil {
+		return unbounded
 	}
+	return first
 }
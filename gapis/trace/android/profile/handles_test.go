@@ -0,0 +1,51 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestExtractTraceHandles(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Two command buffers, reset and reallocated in different frames, share
+	// the replay handle 0x10.
+	mapping := map[uint64][]service.VulkanHandleMappingItem{
+		0x10: {
+			{HandleType: "VkCommandBuffer", TraceValue: 0xa, ReplayValue: 0x10, BeginCommand: 100, EndCommand: 200},
+			{HandleType: "VkCommandBuffer", TraceValue: 0xb, ReplayValue: 0x10, BeginCommand: 300, EndCommand: 400},
+		},
+		0x20: {
+			{HandleType: "VkDevice", TraceValue: 0xc, ReplayValue: 0x20},
+		},
+	}
+
+	handles := []int64{0x10, 0x10, 0x10, 0x10}
+	ExtractTraceHandles(ctx, handles, "VkCommandBuffer", mapping, []int64{150, 350, 250, -1})
+	assert.For(ctx, "ranged").ThatSlice(handles).Equals([]int64{0xa, 0xb, 0xa, 0xa})
+
+	handles = []int64{0x10, 0x10}
+	ExtractTraceHandles(ctx, handles, "VkCommandBuffer", mapping, nil)
+	assert.For(ctx, "no commands").ThatSlice(handles).Equals([]int64{0xa, 0xa})
+
+	handles = []int64{0x20}
+	ExtractTraceHandles(ctx, handles, "VkDevice", mapping, []int64{350})
+	assert.For(ctx, "unbounded").ThatSlice(handles).Equals([]int64{0xc})
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	vulkanEventsQuery = "" +
+		"SELECT s.name, s.submission_id, s.ts FROM gpu_slice s JOIN track t ON s.track_id = t.id " +
+		"WHERE t.name = 'Vulkan Events' AND (s.name = 'vkQueueSubmit' OR s.name = 'vkQueuePresentKHR') ORDER BY s.ts"
+)
+
+// vulkanEvents holds the CPU side timing of the Vulkan queue operations.
+type vulkanEvents struct {
+	presents []uint64 // sorted present times.
+	// ordering holds the submit times, disambiguating the reused submission
+	// IDs by the time of the slices.
+	ordering *SubmissionOrdering
+}
+
+// ComputeGpuIdle finds the gaps in each frame in which the GPU did not
+// execute any work, and classifies their cause based on the timing of the
+// queue submissions and presentations.
+func ComputeGpuIdle(ctx context.Context, processor perfetto.Querier, slices *service.ProfilingData_GpuSlices) (*service.ProfilingData_GpuIdle, error) {
+	events, err := queryVulkanEvents(ctx, processor)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &service.ProfilingData_GpuIdle{}
+	for frame, frameSlices := range SliceFrames(slices) {
+		res.Frames = append(res.Frames, frameIdle(frame, frameSlices, events))
+	}
+	sort.Slice(res.Frames, func(i, j int) bool { return res.Frames[i].FrameId < res.Frames[j].FrameId })
+	return res, nil
+}
+
+func queryVulkanEvents(ctx context.Context, processor perfetto.Querier) (vulkanEvents, error) {
+	eventsQueryResult, err := processor.Query(vulkanEventsQuery)
+	if err != nil {
+		return vulkanEvents{}, queryError(err, vulkanEventsQuery)
+	}
+	columns := eventsQueryResult.GetColumns()
+	names := columns[0].GetStringValues()
+	submissions := columns[1].GetLongValues()
+	timestamps := columns[2].GetLongValues()
+	events := vulkanEvents{ordering: newSubmissionOrdering()}
+	for i := range names {
+		if names[i] == "vkQueuePresentKHR" {
+			events.presents = append(events.presents, uint64(timestamps[i]))
+		} else {
+			events.ordering.add(submissions[i], timestamps[i])
+		}
+	}
+	return events, nil
+}
+
+// SliceFrames groups the slices by their frame.
+func SliceFrames(slices *service.ProfilingData_GpuSlices) map[int64][]*service.ProfilingData_GpuSlices_Slice {
+	frames := map[int64][]*service.ProfilingData_GpuSlices_Slice{}
+	for _, slice := range slices.GetSlices() {
+		if frame, ok := sliceExtraInt(slice, "frameId"); ok {
+			frames[frame] = append(frames[frame], slice)
+		}
+	}
+	return frames
+}
+
+// frameIdle computes the idle gaps between the given slices of a frame.
+func frameIdle(frame int64, slices []*service.ProfilingData_GpuSlices_Slice, events vulkanEvents) *service.ProfilingData_GpuIdle_Frame {
+	sort.Slice(slices, func(i, j int) bool { return slices[i].Ts < slices[j].Ts })
+
+	res := &service.ProfilingData_GpuIdle_Frame{FrameId: frame}
+	if len(slices) == 0 {
+		return res
+	}
+
+	start, end := slices[0].Ts, slices[0].Ts+slices[0].Dur
+	for _, slice := range slices[1:] {
+		if slice.Ts > end {
+			gap := &service.ProfilingData_GpuIdle_Gap{
+				Ts:    end,
+				Dur:   slice.Ts - end,
+				Cause: idleCause(end, slice, events),
+			}
+			res.Gaps = append(res.Gaps, gap)
+			res.Idle += gap.Dur
+		}
+		if e := slice.Ts + slice.Dur; e > end {
+			end = e
+		}
+	}
+
+	res.Ts, res.Dur = start, end-start
+	if res.Dur > 0 {
+		res.IdlePercent = 100 * float64(res.Idle) / float64(res.Dur)
+	}
+	return res
+}
+
+// idleCause classifies the cause of the gap starting at gapStart and ending
+// with the start of the next slice.
+func idleCause(gapStart uint64, next *service.ProfilingData_GpuSlices_Slice, events vulkanEvents) service.ProfilingData_GpuIdle_Cause {
+	gapEnd := next.Ts
+	if i := sort.Search(len(events.presents), func(i int) bool { return events.presents[i] >= gapStart }); i < len(events.presents) && events.presents[i] <= gapEnd {
+		return service.ProfilingData_GpuIdle_PresentBlock
+	}
+
+	submission, ok := sliceSubmission(next)
+	if !ok {
+		return service.ProfilingData_GpuIdle_Unknown
+	}
+	submitTime, ok := events.ordering.SubmitTime(submission, int64(next.Ts))
+	switch {
+	case !ok:
+		return service.ProfilingData_GpuIdle_Unknown
+	case uint64(submitTime) >= gapStart:
+		return service.ProfilingData_GpuIdle_LateSubmission
+	default:
+		return service.ProfilingData_GpuIdle_SyncWait
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func testSlice(ts, dur uint64, submission uint64) *service.ProfilingData_GpuSlices_Slice {
+	return &service.ProfilingData_GpuSlices_Slice{
+		Ts:  ts,
+		Dur: dur,
+		Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{{
+			Name:  "submissionId",
+			Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: submission},
+		}},
+	}
+}
+
+// testOrdering returns the ordering of the given submission ID and submit
+// time pairs, in the order of the submissions.
+func testOrdering(submits ...[2]int64) *SubmissionOrdering {
+	res := newSubmissionOrdering()
+	for _, s := range submits {
+		res.add(s[0], s[1])
+	}
+	return res
+}
+
+func TestFrameIdle(t *testing.T) {
+	ctx := log.Testing(t)
+	slices := []*service.ProfilingData_GpuSlices_Slice{
+		testSlice(0, 100, 1),
+		testSlice(50, 100, 1),  // overlaps the first slice.
+		testSlice(200, 100, 2), // submitted late.
+		testSlice(400, 100, 3), // waited on a semaphore.
+		testSlice(600, 400, 4), // blocked on present.
+	}
+	events := vulkanEvents{
+		presents: []uint64{520},
+		ordering: testOrdering([2]int64{1, 0}, [2]int64{3, 100}, [2]int64{2, 180}, [2]int64{4, 300}),
+	}
+
+	frame := frameIdle(7, slices, events)
+	assert.For(ctx, "frame").That(frame.FrameId).Equals(int64(7))
+	assert.For(ctx, "ts").That(frame.Ts).Equals(uint64(0))
+	assert.For(ctx, "dur").That(frame.Dur).Equals(uint64(1000))
+	assert.For(ctx, "idle").That(frame.Idle).Equals(uint64(250))
+	assert.For(ctx, "percent").That(frame.IdlePercent).Equals(25.0)
+	assert.For(ctx, "gaps").That(len(frame.Gaps)).Equals(3)
+	assert.For(ctx, "gap 0").That(frame.Gaps[0].Cause).Equals(service.ProfilingData_GpuIdle_LateSubmission)
+	assert.For(ctx, "gap 1").That(frame.Gaps[1].Cause).Equals(service.ProfilingData_GpuIdle_SyncWait)
+	assert.For(ctx, "gap 2").That(frame.Gaps[2].Cause).Equals(service.ProfilingData_GpuIdle_PresentBlock)
+}
+
+func TestFrameIdleReusedSubmission(t *testing.T) {
+	ctx := log.Testing(t)
+	slices := []*service.ProfilingData_GpuSlices_Slice{
+		testSlice(0, 100, 2),
+		testSlice(200, 100, 1), // waited on a semaphore.
+		testSlice(500, 100, 1), // submitted late, reusing the ID.
+	}
+	events := vulkanEvents{
+		ordering: testOrdering([2]int64{2, 0}, [2]int64{1, 20}, [2]int64{1, 400}),
+	}
+
+	frame := frameIdle(1, slices, events)
+	assert.For(ctx, "gaps").That(len(frame.Gaps)).Equals(2)
+	assert.For(ctx, "gap 0").That(frame.Gaps[0].Cause).Equals(service.ProfilingData_GpuIdle_SyncWait)
+	assert.For(ctx, "gap 1").That(frame.Gaps[1].Cause).Equals(service.ProfilingData_GpuIdle_LateSubmission)
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/service"
+)
+
+const ignoredSlicesKey = contextKey("ignoredSlices")
+
+// PutIgnoredSlices attaches the patterns of the names of the GPU slices
+// excluded from the slice aggregates to the context.
+func PutIgnoredSlices(ctx context.Context, patterns []*regexp.Regexp) context.Context {
+	return keys.WithValue(ctx, ignoredSlicesKey, patterns)
+}
+
+// GetIgnoredSlices returns the patterns attached to the context by
+// PutIgnoredSlices, or nil if there are none.
+func GetIgnoredSlices(ctx context.Context) []*regexp.Regexp {
+	val, _ := ctx.Value(ignoredSlicesKey).([]*regexp.Regexp)
+	return val
+}
+
+// CompileSlicePatterns compiles the regular expressions of the names of the
+// ignored GPU slices.
+func CompileSlicePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid slice pattern %q: %v", p, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// isIgnoredSlice returns whether the name or the label of the slice matches
+// any of the patterns.
+func isIgnoredSlice(slice *service.ProfilingData_GpuSlices_Slice, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(slice.Name) || p.MatchString(slice.Label) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// CheckSliceIntegrity cross-checks the render pass slices against the
+// submissions and render passes of the capture, such that partially
+// attributed slice data is reported, rather than silently producing partial
+// results. Only the submissions with render passes are checked, as the
+// slices of other work are not attributed to commands, and only those between
+// the first and last submissions with slices, as the trace may cover a range
+// of the capture. Returns nil if there is no sync data.
+func CheckSliceIntegrity(slices *service.ProfilingData_GpuSlices, capture *path.Capture, syncData *sync.Data) *service.ProfilingData_SliceIntegrity {
+	if syncData == nil || syncData.RenderPassLookup == nil {
+		return nil
+	}
+
+	links := map[int32]*path.Commands{}
+	for _, g := range slices.GetGroups() {
+		if len(g.GetLink().GetFrom()) > 0 {
+			links[g.Id] = g.Link
+		}
+	}
+
+	res := &service.ProfilingData_SliceIntegrity{}
+	observedPasses := map[string]bool{}
+	observedSubmits := map[uint64]bool{}
+	submitStarts := map[int64]map[uint64]uint64{} // hwQueueId -> submit -> start
+	first, last := ^uint64(0), uint64(0)
+	for _, s := range slices.GetSlices() {
+		link, ok := links[s.GroupId]
+		if !ok {
+			if s.Depth == 0 && isRenderPassCategory(s.Category) {
+				res.ExtraSlices++
+				res.ExtraTime += s.Dur
+			}
+			continue
+		}
+		submit := link.From[0]
+		observedPasses[fmt.Sprint(api.SubCmdIdx(link.From))] = true
+		observedSubmits[submit] = true
+		if submit < first {
+			first = submit
+		}
+		if submit > last {
+			last = submit
+		}
+
+		queue, _ := sliceExtraInt(s, "hwQueueId")
+		starts, ok := submitStarts[queue]
+		if !ok {
+			starts = map[uint64]uint64{}
+			submitStarts[queue] = starts
+		}
+		if start, ok := starts[submit]; !ok || s.Ts < start {
+			starts[submit] = s.Ts
+		}
+	}
+
+	expectedSubmits := map[uint64]bool{}
+	for _, rp := range syncData.RenderPassLookup.RenderPasses() {
+		if len(rp.From) == 0 || rp.From[0] < first || rp.From[0] > last {
+			continue
+		}
+		res.RenderPasses++
+		expectedSubmits[rp.From[0]] = true
+		if !observedPasses[fmt.Sprint(rp.From)] {
+			res.MissingRenderPasses = append(res.MissingRenderPasses, &path.Commands{
+				Capture: capture,
+				From:    rp.From,
+				To:      rp.To,
+			})
+		}
+	}
+	res.Submissions = uint32(len(expectedSubmits))
+	for submit := range expectedSubmits {
+		if !observedSubmits[submit] {
+			res.MissingSubmissions++
+		}
+	}
+
+	for _, starts := range submitStarts {
+		submits := make([]uint64, 0, len(starts))
+		for submit := range starts {
+			submits = append(submits, submit)
+		}
+		sort.Slice(submits, func(i, j int) bool { return submits[i] < submits[j] })
+		for i := 1; i < len(submits); i++ {
+			if starts[submits[i]] < starts[submits[i-1]] {
+				res.OutOfOrderSubmissions++
+			}
+		}
+	}
+	return res
+}
+
+func isRenderPassCategory(c service.ProfilingData_GpuSlices_Slice_Category) bool {
+	return c == service.ProfilingData_GpuSlices_Slice_Vertex || c == service.ProfilingData_GpuSlices_Slice_Fragment
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestCheckSliceIntegrity(t *testing.T) {
+	ctx := log.Testing(t)
+
+	syncData := sync.NewData()
+	passes := []sync.SubCmdRange{
+		{From: api.SubCmdIdx{5, 0, 0, 1}, To: api.SubCmdIdx{5, 0, 0, 3}},
+		{From: api.SubCmdIdx{5, 0, 0, 4}, To: api.SubCmdIdx{5, 0, 0, 6}},
+		{From: api.SubCmdIdx{8, 0, 0, 1}, To: api.SubCmdIdx{8, 0, 0, 2}},
+		{From: api.SubCmdIdx{10, 0, 0, 1}, To: api.SubCmdIdx{10, 0, 0, 2}},
+		// After the last submission with slices, so not checked.
+		{From: api.SubCmdIdx{12, 0, 0, 1}, To: api.SubCmdIdx{12, 0, 0, 2}},
+	}
+	for i, rp := range passes {
+		syncData.RenderPassLookup.AddRenderPass(ctx, sync.RenderPassKey{i, 10, uint64(20 + i), 30}, rp)
+	}
+
+	queue := func(id uint64) []*service.ProfilingData_GpuSlices_Slice_Extra {
+		return []*service.ProfilingData_GpuSlices_Slice_Extra{
+			{Name: "hwQueueId", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: id}},
+		}
+	}
+	slices := &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Link: &path.Commands{From: passes[0].From, To: passes[0].To}},
+			{Id: 2, Link: &path.Commands{From: passes[3].From, To: passes[3].To}},
+		},
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 100, Dur: 10, GroupId: 1, Category: service.ProfilingData_GpuSlices_Slice_Fragment, Extras: queue(0)},
+			// Starts before the previous submission on the same queue.
+			{Ts: 50, Dur: 10, GroupId: 2, Category: service.ProfilingData_GpuSlices_Slice_Fragment, Extras: queue(0)},
+			// A render pass inserted by the driver.
+			{Ts: 200, Dur: 7, GroupId: -1, Category: service.ProfilingData_GpuSlices_Slice_Fragment, Extras: queue(0)},
+			// Work outside render passes is never attributed.
+			{Ts: 300, Dur: 5, GroupId: -1, Category: service.ProfilingData_GpuSlices_Slice_Compute, Extras: queue(1)},
+		},
+	}
+
+	res := CheckSliceIntegrity(slices, nil, syncData)
+	assert.For(ctx, "submissions").That(res.Submissions).Equals(uint32(3))
+	assert.For(ctx, "missing submissions").That(res.MissingSubmissions).Equals(uint32(1))
+	assert.For(ctx, "render passes").That(res.RenderPasses).Equals(uint32(4))
+	assert.For(ctx, "missing render passes").ThatSlice(res.MissingRenderPasses).IsLength(2)
+	assert.For(ctx, "missing render pass").ThatSlice(res.MissingRenderPasses[0].From).Equals([]uint64{5, 0, 0, 4})
+	assert.For(ctx, "extra slices").That(res.ExtraSlices).Equals(uint32(1))
+	assert.For(ctx, "extra time").That(res.ExtraTime).Equals(uint64(7))
+	assert.For(ctx, "out of order").That(res.OutOfOrderSubmissions).Equals(uint32(1))
+
+	assert.For(ctx, "no sync data").That(CheckSliceIntegrity(slices, nil, nil)).IsNil()
+}
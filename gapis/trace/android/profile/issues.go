@@ -0,0 +1,90 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"regexp"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// knownIssue is a known issue of a device or driver that affects the
+// profiling data.
+type knownIssue struct {
+	// The GPU names of the affected devices.
+	gpu *regexp.Regexp
+	// The highest affected Vulkan driver version, zero if all versions are.
+	maxDriverVersion uint32
+	// The affected sections.
+	sections []service.ProfilingData_SectionError_Section
+	// The names of the affected counters, nil if no counters are.
+	counters    *regexp.Regexp
+	description string
+}
+
+// knownIssues is the database of known device and driver issues. Add issues
+// here as they are found, with a reference to the bug, if any.
+var knownIssues = []knownIssue{
+	{
+		gpu:      regexp.MustCompile(`Adreno`),
+		sections: []service.ProfilingData_SectionError_Section{service.ProfilingData_SectionError_Slices},
+		description: "The driver reports a zero context ID for the first render stage after a " +
+			"render pass change within a submission (b/192546534). The IDs are fixed up from the " +
+			"neighbouring slices, which may misattribute slices of submissions to multiple devices.",
+	},
+	{
+		gpu:      regexp.MustCompile(`Mali`),
+		sections: []service.ProfilingData_SectionError_Section{service.ProfilingData_SectionError_Slices},
+		description: "The driver emits spurious queue submissions without a command buffer " +
+			"(b/150854367). These are ignored, but their slices may be missing from the groups.",
+	},
+}
+
+// AnnotateKnownIssues adds the known issues of the device that apply to the
+// data to its known issues.
+func AnnotateKnownIssues(data *service.ProfilingData, inst *device.Instance) {
+	gpu := inst.GetConfiguration().GetHardware().GetGPU().GetName()
+	driver := uint32(0)
+	if devices := inst.GetConfiguration().GetDrivers().GetVulkan().GetPhysicalDevices(); len(devices) > 0 {
+		driver = devices[0].DriverVersion
+	}
+
+	for _, issue := range knownIssues {
+		if !issue.gpu.MatchString(gpu) {
+			continue
+		}
+		if issue.maxDriverVersion != 0 && (driver == 0 || driver > issue.maxDriverVersion) {
+			continue
+		}
+
+		res := &service.ProfilingData_KnownIssue{
+			Description: issue.description,
+			Sections:    issue.sections,
+		}
+		if issue.counters != nil {
+			for _, counter := range data.Counters {
+				if issue.counters.MatchString(counter.Name) {
+					res.CounterIds = append(res.CounterIds, counter.Id)
+				}
+			}
+			if len(res.CounterIds) == 0 && len(res.Sections) == 0 {
+				// None of the affected counters were traced.
+				continue
+			}
+		}
+		data.KnownIssues = append(data.KnownIssues, res)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestAnnotateKnownIssues(t *testing.T) {
+	ctx := log.Testing(t)
+
+	defer func(issues []knownIssue) { knownIssues = issues }(knownIssues)
+	knownIssues = []knownIssue{
+		{gpu: regexp.MustCompile(`Test GPU`), maxDriverVersion: 10, counters: regexp.MustCompile(`^Fragments`), description: "old driver"},
+		{gpu: regexp.MustCompile(`Test GPU`), counters: regexp.MustCompile(`^Vertices`), description: "untraced counter"},
+		{gpu: regexp.MustCompile(`Other GPU`), description: "other device"},
+	}
+
+	instance := func(driver uint32) *device.Instance {
+		return &device.Instance{Configuration: &device.Configuration{
+			Hardware: &device.Hardware{GPU: &device.GPU{Name: "Test GPU 100"}},
+			Drivers: &device.Drivers{Vulkan: &device.VulkanDriver{
+				PhysicalDevices: []*device.VulkanPhysicalDevice{{DriverVersion: driver}},
+			}},
+		}}
+	}
+	newData := func() *service.ProfilingData {
+		return &service.ProfilingData{Counters: []*service.ProfilingData_Counter{
+			{Id: 1, Name: "Fragments Shaded"},
+			{Id: 2, Name: "Cycles"},
+		}}
+	}
+
+	data := newData()
+	AnnotateKnownIssues(data, instance(5))
+	assert.For(ctx, "issues").That(len(data.KnownIssues)).Equals(1)
+	assert.For(ctx, "description").That(data.KnownIssues[0].Description).Equals("old driver")
+	assert.For(ctx, "counters").ThatSlice(data.KnownIssues[0].CounterIds).Equals([]uint32{1})
+
+	data = newData()
+	AnnotateKnownIssues(data, instance(11))
+	assert.For(ctx, "fixed driver").That(len(data.KnownIssues)).Equals(0)
+}
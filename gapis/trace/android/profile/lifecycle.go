@@ -0,0 +1,138 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+// FrameBoundaries assigns the GPU slices of the data to frames, by setting
+// the data's Frames. Returns false if it could not determine the frames, in
+// which case the next FrameBoundaries is tried. The vendors pass the
+// FrameBoundaries matching their render stage producer to AssignFrames.
+type FrameBoundaries func(ctx context.Context, processor perfetto.Querier, data *SliceData) (bool, error)
+
+// DefaultFrameBoundaries uses the frame ids of the render stage producer, if
+// reported, and falls back to the presentations otherwise.
+var DefaultFrameBoundaries = []FrameBoundaries{ProducerFrames, PresentFrames}
+
+// AssignFrames assigns the GPU slices of the data to frames, using the first
+// of the boundaries that succeeds. If none does, the frames are left as is.
+func AssignFrames(ctx context.Context, processor perfetto.Querier, data *SliceData, boundaries ...FrameBoundaries) error {
+	for _, b := range boundaries {
+		if ok, err := b(ctx, processor, data); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+	log.W(ctx, "Could not determine the frame boundaries of the GPU slices")
+	return nil
+}
+
+// ProducerFrames keeps the frame ids reported by the render stage producer.
+// Fails if the producer did not report any frame id.
+func ProducerFrames(ctx context.Context, processor perfetto.Querier, data *SliceData) (bool, error) {
+	for _, frame := range data.Frames {
+		if frame != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PresentFrames assigns each slice to the frame its queue submission was made
+// in, delimited by the presentations. The frames are numbered from one. Fails
+// if the trace contains no Vulkan events.
+func PresentFrames(ctx context.Context, processor perfetto.Querier, data *SliceData) (bool, error) {
+	events, err := queryVulkanEvents(ctx, processor)
+	if err != nil {
+		return false, err
+	}
+	if len(events.presents) == 0 || events.ordering.Len() == 0 {
+		return false, nil
+	}
+	data.Frames = framesByPresents(data.Submissions, data.Timestamps, events)
+	return true, nil
+}
+
+// framesByPresents returns the frame of the submission of each of the slices
+// starting at the given times, being one plus the number of presentations
+// preceding the submission.
+func framesByPresents(submissions, timestamps []int64, events vulkanEvents) []int64 {
+	frames := make([]int64, len(submissions))
+	for i, submission := range submissions {
+		if submit, ok := events.ordering.SubmitTime(submission, timestamps[i]); ok {
+			frames[i] = int64(sort.Search(len(events.presents), func(i int) bool { return events.presents[i] > uint64(submit) })) + 1
+		}
+	}
+	return frames
+}
+
+// ComputeFrameLifecycle computes the timeline of each frame of the slices,
+// from the timing of the queue submissions and presentations.
+func ComputeFrameLifecycle(ctx context.Context, processor perfetto.Querier, slices *service.ProfilingData_GpuSlices) (*service.ProfilingData_FrameLifecycle, error) {
+	events, err := queryVulkanEvents(ctx, processor)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &service.ProfilingData_FrameLifecycle{}
+	for frame, frameSlices := range SliceFrames(slices) {
+		res.Frames = append(res.Frames, frameLifecycle(frame, frameSlices, events))
+	}
+	sort.Slice(res.Frames, func(i, j int) bool { return res.Frames[i].FrameId < res.Frames[j].FrameId })
+	return res, nil
+}
+
+// frameLifecycle computes the timeline of the frame with the given slices.
+func frameLifecycle(frame int64, slices []*service.ProfilingData_GpuSlices_Slice, events vulkanEvents) *service.ProfilingData_FrameLifecycle_Frame {
+	res := &service.ProfilingData_FrameLifecycle_Frame{FrameId: frame}
+	lastSubmit := uint64(0)
+	for i, slice := range slices {
+		if i == 0 || slice.Ts < res.GpuStart {
+			res.GpuStart = slice.Ts
+		}
+		if end := slice.Ts + slice.Dur; end > res.GpuEnd {
+			res.GpuEnd = end
+		}
+		if submission, ok := sliceSubmission(slice); ok {
+			if ts, ok := events.ordering.SubmitTime(submission, int64(slice.Ts)); ok {
+				submit := uint64(ts)
+				if res.FirstSubmit == 0 || submit < res.FirstSubmit {
+					res.FirstSubmit = submit
+				}
+				if submit > lastSubmit {
+					lastSubmit = submit
+				}
+			}
+		}
+	}
+
+	if res.FirstSubmit != 0 {
+		if i := sort.Search(len(events.presents), func(i int) bool { return events.presents[i] >= lastSubmit }); i < len(events.presents) {
+			res.Present = events.presents[i]
+		}
+		if res.GpuEnd > res.FirstSubmit {
+			res.Latency = res.GpuEnd - res.FirstSubmit
+		}
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestFramesByPresents(t *testing.T) {
+	ctx := log.Testing(t)
+	events := vulkanEvents{
+		presents: []uint64{100, 200},
+		ordering: testOrdering([2]int64{1, 10}, [2]int64{2, 20}, [2]int64{3, 120}, [2]int64{4, 250}, [2]int64{1, 260}),
+	}
+	frames := framesByPresents(
+		[]int64{1, 2, 2, 3, 4, 5, 1},
+		[]int64{30, 40, 50, 130, 270, 280, 290},
+		events)
+	assert.For(ctx, "frames").ThatSlice(frames).Equals([]int64{1, 1, 1, 2, 3, 0, 3})
+}
+
+func TestProducerFrames(t *testing.T) {
+	ctx := log.Testing(t)
+	ok, err := ProducerFrames(ctx, nil, &SliceData{Frames: []int64{0, 0}})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "unreported").That(ok).Equals(false)
+	ok, err = ProducerFrames(ctx, nil, &SliceData{Frames: []int64{0, 1}})
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "reported").That(ok).Equals(true)
+}
+
+func TestFrameLifecycle(t *testing.T) {
+	ctx := log.Testing(t)
+	slices := []*service.ProfilingData_GpuSlices_Slice{
+		testSlice(150, 100, 2),
+		testSlice(50, 50, 1),
+		testSlice(300, 20, 3), // unknown submission.
+	}
+	events := vulkanEvents{
+		presents: []uint64{30, 60, 400},
+		ordering: testOrdering([2]int64{1, 10}, [2]int64{2, 40}),
+	}
+
+	frame := frameLifecycle(3, slices, events)
+	assert.For(ctx, "frame").That(frame.FrameId).Equals(int64(3))
+	assert.For(ctx, "first submit").That(frame.FirstSubmit).Equals(uint64(10))
+	assert.For(ctx, "present").That(frame.Present).Equals(uint64(60))
+	assert.For(ctx, "gpu start").That(frame.GpuStart).Equals(uint64(50))
+	assert.For(ctx, "gpu end").That(frame.GpuEnd).Equals(uint64(320))
+	assert.For(ctx, "latency").That(frame.Latency).Equals(uint64(310))
+}
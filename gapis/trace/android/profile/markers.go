@@ -0,0 +1,172 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// submitPidsQuery returns the processes that submitted GPU work, i.e. the
+	// traced app, or the replayer.
+	submitPidsQuery = "" +
+		"SELECT a.int_value FROM gpu_slice g JOIN args a USING(arg_set_id) " +
+		"WHERE g.name = 'vkQueueSubmit' AND a.key = 'pid'"
+	markersQuery = "" +
+		"SELECT s.ts, s.dur, s.name, s.depth, s.track_id, p.name, t.name, s.category " +
+		"FROM slice s JOIN thread_track tt ON s.track_id = tt.id JOIN thread t USING(utid) LEFT JOIN process p USING(upid) " +
+		"WHERE p.pid IN (" + submitPidsQuery + ") OR NOT EXISTS (" + submitPidsQuery + ") " +
+		"ORDER BY s.ts"
+	submitTimesQuery = "" +
+		"SELECT s.submission_id, s.ts FROM gpu_slice s JOIN track t ON s.track_id = t.id " +
+		"WHERE s.name = 'vkQueueSubmit' AND t.name = 'Vulkan Events' ORDER BY s.ts"
+)
+
+// ProcessMarkers extracts the CPU trace markers of the application, such as
+// ATrace sections and the track events of the in-app SDK, and aligns them
+// with the GPU slice groups of the queue submissions issued while the marker
+// was active. Only the markers of the processes that submitted GPU work are
+// extracted, unless the trace doesn't tell the submitting processes.
+func ProcessMarkers(ctx context.Context, processor perfetto.Querier, slices *service.ProfilingData_GpuSlices) (*service.ProfilingData_Markers, error) {
+	markersQueryResult, err := processor.Query(markersQuery)
+	if err != nil {
+		return nil, queryError(err, markersQuery)
+	}
+	submitTimesQueryResult, err := processor.Query(submitTimesQuery)
+	if err != nil {
+		return nil, queryError(err, submitTimesQuery)
+	}
+
+	submitColumns := submitTimesQueryResult.GetColumns()
+	submitIds := submitColumns[0].GetLongValues()
+	submitTimes := submitColumns[1].GetLongValues()
+	// The order of each submit is its index in the sorted submit times.
+	ordering := newSubmissionOrdering()
+	for j := range submitIds {
+		ordering.add(submitIds[j], submitTimes[j])
+	}
+	submissionGroups := submissionGroups(slices, ordering)
+
+	columns := markersQueryResult.GetColumns()
+	timestamps := columns[0].GetLongValues()
+	durations := columns[1].GetLongValues()
+	names := columns[2].GetStringValues()
+	depths := columns[3].GetLongValues()
+	trackIds := columns[4].GetLongValues()
+	processNames := columns[5].GetStringValues()
+	threadNames := columns[6].GetStringValues()
+	categories := columns[7].GetStringValues()
+
+	tracks := map[int64]*service.ProfilingData_Markers_Track{}
+	markers := make([]*service.ProfilingData_Markers_Marker, len(timestamps))
+	for i := range timestamps {
+		start, end := timestamps[i], timestamps[i]+durations[i]
+		groups := []int32{}
+		seen := map[int32]bool{}
+		// The submit times are sorted, find the first one within the marker.
+		for j := sort.Search(len(submitTimes), func(j int) bool { return submitTimes[j] >= start }); j < len(submitTimes) && submitTimes[j] <= end; j++ {
+			for _, group := range submissionGroups[j] {
+				if !seen[group] {
+					seen[group] = true
+					groups = append(groups, group)
+				}
+			}
+		}
+
+		markers[i] = &service.ProfilingData_Markers_Marker{
+			Ts:       uint64(timestamps[i]),
+			Dur:      uint64(durations[i]),
+			Label:    names[i],
+			Depth:    int32(depths[i]),
+			TrackId:  int32(trackIds[i]),
+			GroupIds: groups,
+			Category: categories[i],
+		}
+
+		if _, ok := tracks[trackIds[i]]; !ok {
+			tracks[trackIds[i]] = &service.ProfilingData_Markers_Track{
+				Id:   int32(trackIds[i]),
+				Name: fmt.Sprintf("%v %v", processNames[i], threadNames[i]),
+			}
+		}
+	}
+
+	flat := make([]*service.ProfilingData_Markers_Track, 0, len(tracks))
+	for _, track := range tracks {
+		flat = append(flat, track)
+	}
+	sort.Slice(flat, func(i, j int) bool { return flat[i].Id < flat[j].Id })
+
+	return &service.ProfilingData_Markers{
+		Markers: markers,
+		Tracks:  flat,
+	}, nil
+}
+
+// submissionGroups returns the top level groups of the GPU slices of each
+// submission, keyed by the submission order. The reused submission IDs are
+// disambiguated by the time of the slices.
+func submissionGroups(slices *service.ProfilingData_GpuSlices, ordering *SubmissionOrdering) map[int][]int32 {
+	parents := map[int32]int32{}
+	for _, group := range slices.GetGroups() {
+		parents[group.Id] = group.ParentId
+	}
+
+	res := map[int][]int32{}
+	seen := map[int]map[int32]bool{}
+	for _, slice := range slices.GetSlices() {
+		id, ok := sliceSubmission(slice)
+		if !ok || slice.GroupId <= 0 {
+			continue
+		}
+		submission, ok := ordering.Lookup(id, int64(slice.Ts))
+		if !ok {
+			continue
+		}
+		group := slice.GroupId
+		for parents[group] != 0 {
+			group = parents[group]
+		}
+		if seen[submission] == nil {
+			seen[submission] = map[int32]bool{}
+		}
+		if !seen[submission][group] {
+			seen[submission][group] = true
+			res[submission] = append(res[submission], group)
+		}
+	}
+	return res
+}
+
+func sliceSubmission(slice *service.ProfilingData_GpuSlices_Slice) (int64, bool) {
+	return sliceExtraInt(slice, "submissionId")
+}
+
+// sliceExtraInt returns the value of the named integer extra of the slice.
+func sliceExtraInt(slice *service.ProfilingData_GpuSlices_Slice, name string) (int64, bool) {
+	for _, extra := range slice.Extras {
+		if extra.Name == name {
+			if v, ok := extra.Value.(*service.ProfilingData_GpuSlices_Slice_Extra_IntValue); ok {
+				return int64(v.IntValue), true
+			}
+		}
+	}
+	return 0, false
+}
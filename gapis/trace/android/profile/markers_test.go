@@ -0,0 +1,55 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSubmissionGroups(t *testing.T) {
+	ctx := log.Testing(t)
+
+	grouped := func(ts uint64, submission uint64, group int32) *service.ProfilingData_GpuSlices_Slice {
+		slice := testSlice(ts, 10, submission)
+		slice.GroupId = group
+		return slice
+	}
+	slices := &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1},
+			{Id: 2, ParentId: 1},
+			{Id: 3},
+			{Id: 4},
+		},
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			grouped(100, 5, 2),
+			grouped(110, 5, 1),
+			grouped(200, 6, 3),
+			grouped(300, 5, 4), // reuses the submission ID.
+			grouped(400, 7, 4), // unknown submission.
+		},
+	}
+	ordering := testOrdering([2]int64{5, 90}, [2]int64{6, 190}, [2]int64{5, 290})
+
+	groups := submissionGroups(slices, ordering)
+	assert.For(ctx, "submissions").That(len(groups)).Equals(3)
+	assert.For(ctx, "first").ThatSlice(groups[0]).Equals([]int32{1})
+	assert.For(ctx, "second").ThatSlice(groups[1]).Equals([]int32{3})
+	assert.For(ctx, "reused").ThatSlice(groups[2]).Equals([]int32{4})
+}
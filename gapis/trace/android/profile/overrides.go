@@ -0,0 +1,77 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/gapis/service"
+)
+
+const counterOverridesKey = contextKey("counterOverrides")
+
+// PutCounterOverrides attaches the overrides applied to the GPU counters
+// extracted by ProcessCounters to the context.
+func PutCounterOverrides(ctx context.Context, overrides *service.CounterOverrides) context.Context {
+	return keys.WithValue(ctx, counterOverridesKey, overrides)
+}
+
+// GetCounterOverrides returns the overrides attached to the context by
+// PutCounterOverrides, or nil if there are none.
+func GetCounterOverrides(ctx context.Context) *service.CounterOverrides {
+	val, _ := ctx.Value(counterOverridesKey).(*service.CounterOverrides)
+	return val
+}
+
+// applyCounterOverrides applies the overrides to the counters, matching them
+// by the name reported by the driver, and returns the counters that are not
+// hidden.
+func applyCounterOverrides(counters []*service.ProfilingData_Counter, overrides *service.CounterOverrides) []*service.ProfilingData_Counter {
+	if len(overrides.GetOverrides()) == 0 {
+		return counters
+	}
+	byName := map[string]*service.CounterOverrides_Override{}
+	for _, o := range overrides.Overrides {
+		byName[o.Name] = o
+	}
+
+	res := counters[:0]
+	for _, counter := range counters {
+		o, ok := byName[counter.Name]
+		if !ok {
+			res = append(res, counter)
+			continue
+		}
+		if o.Hide {
+			continue
+		}
+		if o.Rename != "" {
+			counter.Name = o.Rename
+		}
+		if o.Unit != "" {
+			counter.Unit = o.Unit
+			counter.UnitInferred = false
+		}
+		if o.SelectByDefault {
+			counter.Default = true
+		}
+		if o.HasAggregation {
+			counter.Aggregation = o.Aggregation
+		}
+		res = append(res, counter)
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestApplyCounterOverrides(t *testing.T) {
+	ctx := log.Testing(t)
+
+	counters := []*service.ProfilingData_Counter{
+		{Id: 1, Name: "GPU Freq", Unit: "Hz", Aggregation: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{Id: 2, Name: "Broken", Unit: "ns"},
+		{Id: 3, Name: "ALU Busy", Unit: "ns", Aggregation: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{Id: 4, Name: "Untouched", Unit: "%", Aggregation: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+	}
+	overrides := &service.CounterOverrides{
+		Overrides: []*service.CounterOverrides_Override{
+			// The aggregation is only overridden if has_aggregation is set.
+			{Name: "GPU Freq", Rename: "GPU Frequency", SelectByDefault: true, Aggregation: service.ProfilingData_GpuCounters_Metric_Maximum},
+			{Name: "Broken", Hide: true},
+			{Name: "ALU Busy", Unit: "%", Aggregation: service.ProfilingData_GpuCounters_Metric_Summation, HasAggregation: true},
+			{Name: "Missing", Hide: true},
+		},
+	}
+
+	got := applyCounterOverrides(counters, overrides)
+	assert.For(ctx, "count").That(len(got)).Equals(3)
+	for i, expected := range []struct {
+		id       uint32
+		name     string
+		unit     string
+		selected bool
+		op       service.ProfilingData_GpuCounters_Metric_AggregationOperator
+	}{
+		{1, "GPU Frequency", "Hz", true, service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{3, "ALU Busy", "%", false, service.ProfilingData_GpuCounters_Metric_Summation},
+		{4, "Untouched", "%", false, service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+	} {
+		if i >= len(got) {
+			break
+		}
+		assert.For(ctx, "id %d", i).That(got[i].Id).Equals(expected.id)
+		assert.For(ctx, "name %d", i).That(got[i].Name).Equals(expected.name)
+		assert.For(ctx, "unit %d", i).That(got[i].Unit).Equals(expected.unit)
+		assert.For(ctx, "default %d", i).That(got[i].Default).Equals(expected.selected)
+		assert.For(ctx, "aggregation %d", i).That(got[i].Aggregation).Equals(expected.op)
+	}
+}
+
+func TestCounterOverridesContext(t *testing.T) {
+	ctx := log.Testing(t)
+
+	assert.For(ctx, "unset").That(GetCounterOverrides(ctx)).IsNil()
+	overrides := &service.CounterOverrides{}
+	ctx = PutCounterOverrides(ctx, overrides)
+	assert.For(ctx, "set").That(GetCounterOverrides(ctx)).Equals(overrides)
+}
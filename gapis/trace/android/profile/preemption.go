@@ -0,0 +1,91 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// Preemptions are reported as slices on the render stage or vendor
+	// tracks, named after the preemption, e.g. "Preemption" or "Preempted".
+	preemptionsQuery = "" +
+		"SELECT ts, dur FROM gpu_slice WHERE name LIKE '%preempt%' ORDER BY ts"
+)
+
+// ComputePreemptions counts the GPU preemptions in each frame of gpuIdle and
+// attributes the time they added to the frame. Idle gaps mostly covered by a
+// preemption are attributed to the preemption. Traces without preemption
+// slices leave the frames untouched.
+func ComputePreemptions(ctx context.Context, processor perfetto.Querier, gpuIdle *service.ProfilingData_GpuIdle) error {
+	if len(gpuIdle.GetFrames()) == 0 {
+		return nil
+	}
+
+	preemptionsQueryResult, err := processor.Query(preemptionsQuery)
+	if err != nil {
+		return queryError(err, preemptionsQuery)
+	}
+	columns := preemptionsQueryResult.GetColumns()
+	timestamps := columns[0].GetLongValues()
+	durations := columns[1].GetLongValues()
+
+	for _, frame := range gpuIdle.Frames {
+		start, end := frame.Ts, frame.Ts+frame.Dur
+		for i := range timestamps {
+			ts, dur := uint64(timestamps[i]), uint64(durations[i])
+			if ts >= end {
+				break
+			}
+			if overlap := overlapOf(ts, ts+dur, start, end); overlap > 0 {
+				frame.Preemptions++
+				frame.PreemptionTime += overlap
+			}
+		}
+		if frame.Preemptions == 0 {
+			continue
+		}
+
+		for _, gap := range frame.Gaps {
+			covered := uint64(0)
+			for i := range timestamps {
+				ts := uint64(timestamps[i])
+				covered += overlapOf(ts, ts+uint64(durations[i]), gap.Ts, gap.Ts+gap.Dur)
+			}
+			if 2*covered > gap.Dur {
+				gap.Cause = service.ProfilingData_GpuIdle_Preemption
+			}
+		}
+	}
+	return nil
+}
+
+// overlapOf returns the length of the overlap of [aStart, aEnd) and
+// [bStart, bEnd).
+func overlapOf(aStart, aEnd, bStart, bEnd uint64) uint64 {
+	if bStart > aStart {
+		aStart = bStart
+	}
+	if bEnd < aEnd {
+		aEnd = bEnd
+	}
+	if aEnd <= aStart {
+		return 0
+	}
+	return aEnd - aStart
+}
@@ -0,0 +1,57 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputePreemptions(t *testing.T) {
+	ctx := log.Testing(t)
+
+	player := perfetto.QueryPlayer{
+		// A preemption within the first frame's gap, one spanning the end of
+		// the first frame and one after all frames.
+		preemptionsQuery: &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				{LongValues: []int64{20, 90, 500}},
+				{LongValues: []int64{20, 20, 10}},
+			},
+		},
+	}
+	idle := &service.ProfilingData_GpuIdle{
+		Frames: []*service.ProfilingData_GpuIdle_Frame{
+			{Ts: 0, Dur: 100, Gaps: []*service.ProfilingData_GpuIdle_Gap{
+				{Ts: 15, Dur: 30, Cause: service.ProfilingData_GpuIdle_SyncWait},
+				{Ts: 60, Dur: 10, Cause: service.ProfilingData_GpuIdle_LateSubmission},
+			}},
+			{Ts: 200, Dur: 100},
+		},
+	}
+	assert.For(ctx, "err").ThatError(ComputePreemptions(ctx, player, idle)).Succeeded()
+
+	first := idle.Frames[0]
+	assert.For(ctx, "preemptions").That(first.Preemptions).Equals(uint32(2))
+	assert.For(ctx, "preemption time").That(first.PreemptionTime).Equals(uint64(30))
+	assert.For(ctx, "covered gap").That(first.Gaps[0].Cause).Equals(service.ProfilingData_GpuIdle_Preemption)
+	assert.For(ctx, "other gap").That(first.Gaps[1].Cause).Equals(service.ProfilingData_GpuIdle_LateSubmission)
+	assert.For(ctx, "second frame").That(idle.Frames[1].Preemptions).Equals(uint32(0))
+}
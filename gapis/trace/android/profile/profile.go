@@ -18,6 +18,7 @@ import (
 	"context"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/core/math/f64"
@@ -36,8 +37,9 @@ const (
 func ComputeCounters(ctx context.Context, slices *service.ProfilingData_GpuSlices, counters []*service.ProfilingData_Counter) (*service.ProfilingData_GpuCounters, error) {
 	metrics := []*service.ProfilingData_GpuCounters_Metric{}
 
-	// Filter out the slices that are at depth 0 and belong to a command,
-	// then sort them based on the start time.
+	// Filter out the slices that are at depth 0 of a top level track and
+	// belong to a command, then sort them based on the start time. The slices
+	// of nested tracks overlap the slices of their parent tracks.
 	groupToEntry := map[int32]*service.ProfilingData_GpuCounters_Entry{}
 	groupToParent := map[int32]int32{}
 	for _, group := range slices.Groups {
@@ -47,9 +49,17 @@ func ComputeCounters(ctx context.Context, slices *service.ProfilingData_GpuSlice
 		}
 		groupToParent[group.Id] = group.ParentId
 	}
+	nestedTracks := map[int32]bool{}
+	trackGpus := map[int32]uint32{}
+	for _, track := range slices.Tracks {
+		nestedTracks[track.Id] = track.Depth > 0
+		if track.Gpu > 0 {
+			trackGpus[track.Id] = track.Gpu
+		}
+	}
 	filteredSlices := []*service.ProfilingData_GpuSlices_Slice{}
 	for i := 0; i < len(slices.Slices); i++ {
-		if slices.Slices[i].Depth == 0 && groupToEntry[slices.Slices[i].GroupId] != nil {
+		if slices.Slices[i].Depth == 0 && !nestedTracks[slices.Slices[i].TrackId] && groupToEntry[slices.Slices[i].GroupId] != nil {
 			filteredSlices = append(filteredSlices, slices.Slices[i])
 		}
 	}
@@ -73,7 +83,7 @@ func ComputeCounters(ctx context.Context, slices *service.ProfilingData_GpuSlice
 	setTimeMetrics(ctx, groupToSlices, &metrics, groupToEntry)
 
 	// Calculate GPU Counter Performances for all leaf groups/commands.
-	setGpuCounterMetrics(ctx, groupToSlices, counters, filteredSlices, &metrics, groupToEntry)
+	setGpuCounterMetrics(ctx, groupToSlices, trackGpus, counters, filteredSlices, &metrics, groupToEntry)
 
 	// Collect the entries.
 	entries := []*service.ProfilingData_GpuCounters_Entry{}
@@ -159,16 +169,16 @@ func gpuTimeForGroup(slices []*service.ProfilingData_GpuSlices_Slice) (uint64, u
 
 // Create GPU counter metric metadata, calculate counter performance for each
 // GPU slice group, and append the result to corresponding entries.
-func setGpuCounterMetrics(ctx context.Context, groupToSlices map[int32][]*service.ProfilingData_GpuSlices_Slice, counters []*service.ProfilingData_Counter, globalSlices []*service.ProfilingData_GpuSlices_Slice, metrics *[]*service.ProfilingData_GpuCounters_Metric, groupToEntry map[int32]*service.ProfilingData_GpuCounters_Entry) {
+func setGpuCounterMetrics(ctx context.Context, groupToSlices map[int32][]*service.ProfilingData_GpuSlices_Slice, trackGpus map[int32]uint32, counters []*service.ProfilingData_Counter, globalSlices []*service.ProfilingData_GpuSlices_Slice, metrics *[]*service.ProfilingData_GpuCounters_Metric, groupToEntry map[int32]*service.ProfilingData_GpuCounters_Entry) {
 	for i, counter := range counters {
 		metricId := counterMetricIdOffset + int32(i)
 		op := getCounterAggregationMethod(counter)
 		description := ""
-		selectByDefault := false
+		selectByDefault := counter.Default
 		counterGroups := []device.GpuCounterDescriptor_GpuCounterGroup{}
 		if counter.Spec != nil {
 			description = counter.Spec.Description
-			selectByDefault = counter.Spec.SelectByDefault
+			selectByDefault = selectByDefault || counter.Spec.SelectByDefault
 			counterGroups = counter.Spec.Groups
 		}
 		counterMetric := &service.ProfilingData_GpuCounters_Metric{
@@ -176,19 +186,23 @@ func setGpuCounterMetrics(ctx context.Context, groupToSlices map[int32][]*servic
 			CounterId:       counter.Id,
 			Name:            counter.Name,
 			Unit:            counter.Unit,
+			UnitInferred:    counter.UnitInferred,
 			Op:              op,
 			Description:     description,
 			SelectByDefault: selectByDefault,
 			CounterGroups:   counterGroups,
 		}
 		*metrics = append(*metrics, counterMetric)
-		if op != service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg {
-			log.E(ctx, "Counter aggregation method not implemented yet. Operation: %v", op)
-			continue
-		}
-		concurrentSlicesCount := scanConcurrency(globalSlices, counter)
-		counterPerfSum, counterPerfAvg := float64(0), float64(-1)
+		// Only the slices executed by the GPU of the counter are attributed
+		// its samples.
+		concurrentSlicesCount := scanConcurrency(slicesOnGpu(globalSlices, trackGpus, counter.Gpu), counter)
+		counterPerfSum, counterPerfAvg, groups := float64(0), float64(-1), 0
 		for groupId, slices := range groupToSlices {
+			slices = slicesOnGpu(slices, trackGpus, counter.Gpu)
+			if len(slices) == 0 {
+				continue
+			}
+			groups++
 			estimateSet, minSet, maxSet := mapCounterSamples(slices, counter, concurrentSlicesCount)
 			estimate := aggregateCounterSamples(estimateSet, counter)
 			counterPerfSum += estimate
@@ -213,8 +227,8 @@ func setGpuCounterMetrics(ctx context.Context, groupToSlices map[int32][]*servic
 				MaxSamples:      maxSet,
 			}
 		}
-		if len(groupToSlices) > 0 {
-			counterPerfAvg = counterPerfSum / float64(len(groupToSlices))
+		if groups > 0 {
+			counterPerfAvg = counterPerfSum / float64(groups)
 		}
 		counterMetric.Average = counterPerfAvg
 	}
@@ -302,6 +316,25 @@ func aggregateCounterSamples(sampleWeight map[int32]float64, counter *service.Pr
 		} else {
 			return -1
 		}
+	case service.ProfilingData_GpuCounters_Metric_Maximum:
+		max := float64(-1)
+		for idx, weight := range sampleWeight {
+			if weight > 0 {
+				max = f64.MaxOf(max, counter.Values[idx])
+			}
+		}
+		return max
+	case service.ProfilingData_GpuCounters_Metric_Rate:
+		ValueSum, timeSum := float64(0), float64(0)
+		for idx, weight := range sampleWeight {
+			ValueSum += counter.Values[idx] * weight
+			timeSum += float64(counter.Timestamps[idx]-counter.Timestamps[idx-1]) * weight
+		}
+		if timeSum != 0 {
+			return ValueSum / (timeSum / float64(time.Second))
+		} else {
+			return -1
+		}
 	default:
 		return -1
 	}
@@ -309,6 +342,62 @@ func aggregateCounterSamples(sampleWeight map[int32]float64, counter *service.Pr
 
 // Evaluate and return the appropriate aggregation method for a GPU counter.
 func getCounterAggregationMethod(counter *service.ProfilingData_Counter) service.ProfilingData_GpuCounters_Metric_AggregationOperator {
-	// TODO: Use time-weighted average to aggregate all counters for now. May need vendor's support. Bug tracked with b/158057709.
-	return service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg
+	return counter.Aggregation
+}
+
+// CounterAggregation infers the aggregation method of a GPU counter from the
+// units of its spec. Counters that count events or quantities within each
+// sample period are summed up, temperatures use the maximum and everything
+// else, such as rates, percentages and frequencies, uses the time-weighted
+// average. Rate is never inferred, it is selected by a counter override.
+func CounterAggregation(spec *device.GpuCounterDescriptor_GpuCounterSpec) service.ProfilingData_GpuCounters_Metric_AggregationOperator {
+	if spec == nil || len(spec.NumeratorUnits) == 0 {
+		return service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg
+	}
+	for _, unit := range spec.NumeratorUnits {
+		switch unit {
+		case device.GpuCounterDescriptor_CELSIUS,
+			device.GpuCounterDescriptor_FAHRENHEIT,
+			device.GpuCounterDescriptor_KELVIN:
+			return service.ProfilingData_GpuCounters_Metric_Maximum
+		}
+	}
+	if len(spec.DenominatorUnits) != 0 {
+		return service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg
+	}
+	for _, unit := range spec.NumeratorUnits {
+		if !isCountableUnit(unit) {
+			return service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg
+		}
+	}
+	return service.ProfilingData_GpuCounters_Metric_Summation
+}
+
+// isCountableUnit returns whether samples of the unit are amounts accumulated
+// over the sample period, rather than instantaneous values.
+func isCountableUnit(unit device.GpuCounterDescriptor_MeasureUnit) bool {
+	switch unit {
+	case device.GpuCounterDescriptor_BIT,
+		device.GpuCounterDescriptor_KILOBIT,
+		device.GpuCounterDescriptor_MEGABIT,
+		device.GpuCounterDescriptor_GIGABIT,
+		device.GpuCounterDescriptor_TERABIT,
+		device.GpuCounterDescriptor_PETABIT,
+		device.GpuCounterDescriptor_BYTE,
+		device.GpuCounterDescriptor_KILOBYTE,
+		device.GpuCounterDescriptor_MEGABYTE,
+		device.GpuCounterDescriptor_GIGABYTE,
+		device.GpuCounterDescriptor_TERABYTE,
+		device.GpuCounterDescriptor_PETABYTE,
+		device.GpuCounterDescriptor_VERTEX,
+		device.GpuCounterDescriptor_PIXEL,
+		device.GpuCounterDescriptor_TRIANGLE,
+		device.GpuCounterDescriptor_PRIMITIVE,
+		device.GpuCounterDescriptor_FRAGMENT,
+		device.GpuCounterDescriptor_INSTRUCTION,
+		device.GpuCounterDescriptor_JOULE:
+		return true
+	default:
+		return false
+	}
 }
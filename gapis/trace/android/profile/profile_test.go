@@ -0,0 +1,71 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCounterAggregation(t *testing.T) {
+	ctx := log.Testing(t)
+	spec := func(num, denom []device.GpuCounterDescriptor_MeasureUnit) *device.GpuCounterDescriptor_GpuCounterSpec {
+		return &device.GpuCounterDescriptor_GpuCounterSpec{NumeratorUnits: num, DenominatorUnits: denom}
+	}
+	units := func(u ...device.GpuCounterDescriptor_MeasureUnit) []device.GpuCounterDescriptor_MeasureUnit {
+		return u
+	}
+
+	for _, test := range []struct {
+		name     string
+		spec     *device.GpuCounterDescriptor_GpuCounterSpec
+		expected service.ProfilingData_GpuCounters_Metric_AggregationOperator
+	}{
+		{"nil", nil, service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{"no units", spec(nil, nil), service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{"vertices", spec(units(device.GpuCounterDescriptor_VERTEX), nil), service.ProfilingData_GpuCounters_Metric_Summation},
+		{"bytes/second", spec(units(device.GpuCounterDescriptor_BYTE), units(device.GpuCounterDescriptor_SECOND)), service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{"percent", spec(units(device.GpuCounterDescriptor_PERCENT), nil), service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg},
+		{"temperature", spec(units(device.GpuCounterDescriptor_CELSIUS), nil), service.ProfilingData_GpuCounters_Metric_Maximum},
+	} {
+		assert.For(ctx, test.name).That(CounterAggregation(test.spec)).Equals(test.expected)
+	}
+}
+
+func TestAggregateCounterSamples(t *testing.T) {
+	ctx := log.Testing(t)
+	counter := &service.ProfilingData_Counter{
+		Timestamps: []uint64{0, 100000000, 200000000, 800000000},
+		Values:     []float64{0, 10, 20, 60},
+	}
+	weights := map[int32]float64{1: 1, 2: 1, 3: 0.5}
+
+	for _, test := range []struct {
+		op       service.ProfilingData_GpuCounters_Metric_AggregationOperator
+		expected float64
+	}{
+		{service.ProfilingData_GpuCounters_Metric_Summation, 60},
+		{service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg, 42},
+		{service.ProfilingData_GpuCounters_Metric_Maximum, 60},
+		{service.ProfilingData_GpuCounters_Metric_Rate, 120},
+	} {
+		counter.Aggregation = test.op
+		assert.For(ctx, test.op.String()).That(aggregateCounterSamples(weights, counter)).Equals(test.expected)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// The shares of the GPU, or frame, time above which a finding is a
+	// warning, or critical.
+	warningShare  = 0.05
+	criticalShare = 0.2
+	// loadStoreShare is the share of the GPU time spent loading and storing
+	// attachments above which it is reported.
+	loadStoreShare = 0.1
+)
+
+// loadStoreKeywords and sysmemKeywords are keywords of the vendor render
+// stage names of the slices that load or store attachments, and that render
+// to system memory, e.g. the Adreno "GMEM Load" and "Sysmem Render" stages.
+var (
+	loadStoreKeywords = []string{"load", "store"}
+	sysmemKeywords    = []string{"sysmem", "bypass"}
+)
+
+// ComputeRecommendations consolidates the findings of the analyses of the
+// data into a list of recommendations, most severe first. The data's engine,
+// GPU idle time, utilization, frame budget and submissions should have been
+// computed.
+func ComputeRecommendations(data *service.ProfilingData) []*service.ProfilingData_Recommendation {
+	gpuTime := data.GetUtilization().GetBusy()
+	frameTime := uint64(0)
+	for _, frame := range data.GetGpuIdle().GetFrames() {
+		frameTime += frame.Dur
+	}
+
+	res := []*service.ProfilingData_Recommendation{}
+	res = append(res, enginePassRecommendations(data.GetEngine(), gpuTime)...)
+	if r := sliceRecommendation(data.GetSlices(), gpuTime, loadStoreKeywords, loadStoreShare); r != nil {
+		r.Kind = service.ProfilingData_Recommendation_LoadStoreWaste
+		r.Description = fmt.Sprintf("Loading and storing attachments takes %.0f%% of the GPU time, "+
+			"consider using DONT_CARE load and store ops for attachments that aren't reused.", 100*shareOf(r.EstimatedSavings, gpuTime))
+		res = append(res, r)
+	}
+	if r := sliceRecommendation(data.GetSlices(), gpuTime, sysmemKeywords, 0); r != nil {
+		r.Kind = service.ProfilingData_Recommendation_SysmemFallback
+		r.Description = fmt.Sprintf("%d render passes were rendered to system memory, rather than to the tile memory, "+
+			"consider reducing their attachments or avoiding features that prevent tiled rendering.", len(r.GroupIds))
+		// Rendering to system memory may still be faster than tiling.
+		r.EstimatedSavings = 0
+		if r.Severity == service.ProfilingData_Recommendation_Critical {
+			r.Severity = service.ProfilingData_Recommendation_Warning
+		}
+		res = append(res, r)
+	}
+	if r := syncStallRecommendation(data.GetGpuIdle(), frameTime); r != nil {
+		res = append(res, r)
+	}
+	if r := schedulingRecommendation(data.GetGpuIdle()); r != nil {
+		res = append(res, r)
+	}
+	if r := frameBudgetRecommendation(data.GetGpuIdle(), data.GetFrameBudget(), frameTime); r != nil {
+		res = append(res, r)
+	}
+	if r := batchingRecommendation(data.GetSubmissions(), frameTime); r != nil {
+		res = append(res, r)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Severity != res[j].Severity {
+			return res[i].Severity > res[j].Severity
+		}
+		return res[i].EstimatedSavings > res[j].EstimatedSavings
+	})
+	return res
+}
+
+// shareOf returns part relative to total, or zero if total is zero.
+func shareOf(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// severityOf returns the severity of a finding affecting the given share of
+// the time.
+func severityOf(s float64) service.ProfilingData_Recommendation_Severity {
+	switch {
+	case s >= criticalShare:
+		return service.ProfilingData_Recommendation_Critical
+	case s >= warningShare:
+		return service.ProfilingData_Recommendation_Warning
+	default:
+		return service.ProfilingData_Recommendation_Info
+	}
+}
+
+// enginePassRecommendations returns a recommendation for each pass of the
+// engine taking more than its pass's threshold of the GPU time. The time above
+// the threshold is the estimated savings.
+func enginePassRecommendations(engine *service.ProfilingData_Engine, gpuTime uint64) []*service.ProfilingData_Recommendation {
+	total := uint64(0)
+	for _, pass := range engine.GetPasses() {
+		total += pass.GpuTime
+	}
+	if gpuTime > total {
+		total = gpuTime
+	}
+	if total == 0 {
+		return nil
+	}
+
+	res := []*service.ProfilingData_Recommendation{}
+	for _, pass := range engine.GetPasses() {
+		spec := enginePassByName(engine.Kind, pass.Name)
+		s := shareOf(pass.GpuTime, total)
+		if spec == nil || spec.advice == "" || s <= spec.threshold {
+			continue
+		}
+		res = append(res, &service.ProfilingData_Recommendation{
+			Kind:             service.ProfilingData_Recommendation_EnginePass,
+			Severity:         severityOf(s - spec.threshold),
+			Description:      fmt.Sprintf("%v takes %.0f%% of the GPU time, %v.", pass.Name, 100*s, spec.advice),
+			GroupIds:         pass.GroupIds,
+			EstimatedSavings: pass.GpuTime - uint64(spec.threshold*float64(total)),
+		})
+	}
+	return res
+}
+
+// enginePassByName returns the pass of the engine with the given name, or nil
+// if there is none.
+func enginePassByName(engine service.ProfilingData_Engine_Kind, name string) *enginePass {
+	for i := range enginePasses {
+		if pass := &enginePasses[i]; pass.engine == engine && pass.name == name {
+			return pass
+		}
+	}
+	return nil
+}
+
+// sliceRecommendation returns a recommendation for the slices whose label
+// contains any of the keywords, if their total duration exceeds the given
+// share of the GPU time. The groups of the slices are the affected groups and
+// their duration the estimated savings.
+func sliceRecommendation(slices *service.ProfilingData_GpuSlices, gpuTime uint64, keywords []string, threshold float64) *service.ProfilingData_Recommendation {
+	dur := uint64(0)
+	seen := map[int32]bool{}
+	groups := []int32{}
+	for _, slice := range slices.GetSlices() {
+		if !containsAny(strings.ToLower(slice.Label), keywords) {
+			continue
+		}
+		dur += slice.Dur
+		if slice.GroupId != 0 && !seen[slice.GroupId] {
+			seen[slice.GroupId] = true
+			groups = append(groups, slice.GroupId)
+		}
+	}
+	if dur == 0 || shareOf(dur, gpuTime) <= threshold {
+		return nil
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return &service.ProfilingData_Recommendation{
+		Severity:         severityOf(shareOf(dur, gpuTime)),
+		GroupIds:         groups,
+		EstimatedSavings: dur,
+	}
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncStallRecommendation returns a recommendation for the frames in which
+// the GPU was idle waiting on semaphores or fences, or nil if there are none.
+func syncStallRecommendation(gpuIdle *service.ProfilingData_GpuIdle, frameTime uint64) *service.ProfilingData_Recommendation {
+	res := &service.ProfilingData_Recommendation{Kind: service.ProfilingData_Recommendation_SyncStall}
+	for _, frame := range gpuIdle.GetFrames() {
+		stalled := uint64(0)
+		for _, gap := range frame.Gaps {
+			if gap.Cause == service.ProfilingData_GpuIdle_SyncWait {
+				stalled += gap.Dur
+			}
+		}
+		if stalled > 0 {
+			res.FrameIds = append(res.FrameIds, frame.FrameId)
+			res.EstimatedSavings += stalled
+		}
+	}
+	if len(res.FrameIds) == 0 {
+		return nil
+	}
+	res.Severity = severityOf(shareOf(res.EstimatedSavings, frameTime))
+	res.Description = fmt.Sprintf("The GPU waited %v on semaphores or fences in %d frames, "+
+		"consider removing unnecessary synchronization between the queue submissions.",
+		time.Duration(res.EstimatedSavings), len(res.FrameIds))
+	return res
+}
+
+// schedulingRecommendation returns a recommendation for the frames with
+// scheduler issues, or nil if there are none.
+func schedulingRecommendation(gpuIdle *service.ProfilingData_GpuIdle) *service.ProfilingData_Recommendation {
+	res := &service.ProfilingData_Recommendation{Kind: service.ProfilingData_Recommendation_Scheduling}
+	for _, frame := range gpuIdle.GetFrames() {
+		if len(frame.SchedulerIssues) > 0 {
+			res.FrameIds = append(res.FrameIds, frame.FrameId)
+		}
+	}
+	if len(res.FrameIds) == 0 {
+		return nil
+	}
+	res.Severity = severityOf(shareOf(uint64(len(res.FrameIds)), uint64(len(gpuIdle.Frames))))
+	res.Description = fmt.Sprintf("The critical threads were slowed down by the scheduler in %d of %d frames, "+
+		"consider setting the thread affinity or using the performance hint API.", len(res.FrameIds), len(gpuIdle.Frames))
+	return res
+}
+
+// frameBudgetRecommendation returns a recommendation for the frames that
+// exceeded the frame budget, or nil if there are none. The time above the
+// budget is the estimated savings.
+func frameBudgetRecommendation(gpuIdle *service.ProfilingData_GpuIdle, budget *service.ProfilingData_FrameBudget, frameTime uint64) *service.ProfilingData_Recommendation {
+	if budget.GetExceededFrames() == 0 {
+		return nil
+	}
+	res := &service.ProfilingData_Recommendation{Kind: service.ProfilingData_Recommendation_FrameBudget}
+	for _, frame := range gpuIdle.GetFrames() {
+		if frame.Dur > budget.Budget {
+			res.FrameIds = append(res.FrameIds, frame.FrameId)
+			res.EstimatedSavings += frame.Dur - budget.Budget
+		}
+	}
+	res.Severity = severityOf(shareOf(res.EstimatedSavings, frameTime))
+	res.Description = fmt.Sprintf("%d of %d frames exceeded the frame budget of %v.",
+		budget.ExceededFrames, len(budget.Frames), time.Duration(budget.Budget))
+	return res
+}
+
+// batchingRecommendation returns a recommendation for the frames split into
+// many small queue submissions, or nil if there are none. The GPU idle time
+// between their submissions is the estimated savings.
+func batchingRecommendation(submissions *service.ProfilingData_Submissions, frameTime uint64) *service.ProfilingData_Recommendation {
+	res := &service.ProfilingData_Recommendation{Kind: service.ProfilingData_Recommendation_SubmitBatching}
+	submits := uint32(0)
+	for _, frame := range submissions.GetFrames() {
+		if frame.Submits >= batchingSubmits && frame.MeanGpuTime < smallSubmitTime {
+			res.FrameIds = append(res.FrameIds, frame.FrameId)
+			res.EstimatedSavings += frame.GapTime
+			submits += frame.Submits
+		}
+	}
+	if len(res.FrameIds) == 0 {
+		return nil
+	}
+	res.Severity = severityOf(shareOf(res.EstimatedSavings, frameTime))
+	res.Description = fmt.Sprintf("%d frames issued %d queue submissions on average, with the GPU idle for %v between them, "+
+		"consider batching the command buffers of a frame into fewer vkQueueSubmit calls.",
+		len(res.FrameIds), submits/uint32(len(res.FrameIds)), time.Duration(submissions.GapPerSubmit))
+	return res
+}
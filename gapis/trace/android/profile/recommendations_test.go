@@ -0,0 +1,88 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeRecommendations(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Label: "Render", Dur: 75, GroupId: 1},
+				{Label: "GMEM Store", Dur: 20, GroupId: 2},
+				{Label: "GMEM Load", Dur: 5, GroupId: 2},
+			},
+		},
+		Engine: &service.ProfilingData_Engine{
+			Kind: service.ProfilingData_Engine_Unreal,
+			Passes: []*service.ProfilingData_Engine_Pass{
+				{Name: "Shadows", GroupIds: []int32{1}, GpuTime: 60},
+				{Name: "BasePass", GroupIds: []int32{2}, GpuTime: 30},
+			},
+		},
+		GpuIdle: &service.ProfilingData_GpuIdle{
+			Frames: []*service.ProfilingData_GpuIdle_Frame{
+				{FrameId: 1, Dur: 100, Gaps: []*service.ProfilingData_GpuIdle_Gap{
+					{Dur: 10, Cause: service.ProfilingData_GpuIdle_SyncWait},
+					{Dur: 5, Cause: service.ProfilingData_GpuIdle_LateSubmission},
+				}},
+				{FrameId: 2, Dur: 100},
+			},
+		},
+		Utilization: &service.ProfilingData_Utilization{Busy: 100},
+	}
+
+	got := ComputeRecommendations(data)
+	assert.For(ctx, "count").That(len(got)).Equals(3)
+	for i, expected := range []struct {
+		kind     service.ProfilingData_Recommendation_Kind
+		severity service.ProfilingData_Recommendation_Severity
+		savings  uint64
+	}{
+		{service.ProfilingData_Recommendation_EnginePass, service.ProfilingData_Recommendation_Critical, 40},
+		{service.ProfilingData_Recommendation_LoadStoreWaste, service.ProfilingData_Recommendation_Critical, 25},
+		{service.ProfilingData_Recommendation_SyncStall, service.ProfilingData_Recommendation_Warning, 10},
+	} {
+		if i >= len(got) {
+			break
+		}
+		assert.For(ctx, "kind %d", i).That(got[i].Kind).Equals(expected.kind)
+		assert.For(ctx, "severity %d", i).That(got[i].Severity).Equals(expected.severity)
+		assert.For(ctx, "savings %d", i).That(got[i].EstimatedSavings).Equals(expected.savings)
+	}
+	if len(got) == 3 {
+		assert.For(ctx, "engine groups").ThatSlice(got[0].GroupIds).Equals([]int32{1})
+		assert.For(ctx, "load/store groups").ThatSlice(got[1].GroupIds).Equals([]int32{2})
+		assert.For(ctx, "stalled frames").ThatSlice(got[2].FrameIds).Equals([]int64{1})
+	}
+
+	data.FrameBudget = ComputeFrameBudget(data, 90)
+	got = ComputeRecommendations(data)
+	assert.For(ctx, "with budget").That(len(got)).Equals(4)
+	if len(got) == 4 {
+		// The budget saves more than the sync stalls, at the same severity.
+		assert.For(ctx, "budget kind").That(got[2].Kind).Equals(service.ProfilingData_Recommendation_FrameBudget)
+		assert.For(ctx, "budget frames").ThatSlice(got[2].FrameIds).Equals([]int64{1, 2})
+		assert.For(ctx, "budget savings").That(got[2].EstimatedSavings).Equals(uint64(20))
+	}
+}
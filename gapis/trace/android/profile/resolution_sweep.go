@@ -0,0 +1,98 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// resolutionBoundFraction is the fraction of the GPU time of a group at full
+// resolution above which the group is considered resolution bound.
+const resolutionBoundFraction = 0.5
+
+// ComputeResolutionSweep compares the profiling data of the replays at the
+// given resolution scales. The groups found at every scale are matched by
+// name, and their GPU time is fitted as a fixed cost plus a cost proportional
+// to the number of pixels, i.e. the square of the scale.
+func ComputeResolutionSweep(scales []float32, profiles []*service.ProfilingData) *service.ProfilingData_ResolutionSweep {
+	order := make([]int, len(scales))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scales[order[i]] > scales[order[j]] })
+
+	res := &service.ProfilingData_ResolutionSweep{}
+	times := make([]map[string]uint64, len(order))
+	for i, idx := range order {
+		res.Scales = append(res.Scales, scales[idx])
+		times[i] = groupGpuTimes(profiles[idx])
+		total := uint64(0)
+		for _, dur := range times[i] {
+			total += dur
+		}
+		res.GpuTimes = append(res.GpuTimes, total)
+	}
+	if len(times) == 0 {
+		return res
+	}
+
+	for name := range times[0] {
+		g := &service.ProfilingData_ResolutionSweep_Group{Name: name}
+		for _, t := range times {
+			dur, ok := t[name]
+			if !ok {
+				g = nil
+				break
+			}
+			g.GpuTimes = append(g.GpuTimes, dur)
+		}
+		if g == nil {
+			continue
+		}
+		g.FixedTime, g.PixelTime = fitPixelCost(res.Scales, g.GpuTimes)
+		if full := g.FixedTime + g.PixelTime; full > 0 {
+			g.PixelFraction = math.Max(0, math.Min(1, g.PixelTime/full))
+		}
+		g.ResolutionBound = g.PixelFraction >= resolutionBoundFraction
+		res.Groups = append(res.Groups, g)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		if res.Groups[i].PixelTime != res.Groups[j].PixelTime {
+			return res.Groups[i].PixelTime > res.Groups[j].PixelTime
+		}
+		return res.Groups[i].Name < res.Groups[j].Name
+	})
+	return res
+}
+
+// fitPixelCost returns the least squares fit of the times as fixed + pixel *
+// scale^2. With a single distinct scale, all of the time is assumed to be
+// fixed.
+func fitPixelCost(scales []float32, times []uint64) (fixed, pixel float64) {
+	n := float64(len(times))
+	var sx, sy, sxx, sxy float64
+	for i, t := range times {
+		x, y := float64(scales[i])*float64(scales[i]), float64(t)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	if d := n*sxx - sx*sx; d > 1e-9 {
+		pixel = (n*sxy - sx*sy) / d
+	}
+	fixed = (sy - pixel*sx) / n
+	return fixed, pixel
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeResolutionSweep(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// The shadows have a fixed cost, the lighting scales with the pixels.
+	res := ComputeResolutionSweep([]float32{0.5, 1}, []*service.ProfilingData{
+		shadowsAndLighting(100, 200),
+		shadowsAndLighting(100, 500),
+	})
+	assert.For(ctx, "scales").ThatSlice(res.Scales).Equals([]float32{1, 0.5})
+	assert.For(ctx, "gpu times").ThatSlice(res.GpuTimes).Equals([]uint64{600, 300})
+	assert.For(ctx, "groups").ThatSlice(res.Groups).DeepEquals([]*service.ProfilingData_ResolutionSweep_Group{
+		{Name: "Lighting", GpuTimes: []uint64{500, 200}, FixedTime: 100, PixelTime: 400, PixelFraction: 0.8, ResolutionBound: true},
+		{Name: "Shadows", GpuTimes: []uint64{100, 100}, FixedTime: 100, PixelTime: 0, PixelFraction: 0, ResolutionBound: false},
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"regexp"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// samplingMetricPattern matches the names of the counters reported by the
+// sampler sweep: those of the texture units, of the memory bandwidth and of
+// the fragment shading.
+var samplingMetricPattern = regexp.MustCompile(`(?i)tex|sampl|bandwidth|\bread\b|bytes|fragment`)
+
+// ComputeSamplerSweep compares the profiling data of the original replay to
+// those of the replays with each of the sampler overrides.
+func ComputeSamplerSweep(original *service.ProfilingData, overrides []*service.SamplerOverride, profiles []*service.ProfilingData) *service.ProfilingData_SamplerSweep {
+	res := &service.ProfilingData_SamplerSweep{}
+	base := samplerSweepStep(nil, original)
+	res.Steps = append(res.Steps, base)
+	for i, o := range overrides {
+		step := samplerSweepStep(o, profiles[i])
+		if base.GpuTime > 0 {
+			step.Change = (float64(step.GpuTime) - float64(base.GpuTime)) / float64(base.GpuTime)
+		}
+		if -step.Change > res.Sensitivity {
+			res.Sensitivity = -step.Change
+		}
+		res.Steps = append(res.Steps, step)
+	}
+	return res
+}
+
+func samplerSweepStep(o *service.SamplerOverride, data *service.ProfilingData) *service.ProfilingData_SamplerSweep_Step {
+	step := &service.ProfilingData_SamplerSweep_Step{Override: o}
+	for _, s := range data.GetSlices().GetSlices() {
+		if s.Depth != 0 {
+			continue
+		}
+		step.GpuTime += s.Dur
+		if s.Category == service.ProfilingData_GpuSlices_Slice_Fragment {
+			step.FragmentTime += s.Dur
+		}
+	}
+	for _, m := range data.GetGpuCounters().GetMetrics() {
+		if samplingMetricPattern.MatchString(m.Name) {
+			step.Metrics = append(step.Metrics, m)
+		}
+	}
+	return step
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeSamplerSweep(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// The shadows are vertex work, the lighting fragment work. Nested
+	// slices don't count.
+	profile := func(vertex, fragment uint64, reads float64) *service.ProfilingData {
+		groups := []testGroup{
+			{name: "Shadows", dur: vertex, category: service.ProfilingData_GpuSlices_Slice_Vertex},
+			{name: "Lighting", dur: fragment, category: service.ProfilingData_GpuSlices_Slice_Fragment},
+		}
+		return groupProfile(groups,
+			&service.ProfilingData_GpuCounters_Metric{Name: "Texture Memory Read BW (Bytes/sec)", Unit: "B/s", Average: reads},
+			&service.ProfilingData_GpuCounters_Metric{Name: "GPU Frequency", Unit: "Hz", Average: 5e8})
+	}
+
+	bias := &service.SamplerOverride{LodBias: 1}
+	nearest := &service.SamplerOverride{NearestFiltering: true}
+	res := ComputeSamplerSweep(profile(200, 800, 4e9),
+		[]*service.SamplerOverride{bias, nearest},
+		[]*service.ProfilingData{profile(200, 600, 2e9), profile(200, 700, 3e9)})
+
+	assert.For(ctx, "steps").That(len(res.Steps)).Equals(3)
+	for i, expected := range []struct {
+		override *service.SamplerOverride
+		gpuTime  uint64
+		fragment uint64
+		change   float64
+		reads    float64
+	}{
+		{nil, 1000, 800, 0, 4e9},
+		{bias, 800, 600, -0.2, 2e9},
+		{nearest, 900, 700, -0.1, 3e9},
+	} {
+		step := res.Steps[i]
+		assert.For(ctx, "override").That(step.Override).Equals(expected.override)
+		assert.For(ctx, "gpu time").That(step.GpuTime).Equals(expected.gpuTime)
+		assert.For(ctx, "fragment time").That(step.FragmentTime).Equals(expected.fragment)
+		assert.For(ctx, "change").That(step.Change).Equals(expected.change)
+		assert.For(ctx, "metrics").That(len(step.Metrics)).Equals(1)
+		assert.For(ctx, "reads").That(step.Metrics[0].Average).Equals(expected.reads)
+	}
+	assert.For(ctx, "sensitivity").That(res.Sensitivity).Equals(0.2)
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// CompareShaderAB compares the profiling data of the original capture to that
+// of the capture with a shader replaced. As the replacement doesn't change
+// the commands, the groups and metrics of the profiles are matched by name.
+func CompareShaderAB(original, replaced *service.ProfilingData) *service.ProfilingData_ShaderAB {
+	res := &service.ProfilingData_ShaderAB{}
+
+	groups := map[string]*service.ProfilingData_ShaderAB_Group{}
+	group := func(name string) *service.ProfilingData_ShaderAB_Group {
+		g, ok := groups[name]
+		if !ok {
+			g = &service.ProfilingData_ShaderAB_Group{Name: name}
+			groups[name] = g
+			res.Groups = append(res.Groups, g)
+		}
+		return g
+	}
+	for name, dur := range groupGpuTimes(original) {
+		group(name).GpuTime = dur
+		res.GpuTime += dur
+	}
+	for name, dur := range groupGpuTimes(replaced) {
+		group(name).ReplacedGpuTime = dur
+		res.ReplacedGpuTime += dur
+	}
+	if res.GpuTime > 0 {
+		res.Change = (float64(res.ReplacedGpuTime) - float64(res.GpuTime)) / float64(res.GpuTime)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		di, dj := groupDifference(res.Groups[i]), groupDifference(res.Groups[j])
+		if di != dj {
+			return di > dj
+		}
+		return res.Groups[i].Name < res.Groups[j].Name
+	})
+
+	metrics := map[string]*service.ProfilingData_ShaderAB_Metric{}
+	metric := func(m *service.ProfilingData_GpuCounters_Metric) *service.ProfilingData_ShaderAB_Metric {
+		ab, ok := metrics[m.Name]
+		if !ok {
+			ab = &service.ProfilingData_ShaderAB_Metric{Name: m.Name, Unit: m.Unit}
+			metrics[m.Name] = ab
+			res.Metrics = append(res.Metrics, ab)
+		}
+		return ab
+	}
+	for _, m := range original.GetGpuCounters().GetMetrics() {
+		metric(m).Average = m.Average
+	}
+	for _, m := range replaced.GetGpuCounters().GetMetrics() {
+		metric(m).ReplacedAverage = m.Average
+	}
+	return res
+}
+
+// groupGpuTimes returns the total duration of the top level GPU slices of
+// each group, by group name. Slices without a group are skipped.
+func groupGpuTimes(data *service.ProfilingData) map[string]uint64 {
+	names := map[int32]string{}
+	for _, g := range data.GetSlices().GetGroups() {
+		names[g.Id] = g.Name
+	}
+	res := map[string]uint64{}
+	for _, s := range data.GetSlices().GetSlices() {
+		if name, ok := names[s.GroupId]; ok && s.Depth == 0 {
+			res[name] += s.Dur
+		}
+	}
+	return res
+}
+
+// groupDifference returns the absolute GPU time difference of the group.
+func groupDifference(g *service.ProfilingData_ShaderAB_Group) uint64 {
+	if g.ReplacedGpuTime > g.GpuTime {
+		return g.ReplacedGpuTime - g.GpuTime
+	}
+	return g.GpuTime - g.ReplacedGpuTime
+}
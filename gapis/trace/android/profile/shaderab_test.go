@@ -0,0 +1,77 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+// testGroup is a group of the GPU slices of a test profile.
+type testGroup struct {
+	name string
+	// The duration of the top level slice of the group.
+	dur      uint64
+	category service.ProfilingData_GpuSlices_Slice_Category
+}
+
+// groupProfile returns a profile with a top level slice, and a nested slice
+// of the same duration, of each of the groups, and the counter metrics.
+func groupProfile(groups []testGroup, metrics ...*service.ProfilingData_GpuCounters_Metric) *service.ProfilingData {
+	data := &service.ProfilingData{
+		Slices:      &service.ProfilingData_GpuSlices{},
+		GpuCounters: &service.ProfilingData_GpuCounters{Metrics: metrics},
+	}
+	for i, g := range groups {
+		id := int32(i + 1)
+		data.Slices.Groups = append(data.Slices.Groups, &service.ProfilingData_GpuSlices_Group{Id: id, Name: g.name})
+		data.Slices.Slices = append(data.Slices.Slices,
+			&service.ProfilingData_GpuSlices_Slice{GroupId: id, Dur: g.dur, Category: g.category},
+			&service.ProfilingData_GpuSlices_Slice{GroupId: id, Dur: g.dur, Category: g.category, Depth: 1})
+	}
+	return data
+}
+
+// shadowsAndLighting returns a profile of a shadow pass and a lighting pass
+// of the given durations, and the counter metrics.
+func shadowsAndLighting(shadow, lighting uint64, metrics ...*service.ProfilingData_GpuCounters_Metric) *service.ProfilingData {
+	return groupProfile([]testGroup{{name: "Shadows", dur: shadow}, {name: "Lighting", dur: lighting}}, metrics...)
+}
+
+func TestCompareShaderAB(t *testing.T) {
+	ctx := log.Testing(t)
+
+	profile := func(shadow, lighting uint64, busy float64) *service.ProfilingData {
+		data := shadowsAndLighting(shadow, lighting, &service.ProfilingData_GpuCounters_Metric{Name: "Shaders Busy", Unit: "%", Average: busy})
+		// Nested and ungrouped slices don't count.
+		data.Slices.Slices = append(data.Slices.Slices, &service.ProfilingData_GpuSlices_Slice{GroupId: -1, Dur: 1000})
+		return data
+	}
+
+	res := CompareShaderAB(profile(100, 300, 80), profile(100, 200, 60))
+	assert.For(ctx, "gpu time").That(res.GpuTime).Equals(uint64(400))
+	assert.For(ctx, "replaced gpu time").That(res.ReplacedGpuTime).Equals(uint64(300))
+	assert.For(ctx, "change").That(res.Change).Equals(-0.25)
+	assert.For(ctx, "groups").ThatSlice(res.Groups).DeepEquals([]*service.ProfilingData_ShaderAB_Group{
+		{Name: "Lighting", GpuTime: 300, ReplacedGpuTime: 200},
+		{Name: "Shadows", GpuTime: 100, ReplacedGpuTime: 100},
+	})
+	assert.For(ctx, "metrics").ThatSlice(res.Metrics).DeepEquals([]*service.ProfilingData_ShaderAB_Metric{
+		{Name: "Shaders Busy", Unit: "%", Average: 80, ReplacedAverage: 60},
+	})
+}
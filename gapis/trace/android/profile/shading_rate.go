@@ -0,0 +1,61 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// CompareShadingRate compares the profiling data of the original replay to
+// that of the replay at a coarser shading rate. The groups found in both
+// replays are matched by name.
+func CompareShadingRate(original, coarse *service.ProfilingData) *service.ProfilingData_ShadingRate {
+	res := &service.ProfilingData_ShadingRate{}
+	coarseTimes := groupGpuTimes(coarse)
+	for name, dur := range groupGpuTimes(original) {
+		coarseDur, ok := coarseTimes[name]
+		if !ok {
+			continue
+		}
+		res.Groups = append(res.Groups, &service.ProfilingData_ShadingRate_Group{
+			Name:          name,
+			GpuTime:       dur,
+			CoarseGpuTime: coarseDur,
+			Savings:       savings(dur, coarseDur),
+		})
+		res.GpuTime += dur
+		res.CoarseGpuTime += coarseDur
+	}
+	res.Savings = savings(res.GpuTime, res.CoarseGpuTime)
+	sort.Slice(res.Groups, func(i, j int) bool {
+		si := int64(res.Groups[i].GpuTime) - int64(res.Groups[i].CoarseGpuTime)
+		sj := int64(res.Groups[j].GpuTime) - int64(res.Groups[j].CoarseGpuTime)
+		if si != sj {
+			return si > sj
+		}
+		return res.Groups[i].Name < res.Groups[j].Name
+	})
+	return res
+}
+
+// savings returns the fraction of the original time saved.
+func savings(original, changed uint64) float64 {
+	if original == 0 {
+		return 0
+	}
+	return (float64(original) - float64(changed)) / float64(original)
+}
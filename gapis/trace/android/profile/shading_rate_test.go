@@ -0,0 +1,39 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestCompareShadingRate(t *testing.T) {
+	ctx := log.Testing(t)
+
+	res := CompareShadingRate(
+		groupProfile([]testGroup{{name: "Shadows", dur: 100}, {name: "Lighting", dur: 400}, {name: "Post", dur: 100}}),
+		groupProfile([]testGroup{{name: "Shadows", dur: 110}, {name: "Lighting", dur: 200}, {name: "UI", dur: 50}}))
+	assert.For(ctx, "gpu time").That(res.GpuTime).Equals(uint64(500))
+	assert.For(ctx, "coarse gpu time").That(res.CoarseGpuTime).Equals(uint64(310))
+	assert.For(ctx, "savings").That(res.Savings).Equals(0.38)
+	// The groups of only either replay are skipped.
+	assert.For(ctx, "groups").ThatSlice(res.Groups).DeepEquals([]*service.ProfilingData_ShadingRate_Group{
+		{Name: "Lighting", GpuTime: 400, CoarseGpuTime: 200, Savings: 0.5},
+		{Name: "Shadows", GpuTime: 100, CoarseGpuTime: 110, Savings: -0.1},
+	})
+}
@@ -17,8 +17,12 @@ package profile
 import (
 	"context"
 	"fmt"
+	"io"
 	"sort"
+	"strings"
 
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/data/arrow"
 	"github.com/google/gapid/core/data/slice"
 	"github.com/google/gapid/core/log"
 	"github.com/google/gapid/gapis/api/sync"
@@ -30,13 +34,37 @@ import (
 
 const (
 	slicesQuery = "" +
-		"SELECT s.context_id, s.render_target, s.frame_id, s.submission_id, s.hw_queue_id, s.command_buffer, s.render_pass, s.ts, s.dur, s.id, s.name, depth, arg_set_id, track_id, t.name " +
+		"SELECT s.context_id, s.render_target, s.frame_id, s.submission_id, s.hw_queue_id, s.command_buffer, s.render_pass, s.ts, s.dur, s.id, s.name, depth, arg_set_id, track_id, t.name, COALESCE(s.parent_id, 0) " +
 		"FROM gpu_track t LEFT JOIN gpu_slice s " +
 		"ON s.track_id = t.id WHERE t.scope = 'gpu_render_stage' ORDER BY s.ts"
 	argsQueryFmt = "" +
 		"SELECT key, string_value FROM args WHERE args.arg_set_id = %d"
+	rawArgsQueryFmt = "" +
+		"SELECT key, value_type, int_value, real_value, string_value FROM args WHERE args.arg_set_id = %d"
+	trackTreeQuery = "" +
+		"SELECT id, COALESCE(parent_id, -1), COALESCE(name, '') FROM gpu_track"
 )
 
+const includeRawArgsKey = contextKey("includeRawArgs")
+
+// PutIncludeRawArgs marks the context such that the raw Perfetto arguments
+// of the GPU slices are included in the slices.
+func PutIncludeRawArgs(ctx context.Context) context.Context {
+	return keys.WithValue(ctx, includeRawArgsKey, true)
+}
+
+// ShouldIncludeRawArgs returns whether the context was marked by
+// PutIncludeRawArgs.
+func ShouldIncludeRawArgs(ctx context.Context) bool {
+	val, _ := ctx.Value(includeRawArgsKey).(bool)
+	return val
+}
+
+// SliceData holds the GPU render stage slices of a trace in a columnar
+// layout: each field is a column with one entry per slice, in the order of
+// the slices' start times. The columns extracted from the trace share their
+// backing arrays with the trace processor's query result, so no per slice
+// objects are allocated until the data is converted to the service format.
 type SliceData struct {
 	Contexts       []int64
 	RenderTargets  []int64
@@ -53,15 +81,48 @@ type SliceData struct {
 	ArgSets        []int64
 	Tracks         []int64
 	TrackNames     []string
+	Parents        []int64 // Only valid for slices with a non-zero depth.
 	GroupIds       []int32 // To be filled in by caller.
+	Categories     []service.ProfilingData_GpuSlices_Slice_Category
+	// The confidence of the GroupIds, to be filled in by caller.
+	Confidences []service.ProfilingData_GpuSlices_Slice_Confidence
+	// The capture command index of the submission of each slice, -1 if
+	// unknown. Filled in by AssignCommands, and exported as the submitCommand
+	// extra of the slices.
+	Commands []int64
+	// The number of slices that duplicated a slice of another track.
+	Duplicates int
 
 	groups groupTree
+	tracks trackTree
+	// The GPU of the tracks not of GPU 0, keyed by track ID.
+	trackGpus map[int64]uint32
+}
+
+// trackTree is the nesting of the GPU tracks, keyed by track ID.
+type trackTree map[int64]trackNode
+
+type trackNode struct {
+	parent int64 // -1 if the track is not nested.
+	name   string
+}
+
+func ExtractSliceData(ctx context.Context, processor perfetto.Querier) (*SliceData, error) {
+	data, err := ExtractSliceDataWithQuery(ctx, processor, slicesQuery)
+	if err == nil && data.Len() == 0 {
+		return nil, Errf(service.ProfilingErrorCode_NoRenderStageTrack, nil, "The trace has no GPU render stage slices")
+	}
+	return data, err
 }
 
-func ExtractSliceData(ctx context.Context, processor *perfetto.Processor) (*SliceData, error) {
-	slicesQueryResult, err := processor.Query(slicesQuery)
+// ExtractSliceDataWithQuery is like ExtractSliceData, but extracts the slices
+// returned by the given query, for backends that don't report their timings
+// as GPU render stages. The query must return the same columns, in the same
+// order, as the render stage query.
+func ExtractSliceDataWithQuery(ctx context.Context, processor perfetto.Querier, query string) (*SliceData, error) {
+	slicesQueryResult, err := processor.Query(query)
 	if err != nil {
-		return nil, log.Errf(ctx, err, "SQL query failed: %v", slicesQuery)
+		return nil, queryError(err, query)
 	}
 
 	slicesColumns := slicesQueryResult.GetColumns()
@@ -81,42 +142,184 @@ func ExtractSliceData(ctx context.Context, processor *perfetto.Processor) (*Slic
 		ArgSets:        slicesColumns[12].GetLongValues(),
 		Tracks:         slicesColumns[13].GetLongValues(),
 		TrackNames:     slicesColumns[14].GetStringValues(),
-		GroupIds:       make([]int32, slicesQueryResult.GetNumRecords()),
+		Parents:        slicesColumns[15].GetLongValues(),
 		groups:         groupTree{1, groupTreeNode{id: 0, name: "root"}},
 	}
+	if dups, count := duplicateSlices(data); count > 0 {
+		data.Duplicates = count
+		if GetSliceDedupPolicy(ctx) == service.SliceDedupPolicy_DropDuplicateSlices {
+			log.W(ctx, "Dropping %d GPU slices duplicated on several tracks", count)
+			data.dropSlices(dups)
+		} else {
+			log.W(ctx, "Keeping %d GPU slices duplicated on several tracks", count)
+		}
+	}
+	data.GroupIds = make([]int32, data.Len())
+	data.Confidences = make([]service.ProfilingData_GpuSlices_Slice_Confidence, data.Len())
+	// Categorize before the callers rename the slices.
+	data.Categories = make([]service.ProfilingData_GpuSlices_Slice_Category, len(data.Names))
+	for i := range data.Names {
+		data.Categories[i] = SliceCategory(data.Names[i], data.TrackNames[i])
+	}
+	data.tracks = queryTrackTree(ctx, processor)
+	data.trackGpus = queryTrackGpus(ctx, processor)
 
 	return data, nil
 }
 
+// queryTrackTree returns the nesting of the GPU tracks. Drivers may nest the
+// render stage tracks to an arbitrary depth, e.g. queue, stage and sub-stage.
+// If the trace processor doesn't expose the nesting, the tracks are flat.
+func queryTrackTree(ctx context.Context, processor perfetto.Querier) trackTree {
+	res, err := processor.Query(trackTreeQuery)
+	if err != nil {
+		log.W(ctx, "SQL query failed, treating the GPU tracks as flat: %v: %v", trackTreeQuery, err)
+		return trackTree{}
+	}
+	columns := res.GetColumns()
+	ids := columns[0].GetLongValues()
+	parents := columns[1].GetLongValues()
+	names := columns[2].GetStringValues()
+	tree := make(trackTree, len(ids))
+	for i := range ids {
+		tree[ids[i]] = trackNode{parents[i], names[i]}
+	}
+	return tree
+}
+
+// Len returns the number of slices.
+func (d *SliceData) Len() int {
+	return len(d.Timestamps)
+}
+
+// Int64Columns returns the integer columns by name, for zero-copy handoff
+// to exporters. The columns must not be modified.
+func (d *SliceData) Int64Columns() map[string][]int64 {
+	return map[string][]int64{
+		"contextId":     d.Contexts,
+		"renderTarget":  d.RenderTargets,
+		"frameId":       d.Frames,
+		"submissionId":  d.Submissions,
+		"hwQueueId":     d.HardwareQueues,
+		"commandBuffer": d.CommandBuffers,
+		"renderPass":    d.RenderPasses,
+		"ts":            d.Timestamps,
+		"dur":           d.Durations,
+		"id":            d.SliceIds,
+		"depth":         d.Depths,
+		"argSetId":      d.ArgSets,
+		"trackId":       d.Tracks,
+		"parentId":      d.Parents,
+	}
+}
+
+// StringColumns returns the string columns by name, for zero-copy handoff
+// to exporters. The columns must not be modified.
+func (d *SliceData) StringColumns() map[string][]string {
+	return map[string][]string{
+		"name":      d.Names,
+		"trackName": d.TrackNames,
+	}
+}
+
+// WriteArrow writes the columns of the slices to w as an Arrow IPC stream,
+// sorted by name, such that Arrow readers can map them without copying.
+func (d *SliceData) WriteArrow(w io.Writer) error {
+	columns := []arrow.Column{}
+	for name, values := range d.Int64Columns() {
+		columns = append(columns, arrow.Int64Column(name, values))
+	}
+	for name, values := range d.StringColumns() {
+		columns = append(columns, arrow.StringColumn(name, values))
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Name < columns[j].Name })
+	return arrow.WriteTable(w, columns)
+}
+
+// AssignCommands sets the capture command index of the submission of each
+// slice, used by MapIdentifiers to pick the mapping of a reused handle that
+// was valid at the time of the slice.
+func (d *SliceData) AssignCommands(ordering *SubmissionOrdering, syncData *sync.Data) {
+	submits := SubmissionCommands(syncData)
+	d.Commands = make([]int64, d.Len())
+	for i, v := range d.Submissions {
+		d.Commands[i] = -1
+		if order, ok := ordering.Lookup(v, d.Timestamps[i]); ok && order < len(submits) {
+			d.Commands[i] = int64(submits[order])
+		}
+	}
+}
+
 func (d *SliceData) MapIdentifiers(ctx context.Context, handleMapping map[uint64][]service.VulkanHandleMappingItem) {
-	ExtractTraceHandles(ctx, d.Contexts, "VkDevice", handleMapping)
-	ExtractTraceHandles(ctx, d.RenderTargets, "VkFramebuffer", handleMapping)
-	ExtractTraceHandles(ctx, d.CommandBuffers, "VkCommandBuffer", handleMapping)
-	ExtractTraceHandles(ctx, d.RenderPasses, "VkRenderPass", handleMapping)
+	ExtractTraceHandles(ctx, d.Contexts, "VkDevice", handleMapping, d.Commands)
+	ExtractTraceHandles(ctx, d.RenderTargets, "VkFramebuffer", handleMapping, d.Commands)
+	ExtractTraceHandles(ctx, d.CommandBuffers, "VkCommandBuffer", handleMapping, d.Commands)
+	ExtractTraceHandles(ctx, d.RenderPasses, "VkRenderPass", handleMapping, d.Commands)
 }
 
 func (d *SliceData) CreateOrGetGroup(name string, link sync.SubCmdRange) int32 {
 	return d.groups.createOrGetGroup(name, link)
 }
 
-func (d *SliceData) ToService(ctx context.Context, processor *perfetto.Processor, capture *path.Capture) *service.ProfilingData_GpuSlices {
+// AttributeByLabels attributes the slices that are not part of any group
+// to the first group, in command order, with the slice's label among its
+// debug labels, as named by RenderPassGroupName.
+func (d *SliceData) AttributeByLabels() {
+	for i, id := range d.GroupIds {
+		if id >= 0 || d.Names[i] == "" {
+			continue
+		}
+		if group, ok := d.groups.findByLabel(d.Names[i]); ok {
+			d.GroupIds[i] = group
+			d.Confidences[i] = service.ProfilingData_GpuSlices_Slice_DebugLabel
+		}
+	}
+}
+
+// MatchConfidence returns the confidence of a group attribution found by a
+// RenderPassLookup match.
+func MatchConfidence(match sync.Match) service.ProfilingData_GpuSlices_Slice_Confidence {
+	switch match {
+	case sync.ExactMatch:
+		return service.ProfilingData_GpuSlices_Slice_Exact
+	case sync.FuzzyMatch:
+		return service.ProfilingData_GpuSlices_Slice_Fuzzy
+	default:
+		return service.ProfilingData_GpuSlices_Slice_Unmatched
+	}
+}
+
+func (d *SliceData) ToService(ctx context.Context, processor perfetto.Querier, capture *path.Capture) *service.ProfilingData_GpuSlices {
 	extraCache := newExtras(processor)
+	includeRawArgs := ShouldIncludeRawArgs(ctx)
 
 	tracks := map[int64]*service.ProfilingData_GpuSlices_Track{}
-	slices := make([]*service.ProfilingData_GpuSlices_Slice, len(d.Contexts))
+	// Allocate the slices in one block, rather than one at a time.
+	block := make([]service.ProfilingData_GpuSlices_Slice, d.Len())
+	slices := make([]*service.ProfilingData_GpuSlices_Slice, d.Len())
 
-	for i := range d.Contexts {
+	for i := range slices {
 		extras := d.fillInExtras(i, extraCache.get(ctx, d.ArgSets[i]))
 
-		slices[i] = &service.ProfilingData_GpuSlices_Slice{
-			Ts:      uint64(d.Timestamps[i]),
-			Dur:     uint64(d.Durations[i]),
-			Id:      uint64(d.SliceIds[i]),
-			Label:   d.Names[i],
-			Depth:   int32(d.Depths[i]),
-			Extras:  extras,
-			TrackId: int32(d.Tracks[i]),
-			GroupId: d.GroupIds[i],
+		block[i] = service.ProfilingData_GpuSlices_Slice{
+			Ts:         uint64(d.Timestamps[i]),
+			Dur:        uint64(d.Durations[i]),
+			Id:         uint64(d.SliceIds[i]),
+			Label:      d.Names[i],
+			Depth:      int32(d.Depths[i]),
+			Extras:     extras,
+			TrackId:    int32(d.Tracks[i]),
+			GroupId:    d.GroupIds[i],
+			Category:   d.Categories[i],
+			Color:      categoryColors[d.Categories[i]],
+			Confidence: d.Confidences[i],
+		}
+		if d.Depths[i] > 0 {
+			block[i].ParentId = uint64(d.Parents[i])
+		}
+		slices[i] = &block[i]
+		if includeRawArgs {
+			slices[i].RawArgs = extraCache.getRaw(ctx, d.ArgSets[i])
 		}
 
 		if _, ok := tracks[d.Tracks[i]]; !ok {
@@ -127,10 +330,57 @@ func (d *SliceData) ToService(ctx context.Context, processor *perfetto.Processor
 		}
 	}
 
+	d.tracks.nest(tracks)
+	for id, track := range tracks {
+		track.Gpu = d.trackGpus[id]
+	}
+	computeSelfDurations(slices)
+
 	return &service.ProfilingData_GpuSlices{
-		Slices: slices,
-		Tracks: flattenTracks(tracks),
-		Groups: d.groups.flatten(nil, capture, 0),
+		Slices:     slices,
+		Tracks:     flattenTracks(tracks),
+		Groups:     d.groups.flatten(nil, capture, 0),
+		Duplicates: uint32(d.Duplicates),
+	}
+}
+
+// computeSelfDurations sets the exclusive duration of each slice, its
+// duration minus the union of the time covered by its children, clipped to
+// the slice.
+func computeSelfDurations(slices []*service.ProfilingData_GpuSlices_Slice) {
+	byId := make(map[uint64]*service.ProfilingData_GpuSlices_Slice, len(slices))
+	for _, s := range slices {
+		byId[s.Id] = s
+		s.SelfDur = s.Dur
+	}
+	sorted := append([]*service.ProfilingData_GpuSlices_Slice{}, slices...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Ts < sorted[j].Ts })
+
+	// The end of the time covered by the children of each slice so far.
+	coveredEnd := map[uint64]uint64{}
+	for _, s := range sorted {
+		if s.Depth <= 0 {
+			continue
+		}
+		parent, ok := byId[s.ParentId]
+		if !ok {
+			continue
+		}
+		start, end := s.Ts, s.Ts+s.Dur
+		if covered, ok := coveredEnd[parent.Id]; ok && covered > start {
+			start = covered
+		}
+		if start < parent.Ts {
+			start = parent.Ts
+		}
+		if parentEnd := parent.Ts + parent.Dur; end > parentEnd {
+			end = parentEnd
+		}
+		if end <= start {
+			continue
+		}
+		parent.SelfDur -= end - start
+		coveredEnd[parent.Id] = end
 	}
 }
 
@@ -163,9 +413,47 @@ func (d *SliceData) fillInExtras(idx int, extras []*service.ProfilingData_GpuSli
 		Name:  "hwQueueId",
 		Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(d.HardwareQueues[idx])},
 	})
+	if d.Commands != nil && d.Commands[idx] >= 0 {
+		extras = append(extras, &service.ProfilingData_GpuSlices_Slice_Extra{
+			Name:  submitCommandExtra,
+			Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(d.Commands[idx])},
+		})
+	}
 	return extras
 }
 
+// nest adds the ancestors of the tracks to tracks, and sets the parent and
+// depth of each track.
+func (t trackTree) nest(tracks map[int64]*service.ProfilingData_GpuSlices_Track) {
+	done := map[int64]bool{}
+	var visit func(id int64) *service.ProfilingData_GpuSlices_Track
+	visit = func(id int64) *service.ProfilingData_GpuSlices_Track {
+		track, ok := tracks[id]
+		if !ok {
+			track = &service.ProfilingData_GpuSlices_Track{Id: int32(id), Name: t[id].name}
+			tracks[id] = track
+		}
+		if done[id] {
+			return track
+		}
+		done[id] = true
+		if node, ok := t[id]; ok && node.parent >= 0 {
+			parent := visit(node.parent)
+			track.ParentId = parent.Id
+			track.Depth = parent.Depth + 1
+		}
+		return track
+	}
+
+	ids := make([]int64, 0, len(tracks))
+	for id := range tracks {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		visit(id)
+	}
+}
+
 func flattenTracks(tracks map[int64]*service.ProfilingData_GpuSlices_Track) []*service.ProfilingData_GpuSlices_Track {
 	flat := make([]*service.ProfilingData_GpuSlices_Track, 0, len(tracks))
 	for _, v := range tracks {
@@ -175,12 +463,13 @@ func flattenTracks(tracks map[int64]*service.ProfilingData_GpuSlices_Track) []*s
 }
 
 type extras struct {
-	processor *perfetto.Processor
+	processor perfetto.Querier
 	cache     map[int64]*perfetto_service.QueryResult
+	rawCache  map[int64][]*service.ProfilingData_GpuSlices_Slice_Extra
 }
 
-func newExtras(processor *perfetto.Processor) *extras {
-	return &extras{processor, map[int64]*perfetto_service.QueryResult{}}
+func newExtras(processor perfetto.Querier) *extras {
+	return &extras{processor, map[int64]*perfetto_service.QueryResult{}, map[int64][]*service.ProfilingData_GpuSlices_Slice_Extra{}}
 }
 
 func (e *extras) get(ctx context.Context, argSet int64) []*service.ProfilingData_GpuSlices_Slice_Extra {
@@ -209,6 +498,35 @@ func (e *extras) get(ctx context.Context, argSet int64) []*service.ProfilingData
 	return extras
 }
 
+// getRaw returns the arguments of the arg set with their original types.
+func (e *extras) getRaw(ctx context.Context, argSet int64) []*service.ProfilingData_GpuSlices_Slice_Extra {
+	if res, ok := e.rawCache[argSet]; ok {
+		return res
+	}
+
+	rawArgsQuery := fmt.Sprintf(rawArgsQueryFmt, argSet)
+	rawArgsQueryResult, err := e.processor.Query(rawArgsQuery)
+	if err != nil {
+		log.W(ctx, "SQL query failed: %v", rawArgsQuery)
+	}
+	columns := rawArgsQueryResult.GetColumns()
+	var res []*service.ProfilingData_GpuSlices_Slice_Extra
+	for j := uint64(0); j < rawArgsQueryResult.GetNumRecords(); j++ {
+		arg := &service.ProfilingData_GpuSlices_Slice_Extra{Name: columns[0].GetStringValues()[j]}
+		switch columns[1].GetStringValues()[j] {
+		case "int", "uint", "pointer", "bool":
+			arg.Value = &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: uint64(columns[2].GetLongValues()[j])}
+		case "real":
+			arg.Value = &service.ProfilingData_GpuSlices_Slice_Extra_DoubleValue{DoubleValue: columns[3].GetDoubleValues()[j]}
+		default:
+			arg.Value = &service.ProfilingData_GpuSlices_Slice_Extra_StringValue{StringValue: columns[4].GetStringValues()[j]}
+		}
+		res = append(res, arg)
+	}
+	e.rawCache[argSet] = res
+	return res
+}
+
 type groupTreeNode struct {
 	id   int32
 	name string
@@ -265,14 +583,49 @@ func (n *groupTreeNode) findOrInsert(id int32, name string, link sync.SubCmdRang
 	return &n.children[idx], false
 }
 
+func (n *groupTreeNode) findByLabel(label string) (int32, bool) {
+	if n.id != 0 {
+		for _, l := range groupLabels(n.name) {
+			if l == label {
+				return n.id, true
+			}
+		}
+	}
+	for i := range n.children {
+		if id, ok := n.children[i].findByLabel(label); ok {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// groupLabels returns the debug labels of a group name built by
+// RenderPassGroupName, e.g. "Frame / Shadows: glDrawArrays (RenderPass 1,
+// RenderTarget 2)" has the labels "Frame" and "Shadows".
+func groupLabels(name string) []string {
+	i := strings.LastIndex(name, " (")
+	if i < 0 {
+		return nil
+	}
+	name = name[:i]
+	if i := strings.Index(name, ": "); i >= 0 {
+		name = name[:i]
+	}
+	return strings.Split(name, " / ")
+}
+
 func (n *groupTreeNode) flatten(list []*service.ProfilingData_GpuSlices_Group, capture *path.Capture, parent int32) []*service.ProfilingData_GpuSlices_Group {
 	if n.id != 0 {
-		list = append(list, &service.ProfilingData_GpuSlices_Group{
+		group := &service.ProfilingData_GpuSlices_Group{
 			Id:       n.id,
 			Name:     n.name,
 			ParentId: parent,
-			Link:     &path.Commands{Capture: capture, From: n.link.From, To: n.link.To},
-		})
+		}
+		// Groups of traces without a capture do not link to any commands.
+		if capture != nil {
+			group.Link = &path.Commands{Capture: capture, From: n.link.From, To: n.link.To}
+		}
+		list = append(list, group)
 	}
 
 	for i := range n.children {
@@ -0,0 +1,155 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestAttributeByLabels(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data := &SliceData{
+		Names:       []string{"Shadows", "Unknown", "", "1-3"},
+		GroupIds:    []int32{-1, -1, -1, 0},
+		Confidences: make([]service.ProfilingData_GpuSlices_Slice_Confidence, 4),
+		groups:      groupTree{1, groupTreeNode{id: 0, name: "root"}},
+	}
+	rp := sync.SubCmdRange{From: api.SubCmdIdx{5, 0, 0, 1}, To: api.SubCmdIdx{5, 0, 0, 3}}
+	group := data.CreateOrGetGroup("Frame / Shadows: glDrawArrays (RenderPass 1, RenderTarget 2)", rp)
+	data.GroupIds[3] = group
+	data.Confidences[3] = service.ProfilingData_GpuSlices_Slice_Exact
+
+	data.AttributeByLabels()
+	assert.For(ctx, "groups").ThatSlice(data.GroupIds).Equals([]int32{group, -1, -1, group})
+	assert.For(ctx, "confidences").ThatSlice(data.Confidences).Equals([]service.ProfilingData_GpuSlices_Slice_Confidence{
+		service.ProfilingData_GpuSlices_Slice_DebugLabel,
+		service.ProfilingData_GpuSlices_Slice_Unmatched,
+		service.ProfilingData_GpuSlices_Slice_Unmatched,
+		service.ProfilingData_GpuSlices_Slice_Exact,
+	})
+}
+
+func TestGroupLabels(t *testing.T) {
+	ctx := log.Testing(t)
+
+	for _, test := range []struct {
+		name     string
+		expected []string
+	}{
+		{"RenderPass 1, RenderTarget 2", nil},
+		{"Frame / Shadows: glDrawArrays (RenderPass 1, RenderTarget 2)", []string{"Frame", "Shadows"}},
+		{"glDrawArrays, glDrawElements (RenderPass 1, RenderTarget 2)", []string{"glDrawArrays, glDrawElements"}},
+	} {
+		assert.For(ctx, "%v", test.name).ThatSlice(groupLabels(test.name)).Equals(test.expected)
+	}
+}
+
+func TestNestTracks(t *testing.T) {
+	ctx := log.Testing(t)
+
+	tree := trackTree{
+		1: {-1, "Queue"},
+		2: {1, "Stage"},
+		3: {2, "Sub-stage"},
+		4: {-1, "Other queue"},
+	}
+	tracks := map[int64]*service.ProfilingData_GpuSlices_Track{
+		3: {Id: 3, Name: "Sub-stage"},
+		4: {Id: 4, Name: "Other queue"},
+		5: {Id: 5, Name: "Unknown"},
+	}
+	tree.nest(tracks)
+
+	for _, test := range []struct {
+		id     int64
+		name   string
+		parent int32
+		depth  int32
+	}{
+		{1, "Queue", 0, 0},
+		{2, "Stage", 1, 1},
+		{3, "Sub-stage", 2, 2},
+		{4, "Other queue", 0, 0},
+		{5, "Unknown", 0, 0},
+	} {
+		track := tracks[test.id]
+		if !assert.For(ctx, "track %v", test.id).That(track).IsNotNil() {
+			continue
+		}
+		assert.For(ctx, "track %v name", test.id).That(track.Name).Equals(test.name)
+		assert.For(ctx, "track %v parent", test.id).That(track.ParentId).Equals(test.parent)
+		assert.For(ctx, "track %v depth", test.id).That(track.Depth).Equals(test.depth)
+	}
+	assert.For(ctx, "tracks").That(len(tracks)).Equals(5)
+}
+
+func TestComputeSelfDurations(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slices := []*service.ProfilingData_GpuSlices_Slice{
+		{Id: 1, Ts: 0, Dur: 100},
+		// Overlapping children, and a child overrunning its parent.
+		{Id: 2, Ts: 10, Dur: 20, Depth: 1, ParentId: 1},
+		{Id: 3, Ts: 20, Dur: 20, Depth: 1, ParentId: 1},
+		{Id: 4, Ts: 90, Dur: 30, Depth: 1, ParentId: 1},
+		{Id: 5, Ts: 25, Dur: 5, Depth: 2, ParentId: 3},
+		{Id: 6, Ts: 200, Dur: 50},
+	}
+	computeSelfDurations(slices)
+
+	for i, expected := range []uint64{60, 20, 15, 30, 5, 50} {
+		assert.For(ctx, "slice %d", slices[i].Id).That(slices[i].SelfDur).Equals(expected)
+	}
+}
+
+func TestWriteArrow(t *testing.T) {
+	ctx := log.Testing(t)
+
+	ids := []int64{1, 2}
+	data := &SliceData{
+		Contexts:       ids,
+		RenderTargets:  ids,
+		Frames:         ids,
+		Submissions:    ids,
+		HardwareQueues: ids,
+		CommandBuffers: ids,
+		RenderPasses:   ids,
+		Timestamps:     []int64{10, 20},
+		Durations:      []int64{5, 5},
+		SliceIds:       ids,
+		Names:          []string{"vkQueueSubmit", "Shadows"},
+		Depths:         []int64{0, 1},
+		ArgSets:        ids,
+		Tracks:         ids,
+		TrackNames:     []string{"GPU", "GPU"},
+		Parents:        []int64{0, 1},
+	}
+	buf := &bytes.Buffer{}
+	err := data.WriteArrow(buf)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	stream := buf.Bytes()
+	assert.For(ctx, "start").ThatSlice(stream[:4]).Equals([]byte{0xff, 0xff, 0xff, 0xff})
+	assert.For(ctx, "end").ThatSlice(stream[len(stream)-8:]).Equals([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	assert.For(ctx, "names").That(bytes.Contains(stream, []byte("vkQueueSubmitShadows"))).Equals(true)
+	assert.For(ctx, "columns").That(bytes.Contains(stream, []byte("trackName"))).Equals(true)
+}
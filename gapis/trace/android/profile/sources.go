@@ -0,0 +1,149 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+const counterSourcesKey = contextKey("counterSources")
+
+// counterSourcePatterns match the counter names prefixed by the producer that
+// published them, e.g. "[HAL] GPU utilization" or "pvr: GPU utilization",
+// capturing the producer and the name without the prefix.
+var counterSourcePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\[([^\]]+)\]\s*(.+)$`),
+	regexp.MustCompile(`^([\w-]+):\s*(.+)$`),
+}
+
+// CounterSources selects which producer's counters are kept when several
+// producers publish the same counter.
+type CounterSources struct {
+	Policy service.CounterSourcePolicy
+	// The producer preferred by the PreferNamedSource policy.
+	Source string
+}
+
+// PutCounterSources attaches the handling of the counters published by
+// several producers to the context.
+func PutCounterSources(ctx context.Context, policy service.CounterSourcePolicy, source string) context.Context {
+	return keys.WithValue(ctx, counterSourcesKey, CounterSources{policy, source})
+}
+
+// GetCounterSources returns the handling attached to the context by
+// PutCounterSources, defaulting to PreferDescriptorSource.
+func GetCounterSources(ctx context.Context) CounterSources {
+	val, _ := ctx.Value(counterSourcesKey).(CounterSources)
+	return val
+}
+
+// splitCounterSource returns the producer prefix of a counter name, or the
+// empty string if it has none, and the name without the prefix.
+func splitCounterSource(name string) (source, base string) {
+	for _, p := range counterSourcePatterns {
+		if m := p.FindStringSubmatch(name); m != nil {
+			return m[1], m[2]
+		}
+	}
+	return "", name
+}
+
+// selectCounterSources keeps the counters of a single producer of the
+// counters of the same GPU whose names only differ by their producer prefix,
+// according to the sources. By default, the producer of the counter of the
+// device's counter descriptor is kept, or if there is none, the producer
+// without a prefix, or else the producer with the most samples. The counters
+// published by a single producer are all kept, including those of the same
+// name, which are handled by dedupCounters.
+func selectCounterSources(ctx context.Context, counters []*service.ProfilingData_Counter, sources CounterSources) []*service.ProfilingData_Counter {
+	if sources.Policy == service.CounterSourcePolicy_KeepAllSources {
+		return counters
+	}
+
+	type key struct {
+		name string
+		gpu  uint32
+	}
+	type producer struct {
+		source  string
+		spec    bool
+		samples int
+	}
+	producers := map[key][]*producer{}
+	groups, counterSources := make([]key, len(counters)), make([]string, len(counters))
+	for i, counter := range counters {
+		source, base := splitCounterSource(counter.Name)
+		k := key{strings.ToLower(base), counter.Gpu}
+		groups[i], counterSources[i] = k, source
+		var p *producer
+		for _, q := range producers[k] {
+			if q.source == source {
+				p = q
+			}
+		}
+		if p == nil {
+			p = &producer{source: source}
+			producers[k] = append(producers[k], p)
+		}
+		p.spec = p.spec || counter.Spec != nil
+		p.samples += len(counter.Values)
+	}
+
+	preferred := func(ps []*producer) string {
+		if sources.Policy == service.CounterSourcePolicy_PreferNamedSource {
+			for _, p := range ps {
+				if strings.EqualFold(p.source, sources.Source) {
+					return p.source
+				}
+			}
+		}
+		best := ps[0]
+		for _, p := range ps[1:] {
+			switch {
+			case p.spec != best.spec:
+				if p.spec {
+					best = p
+				}
+			case (p.source == "") != (best.source == ""):
+				if p.source == "" {
+					best = p
+				}
+			case p.samples > best.samples:
+				best = p
+			}
+		}
+		return best.source
+	}
+
+	res := make([]*service.ProfilingData_Counter, 0, len(counters))
+	dropped := 0
+	for i, counter := range counters {
+		if ps := producers[groups[i]]; len(ps) > 1 && counterSources[i] != preferred(ps) {
+			dropped++
+			continue
+		}
+		res = append(res, counter)
+	}
+	if dropped > 0 {
+		log.I(ctx, "Dropped %d counters also published by another producer", dropped)
+	}
+	return res
+}
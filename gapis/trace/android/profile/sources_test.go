@@ -0,0 +1,79 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestSelectCounterSources(t *testing.T) {
+	ctx := log.Testing(t)
+
+	counters := func() []*service.ProfilingData_Counter {
+		return []*service.ProfilingData_Counter{
+			{Id: 1, Name: "GPU Utilization", Spec: &device.GpuCounterDescriptor_GpuCounterSpec{Name: "GPU Utilization"}, Values: []float64{1}},
+			{Id: 2, Name: "pvr: GPU utilization", Values: []float64{1, 2, 3}},
+			{Id: 3, Name: "[Standalone] ALU Busy", Values: []float64{1, 2, 3}},
+			{Id: 4, Name: "ALU Busy", Values: []float64{1}},
+			{Id: 5, Name: "[A] Freq", Values: []float64{1}},
+			{Id: 6, Name: "[B] Freq", Values: []float64{1, 2}},
+			{Id: 7, Name: "[B] Freq", Gpu: 1, Values: []float64{1}},
+		}
+	}
+	ids := func(counters []*service.ProfilingData_Counter) []uint32 {
+		res := []uint32{}
+		for _, c := range counters {
+			res = append(res, c.Id)
+		}
+		return res
+	}
+
+	for _, test := range []struct {
+		name     string
+		sources  CounterSources
+		expected []uint32
+	}{
+		{"descriptor", CounterSources{}, []uint32{1, 4, 6, 7}},
+		{"named", CounterSources{service.CounterSourcePolicy_PreferNamedSource, "PVR"}, []uint32{2, 4, 6, 7}},
+		{"named prefix", CounterSources{service.CounterSourcePolicy_PreferNamedSource, "standalone"}, []uint32{1, 3, 6, 7}},
+		{"named fewer samples", CounterSources{service.CounterSourcePolicy_PreferNamedSource, "A"}, []uint32{1, 4, 5, 7}},
+		{"keep all", CounterSources{service.CounterSourcePolicy_KeepAllSources, ""}, []uint32{1, 2, 3, 4, 5, 6, 7}},
+	} {
+		got := selectCounterSources(ctx, counters(), test.sources)
+		assert.For(ctx, "%v counters", test.name).ThatSlice(ids(got)).Equals(test.expected)
+	}
+}
+
+func TestSplitCounterSource(t *testing.T) {
+	ctx := log.Testing(t)
+
+	for _, test := range []struct {
+		name, source, base string
+	}{
+		{"[HAL] GPU utilization", "HAL", "GPU utilization"},
+		{"pvr: GPU utilization", "pvr", "GPU utilization"},
+		{"GPU % Utilization", "", "GPU % Utilization"},
+		{"Avg Bytes / Fragment", "", "Avg Bytes / Fragment"},
+	} {
+		source, base := splitCounterSource(test.name)
+		assert.For(ctx, "%v source", test.name).That(source).Equals(test.source)
+		assert.For(ctx, "%v base", test.name).That(base).Equals(test.base)
+	}
+}
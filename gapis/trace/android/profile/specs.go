@@ -0,0 +1,109 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/gapid/core/context/keys"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+const specMergePolicyKey = contextKey("counterSpecMergePolicy")
+
+// PutCounterSpecMergePolicy attaches the policy used to pick between counter
+// specs with the same name to the context.
+func PutCounterSpecMergePolicy(ctx context.Context, policy service.CounterSpecMergePolicy) context.Context {
+	return keys.WithValue(ctx, specMergePolicyKey, policy)
+}
+
+// GetCounterSpecMergePolicy returns the policy attached to the context by
+// PutCounterSpecMergePolicy, defaulting to LastSpec.
+func GetCounterSpecMergePolicy(ctx context.Context) service.CounterSpecMergePolicy {
+	val, _ := ctx.Value(specMergePolicyKey).(service.CounterSpecMergePolicy)
+	return val
+}
+
+// MergeCounterSpecs returns the spec to use for each counter name of the
+// descriptor, picking between specs with the same name according to the
+// context's merge policy. Specs with the same name that differ are reported
+// as conflicts.
+func MergeCounterSpecs(ctx context.Context, desc *device.GpuCounterDescriptor) (map[string]*device.GpuCounterDescriptor_GpuCounterSpec, []*service.ProfilingData_CounterSpecConflict) {
+	policy := GetCounterSpecMergePolicy(ctx)
+
+	names := []string{}
+	byName := map[string][]*device.GpuCounterDescriptor_GpuCounterSpec{}
+	for _, spec := range desc.GetSpecs() {
+		if _, ok := byName[spec.Name]; !ok {
+			names = append(names, spec.Name)
+		}
+		byName[spec.Name] = append(byName[spec.Name], spec)
+	}
+
+	res := map[string]*device.GpuCounterDescriptor_GpuCounterSpec{}
+	conflicts := []*service.ProfilingData_CounterSpecConflict{}
+	for _, name := range names {
+		specs := byName[name]
+		used := pickCounterSpec(specs, policy)
+		res[name] = specs[used]
+
+		if fields := specDifferences(specs); len(fields) > 0 {
+			conflicts = append(conflicts, &service.ProfilingData_CounterSpecConflict{
+				Name:   name,
+				Specs:  specs,
+				Used:   int32(used),
+				Fields: fields,
+			})
+		}
+	}
+	return res, conflicts
+}
+
+// pickCounterSpec returns the index of the spec to use according to policy.
+func pickCounterSpec(specs []*device.GpuCounterDescriptor_GpuCounterSpec, policy service.CounterSpecMergePolicy) int {
+	last := len(specs) - 1
+	switch policy {
+	case service.CounterSpecMergePolicy_FirstSpec:
+		return 0
+	case service.CounterSpecMergePolicy_PreferSelectedByDefault:
+		for i := last; i >= 0; i-- {
+			if specs[i].SelectByDefault {
+				return i
+			}
+		}
+	}
+	return last
+}
+
+// specDifferences returns the names of the fields in which the specs differ.
+func specDifferences(specs []*device.GpuCounterDescriptor_GpuCounterSpec) []string {
+	fields := []string{}
+	differs := func(name string, get func(*device.GpuCounterDescriptor_GpuCounterSpec) interface{}) {
+		for _, spec := range specs[1:] {
+			if !reflect.DeepEqual(get(specs[0]), get(spec)) {
+				fields = append(fields, name)
+				return
+			}
+		}
+	}
+	differs("select_by_default", func(s *device.GpuCounterDescriptor_GpuCounterSpec) interface{} { return s.SelectByDefault })
+	differs("numerator_units", func(s *device.GpuCounterDescriptor_GpuCounterSpec) interface{} { return s.NumeratorUnits })
+	differs("denominator_units", func(s *device.GpuCounterDescriptor_GpuCounterSpec) interface{} { return s.DenominatorUnits })
+	differs("peak_value", func(s *device.GpuCounterDescriptor_GpuCounterSpec) interface{} { return s.PeakValue })
+	differs("groups", func(s *device.GpuCounterDescriptor_GpuCounterSpec) interface{} { return s.Groups })
+	return fields
+}
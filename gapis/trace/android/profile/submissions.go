@@ -0,0 +1,141 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/api/sync"
+	"github.com/google/gapid/gapis/perfetto"
+)
+
+const (
+	queueSubmitsQuery = "" +
+		"SELECT submission_id, command_buffer, ts FROM gpu_slice s JOIN track t ON s.track_id = t.id " +
+		"WHERE s.name = 'vkQueueSubmit' AND t.name = 'Vulkan Events' ORDER BY ts"
+)
+
+// SubmissionOrdering maps the submission IDs of the GPU slices to the order
+// of the vkQueueSubmit calls, which matches the submission order of the
+// capture.
+//
+// Some drivers wrap around or reuse the submission IDs in long traces, so an
+// ID may belong to more than one submission. Such IDs are disambiguated by
+// the time of the submission: a slice belongs to the latest submission with
+// its ID that was submitted before the slice started.
+type SubmissionOrdering struct {
+	submits map[int64][]orderedSubmit // submission ID -> submits, sorted by time.
+	count   int
+}
+
+type orderedSubmit struct {
+	ts    int64
+	order int
+}
+
+// ProcessSubmissionOrdering queries the vkQueueSubmit calls of the trace. If
+// skipSpurious is true, the submissions without a command buffer are ignored.
+func ProcessSubmissionOrdering(ctx context.Context, processor perfetto.Querier, skipSpurious bool) (*SubmissionOrdering, error) {
+	queueSubmitsQueryResult, err := processor.Query(queueSubmitsQuery)
+	if err != nil {
+		return nil, queryError(err, queueSubmitsQuery)
+	}
+	columns := queueSubmitsQueryResult.GetColumns()
+	ids := columns[0].GetLongValues()
+	commandBuffers := columns[1].GetLongValues()
+	timestamps := columns[2].GetLongValues()
+
+	res := newSubmissionOrdering()
+	reused := 0
+	for i, id := range ids {
+		if skipSpurious && commandBuffers[i] == 0 {
+			// This is a spurious submission. See b/150854367
+			log.W(ctx, "Spurious vkQueueSubmit slice with submission id %v", id)
+			continue
+		}
+		if res.add(id, timestamps[i]) {
+			reused++
+		}
+	}
+	if reused > 0 {
+		log.W(ctx, "%d submission IDs were reused, disambiguating them by time", reused)
+	}
+	return res, nil
+}
+
+func newSubmissionOrdering() *SubmissionOrdering {
+	return &SubmissionOrdering{submits: map[int64][]orderedSubmit{}}
+}
+
+// add adds the submission with the given ID, submitted at ts after all the
+// submissions added before. Returns whether the ID was reused.
+func (o *SubmissionOrdering) add(id, ts int64) bool {
+	reused := len(o.submits[id]) > 0
+	o.submits[id] = append(o.submits[id], orderedSubmit{ts, o.count})
+	o.count++
+	return reused
+}
+
+// Len returns the number of submissions.
+func (o *SubmissionOrdering) Len() int {
+	return o.count
+}
+
+// Lookup returns the order of the submission with the given ID, that
+// executed the GPU slice starting at the given time.
+func (o *SubmissionOrdering) Lookup(id, ts int64) (int, bool) {
+	submit, ok := o.find(id, ts)
+	return submit.order, ok
+}
+
+// SubmitTime returns the time of the vkQueueSubmit of the submission with the
+// given ID, that executed the GPU slice starting at the given time.
+func (o *SubmissionOrdering) SubmitTime(id, ts int64) (int64, bool) {
+	submit, ok := o.find(id, ts)
+	return submit.ts, ok
+}
+
+func (o *SubmissionOrdering) find(id, ts int64) (orderedSubmit, bool) {
+	submits := o.submits[id]
+	switch len(submits) {
+	case 0:
+		return orderedSubmit{}, false
+	case 1:
+		return submits[0], true
+	}
+	// Find the last submit before the slice. If the clocks are skewed such
+	// that the slice starts before all the submits, use the first one.
+	i := sort.Search(len(submits), func(i int) bool { return submits[i].ts > ts }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return submits[i], true
+}
+
+// SubmissionCommands returns the capture command indices of the vkQueueSubmit
+// calls of the capture, indexed by the submission order.
+func SubmissionCommands(syncData *sync.Data) []uint64 {
+	if syncData == nil {
+		return nil
+	}
+	res := make([]uint64, 0, len(syncData.SubcommandReferences))
+	for id := range syncData.SubcommandReferences {
+		res = append(res, uint64(id))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+)
+
+func TestSubmissionOrderingWraparound(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Submission IDs 7, 8, 9 wrap around to 1, 2, then 7 is reused.
+	ids := []int64{7, 8, 9, 1, 2, 7}
+	timestamps := []int64{100, 200, 300, 400, 500, 600}
+	player := perfetto.QueryPlayer{
+		queueSubmitsQuery: &perfetto_service.QueryResult{
+			NumRecords: uint64(len(ids)),
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				{LongValues: ids},
+				{LongValues: []int64{1, 1, 1, 1, 1, 1}},
+				{LongValues: timestamps},
+			},
+		},
+	}
+	ordering, err := ProcessSubmissionOrdering(ctx, player, true)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+
+	for _, test := range []struct {
+		id, ts int64
+		order  int
+	}{
+		{7, 150, 0},
+		{8, 250, 1},
+		{1, 450, 3},
+		{2, 550, 4},
+		{7, 650, 5}, // the reused ID.
+		{7, 50, 0},  // before any submit.
+	} {
+		order, ok := ordering.Lookup(test.id, test.ts)
+		assert.For(ctx, "found %v@%v", test.id, test.ts).That(ok).Equals(true)
+		assert.For(ctx, "order %v@%v", test.id, test.ts).That(order).Equals(test.order)
+	}
+	_, ok := ordering.Lookup(3, 700)
+	assert.For(ctx, "unknown").That(ok).Equals(false)
+
+	submitTime, ok := ordering.SubmitTime(7, 650)
+	assert.For(ctx, "reused submit").That(ok).Equals(true)
+	assert.For(ctx, "reused submit time").That(submitTime).Equals(int64(600))
+	assert.For(ctx, "submissions").That(ordering.Len()).Equals(6)
+}
@@ -0,0 +1,207 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	// The buffer queue events of the graphics frame data source carry the
+	// buffer they are about as an argument.
+	swapchainQuery = "" +
+		"SELECT t.name, s.name, s.ts, s.dur, COALESCE(a.int_value, 0) FROM slice s JOIN gpu_track t ON s.track_id = t.id " +
+		"LEFT JOIN args a ON a.arg_set_id = s.arg_set_id AND a.key = 'buffer_id' " +
+		"WHERE t.scope = 'graphics_frame_event' AND s.name IN ('Dequeue', 'AcquireFenceSignaled', 'Queue', 'PresentFenceSignaled') ORDER BY s.ts"
+
+	// acquireStallThreshold is the time an acquisition has to block for to
+	// count as stalled.
+	acquireStallThreshold = uint64(time.Millisecond)
+	// starvationRatio is the part of the acquisitions that have to stall
+	// with all the images in flight for the swapchain to be starved.
+	starvationRatio = 0.1
+)
+
+// bufferEvent is a buffer queue event of a buffer of a layer.
+type bufferEvent struct {
+	layer, name string
+	buffer      uint64
+	ts, dur     uint64
+}
+
+// order returns the time the event takes effect.
+func (e bufferEvent) order() uint64 {
+	if e.name == "Dequeue" {
+		return e.ts + e.dur
+	}
+	return e.ts
+}
+
+// ComputeSwapchainTimeline tracks the uses of the images of each swapchain,
+// from being acquired to being displayed, and reports the pipelining depth
+// and the acquisitions stalled waiting for an image. Returns nil if the trace
+// has no buffer queue events.
+func ComputeSwapchainTimeline(ctx context.Context, processor perfetto.Querier) (*service.ProfilingData_SwapchainTimeline, error) {
+	swapchainQueryResult, err := processor.Query(swapchainQuery)
+	if err != nil {
+		return nil, queryError(err, swapchainQuery)
+	}
+	columns := swapchainQueryResult.GetColumns()
+	layers := columns[0].GetStringValues()
+	names := columns[1].GetStringValues()
+	timestamps := columns[2].GetLongValues()
+	durations := columns[3].GetLongValues()
+	buffers := columns[4].GetLongValues()
+
+	events := make([]bufferEvent, len(layers))
+	for i := range layers {
+		events[i] = bufferEvent{
+			layer:  layers[i],
+			name:   names[i],
+			buffer: uint64(buffers[i]),
+			ts:     uint64(timestamps[i]),
+			dur:    uint64(durations[i]),
+		}
+	}
+	return swapchainTimeline(events), nil
+}
+
+// swapchainTimeline builds the timeline of the swapchains from the events,
+// sorted by time. A dequeue starts a use of its buffer, which the following
+// events of the buffer complete. A blocked dequeue returns the buffer once
+// its previous use is released, so it is ordered by its end.
+func swapchainTimeline(events []bufferEvent) *service.ProfilingData_SwapchainTimeline {
+	events = append([]bufferEvent{}, events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].order() < events[j].order() })
+
+	swapchains := map[string]map[uint64]*service.ProfilingData_SwapchainTimeline_Image{}
+	for _, e := range events {
+		images, ok := swapchains[e.layer]
+		if !ok {
+			images = map[uint64]*service.ProfilingData_SwapchainTimeline_Image{}
+			swapchains[e.layer] = images
+		}
+		image, ok := images[e.buffer]
+		if e.name == "Dequeue" {
+			if !ok {
+				image = &service.ProfilingData_SwapchainTimeline_Image{BufferId: e.buffer}
+				images[e.buffer] = image
+			}
+			image.Uses = append(image.Uses, &service.ProfilingData_SwapchainTimeline_Use{
+				Acquired:     e.ts,
+				AcquireStall: e.dur,
+			})
+			image.AcquireStall += e.dur
+			continue
+		}
+		if !ok {
+			// Acquired before the start of the trace.
+			continue
+		}
+		use := image.Uses[len(image.Uses)-1]
+		switch e.name {
+		case "AcquireFenceSignaled":
+			use.Rendered = e.ts
+		case "Queue":
+			use.Presented = e.ts
+		case "PresentFenceSignaled":
+			use.Displayed = e.ts
+		}
+	}
+
+	res := &service.ProfilingData_SwapchainTimeline{}
+	for layer, images := range swapchains {
+		if len(images) > 0 {
+			res.Swapchains = append(res.Swapchains, swapchain(layer, images))
+		}
+	}
+	if len(res.Swapchains) == 0 {
+		return nil
+	}
+	sort.Slice(res.Swapchains, func(i, j int) bool {
+		a, b := res.Swapchains[i], res.Swapchains[j]
+		if a.Acquires != b.Acquires {
+			return a.Acquires > b.Acquires
+		}
+		return a.Layer < b.Layer
+	})
+	return res
+}
+
+// swapchain summarizes the uses of the images of the swapchain of the layer,
+// and sets the pipelining depth of each use.
+func swapchain(layer string, images map[uint64]*service.ProfilingData_SwapchainTimeline_Image) *service.ProfilingData_SwapchainTimeline_Swapchain {
+	res := &service.ProfilingData_SwapchainTimeline_Swapchain{Layer: layer}
+	for _, image := range images {
+		res.Images = append(res.Images, image)
+	}
+	sort.Slice(res.Images, func(i, j int) bool { return res.Images[i].BufferId < res.Images[j].BufferId })
+
+	starved, depths := uint32(0), uint64(0)
+	for _, image := range res.Images {
+		for _, use := range image.Uses {
+			// The images with a use in flight when the image was acquired. A
+			// previous use of the image itself is in flight if the
+			// acquisition waited for its release.
+			busy, depth := uint32(0), uint32(1)
+			for _, other := range res.Images {
+				if inFlight(other, use) {
+					busy++
+					if other != image {
+						depth++
+					}
+				}
+			}
+			use.Depth = depth
+			res.Acquires++
+			depths += uint64(depth)
+			if depth > res.MaxDepth {
+				res.MaxDepth = depth
+			}
+			if use.AcquireStall >= acquireStallThreshold {
+				res.StalledAcquires++
+				res.AcquireStall += use.AcquireStall
+				if busy == uint32(len(res.Images)) {
+					starved++
+				}
+			}
+		}
+	}
+	res.MeanDepth = float64(depths) / float64(res.Acquires)
+	res.Starved = starved > 0 && float64(starved) >= starvationRatio*float64(res.Acquires)
+	return res
+}
+
+// inFlight returns whether the image has a use acquired before, and not yet
+// released at, the acquisition of the given use. A buffer is only dequeued
+// again once released, so only its last use can be in flight. A use is
+// released once displayed, or presented if its display is unknown.
+func inFlight(image *service.ProfilingData_SwapchainTimeline_Image, use *service.ProfilingData_SwapchainTimeline_Use) bool {
+	i := sort.Search(len(image.Uses), func(i int) bool { return image.Uses[i].Acquired >= use.Acquired })
+	if i == 0 {
+		return false
+	}
+	last := image.Uses[i-1]
+	released := last.Displayed
+	if released == 0 {
+		released = last.Presented
+	}
+	return released == 0 || released > use.Acquired
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+)
+
+func TestSwapchainTimeline(t *testing.T) {
+	ctx := log.Testing(t)
+	stall := 2 * acquireStallThreshold
+	res := swapchainTimeline([]bufferEvent{
+		{layer: "app", name: "Queue", buffer: 3, ts: 0}, // Acquired before the trace.
+		{layer: "app", name: "Dequeue", buffer: 1, ts: 0},
+		{layer: "app", name: "Dequeue", buffer: 2, ts: 1},
+		{layer: "app", name: "Queue", buffer: 1, ts: 5},
+		{layer: "app", name: "AcquireFenceSignaled", buffer: 1, ts: 10},
+		{layer: "app", name: "Queue", buffer: 2, ts: 12},
+		// Both images are in flight, the acquisition stalls until the first
+		// is displayed.
+		{layer: "app", name: "Dequeue", buffer: 1, ts: 15, dur: stall},
+		{layer: "app", name: "PresentFenceSignaled", buffer: 1, ts: 20},
+		{layer: "app", name: "PresentFenceSignaled", buffer: 2, ts: 30},
+		{layer: "other", name: "Dequeue", buffer: 7, ts: 3},
+	})
+
+	assert.For(ctx, "swapchains").That(len(res.Swapchains)).Equals(2)
+	app := res.Swapchains[0]
+	assert.For(ctx, "layer").That(app.Layer).Equals("app")
+	assert.For(ctx, "images").That(len(app.Images)).Equals(2)
+	assert.For(ctx, "acquires").That(app.Acquires).Equals(uint32(3))
+	assert.For(ctx, "max depth").That(app.MaxDepth).Equals(uint32(2))
+	assert.For(ctx, "mean depth").That(app.MeanDepth).Equals(5.0 / 3)
+	assert.For(ctx, "stalled").That(app.StalledAcquires).Equals(uint32(1))
+	assert.For(ctx, "stall").That(app.AcquireStall).Equals(stall)
+	assert.For(ctx, "starved").That(app.Starved).Equals(true)
+
+	first := app.Images[0]
+	assert.For(ctx, "buffer").That(first.BufferId).Equals(uint64(1))
+	assert.For(ctx, "uses").That(len(first.Uses)).Equals(2)
+	assert.For(ctx, "acquired").That(first.Uses[0].Acquired).Equals(uint64(0))
+	assert.For(ctx, "rendered").That(first.Uses[0].Rendered).Equals(uint64(10))
+	assert.For(ctx, "presented").That(first.Uses[0].Presented).Equals(uint64(5))
+	assert.For(ctx, "displayed").That(first.Uses[0].Displayed).Equals(uint64(20))
+	assert.For(ctx, "first depth").That(first.Uses[0].Depth).Equals(uint32(1))
+	assert.For(ctx, "image stall").That(first.AcquireStall).Equals(stall)
+	assert.For(ctx, "second depth").That(app.Images[1].Uses[0].Depth).Equals(uint32(2))
+
+	other := res.Swapchains[1]
+	assert.For(ctx, "other starved").That(other.Starved).Equals(false)
+	assert.For(ctx, "other depth").That(other.MaxDepth).Equals(uint32(1))
+
+	assert.For(ctx, "no events").That(swapchainTimeline(nil)).IsNil()
+}
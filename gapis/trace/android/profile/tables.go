@@ -0,0 +1,154 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+// maxRowsPerInsert is the number of rows inserted per statement, bounded by
+// SQLite's limit on the number of terms of a VALUES clause.
+const maxRowsPerInsert = 500
+
+// table is a table of the profiling data exported to the trace processor.
+type table struct {
+	name    string
+	columns string
+	rows    func(data *service.ProfilingData, add func(values ...interface{}))
+}
+
+// exportedTables are the tables created by ExportTables. The slices are keyed
+// by the ID of their row in the trace processor's slice table, such that the
+// groups can be joined against the raw trace data.
+var exportedTables = []table{
+	{
+		name:    "agi_group",
+		columns: "id INT, name STRING, parent_id INT, first_command STRING, last_command STRING",
+		rows: func(data *service.ProfilingData, add func(values ...interface{})) {
+			for _, g := range data.GetSlices().GetGroups() {
+				add(g.Id, g.Name, g.ParentId, commandIndex(g.GetLink().GetFrom()), commandIndex(g.GetLink().GetTo()))
+			}
+		},
+	},
+	{
+		name:    "agi_slice",
+		columns: "slice_id INT, group_id INT, category STRING, confidence STRING, self_dur INT",
+		rows: func(data *service.ProfilingData, add func(values ...interface{})) {
+			for _, s := range data.GetSlices().GetSlices() {
+				add(s.Id, s.GroupId, s.Category.String(), s.Confidence.String(), s.SelfDur)
+			}
+		},
+	},
+	{
+		name:    "agi_metric",
+		columns: "id INT, counter_id INT, name STRING, unit STRING, average DOUBLE",
+		rows: func(data *service.ProfilingData, add func(values ...interface{})) {
+			for _, m := range data.GetGpuCounters().GetMetrics() {
+				add(m.Id, m.CounterId, m.Name, m.Unit, m.Average)
+			}
+		},
+	},
+	{
+		name:    "agi_group_metric",
+		columns: "group_id INT, metric_id INT, estimate DOUBLE, min DOUBLE, max DOUBLE",
+		rows: func(data *service.ProfilingData, add func(values ...interface{})) {
+			for _, e := range data.GetGpuCounters().GetEntries() {
+				for _, m := range data.GetGpuCounters().GetMetrics() {
+					if perf, ok := e.MetricToValue[m.Id]; ok {
+						add(e.GroupId, m.Id, perf.Estimate, perf.Min, perf.Max)
+					}
+				}
+			}
+		},
+	},
+}
+
+// ExportTables creates tables of the slice groups, slices and GPU counter
+// values of the profiling data in the trace processor, replacing the tables
+// of any previously exported data. This allows joining the groups computed by
+// AGI against the raw trace tables in a single query, e.g.
+//
+//	SELECT g.name, SUM(s.dur) FROM slice s
+//	JOIN agi_slice a ON a.slice_id = s.id JOIN agi_group g ON g.id = a.group_id
+//	GROUP BY g.id
+func ExportTables(ctx context.Context, processor perfetto.Querier, data *service.ProfilingData) error {
+	for _, t := range exportedTables {
+		if err := execStatement(processor, fmt.Sprintf("DROP TABLE IF EXISTS %v", t.name)); err != nil {
+			return err
+		}
+		if err := execStatement(processor, fmt.Sprintf("CREATE TABLE %v (%v)", t.name, t.columns)); err != nil {
+			return err
+		}
+		rows := []string{}
+		t.rows(data, func(values ...interface{}) {
+			rows = append(rows, sqlRow(values))
+		})
+		for len(rows) > 0 {
+			n := len(rows)
+			if n > maxRowsPerInsert {
+				n = maxRowsPerInsert
+			}
+			q := fmt.Sprintf("INSERT INTO %v VALUES %v", t.name, strings.Join(rows[:n], ", "))
+			if err := execStatement(processor, q); err != nil {
+				return err
+			}
+			rows = rows[n:]
+		}
+	}
+	return nil
+}
+
+// execStatement runs the statement, returning the error of either the query
+// or its result.
+func execStatement(processor perfetto.Querier, q string) error {
+	res, err := processor.Query(q)
+	if err == nil && res.GetError() != "" {
+		err = errors.New(res.GetError())
+	}
+	if err != nil {
+		return queryError(err, q)
+	}
+	return nil
+}
+
+// sqlRow formats the values as a row of a VALUES clause.
+func sqlRow(values []interface{}) string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			res[i] = "'" + strings.Replace(v, "'", "''", -1) + "'"
+		default:
+			res[i] = fmt.Sprint(v)
+		}
+	}
+	return "(" + strings.Join(res, ", ") + ")"
+}
+
+// commandIndex formats the command index as dot separated indices, or as an
+// empty string if the index is empty.
+func commandIndex(idx []uint64) string {
+	res := make([]string, len(idx))
+	for i, v := range idx {
+		res[i] = fmt.Sprint(v)
+	}
+	return strings.Join(res, ".")
+}
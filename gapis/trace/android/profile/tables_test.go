@@ -0,0 +1,88 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// statementRecorder is a Querier that records the statements it runs.
+type statementRecorder []string
+
+func (r *statementRecorder) Query(q string) (*perfetto_service.QueryResult, error) {
+	*r = append(*r, q)
+	return &perfetto_service.QueryResult{}, nil
+}
+
+func TestExportTables(t *testing.T) {
+	ctx := log.Testing(t)
+
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1, Name: "Pass 'A'", Link: &path.Commands{From: []uint64{3, 0, 1}, To: []uint64{3, 0, 2}}},
+			},
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Id: 42, GroupId: 1, SelfDur: 10},
+			},
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: 0, CounterId: 7, Name: "Busy", Unit: "%", Average: 0.5},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{
+				{GroupId: 1, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{
+					0: {Estimate: 0.25, Min: 0.125, Max: 0.5},
+				}},
+			},
+		},
+	}
+
+	var got statementRecorder
+	assert.For(ctx, "err").ThatError(ExportTables(ctx, &got, data)).Succeeded()
+	assert.For(ctx, "statements").That(len(got)).Equals(3 * len(exportedTables))
+	assert.For(ctx, "drop").That(got[0]).Equals("DROP TABLE IF EXISTS agi_group")
+	assert.For(ctx, "create").That(strings.HasPrefix(got[1], "CREATE TABLE agi_group (")).Equals(true)
+	assert.For(ctx, "group").That(got[2]).Equals("INSERT INTO agi_group VALUES (1, 'Pass ''A''', 0, '3.0.1', '3.0.2')")
+	assert.For(ctx, "slice").That(got[5]).Equals("INSERT INTO agi_slice VALUES (42, 1, 'Unknown', 'Unmatched', 10)")
+	assert.For(ctx, "metric").That(got[8]).Equals("INSERT INTO agi_metric VALUES (0, 7, 'Busy', '%', 0.5)")
+	assert.For(ctx, "group metric").That(got[11]).Equals("INSERT INTO agi_group_metric VALUES (1, 0, 0.25, 0.125, 0.5)")
+}
+
+func TestExportTablesBatches(t *testing.T) {
+	ctx := log.Testing(t)
+
+	slices := &service.ProfilingData_GpuSlices{}
+	for i := 0; i < maxRowsPerInsert+1; i++ {
+		slices.Slices = append(slices.Slices, &service.ProfilingData_GpuSlices_Slice{Id: uint64(i)})
+	}
+
+	var got statementRecorder
+	assert.For(ctx, "err").ThatError(ExportTables(ctx, &got, &service.ProfilingData{Slices: slices})).Succeeded()
+	inserts := 0
+	for _, q := range got {
+		if strings.HasPrefix(q, "INSERT INTO agi_slice ") {
+			inserts++
+		}
+	}
+	assert.For(ctx, "inserts").That(inserts).Equals(2)
+}
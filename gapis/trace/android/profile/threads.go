@@ -0,0 +1,275 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/gapid/gapis/perfetto"
+	"github.com/google/gapid/gapis/service"
+)
+
+const (
+	schedQuery = "" +
+		"SELECT s.ts, s.dur, s.utid, s.cpu, t.tid, t.name FROM sched s JOIN thread t USING(utid) " +
+		"WHERE s.utid != 0 ORDER BY s.ts"
+	cpuFreqQuery = "" +
+		"SELECT t.cpu, c.ts, c.value FROM counter c JOIN cpu_counter_track t ON c.track_id = t.id " +
+		"WHERE t.name = 'cpufreq' ORDER BY t.cpu, c.ts"
+
+	// maxThreadsPerFrame is the maximum number of threads reported per frame.
+	maxThreadsPerFrame = 8
+	// criticalUtilization is the minimum utilization of a thread during a
+	// frame, for the thread to be considered critical for the frame.
+	criticalUtilization = 0.5
+	// The thresholds above which a critical thread's scheduling is reported
+	// as an issue.
+	maxLittleCoreShare   = 0.5
+	maxClusterMigrations = 3
+	minFrequencyRatio    = 0.7
+)
+
+// schedSlice is a period of time a thread was scheduled on a CPU.
+type schedSlice struct {
+	ts, end uint64
+	utid    int64
+	cpu     int32
+}
+
+// freqSample is the frequency of a CPU from the sample's time on.
+type freqSample struct {
+	ts   uint64
+	freq float64
+}
+
+// schedData is the scheduling and CPU frequency data of a trace.
+type schedData struct {
+	slices  []schedSlice // sorted by start time.
+	maxDur  uint64
+	threads map[int64]*service.ProfilingData_ThreadTime
+
+	freqs    map[int32][]freqSample // sorted by time.
+	maxFreq  map[int32]float64
+	clusters map[int32]int // CPU -> cluster, 0 being the slowest.
+	// numClusters is the number of core clusters, zero if unknown.
+	numClusters int
+}
+
+// ComputeThreadUsage attributes the CPU time of each thread, from the
+// scheduling data in the trace, to the frames in gpuIdle, such that a CPU
+// bound frame can be attributed to a thread, e.g. the render thread. If the
+// trace contains CPU frequency data, the frames in which the critical threads
+// were slowed down by the scheduler, e.g. by running on the little cores, are
+// flagged. Traces without scheduling data leave the frames untouched.
+func ComputeThreadUsage(ctx context.Context, processor perfetto.Querier, gpuIdle *service.ProfilingData_GpuIdle) error {
+	if len(gpuIdle.GetFrames()) == 0 {
+		return nil
+	}
+
+	data, err := querySchedData(ctx, processor)
+	if err != nil {
+		return err
+	}
+	for _, frame := range gpuIdle.Frames {
+		frame.Threads = data.frameThreads(frame.Ts, frame.Ts+frame.Dur)
+		frame.SchedulerIssues = data.schedulerIssues(frame.Threads)
+	}
+	return nil
+}
+
+func querySchedData(ctx context.Context, processor perfetto.Querier) (*schedData, error) {
+	schedQueryResult, err := processor.Query(schedQuery)
+	if err != nil {
+		return nil, queryError(err, schedQuery)
+	}
+	columns := schedQueryResult.GetColumns()
+	timestamps := columns[0].GetLongValues()
+	durations := columns[1].GetLongValues()
+	utids := columns[2].GetLongValues()
+	cpus := columns[3].GetLongValues()
+	tids := columns[4].GetLongValues()
+	names := columns[5].GetStringValues()
+
+	data := &schedData{
+		slices:   make([]schedSlice, len(timestamps)),
+		threads:  map[int64]*service.ProfilingData_ThreadTime{},
+		freqs:    map[int32][]freqSample{},
+		maxFreq:  map[int32]float64{},
+		clusters: map[int32]int{},
+	}
+	for i := range timestamps {
+		data.slices[i] = schedSlice{uint64(timestamps[i]), uint64(timestamps[i] + durations[i]), utids[i], int32(cpus[i])}
+		if d := uint64(durations[i]); d > data.maxDur {
+			data.maxDur = d
+		}
+		if _, ok := data.threads[utids[i]]; !ok {
+			data.threads[utids[i]] = &service.ProfilingData_ThreadTime{Utid: utids[i], Tid: tids[i], Name: names[i]}
+		}
+	}
+
+	cpuFreqQueryResult, err := processor.Query(cpuFreqQuery)
+	if err != nil {
+		return nil, queryError(err, cpuFreqQuery)
+	}
+	columns = cpuFreqQueryResult.GetColumns()
+	freqCpus := columns[0].GetLongValues()
+	freqTimestamps := columns[1].GetLongValues()
+	freqValues := columns[2].GetDoubleValues()
+	for i := range freqCpus {
+		cpu := int32(freqCpus[i])
+		data.freqs[cpu] = append(data.freqs[cpu], freqSample{uint64(freqTimestamps[i]), freqValues[i]})
+		if freqValues[i] > data.maxFreq[cpu] {
+			data.maxFreq[cpu] = freqValues[i]
+		}
+	}
+	data.clusterCpus()
+	return data, nil
+}
+
+// clusterCpus groups the CPUs into clusters by their maximum frequency, as
+// the cores of a cluster share their frequency range.
+func (d *schedData) clusterCpus() {
+	freqs := []float64{}
+	seen := map[float64]bool{}
+	for _, f := range d.maxFreq {
+		if !seen[f] {
+			seen[f] = true
+			freqs = append(freqs, f)
+		}
+	}
+	sort.Float64s(freqs)
+	for cpu, f := range d.maxFreq {
+		d.clusters[cpu] = sort.SearchFloat64s(freqs, f)
+	}
+	d.numClusters = len(freqs)
+}
+
+// frequencyAt returns the frequency of the CPU at the given time, relative to
+// its maximum frequency, or zero if unknown.
+func (d *schedData) frequencyAt(cpu int32, ts uint64) float64 {
+	samples := d.freqs[cpu]
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].ts > ts }) - 1
+	if i < 0 || d.maxFreq[cpu] == 0 {
+		return 0
+	}
+	return samples[i].freq / d.maxFreq[cpu]
+}
+
+// frameThreads returns the CPU time of the busiest threads within [start, end).
+func (d *schedData) frameThreads(start, end uint64) []*service.ProfilingData_ThreadTime {
+	if end <= start {
+		return nil
+	}
+
+	type usage struct {
+		time        uint64
+		clusterTime []uint64
+		migrations  uint32
+		lastCluster int
+		freqTime    float64 // frequency ratio weighted by time.
+		knownTime   uint64  // time with a known frequency.
+	}
+	usages := map[int64]*usage{}
+
+	// No slice starting before start-maxDur can overlap the window.
+	first := sort.Search(len(d.slices), func(i int) bool { return d.slices[i].ts+d.maxDur > start })
+	for _, s := range d.slices[first:] {
+		if s.ts >= end {
+			break
+		}
+		if s.end <= start {
+			continue
+		}
+		from, to := s.ts, s.end
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+
+		u, ok := usages[s.utid]
+		if !ok {
+			u = &usage{clusterTime: make([]uint64, d.numClusters), lastCluster: -1}
+			usages[s.utid] = u
+		}
+		u.time += to - from
+		if cluster, ok := d.clusters[s.cpu]; ok {
+			u.clusterTime[cluster] += to - from
+			if u.lastCluster >= 0 && u.lastCluster != cluster {
+				u.migrations++
+			}
+			u.lastCluster = cluster
+		}
+		if f := d.frequencyAt(s.cpu, from); f > 0 {
+			u.freqTime += f * float64(to-from)
+			u.knownTime += to - from
+		}
+	}
+
+	res := make([]*service.ProfilingData_ThreadTime, 0, len(usages))
+	for utid, u := range usages {
+		thread := d.threads[utid]
+		t := &service.ProfilingData_ThreadTime{
+			Utid:              thread.Utid,
+			Tid:               thread.Tid,
+			Name:              thread.Name,
+			CpuTime:           u.time,
+			Utilization:       float64(u.time) / float64(end-start),
+			ClusterMigrations: u.migrations,
+			ClusterTime:       u.clusterTime,
+		}
+		if u.knownTime > 0 {
+			t.FrequencyRatio = u.freqTime / float64(u.knownTime)
+		}
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].CpuTime != res[j].CpuTime {
+			return res[i].CpuTime > res[j].CpuTime
+		}
+		return res[i].Utid < res[j].Utid
+	})
+	if len(res) > maxThreadsPerFrame {
+		res = res[:maxThreadsPerFrame]
+	}
+	return res
+}
+
+// schedulerIssues returns the scheduling issues of the critical threads of a
+// frame, given the frame's threads sorted by CPU time.
+func (d *schedData) schedulerIssues(threads []*service.ProfilingData_ThreadTime) []string {
+	issues := []string{}
+	for _, t := range threads {
+		if t.Utilization < criticalUtilization {
+			break
+		}
+		name := fmt.Sprintf("%v (%v)", t.Name, t.Tid)
+		if d.numClusters > 1 && t.CpuTime > 0 {
+			if share := float64(t.ClusterTime[0]) / float64(t.CpuTime); share > maxLittleCoreShare {
+				issues = append(issues, fmt.Sprintf("Thread %v ran %.0f%% of its time on the little cores", name, 100*share))
+			}
+		}
+		if t.ClusterMigrations >= maxClusterMigrations {
+			issues = append(issues, fmt.Sprintf("Thread %v migrated between core clusters %d times", name, t.ClusterMigrations))
+		}
+		if t.FrequencyRatio > 0 && t.FrequencyRatio < minFrequencyRatio {
+			issues = append(issues, fmt.Sprintf("Thread %v ran at %.0f%% of the maximum CPU frequency", name, 100*t.FrequencyRatio))
+		}
+	}
+	return issues
+}
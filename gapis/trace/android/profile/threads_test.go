@@ -0,0 +1,73 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/perfetto"
+	perfetto_service "github.com/google/gapid/gapis/perfetto/service"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeThreadUsage(t *testing.T) {
+	ctx := log.Testing(t)
+
+	longs := func(v ...int64) *perfetto_service.QueryResult_ColumnValues {
+		return &perfetto_service.QueryResult_ColumnValues{LongValues: v}
+	}
+	player := perfetto.QueryPlayer{
+		// The render thread runs 60ns on the little CPU 0, then 40ns on the
+		// big CPU 1, while a worker runs 10ns on CPU 0.
+		schedQuery: &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				longs(0, 60, 70),
+				longs(60, 40, 10),
+				longs(1, 1, 2),
+				longs(0, 1, 0),
+				longs(100, 100, 101),
+				{StringValues: []string{"RenderThread", "RenderThread", "Worker"}},
+			},
+		},
+		// CPU 0 runs at its maximum, CPU 1 at half of it during the frame.
+		cpuFreqQuery: &perfetto_service.QueryResult{
+			Columns: []*perfetto_service.QueryResult_ColumnValues{
+				longs(0, 1, 1),
+				longs(0, 0, 200),
+				{DoubleValues: []float64{1000, 1000, 2000}},
+			},
+		},
+	}
+	idle := &service.ProfilingData_GpuIdle{
+		Frames: []*service.ProfilingData_GpuIdle_Frame{{Ts: 0, Dur: 100}},
+	}
+	assert.For(ctx, "err").ThatError(ComputeThreadUsage(ctx, player, idle)).Succeeded()
+
+	frame := idle.Frames[0]
+	assert.For(ctx, "threads").That(len(frame.Threads)).Equals(2)
+	render := frame.Threads[0]
+	assert.For(ctx, "name").That(render.Name).Equals("RenderThread")
+	assert.For(ctx, "cpu time").That(render.CpuTime).Equals(uint64(100))
+	assert.For(ctx, "cluster time").ThatSlice(render.ClusterTime).Equals([]uint64{60, 40})
+	assert.For(ctx, "migrations").That(render.ClusterMigrations).Equals(uint32(1))
+	// 60ns at full speed and 40ns at half speed.
+	assert.For(ctx, "frequency").That(render.FrequencyRatio).Equals(0.8)
+	assert.For(ctx, "worker").That(frame.Threads[1].CpuTime).Equals(uint64(10))
+
+	// Only the little core share is an issue, the worker isn't critical.
+	assert.For(ctx, "issues").That(len(frame.SchedulerIssues)).Equals(1)
+}
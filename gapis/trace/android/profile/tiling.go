@@ -0,0 +1,141 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+var (
+	// binCounterNames and primitiveCounterNames are the lower case names of
+	// the vendor counters of the number of bins, or tiles, and of primitives.
+	binCounterNames = []string{
+		"bins", "bin count", "total bins", "gmem bins", // Adreno
+		"tiles", "physical tiles", "tile count", // Mali
+	}
+	primitiveCounterNames = []string{
+		"primitives", "input primitives", "total primitives", "prims processed", // Adreno
+		"total input primitives", "visible primitives", // Mali
+	}
+	// binArgNames are the names of the slice arguments holding the number of
+	// bins of a render pass, for drivers that report it per slice.
+	binArgNames = []string{"binCount", "bins", "numBins", "tileCount", "tiles"}
+)
+
+// ComputeTiling returns the number of bins touched by each render pass, i.e.
+// slice group, and the distribution of the primitives per bin, from the
+// slices' bin arguments or the bin and primitive counters. Returns nil if the
+// bins of none of the passes are known. The GPU counters of the data should
+// have been computed.
+func ComputeTiling(data *service.ProfilingData) *service.ProfilingData_Tiling {
+	binMetric, primitiveMetric := int32(-1), int32(-1)
+	for _, metric := range data.GetGpuCounters().GetMetrics() {
+		name := strings.ToLower(metric.Name)
+		if binMetric < 0 && containsString(binCounterNames, name) {
+			binMetric = metric.Id
+		}
+		if primitiveMetric < 0 && containsString(primitiveCounterNames, name) {
+			primitiveMetric = metric.Id
+		}
+	}
+
+	gpuTime := map[int32]uint64{}
+	sliceBins := map[int32]float64{}
+	for _, s := range data.GetSlices().GetSlices() {
+		if s.GroupId <= 0 {
+			continue
+		}
+		if s.Depth == 0 {
+			gpuTime[s.GroupId] += s.Dur
+		}
+		if bins, ok := binArg(s); ok && bins > sliceBins[s.GroupId] {
+			sliceBins[s.GroupId] = bins
+		}
+	}
+
+	counters := map[int32]map[int32]*service.ProfilingData_GpuCounters_Perf{}
+	for _, entry := range data.GetGpuCounters().GetEntries() {
+		counters[entry.GroupId] = entry.MetricToValue
+	}
+
+	res := &service.ProfilingData_Tiling{}
+	perBin := []float64{}
+	for _, group := range data.GetSlices().GetGroups() {
+		bins, ok := sliceBins[group.Id]
+		if !ok {
+			bins = counters[group.Id][binMetric].GetEstimate()
+		}
+		if bins <= 0 {
+			continue
+		}
+		pass := &service.ProfilingData_Tiling_Pass{
+			GroupId: group.Id,
+			Name:    group.Name,
+			Bins:    bins,
+			BinTime: float64(gpuTime[group.Id]) / bins,
+		}
+		if p := counters[group.Id][primitiveMetric].GetEstimate(); p > 0 {
+			pass.Primitives = p
+			pass.PrimitivesPerBin = p / bins
+			perBin = append(perBin, pass.PrimitivesPerBin)
+		}
+		res.Passes = append(res.Passes, pass)
+	}
+	if len(res.Passes) == 0 {
+		return nil
+	}
+	sort.SliceStable(res.Passes, func(i, j int) bool { return res.Passes[i].BinTime > res.Passes[j].BinTime })
+
+	if len(perBin) > 0 {
+		sort.Float64s(perBin)
+		res.PrimitivesPerBinP50 = perBin[(len(perBin)-1)/2]
+		res.PrimitivesPerBinP90 = perBin[(len(perBin)-1)*9/10]
+		res.PrimitivesPerBinMax = perBin[len(perBin)-1]
+	}
+	return res
+}
+
+// binArg returns the number of bins of the slice's arguments, if any.
+func binArg(s *service.ProfilingData_GpuSlices_Slice) (float64, bool) {
+	for _, extra := range s.Extras {
+		if !containsString(binArgNames, extra.Name) {
+			continue
+		}
+		switch v := extra.Value.(type) {
+		case *service.ProfilingData_GpuSlices_Slice_Extra_IntValue:
+			return float64(v.IntValue), true
+		case *service.ProfilingData_GpuSlices_Slice_Extra_DoubleValue:
+			return v.DoubleValue, true
+		case *service.ProfilingData_GpuSlices_Slice_Extra_StringValue:
+			if n, err := strconv.ParseFloat(v.StringValue, 64); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeTiling(t *testing.T) {
+	ctx := log.Testing(t)
+
+	perf := func(v float64) *service.ProfilingData_GpuCounters_Perf {
+		return &service.ProfilingData_GpuCounters_Perf{Estimate: v}
+	}
+	data := &service.ProfilingData{
+		Slices: &service.ProfilingData_GpuSlices{
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1, Name: "Shadow"}, {Id: 2, Name: "Main"}, {Id: 3, Name: "Blit"},
+			},
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				{Dur: 100, GroupId: 1},
+				{Dur: 400, GroupId: 2, Extras: []*service.ProfilingData_GpuSlices_Slice_Extra{
+					{Name: "binCount", Value: &service.ProfilingData_GpuSlices_Slice_Extra_StringValue{StringValue: "8"}},
+				}},
+				{Dur: 50, GroupId: 3},
+			},
+		},
+		GpuCounters: &service.ProfilingData_GpuCounters{
+			Metrics: []*service.ProfilingData_GpuCounters_Metric{
+				{Id: 10, Name: "Tiles"},
+				{Id: 11, Name: "Input Primitives"},
+			},
+			Entries: []*service.ProfilingData_GpuCounters_Entry{
+				{GroupId: 1, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{10: perf(4), 11: perf(1000)}},
+				{GroupId: 2, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{10: perf(16), 11: perf(4000)}},
+				{GroupId: 3, MetricToValue: map[int32]*service.ProfilingData_GpuCounters_Perf{11: perf(2)}},
+			},
+		},
+	}
+
+	tiling := ComputeTiling(data)
+	if !assert.For(ctx, "passes").That(len(tiling.GetPasses())).Equals(2) {
+		return
+	}
+	// The bins of the slice arguments take precedence over the counters.
+	main, shadow := tiling.Passes[0], tiling.Passes[1]
+	assert.For(ctx, "main").That(main.Name).Equals("Main")
+	assert.For(ctx, "main bins").That(main.Bins).Equals(8.0)
+	assert.For(ctx, "main bin time").That(main.BinTime).Equals(50.0)
+	assert.For(ctx, "main primitives per bin").That(main.PrimitivesPerBin).Equals(500.0)
+	assert.For(ctx, "shadow bins").That(shadow.Bins).Equals(4.0)
+	assert.For(ctx, "shadow bin time").That(shadow.BinTime).Equals(25.0)
+	assert.For(ctx, "p50").That(tiling.PrimitivesPerBinP50).Equals(250.0)
+	assert.For(ctx, "max").That(tiling.PrimitivesPerBinMax).Equals(500.0)
+
+	assert.For(ctx, "no bins").That(ComputeTiling(&service.ProfilingData{})).IsNil()
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+// submitCommandExtra is the slice extra holding the capture command index of
+// the vkQueueSubmit that executed the slice, as correlated with the Vulkan
+// events of the trace by the SubmissionOrdering.
+const submitCommandExtra = "submitCommand"
+
+// ComputeTimeMapping maps the commands of the capture to the times they
+// executed on the GPU, based on the correlation of the slices with the
+// vkQueueSubmit calls of the capture. Each correlated submission is mapped to
+// the time range of its slices, and each slice group linked to commands to
+// the time range of its correlated slices, including the slices of its
+// descendant groups. Slices without a correlated submission are skipped.
+func ComputeTimeMapping(capture *path.Capture, slices *service.ProfilingData_GpuSlices) *service.TimeMapping {
+	parents := map[int32]int32{}
+	links := map[int32]*path.Commands{}
+	for _, group := range slices.GetGroups() {
+		parents[group.Id] = group.ParentId
+		links[group.Id] = group.Link
+	}
+
+	submits := map[uint64]*interval{}
+	groups := map[int32]*interval{}
+	for _, slice := range slices.GetSlices() {
+		cmd, ok := sliceExtraInt(slice, submitCommandExtra)
+		if !ok {
+			continue
+		}
+		start, end := slice.Ts, slice.Ts+slice.Dur
+		if r, ok := submits[uint64(cmd)]; ok {
+			r.cover(start, end)
+		} else {
+			submits[uint64(cmd)] = &interval{start, end}
+		}
+		for id := slice.GroupId; id > 0; id = parents[id] {
+			if r, ok := groups[id]; ok {
+				r.cover(start, end)
+			} else {
+				groups[id] = &interval{start, end}
+			}
+		}
+	}
+
+	res := &service.TimeMapping{}
+	for cmd, r := range submits {
+		res.Entries = append(res.Entries, &service.TimeMapping_Entry{
+			Commands: &path.Commands{Capture: capture, From: []uint64{cmd}, To: []uint64{cmd}},
+			Start:    r.start,
+			End:      r.end,
+		})
+	}
+	for id, r := range groups {
+		if links[id] == nil {
+			continue
+		}
+		res.Entries = append(res.Entries, &service.TimeMapping_Entry{
+			Commands: links[id],
+			Start:    r.start,
+			End:      r.end,
+			GroupId:  id,
+		})
+	}
+	// Sort by start time, the enclosing entries first.
+	sort.Slice(res.Entries, func(i, j int) bool {
+		a, b := res.Entries[i], res.Entries[j]
+		switch {
+		case a.Start != b.Start:
+			return a.Start < b.Start
+		case a.End != b.End:
+			return a.End > b.End
+		default:
+			return a.GroupId < b.GroupId
+		}
+	})
+	return res
+}
+
+// LookupTime returns the entries of the mapping, sorted as by
+// ComputeTimeMapping, that executed at the given time, i.e. the commands
+// executing on the GPU at that time, from the enclosing submission to the
+// innermost group.
+func LookupTime(mapping *service.TimeMapping, ts uint64) []*service.TimeMapping_Entry {
+	// The entries starting after ts can not contain it. The entries starting
+	// before may end before ts, as the ranges of different submissions or
+	// queues overlap, so check each of them.
+	n := sort.Search(len(mapping.Entries), func(i int) bool {
+		return mapping.Entries[i].Start > ts
+	})
+	res := []*service.TimeMapping_Entry{}
+	for _, e := range mapping.Entries[:n] {
+		if ts < e.End {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// groupTimeRanges returns the time range of the slices of each group,
+// including the slices of its descendant groups. Groups without slices have
+// no range.
+func groupTimeRanges(slices *service.ProfilingData_GpuSlices) map[int32]*interval {
+	ranges := map[int32]*interval{}
+	parents := map[int32]int32{}
+	for _, group := range slices.GetGroups() {
+		parents[group.Id] = group.ParentId
+	}
+
+	for _, slice := range slices.GetSlices() {
+		end := slice.Ts + slice.Dur
+		// Extend the range of the slice's group and all its ancestors.
+		for id := slice.GroupId; id > 0; id = parents[id] {
+			if r, ok := ranges[id]; !ok {
+				ranges[id] = &interval{slice.Ts, end}
+			} else {
+				r.cover(slice.Ts, end)
+			}
+		}
+	}
+	return ranges
+}
+
+// cover extends the interval to cover the given range.
+func (i *interval) cover(start, end uint64) {
+	if start < i.start {
+		i.start = start
+	}
+	if end > i.end {
+		i.end = end
+	}
+}
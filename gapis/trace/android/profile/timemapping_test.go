@@ -0,0 +1,97 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/service/path"
+)
+
+func TestComputeTimeMapping(t *testing.T) {
+	ctx := log.Testing(t)
+
+	submitted := func(cmd uint64) []*service.ProfilingData_GpuSlices_Slice_Extra {
+		return []*service.ProfilingData_GpuSlices_Slice_Extra{
+			{Name: "submitCommand", Value: &service.ProfilingData_GpuSlices_Slice_Extra_IntValue{IntValue: cmd}},
+		}
+	}
+
+	capture := &path.Capture{}
+	submit5 := &path.Commands{Capture: capture, From: []uint64{5}, To: []uint64{5}}
+	submit9 := &path.Commands{Capture: capture, From: []uint64{9}, To: []uint64{9}}
+	cmdBuf := &path.Commands{From: []uint64{5, 0, 0}, To: []uint64{5, 0, 0}}
+	rp1 := &path.Commands{From: []uint64{5, 0, 0, 1}, To: []uint64{5, 0, 0, 3}}
+	rp2 := &path.Commands{From: []uint64{5, 0, 0, 4}, To: []uint64{5, 0, 0, 6}}
+	slices := &service.ProfilingData_GpuSlices{
+		Groups: []*service.ProfilingData_GpuSlices_Group{
+			{Id: 1, Link: submit5},
+			{Id: 2, ParentId: 1, Link: cmdBuf},
+			{Id: 3, ParentId: 2, Link: rp1},
+			{Id: 4, ParentId: 2, Link: rp2},
+			{Id: 5, ParentId: 2}, // no slices
+			{Id: 6},              // no link
+		},
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 300, Dur: 50, GroupId: 4, Extras: submitted(5)},
+			{Ts: 100, Dur: 100, GroupId: 3, Extras: submitted(5)},
+			{Ts: 120, Dur: 200, GroupId: 3, Extras: submitted(5)},
+			{Ts: 330, Dur: 100, GroupId: 6, Extras: submitted(9)},
+			{Ts: 50, Dur: 500, GroupId: 4}, // not correlated
+		},
+	}
+
+	mapping := ComputeTimeMapping(capture, slices)
+	expected := []struct {
+		group      int32
+		start, end uint64
+		commands   *path.Commands
+	}{
+		{0, 100, 350, submit5},
+		{1, 100, 350, submit5},
+		{2, 100, 350, cmdBuf},
+		{3, 100, 320, rp1},
+		{4, 300, 350, rp2},
+		{0, 330, 430, submit9},
+	}
+	assert.For(ctx, "entries").That(len(mapping.Entries)).Equals(len(expected))
+	for i, e := range expected {
+		got := mapping.Entries[i]
+		assert.For(ctx, "group").That(got.GroupId).Equals(e.group)
+		assert.For(ctx, "start").That(got.Start).Equals(e.start)
+		assert.For(ctx, "end").That(got.End).Equals(e.end)
+		assert.For(ctx, "commands").That(got.Commands).DeepEquals(e.commands)
+	}
+
+	for _, test := range []struct {
+		ts     uint64
+		groups []int32
+	}{
+		{50, []int32{}},
+		{110, []int32{0, 1, 2, 3}},
+		{340, []int32{0, 1, 2, 4, 0}},
+		{400, []int32{0}},
+		{430, []int32{}},
+	} {
+		groups := []int32{}
+		for _, e := range LookupTime(mapping, test.ts) {
+			groups = append(groups, e.GroupId)
+		}
+		assert.For(ctx, "lookup %d", test.ts).ThatSlice(groups).Equals(test.groups)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+
+	"github.com/google/gapid/core/context/keys"
+)
+
+const traceSinkKey = contextKey("traceSink")
+
+// PutTraceSink returns a context in which the Perfetto traces of the profiled
+// replays are passed to sink once their profiling data was processed, e.g. to
+// keep them queryable.
+func PutTraceSink(ctx context.Context, sink func(data []byte)) context.Context {
+	return keys.WithValue(ctx, traceSinkKey, sink)
+}
+
+// SinkTrace passes the Perfetto trace data to the sink of the context, if
+// any.
+func SinkTrace(ctx context.Context, data []byte) {
+	if sink, ok := ctx.Value(traceSinkKey).(func(data []byte)); ok {
+		sink(data)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// ComputePassTrends tracks the render passes, i.e. the slice groups, across
+// the frames of the data and returns the GPU time of each pass per frame.
+// The groups of a frame are matched to the passes by their name and, for
+// names occurring more than once in a frame, the order of the groups in the
+// frame. Only passes occurring in more than one frame are returned, by
+// decreasing total GPU time. The data's GPU idle time should have been
+// computed.
+func ComputePassTrends(data *service.ProfilingData) []*service.ProfilingData_PassTrend {
+	frames := data.GetGpuIdle().GetFrames()
+	if len(frames) < 2 {
+		return nil
+	}
+	names := map[int32]string{}
+	for _, group := range data.GetSlices().GetGroups() {
+		names[group.Id] = group.Name
+	}
+
+	// The GPU time of the top level slices of each group, by frame, and the
+	// groups of each frame in the order of their first slice.
+	type frameGroup struct {
+		frame int
+		group int32
+	}
+	gpuTime := map[frameGroup]uint64{}
+	order := make([][]int32, len(frames))
+	for _, s := range data.GetSlices().GetSlices() {
+		if s.Depth != 0 || s.GroupId <= 0 {
+			continue
+		}
+		f := frameOf(data.GetGpuIdle(), s.Ts)
+		if f < 0 {
+			continue
+		}
+		k := frameGroup{f, s.GroupId}
+		if _, ok := gpuTime[k]; !ok {
+			order[f] = append(order[f], s.GroupId)
+		}
+		gpuTime[k] += s.Dur
+	}
+
+	type passKey struct {
+		name       string
+		occurrence uint32
+	}
+	passes := map[passKey]*service.ProfilingData_PassTrend{}
+	keys := []passKey{}
+	for f, groups := range order {
+		occurrences := map[string]uint32{}
+		for _, group := range groups {
+			name := names[group]
+			k := passKey{name, occurrences[name]}
+			occurrences[name]++
+			pass, ok := passes[k]
+			if !ok {
+				pass = &service.ProfilingData_PassTrend{Name: name, Occurrence: k.occurrence}
+				passes[k] = pass
+				keys = append(keys, k)
+			}
+			pass.Samples = append(pass.Samples, &service.ProfilingData_PassTrend_Sample{
+				FrameId: frames[f].FrameId,
+				GpuTime: gpuTime[frameGroup{f, group}],
+			})
+		}
+	}
+
+	res := []*service.ProfilingData_PassTrend{}
+	totals := map[*service.ProfilingData_PassTrend]uint64{}
+	for _, k := range keys {
+		pass := passes[k]
+		if len(pass.Samples) < 2 {
+			continue
+		}
+		total := uint64(0)
+		for _, s := range pass.Samples {
+			total += s.GpuTime
+		}
+		totals[pass] = total
+		pass.Mean = float64(total) / float64(len(pass.Samples))
+		pass.Slope = trendSlope(pass.Samples)
+		res = append(res, pass)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return totals[res[i]] > totals[res[j]] })
+	return res
+}
+
+// trendSlope returns the least squares slope of the GPU times of the samples
+// over their index, in nanoseconds per frame.
+func trendSlope(samples []*service.ProfilingData_PassTrend_Sample) float64 {
+	n := float64(len(samples))
+	sumX, sumY, sumXY, sumXX := 0.0, 0.0, 0.0, 0.0
+	for i, s := range samples {
+		x, y := float64(i), float64(s.GpuTime)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / d
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputePassTrends(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Three frames of a shadow pass rendered twice per frame, the second
+	// cascade growing, and a main pass. The post pass only occurs once.
+	slice := func(ts, dur uint64, group int32) *service.ProfilingData_GpuSlices_Slice {
+		return &service.ProfilingData_GpuSlices_Slice{Ts: ts, Dur: dur, GroupId: group}
+	}
+	data := &service.ProfilingData{
+		GpuIdle: &service.ProfilingData_GpuIdle{
+			Frames: []*service.ProfilingData_GpuIdle_Frame{
+				{FrameId: 1, Ts: 0, Dur: 100},
+				{FrameId: 2, Ts: 100, Dur: 100},
+				{FrameId: 3, Ts: 200, Dur: 100},
+			},
+		},
+		Slices: &service.ProfilingData_GpuSlices{
+			Groups: []*service.ProfilingData_GpuSlices_Group{
+				{Id: 1, Name: "Shadow"}, {Id: 2, Name: "Shadow"}, {Id: 3, Name: "Main"},
+				{Id: 4, Name: "Shadow"}, {Id: 5, Name: "Shadow"}, {Id: 6, Name: "Main"},
+				{Id: 7, Name: "Shadow"}, {Id: 8, Name: "Shadow"}, {Id: 9, Name: "Main"},
+				{Id: 10, Name: "Post"},
+			},
+			Slices: []*service.ProfilingData_GpuSlices_Slice{
+				slice(0, 10, 1), slice(10, 10, 2), slice(20, 40, 3), slice(60, 5, 3),
+				slice(100, 10, 4), slice(110, 20, 5), slice(130, 45, 6),
+				slice(200, 10, 7), slice(210, 30, 8), slice(240, 45, 9), slice(290, 5, 10),
+				{Ts: 245, Dur: 20, GroupId: 9, Depth: 1},
+			},
+		},
+	}
+
+	trends := ComputePassTrends(data)
+	if !assert.For(ctx, "trends").That(len(trends)).Equals(3) {
+		return
+	}
+	for i, expected := range []struct {
+		name       string
+		occurrence uint32
+		times      []uint64
+		slope      float64
+	}{
+		{"Main", 0, []uint64{45, 45, 45}, 0},
+		{"Shadow", 1, []uint64{10, 20, 30}, 10},
+		{"Shadow", 0, []uint64{10, 10, 10}, 0},
+	} {
+		trend := trends[i]
+		assert.For(ctx, "name %d", i).That(trend.Name).Equals(expected.name)
+		assert.For(ctx, "occurrence %d", i).That(trend.Occurrence).Equals(expected.occurrence)
+		times := []uint64{}
+		for _, s := range trend.Samples {
+			times = append(times, s.GpuTime)
+		}
+		assert.For(ctx, "times %d", i).ThatSlice(times).Equals(expected.times)
+		assert.For(ctx, "slope %d", i).That(trend.Slope).Equals(expected.slope)
+	}
+	assert.For(ctx, "frame").That(trends[1].Samples[2].FrameId).Equals(int64(3))
+	assert.For(ctx, "mean").That(trends[1].Mean).Equals(20.0)
+}
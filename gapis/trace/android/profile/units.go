@@ -0,0 +1,157 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+// measureUnitNames are the names of the units of the GPU counter specs.
+var measureUnitNames = map[device.GpuCounterDescriptor_MeasureUnit]string{
+	device.GpuCounterDescriptor_BIT:         "bit",
+	device.GpuCounterDescriptor_BYTE:        "B",
+	device.GpuCounterDescriptor_KILOBYTE:    "KB",
+	device.GpuCounterDescriptor_MEGABYTE:    "MB",
+	device.GpuCounterDescriptor_GIGABYTE:    "GB",
+	device.GpuCounterDescriptor_HERTZ:       "Hz",
+	device.GpuCounterDescriptor_KILOHERTZ:   "kHz",
+	device.GpuCounterDescriptor_MEGAHERTZ:   "MHz",
+	device.GpuCounterDescriptor_GIGAHERTZ:   "GHz",
+	device.GpuCounterDescriptor_NANOSECOND:  "ns",
+	device.GpuCounterDescriptor_MICROSECOND: "us",
+	device.GpuCounterDescriptor_MILLISECOND: "ms",
+	device.GpuCounterDescriptor_SECOND:      "s",
+	device.GpuCounterDescriptor_VERTEX:      "vertices",
+	device.GpuCounterDescriptor_PIXEL:       "pixels",
+	device.GpuCounterDescriptor_TRIANGLE:    "triangles",
+	device.GpuCounterDescriptor_PRIMITIVE:   "primitives",
+	device.GpuCounterDescriptor_FRAGMENT:    "fragments",
+	device.GpuCounterDescriptor_MILLIWATT:   "mW",
+	device.GpuCounterDescriptor_WATT:        "W",
+	device.GpuCounterDescriptor_JOULE:       "J",
+	device.GpuCounterDescriptor_CELSIUS:     "°C",
+	device.GpuCounterDescriptor_PERCENT:     "%",
+	device.GpuCounterDescriptor_INSTRUCTION: "instructions",
+}
+
+// vendorCounterUnits are the units of vendor counters, by name, that are
+// commonly reported without a unit.
+var vendorCounterUnits = map[string]string{
+	// Adreno
+	"GPU Frequency":                          "Hz",
+	"GPU % Utilization":                      "%",
+	"GPU % Bus Busy":                         "%",
+	"% Shaders Busy":                         "%",
+	"% Texture Fetch Stall":                  "%",
+	"% Vertex Fetch Stall":                   "%",
+	"Avg Bytes / Fragment":                   "B",
+	"Avg Bytes / Vertex":                     "B",
+	"Fragment ALU Instructions / Sec (Full)": "instructions/s",
+	"Fragments Shaded / Second":              "fragments/s",
+	"Vertices Shaded / Second":               "vertices/s",
+	// Mali
+	"GPU active cycles":           "cycles",
+	"Fragment active cycles":      "cycles",
+	"Non-fragment active cycles":  "cycles",
+	"Tiler active cycles":         "cycles",
+	"External memory read bytes":  "B",
+	"External memory write bytes": "B",
+}
+
+// counterUnitPatterns infer the unit of a counter from its name. The first
+// matching pattern wins, so more specific patterns come first.
+var counterUnitPatterns = []struct {
+	pattern *regexp.Regexp
+	unit    string
+}{
+	// Units spelled out in the name, e.g. "Read Total (Bytes/sec)".
+	{regexp.MustCompile(`(?i)\(bytes\s*/\s*sec(ond)?\)|bytes\s*(/|per)\s*sec(ond)?`), "B/s"},
+	{regexp.MustCompile(`(?i)\(bytes\)`), "B"},
+	{regexp.MustCompile(`(?i)\(%\)|%|percent|utili[sz]ation|busy|stall`), "%"},
+	{regexp.MustCompile(`(?i)(/|per)\s*sec(ond)?\b`), "/s"},
+	{regexp.MustCompile(`(?i)\bfreq(uency)?\b|\bclock\b`), "Hz"},
+	{regexp.MustCompile(`(?i)\bcycles?\b`), "cycles"},
+	{regexp.MustCompile(`(?i)\bbytes?\b|\bbandwidth\b`), "B"},
+	{regexp.MustCompile(`(?i)\b(time|duration|latency)\b`), "ns"},
+}
+
+// InferCounterUnit returns the unit of the counter, for a counter without a
+// unit, from the units of its spec, the table of known vendor counters or the
+// patterns of its name, in that order. Returns an empty string if none
+// applies.
+func InferCounterUnit(counter *service.ProfilingData_Counter) string {
+	if unit := specUnit(counter.GetSpec()); unit != "" {
+		return unit
+	}
+	if unit, ok := vendorCounterUnits[counter.Name]; ok {
+		return unit
+	}
+	for _, p := range counterUnitPatterns {
+		if p.pattern.MatchString(counter.Name) {
+			return p.unit
+		}
+	}
+	return ""
+}
+
+// specUnit returns the unit described by the numerator and denominator units
+// of the spec, e.g. "B/s". Returns an empty string if the spec has no units,
+// or units without a name.
+func specUnit(spec *device.GpuCounterDescriptor_GpuCounterSpec) string {
+	join := func(units []device.GpuCounterDescriptor_MeasureUnit) (string, bool) {
+		names := make([]string, len(units))
+		for i, u := range units {
+			name, ok := measureUnitNames[u]
+			if !ok {
+				return "", false
+			}
+			names[i] = name
+		}
+		return strings.Join(names, "·"), true
+	}
+	numerator, ok := join(spec.GetNumeratorUnits())
+	if !ok {
+		return ""
+	}
+	denominator, ok := join(spec.GetDenominatorUnits())
+	if !ok {
+		return ""
+	}
+	switch {
+	case denominator == "":
+		return numerator
+	case numerator == "":
+		return "1/" + denominator
+	default:
+		return numerator + "/" + denominator
+	}
+}
+
+// inferCounterUnits sets the inferred units of the counters without a unit.
+func inferCounterUnits(counters []*service.ProfilingData_Counter) {
+	for _, counter := range counters {
+		if counter.Unit != "" {
+			continue
+		}
+		if unit := InferCounterUnit(counter); unit != "" {
+			counter.Unit = unit
+			counter.UnitInferred = true
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/device"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestInferCounterUnits(t *testing.T) {
+	ctx := log.Testing(t)
+
+	bytesPerSecond := &device.GpuCounterDescriptor_GpuCounterSpec{
+		NumeratorUnits:   []device.GpuCounterDescriptor_MeasureUnit{device.GpuCounterDescriptor_BYTE},
+		DenominatorUnits: []device.GpuCounterDescriptor_MeasureUnit{device.GpuCounterDescriptor_SECOND},
+	}
+	counters := []*service.ProfilingData_Counter{
+		{Name: "Reported", Unit: "ns"},
+		{Name: "Bus Traffic", Spec: bytesPerSecond},
+		{Name: "GPU active cycles"},
+		{Name: "Read Total (Bytes/sec)"},
+		{Name: "ALU Utilization"},
+		{Name: "Shader Core Freq"},
+		{Name: "Vertices Shaded"},
+	}
+	inferCounterUnits(counters)
+
+	for i, expected := range []struct {
+		unit     string
+		inferred bool
+	}{
+		{"ns", false},
+		{"B/s", true},
+		{"cycles", true},
+		{"B/s", true},
+		{"%", true},
+		{"Hz", true},
+		{"", false},
+	} {
+		assert.For(ctx, "unit %d", i).That(counters[i].Unit).Equals(expected.unit)
+		assert.For(ctx, "inferred %d", i).That(counters[i].UnitInferred).Equals(expected.inferred)
+	}
+}
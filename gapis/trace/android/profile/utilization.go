@@ -0,0 +1,117 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sort"
+
+	"github.com/google/gapid/gapis/service"
+)
+
+// gpuBoundUtilization is the minimum GPU utilization of a frame for the frame
+// to be considered limited by the GPU.
+const gpuBoundUtilization = 0.9
+
+// interval is a period of time, [start, end).
+type interval struct {
+	start, end uint64
+}
+
+// busyTime returns the total time covered by the intervals, counting the
+// overlapping parts once. Sorts the intervals.
+func busyTime(intervals []interval) uint64 {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	res, end := uint64(0), uint64(0)
+	for _, i := range intervals {
+		switch {
+		case i.start >= end:
+			res += i.end - i.start
+			end = i.end
+		case i.end > end:
+			res += i.end - end
+			end = i.end
+		}
+	}
+	return res
+}
+
+// ComputeUtilization returns the share of the time the GPU was busy, overall
+// and per hardware queue track, from the slices, and per frame, from the GPU
+// idle time of the frames. Returns nil if there are no slices.
+func ComputeUtilization(slices *service.ProfilingData_GpuSlices, gpuIdle *service.ProfilingData_GpuIdle) *service.ProfilingData_Utilization {
+	if len(slices.GetSlices()) == 0 {
+		return nil
+	}
+
+	all := make([]interval, 0, len(slices.Slices))
+	tracks := map[int32][]interval{}
+	start, end := slices.Slices[0].Ts, uint64(0)
+	for _, s := range slices.Slices {
+		i := interval{s.Ts, s.Ts + s.Dur}
+		all = append(all, i)
+		tracks[s.TrackId] = append(tracks[s.TrackId], i)
+		if i.start < start {
+			start = i.start
+		}
+		if i.end > end {
+			end = i.end
+		}
+	}
+
+	res := &service.ProfilingData_Utilization{
+		Duration: end - start,
+		Busy:     busyTime(all),
+	}
+	ratio := func(busy uint64) float64 {
+		if res.Duration == 0 {
+			return 0
+		}
+		return float64(busy) / float64(res.Duration)
+	}
+	res.Utilization = ratio(res.Busy)
+
+	names := map[int32]string{}
+	for _, t := range slices.Tracks {
+		names[t.Id] = t.Name
+	}
+	for id, intervals := range tracks {
+		busy := busyTime(intervals)
+		res.Tracks = append(res.Tracks, &service.ProfilingData_Utilization_Track{
+			TrackId:     id,
+			Name:        names[id],
+			Busy:        busy,
+			Utilization: ratio(busy),
+		})
+	}
+	sort.Slice(res.Tracks, func(i, j int) bool { return res.Tracks[i].TrackId < res.Tracks[j].TrackId })
+
+	frames := gpuIdle.GetFrames()
+	for i, frame := range frames {
+		frameTime := frame.Dur
+		if i+1 < len(frames) && frames[i+1].Ts > frame.Ts {
+			frameTime = frames[i+1].Ts - frame.Ts
+		}
+		f := &service.ProfilingData_Utilization_Frame{FrameId: frame.FrameId}
+		if frameTime > 0 {
+			f.Utilization = float64(frame.Dur-frame.Idle) / float64(frameTime)
+		}
+		f.GpuBound = f.Utilization >= gpuBoundUtilization
+		if f.GpuBound {
+			res.GpuBoundFrames++
+		}
+		res.Frames = append(res.Frames, f)
+	}
+	return res
+}
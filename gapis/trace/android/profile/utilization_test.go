@@ -0,0 +1,74 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestComputeUtilization(t *testing.T) {
+	ctx := log.Testing(t)
+	slices := &service.ProfilingData_GpuSlices{
+		Slices: []*service.ProfilingData_GpuSlices_Slice{
+			{Ts: 0, Dur: 100, TrackId: 1},
+			{Ts: 50, Dur: 100, TrackId: 1}, // overlaps the first slice.
+			{Ts: 100, Dur: 100, TrackId: 2},
+			{Ts: 300, Dur: 100, TrackId: 1},
+		},
+		Tracks: []*service.ProfilingData_GpuSlices_Track{
+			{Id: 1, Name: "fragment"},
+			{Id: 2, Name: "vertex"},
+		},
+	}
+	gpuIdle := &service.ProfilingData_GpuIdle{
+		Frames: []*service.ProfilingData_GpuIdle_Frame{
+			{FrameId: 1, Ts: 0, Dur: 200, Idle: 0},
+			{FrameId: 2, Ts: 300, Dur: 100, Idle: 0},
+			{FrameId: 3, Ts: 1000, Dur: 100, Idle: 50},
+		},
+	}
+
+	res := ComputeUtilization(slices, gpuIdle)
+	assert.For(ctx, "duration").That(res.Duration).Equals(uint64(400))
+	assert.For(ctx, "busy").That(res.Busy).Equals(uint64(300))
+	assert.For(ctx, "utilization").That(res.Utilization).Equals(0.75)
+
+	assert.For(ctx, "tracks").That(len(res.Tracks)).Equals(2)
+	assert.For(ctx, "track name").That(res.Tracks[0].Name).Equals("fragment")
+	assert.For(ctx, "track busy").That(res.Tracks[0].Busy).Equals(uint64(250))
+	assert.For(ctx, "track utilization").That(res.Tracks[1].Utilization).Equals(0.25)
+
+	assert.For(ctx, "frames").That(len(res.Frames)).Equals(3)
+	// Busy for 200 of the 300 until the next frame.
+	assert.For(ctx, "cpu bound").That(res.Frames[0].GpuBound).Equals(false)
+	// Busy for 100 of the 700 until the next frame.
+	assert.For(ctx, "idle frame").That(res.Frames[1].GpuBound).Equals(false)
+	// The last frame is measured against its own duration.
+	assert.For(ctx, "last frame").That(res.Frames[2].Utilization).Equals(0.5)
+
+	gpuIdle.Frames[1].Dur = 680
+	res = ComputeUtilization(slices, gpuIdle)
+	assert.For(ctx, "gpu bound").That(res.Frames[1].GpuBound).Equals(true)
+	assert.For(ctx, "gpu bound frames").That(res.GpuBoundFrames).Equals(uint32(1))
+}
+
+func TestComputeUtilizationEmpty(t *testing.T) {
+	ctx := log.Testing(t)
+	assert.For(ctx, "utilization").That(ComputeUtilization(&service.ProfilingData_GpuSlices{}, nil)).IsNil()
+}
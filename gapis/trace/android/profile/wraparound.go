@@ -0,0 +1,41 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"github.com/google/gapid/gapis/service"
+)
+
+// counterWrapRange is the range of the 32-bit hardware counters. A counter
+// that wraps between two samples produces a negative delta, off by the range.
+const counterWrapRange = float64(1 << 32)
+
+// unwrapCounter corrects the samples of the counter that wrapped around at
+// 2^32, returning whether any sample was corrected. Only counters whose
+// samples are amounts accumulated over the sample period, and so can't be
+// negative, are unwrapped.
+func unwrapCounter(counter *service.ProfilingData_Counter) bool {
+	if counter.Aggregation != service.ProfilingData_GpuCounters_Metric_Summation {
+		return false
+	}
+	unwrapped := false
+	for i, v := range counter.Values {
+		if v < 0 && v > -counterWrapRange {
+			counter.Values[i] = v + counterWrapRange
+			unwrapped = true
+		}
+	}
+	return unwrapped
+}
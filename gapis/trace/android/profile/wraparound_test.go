@@ -0,0 +1,47 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+func TestUnwrapCounter(t *testing.T) {
+	ctx := log.Testing(t)
+
+	summed := &service.ProfilingData_Counter{
+		Aggregation: service.ProfilingData_GpuCounters_Metric_Summation,
+		Values:      []float64{100, -4294967000, 200},
+	}
+	assert.For(ctx, "unwrapped").That(unwrapCounter(summed)).Equals(true)
+	assert.For(ctx, "values").ThatSlice(summed.Values).Equals([]float64{100, 296, 200})
+
+	clean := &service.ProfilingData_Counter{
+		Aggregation: service.ProfilingData_GpuCounters_Metric_Summation,
+		Values:      []float64{1, 2, 3},
+	}
+	assert.For(ctx, "clean").That(unwrapCounter(clean)).Equals(false)
+
+	averaged := &service.ProfilingData_Counter{
+		Aggregation: service.ProfilingData_GpuCounters_Metric_TimeWeightedAvg,
+		Values:      []float64{-5},
+	}
+	assert.For(ctx, "averaged").That(unwrapCounter(averaged)).Equals(false)
+	assert.For(ctx, "averaged value").That(averaged.Values[0]).Equals(-5.0)
+}
@@ -51,10 +51,15 @@ import (
 	"github.com/google/gapid/gapis/perfetto"
 	perfetto_android "github.com/google/gapid/gapis/perfetto/android"
 	"github.com/google/gapid/gapis/service"
-	"github.com/google/gapid/gapis/trace/android/adreno"
-	"github.com/google/gapid/gapis/trace/android/mali"
+	"github.com/google/gapid/gapis/trace/android/gfxstream"
+	"github.com/google/gapid/gapis/trace/android/profile"
 	"github.com/google/gapid/gapis/trace/android/validate"
 	"github.com/google/gapid/gapis/trace/tracer"
+
+	// The GPU vendor backends register themselves with the profile package.
+	_ "github.com/google/gapid/gapis/trace/android/adreno"
+	_ "github.com/google/gapid/gapis/trace/android/mali"
+	_ "github.com/google/gapid/gapis/trace/android/powervr"
 )
 
 const (
@@ -80,16 +85,26 @@ type androidTracer struct {
 }
 
 func newValidator(dev bind.Device) validate.Validator {
-	gpuName := dev.Instance().GetConfiguration().GetHardware().GetGPU().GetName()
-	if strings.Contains(gpuName, "Adreno") {
-		return &adreno.AdrenoValidator{}
-	} else if strings.Contains(gpuName, "Mali") {
-		return mali.NewMaliValidator(gpuName)
+	if b, ok := profile.FindBackend(dev.Instance()); ok && b.NewValidator != nil {
+		return b.NewValidator(dev.Instance())
 	}
 	return nil
 }
 
 func deviceValidationTraceOptions(ctx context.Context, v validate.Validator) (*service.TraceOptions, error) {
+	if _, ok := v.(*gfxstream.Validator); ok {
+		// Emulators have no render stages or counters, only the host timings.
+		return &service.TraceOptions{
+			DeferStart: true,
+			PerfettoConfig: &perfetto_pb.TraceConfig{
+				Buffers: []*perfetto_pb.TraceConfig_BufferConfig{
+					{SizeKb: proto.Uint32(bufferSizeKb)},
+				},
+				DurationMs:  proto.Uint32(durationMs),
+				DataSources: []*perfetto_pb.TraceConfig_DataSource{gfxstream.DataSource()},
+			},
+		}, nil
+	}
 	counters := v.GetCounters()
 	ids := make([]uint32, len(counters))
 	for i, counter := range counters {
@@ -139,22 +154,28 @@ func (t *androidTracer) ProcessProfilingData(ctx context.Context, buffer *bytes.
 		return nil, log.Errf(ctx, err, "Failed to create trace processor")
 	}
 	conf := t.b.Instance().GetConfiguration()
-	gpu := conf.GetHardware().GetGPU()
 	desc := conf.GetPerfettoCapability().GetGpuProfiling().GetGpuCounterDescriptor()
-	gpuName := gpu.GetName()
-	if strings.Contains(gpuName, "Adreno") {
-		return adreno.ProcessProfilingData(ctx, processor, capture, desc, handleMappings, syncData)
-	} else if strings.Contains(gpuName, "Mali") {
-		return mali.ProcessProfilingData(ctx, processor, capture, desc, handleMappings, syncData)
+	backend, ok := profile.FindBackend(t.b.Instance())
+	if !ok {
+		return nil, profile.Errf(service.ProfilingErrorCode_UnsupportedGpu, nil, "Failed to process Perfetto trace for device %v", conf.GetHardware().GetGPU().GetName())
+	}
+
+	data, err := profile.WithQueryRecording(ctx, processor, func(querier perfetto.Querier) (*service.ProfilingData, error) {
+		return backend.ProcessProfilingData(ctx, querier, capture, desc, handleMappings, syncData)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, log.Errf(ctx, nil, "Failed to process Perfetto trace for device %v", gpuName)
+	profile.AnnotateKnownIssues(data, t.b.Instance())
+	profile.SinkTrace(ctx, rawData)
+	return data, nil
 }
 
 func (t *androidTracer) Validate(ctx context.Context) error {
 	ctx = status.Start(ctx, "Android Device Validation")
 	defer status.Finish(ctx)
 	if t.v == nil {
-		return log.Errf(ctx, nil, "No validator found for device %d", t.b.Instance().ID.ID())
+		return profile.Errf(service.ProfilingErrorCode_UnsupportedGpu, nil, "No validator found for device %d", t.b.Instance().ID.ID())
 	}
 	d := t.b.(adb.Device)
 	osConfiguration := d.Instance().GetConfiguration()
@@ -164,8 +185,9 @@ func (t *androidTracer) Validate(ctx context.Context) error {
 	if osConfiguration.GetPerfettoCapability() == nil {
 		return log.Errf(ctx, nil, "No Perfetto Capability found on device %d", d.Instance().ID.ID())
 	}
-	if gpuProfiling := osConfiguration.GetPerfettoCapability().GetGpuProfiling(); gpuProfiling == nil || gpuProfiling.GetGpuCounterDescriptor() == nil {
-		return log.Errf(ctx, nil, "No GPU profiling capabilities found on device %d", d.Instance().ID.ID())
+	// Emulators report the gfxstream host timings in place of GPU profiling data.
+	if gpuProfiling := osConfiguration.GetPerfettoCapability().GetGpuProfiling(); !gfxstream.IsEmulator(d.Instance()) && (gpuProfiling == nil || gpuProfiling.GetGpuCounterDescriptor() == nil) {
+		return profile.Errf(service.ProfilingErrorCode_NoProfilingCapability, nil, "No GPU profiling capabilities found on device %d", d.Instance().ID.ID())
 	}
 
 	// Get ActivityAction
@@ -185,7 +207,7 @@ func (t *androidTracer) Validate(ctx context.Context) error {
 	if err != nil {
 		return log.Err(ctx, err, "Could not get the trace configuration")
 	}
-	process, cleanup, err := perfetto_android.Start(ctx, d, activityAction, traceOpts, nil, []string{})
+	process, cleanup, err := perfetto_android.Start(ctx, d, activityAction, traceOpts, nil, []string{}, nil)
 	if err != nil {
 		cleanup.Invoke(ctx)
 		return log.Err(ctx, err, "Error when start Perfetto tracing.")
@@ -679,7 +701,7 @@ func (t *androidTracer) SetupTrace(ctx context.Context, o *service.TraceOptions)
 		}
 		var perfettoCleanup app.Cleanup
 		log.E(ctx, "Setting up layers %+v: %+v", packageABI, layers)
-		process, perfettoCleanup, err = perfetto_android.Start(ctx, t.b, a, o, packageABI, layers)
+		process, perfettoCleanup, err = perfetto_android.Start(ctx, t.b, a, o, packageABI, layers, tracer.VulkanLayers(o))
 		cleanup = cleanup.Then(perfettoCleanup)
 	} else {
 		log.I(ctx, "Starting with options %+v", tracer.GapiiOptions(o))
@@ -0,0 +1,236 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gapid/core/app/crash"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/core/os/android"
+	"github.com/google/gapid/core/os/android/adb"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/trigger"
+)
+
+// pendingPresent is the present time reported by SurfaceFlinger for the
+// frames that were not presented yet.
+const pendingPresent = math.MaxInt64
+
+// pidPollInterval is how often the process of the application is looked for
+// until it started.
+const pidPollInterval = 500 * time.Millisecond
+
+var uriPackage = regexp.MustCompile("([^:]*):([^/]*)/\\.?(.*)")
+
+// triggerSource observes the frames of the traced application from the
+// SurfaceFlinger frame statistics, the markers from the logcat and the
+// counters by reading their files.
+type triggerSource struct {
+	d        adb.Device
+	pkg      string
+	frames   bool
+	counters []string
+	// layer is the SurfaceFlinger layer of the application, empty until it's
+	// found.
+	layer string
+	// lastPresent is the present time of the last observed frame.
+	lastPresent int64
+	// primed is set once the frames presented before the first poll were
+	// skipped.
+	primed bool
+
+	cancel  task.CancelFunc
+	mutex   sync.Mutex
+	markers []trigger.Observation
+}
+
+// ObserveTriggers implements tracer.TriggerObserver.
+func (t *androidTracer) ObserveTriggers(ctx context.Context, o *service.TraceOptions) (trigger.Source, error) {
+	observed, err := trigger.Observe(o.GetTriggers())
+	if err != nil {
+		return nil, err
+	}
+	src := &triggerSource{
+		d:        t.b,
+		frames:   observed.Frames,
+		counters: observed.Counters,
+	}
+	if match := uriPackage.FindStringSubmatch(o.GetUri()); len(match) == 4 {
+		src.pkg = match[2]
+	}
+	if src.frames && src.pkg == "" {
+		return nil, log.Err(ctx, nil, "Frame time triggers need the URI of the traced application")
+	}
+
+	if observed.Markers && src.pkg == "" {
+		return nil, log.Err(ctx, nil, "Marker triggers need the URI of the traced application")
+	}
+
+	ctx, src.cancel = task.WithCancel(ctx)
+	if observed.Markers {
+		crash.Go(func() { src.observeMarkers(ctx) })
+	}
+	return src, nil
+}
+
+// observeMarkers waits for the application to start, then observes the
+// messages it logs at all priorities as markers, until ctx is stopped.
+func (s *triggerSource) observeMarkers(ctx context.Context) {
+	pkg := &android.InstalledPackage{Name: s.pkg, Device: s.d}
+	pid, err := pkg.Pid(ctx)
+	for err == android.ErrProcessNotFound {
+		select {
+		case <-task.ShouldStop(ctx):
+			return
+		case <-time.After(pidPollInterval):
+		}
+		pid, err = pkg.Pid(ctx)
+	}
+	if err != nil {
+		log.W(ctx, "Failed to find the process of %v for the trace triggers: %v", s.pkg, err)
+		return
+	}
+
+	msgs := make(chan android.LogcatMessage, 64)
+	crash.Go(func() {
+		for msg := range msgs {
+			s.mutex.Lock()
+			s.markers = append(s.markers, trigger.Observation{Marker: msg.Tag + ": " + msg.Message})
+			s.mutex.Unlock()
+		}
+	})
+	if err := s.d.ProcessLogcat(ctx, pid, msgs); err != nil && !task.Stopped(ctx) {
+		log.W(ctx, "Observing the logcat for the trace triggers failed: %v", err)
+	}
+}
+
+// Poll implements trigger.Source.
+func (s *triggerSource) Poll(ctx context.Context) ([]trigger.Observation, error) {
+	var res []trigger.Observation
+	if s.frames {
+		frames, err := s.pollFrames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, frames...)
+	}
+
+	s.mutex.Lock()
+	res = append(res, s.markers...)
+	s.markers = nil
+	s.mutex.Unlock()
+
+	for _, path := range s.counters {
+		out, err := s.d.Shell("cat", path).Call(ctx)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Failed to read the counter %v", path)
+		}
+		// Some driver nodes hold several values, the first is used.
+		fields := strings.Fields(out)
+		if len(fields) == 0 {
+			return nil, log.Errf(ctx, nil, "The counter %v has no value", path)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, log.Errf(ctx, err, "Invalid value of the counter %v: %v", path, fields[0])
+		}
+		res = append(res, trigger.Observation{Counter: path, Value: value})
+	}
+	return res, nil
+}
+
+// pollFrames returns the frame times of the frames of the application
+// presented since the last poll. The frames presented before the first poll
+// are not observed.
+func (s *triggerSource) pollFrames(ctx context.Context) ([]trigger.Observation, error) {
+	if s.layer == "" {
+		out, err := s.d.Shell("dumpsys", "SurfaceFlinger", "--list").Call(ctx)
+		if err != nil {
+			return nil, log.Err(ctx, err, "Failed to list the SurfaceFlinger layers")
+		}
+		if s.layer = applicationLayer(out, s.pkg); s.layer == "" {
+			// The application is not shown yet.
+			return nil, nil
+		}
+		log.I(ctx, "Observing the frames of the layer %v", s.layer)
+	}
+
+	out, err := s.d.Shell("dumpsys", "SurfaceFlinger", "--latency", "'"+s.layer+"'").Call(ctx)
+	if err != nil {
+		return nil, log.Err(ctx, err, "Failed to get the SurfaceFlinger frame statistics")
+	}
+	// The first line is the refresh period, followed by the desired present,
+	// actual present and frame ready times of the last frames.
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) <= 1 {
+		// The layer is gone, e.g. the application restarted the activity.
+		s.layer = ""
+		return nil, nil
+	}
+
+	var res []trigger.Observation
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		present, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || present == 0 || present == pendingPresent || present <= s.lastPresent {
+			continue
+		}
+		if s.lastPresent != 0 {
+			res = append(res, trigger.Observation{FrameTime: time.Duration(present - s.lastPresent)})
+		}
+		s.lastPresent = present
+	}
+	if !s.primed {
+		// Skip the frames presented before the triggers were observed.
+		s.primed = true
+		return nil, nil
+	}
+	return res, nil
+}
+
+// Close implements trigger.Source.
+func (s *triggerSource) Close(ctx context.Context) {
+	s.cancel()
+}
+
+// applicationLayer returns the SurfaceFlinger layer of the application from
+// the list of layers, preferring the SurfaceView the games render to.
+func applicationLayer(layers, pkg string) string {
+	res := ""
+	for _, layer := range strings.Split(layers, "\n") {
+		layer = strings.TrimSpace(layer)
+		if !strings.Contains(layer, pkg) {
+			continue
+		}
+		if strings.HasPrefix(layer, "SurfaceView") {
+			return layer
+		}
+		if res == "" {
+			res = layer
+		}
+	}
+	return res
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
 	"github.com/google/gapid/gapis/trace/tracer"
+	"github.com/google/gapid/gapis/trace/trigger"
 )
 
 func trace(ctx context.Context, device *path.Device, start task.Signal, stop task.Signal, ready task.Task, options *service.TraceOptions, written *int64, buffer *bytes.Buffer) error {
@@ -110,6 +111,20 @@ func ProcessProfilingData(ctx context.Context, device *path.Device, capture *pat
 	return t.ProcessProfilingData(ctx, buffer, capture, handleMapping, syncData)
 }
 
+// ObserveTriggers starts observing the application traced with the given
+// options for its triggers.
+func ObserveTriggers(ctx context.Context, device *path.Device, options *service.TraceOptions) (trigger.Source, error) {
+	t, err := GetTracer(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := t.(tracer.TriggerObserver)
+	if !ok {
+		return nil, log.Errf(ctx, nil, "Trace triggers are not supported on this device")
+	}
+	return o.ObserveTriggers(ctx, options)
+}
+
 func Validate(ctx context.Context, device *path.Device) error {
 	t, err := GetTracer(ctx, device)
 	if err != nil {
@@ -23,11 +23,13 @@ import (
 	"github.com/google/gapid/core/app"
 	"github.com/google/gapid/core/app/layout"
 	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/os/android"
 	"github.com/google/gapid/core/os/device/bind"
 	gapii "github.com/google/gapid/gapii/client"
 	"github.com/google/gapid/gapis/api/sync"
 	"github.com/google/gapid/gapis/service"
 	"github.com/google/gapid/gapis/service/path"
+	"github.com/google/gapid/gapis/trace/trigger"
 )
 
 // TraceTargetTreeNode represents a node in the traceable application
@@ -81,6 +83,14 @@ type Tracer interface {
 	Validate(ctx context.Context) error
 }
 
+// TriggerObserver is an optional interface that a Tracer can implement to
+// support the triggers of the trace options.
+type TriggerObserver interface {
+	// ObserveTriggers starts observing the application traced with the given
+	// options for its triggers.
+	ObserveTriggers(ctx context.Context, o *service.TraceOptions) (trigger.Source, error)
+}
+
 // LayersFromOptions Parses the perfetto options, and returns the required layers
 func LayersFromOptions(ctx context.Context, o *service.TraceOptions) []string {
 	ret := []string{}
@@ -139,5 +149,19 @@ func GapiiOptions(o *service.TraceOptions) gapii.Options {
 		o.PipeName,
 		o.ProcessName,
 		o.LoadValidationLayer,
+		VulkanLayers(o),
+	}
+}
+
+// VulkanLayers returns the additional Vulkan layers of the given TraceOptions.
+func VulkanLayers(o *service.TraceOptions) []android.Layer {
+	layers := []android.Layer{}
+	for _, l := range o.GetVulkanLayers().GetLayers() {
+		layers = append(layers, android.Layer{
+			Name:     l.Name,
+			Package:  l.Package,
+			Settings: l.Settings,
+		})
 	}
+	return layers
 }
@@ -0,0 +1,225 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trigger starts and stops traces automatically when conditions on
+// the traced application are met.
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+)
+
+// pollInterval is the time between two polls of the observations.
+const pollInterval = 250 * time.Millisecond
+
+// Observation is an observation of the traced application, of either a frame,
+// a marker or a counter value.
+type Observation struct {
+	// FrameTime is the time between the presentation of a frame and of the
+	// previous one, or 0 if the observation is not of a frame.
+	FrameTime time.Duration
+	// Marker is a message logged by the application, as "<tag>: <message>".
+	Marker string
+	// Counter is the path of the counter that had the value Value.
+	Counter string
+	Value   float64
+}
+
+func (o Observation) String() string {
+	switch {
+	case o.FrameTime != 0:
+		return fmt.Sprintf("frame time %v", o.FrameTime)
+	case o.Marker != "":
+		return fmt.Sprintf("marker %q", o.Marker)
+	default:
+		return fmt.Sprintf("counter %v = %v", o.Counter, o.Value)
+	}
+}
+
+// Source is a source of observations of the traced application.
+type Source interface {
+	// Poll returns the observations made since the previous call.
+	Poll(ctx context.Context) ([]Observation, error)
+	// Close stops observing the application.
+	Close(ctx context.Context)
+}
+
+// Observed lists what the triggers observe: the frames, the markers and the
+// paths of the counters.
+type Observed struct {
+	Frames   bool
+	Markers  bool
+	Counters []string
+}
+
+// Enabled returns true if there is a start or stop trigger.
+func Enabled(triggers *service.TraceTriggers) bool {
+	return len(triggers.GetStart()) > 0 || len(triggers.GetStop()) > 0
+}
+
+// Observe returns what the triggers observe, or an error if any of the
+// triggers is invalid.
+func Observe(triggers *service.TraceTriggers) (Observed, error) {
+	res := Observed{}
+	seen := map[string]bool{}
+	for _, t := range append(append([]*service.TraceTrigger{}, triggers.GetStart()...), triggers.GetStop()...) {
+		switch c := t.GetCondition().(type) {
+		case *service.TraceTrigger_FrameTimeMs:
+			if c.FrameTimeMs <= 0 {
+				return Observed{}, fmt.Errorf("Invalid frame time trigger: %v ms", c.FrameTimeMs)
+			}
+			res.Frames = true
+		case *service.TraceTrigger_Marker:
+			if _, err := regexp.Compile(c.Marker); err != nil {
+				return Observed{}, fmt.Errorf("Invalid marker trigger %q: %v", c.Marker, err)
+			}
+			res.Markers = true
+		case *service.TraceTrigger_Counter:
+			path := c.Counter.GetPath()
+			if path == "" {
+				return Observed{}, fmt.Errorf("Counter trigger without a counter path")
+			}
+			if !seen[path] {
+				seen[path] = true
+				res.Counters = append(res.Counters, path)
+			}
+		default:
+			return Observed{}, fmt.Errorf("Trigger without a condition")
+		}
+	}
+	return res, nil
+}
+
+// matcher is a trigger with its marker regular expression compiled.
+type matcher struct {
+	trigger *service.TraceTrigger
+	marker  *regexp.Regexp
+}
+
+func compile(triggers []*service.TraceTrigger) []matcher {
+	res := make([]matcher, len(triggers))
+	for i, t := range triggers {
+		res[i] = matcher{trigger: t}
+		if m := t.GetMarker(); m != "" {
+			res[i].marker = regexp.MustCompile(m)
+		}
+	}
+	return res
+}
+
+// fires returns true if the trigger fires on the observation.
+func (m matcher) fires(o Observation) bool {
+	switch c := m.trigger.GetCondition().(type) {
+	case *service.TraceTrigger_FrameTimeMs:
+		return o.FrameTime > time.Duration(float64(c.FrameTimeMs)*float64(time.Millisecond))
+	case *service.TraceTrigger_Marker:
+		return o.Marker != "" && m.marker.MatchString(o.Marker)
+	case *service.TraceTrigger_Counter:
+		return o.Counter == c.Counter.GetPath() && o.Value > c.Counter.GetThreshold()
+	}
+	return false
+}
+
+// Watch polls the source until one of the start triggers fires and calls
+// start, then, dropping the observations made while starting, until one of
+// the stop triggers fires and calls stop once the stop delay elapsed. Start is not called if there are no start triggers. It
+// returns early, without an error, if ctx is cancelled, e.g. because the
+// trace was stopped otherwise.
+func Watch(ctx context.Context, triggers *service.TraceTriggers, src Source, start, stop task.Task) error {
+	if _, err := Observe(triggers); err != nil {
+		return err
+	}
+
+	if starts := compile(triggers.GetStart()); len(starts) > 0 {
+		waitCtx := ctx
+		if timeout := triggers.GetStartTimeout(); timeout > 0 {
+			var cancel task.CancelFunc
+			waitCtx, cancel = task.WithTimeout(ctx, seconds(timeout))
+			defer cancel()
+		}
+		o, err := wait(waitCtx, src, starts)
+		switch {
+		case task.Stopped(ctx):
+			return nil
+		case task.Stopped(waitCtx):
+			return log.Errf(ctx, nil, "No start trigger fired within %vs", triggers.GetStartTimeout())
+		case err != nil:
+			return err
+		}
+		log.I(ctx, "Start trigger fired on %v", o)
+		if err := start(ctx); err != nil {
+			return err
+		}
+		// Drop the observations made while the trace was starting, e.g. the
+		// markers logged since the start trigger fired.
+		if _, err := src.Poll(ctx); err != nil {
+			return err
+		}
+	}
+
+	stops := compile(triggers.GetStop())
+	if len(stops) == 0 {
+		return nil
+	}
+	o, err := wait(ctx, src, stops)
+	switch {
+	case task.Stopped(ctx):
+		return nil
+	case err != nil:
+		return err
+	}
+	log.I(ctx, "Stop trigger fired on %v", o)
+	if delay := triggers.GetStopDelay(); delay > 0 {
+		select {
+		case <-task.ShouldStop(ctx):
+			return nil
+		case <-time.After(seconds(delay)):
+		}
+	}
+	return stop(ctx)
+}
+
+// wait polls the source until one of the triggers fires, and returns the
+// observation it fired on.
+func wait(ctx context.Context, src Source, triggers []matcher) (Observation, error) {
+	for {
+		observations, err := src.Poll(ctx)
+		if err != nil {
+			return Observation{}, err
+		}
+		for _, o := range observations {
+			for _, t := range triggers {
+				if t.fires(o) {
+					return o, nil
+				}
+			}
+		}
+		select {
+		case <-task.ShouldStop(ctx):
+			return Observation{}, task.StopReason(ctx)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func seconds(s float32) time.Duration {
+	return time.Duration(float64(s) * float64(time.Second))
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2021 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trigger_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gapid/core/assert"
+	"github.com/google/gapid/core/event/task"
+	"github.com/google/gapid/core/log"
+	"github.com/google/gapid/gapis/service"
+	"github.com/google/gapid/gapis/trace/trigger"
+)
+
+// fakeSource returns the observations of polls in order, then none.
+type fakeSource struct {
+	mutex  sync.Mutex
+	polls  [][]trigger.Observation
+	polled int
+}
+
+func (s *fakeSource) Poll(ctx context.Context) ([]trigger.Observation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.polled++
+	if s.polled > len(s.polls) {
+		return nil, nil
+	}
+	return s.polls[s.polled-1], nil
+}
+
+func (s *fakeSource) Close(ctx context.Context) {}
+
+func (s *fakeSource) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.polled
+}
+
+// recorder records the number of polls of the source when the trace was
+// started and stopped, 0 if it wasn't.
+type recorder struct {
+	src     *fakeSource
+	started int
+	stopped int
+	// The time the trace was stopped at.
+	stopT time.Time
+}
+
+func (r *recorder) start(ctx context.Context) error {
+	r.started = r.src.count()
+	return nil
+}
+
+func (r *recorder) stop(ctx context.Context) error {
+	r.stopped, r.stopT = r.src.count(), time.Now()
+	return nil
+}
+
+func marker(re string) *service.TraceTrigger {
+	return &service.TraceTrigger{Condition: &service.TraceTrigger_Marker{Marker: re}}
+}
+
+func TestWatchStartStop(t *testing.T) {
+	ctx := log.Testing(t)
+	src := &fakeSource{polls: [][]trigger.Observation{
+		{{Marker: "app: hello"}},
+		{{Marker: "app: start"}},
+		// Logged while the trace was starting.
+		{{Marker: "app: stop"}},
+		{{FrameTime: time.Millisecond}},
+		{{Marker: "app: stop"}},
+	}}
+	r := &recorder{src: src}
+	triggers := &service.TraceTriggers{
+		Start: []*service.TraceTrigger{marker("start$")},
+		Stop:  []*service.TraceTrigger{marker("stop$")},
+	}
+
+	err := trigger.Watch(ctx, triggers, src, r.start, r.stop)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "started").That(r.started).Equals(2)
+	assert.For(ctx, "stopped").That(r.stopped).Equals(5)
+}
+
+func TestWatchStopDelay(t *testing.T) {
+	ctx := log.Testing(t)
+	src := &fakeSource{polls: [][]trigger.Observation{{{FrameTime: 50 * time.Millisecond}}}}
+	r := &recorder{src: src}
+	triggers := &service.TraceTriggers{
+		Stop:      []*service.TraceTrigger{{Condition: &service.TraceTrigger_FrameTimeMs{FrameTimeMs: 30}}},
+		StopDelay: 0.2,
+	}
+
+	begin := time.Now()
+	err := trigger.Watch(ctx, triggers, src, r.start, r.stop)
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "started").That(r.started).Equals(0)
+	assert.For(ctx, "stopped").That(r.stopped).Equals(1)
+	assert.For(ctx, "delay").That(r.stopT.Sub(begin) >= 200*time.Millisecond).Equals(true)
+}
+
+func TestWatchStartTimeout(t *testing.T) {
+	ctx := log.Testing(t)
+	src := &fakeSource{}
+	r := &recorder{src: src}
+	triggers := &service.TraceTriggers{
+		Start:        []*service.TraceTrigger{marker("start$")},
+		Stop:         []*service.TraceTrigger{marker("stop$")},
+		StartTimeout: 0.3,
+	}
+
+	err := trigger.Watch(ctx, triggers, src, r.start, r.stop)
+	assert.For(ctx, "err").ThatError(err).Failed()
+	assert.For(ctx, "started").That(r.started).Equals(0)
+	assert.For(ctx, "stopped").That(r.stopped).Equals(0)
+}
+
+func TestWatchCancel(t *testing.T) {
+	ctx := log.Testing(t)
+
+	// Cancelled while waiting for the start trigger.
+	src := &fakeSource{}
+	r := &recorder{src: src}
+	triggers := &service.TraceTriggers{
+		Start: []*service.TraceTrigger{marker("start$")},
+		Stop:  []*service.TraceTrigger{marker("stop$")},
+	}
+	cancelCtx, cancel := task.WithTimeout(ctx, 300*time.Millisecond)
+	err := trigger.Watch(cancelCtx, triggers, src, r.start, r.stop)
+	cancel()
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "started").That(r.started).Equals(0)
+	assert.For(ctx, "stopped").That(r.stopped).Equals(0)
+
+	// Cancelled during the stop delay.
+	src = &fakeSource{polls: [][]trigger.Observation{{{Marker: "app: stop"}}}}
+	r = &recorder{src: src}
+	triggers = &service.TraceTriggers{
+		Stop:      []*service.TraceTrigger{marker("stop$")},
+		StopDelay: 10,
+	}
+	cancelCtx, cancel = task.WithTimeout(ctx, 300*time.Millisecond)
+	err = trigger.Watch(cancelCtx, triggers, src, r.start, r.stop)
+	cancel()
+	assert.For(ctx, "err").ThatError(err).Succeeded()
+	assert.For(ctx, "stopped").That(r.stopped).Equals(0)
+}
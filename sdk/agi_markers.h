@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2021 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// In-app markers for AGI's GPU profiler.
+//
+// Apps using the Perfetto SDK can delimit their own rendering passes with
+// these markers, rather than relying on the detection of the passes of known
+// game engines. The GPU work submitted while a pass marker is active is
+// attributed to the pass, named by the marker's name.
+//
+// The markers are track events of the "agi.pass" category, which the app
+// registers along with its own categories:
+//
+//   PERFETTO_DEFINE_CATEGORIES(AGI_TRACK_EVENT_CATEGORIES, ...);
+//   PERFETTO_TRACK_EVENT_STATIC_STORAGE();
+//
+// and which the trace config enables with the "track_event" data source:
+//
+//   data_sources {
+//     config {
+//       name: "track_event"
+//       track_event_config { enabled_categories: "agi.pass" }
+//     }
+//   }
+//
+// The passes are marked on the thread submitting their work:
+//
+//   {
+//     AGI_PASS("Shadows");
+//     RecordAndSubmitShadowPass();
+//   }
+
+#ifndef __AGI_MARKERS_H__
+#define __AGI_MARKERS_H__
+
+#include <perfetto.h>
+
+// The track_event category of the pass markers.
+#define AGI_PASS_CATEGORY "agi.pass"
+
+// The categories of the AGI markers, to add to the app's
+// PERFETTO_DEFINE_CATEGORIES.
+#define AGI_TRACK_EVENT_CATEGORIES      \
+  perfetto::Category(AGI_PASS_CATEGORY) \
+      .SetDescription("Rendering passes delimited by the app, for AGI")
+
+// Marks a pass from here to the end of the enclosing scope.
+#define AGI_PASS(name) TRACE_EVENT(AGI_PASS_CATEGORY, name)
+
+// Marks the beginning and the end of a pass spanning several scopes. The
+// begin and end markers must be emitted on the same thread.
+#define AGI_PASS_BEGIN(name) TRACE_EVENT_BEGIN(AGI_PASS_CATEGORY, name)
+#define AGI_PASS_END() TRACE_EVENT_END(AGI_PASS_CATEGORY)
+
+#endif  // __AGI_MARKERS_H__
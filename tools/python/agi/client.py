@@ -0,0 +1,139 @@
+# Copyright (C) 2021 Google Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Client of the GAPIS gRPC service, mirroring gapis/client/profiling."""
+
+import os
+import re
+import secrets
+import subprocess
+import sys
+
+import grpc
+
+# The generated modules import each other by their proto path, so the
+# directory they were generated into needs to be on the path.
+sys.path.insert(0, os.path.join(os.path.dirname(os.path.abspath(__file__)), 'proto'))
+
+from gapis.service import service_pb2  # noqa: E402
+from gapis.service import service_pb2_grpc  # noqa: E402
+
+PORT_PATTERN = re.compile(r"^Bound on port '(\d+)'$")
+AUTH_HEADER = 'auth_token'
+
+
+class GapisError(Exception):
+    """An error returned by the GAPIS server."""
+
+    def __init__(self, error):
+        self.error = error
+        kind = error.WhichOneof('err')
+        super().__init__('{}: {}'.format(kind, getattr(error, kind) if kind else error))
+
+
+def _unwrap(res, field):
+    if res.WhichOneof('res') == 'error':
+        raise GapisError(res.error)
+    return getattr(res, field)
+
+
+class Client:
+    """A connection to a GAPIS server.
+
+    If no port is given, a new server is started from the gapis binary, and
+    stopped when the client is closed.
+    """
+
+    def __init__(self, gapis='gapis', port=0, token='', args=()):
+        self._process = None
+        if port == 0:
+            token = secrets.token_hex(8)
+            cmd = [gapis, '--enable-local-files', '--idle-timeout', '1m',
+                   '--gapis-auth-token', token] + list(args)
+            self._process = subprocess.Popen(
+                cmd, stdout=subprocess.PIPE, universal_newlines=True)
+            port = self._wait_for_port()
+        self._metadata = [(AUTH_HEADER, token)] if token else []
+        self._channel = grpc.insecure_channel('localhost:{}'.format(port))
+        self._stub = service_pb2_grpc.GapidStub(self._channel)
+
+    def _wait_for_port(self):
+        for line in self._process.stdout:
+            match = PORT_PATTERN.match(line.strip())
+            if match:
+                return int(match.group(1))
+        raise RuntimeError('GAPIS exited without binding a port')
+
+    def close(self):
+        self._channel.close()
+        if self._process:
+            self._process.terminate()
+            self._process.wait()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *args):
+        self.close()
+
+    def _call(self, rpc, req, field):
+        return _unwrap(rpc(req, metadata=self._metadata), field)
+
+    def ping(self):
+        self._stub.Ping(service_pb2.PingRequest(), metadata=self._metadata)
+
+    def load_capture(self, path):
+        """Loads the capture, or Perfetto trace, and returns its path."""
+        return self._call(self._stub.LoadCapture,
+                          service_pb2.LoadCaptureRequest(path=os.path.abspath(path)), 'capture')
+
+    def devices_for_replay(self, capture):
+        """Returns the paths of the devices the capture can be replayed on."""
+        devices = self._call(self._stub.GetDevicesForReplay,
+                             service_pb2.GetDevicesForReplayRequest(capture=capture), 'devices')
+        return [d for d, ok in zip(devices.list, devices.compatibilities) if ok]
+
+    def gpu_profile(self, capture, device=None, loop_count=1, experiments=None,
+                    bisect_command_buffers=False, prime_pipeline_caches=False):
+        """Profiles the capture on the device and returns the ProfilingData.
+
+        The device defaults to the first compatible replay device. Perfetto
+        traces are processed without a device.
+        """
+        req = service_pb2.GpuProfileRequest(
+            capture=capture,
+            loopCount=loop_count,
+            bisectCommandBuffers=bisect_command_buffers,
+            primePipelineCaches=prime_pipeline_caches)
+        if experiments is not None:
+            req.experiments.CopyFrom(experiments)
+        if device is not None:
+            req.device.CopyFrom(device)
+        return self._call(self._stub.GpuProfile, req, 'profiling_data')
+
+    def profile(self, path, **kwargs):
+        """Loads the capture file and profiles it on the first compatible
+        device, unless a device is given."""
+        capture = self.load_capture(path)
+        if 'device' not in kwargs and not path.endswith('.perfetto-trace'):
+            devices = self.devices_for_replay(capture)
+            if not devices:
+                raise RuntimeError('No compatible replay device found')
+            kwargs['device'] = devices[0]
+        return self.gpu_profile(capture, **kwargs)
+
+    def perfetto_query(self, capture, query):
+        """Runs the trace processor query on the capture's Perfetto trace."""
+        return self._call(self._stub.PerfettoQuery,
+                          service_pb2.PerfettoQueryRequest(capture=capture, query=query), 'result')
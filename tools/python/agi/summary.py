@@ -0,0 +1,68 @@
+# Copyright (C) 2021 Google Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Summaries of ProfilingData, matching gapis/client/profiling.Summarize."""
+
+import csv
+import json
+
+MAX_TOP_GROUPS = 10
+GPU_TIME_METRIC = 'GPU Time'
+GPU_WALL_TIME_METRIC = 'GPU Wall Time'
+MEDIAN_FRAME = 0  # ProfilingData.FrameSelection.Kind.Median
+
+
+def summarize(data):
+    """Returns the summary of the ProfilingData as a dict."""
+    counters = []
+    gpu_time_id = None
+    for metric in data.gpu_counters.metrics:
+        if metric.name == GPU_TIME_METRIC:
+            gpu_time_id = metric.id
+        elif metric.name != GPU_WALL_TIME_METRIC:
+            counters.append({'name': metric.name, 'unit': metric.unit, 'average': metric.average})
+
+    gpu_time, groups = 0, []
+    if gpu_time_id is not None:
+        times = {}
+        for entry in data.gpu_counters.entries:
+            if gpu_time_id in entry.metric_to_value:
+                times[entry.group_id] = int(entry.metric_to_value[gpu_time_id].estimate)
+        for group in data.slices.groups:
+            if group.parent_id == 0:
+                gpu_time += times.get(group.id, 0)
+                groups.append({'name': group.name, 'gpu_time': times.get(group.id, 0)})
+        groups.sort(key=lambda g: -g['gpu_time'])
+
+    median = [f.busy for f in data.representative_frames.frames if f.kind == MEDIAN_FRAME]
+    return {
+        'gpu_time': gpu_time,
+        'frames': len(data.gpu_idle.frames),
+        'median_frame_busy': median[0] if median else 0,
+        'top_groups': groups[:MAX_TOP_GROUPS],
+        'counters': counters,
+        'errors': [e.error for e in data.errors],
+    }
+
+
+def write_summary_json(summary, f):
+    json.dump(summary, f, indent=2)
+
+
+def write_summary_csv(summary, f):
+    """Writes the counters of the summary, one per row."""
+    w = csv.writer(f)
+    w.writerow(['counter', 'unit', 'average'])
+    for c in summary['counters']:
+        w.writerow([c['name'], c['unit'], c['average']])
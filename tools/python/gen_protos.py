@@ -0,0 +1,83 @@
+#!/usr/bin/env python3
+
+# Copyright (C) 2021 Google Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Generates the Python protobuf and gRPC modules of the GAPIS service, and all
+# the protos it depends on, into agi/proto. Requires the grpcio-tools package.
+
+import argparse
+import os
+import re
+import sys
+
+from grpc_tools import protoc
+
+SERVICE_PROTO = 'gapis/service/service.proto'
+IMPORT_PATTERN = re.compile(r'^import\s+(?:public\s+)?"([^"]+)";', re.MULTILINE)
+
+
+def find_proto(name, roots):
+    for root in roots:
+        path = os.path.join(root, name)
+        if os.path.isfile(path):
+            return path
+    raise FileNotFoundError('Cannot find {} in {}'.format(name, roots))
+
+
+def collect_protos(name, roots, seen):
+    """Adds name and all the protos it transitively imports to seen."""
+    if name in seen:
+        return
+    seen.add(name)
+    with open(find_proto(name, roots)) as f:
+        for dep in IMPORT_PATTERN.findall(f.read()):
+            if not dep.startswith('google/protobuf/'):
+                collect_protos(dep, roots, seen)
+
+
+def main():
+    here = os.path.dirname(os.path.abspath(__file__))
+    parser = argparse.ArgumentParser()
+    parser.add_argument('--agi', default=os.path.join(here, '..', '..'),
+                        help='Path to the AGI source tree')
+    parser.add_argument('--perfetto', required=True,
+                        help='Path to the Perfetto source tree')
+    parser.add_argument('--out', default=os.path.join(here, 'agi', 'proto'),
+                        help='Directory to write the generated modules to')
+    args = parser.parse_args()
+
+    roots = [os.path.abspath(args.agi), os.path.abspath(args.perfetto)]
+    protos = set()
+    collect_protos(SERVICE_PROTO, roots, protos)
+
+    os.makedirs(args.out, exist_ok=True)
+    # The generated modules import each other by their proto path.
+    for name in protos:
+        pkg = os.path.dirname(name)
+        while pkg:
+            init = os.path.join(args.out, pkg, '__init__.py')
+            os.makedirs(os.path.dirname(init), exist_ok=True)
+            open(init, 'a').close()
+            pkg = os.path.dirname(pkg)
+
+    protoc_args = ['grpc_tools.protoc', '--python_out=' + args.out,
+                   '--grpc_python_out=' + args.out]
+    protoc_args += ['-I' + root for root in roots]
+    protoc_args += sorted(protos)
+    return protoc.main(protoc_args)
+
+
+if __name__ == '__main__':
+    sys.exit(main())
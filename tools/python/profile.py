@@ -0,0 +1,54 @@
+#!/usr/bin/env python3
+
+# Copyright (C) 2021 Google Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Profiles a capture, or Perfetto trace, and writes the summary of the
+# profiling data as JSON or CSV.
+
+import argparse
+import sys
+
+import agi
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument('capture', help='Path to the .gfxtrace or .perfetto-trace file')
+    parser.add_argument('--gapis', default='gapis', help='Path to the gapis binary')
+    parser.add_argument('--port', type=int, default=0, help='Port of a running gapis')
+    parser.add_argument('--token', default='', help='Auth token of a running gapis')
+    parser.add_argument('--loop-count', type=int, default=1, help='Number of replays')
+    parser.add_argument('--format', choices=['json', 'csv'], default='json')
+    parser.add_argument('--out', help='Output file, defaults to stdout')
+    args = parser.parse_args()
+
+    with agi.Client(gapis=args.gapis, port=args.port, token=args.token) as client:
+        data = client.profile(args.capture, loop_count=args.loop_count)
+    summary = agi.summarize(data)
+
+    out = open(args.out, 'w', newline='') if args.out else sys.stdout
+    try:
+        if args.format == 'json':
+            agi.write_summary_json(summary, out)
+        else:
+            agi.write_summary_csv(summary, out)
+    finally:
+        if args.out:
+            out.close()
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())